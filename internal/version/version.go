@@ -1,8 +1,38 @@
 package version
 
+import (
+	"runtime"
+	"runtime/debug"
+)
+
 var (
 	// Version represents the application semantic version, variable will be replaced at link time after `make` has been run.
 	Version = "latest"
 	// GitHash represents the application Git SHA-1 hash, variable will be replaced at link time after `make` has been run.
 	GitHash = "<UNKNOWN>"
+	// BuildDate represents the application build date in RFC 3339 format, variable will be replaced at link time after `make` has been run.
+	BuildDate = "<UNKNOWN>"
 )
+
+// BuildInfo represents the build information of the application
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information of the application. Binaries built without `make` (eg. with `go install`) fall
+// back to the module version recorded by the Go toolchain.
+func Get() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		GitCommit: GitHash,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok && info.Version == "latest" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+		info.Version = buildInfo.Main.Version
+	}
+	return info
+}
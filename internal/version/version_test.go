@@ -0,0 +1,25 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	previousVersion, previousGitHash, previousBuildDate := Version, GitHash, BuildDate
+	defer func() {
+		Version, GitHash, BuildDate = previousVersion, previousGitHash, previousBuildDate
+	}()
+
+	Version, GitHash, BuildDate = "1.2.3", "7591664", "2020-12-01T10:00:00Z"
+	expected := BuildInfo{Version: "1.2.3", GitCommit: "7591664", BuildDate: "2020-12-01T10:00:00Z", GoVersion: runtime.Version()}
+	if info := Get(); info != expected {
+		t.Errorf("Get() = %+v, want %+v", info, expected)
+	}
+
+	// test binaries don't record a module version, so the default version is kept
+	Version = "latest"
+	if info := Get(); info.Version != "latest" {
+		t.Errorf("Get().Version = %q, want %q", info.Version, "latest")
+	}
+}
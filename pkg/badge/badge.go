@@ -9,9 +9,15 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"regexp"
 	"strings"
 	"text/template"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Style determines the type of badge to generate
@@ -26,15 +32,43 @@ const (
 )
 
 const (
+	// MaxTextLength represents the maximum number of characters of the subject & status texts,
+	// longer texts are truncated with an ellipsis
+	MaxTextLength = 200
 	// DefaultColor represents the default color
 	DefaultColor string = "#f7b137"
 	// DefaultStyle represents the default style
 	DefaultStyle Style = ClassicStyle
+	// Height represents the height in pixels of badges of every style
+	Height = 20
+	// DefaultIconSize represents the default width & height in pixels of icons
+	DefaultIconSize = 13
+	// MinIconSize represents the minimum width & height in pixels of icons
+	MinIconSize = 8
+	// MaxIconSize represents the maximum width & height in pixels of icons
+	MaxIconSize = 18
+	// DefaultLogoWidth represents the default width in pixels reserved for logos
+	DefaultLogoWidth = 14
+	// MaxLogoWidth represents the maximum width in pixels reserved for logos
+	MaxLogoWidth = 100
+	// logoHeight represents the height in pixels of logos
+	logoHeight = 14
+	// iconPadding represents the space in pixels between the icon & the subject text
+	iconPadding = 3
 )
 
 // SupportedStyles contains a list of all supported badge styles
 var SupportedStyles = [...]Style{ClassicStyle, FlatStyle, PlasticStyle, SemaphoreCIStyle}
 
+// Direction determines the writing direction of the texts of a badge
+type Direction string
+
+// List of supported text directions
+const (
+	LeftToRight Direction = "ltr"
+	RightToLeft Direction = "rtl"
+)
+
 // Params holds badge parameters
 type Params struct {
 	// Subject determines the subject text of the badge.
@@ -42,12 +76,130 @@ type Params struct {
 	// Status determines the status text of the badge.
 	Status string
 	// Color determines the highlight color of the badge.
-	// Valid color values includes CSS color names (up to CSS Color Module Level 3) or HEX values (eg. "coral", "#1bacbf", "1bacbf", "fff", "#fff")
+	// Valid color values includes shields.io color names, CSS color names (up to CSS Color Module Level 3) or HEX values (eg. "brightgreen", "coral", "#1bacbf", "1bacbf", "fff", "#fff")
 	Color string
+	// LabelColor determines the background color of the subject (left-hand side) of the badge.
+	// Accepts the same color values as Color, defaults to the style's label color.
+	LabelColor string
 	// Icon determines whether the badge should include icons or not (eg. "brands/docker", "regular/credit-card", "solid/anchor")
 	Icon string
+	// IconColor determines the fill color of the icon, accepts the same color values as Color.
+	// Defaults to the color of the subject text.
+	IconColor string
+	// IconSize determines the width & height in pixels of the icon, clamped between `MinIconSize` & `MaxIconSize`.
+	// Defaults to `DefaultIconSize`.
+	IconSize int
+	// Logo determines a custom image drawn in place of the icon, as a base64-encoded SVG or PNG data URI
+	// (eg. "data:image/png;base64,..."). Other values are ignored.
+	Logo string
+	// LogoWidth determines the width in pixels reserved for the logo, up to `MaxLogoWidth`.
+	// Defaults to `DefaultLogoWidth`.
+	LogoWidth int
+	// Links determines the http(s) URLs navigated to when clicking the badge, a single link covers the whole badge while
+	// 2 links cover the subject & the status respectively. Other URLs & links beyond the first 2 are ignored.
+	Links []string
 	// Style determines the visual style of the badge
 	Style Style
+	// Sparkline determines the values of a sparkline drawn after the status text, missing values are represented by NaN.
+	// Sparklines with fewer than `MinSparklinePoints` values are omitted.
+	Sparkline []float64
+	// Title determines the tooltip text of the badge, defaults to the accessible label of the badge
+	// (eg. "stars: 1234").
+	Title string
+	// Segments determines the segments drawn after the subject in place of the status, each with its own text, color &
+	// icon (eg. "★ 1.2k | ⑂ 340"). Status, Color, Icon, Logo, Links & Sparkline are ignored by multi-segment badges.
+	Segments []Segment
+	// Truncate determines the maximum number of characters of the subject & status texts (& of the texts of the
+	// segments), longer texts are truncated with an ellipsis. Disabled if not positive.
+	Truncate int
+	// MaxWidth determines the maximum width in pixels of the badge, the wider of the subject & status texts is
+	// truncated with an ellipsis until the badge fits, down to a single ellipsis each. Multi-segment badges keep as
+	// many leading segments as fit instead, down to a single segment. Disabled if not positive.
+	MaxWidth int
+	// Direction determines the writing direction of the subject & status texts (& of the texts of the segments).
+	// Defaults to the direction of the first letter of each text, ie. right to left for Hebrew or Arabic letters.
+	Direction Direction
+}
+
+// logoDataURIPattern matches the base64-encoded SVG & PNG data URIs that can be embedded as logos
+var logoDataURIPattern = regexp.MustCompile(`^data:image/(svg\+xml|png);base64,[A-Za-z0-9+/]+={0,2}$`)
+
+// Errors returned by `Params.Validate`, wrapped in a `ParamError`
+var (
+	ErrUnknownStyle     = errors.New("unsupported style")
+	ErrUnknownDirection = errors.New("unsupported direction")
+	ErrInvalidColor     = errors.New("invalid color")
+	ErrTextTooLong      = fmt.Errorf("longer than %d characters", MaxTextLength)
+)
+
+// ParamError represents an invalid badge parameter
+type ParamError struct {
+	// Param is the name of the invalid parameter (eg. "color", "labelColor")
+	Param string
+	Err   error
+}
+
+func (err *ParamError) Error() string {
+	return "invalid " + err.Param + ": " + err.Err.Error()
+}
+
+// Unwrap returns the reason of the invalid badge parameter
+func (err *ParamError) Unwrap() error {
+	return err.Err
+}
+
+// Validate returns a `*ParamError` for the first badge parameter that would be altered when generating the badge,
+// ie. unsupported styles & directions, invalid colors & texts longer than `MaxTextLength` characters. Empty parameters are valid.
+func (params *Params) Validate() error {
+	if params.Style != "" {
+		supported := false
+		for _, style := range SupportedStyles {
+			if params.Style == style {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return &ParamError{Param: "style", Err: ErrUnknownStyle}
+		}
+	}
+	if params.Direction != "" && params.Direction != LeftToRight && params.Direction != RightToLeft {
+		return &ParamError{Param: "direction", Err: ErrUnknownDirection}
+	}
+	for _, color := range []struct {
+		param string
+		value string
+	}{
+		{"color", params.Color},
+		{"labelColor", params.LabelColor},
+		{"iconColor", params.IconColor},
+	} {
+		if color.value != "" && !IsValidColor(color.value) {
+			return &ParamError{Param: color.param, Err: ErrInvalidColor}
+		}
+	}
+	for i, segment := range params.Segments {
+		if segment.Color != "" && !IsValidColor(segment.Color) {
+			return &ParamError{Param: fmt.Sprintf("segments[%d].color", i), Err: ErrInvalidColor}
+		}
+		if utf8.RuneCountInString(segment.Text) > MaxTextLength {
+			return &ParamError{Param: fmt.Sprintf("segments[%d].text", i), Err: ErrTextTooLong}
+		}
+	}
+	for _, text := range []struct {
+		param string
+		value string
+	}{
+		{"subject", params.Subject},
+		{"status", params.Status},
+		{"title", params.Title},
+	} {
+		if utf8.RuneCountInString(text.value) > MaxTextLength {
+			return &ParamError{Param: text.param, Err: ErrTextTooLong}
+		}
+	}
+
+	return nil
 }
 
 // badgeDimensions holds dimensions required for generating SVG badge
@@ -55,35 +207,176 @@ type badgeDimensions struct {
 	Style        Style
 	Template     *template.Template
 	Color        string
+	LabelColor   string
 	FontFamily   string
 	FontSize     int
 	PaddingInner int
 	PaddingOuter int
 	TotalWidth   int
+	Height       int
 
 	Status          string
 	StatusFontColor string
 	StatusOffset    int
 	StatusTextWidth int
 	StatusWidth     int
+	StatusX         int
+	StatusRTL       bool
 
 	Subject          string
 	SubjectFontColor string
 	SubjectOffset    int
 	SubjectTextWidth int
 	SubjectWidth     int
+	SubjectX         int
+	SubjectRTL       bool
+
+	IconID     string
+	IconLabel  string
+	IconHref   string
+	IconOffset int
+	IconWidth  int
+	IconHeight int
+	IconY      int
+
+	Sparklines []string
+
+	Segments []badgeSegment
+
+	// subjectText & statusText hold the unescaped subject & status texts, as truncated to fit the badge
+	subjectText string
+	statusText  string
+
+	Links []badgeLink
+
+	Title     string
+	AriaLabel string
+}
+
+// badgeLink holds the URL & the clickable area of a badge link
+type badgeLink struct {
+	Href  string
+	X     int
+	Width int
+}
+
+// accessibleLabel returns the text read by screen readers for the badge, composed from its subject & status texts
+func accessibleLabel(subject string, status string) string {
+	if subject == "" || status == "" {
+		return subject + status
+	}
+
+	return subject + ": " + status
+}
+
+// isTextRightToLeft returns whether the text is written from right to left, in the direction if set or in the
+// direction of its first letter otherwise
+func isTextRightToLeft(text string, direction Direction) bool {
+	if direction != "" {
+		return direction == RightToLeft
+	}
+
+	return isRightToLeft(text)
+}
+
+// textX returns the horizontal position of the text anchor, which is the right edge of right-to-left texts
+func textX(offset int, width int, rightToLeft bool) int {
+	if rightToLeft {
+		return offset + width
+	}
+
+	return offset
+}
+
+// iconDataURI returns the data URI of the icon filled with the color, if the icon exists
+func iconDataURI(icon string, color string) (string, bool) {
+	svgIcon, ok := fontAwesomeIcons[icon]
+	if !ok {
+		return "", false
+	}
+
+	// Icons are single-path SVGs, so filling the root element recolors the whole icon. Encode icon into a base64
+	// string.
+	modifiedSvgIcon := "<svg fill=\"" + color + "\"" + svgIcon[len("<svg"):]
+	return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(modifiedSvgIcon)), true
+}
+
+// isLinkURL reports whether the URL can be embedded as a badge link
+func isLinkURL(link string) bool {
+	linkURL, err := url.Parse(link)
+	return err == nil && (linkURL.Scheme == "http" || linkURL.Scheme == "https") && linkURL.Host != ""
+}
+
+// sanitizeText strips control characters from the text & truncates it to `MaxTextLength` characters
+func sanitizeText(text string) string {
+	runes := make([]rune, 0, len(text))
+	for _, r := range text {
+		if !unicode.IsControl(r) {
+			runes = append(runes, r)
+		}
+	}
+
+	return ellipsize(runes, MaxTextLength)
+}
+
+// ellipsize returns the first `length` characters of the text, ending with an ellipsis if the text is longer
+func ellipsize(runes []rune, length int) string {
+	if len(runes) <= length {
+		return string(runes)
+	}
+
+	return strings.TrimRightFunc(string(runes[:length-1]), unicode.IsSpace) + "…"
+}
+
+// truncateText truncates the text to `length` characters with an ellipsis, unless the length isn't positive
+func truncateText(text string, length int) string {
+	if length <= 0 {
+		return text
+	}
+
+	return ellipsize([]rune(text), length)
+}
+
+// fitTexts truncates the wider of the subject & status texts with an ellipsis, one character at a time, until their
+// total width is within the maximum width or both are down to a single ellipsis
+func fitTexts(subject string, status string, maxWidth int, textWidth func(text string) int) (string, string) {
+	subjectRunes, statusRunes := []rune(subject), []rune(status)
+	subjectLength, statusLength := len(subjectRunes), len(statusRunes)
+	subjectWidth, statusWidth := textWidth(subject), textWidth(status)
+	for subjectWidth+statusWidth > maxWidth {
+		switch {
+		case statusLength > 1 && (statusWidth >= subjectWidth || subjectLength <= 1):
+			statusLength--
+			status = ellipsize(statusRunes, statusLength)
+			statusWidth = textWidth(status)
+		case subjectLength > 1:
+			subjectLength--
+			subject = ellipsize(subjectRunes, subjectLength)
+			subjectWidth = textWidth(subject)
+		default:
+			return subject, status
+		}
+	}
+
+	return subject, status
+}
 
-	IconLabel     string
-	IconBase64Str string
-	IconOffset    int
+// escapeText escapes the text so that it can be safely embedded into the SVG badge
+func escapeText(text string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(text))
+	return buf.String()
 }
 
 // generateBadge converts badge parameters into dimensions for generating SVG badge
 func generateBadge(params *Params) (*badgeDimensions, error) {
-	badgeParams := params
-	if badgeParams == nil {
-		badgeParams = &Params{}
+	badgeParams := &Params{}
+	if params != nil {
+		*badgeParams = *params
 	}
+	badgeParams.Subject = truncateText(sanitizeText(badgeParams.Subject), badgeParams.Truncate)
+	badgeParams.Status = truncateText(sanitizeText(badgeParams.Status), badgeParams.Truncate)
+	badgeParams.Title = sanitizeText(badgeParams.Title)
 	badgeColor := parseColor(badgeParams.Color)
 	if badgeColor == "" {
 		badgeColor = DefaultColor
@@ -100,12 +393,13 @@ func generateBadge(params *Params) (*badgeDimensions, error) {
 			Style:            FlatStyle,
 			Template:         badgeTemplates[FlatStyle],
 			Color:            badgeColor,
+			LabelColor:       "#555",
 			FontFamily:       "Verdana",
 			FontSize:         11,
 			PaddingInner:     4,
 			PaddingOuter:     6,
 			Status:           badgeParams.Status,
-			StatusFontColor:  "#fff",
+			StatusFontColor:  textColor(badgeColor),
 			Subject:          badgeParams.Subject,
 			SubjectFontColor: "#fff",
 		}
@@ -114,12 +408,13 @@ func generateBadge(params *Params) (*badgeDimensions, error) {
 			Style:            PlasticStyle,
 			Template:         badgeTemplates[PlasticStyle],
 			Color:            badgeColor,
+			LabelColor:       "#555",
 			FontFamily:       "Verdana",
 			FontSize:         11,
 			PaddingInner:     4,
 			PaddingOuter:     6,
 			Status:           badgeParams.Status,
-			StatusFontColor:  "#fff",
+			StatusFontColor:  textColor(badgeColor),
 			Subject:          badgeParams.Subject,
 			SubjectFontColor: "#fff",
 		}
@@ -128,12 +423,13 @@ func generateBadge(params *Params) (*badgeDimensions, error) {
 			Style:            SemaphoreCIStyle,
 			Template:         badgeTemplates[SemaphoreCIStyle],
 			Color:            badgeColor,
+			LabelColor:       "#f1f1f1",
 			FontFamily:       "Verdana",
 			FontSize:         9,
 			PaddingInner:     10,
 			PaddingOuter:     10,
 			Status:           strings.ToUpper(badgeParams.Status),
-			StatusFontColor:  "#fff",
+			StatusFontColor:  textColor(badgeColor),
 			Subject:          strings.ToUpper(badgeParams.Subject),
 			SubjectFontColor: "#888",
 		}
@@ -144,17 +440,85 @@ func generateBadge(params *Params) (*badgeDimensions, error) {
 			Style:            ClassicStyle,
 			Template:         badgeTemplates[ClassicStyle],
 			Color:            badgeColor,
+			LabelColor:       "#555",
 			FontFamily:       "Verdana",
 			FontSize:         11,
 			PaddingInner:     4,
 			PaddingOuter:     6,
 			Status:           badgeParams.Status,
-			StatusFontColor:  "#fff",
+			StatusFontColor:  textColor(badgeColor),
 			Subject:          badgeParams.Subject,
 			SubjectFontColor: "#fff",
 		}
 	}
 
+	if labelColor := parseColor(badgeParams.LabelColor); labelColor != "" {
+		newBadge.LabelColor = labelColor
+		newBadge.SubjectFontColor = textColor(labelColor)
+	}
+
+	if len(badgeParams.Segments) > 0 {
+		return generateSegmentedBadge(&newBadge, badgeParams)
+	}
+
+	if badgeParams.Icon != "" {
+		iconColor := parseColor(badgeParams.IconColor)
+		if iconColor == "" {
+			iconColor = newBadge.SubjectFontColor
+		}
+		if iconHref, ok := iconDataURI(badgeParams.Icon, iconColor); ok {
+			iconSize := badgeParams.IconSize
+			switch {
+			case iconSize == 0:
+				iconSize = DefaultIconSize
+			case iconSize < MinIconSize:
+				iconSize = MinIconSize
+			case iconSize > MaxIconSize:
+				iconSize = MaxIconSize
+			}
+
+			newBadge.IconID = "icon"
+			newBadge.IconLabel = badgeParams.Icon
+			newBadge.IconHref = iconHref
+			newBadge.IconWidth = iconSize
+			newBadge.IconHeight = iconSize
+			newBadge.IconY = (Height - iconSize) / 2
+			newBadge.IconOffset = iconPadding + iconSize
+		}
+	}
+
+	if logoDataURIPattern.MatchString(badgeParams.Logo) {
+		logoWidth := badgeParams.LogoWidth
+		switch {
+		case logoWidth <= 0:
+			logoWidth = DefaultLogoWidth
+		case logoWidth > MaxLogoWidth:
+			logoWidth = MaxLogoWidth
+		}
+
+		newBadge.IconID = "logo"
+		newBadge.IconLabel = "logo"
+		newBadge.IconHref = badgeParams.Logo
+		newBadge.IconWidth = logoWidth
+		newBadge.IconHeight = logoHeight
+		newBadge.IconY = (Height - logoHeight) / 2
+		newBadge.IconOffset = iconPadding + logoWidth
+	}
+
+	if badgeParams.MaxWidth > 0 {
+		fixedWidth := 2*newBadge.PaddingOuter + 2*newBadge.PaddingInner + newBadge.IconOffset
+		if len(sparklinePolylines(badgeParams.Sparkline, 0)) > 0 {
+			fixedWidth += sparklineWidth + newBadge.PaddingInner
+		}
+		newBadge.Subject, newBadge.Status = fitTexts(newBadge.Subject, newBadge.Status, badgeParams.MaxWidth-fixedWidth,
+			func(text string) int {
+				width, _ := computeTextWidth(text, newBadge.FontSize, newBadge.FontFamily)
+				return width
+			})
+	}
+	newBadge.subjectText = newBadge.Subject
+	newBadge.statusText = newBadge.Status
+
 	subjectTextWidth, err := computeTextWidth(newBadge.Subject, newBadge.FontSize,
 		newBadge.FontFamily)
 	if err != nil {
@@ -167,17 +531,6 @@ func generateBadge(params *Params) (*badgeDimensions, error) {
 		return nil, err
 	}
 
-	if badgeParams.Icon != "" {
-		svgIcon, ok := fontAwesomeIcons[badgeParams.Icon]
-		if ok {
-			// Encode icon into a base64 string
-			modifiedSvgIcon := "<svg fill=\"" + newBadge.SubjectFontColor + "\"" + svgIcon[len("<svg"):]
-			newBadge.IconLabel = badgeParams.Icon
-			newBadge.IconBase64Str = base64.StdEncoding.EncodeToString([]byte(modifiedSvgIcon))
-			newBadge.IconOffset = 3 + 13 // IconPadding + IconSize
-		}
-	}
-
 	newBadge.SubjectOffset = newBadge.PaddingOuter + newBadge.IconOffset
 	newBadge.SubjectTextWidth = subjectTextWidth
 	newBadge.SubjectWidth = newBadge.SubjectOffset + subjectTextWidth + newBadge.PaddingInner
@@ -186,37 +539,103 @@ func generateBadge(params *Params) (*badgeDimensions, error) {
 	newBadge.StatusTextWidth = statusTextWidth
 	newBadge.StatusWidth = newBadge.PaddingInner + statusTextWidth + newBadge.PaddingOuter
 
+	newBadge.SubjectRTL = isTextRightToLeft(newBadge.Subject, badgeParams.Direction)
+	newBadge.SubjectX = textX(newBadge.SubjectOffset, subjectTextWidth, newBadge.SubjectRTL)
+	newBadge.StatusRTL = isTextRightToLeft(newBadge.Status, badgeParams.Direction)
+	newBadge.StatusX = textX(newBadge.StatusOffset, statusTextWidth, newBadge.StatusRTL)
+
+	sparklineOffset := newBadge.StatusOffset + statusTextWidth + newBadge.PaddingInner
+	if sparklines := sparklinePolylines(badgeParams.Sparkline, sparklineOffset); len(sparklines) > 0 {
+		newBadge.Sparklines = sparklines
+		newBadge.StatusWidth += sparklineWidth + newBadge.PaddingInner
+	}
+
 	newBadge.TotalWidth = newBadge.SubjectWidth + newBadge.StatusWidth
+	newBadge.Height = Height
+
+	switch links := badgeParams.Links; {
+	case len(links) == 1:
+		if isLinkURL(links[0]) {
+			newBadge.Links = []badgeLink{{Href: escapeText(links[0]), Width: newBadge.TotalWidth}}
+		}
+	case len(links) >= 2:
+		if isLinkURL(links[0]) {
+			newBadge.Links = append(newBadge.Links, badgeLink{Href: escapeText(links[0]), Width: newBadge.SubjectWidth})
+		}
+		if isLinkURL(links[1]) {
+			newBadge.Links = append(newBadge.Links, badgeLink{Href: escapeText(links[1]), X: newBadge.SubjectWidth, Width: newBadge.StatusWidth})
+		}
+	}
+
+	label := accessibleLabel(newBadge.Subject, newBadge.Status)
+	title := badgeParams.Title
+	if title == "" {
+		title = label
+	}
+	newBadge.Subject = escapeText(newBadge.Subject)
+	newBadge.Status = escapeText(newBadge.Status)
+	newBadge.Title = escapeText(title)
+	newBadge.AriaLabel = escapeText(label)
 
 	if newBadge.Template == nil {
-		return nil, fmt.Errorf("Badge template does not exist: %s", params.Style)
+		return nil, fmt.Errorf("Badge template does not exist: %s", badgeParams.Style)
 	}
 
 	return &newBadge, nil
 }
 
+// Size holds the dimensions in pixels of a generated SVG badge
+type Size struct {
+	Width  int
+	Height int
+}
+
 // Create generates a SVG badge
 func Create(params *Params) (string, error) {
+	generatedBadge, _, err := CreateWithSize(params)
+	return generatedBadge, err
+}
+
+// CreateWithSize generates a SVG badge & returns it along with its dimensions, which match the width & height
+// attributes of its root element
+func CreateWithSize(params *Params) (string, Size, error) {
 	newBadge, err := generateBadge(params)
 	if err != nil {
-		return "", err
+		return "", Size{}, err
 	}
 
-	var buf bytes.Buffer
+	var buf strings.Builder
 	if err = newBadge.Template.Execute(&buf, newBadge); err != nil {
-		return "", err
+		return "", Size{}, err
+	}
+
+	return buf.String(), Size{Width: newBadge.TotalWidth, Height: newBadge.Height}, nil
+}
+
+// Render generates a SVG badge & streams it into the writer, without buffering the whole badge in memory
+func Render(w io.Writer, params *Params) error {
+	newBadge, err := generateBadge(params)
+	if err != nil {
+		return err
 	}
 
-	return buf.String(), nil
+	return newBadge.Template.Execute(w, newBadge)
 }
 
 type imageNode struct {
 	XMLName xml.Name `xml:"image"`
 	ID      string   `xml:"id,attr"`
 	Alt     string   `xml:"alt,attr"`
+	Width   int      `xml:"width,attr"`
+	Height  int      `xml:"height,attr"`
 	Href    string   `xml:"href,attr"`
 }
 
+type iconNode struct {
+	XMLName xml.Name `xml:"svg"`
+	Fill    string   `xml:"fill,attr"`
+}
+
 type pathNode struct {
 	XMLName xml.Name `xml:"path"`
 	ID      string   `xml:"id,attr"`
@@ -226,15 +645,52 @@ type pathNode struct {
 type textNode struct {
 	XMLName  xml.Name `xml:"text"`
 	ID       string   `xml:"id,attr"`
+	Fill     string   `xml:"fill,attr"`
 	CharData string   `xml:",chardata"`
 }
 
+// useNode represents the text of a badge drawn over its shadow, which the text reuses
+type useNode struct {
+	XMLName xml.Name `xml:"use"`
+	Href    string   `xml:"href,attr"`
+	Fill    string   `xml:"fill,attr"`
+}
+
+type linkNode struct {
+	XMLName xml.Name `xml:"a"`
+	Href    string   `xml:"href,attr"`
+	Rect    struct {
+		X     int `xml:"x,attr"`
+		Width int `xml:"width,attr"`
+	} `xml:"rect"`
+}
+
 type svg struct {
 	XMLName xml.Name    `xml:"svg"`
 	ID      string      `xml:"id,attr"`
+	Width   int         `xml:"width,attr"`
+	Links   []linkNode  `xml:"a"`
+	Title   string      `xml:"title"`
 	Images  []imageNode `xml:"g>image"`
 	Paths   []pathNode  `xml:"g>path"`
 	Texts   []textNode  `xml:"g>text"`
+	// Shadows represents the shadows of the texts of styles with shadows, reused by the texts
+	Shadows []textNode `xml:"g>g>text"`
+	Uses    []useNode  `xml:"g>use"`
+}
+
+// extractIconFill returns the fill color of the base64-encoded SVG icon embedded by `Create`
+func extractIconFill(href string) string {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(href, "data:image/svg+xml;base64,"))
+	if err != nil {
+		return ""
+	}
+	icon := new(iconNode)
+	if err := xml.Unmarshal(data, icon); err != nil {
+		return ""
+	}
+
+	return icon.Fill
 }
 
 // ExtractParams parses a SVG badge generated by `Create` & returns the corresponding badge parameters
@@ -245,34 +701,91 @@ func ExtractParams(badge string) (*Params, error) {
 	}
 
 	result := new(Params)
+	result.Title = svgObj.Title
+	var iconFill string
 	for _, image := range svgObj.Images {
 		if image.ID == "icon" {
 			result.Icon = image.Alt
+			if image.Height != DefaultIconSize {
+				result.IconSize = image.Height
+			}
+			iconFill = extractIconFill(image.Href)
+		}
+		if image.ID == "logo" {
+			result.Logo = image.Href
+			if image.Width != DefaultLogoWidth {
+				result.LogoWidth = image.Width
+			}
 		}
 	}
+	var leftLink, rightLink string
+	for _, link := range svgObj.Links {
+		switch {
+		case link.Rect.Width == svgObj.Width:
+			result.Links = []string{link.Href}
+		case link.Rect.X == 0:
+			leftLink = link.Href
+		default:
+			rightLink = link.Href
+		}
+	}
+	if leftLink != "" || rightLink != "" {
+		result.Links = []string{leftLink, rightLink}
+	}
+	var labelColor string
 	for _, path := range svgObj.Paths {
 		if path.ID == "fill" {
 			result.Color = strings.ToLower(path.Fill)
 		}
+		if path.ID == "label" {
+			labelColor = strings.ToLower(path.Fill)
+		}
+	}
+	for _, shadow := range svgObj.Shadows {
+		for _, use := range svgObj.Uses {
+			if use.Href == "#"+shadow.ID {
+				shadow.Fill = use.Fill
+				svgObj.Texts = append(svgObj.Texts, shadow)
+			}
+		}
 	}
 	for _, text := range svgObj.Texts {
 		if text.ID == "subject" {
 			result.Subject = text.CharData
+			if iconFill != "" && iconFill != text.Fill {
+				result.IconColor = iconFill
+			}
 		}
 		if text.ID == "status" {
 			result.Status = text.CharData
 		}
 	}
+	if result.Title == accessibleLabel(result.Subject, result.Status) {
+		result.Title = ""
+	}
 	for _, style := range SupportedStyles {
+		styleLabelColor := labelColor
+		if defaultBadge, err := generateBadge(&Params{Style: style}); err == nil &&
+			defaultBadge.LabelColor == labelColor {
+			styleLabelColor = ""
+		}
 		newBadge, _ := Create(&Params{
-			Style:   style,
-			Subject: result.Subject,
-			Status:  result.Status,
-			Color:   result.Color,
-			Icon:    result.Icon,
+			Style:      style,
+			Subject:    result.Subject,
+			Status:     result.Status,
+			Color:      result.Color,
+			LabelColor: styleLabelColor,
+			Icon:       result.Icon,
+			IconColor:  result.IconColor,
+			IconSize:   result.IconSize,
+			Logo:       result.Logo,
+			LogoWidth:  result.LogoWidth,
+			Links:      result.Links,
+			Title:      result.Title,
 		})
 		if newBadge == badge {
 			result.Style = style
+			result.LabelColor = styleLabelColor
 			break
 		}
 	}
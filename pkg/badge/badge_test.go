@@ -1,13 +1,26 @@
 package badge
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/bradleyjkemp/cupaloy"
 	"github.com/stretchr/testify/assert"
 )
 
+const (
+	testPNGLogo = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+	testSVGLogo = "data:image/svg+xml;base64,PHN2ZyB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciIHZpZXdCb3g9IjAgMCAxIDEiPjxyZWN0IHdpZHRoPSIxIiBoZWlnaHQ9IjEiLz48L3N2Zz4="
+)
+
 type testCase struct {
 	name     string
 	input    Params
@@ -61,12 +74,12 @@ var testCases = (func() []testCase {
 			{
 				name:     testNamePrefix + "BadgeWithColorName1",
 				input:    Params{Style: testStyle, Color: "red"},
-				expected: Params{Style: expectedStyle, Color: "red"},
+				expected: Params{Style: expectedStyle, Color: "#e05d44"},
 			},
 			{
 				name:     testNamePrefix + "BadgeWithColorName2",
 				input:    Params{Style: testStyle, Color: "RED"},
-				expected: Params{Style: expectedStyle, Color: "red"},
+				expected: Params{Style: expectedStyle, Color: "#e05d44"},
 			},
 			{
 				name:     testNamePrefix + "BadgeWithInvalidColorName",
@@ -103,11 +116,101 @@ var testCases = (func() []testCase {
 				input:    Params{Style: testStyle, Color: "#f7b137aa"},
 				expected: Params{Style: expectedStyle, Color: DefaultColor},
 			},
+			{
+				name:     testNamePrefix + "BadgeWithLightLabelColor",
+				input:    Params{Style: testStyle, LabelColor: "ffff00"},
+				expected: Params{Style: expectedStyle, Color: DefaultColor, LabelColor: "#ffff00"},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithDarkLabelColor",
+				input:    Params{Style: testStyle, LabelColor: "navy"},
+				expected: Params{Style: expectedStyle, Color: DefaultColor, LabelColor: "navy"},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithLabelColorAlias",
+				input:    Params{Style: testStyle, LabelColor: "informational"},
+				expected: Params{Style: expectedStyle, Color: DefaultColor, LabelColor: "#007ec6"},
+			},
 			{
 				name:     testNamePrefix + "BadgeWithIcon",
 				input:    Params{Style: testStyle, Icon: "solid/star"},
 				expected: Params{Style: expectedStyle, Color: DefaultColor, Icon: "solid/star"},
 			},
+			{
+				name:     testNamePrefix + "BadgeWithIconColor",
+				input:    Params{Style: testStyle, Subject: testSubject, Icon: "brands/github", IconColor: "orange"},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Color: DefaultColor, Icon: "brands/github", IconColor: "#fe7d37"},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithSmallIcon",
+				input:    Params{Style: testStyle, Subject: testSubject, Icon: "brands/github", IconSize: 10},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Color: DefaultColor, Icon: "brands/github", IconSize: 10},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithLargeIcon",
+				input:    Params{Style: testStyle, Subject: testSubject, Icon: "brands/github", IconSize: 16},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Color: DefaultColor, Icon: "brands/github", IconSize: 16},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithOversizedIcon",
+				input:    Params{Style: testStyle, Icon: "brands/github", IconSize: 100},
+				expected: Params{Style: expectedStyle, Color: DefaultColor, Icon: "brands/github", IconSize: MaxIconSize},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithInvalidIconColor",
+				input:    Params{Style: testStyle, Icon: "brands/github", IconColor: "rainbow"},
+				expected: Params{Style: expectedStyle, Color: DefaultColor, Icon: "brands/github"},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithIconOptionsWithoutIcon",
+				input:    Params{Style: testStyle, Icon: "invalid-icon", IconColor: "orange", IconSize: 16},
+				expected: Params{Style: expectedStyle, Color: DefaultColor},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithPNGLogo",
+				input:    Params{Style: testStyle, Subject: testSubject, Logo: testPNGLogo},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Color: DefaultColor, Logo: testPNGLogo},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithSVGLogo",
+				input:    Params{Style: testStyle, Subject: testSubject, Logo: testSVGLogo},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Color: DefaultColor, Logo: testSVGLogo},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithWideLogo",
+				input:    Params{Style: testStyle, Subject: testSubject, Logo: testPNGLogo, LogoWidth: 40},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Color: DefaultColor, Logo: testPNGLogo, LogoWidth: 40},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithLogoAndIcon",
+				input:    Params{Style: testStyle, Icon: "solid/star", Logo: testSVGLogo},
+				expected: Params{Style: expectedStyle, Color: DefaultColor, Logo: testSVGLogo},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithInvalidLogo",
+				input:    Params{Style: testStyle, Icon: "solid/star", Logo: `data:text/html;base64,PHNjcmlwdD4="><script>`},
+				expected: Params{Style: expectedStyle, Color: DefaultColor, Icon: "solid/star"},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithLink",
+				input:    Params{Style: testStyle, Subject: testSubject, Status: testStatus, Links: []string{"https://github.com/tohjustin/aegis"}},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Status: expectedStatus, Color: DefaultColor, Links: []string{"https://github.com/tohjustin/aegis"}},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithLinks",
+				input:    Params{Style: testStyle, Subject: testSubject, Status: testStatus, Links: []string{"https://github.com/tohjustin/aegis", "http://example.com/?a=1&b=2"}},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Status: expectedStatus, Color: DefaultColor, Links: []string{"https://github.com/tohjustin/aegis", "http://example.com/?a=1&b=2"}},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithUnsafeLink",
+				input:    Params{Style: testStyle, Subject: testSubject, Status: testStatus, Links: []string{"javascript:alert(1)", "https://example.com"}},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Status: expectedStatus, Color: DefaultColor, Links: []string{"", "https://example.com"}},
+			},
+			{
+				name:     testNamePrefix + "BadgeWithInvalidLinks",
+				input:    Params{Style: testStyle, Subject: testSubject, Status: testStatus, Links: []string{"/relative", "ftp://example.com"}},
+				expected: Params{Style: expectedStyle, Subject: expectedSubject, Status: expectedStatus, Color: DefaultColor},
+			},
 			{
 				name:     testNamePrefix + "BadgeWithInvalidIcon1",
 				input:    Params{Style: testStyle, Icon: "solid/STAR"},
@@ -158,3 +261,664 @@ func TestBadgeCreate(t *testing.T) {
 		})
 	}
 }
+
+func TestBadgeLabelTextColor(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		labelColor        string
+		expectedFontColor string
+	}{
+		{"ffff00", "#333"},
+		{"#fff", "#333"},
+		{"lightyellow", "#333"},
+		{"navy", "#fff"},
+		{"#000", "#fff"},
+		{"critical", "#fff"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.labelColor, func(t *testing.T) {
+			for _, style := range SupportedStyles {
+				newBadge, err := generateBadge(&Params{Style: style, LabelColor: testCase.labelColor})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				assert.Equal(t, testCase.expectedFontColor, newBadge.SubjectFontColor)
+			}
+		})
+	}
+}
+
+func TestBadgeStatusTextColor(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		color             string
+		expectedFontColor string
+	}{
+		{"ffff00", "#333"},
+		{"#FF0", "#333"},
+		{"lightyellow", "#333"},
+		{"", "#333"},
+		{"1bacbf", "#fff"},
+		{"#000", "#fff"},
+		{"success", "#fff"},
+		{"critical", "#fff"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.color, func(t *testing.T) {
+			for _, style := range SupportedStyles {
+				newBadge, err := generateBadge(&Params{Style: style, Color: testCase.color})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				assert.Equal(t, testCase.expectedFontColor, newBadge.StatusFontColor)
+			}
+		})
+	}
+}
+
+var unsafeTextTestCases = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{"Markup", `"><script>alert(1)</script>`, `"><script>alert(1)</script>`},
+	{"Ampersand", "a & b", "a & b"},
+	{"Quotes", `'single' "double"`, `'single' "double"`},
+	{"Emoji", "🚀 launched", "🚀 launched"},
+	{"Latin1", "ÿ", "ÿ"},
+	{"ControlCharacters", "a\x00b\x1bc\u0085d", "abcd"},
+	{"LongText", strings.Repeat("a", 1000), strings.Repeat("a", MaxTextLength-1) + "…"},
+	{"LongMultiByteText", strings.Repeat("状", 300), strings.Repeat("状", MaxTextLength-1) + "…"},
+}
+
+func TestSanitizeText(t *testing.T) {
+	t.Parallel()
+
+	for _, testCase := range unsafeTextTestCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, sanitizeText(testCase.input))
+		})
+	}
+	assert.Equal(t, strings.Repeat("a", MaxTextLength), sanitizeText(strings.Repeat("a", MaxTextLength)))
+}
+
+func TestBadgeCreateEscapesText(t *testing.T) {
+	t.Parallel()
+
+	for _, testCase := range unsafeTextTestCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			for _, style := range SupportedStyles {
+				newBadge, err := Create(&Params{Style: style, Subject: testCase.input, Status: testCase.input})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				assert.NoError(t, xml.Unmarshal([]byte(newBadge), new(svg)))
+				assert.NotContains(t, newBadge, "<script")
+				newBadgeParams, err := ExtractParams(newBadge)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if style == SemaphoreCIStyle {
+					assert.Equal(t, strings.ToUpper(testCase.expected), newBadgeParams.Subject)
+					assert.Equal(t, strings.ToUpper(testCase.expected), newBadgeParams.Status)
+				} else {
+					assert.Equal(t, testCase.expected, newBadgeParams.Subject)
+					assert.Equal(t, testCase.expected, newBadgeParams.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestBadgeCreateWithTitle(t *testing.T) {
+	t.Parallel()
+
+	for _, style := range SupportedStyles {
+		newBadge, err := Create(&Params{Style: style, Subject: "health", Status: "healthy", Title: `score <82> & "up"`})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Contains(t, newBadge, "<title>score &lt;82&gt; &amp; &#34;up&#34;</title>")
+		newBadgeParams, err := ExtractParams(newBadge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, `score <82> & "up"`, newBadgeParams.Title)
+		assert.Equal(t, style, newBadgeParams.Style)
+	}
+
+	newBadge, err := Create(&Params{Subject: "health", Status: "healthy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, newBadge, "<title>health: healthy</title>")
+	assert.Contains(t, newBadge, `aria-label="health: healthy"`)
+}
+
+func TestBadgeAccessibility(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name              string
+		params            Params
+		expectedTitle     string
+		expectedAriaLabel string
+	}{
+		{"Badge", Params{Subject: "stars", Status: "1234"}, "stars: 1234", "stars: 1234"},
+		{"Title", Params{Subject: "health", Status: "82", Title: "health score: 82/100"}, "health score: 82/100", "health: 82"},
+		{"UnsafeText", Params{Subject: `<a href="#">`, Status: "a & b"}, `<a href="#">: a & b`, `<a href="#">: a & b`},
+		{"NoSubject", Params{Status: "passing"}, "passing", "passing"},
+		{"NoStatus", Params{Subject: "build"}, "build", "build"},
+		{"SemaphoreCIStyle", Params{Subject: "stars", Status: "1234", Style: SemaphoreCIStyle}, "STARS: 1234", "STARS: 1234"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			newBadge, err := Create(&testCase.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var root struct {
+				Role      string `xml:"role,attr"`
+				AriaLabel string `xml:"aria-label,attr"`
+				Title     string `xml:"title"`
+			}
+			if err := xml.Unmarshal([]byte(newBadge), &root); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "img", root.Role)
+			assert.Equal(t, testCase.expectedTitle, root.Title)
+			assert.Equal(t, testCase.expectedAriaLabel, root.AriaLabel)
+		})
+	}
+}
+
+func TestBadgeCreateWithSize(t *testing.T) {
+	t.Parallel()
+
+	for _, style := range SupportedStyles {
+		var widthWithoutIcon int
+		for _, icon := range []string{"", "brands/docker"} {
+			newBadge, size, err := CreateWithSize(&Params{Style: style, Subject: "testSubject", Status: "testStatus", Icon: icon})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var root struct {
+				Width  int `xml:"width,attr"`
+				Height int `xml:"height,attr"`
+			}
+			if err := xml.Unmarshal([]byte(newBadge), &root); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, root.Width, size.Width, "style %q, icon %q", style, icon)
+			assert.Equal(t, root.Height, size.Height, "style %q, icon %q", style, icon)
+			assert.Equal(t, Height, size.Height)
+			if icon == "" {
+				widthWithoutIcon = size.Width
+			} else {
+				assert.True(t, size.Width > widthWithoutIcon, "style %q: icon doesn't widen badge", style)
+			}
+		}
+	}
+}
+
+func TestBadgeIconSize(t *testing.T) {
+	t.Parallel()
+
+	for _, style := range SupportedStyles {
+		var previousWidth int
+		for _, iconSize := range []int{MinIconSize, DefaultIconSize, MaxIconSize} {
+			newBadge, err := generateBadge(&Params{Style: style, Subject: "testSubject", Icon: "brands/github", IconSize: iconSize})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, iconSize, newBadge.IconWidth)
+			assert.Equal(t, Height, 2*newBadge.IconY+iconSize+iconSize%2, "style %q: icon isn't vertically centered", style)
+			assert.Equal(t, newBadge.PaddingOuter+iconPadding+iconSize, newBadge.SubjectOffset)
+			assert.True(t, newBadge.TotalWidth > previousWidth, "style %q: larger icon doesn't widen badge", style)
+			previousWidth = newBadge.TotalWidth
+		}
+	}
+}
+
+func TestBadgeRender(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range testCases {
+		t.Run(spec.name, func(t *testing.T) {
+			newBadge, err := Create(&spec.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := Render(&buf, &spec.input); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, newBadge, buf.String())
+		})
+	}
+}
+
+func TestParamsValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		params        Params
+		expectedParam string
+		expectedErr   error
+	}{
+		{"Empty", Params{}, "", nil},
+		{"Valid", Params{Subject: "stars", Status: "1.2k", Color: "1bacbf", LabelColor: "navy", IconColor: "#fff", Style: FlatStyle}, "", nil},
+		{"LongestText", Params{Subject: strings.Repeat("a", MaxTextLength), Status: strings.Repeat("状", MaxTextLength)}, "", nil},
+		{"UnknownStyle", Params{Style: "flat-square"}, "style", ErrUnknownStyle},
+		{"RightToLeft", Params{Subject: "כוכבים", Direction: RightToLeft}, "", nil},
+		{"UnknownDirection", Params{Direction: "ttb"}, "direction", ErrUnknownDirection},
+		{"InvalidColor", Params{Color: "#zzz"}, "color", ErrInvalidColor},
+		{"InvalidLabelColor", Params{LabelColor: "#f7b1"}, "labelColor", ErrInvalidColor},
+		{"InvalidIconColor", Params{IconColor: "rainbow"}, "iconColor", ErrInvalidColor},
+		{"LongSubject", Params{Subject: strings.Repeat("a", MaxTextLength+1)}, "subject", ErrTextTooLong},
+		{"LongStatus", Params{Status: strings.Repeat("状", MaxTextLength+1)}, "status", ErrTextTooLong},
+		{"LongTitle", Params{Title: strings.Repeat("a", MaxTextLength+1)}, "title", ErrTextTooLong},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := testCase.params.Validate()
+			if testCase.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var paramErr *ParamError
+			if assert.True(t, errors.As(err, &paramErr), "unexpected error: %v", err) {
+				assert.Equal(t, testCase.expectedParam, paramErr.Param)
+			}
+			assert.True(t, errors.Is(err, testCase.expectedErr), "unexpected error: %v", err)
+		})
+	}
+}
+
+// benchmarkParams represents the parameters of a typical badge
+var benchmarkParams = &Params{Subject: "stars", Status: "1.2k", Color: "blue", Icon: "brands/github", Title: "stars: 1234"}
+
+func BenchmarkCreate(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Create(benchmarkParams); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := Render(ioutil.Discard, benchmarkParams); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// urlReference matches the references to paint servers & clip paths
+var urlReference = regexp.MustCompile(`^url\(#(.+)\)$`)
+
+// assertBadgeMarkup asserts that the badge is well-formed XML without whitespace between its elements, along with the
+// SVG images it embeds, & that its references are consistent
+func assertBadgeMarkup(t *testing.T, newBadge string) {
+	assert.NotRegexp(t, `>\s+<`, newBadge)
+
+	// Every paint server & clip path must be referenced & every reference must be defined
+	ids := map[string]bool{}
+	definitions := map[string]bool{}
+	references := map[string]bool{}
+	var uses []string
+	usesXLink := false
+	decoder := xml.NewDecoder(strings.NewReader(newBadge))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid XML: %v", err)
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range element.Attr {
+			if attr.Name.Local == "id" {
+				ids[attr.Value] = true
+			}
+			switch {
+			case attr.Name.Local == "id" && (element.Name.Local == "linearGradient" || element.Name.Local == "clipPath"):
+				definitions[attr.Value] = true
+			case urlReference.MatchString(attr.Value):
+				references[urlReference.FindStringSubmatch(attr.Value)[1]] = true
+			case attr.Name.Local == "href" && element.Name.Local == "use":
+				uses = append(uses, strings.TrimPrefix(attr.Value, "#"))
+			case attr.Name.Local == "href" && strings.HasPrefix(attr.Value, "data:image/svg+xml;base64,"):
+				image, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(attr.Value, "data:image/svg+xml;base64,"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := xml.Unmarshal(image, new(struct{})); err != nil {
+					t.Fatalf("invalid XML of image: %v", err)
+				}
+			}
+			if attr.Name.Space == "http://www.w3.org/1999/xlink" {
+				usesXLink = true
+			}
+		}
+		// Elements are referenced with `xlink:href` too, for renderers predating SVG 2 (eg. Safari before 12.1)
+		if element.Name.Local == "use" {
+			hrefs := map[string]string{}
+			for _, attr := range element.Attr {
+				if attr.Name.Local == "href" {
+					hrefs[attr.Name.Space] = attr.Value
+				}
+			}
+			assert.Equal(t, hrefs[""], hrefs["http://www.w3.org/1999/xlink"])
+		}
+	}
+	assert.Equal(t, definitions, references)
+	for _, id := range uses {
+		assert.True(t, ids[id], "undefined element %q", id)
+	}
+	assert.Equal(t, usesXLink, strings.Contains(newBadge, "xmlns:xlink"))
+}
+
+func TestBadgeMarkup(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range testCases {
+		t.Run(spec.name, func(t *testing.T) {
+			newBadge, err := Create(&spec.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertBadgeMarkup(t, newBadge)
+		})
+	}
+
+	// every style is well-formed with icons, links, sparklines, segments & international texts
+	for _, style := range SupportedStyles {
+		for _, spec := range append(markupTestCases, internationalTestCases...) {
+			params := spec.input
+			params.Style = style
+			t.Run(spec.name+"/"+string(style), func(t *testing.T) {
+				newBadge, err := Create(&params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertBadgeMarkup(t, newBadge)
+			})
+		}
+	}
+}
+
+func TestBadgeSize(t *testing.T) {
+	t.Parallel()
+
+	// Byte budgets of a typical badge & of a badge with a detailed icon, which are served far too often for their
+	// markup to grow unnoticed
+	testCases := []struct {
+		style        Style
+		expected     int
+		expectedIcon int
+	}{
+		{ClassicStyle, 900, 2010},
+		{FlatStyle, 630, 1740},
+		{PlasticStyle, 1030, 2140},
+		{SemaphoreCIStyle, 540, 1690},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(string(testCase.style), func(t *testing.T) {
+			newBadge, err := Create(&Params{Subject: "build", Status: "passing", Color: "green", Style: testCase.style})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.LessOrEqual(t, len(newBadge), testCase.expected)
+
+			newBadge, err = Create(&Params{Subject: "stars", Status: "1.2k", Icon: "brands/airbnb", Style: testCase.style})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.LessOrEqual(t, len(newBadge), testCase.expectedIcon)
+		})
+	}
+}
+
+// truncationTestCases represents badges with truncated & untruncated texts
+var truncationTestCases = []struct {
+	name  string
+	input Params
+}{
+	{"Untruncated", Params{Subject: "stars", Status: "1.2k", Truncate: 10, MaxWidth: 200}},
+	{"Truncate", Params{Subject: "description", Status: "Packet decoding for the Go language", Truncate: 12}},
+	{"MaxWidth", Params{Subject: "description", Status: "Packet decoding for the Go language", MaxWidth: 150}},
+	{"MaxWidthWithIcon", Params{Subject: "description", Status: "Packet decoding for the Go language", Icon: "brands/github", MaxWidth: 150}},
+	{"MaxWidthWithLongSubject", Params{Subject: "a very long subject of the badge", Status: "ok", MaxWidth: 100}},
+	{"MultiByteTruncate", Params{Subject: "説明", Status: "日本語のパケット解析ライブラリ", Truncate: 6}},
+	{"MultiByteMaxWidth", Params{Subject: "説明", Status: "日本語のパケット解析ライブラリ", MaxWidth: 100}},
+}
+
+func TestSnapshotBadgeTruncation(t *testing.T) {
+	t.Parallel()
+
+	for _, style := range SupportedStyles {
+		for _, testCase := range truncationTestCases {
+			params := testCase.input
+			params.Style = style
+			t.Run(testCase.name+"/"+string(style), func(t *testing.T) {
+				result, err := Create(&params)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				cupaloy.SnapshotT(t, result)
+			})
+		}
+	}
+}
+
+func TestBadgeTruncation(t *testing.T) {
+	t.Parallel()
+
+	for _, style := range SupportedStyles {
+		for _, testCase := range truncationTestCases {
+			params := testCase.input
+			params.Style = style
+			newBadge, size, err := CreateWithSize(&params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			extracted, err := ExtractParams(newBadge)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, text := range []struct{ input, output string }{
+				{params.Subject, extracted.Subject},
+				{params.Status, extracted.Status},
+			} {
+				// truncated texts keep whole characters & end with an ellipsis
+				assert.True(t, utf8.ValidString(text.output), "%s/%s: %q", testCase.name, style, text.output)
+				if !strings.EqualFold(text.input, text.output) {
+					assert.True(t, strings.HasSuffix(text.output, "…"), "%s/%s: %q", testCase.name, style, text.output)
+					assert.True(t, strings.HasPrefix(strings.ToUpper(text.input), strings.ToUpper(strings.TrimSuffix(text.output, "…"))),
+						"%s/%s: %q", testCase.name, style, text.output)
+				}
+				if params.Truncate > 0 {
+					assert.True(t, utf8.RuneCountInString(text.output) <= params.Truncate, "%s/%s: %q", testCase.name, style, text.output)
+				}
+			}
+			if params.MaxWidth > 0 {
+				assert.True(t, size.Width <= params.MaxWidth, "%s/%s: %d", testCase.name, style, size.Width)
+			}
+			if testCase.name == "Untruncated" {
+				assert.True(t, strings.EqualFold(params.Status, extracted.Status))
+			}
+		}
+	}
+}
+
+func TestBadgeMaxWidthTooNarrow(t *testing.T) {
+	t.Parallel()
+
+	// texts are truncated down to a single ellipsis each, even if the badge is still wider
+	newBadge, err := Create(&Params{Subject: "subject", Status: "status", MaxWidth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extracted, err := ExtractParams(newBadge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "…", extracted.Subject)
+	assert.Equal(t, "…", extracted.Status)
+}
+
+func TestTruncateText(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "abc", truncateText("abc", 0))
+	assert.Equal(t, "abc", truncateText("abc", 3))
+	assert.Equal(t, "a…", truncateText("abc", 2))
+	assert.Equal(t, "ab…", truncateText("ab cd", 4))
+	assert.Equal(t, "日本…", truncateText("日本語です", 3))
+}
+
+// markupTestCases represents badges covering the markup of every style
+var markupTestCases = []struct {
+	name  string
+	input Params
+}{
+	{"Badge", Params{Subject: "build", Status: "passing", Color: "green"}},
+	{"Icon", Params{Subject: "stars", Status: "1.2k", Icon: "brands/github"}},
+	{"IconColor", Params{Subject: "license", Status: "MIT", Icon: "solid/balance-scale", IconColor: "#fe7d37"}},
+	{"IconOnly", Params{Status: "4.5k", Icon: "regular/star"}},
+	{"DetailedIcon", Params{Subject: "republic", Status: "old", Icon: "brands/old-republic", IconSize: MaxIconSize}},
+	{"Links", Params{Subject: "docs", Status: "latest", Links: []string{"https://example.com/a", "https://example.com/b"}}},
+	{"Sparkline", Params{Subject: "commits", Status: "128", Sparkline: []float64{3, 8, 1, 9, 4, 12, 7}}},
+	{"Segments", Params{Subject: "gopacket", Segments: []Segment{
+		{Text: "1.23k", Color: "#f7b137", Icon: "regular/star", Label: "stars: 1.23k"},
+		{Text: "forks 567", Color: "blue", Label: "forks: 567"},
+	}}},
+}
+
+// internationalTestCases represents badges with texts of various scripts
+var internationalTestCases = []struct {
+	name  string
+	input Params
+}{
+	{"Hebrew", Params{Subject: "כוכבים", Status: "1.2k"}},
+	{"Arabic", Params{Subject: "النجوم", Status: "مستقر"}},
+	{"Japanese", Params{Subject: "ビルド", Status: "成功"}},
+	{"Emoji", Params{Subject: "🚀 release", Status: "v1.2.0 ✨"}},
+	{"ExplicitRightToLeft", Params{Subject: "stars", Status: "1.2k", Direction: RightToLeft}},
+	{"ExplicitLeftToRight", Params{Subject: "כוכבים", Status: "1.2k", Direction: LeftToRight}},
+}
+
+func TestSnapshotBadgeInternationalText(t *testing.T) {
+	t.Parallel()
+
+	for _, style := range SupportedStyles {
+		for _, testCase := range internationalTestCases {
+			params := testCase.input
+			params.Style = style
+			t.Run(testCase.name+"/"+string(style), func(t *testing.T) {
+				result, err := Create(&params)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				cupaloy.SnapshotT(t, result)
+			})
+		}
+	}
+}
+
+func TestBadgeTextDirection(t *testing.T) {
+	t.Parallel()
+
+	type text struct {
+		ID         string `xml:"id,attr"`
+		X          int    `xml:"x,attr"`
+		TextLength int    `xml:"textLength,attr"`
+		Direction  string `xml:"direction,attr"`
+		CharData   string `xml:",chardata"`
+	}
+	var root struct {
+		Texts   []text `xml:"g>text"`
+		Shadows []text `xml:"g>g>text"`
+	}
+	for _, style := range SupportedStyles {
+		for _, testCase := range internationalTestCases {
+			params := testCase.input
+			params.Style = style
+			newBadge, err := Create(&params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root.Texts, root.Shadows = nil, nil
+			if err := xml.Unmarshal([]byte(newBadge), &root); err != nil {
+				t.Fatalf("%s/%s: %v", testCase.name, style, err)
+			}
+
+			// right-to-left texts are anchored at their right edge
+			texts := map[string]text{}
+			for _, text := range append(root.Texts, root.Shadows...) {
+				texts[text.ID] = text
+			}
+			newDimensions, err := generateBadge(&params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range []struct {
+				id, text string
+				offset   int
+			}{
+				{"subject", params.Subject, newDimensions.SubjectOffset},
+				{"status", params.Status, newDimensions.StatusOffset},
+			} {
+				rightToLeft := isTextRightToLeft(expected.text, params.Direction)
+				text := texts[expected.id]
+				assert.True(t, text.TextLength > 0, "%s/%s: %s", testCase.name, style, expected.id)
+				if rightToLeft {
+					assert.Equal(t, "rtl", text.Direction, "%s/%s: %s", testCase.name, style, expected.id)
+					assert.Equal(t, expected.offset+text.TextLength, text.X, "%s/%s: %s", testCase.name, style, expected.id)
+				} else {
+					assert.Equal(t, "", text.Direction, "%s/%s: %s", testCase.name, style, expected.id)
+					assert.Equal(t, expected.offset, text.X, "%s/%s: %s", testCase.name, style, expected.id)
+				}
+			}
+		}
+	}
+}
+
+func TestSegmentedBadgeTextDirection(t *testing.T) {
+	t.Parallel()
+
+	newBadge, err := Create(&Params{Subject: "כוכבים", Segments: []Segment{{Text: "1.2k"}, {Text: "מזלגות 340"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, newBadge, `direction="rtl">כוכבים</text>`)
+	assert.Contains(t, newBadge, `direction="rtl">מזלגות 340</text>`)
+	assert.NotContains(t, newBadge, `direction="rtl">1.2k</text>`)
+}
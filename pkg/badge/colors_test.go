@@ -49,6 +49,27 @@ var cssColorTestCases = []struct {
 	{"rebeccapurple", false}, // CSS Level 4 (not supported)
 }
 
+var colorAliasTestCases = []struct {
+	input    string
+	expected string
+}{
+	{"brightgreen", "#4c1"},
+	{"green", "#97ca00"},
+	{"yellowgreen", "#a4a61d"},
+	{"yellow", "#dfb317"},
+	{"orange", "#fe7d37"},
+	{"red", "#e05d44"},
+	{"blue", "#007ec6"},
+	{"lightgrey", "#9f9f9f"},
+	{"success", "#4c1"},
+	{"important", "#fe7d37"},
+	{"critical", "#e05d44"},
+	{"informational", "#007ec6"},
+	{"inactive", "#9f9f9f"},
+	{"BrightGreen", "#4c1"},
+	{"CRITICAL", "#e05d44"},
+}
+
 func TestIsValidHexColor(t *testing.T) {
 	t.Parallel()
 
@@ -68,13 +89,29 @@ func TestIsValidCSSColorName(t *testing.T) {
 		})
 	}
 }
+
+func TestParseColorAliases(t *testing.T) {
+	t.Parallel()
+
+	for _, testCase := range colorAliasTestCases {
+		t.Run(testCase.input, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, parseColor(testCase.input))
+			assert.True(t, IsValidColor(testCase.input))
+		})
+	}
+}
+
 func TestParseColor(t *testing.T) {
 	t.Parallel()
 
 	for cssColorName := range cssColorNames {
+		expected := cssColorName
+		if hexColor, ok := colorAliases[cssColorName]; ok {
+			expected = hexColor
+		}
 		t.Run("TestParseColor-"+cssColorName, func(t *testing.T) {
 			result := parseColor(cssColorName)
-			assert.Equal(t, result, cssColorName)
+			assert.Equal(t, result, expected)
 		})
 	}
 
@@ -90,3 +127,35 @@ func TestParseColor(t *testing.T) {
 	assert.Equal(t, "", parseColor("#f7baa"))
 	assert.Equal(t, "", parseColor("#f7b1"))
 }
+
+func TestTextColor(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		backgroundColor string
+		expected        string
+	}{
+		{"#ffff00", "#333"},
+		{"#fff", "#333"},
+		{"#ffffff", "#333"},
+		{"#f7b137", "#333"},
+		{"#dfb317", "#fff"},
+		{"#000", "#fff"},
+		{"#555", "#fff"},
+		{"#1bacbf", "#fff"},
+		{"yellow", "#fff"},
+		{"lightyellow", "#333"},
+		{"white", "#333"},
+		{"navy", "#fff"},
+		{"brightgreen", "#fff"},
+		{"critical", "#fff"},
+		{"informational", "#fff"},
+		{"inactive", "#fff"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.backgroundColor, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, textColor(parseColor(testCase.backgroundColor)))
+		})
+	}
+}
@@ -1,11 +1,108 @@
 package badge
 
-import "fmt"
+import (
+	"fmt"
+	"unicode"
+)
 
-const fallbackCharCode = 64 // @
+const (
+	fallbackCharCode = 64 // @
+	// narrowFallbackCharCode represents the character whose width is used for the letters of scripts missing from the
+	// width tables that are drawn with glyphs of about the width of latin letters (eg. Hebrew, Arabic)
+	narrowFallbackCharCode = 110 // n
+	// zeroWidthJoiner joins the characters around it into a single glyph (eg. emoji sequences)
+	zeroWidthJoiner = '\u200d'
+)
+
+// wideChars represents the characters drawn as wide as the font size, ie. the East Asian wide & fullwidth characters
+// (eg. CJK ideographs, Hiragana, Katakana, Hangul) & emojis
+var wideChars = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x1100, Hi: 0x115f, Stride: 1}, // Hangul Jamo
+		{Lo: 0x231a, Hi: 0x231b, Stride: 1}, // Watch & hourglass
+		{Lo: 0x2e80, Hi: 0x303e, Stride: 1}, // CJK Radicals Supplement to CJK Symbols and Punctuation
+		{Lo: 0x3041, Hi: 0x33ff, Stride: 1}, // Hiragana to CJK Compatibility
+		{Lo: 0x3400, Hi: 0x4dbf, Stride: 1}, // CJK Unified Ideographs Extension A
+		{Lo: 0x4e00, Hi: 0x9fff, Stride: 1}, // CJK Unified Ideographs
+		{Lo: 0xa000, Hi: 0xa4cf, Stride: 1}, // Yi Syllables & Yi Radicals
+		{Lo: 0xac00, Hi: 0xd7a3, Stride: 1}, // Hangul Syllables
+		{Lo: 0xf900, Hi: 0xfaff, Stride: 1}, // CJK Compatibility Ideographs
+		{Lo: 0xfe30, Hi: 0xfe4f, Stride: 1}, // CJK Compatibility Forms
+		{Lo: 0xff00, Hi: 0xff60, Stride: 1}, // Fullwidth Forms
+		{Lo: 0xffe0, Hi: 0xffe6, Stride: 1}, // Fullwidth Signs
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f300, Hi: 0x1f64f, Stride: 1}, // Miscellaneous Symbols and Pictographs & Emoticons
+		{Lo: 0x1f680, Hi: 0x1f6ff, Stride: 1}, // Transport and Map Symbols
+		{Lo: 0x1f900, Hi: 0x1f9ff, Stride: 1}, // Supplemental Symbols and Pictographs
+		{Lo: 0x20000, Hi: 0x2fffd, Stride: 1}, // CJK Unified Ideographs Extension B to CJK Compatibility Ideographs Supplement
+		{Lo: 0x30000, Hi: 0x3fffd, Stride: 1}, // CJK Unified Ideographs Extension G
+	},
+}
+
+// zeroWidthChars represents the characters drawn without advancing the text, ie. combining marks (eg. accents,
+// Arabic & Hebrew vowel marks, variation selectors), format characters (eg. joiners, directional marks) & emoji skin
+// tone modifiers
+var zeroWidthChars = []*unicode.RangeTable{
+	unicode.Mn,
+	unicode.Me,
+	unicode.Cf,
+	{R32: []unicode.Range32{{Lo: 0x1f3fb, Hi: 0x1f3ff, Stride: 1}}},
+}
+
+// narrowChars represents the characters missing from the width tables that are drawn about as wide as latin letters
+var narrowChars = []*unicode.RangeTable{
+	unicode.Hebrew,
+	unicode.Arabic,
+	unicode.Syriac,
+	unicode.Thaana,
+	unicode.Nko,
+	{R16: []unicode.Range16{{Lo: 0xff61, Hi: 0xffdc, Stride: 1}}}, // Halfwidth Forms
+}
+
+// rightToLeftScripts represents the scripts written from right to left
+var rightToLeftScripts = []*unicode.RangeTable{
+	unicode.Hebrew,
+	unicode.Arabic,
+	unicode.Syriac,
+	unicode.Thaana,
+	unicode.Nko,
+	unicode.Samaritan,
+	unicode.Mandaic,
+}
+
+// isRightToLeft returns whether the text is written from right to left, ie. whether its first strong character (ie.
+// its first letter) belongs to a right-to-left script
+func isRightToLeft(text string) bool {
+	for _, character := range text {
+		if unicode.IsOneOf(rightToLeftScripts, character) {
+			return true
+		}
+		if unicode.IsLetter(character) {
+			return false
+		}
+	}
+	return false
+}
+
+// charWidth returns the width in pixels of the character, from the width table or from the kind of the characters
+// missing from the width table
+func charWidth(character rune, charWidthTable []int, fontSize int) int {
+	switch {
+	case int(character) < len(charWidthTable):
+		return charWidthTable[character]
+	case unicode.IsOneOf(zeroWidthChars, character):
+		return 0
+	case unicode.Is(wideChars, character):
+		return fontSize
+	case unicode.IsOneOf(narrowChars, character):
+		return charWidthTable[narrowFallbackCharCode]
+	default:
+		return charWidthTable[fallbackCharCode]
+	}
+}
 
 func computeTextWidth(text string, fontSize int, fontFamily string) (int, error) {
-	textArray := []rune(text)
 	textWidth := 0
 
 	var charWidthTable []int
@@ -22,13 +119,13 @@ func computeTextWidth(text string, fontSize int, fontFamily string) (int, error)
 		return 0, fmt.Errorf("unsupported font family: %s", fontFamily)
 	}
 
-	charWidthTableSize := len(charWidthTable)
-	for _, character := range textArray {
-		charCode := int(character)
-		if charCode > charWidthTableSize {
-			charCode = fallbackCharCode
+	joined := false
+	for _, character := range text {
+		// Characters joined to the previous one are drawn as part of its glyph
+		if !joined {
+			textWidth += charWidth(character, charWidthTable, fontSize)
 		}
-		textWidth += charWidthTable[charCode]
+		joined = character == zeroWidthJoiner
 	}
 
 	return textWidth, nil
@@ -0,0 +1,87 @@
+package badge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func textWidth(t *testing.T, text string, fontSize int) int {
+	width, err := computeTextWidth(text, fontSize, "Verdana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return width
+}
+
+func TestComputeTextWidth(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		text     string
+		expected int
+	}{
+		{"Latin", "stars", 28},
+		{"Japanese", "日本語のパケット", 8 * 11},
+		{"HalfwidthKatakana", "ｶﾀｶﾅ", 4 * 7},
+		{"Korean", "한국어", 3 * 11},
+		{"Hebrew", "עברית", 5 * 7},
+		{"Arabic", "عربي", 4 * 7},
+		{"Emoji", "🚀✨", 11 + 11},
+		{"EmojiWithSkinTone", "👍🏽", 11},
+		{"EmojiSequence", "👩\u200d💻", 11},
+		{"EmojiWithVariationSelector", "❤️", 11},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, testCase.expected, textWidth(t, testCase.text, 11))
+		})
+	}
+}
+
+func TestComputeTextWidthWithCombiningCharacters(t *testing.T) {
+	t.Parallel()
+
+	// combining marks are drawn on top of the previous character
+	assert.Equal(t, textWidth(t, "e", 11), textWidth(t, "é", 11))
+	assert.Equal(t, textWidth(t, "שלום", 11), textWidth(t, "שָׁלוֹם", 11))
+	assert.Equal(t, textWidth(t, "مرحبا", 11), textWidth(t, "مَرْحَبًا", 11))
+	assert.Equal(t, textWidth(t, "ab", 9), textWidth(t, "a\u200fb", 9))
+}
+
+func TestComputeTextWidthWithWideCharacters(t *testing.T) {
+	t.Parallel()
+
+	// wide characters are as wide as the font size
+	for _, fontSize := range []int{9, 11} {
+		assert.Equal(t, 2*fontSize, textWidth(t, "状態", fontSize))
+		assert.Equal(t, 2*fontSize, textWidth(t, "😀🎉", fontSize))
+	}
+}
+
+func TestIsRightToLeft(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		text     string
+		expected bool
+	}{
+		{"stars", false},
+		{"עברית", true},
+		{"عربي", true},
+		{"日本語", false},
+		{"42 כוכבים", true},
+		{"v1.2 عربي", false},
+		{"🚀", false},
+		{"", false},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, isRightToLeft(testCase.text), testCase.text)
+	}
+}
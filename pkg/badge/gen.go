@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -157,7 +158,7 @@ package badge
 // iconName -> svg
 var fontAwesomeIcons = map[string]string{
 	{{- range .Icons}}
-	"{{.Name}}": ` + "`" + `{{.Value | minifyString}}` + "`" + `,
+	"{{.Name}}": ` + "`" + `{{.Value | minifyString | minifyPaths}}` + "`" + `,
 	{{- end}}
 }
 `),
@@ -180,8 +181,183 @@ func t(text string) *template.Template {
 		"minifyString": func(s string) string {
 			return regexp.MustCompile(`[\n\r\t]`).ReplaceAllString(s, "")
 		},
+		"minifyPaths": func(s string) string {
+			return pathDataAttr.ReplaceAllStringFunc(s, func(attr string) string {
+				d, err := minifyPathData(pathDataAttr.FindStringSubmatch(attr)[1])
+				if err != nil {
+					log.Fatalln(err)
+				}
+				return ` d="` + d + `"`
+			})
+		},
 		"stringifyIntSlice": func(s []int) string {
 			return fmt.Sprintf("[...]int {%s}", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(s)), ","), "[]"))
 		},
 	}).Parse(text))
 }
+
+// pathDataAttr matches the path data attributes of SVG elements
+var pathDataAttr = regexp.MustCompile(` d="([^"]*)"`)
+
+// pathNumber matches the number at the start of path data
+var pathNumber = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?`)
+
+// pathArgCounts represents the number of arguments of each path command
+var pathArgCounts = map[byte]int{'m': 2, 'l': 2, 'h': 1, 'v': 1, 'c': 6, 's': 4, 'q': 4, 't': 2, 'a': 7, 'z': 0}
+
+// minifyPathData rounds the coordinates of the path data to one decimal, which is a fraction of a pixel at the sizes of
+// the icons, & drops the separators that aren't needed. Relative coordinates are rounded relative to the rounded
+// current point, so that rounding errors don't add up along the path.
+func minifyPathData(d string) (string, error) {
+	var out strings.Builder
+	var last string
+	write := func(value string, isFlag bool) {
+		if last != "" && last != "flag" && !strings.HasPrefix(value, "-") &&
+			!(strings.HasPrefix(value, ".") && strings.Contains(last, ".")) {
+			out.WriteByte(' ')
+		}
+		if last == "flag" && !strings.HasPrefix(value, "-") {
+			out.WriteByte(' ')
+		}
+		out.WriteString(value)
+		last = value
+		if isFlag {
+			last = "flag"
+		}
+	}
+	writeCommand := func(command byte) {
+		out.WriteByte(command)
+		last = ""
+	}
+
+	// exact & rounded represent the current point of the path & of the minified path, & so do the starts of the
+	// subpaths
+	var exact, rounded, exactStart, roundedStart [2]float64
+	var command byte
+	i := 0
+	skip := func() {
+		for i < len(d) && strings.IndexByte(" ,\t\n\r", d[i]) >= 0 {
+			i++
+		}
+	}
+	number := func() (float64, error) {
+		skip()
+		match := pathNumber.FindString(d[i:])
+		if match == "" {
+			return 0, fmt.Errorf("invalid path data at %d: %q", i, d)
+		}
+		i += len(match)
+		return strconv.ParseFloat(match, 64)
+	}
+	for {
+		skip()
+		if i >= len(d) {
+			break
+		}
+		if c := d[i]; strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", c) >= 0 {
+			command = c
+			writeCommand(c)
+			i++
+		} else if command == 0 {
+			return "", fmt.Errorf("missing path command at %d: %q", i, d)
+		}
+		lower := command | 0x20
+		relative := command == lower
+		if lower == 'z' {
+			exact, rounded = exactStart, roundedStart
+			continue
+		}
+
+		args := make([]float64, pathArgCounts[lower])
+		for j := range args {
+			// The large arc & sweep flags are single digits that may not be followed by a separator
+			if lower == 'a' && (j == 3 || j == 4) {
+				skip()
+				if i >= len(d) || (d[i] != '0' && d[i] != '1') {
+					return "", fmt.Errorf("invalid arc flag at %d: %q", i, d)
+				}
+				args[j] = float64(d[i] - '0')
+				i++
+				continue
+			}
+			var err error
+			if args[j], err = number(); err != nil {
+				return "", err
+			}
+		}
+
+		// Coordinates are rounded as absolute coordinates, then made relative to the rounded current point
+		coordinate := func(value float64, axis int) string {
+			target := value
+			if relative {
+				target += exact[axis]
+			}
+			roundedTarget := roundDecimal(target)
+			if relative {
+				return formatDecimal(roundedTarget - rounded[axis])
+			}
+			return formatDecimal(roundedTarget)
+		}
+		next := exact
+		nextRounded := rounded
+		endpoint := func(value float64, axis int) {
+			target := value
+			if relative {
+				target += exact[axis]
+			}
+			next[axis], nextRounded[axis] = target, roundDecimal(target)
+		}
+		switch lower {
+		case 'h', 'v':
+			axis := 0
+			if lower == 'v' {
+				axis = 1
+			}
+			write(coordinate(args[0], axis), false)
+			endpoint(args[0], axis)
+		case 'a':
+			write(formatDecimal(roundDecimal(args[0])), false)
+			write(formatDecimal(roundDecimal(args[1])), false)
+			write(formatDecimal(roundDecimal(args[2])), false)
+			write(strconv.Itoa(int(args[3])), true)
+			write(strconv.Itoa(int(args[4])), true)
+			write(coordinate(args[5], 0), false)
+			write(coordinate(args[6], 1), false)
+			endpoint(args[5], 0)
+			endpoint(args[6], 1)
+		default:
+			for j := 0; j < len(args); j += 2 {
+				write(coordinate(args[j], 0), false)
+				write(coordinate(args[j+1], 1), false)
+			}
+			endpoint(args[len(args)-2], 0)
+			endpoint(args[len(args)-1], 1)
+		}
+		exact, rounded = next, nextRounded
+		if lower == 'm' {
+			exactStart, roundedStart = exact, rounded
+			// Coordinates following a move are lines
+			command -= 'm' - 'l'
+		}
+	}
+	return out.String(), nil
+}
+
+// roundDecimal rounds the number to one decimal
+func roundDecimal(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+// formatDecimal formats the number with one decimal at most & without leading zero
+func formatDecimal(value float64) string {
+	formatted := strconv.FormatFloat(roundDecimal(value), 'f', -1, 64)
+	switch {
+	case formatted == "-0":
+		return "0"
+	case strings.HasPrefix(formatted, "0."):
+		return formatted[1:]
+	case strings.HasPrefix(formatted, "-0."):
+		return "-" + formatted[2:]
+	}
+	return formatted
+}
@@ -0,0 +1,169 @@
+package badge
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	// pngGlyphAdvance represents the width in pixels of each character of PNG badges, including the space after it
+	pngGlyphAdvance = 6
+	// pngGlyphTop represents the row of the top of the characters of PNG badges
+	pngGlyphTop = 7
+)
+
+// pngCornerRadius represents the radius in pixels of the corners of PNG badges by style, same as SVG badges
+var pngCornerRadius = map[Style]int{
+	ClassicStyle:     3,
+	FlatStyle:        0,
+	PlasticStyle:     3,
+	SemaphoreCIStyle: 2,
+}
+
+// pngFont represents the 5x8 bitmap glyphs of the printable ASCII characters (from space to `~`) drawn on PNG badges,
+// as columns whose bits represent the rows from the top (least significant bit) down to the descender
+var pngFont = [95][5]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, {0x00, 0x00, 0x5f, 0x00, 0x00}, {0x00, 0x07, 0x00, 0x07, 0x00}, {0x14, 0x7f, 0x14, 0x7f, 0x14},
+	{0x24, 0x2a, 0x7f, 0x2a, 0x12}, {0x23, 0x13, 0x08, 0x64, 0x62}, {0x36, 0x49, 0x56, 0x20, 0x50}, {0x00, 0x08, 0x07, 0x03, 0x00},
+	{0x00, 0x1c, 0x22, 0x41, 0x00}, {0x00, 0x41, 0x22, 0x1c, 0x00}, {0x2a, 0x1c, 0x7f, 0x1c, 0x2a}, {0x08, 0x08, 0x3e, 0x08, 0x08},
+	{0x00, 0x80, 0x70, 0x30, 0x00}, {0x08, 0x08, 0x08, 0x08, 0x08}, {0x00, 0x00, 0x60, 0x60, 0x00}, {0x20, 0x10, 0x08, 0x04, 0x02},
+	{0x3e, 0x51, 0x49, 0x45, 0x3e}, {0x00, 0x42, 0x7f, 0x40, 0x00}, {0x72, 0x49, 0x49, 0x49, 0x46}, {0x21, 0x41, 0x49, 0x4d, 0x33},
+	{0x18, 0x14, 0x12, 0x7f, 0x10}, {0x27, 0x45, 0x45, 0x45, 0x39}, {0x3c, 0x4a, 0x49, 0x49, 0x31}, {0x41, 0x21, 0x11, 0x09, 0x07},
+	{0x36, 0x49, 0x49, 0x49, 0x36}, {0x46, 0x49, 0x49, 0x29, 0x1e}, {0x00, 0x00, 0x14, 0x00, 0x00}, {0x00, 0x40, 0x34, 0x00, 0x00},
+	{0x00, 0x08, 0x14, 0x22, 0x41}, {0x14, 0x14, 0x14, 0x14, 0x14}, {0x00, 0x41, 0x22, 0x14, 0x08}, {0x02, 0x01, 0x59, 0x09, 0x06},
+	{0x3e, 0x41, 0x5d, 0x59, 0x4e}, {0x7c, 0x12, 0x11, 0x12, 0x7c}, {0x7f, 0x49, 0x49, 0x49, 0x36}, {0x3e, 0x41, 0x41, 0x41, 0x22},
+	{0x7f, 0x41, 0x41, 0x41, 0x3e}, {0x7f, 0x49, 0x49, 0x49, 0x41}, {0x7f, 0x09, 0x09, 0x09, 0x01}, {0x3e, 0x41, 0x41, 0x51, 0x73},
+	{0x7f, 0x08, 0x08, 0x08, 0x7f}, {0x00, 0x41, 0x7f, 0x41, 0x00}, {0x20, 0x40, 0x41, 0x3f, 0x01}, {0x7f, 0x08, 0x14, 0x22, 0x41},
+	{0x7f, 0x40, 0x40, 0x40, 0x40}, {0x7f, 0x02, 0x1c, 0x02, 0x7f}, {0x7f, 0x04, 0x08, 0x10, 0x7f}, {0x3e, 0x41, 0x41, 0x41, 0x3e},
+	{0x7f, 0x09, 0x09, 0x09, 0x06}, {0x3e, 0x41, 0x51, 0x21, 0x5e}, {0x7f, 0x09, 0x19, 0x29, 0x46}, {0x26, 0x49, 0x49, 0x49, 0x32},
+	{0x03, 0x01, 0x7f, 0x01, 0x03}, {0x3f, 0x40, 0x40, 0x40, 0x3f}, {0x1f, 0x20, 0x40, 0x20, 0x1f}, {0x3f, 0x40, 0x38, 0x40, 0x3f},
+	{0x63, 0x14, 0x08, 0x14, 0x63}, {0x03, 0x04, 0x78, 0x04, 0x03}, {0x61, 0x59, 0x49, 0x4d, 0x43}, {0x00, 0x7f, 0x41, 0x41, 0x41},
+	{0x02, 0x04, 0x08, 0x10, 0x20}, {0x00, 0x41, 0x41, 0x41, 0x7f}, {0x04, 0x02, 0x01, 0x02, 0x04}, {0x40, 0x40, 0x40, 0x40, 0x40},
+	{0x00, 0x03, 0x07, 0x08, 0x00}, {0x20, 0x54, 0x54, 0x78, 0x40}, {0x7f, 0x28, 0x44, 0x44, 0x38}, {0x38, 0x44, 0x44, 0x44, 0x28},
+	{0x38, 0x44, 0x44, 0x28, 0x7f}, {0x38, 0x54, 0x54, 0x54, 0x18}, {0x00, 0x08, 0x7e, 0x09, 0x02}, {0x18, 0xa4, 0xa4, 0x9c, 0x78},
+	{0x7f, 0x08, 0x04, 0x04, 0x78}, {0x00, 0x44, 0x7d, 0x40, 0x00}, {0x20, 0x40, 0x40, 0x3d, 0x00}, {0x7f, 0x10, 0x28, 0x44, 0x00},
+	{0x00, 0x41, 0x7f, 0x40, 0x00}, {0x7c, 0x04, 0x78, 0x04, 0x78}, {0x7c, 0x08, 0x04, 0x04, 0x78}, {0x38, 0x44, 0x44, 0x44, 0x38},
+	{0xfc, 0x18, 0x24, 0x24, 0x18}, {0x18, 0x24, 0x24, 0x18, 0xfc}, {0x7c, 0x08, 0x04, 0x04, 0x08}, {0x48, 0x54, 0x54, 0x54, 0x24},
+	{0x04, 0x04, 0x3f, 0x44, 0x24}, {0x3c, 0x40, 0x40, 0x20, 0x7c}, {0x1c, 0x20, 0x40, 0x20, 0x1c}, {0x3c, 0x40, 0x30, 0x40, 0x3c},
+	{0x44, 0x28, 0x10, 0x28, 0x44}, {0x4c, 0x90, 0x90, 0x90, 0x7c}, {0x44, 0x64, 0x54, 0x4c, 0x44}, {0x00, 0x08, 0x36, 0x41, 0x00},
+	{0x00, 0x00, 0x77, 0x00, 0x00}, {0x00, 0x41, 0x36, 0x08, 0x00}, {0x02, 0x01, 0x02, 0x04, 0x02},
+}
+
+// pngTextWidth returns the width in pixels of the text drawn on PNG badges
+func pngTextWidth(text string) int {
+	if text == "" {
+		return 0
+	}
+	return utf8.RuneCountInString(text)*pngGlyphAdvance - 1
+}
+
+// isInsideRoundedRect reports whether the pixel is inside the rectangle of the image bounds with rounded corners
+func isInsideRoundedRect(bounds image.Rectangle, radius int, x int, y int) bool {
+	cx, cy := x, y
+	switch {
+	case x < bounds.Min.X+radius:
+		cx = bounds.Min.X + radius
+	case x >= bounds.Max.X-radius:
+		cx = bounds.Max.X - radius - 1
+	}
+	switch {
+	case y < bounds.Min.Y+radius:
+		cy = bounds.Min.Y + radius
+	case y >= bounds.Max.Y-radius:
+		cy = bounds.Max.Y - radius - 1
+	}
+	dx, dy := x-cx, y-cy
+	return dx*dx+dy*dy <= radius*radius
+}
+
+// drawPNGText draws the text with the bitmap font, starting from the column
+func drawPNGText(img *image.NRGBA, text string, x int, textColor color.NRGBA) {
+	for _, r := range text {
+		if r < ' ' || r > '~' {
+			r = '?'
+		}
+		for column, bits := range pngFont[r-' '] {
+			for row := 0; row < 8; row++ {
+				if bits&(1<<uint(row)) != 0 {
+					img.SetNRGBA(x+column, pngGlyphTop+row, textColor)
+				}
+			}
+		}
+		x += pngGlyphAdvance
+	}
+}
+
+// pngPart represents the subject, the status or a segment of PNG badges
+type pngPart struct {
+	text       string
+	width      int
+	textOffset int
+	color      color.NRGBA
+	fontColor  color.NRGBA
+}
+
+// pngParts lays out the subject & the status, or the subject & the segments of multi-segment badges, of PNG badges
+func pngParts(newBadge *badgeDimensions) []pngPart {
+	labelColor, subjectFontColor := rgbaColor(newBadge.LabelColor), rgbaColor(newBadge.SubjectFontColor)
+	subject := newBadge.subjectText
+
+	if len(newBadge.Segments) == 0 {
+		status := newBadge.statusText
+		return []pngPart{
+			{subject, newBadge.PaddingOuter + pngTextWidth(subject) + newBadge.PaddingInner, newBadge.PaddingOuter, labelColor, subjectFontColor},
+			{status, newBadge.PaddingInner + pngTextWidth(status) + newBadge.PaddingOuter, newBadge.PaddingInner, rgbaColor(newBadge.Color), rgbaColor(newBadge.StatusFontColor)},
+		}
+	}
+
+	var parts []pngPart
+	if subject != "" {
+		parts = append(parts, pngPart{subject, newBadge.PaddingOuter + pngTextWidth(subject) + newBadge.PaddingInner, newBadge.PaddingOuter, labelColor, subjectFontColor})
+	}
+	for i, segment := range newBadge.Segments {
+		paddingLeft, paddingRight := newBadge.PaddingInner, newBadge.PaddingInner
+		if len(parts) == 0 {
+			paddingLeft = newBadge.PaddingOuter
+		}
+		if i == len(newBadge.Segments)-1 {
+			paddingRight = newBadge.PaddingOuter
+		}
+		parts = append(parts, pngPart{segment.text, paddingLeft + pngTextWidth(segment.text) + paddingRight, paddingLeft, rgbaColor(segment.Color), rgbaColor(segment.FontColor)})
+	}
+	return parts
+}
+
+// RenderPNG generates a PNG badge & writes it into the writer, for places where SVG images aren't supported. PNG
+// badges have the colors, texts & shape of SVG badges, but are drawn with a bitmap font (replacing non-ASCII characters
+// with `?`), without gradients, icons, logos, links nor sparklines.
+func RenderPNG(w io.Writer, params *Params) error {
+	newBadge, err := generateBadge(params)
+	if err != nil {
+		return err
+	}
+
+	parts := pngParts(newBadge)
+	width := 0
+	for _, part := range parts {
+		width += part.width
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, Height))
+	radius := pngCornerRadius[newBadge.Style]
+	x := 0
+	for _, part := range parts {
+		for y := 0; y < Height; y++ {
+			for px := x; px < x+part.width; px++ {
+				if isInsideRoundedRect(img.Bounds(), radius, px, y) {
+					img.SetNRGBA(px, y, part.color)
+				}
+			}
+		}
+		drawPNGText(img, part.text, x+part.textOffset, part.fontColor)
+		x += part.width
+	}
+
+	return png.Encode(w, img)
+}
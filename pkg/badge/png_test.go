@@ -0,0 +1,80 @@
+package badge
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func renderTestPNG(t *testing.T, params *Params) image.Image {
+	var buf bytes.Buffer
+	if err := RenderPNG(&buf, params); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// pixelAt returns the color of the pixel, regardless of the color model of the decoded image (eg. opaque images are
+// decoded as RGBA)
+func pixelAt(img image.Image, x int, y int) color.NRGBA {
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+}
+
+func TestRenderPNG(t *testing.T) {
+	t.Parallel()
+
+	img := renderTestPNG(t, &Params{Subject: "build", Status: "passing", Color: "green"})
+	subjectWidth := 6 + pngTextWidth("build") + 4
+	assert.Equal(t, image.Rect(0, 0, subjectWidth+4+pngTextWidth("passing")+6, Height), img.Bounds())
+
+	// corners are rounded
+	assert.Equal(t, color.NRGBA{}, pixelAt(img, 0, 0))
+	assert.Equal(t, color.NRGBA{}, pixelAt(img, img.Bounds().Dx()-1, Height-1))
+	assert.Equal(t, rgbaColor("#555"), pixelAt(img, 0, Height/2))
+	assert.Equal(t, rgbaColor("#97ca00"), pixelAt(img, img.Bounds().Dx()-1, Height/2))
+
+	// texts are drawn with the font color of their background
+	textPixels := map[color.NRGBA]int{}
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		for y := pngGlyphTop; y < pngGlyphTop+8; y++ {
+			textPixels[pixelAt(img, x, y)]++
+		}
+	}
+	assert.Contains(t, textPixels, rgbaColor("#fff"))
+	assert.Len(t, textPixels, 3)
+}
+
+func TestRenderPNGStyles(t *testing.T) {
+	t.Parallel()
+
+	flat := renderTestPNG(t, &Params{Subject: "build", Status: "passing", Style: FlatStyle})
+	assert.Equal(t, rgbaColor("#555"), pixelAt(flat, 0, 0))
+
+	// texts of SemaphoreCI badges are uppercase
+	semaphoreCI := renderTestPNG(t, &Params{Subject: "build", Status: "passing", Style: SemaphoreCIStyle})
+	assert.Equal(t, 10+pngTextWidth("BUILD")+10+10+pngTextWidth("PASSING")+10, semaphoreCI.Bounds().Dx())
+	assert.Equal(t, color.NRGBA{}, pixelAt(semaphoreCI, 0, 0))
+	assert.Equal(t, rgbaColor("#f1f1f1"), pixelAt(semaphoreCI, 1, 1))
+}
+
+func TestRenderPNGNonASCIIText(t *testing.T) {
+	t.Parallel()
+
+	// non-ASCII characters are drawn as `?`, taking the same width
+	assert.Equal(t, renderTestPNG(t, &Params{Subject: "?", Status: "??"}), renderTestPNG(t, &Params{Subject: "★", Status: "日本"}))
+}
+
+func TestRenderPNGInvalidStyle(t *testing.T) {
+	t.Parallel()
+
+	// unknown styles fall back to the default style, same as SVG badges
+	assert.Equal(t, renderTestPNG(t, &Params{Subject: "build", Style: DefaultStyle}), renderTestPNG(t, &Params{Subject: "build", Style: "unknown"}))
+}
@@ -0,0 +1,4 @@
+// Package rastertest compares badges rasterized by resvg (https://github.com/RazrFalcon/resvg), a SVG renderer, with
+// golden images, so that changes of the markup of the badges are checked against how they're drawn. It's a module of
+// its own, as resvg requires a newer version of Go than the badge package.
+package rastertest
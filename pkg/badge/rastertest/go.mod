@@ -0,0 +1,15 @@
+module github.com/tohjustin/aegis/pkg/badge/rastertest
+
+go 1.24.0
+
+require (
+	github.com/kanrichan/resvg-go v0.0.2-0.20260124063605-1b2ace355216
+	github.com/tohjustin/aegis v0.0.0
+)
+
+require (
+	github.com/tetratelabs/wazero v1.11.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+)
+
+replace github.com/tohjustin/aegis => ../../..
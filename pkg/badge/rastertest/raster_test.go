@@ -0,0 +1,200 @@
+package rastertest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	resvg "github.com/kanrichan/resvg-go"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+)
+
+// rasterScale represents the number of pixels per user unit of the rasterized badges, high enough to tell apart
+// markup drawn a subpixel off
+const rasterScale = 2
+
+// rasterTolerance represents the maximum difference of any color channel of a pixel between a rasterized badge & its
+// golden image, as the path data of icons is rounded to a tenth of a unit, which shifts the antialiased edges of the
+// largest icons by a fraction of a pixel
+const rasterTolerance = 32
+
+// rasterTestCases represents the badges compared with their golden images, covering the markup of every style
+var rasterTestCases = []struct {
+	name  string
+	input badge.Params
+}{
+	{"Badge", badge.Params{Subject: "build", Status: "passing", Color: "green"}},
+	{"RightToLeft", badge.Params{Subject: "نجوم", Status: "1.2k", Color: "blue"}},
+	{"Icon", badge.Params{Subject: "stars", Status: "1.2k", Icon: "brands/github"}},
+	{"IconColor", badge.Params{Subject: "license", Status: "MIT", Icon: "solid/balance-scale", IconColor: "#fe7d37"}},
+	{"IconOnly", badge.Params{Status: "4.5k", Icon: "regular/star"}},
+	{"DetailedIcon", badge.Params{Subject: "republic", Status: "old", Icon: "brands/old-republic", IconSize: badge.MaxIconSize}},
+	{"CurvedIcon", badge.Params{Subject: "stays", Status: "12", Icon: "brands/airbnb", IconSize: badge.MaxIconSize}},
+	{"Links", badge.Params{Subject: "docs", Status: "latest", Links: []string{"https://example.com/a", "https://example.com/b"}}},
+	{"Sparkline", badge.Params{Subject: "commits", Status: "128", Sparkline: []float64{3, 8, 1, 9, 4, 12, 7}}},
+	{"Segments", badge.Params{Subject: "gopacket", Segments: []badge.Segment{
+		{Text: "1.23k", Color: "#f7b137", Icon: "regular/star", Label: "stars: 1.23k"},
+		{Text: "forks 567", Color: "blue", Label: "forks: 567"},
+	}}},
+}
+
+// rasterizer rasterizes badges with resvg, drawing their texts with the font the widths of the texts are computed with
+type rasterizer struct {
+	worker *resvg.Worker
+	fontdb *resvg.FontDB
+}
+
+func newRasterizer(t *testing.T) *rasterizer {
+	worker, err := resvg.NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := os.ReadFile(filepath.Join("..", "assets", "fonts", "Verdana.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fontdb.LoadFontData(font); err != nil {
+		t.Fatal(err)
+	}
+	if err := fontdb.SetSansSerifFamily("Verdana"); err != nil {
+		t.Fatal(err)
+	}
+	return &rasterizer{worker: worker, fontdb: fontdb}
+}
+
+func (r *rasterizer) close() {
+	r.fontdb.Close()
+	r.worker.Close()
+}
+
+// rasterize returns the PNG image of the SVG badge
+func (r *rasterizer) rasterize(t *testing.T, svg string) []byte {
+	tree, err := r.worker.NewTreeFromData([]byte(svg), &resvg.Options{
+		Dpi:                96,
+		FontFamily:         "Verdana",
+		FontSize:           11,
+		Languages:          []string{"en"},
+		ShapeRenderingMode: resvg.ShapeRenderingModeGeometricPrecision,
+		TextRenderingMode:  resvg.TextRenderingModeOptimizeLegibility,
+		ImageRenderingMode: resvg.ImageRenderingModeOptimizeQuality,
+		DefaultSizeWidth:   100,
+		DefaultSizeHeight:  20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if err := tree.ConvertText(r.fontdb); err != nil {
+		t.Fatal(err)
+	}
+
+	width, height, err := tree.GetSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixmap, err := r.worker.NewPixmap(uint32(math.Ceil(float64(width*rasterScale))), uint32(math.Ceil(float64(height*rasterScale))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pixmap.Close()
+	if err := tree.Render(resvg.TransformFromScale(rasterScale, rasterScale), pixmap); err != nil {
+		t.Fatal(err)
+	}
+	data, err := pixmap.EncodePNG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// rasterGoldenPath returns the path of the golden image of the test case, which are updated by setting the
+// `UPDATE_SNAPSHOTS` environment variable
+func rasterGoldenPath(name string, style badge.Style) string {
+	return filepath.Join("testdata", fmt.Sprintf("%s-%s.png", name, style))
+}
+
+func TestBadgeRaster(t *testing.T) {
+	r := newRasterizer(t)
+	defer r.close()
+
+	for _, style := range badge.SupportedStyles {
+		for _, testCase := range rasterTestCases {
+			params := testCase.input
+			params.Style = style
+			t.Run(testCase.name+"/"+string(style), func(t *testing.T) {
+				newBadge, err := badge.Create(&params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				actual := r.rasterize(t, newBadge)
+
+				path := rasterGoldenPath(testCase.name, style)
+				if os.Getenv("UPDATE_SNAPSHOTS") != "" {
+					if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(path, actual, 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				golden, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertSimilarImages(t, golden, actual)
+			})
+		}
+	}
+}
+
+// assertSimilarImages asserts that the PNG images have the same size & that no color channel of any pixel differs by
+// more than the tolerance
+func assertSimilarImages(t *testing.T, expectedPNG []byte, actualPNG []byte) {
+	expected, err := png.Decode(bytes.NewReader(expectedPNG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := png.Decode(bytes.NewReader(actualPNG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected.Bounds() != actual.Bounds() {
+		t.Fatalf("expected image of %v, got %v", expected.Bounds(), actual.Bounds())
+	}
+
+	if differences := countDifferences(expected, actual); differences > 0 {
+		t.Errorf("%d pixels differ from the golden image by more than %d", differences, rasterTolerance)
+	}
+}
+
+// countDifferences returns the number of pixels of which a color channel differs by more than the tolerance
+func countDifferences(expected image.Image, actual image.Image) int {
+	differences := 0
+	bounds := expected.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			e := color.NRGBAModel.Convert(expected.At(x, y)).(color.NRGBA)
+			a := color.NRGBAModel.Convert(actual.At(x, y)).(color.NRGBA)
+			for _, channel := range [][2]uint8{{e.R, a.R}, {e.G, a.G}, {e.B, a.B}, {e.A, a.A}} {
+				if math.Abs(float64(channel[0])-float64(channel[1])) > rasterTolerance {
+					differences++
+					break
+				}
+			}
+		}
+	}
+	return differences
+}
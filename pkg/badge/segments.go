@@ -0,0 +1,146 @@
+package badge
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Segment holds the parameters of a segment of a multi-segment badge
+type Segment struct {
+	// Text determines the text of the segment.
+	Text string
+	// Color determines the background color of the segment, accepts the same color values as `Params.Color`.
+	Color string
+	// Icon determines the icon drawn before the text of the segment (eg. "regular/star"), filled with the color of the
+	// text.
+	Icon string
+	// Label determines the text read by screen readers for the segment (eg. "stars: 1.2k" for a segment showing a star
+	// icon & "1.2k"), defaults to the text of the segment.
+	Label string
+}
+
+// badgeSegment holds the dimensions of a segment of a multi-segment badge
+type badgeSegment struct {
+	// text holds the unescaped text of the segment
+	text      string
+	Text      string
+	Color     string
+	FontColor string
+	X         int
+	Width     int
+
+	TextOffset int
+	TextWidth  int
+	TextX      int
+	RTL        bool
+
+	IconHref  string
+	IconLabel string
+	IconSize  int
+	IconX     int
+	IconY     int
+}
+
+// generateSegmentedBadge lays out the subject & the segments of a multi-segment badge, on top of the dimensions of
+// the style of the badge. The subject is omitted if empty.
+func generateSegmentedBadge(newBadge *badgeDimensions, params *Params) (*badgeDimensions, error) {
+	newBadge.Template = badgeTemplates["segments"]
+	if newBadge.Template == nil {
+		return nil, fmt.Errorf("Badge template does not exist: segments")
+	}
+
+	x := 0
+	if newBadge.Subject != "" {
+		subjectTextWidth, err := computeTextWidth(newBadge.Subject, newBadge.FontSize, newBadge.FontFamily)
+		if err != nil {
+			return nil, err
+		}
+		newBadge.SubjectOffset = newBadge.PaddingOuter
+		newBadge.SubjectTextWidth = subjectTextWidth
+		newBadge.SubjectWidth = newBadge.PaddingOuter + subjectTextWidth + newBadge.PaddingInner
+		newBadge.SubjectRTL = isTextRightToLeft(newBadge.Subject, params.Direction)
+		newBadge.SubjectX = textX(newBadge.SubjectOffset, subjectTextWidth, newBadge.SubjectRTL)
+		x = newBadge.SubjectWidth
+	}
+
+	// trailing segments are dropped until the badge fits, down to a single segment
+	segments := params.Segments
+	badgeSegments, labels, width, err := layoutSegments(newBadge, params, segments, x)
+	for err == nil && params.MaxWidth > 0 && width > params.MaxWidth && len(segments) > 1 {
+		segments = segments[:len(segments)-1]
+		badgeSegments, labels, width, err = layoutSegments(newBadge, params, segments, x)
+	}
+	if err != nil {
+		return nil, err
+	}
+	newBadge.Segments = badgeSegments
+	newBadge.TotalWidth = width
+	newBadge.Height = Height
+
+	newBadge.subjectText = newBadge.Subject
+	label := accessibleLabel(newBadge.Subject, strings.Join(labels, " | "))
+	title := sanitizeText(params.Title)
+	if title == "" {
+		title = label
+	}
+	newBadge.Subject = escapeText(newBadge.Subject)
+	newBadge.Title = escapeText(title)
+	newBadge.AriaLabel = escapeText(label)
+
+	return newBadge, nil
+}
+
+// layoutSegments lays out the segments after the subject ending at `x`, returning the dimensions & the accessible labels
+// of the segments, & the width of the badge
+func layoutSegments(newBadge *badgeDimensions, params *Params, segments []Segment, x int) ([]badgeSegment, []string, int, error) {
+	badgeSegments := make([]badgeSegment, 0, len(segments))
+	labels := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		text := truncateText(sanitizeText(segment.Text), params.Truncate)
+		if newBadge.Style == SemaphoreCIStyle {
+			text = strings.ToUpper(text)
+		}
+		label := sanitizeText(segment.Label)
+		if label == "" {
+			label = text
+		}
+		labels = append(labels, label)
+
+		// segments are padded like the status, except between segments
+		paddingLeft, paddingRight := newBadge.PaddingInner, newBadge.PaddingInner
+		if x == 0 {
+			paddingLeft = newBadge.PaddingOuter
+		}
+		if i == len(segments)-1 {
+			paddingRight = newBadge.PaddingOuter
+		}
+
+		color := parseColor(segment.Color)
+		if color == "" {
+			color = DefaultColor
+		}
+		newSegment := badgeSegment{text: text, Text: escapeText(text), Color: color, FontColor: textColor(color), X: x}
+		offset := x + paddingLeft
+		if iconHref, ok := iconDataURI(segment.Icon, newSegment.FontColor); ok {
+			newSegment.IconHref = iconHref
+			newSegment.IconLabel = segment.Icon
+			newSegment.IconSize = DefaultIconSize
+			newSegment.IconX = offset
+			newSegment.IconY = (Height - DefaultIconSize) / 2
+			offset += DefaultIconSize + iconPadding
+		}
+
+		textWidth, err := computeTextWidth(text, newBadge.FontSize, newBadge.FontFamily)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		newSegment.TextOffset = offset
+		newSegment.TextWidth = textWidth
+		newSegment.RTL = isTextRightToLeft(text, params.Direction)
+		newSegment.TextX = textX(offset, textWidth, newSegment.RTL)
+		newSegment.Width = offset + textWidth + paddingRight - x
+		badgeSegments = append(badgeSegments, newSegment)
+		x += newSegment.Width
+	}
+	return badgeSegments, labels, x, nil
+}
@@ -0,0 +1,235 @@
+package badge
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// segmentedSVG represents the elements of multi-segment badges checked by tests
+type segmentedSVG struct {
+	Width     int    `xml:"width,attr"`
+	AriaLabel string `xml:"aria-label,attr"`
+	Title     string `xml:"title"`
+	Paths     []struct {
+		ID   string `xml:"id,attr"`
+		D    string `xml:"d,attr"`
+		Fill string `xml:"fill,attr"`
+	} `xml:"g>path"`
+	Images []struct {
+		Alt string `xml:"alt,attr"`
+		X   int    `xml:"x,attr"`
+	} `xml:"g>image"`
+	Texts   []segmentedText `xml:"g>text"`
+	Shadows []segmentedText `xml:"g>g>text"`
+	Uses    []struct {
+		Href string `xml:"href,attr"`
+		Fill string `xml:"fill,attr"`
+	} `xml:"g>use"`
+}
+
+type segmentedText struct {
+	ID       string `xml:"id,attr"`
+	Fill     string `xml:"fill,attr"`
+	X        int    `xml:"x,attr"`
+	CharData string `xml:",chardata"`
+}
+
+func createSegmentedSVG(t *testing.T, params *Params) (segmentedSVG, Size) {
+	newBadge, size, err := CreateWithSize(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root segmentedSVG
+	if err := xml.Unmarshal([]byte(newBadge), &root); err != nil {
+		t.Fatal(err)
+	}
+	// texts drawn over their shadows reuse them
+	for _, use := range root.Uses {
+		for _, shadow := range root.Shadows {
+			if use.Href == "#"+shadow.ID {
+				shadow.Fill = use.Fill
+				root.Texts = append(root.Texts, shadow)
+			}
+		}
+	}
+	return root, size
+}
+
+// pathBounds returns the horizontal position & the width of a `M{X} 0h{WIDTH}v20H{X}z` path
+func pathBounds(t *testing.T, d string) (int, int) {
+	var x, width int
+	if _, err := fmt.Sscanf(strings.Replace(d, "v20H", " v20H", 1), "M%d 0h%d v20H", &x, &width); err != nil {
+		t.Fatal(err)
+	}
+	return x, width
+}
+
+func TestSegmentedBadgeLayout(t *testing.T) {
+	t.Parallel()
+
+	segments := []Segment{
+		{Text: "1.2k", Color: "blue", Icon: "regular/star", Label: "stars: 1.2k"},
+		{Text: "340", Color: "green", Label: "forks: 340"},
+		{Text: "12", Color: "yellow"},
+		{Text: "err", Color: "lightgrey"},
+	}
+
+	for _, style := range SupportedStyles {
+		for count := 2; count <= len(segments); count++ {
+			style, count := style, count
+			t.Run(fmt.Sprintf("%s/%d", style, count), func(t *testing.T) {
+				t.Parallel()
+
+				root, size := createSegmentedSVG(t, &Params{Subject: "repo", Segments: segments[:count], Style: style})
+				assert.Equal(t, size.Width, root.Width)
+
+				// the label is followed by contiguous segments filling the rest of the badge
+				fills := []struct {
+					x, width int
+					fill     string
+				}{}
+				for _, path := range root.Paths {
+					if path.Fill == "url(#b)" {
+						continue
+					}
+					x, width := pathBounds(t, path.D)
+					fills = append(fills, struct {
+						x, width int
+						fill     string
+					}{x, width, path.Fill})
+				}
+				if assert.Len(t, fills, count+1) {
+					assert.Equal(t, 0, fills[0].x)
+					for i := 1; i < len(fills); i++ {
+						assert.Equal(t, fills[i-1].x+fills[i-1].width, fills[i].x)
+						assert.Equal(t, parseColor(segments[i-1].Color), fills[i].fill)
+					}
+					assert.Equal(t, size.Width, fills[count].x+fills[count].width)
+				}
+
+				// the icon of the first segment is drawn before its text
+				if assert.Len(t, root.Images, 1) {
+					assert.Equal(t, "regular/star", root.Images[0].Alt)
+					assert.True(t, root.Images[0].X > fills[1].x)
+				}
+
+				var texts []string
+				for _, text := range root.Texts {
+					texts = append(texts, text.CharData)
+				}
+				expected := []string{"repo", "1.2k", "340", "12", "err"}[:count+1]
+				if style == SemaphoreCIStyle {
+					expected = []string{"REPO", "1.2K", "340", "12", "ERR"}[:count+1]
+					assert.Empty(t, root.Shadows)
+				} else {
+					// texts are drawn over their shadows
+					assert.Len(t, root.Shadows, count+1)
+				}
+				assert.Equal(t, expected, texts)
+			})
+		}
+	}
+}
+
+func TestSegmentedBadgeWithoutSubject(t *testing.T) {
+	t.Parallel()
+
+	root, _ := createSegmentedSVG(t, &Params{Segments: []Segment{{Text: "1.2k"}, {Text: "340"}}, Style: FlatStyle})
+	for _, path := range root.Paths {
+		assert.NotEqual(t, "label", path.ID)
+	}
+	if assert.Len(t, root.Paths, 2) {
+		x, _ := pathBounds(t, root.Paths[0].D)
+		assert.Equal(t, 0, x)
+		assert.Equal(t, DefaultColor, root.Paths[0].Fill)
+	}
+	// the first segment is padded like the subject
+	assert.Equal(t, 6, root.Texts[0].X)
+}
+
+func TestSegmentedBadgeMaxWidth(t *testing.T) {
+	t.Parallel()
+
+	segments := []Segment{{Text: "bug 12"}, {Text: "enhancement 3"}, {Text: "question 0"}}
+	_, size := createSegmentedSVG(t, &Params{Subject: "issues", Segments: segments, Style: FlatStyle})
+
+	testCases := []struct {
+		name     string
+		maxWidth int
+		expected int
+	}{
+		{"Disabled", 0, 3},
+		{"Fits", size.Width, 3},
+		{"DropsTrailingSegments", size.Width - 1, 2},
+		{"KeepsFirstSegment", 1, 1},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			root, size := createSegmentedSVG(t, &Params{Subject: "issues", Segments: segments, MaxWidth: testCase.maxWidth, Style: FlatStyle})
+			assert.Len(t, root.Paths, testCase.expected+1)
+			assert.Equal(t, root.Width, size.Width)
+			if testCase.maxWidth > 0 && testCase.expected > 1 {
+				assert.LessOrEqual(t, size.Width, testCase.maxWidth)
+			}
+			// the last segment kept is padded like the status
+			last := root.Paths[len(root.Paths)-1]
+			x, width := pathBounds(t, last.D)
+			assert.Equal(t, size.Width, x+width)
+		})
+	}
+}
+
+func TestSegmentedBadgeAccessibility(t *testing.T) {
+	t.Parallel()
+
+	root, _ := createSegmentedSVG(t, &Params{Subject: "gopacket", Segments: []Segment{
+		{Text: "1.2k", Icon: "regular/star", Label: "stars: 1.2k"},
+		{Text: "a & b"},
+	}})
+	assert.Equal(t, "gopacket: stars: 1.2k | a & b", root.AriaLabel)
+	assert.Equal(t, "gopacket: stars: 1.2k | a & b", root.Title)
+
+	root, _ = createSegmentedSVG(t, &Params{Segments: []Segment{{Text: "1.2k"}}, Title: "stars"})
+	assert.Equal(t, "1.2k", root.AriaLabel)
+	assert.Equal(t, "stars", root.Title)
+}
+
+func TestSegmentedBadgeValidate(t *testing.T) {
+	t.Parallel()
+
+	err := (&Params{Segments: []Segment{{Text: "1.2k"}, {Text: "340", Color: "nope"}}}).Validate()
+	var paramErr *ParamError
+	if assert.ErrorAs(t, err, &paramErr) {
+		assert.Equal(t, "segments[1].color", paramErr.Param)
+		assert.Equal(t, ErrInvalidColor, paramErr.Err)
+	}
+
+	err = (&Params{Segments: []Segment{{Text: strings.Repeat("a", MaxTextLength+1)}}}).Validate()
+	if assert.ErrorAs(t, err, &paramErr) {
+		assert.Equal(t, "segments[0].text", paramErr.Param)
+	}
+}
+
+func TestSegmentedBadgeRenderPNG(t *testing.T) {
+	t.Parallel()
+
+	img := renderTestPNG(t, &Params{Subject: "repo", Segments: []Segment{
+		{Text: "1.2k", Color: "blue", Icon: "regular/star"},
+		{Text: "340", Color: "green"},
+	}})
+	subjectWidth := 6 + pngTextWidth("repo") + 4
+	firstWidth := 4 + pngTextWidth("1.2k") + 4
+	assert.Equal(t, image.Rect(0, 0, subjectWidth+firstWidth+4+pngTextWidth("340")+6, Height), img.Bounds())
+	assert.Equal(t, rgbaColor("#555"), pixelAt(img, subjectWidth-1, Height/2))
+	assert.Equal(t, rgbaColor("#007ec6"), pixelAt(img, subjectWidth, Height/2))
+	assert.Equal(t, rgbaColor("#97ca00"), pixelAt(img, subjectWidth+firstWidth, Height/2))
+}
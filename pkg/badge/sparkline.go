@@ -0,0 +1,70 @@
+package badge
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MinSparklinePoints represents the minimum number of values required for drawing a sparkline,
+	// sparklines with fewer values are omitted from the badge
+	MinSparklinePoints = 3
+
+	sparklineWidth   = 40
+	sparklineHeight  = 10
+	sparklineOffsetY = 5
+)
+
+// formatCoordinate formats a coordinate with a precision of one decimal place
+func formatCoordinate(n float64) string {
+	return strconv.FormatFloat(math.Round(n*10)/10, 'f', -1, 64)
+}
+
+// sparklinePolylines converts the sparkline values into the points of SVG polylines starting at `offsetX`.
+// Missing values (NaN) leave a gap in the sparkline, splitting it into one polyline per run of values.
+func sparklinePolylines(values []float64, offsetX int) []string {
+	count := 0
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		if math.IsNaN(value) {
+			continue
+		}
+		count++
+		minValue = math.Min(minValue, value)
+		maxValue = math.Max(maxValue, value)
+	}
+	if count < MinSparklinePoints {
+		return nil
+	}
+
+	// Normalize values into the sparkline's height, with flat series drawn across the middle
+	normalize := func(value float64) float64 {
+		if maxValue == minValue {
+			return sparklineOffsetY + sparklineHeight/2.0
+		}
+		return sparklineOffsetY + (maxValue-value)/(maxValue-minValue)*sparklineHeight
+	}
+	stepX := float64(sparklineWidth) / float64(len(values)-1)
+
+	polylines := []string{}
+	points := []string{}
+	flush := func() {
+		// a single point doesn't draw a visible line
+		if len(points) > 1 {
+			polylines = append(polylines, strings.Join(points, " "))
+		}
+		points = []string{}
+	}
+	for i, value := range values {
+		if math.IsNaN(value) {
+			flush()
+			continue
+		}
+		x := float64(offsetX) + float64(i)*stepX
+		points = append(points, formatCoordinate(x)+","+formatCoordinate(normalize(value)))
+	}
+	flush()
+
+	return polylines
+}
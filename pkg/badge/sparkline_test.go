@@ -0,0 +1,85 @@
+package badge
+
+import (
+	"encoding/xml"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+	"github.com/stretchr/testify/assert"
+)
+
+var nan = math.NaN()
+
+var sparklineTestCases = []struct {
+	name     string
+	input    []float64
+	expected []string
+}{
+	{
+		name:     "Flat",
+		input:    []float64{5, 5, 5, 5, 5},
+		expected: []string{"100,10 110,10 120,10 130,10 140,10"},
+	},
+	{
+		name:     "Rising",
+		input:    []float64{0, 1, 2, 3, 4},
+		expected: []string{"100,15 110,12.5 120,10 130,7.5 140,5"},
+	},
+	{
+		name:     "Falling",
+		input:    []float64{30, 20, 0},
+		expected: []string{"100,5 120,8.3 140,15"},
+	},
+	{
+		name:     "Gappy",
+		input:    []float64{1, 2, nan, 4, 5, nan, 3},
+		expected: []string{"100,15 106.7,12.5", "120,7.5 126.7,5"},
+	},
+	{
+		name:     "TooFewPoints",
+		input:    []float64{1, nan, nan, 2},
+		expected: nil,
+	},
+	{
+		name:     "Empty",
+		input:    nil,
+		expected: nil,
+	},
+}
+
+func TestSparklinePolylines(t *testing.T) {
+	t.Parallel()
+
+	for _, testCase := range sparklineTestCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, sparklinePolylines(testCase.input, 100))
+		})
+	}
+}
+
+func TestSnapshotBadgeCreateWithSparkline(t *testing.T) {
+	t.Parallel()
+
+	for _, style := range SupportedStyles {
+		testNamePrefix := strings.ToUpper(string(style)[:1]) + string(style)[1:]
+		for _, testCase := range sparklineTestCases {
+			t.Run(testNamePrefix+"BadgeWith"+testCase.name+"Sparkline", func(t *testing.T) {
+				result, err := Create(&Params{
+					Style:     style,
+					Subject:   "stars",
+					Status:    "1.2k",
+					Sparkline: testCase.input,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				assert.NoError(t, xml.Unmarshal([]byte(result), new(svg)))
+				assert.Equal(t, len(testCase.expected), strings.Count(result, "<polyline"))
+				cupaloy.SnapshotT(t, result)
+			})
+		}
+	}
+}
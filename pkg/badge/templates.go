@@ -5,8 +5,9 @@ import "text/template"
 
 // styleName -> template
 var badgeTemplates = map[Style]*template.Template{
-	"classic":     template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1" height="20" width="{{.TotalWidth}}"><linearGradient id="b" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient><clipPath id="a"><rect height="20" width="{{.TotalWidth}}" rx="3"/></clipPath><g clip-path="url(#a)"><path d="M0 0h{{.SubjectWidth}}v20H0z" fill="#555"/><path id="fill" d="M{{.SubjectWidth}} 0h{{.StatusWidth}}v20H{{.SubjectWidth}}z" fill="{{.Color}}"/><path d="M0 0h{{.TotalWidth}}v20H0z" fill="url(#b)"/></g><g font-family="{{.FontFamily}},sans-serif" font-size="{{.FontSize}}">{{if .IconBase64Str}}<image id="icon" alt="{{.IconLabel}}" height="12" width="12" x="{{.PaddingOuter}}" y="4" xlink:href="data:image/svg+xml;base64,{{.IconBase64Str}}"></image>{{end}}<text fill="#000" fill-opacity=".3" textLength="{{.SubjectTextWidth}}" x="{{.SubjectOffset}}" y="15">{{.Subject}}</text><text id="subject" fill="{{.SubjectFontColor}}" textLength="{{.SubjectTextWidth}}" x="{{.SubjectOffset}}" y="14">{{.Subject}}</text><text fill="#000" fill-opacity=".3" textLength="{{.StatusTextWidth}}" x="{{.StatusOffset}}" y="15">{{.Status}}</text><text id="status" fill="{{.StatusFontColor}}" textLength="{{.StatusTextWidth}}" x="{{.StatusOffset}}" y="14">{{.Status}}</text></g></svg>`)),
-	"flat":        template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1" height="20" width="{{.TotalWidth}}"><clipPath id="a"><rect height="20" width="{{.TotalWidth}}"/></clipPath><g clip-path="url(#a)"><path d="M0 0h{{.SubjectWidth}}v20H0z" fill="#555"/><path id="fill" d="M{{.SubjectWidth}} 0h{{.StatusWidth}}v20H{{.SubjectWidth}}z" fill="{{.Color}}"/><path d="M0 0h{{.TotalWidth}}v20H0z" fill="url(#b)"/></g><g font-family="Verdana,sans-serif" font-size="{{.FontSize}}">{{if .IconBase64Str}}<image id="icon" alt="{{.IconLabel}}" height="12" width="12" x="{{.PaddingOuter}}" y="4" xlink:href="data:image/svg+xml;base64,{{.IconBase64Str}}"></image>{{end}}<text fill="#000" fill-opacity=".3" textLength="{{.SubjectTextWidth}}" x="{{.SubjectOffset}}" y="15">{{.Subject}}</text><text id="subject" fill="{{.SubjectFontColor}}" textLength="{{.SubjectTextWidth}}" x="{{.SubjectOffset}}" y="14">{{.Subject}}</text><text fill="#000" fill-opacity=".3" textLength="{{.StatusTextWidth}}" x="{{.StatusOffset}}" y="15">{{.Status}}</text><text id="status" fill="{{.StatusFontColor}}" textLength="{{.StatusTextWidth}}" x="{{.StatusOffset}}" y="14">{{.Status}}</text></g></svg>`)),
-	"plastic":     template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1" height="20" width="{{.TotalWidth}}"><linearGradient id="b" x2="0" y2="100%"><stop offset="0" stop-color="#fff" stop-opacity=".7"/><stop offset=".1" stop-color="#aaa" stop-opacity=".1"/><stop offset=".9" stop-color="#000" stop-opacity=".3"/><stop offset="1" stop-color="#000" stop-opacity=".5"/></linearGradient><clipPath id="a"><rect height="20" width="{{.TotalWidth}}" rx="3"/></clipPath><g clip-path="url(#a)"><path d="M0 0h{{.SubjectWidth}}v20H0z" fill="#555"/><path id="fill" d="M{{.SubjectWidth}} 0h{{.StatusWidth}}v20H{{.SubjectWidth}}z" fill="{{.Color}}"/><path d="M0 0h{{.TotalWidth}}v20H0z" fill="url(#b)"/></g><g font-family="Verdana,sans-serif" font-size="{{.FontSize}}">{{if .IconBase64Str}}<image id="icon" alt="{{.IconLabel}}" height="12" width="12" x="{{.PaddingOuter}}" y="4" xlink:href="data:image/svg+xml;base64,{{.IconBase64Str}}"></image>{{end}}<text fill="#000" fill-opacity=".3" textLength="{{.SubjectTextWidth}}" x="{{.SubjectOffset}}" y="15">{{.Subject}}</text><text id="subject" fill="{{.SubjectFontColor}}" textLength="{{.SubjectTextWidth}}" x="{{.SubjectOffset}}" y="14">{{.Subject}}</text><text fill="#000" fill-opacity=".3" textLength="{{.StatusTextWidth}}" x="{{.StatusOffset}}" y="15">{{.Status}}</text><text id="status" fill="{{.StatusFontColor}}" textLength="{{.StatusTextWidth}}" x="{{.StatusOffset}}" y="14">{{.Status}}</text></g></svg>`)),
-	"semaphoreci": template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1" height="20" width="{{.TotalWidth}}"><clipPath id="a"><rect height="20" width="{{.TotalWidth}}" rx="2"/></clipPath><g clip-path="url(#a)"><path d="M0 0h{{.SubjectWidth}}v20H0z" fill="#f1f1f1"/><path id="fill" d="M{{.SubjectWidth}} 0h{{.StatusWidth}}v20H{{.SubjectWidth}}z" fill="{{.Color}}"/></g><g font-family="Verdana,sans-serif" font-size="{{.FontSize}}">{{if .IconBase64Str}}<image id="icon" alt="{{.IconLabel}}" height="12" width="12" x="{{.PaddingOuter}}" y="4" xlink:href="data:image/svg+xml;base64,{{.IconBase64Str}}"></image>{{end}}<text id="subject" fill="{{.SubjectFontColor}}" textLength="{{.SubjectTextWidth}}" x="{{.SubjectOffset}}" y="13">{{.Subject}}</text><text id="status" fill="{{.StatusFontColor}}" textLength="{{.StatusTextWidth}}" x="{{.StatusOffset}}" y="13">{{.Status}}</text></g></svg>`)),
+	"classic":     template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" height="{{.Height}}" width="{{.TotalWidth}}" role="img" aria-label="{{.AriaLabel}}">{{if .Title}}<title>{{.Title}}</title>{{end}}<linearGradient id="b" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient><clipPath id="a"><rect height="20" width="{{.TotalWidth}}" rx="3"/></clipPath><g clip-path="url(#a)"><path id="label" d="M0 0h{{.SubjectWidth}}v20H0z" fill="{{.LabelColor}}"/><path id="fill" d="M{{.SubjectWidth}} 0h{{.StatusWidth}}v20H{{.SubjectWidth}}z" fill="{{.Color}}"/><path d="M0 0h{{.TotalWidth}}v20H0z" fill="url(#b)"/></g><g font-family="{{.FontFamily}},sans-serif" font-size="{{.FontSize}}">{{if .IconHref}}<image id="{{.IconID}}" alt="{{.IconLabel}}" height="{{.IconHeight}}" width="{{.IconWidth}}" x="{{.PaddingOuter}}" y="{{.IconY}}" xlink:href="{{.IconHref}}"/>{{end}}<g fill="#000" fill-opacity=".3"><text id="subject" textLength="{{.SubjectTextWidth}}" x="{{.SubjectX}}" y="15"{{if .SubjectRTL}} direction="rtl"{{end}}>{{.Subject}}</text><text id="status" textLength="{{.StatusTextWidth}}" x="{{.StatusX}}" y="15"{{if .StatusRTL}} direction="rtl"{{end}}>{{.Status}}</text></g><use href="#subject" xlink:href="#subject" fill="{{.SubjectFontColor}}" y="-1"/><use href="#status" xlink:href="#status" fill="{{.StatusFontColor}}" y="-1"/>{{range .Sparklines}}<polyline fill="none" stroke="{{$.StatusFontColor}}" points="{{.}}"/>{{end}}</g>{{range .Links}}<a target="_blank" xlink:href="{{.Href}}"><rect x="{{.X}}" width="{{.Width}}" height="20" fill-opacity="0"/></a>{{end}}</svg>`)),
+	"flat":        template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" height="{{.Height}}" width="{{.TotalWidth}}" role="img" aria-label="{{.AriaLabel}}">{{if .Title}}<title>{{.Title}}</title>{{end}}<g><path id="label" d="M0 0h{{.SubjectWidth}}v20H0z" fill="{{.LabelColor}}"/><path id="fill" d="M{{.SubjectWidth}} 0h{{.StatusWidth}}v20H{{.SubjectWidth}}z" fill="{{.Color}}"/></g><g font-family="Verdana,sans-serif" font-size="{{.FontSize}}">{{if .IconHref}}<image id="{{.IconID}}" alt="{{.IconLabel}}" height="{{.IconHeight}}" width="{{.IconWidth}}" x="{{.PaddingOuter}}" y="{{.IconY}}" xlink:href="{{.IconHref}}"/>{{end}}<g fill="#000" fill-opacity=".3"><text id="subject" textLength="{{.SubjectTextWidth}}" x="{{.SubjectX}}" y="15"{{if .SubjectRTL}} direction="rtl"{{end}}>{{.Subject}}</text><text id="status" textLength="{{.StatusTextWidth}}" x="{{.StatusX}}" y="15"{{if .StatusRTL}} direction="rtl"{{end}}>{{.Status}}</text></g><use href="#subject" xlink:href="#subject" fill="{{.SubjectFontColor}}" y="-1"/><use href="#status" xlink:href="#status" fill="{{.StatusFontColor}}" y="-1"/>{{range .Sparklines}}<polyline fill="none" stroke="{{$.StatusFontColor}}" points="{{.}}"/>{{end}}</g>{{range .Links}}<a target="_blank" xlink:href="{{.Href}}"><rect x="{{.X}}" width="{{.Width}}" height="20" fill-opacity="0"/></a>{{end}}</svg>`)),
+	"plastic":     template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" height="{{.Height}}" width="{{.TotalWidth}}" role="img" aria-label="{{.AriaLabel}}">{{if .Title}}<title>{{.Title}}</title>{{end}}<linearGradient id="b" x2="0" y2="100%"><stop offset="0" stop-color="#fff" stop-opacity=".7"/><stop offset=".1" stop-color="#aaa" stop-opacity=".1"/><stop offset=".9" stop-color="#000" stop-opacity=".3"/><stop offset="1" stop-color="#000" stop-opacity=".5"/></linearGradient><clipPath id="a"><rect height="20" width="{{.TotalWidth}}" rx="3"/></clipPath><g clip-path="url(#a)"><path id="label" d="M0 0h{{.SubjectWidth}}v20H0z" fill="{{.LabelColor}}"/><path id="fill" d="M{{.SubjectWidth}} 0h{{.StatusWidth}}v20H{{.SubjectWidth}}z" fill="{{.Color}}"/><path d="M0 0h{{.TotalWidth}}v20H0z" fill="url(#b)"/></g><g font-family="Verdana,sans-serif" font-size="{{.FontSize}}">{{if .IconHref}}<image id="{{.IconID}}" alt="{{.IconLabel}}" height="{{.IconHeight}}" width="{{.IconWidth}}" x="{{.PaddingOuter}}" y="{{.IconY}}" xlink:href="{{.IconHref}}"/>{{end}}<g fill="#000" fill-opacity=".3"><text id="subject" textLength="{{.SubjectTextWidth}}" x="{{.SubjectX}}" y="15"{{if .SubjectRTL}} direction="rtl"{{end}}>{{.Subject}}</text><text id="status" textLength="{{.StatusTextWidth}}" x="{{.StatusX}}" y="15"{{if .StatusRTL}} direction="rtl"{{end}}>{{.Status}}</text></g><use href="#subject" xlink:href="#subject" fill="{{.SubjectFontColor}}" y="-1"/><use href="#status" xlink:href="#status" fill="{{.StatusFontColor}}" y="-1"/>{{range .Sparklines}}<polyline fill="none" stroke="{{$.StatusFontColor}}" points="{{.}}"/>{{end}}</g>{{range .Links}}<a target="_blank" xlink:href="{{.Href}}"><rect x="{{.X}}" width="{{.Width}}" height="20" fill-opacity="0"/></a>{{end}}</svg>`)),
+	"segments":    template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" height="{{.Height}}" width="{{.TotalWidth}}" role="img" aria-label="{{.AriaLabel}}">{{if .Title}}<title>{{.Title}}</title>{{end}}{{if eq .Style "classic"}}<linearGradient id="b" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>{{else if eq .Style "plastic"}}<linearGradient id="b" x2="0" y2="100%"><stop offset="0" stop-color="#fff" stop-opacity=".7"/><stop offset=".1" stop-color="#aaa" stop-opacity=".1"/><stop offset=".9" stop-color="#000" stop-opacity=".3"/><stop offset="1" stop-color="#000" stop-opacity=".5"/></linearGradient>{{end}}<clipPath id="a"><rect height="20" width="{{.TotalWidth}}" rx="{{if eq .Style "flat"}}0{{else if eq .Style "semaphoreci"}}2{{else}}3{{end}}"/></clipPath><g clip-path="url(#a)">{{if .SubjectWidth}}<path id="label" d="M0 0h{{.SubjectWidth}}v20H0z" fill="{{.LabelColor}}"/>{{end}}{{range .Segments}}<path d="M{{.X}} 0h{{.Width}}v20H{{.X}}z" fill="{{.Color}}"/>{{end}}{{if or (eq .Style "classic") (eq .Style "plastic")}}<path d="M0 0h{{.TotalWidth}}v20H0z" fill="url(#b)"/>{{end}}</g><g font-family="Verdana,sans-serif" font-size="{{.FontSize}}">{{range .Segments}}{{if .IconHref}}<image alt="{{.IconLabel}}" height="{{.IconSize}}" width="{{.IconSize}}" x="{{.IconX}}" y="{{.IconY}}" xlink:href="{{.IconHref}}"/>{{end}}{{end}}{{if eq .Style "semaphoreci"}}{{if .SubjectWidth}}<text id="subject" fill="{{.SubjectFontColor}}" textLength="{{.SubjectTextWidth}}" x="{{.SubjectX}}" y="13"{{if .SubjectRTL}} direction="rtl"{{end}}>{{.Subject}}</text>{{end}}{{range .Segments}}<text fill="{{.FontColor}}" textLength="{{.TextWidth}}" x="{{.TextX}}" y="13"{{if .RTL}} direction="rtl"{{end}}>{{.Text}}</text>{{end}}{{else}}<g fill="#000" fill-opacity=".3">{{if .SubjectWidth}}<text id="subject" textLength="{{.SubjectTextWidth}}" x="{{.SubjectX}}" y="15"{{if .SubjectRTL}} direction="rtl"{{end}}>{{.Subject}}</text>{{end}}{{range $i, $segment := .Segments}}<text id="s{{$i}}" textLength="{{.TextWidth}}" x="{{.TextX}}" y="15"{{if .RTL}} direction="rtl"{{end}}>{{.Text}}</text>{{end}}</g>{{if .SubjectWidth}}<use href="#subject" xlink:href="#subject" fill="{{.SubjectFontColor}}" y="-1"/>{{end}}{{range $i, $segment := .Segments}}<use href="#s{{$i}}" xlink:href="#s{{$i}}" fill="{{.FontColor}}" y="-1"/>{{end}}{{end}}</g></svg>`)),
+	"semaphoreci": template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg"{{if or .IconHref .Links}} xmlns:xlink="http://www.w3.org/1999/xlink"{{end}} height="{{.Height}}" width="{{.TotalWidth}}" role="img" aria-label="{{.AriaLabel}}">{{if .Title}}<title>{{.Title}}</title>{{end}}<clipPath id="a"><rect height="20" width="{{.TotalWidth}}" rx="2"/></clipPath><g clip-path="url(#a)"><path id="label" d="M0 0h{{.SubjectWidth}}v20H0z" fill="{{.LabelColor}}"/><path id="fill" d="M{{.SubjectWidth}} 0h{{.StatusWidth}}v20H{{.SubjectWidth}}z" fill="{{.Color}}"/></g><g font-family="Verdana,sans-serif" font-size="{{.FontSize}}">{{if .IconHref}}<image id="{{.IconID}}" alt="{{.IconLabel}}" height="{{.IconHeight}}" width="{{.IconWidth}}" x="{{.PaddingOuter}}" y="{{.IconY}}" xlink:href="{{.IconHref}}"/>{{end}}<text id="subject" fill="{{.SubjectFontColor}}" textLength="{{.SubjectTextWidth}}" x="{{.SubjectX}}" y="13"{{if .SubjectRTL}} direction="rtl"{{end}}>{{.Subject}}</text><text id="status" fill="{{.StatusFontColor}}" textLength="{{.StatusTextWidth}}" x="{{.StatusX}}" y="13"{{if .StatusRTL}} direction="rtl"{{end}}>{{.Status}}</text>{{range .Sparklines}}<polyline fill="none" stroke="{{$.StatusFontColor}}" points="{{.}}"/>{{end}}</g>{{range .Links}}<a target="_blank" xlink:href="{{.Href}}"><rect x="{{.X}}" width="{{.Width}}" height="20" fill-opacity="0"/></a>{{end}}</svg>`)),
 }
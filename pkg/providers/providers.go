@@ -0,0 +1,202 @@
+// Package providers provides HTTP handlers serving the badges of the providers (eg. GitHub stars), for applications
+// embedding the badge services rather than running the server.
+package providers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// Options represents the options of the badge service of a provider
+type Options struct {
+	// Token authenticates the upstream API calls, which are anonymous if empty
+	Token string
+	// Username authenticates the upstream API calls with the token as password (Bitbucket app passwords only)
+	Username string
+	// BaseURL represents the base URL of the upstream API (GitHub, GitLab & Gitea only, eg. a self-hosted GitLab
+	// instance), the public API if empty
+	BaseURL string
+	// HTTPClient sends the upstream API calls with its transport & timeout, http.DefaultTransport & a 1.5s timeout if
+	// nil
+	HTTPClient *http.Client
+	// Logger logs the requests & the failed upstream API calls, nothing is logged if nil
+	Logger *zap.Logger
+}
+
+// newConfig returns the configuration of the server with its default values, updated with the options
+func newConfig(options Options) *config.Config {
+	configuration := &config.Config{
+		UpstreamTimeout:         1500 * time.Millisecond,
+		UpstreamRetries:         2,
+		UpstreamRetryDelay:      100 * time.Millisecond,
+		CircuitBreakerThreshold: 5,
+		CircuitBreakerCooldown:  30 * time.Second,
+		MaxConcurrentUpstream:   32,
+		UpstreamQueueTimeout:    250 * time.Millisecond,
+		CacheSeconds:            3600,
+		MinCacheSeconds:         300,
+		MaxCacheSeconds:         86400,
+		MaxLogoSize:             8192,
+		CORSAllowedOrigins:      []string{"*"},
+	}
+	if options.HTTPClient != nil {
+		configuration.UpstreamTransport = options.HTTPClient.Transport
+		if options.HTTPClient.Timeout != 0 {
+			configuration.UpstreamTimeout = options.HTTPClient.Timeout
+		}
+	}
+	return configuration
+}
+
+// newHandler returns the HTTP handler serving the badge routes of the provider relative to its path (eg.
+// `/stars/{owner}/{repo}` for the `/github/stars/{owner}/{repo}` route of the server)
+func newHandler(provider string, configuration *config.Config, logger *zap.Logger) (http.Handler, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	configuration.Providers = []string{provider}
+	router, err := service.NewRouter(configuration, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "/" + provider
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = prefix + r.URL.Path
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = prefix + r.URL.RawPath
+		}
+		router.ServeHTTP(w, r2)
+	}), nil
+}
+
+// checkOptions returns an error if the options set the token, the username or the base URL, which the provider doesn't
+// support
+func checkOptions(provider string, options Options, token bool, username bool, baseURL bool) error {
+	switch {
+	case options.Token != "" && !token:
+		return fmt.Errorf("%s doesn't support tokens", provider)
+	case options.Username != "" && !username:
+		return fmt.Errorf("%s doesn't support usernames", provider)
+	case options.BaseURL != "" && !baseURL:
+		return fmt.Errorf("%s doesn't support base URLs", provider)
+	}
+	return nil
+}
+
+// NewGithub returns the HTTP handler of the GitHub badge service, making unauthenticated GitHub API calls if the
+// token isn't set
+func NewGithub(options Options) (http.Handler, error) {
+	if err := checkOptions("github", options, true, false, true); err != nil {
+		return nil, err
+	}
+	configuration := newConfig(options)
+	configuration.GithubAccessToken = options.Token
+	configuration.GithubAllowUnauthenticated = options.Token == ""
+	configuration.GithubAPIBaseURL = options.BaseURL
+	return newHandler("github", configuration, options.Logger)
+}
+
+// NewGitlab returns the HTTP handler of the GitLab badge service
+func NewGitlab(options Options) (http.Handler, error) {
+	if err := checkOptions("gitlab", options, true, false, true); err != nil {
+		return nil, err
+	}
+	configuration := newConfig(options)
+	configuration.GitlabAccessToken = options.Token
+	configuration.GitlabAPIBaseURL = options.BaseURL
+	return newHandler("gitlab", configuration, options.Logger)
+}
+
+// NewGitea returns the HTTP handler of the Gitea badge service, whose base URL is the URL of the Gitea instance
+// (Codeberg if empty)
+func NewGitea(options Options) (http.Handler, error) {
+	if err := checkOptions("gitea", options, true, false, true); err != nil {
+		return nil, err
+	}
+	configuration := newConfig(options)
+	configuration.GiteaAccessToken = options.Token
+	configuration.GiteaBaseURL = "https://codeberg.org"
+	if options.BaseURL != "" {
+		configuration.GiteaBaseURL = options.BaseURL
+	}
+	return newHandler("gitea", configuration, options.Logger)
+}
+
+// NewBitbucket returns the HTTP handler of the Bitbucket badge service, whose token is the app password of the
+// username
+func NewBitbucket(options Options) (http.Handler, error) {
+	if err := checkOptions("bitbucket", options, true, true, false); err != nil {
+		return nil, err
+	}
+	if (options.Username == "") != (options.Token == "") {
+		return nil, fmt.Errorf("bitbucket username & token must be set together")
+	}
+	configuration := newConfig(options)
+	configuration.BitbucketUsername = options.Username
+	configuration.BitbucketAppPassword = options.Token
+	return newHandler("bitbucket", configuration, options.Logger)
+}
+
+// NewAzureDevops returns the HTTP handler of the Azure DevOps badge service
+func NewAzureDevops(options Options) (http.Handler, error) {
+	if err := checkOptions("azure", options, true, false, false); err != nil {
+		return nil, err
+	}
+	configuration := newConfig(options)
+	configuration.AzureDevopsToken = options.Token
+	return newHandler("azure", configuration, options.Logger)
+}
+
+// NewSourcehut returns the HTTP handler of the SourceHut badge service
+func NewSourcehut(options Options) (http.Handler, error) {
+	if err := checkOptions("sourcehut", options, true, false, false); err != nil {
+		return nil, err
+	}
+	configuration := newConfig(options)
+	configuration.SourcehutAccessToken = options.Token
+	return newHandler("sourcehut", configuration, options.Logger)
+}
+
+// NewCrates returns the HTTP handler of the crates.io badge service
+func NewCrates(options Options) (http.Handler, error) {
+	if err := checkOptions("crates", options, false, false, false); err != nil {
+		return nil, err
+	}
+	return newHandler("crates", newConfig(options), options.Logger)
+}
+
+// NewDocker returns the HTTP handler of the Docker Hub badge service
+func NewDocker(options Options) (http.Handler, error) {
+	if err := checkOptions("docker", options, false, false, false); err != nil {
+		return nil, err
+	}
+	return newHandler("docker", newConfig(options), options.Logger)
+}
+
+// NewNpm returns the HTTP handler of the npm badge service
+func NewNpm(options Options) (http.Handler, error) {
+	if err := checkOptions("npm", options, false, false, false); err != nil {
+		return nil, err
+	}
+	return newHandler("npm", newConfig(options), options.Logger)
+}
+
+// NewPypi returns the HTTP handler of the PyPI badge service
+func NewPypi(options Options) (http.Handler, error) {
+	if err := checkOptions("pypi", options, false, false, false); err != nil {
+		return nil, err
+	}
+	return newHandler("pypi", newConfig(options), options.Logger)
+}
@@ -0,0 +1,116 @@
+package providers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tohjustin/aegis/pkg/providers"
+)
+
+// tokenTransport records the token sent with the upstream API calls
+type tokenTransport struct {
+	header string
+	token  string
+}
+
+func (transport *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.token = req.Header.Get(transport.header)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func getBadge(t *testing.T, handler http.Handler, path string) (int, string) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestNewGitlab(t *testing.T) {
+	t.Parallel()
+
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/projects/gitlab-org%2Fgitaly", r.URL.EscapedPath())
+		w.Write([]byte(`{"star_count":42}`))
+	}))
+	defer fakeAPI.Close()
+
+	transport := &tokenTransport{header: "PRIVATE-TOKEN"}
+	handler, err := providers.NewGitlab(providers.Options{
+		Token:      "secret",
+		BaseURL:    fakeAPI.URL + "/api/v4",
+		HTTPClient: &http.Client{Transport: transport, Timeout: time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// badge routes of the provider are relative to the path the handler is mounted on
+	mux := http.NewServeMux()
+	mux.Handle("/badges/gitlab/", http.StripPrefix("/badges/gitlab", handler))
+	statusCode, body := getBadge(t, mux, "/badges/gitlab/stars/gitlab-org/gitaly")
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, body, `aria-label="stars: 42"`)
+	assert.Equal(t, "secret", transport.token)
+
+	// routes of other providers aren't served
+	statusCode, _ = getBadge(t, mux, "/badges/gitlab/github/stars/gitlab-org/gitaly")
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestNewGitea(t *testing.T) {
+	t.Parallel()
+
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/repos/forgejo/forgejo", r.URL.Path)
+		w.Write([]byte(`{"stars_count":1234}`))
+	}))
+	defer fakeAPI.Close()
+
+	handler, err := providers.NewGitea(providers.Options{BaseURL: fakeAPI.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusCode, body := getBadge(t, handler, "/stars/forgejo/forgejo")
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, body, `aria-label="stars: 1.23k"`)
+}
+
+func TestNewWithUnsupportedOptions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		constructor func(providers.Options) (http.Handler, error)
+		options     providers.Options
+	}{
+		{"NpmToken", providers.NewNpm, providers.Options{Token: "secret"}},
+		{"PypiBaseURL", providers.NewPypi, providers.Options{BaseURL: "https://pypi.example.com"}},
+		{"GithubUsername", providers.NewGithub, providers.Options{Username: "octocat", Token: "secret"}},
+		{"BitbucketUsernameWithoutToken", providers.NewBitbucket, providers.Options{Username: "octocat"}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler, err := testCase.constructor(testCase.options)
+			assert.Error(t, err)
+			assert.Nil(t, handler)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// apiVersion represents the current version of the JSON APIs, changed only on breaking changes of their
+	// response shapes
+	apiVersion = "v1"
+	// apiPathPrefix represents the path prefix of the current version of the JSON APIs
+	apiPathPrefix = "/api/" + apiVersion
+	// legacyAPIPathPrefix represents the path prefix of the deprecated unversioned JSON APIs
+	legacyAPIPathPrefix = "/api"
+)
+
+// apiDeprecation represents a path prefix of the JSON APIs to be retired at the sunset time
+type apiDeprecation struct {
+	prefix string
+	sunset time.Time
+}
+
+// newAPIDeprecations returns the API deprecations of the configured deprecation map, ordered by the longest path
+// prefix first so that more specific deprecations take precedence
+func newAPIDeprecations(deprecations map[string]time.Time) []apiDeprecation {
+	apiDeprecations := make([]apiDeprecation, 0, len(deprecations))
+	for prefix, sunset := range deprecations {
+		apiDeprecations = append(apiDeprecations, apiDeprecation{prefix: strings.TrimSuffix(prefix, "/"), sunset: sunset})
+	}
+	sort.Slice(apiDeprecations, func(i, j int) bool {
+		if len(apiDeprecations[i].prefix) != len(apiDeprecations[j].prefix) {
+			return len(apiDeprecations[i].prefix) > len(apiDeprecations[j].prefix)
+		}
+		return apiDeprecations[i].prefix < apiDeprecations[j].prefix
+	})
+	return apiDeprecations
+}
+
+// withAPIDeprecations sets the `Deprecation` & `Sunset` headers on responses of the deprecated paths, matching
+// whole path segments only
+func withAPIDeprecations(deprecations map[string]time.Time, next http.Handler) http.Handler {
+	apiDeprecations := newAPIDeprecations(deprecations)
+	if len(apiDeprecations) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.EscapedPath()
+		for _, deprecation := range apiDeprecations {
+			if path == deprecation.prefix || strings.HasPrefix(path, deprecation.prefix+"/") {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Sunset", deprecation.sunset.UTC().Format(http.TimeFormat))
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withLegacyAPI marks responses of the unversioned JSON APIs as deprecated, linking to the same path of the
+// current version of the JSON APIs
+func withLegacyAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successorPath := apiPathPrefix + strings.TrimPrefix(r.URL.EscapedPath(), legacyAPIPathPrefix)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successorPath+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAPI registers the JSON API handler of the path (relative to the API path prefix) under the current version
+// of the JSON APIs, along with its deprecated unversioned path
+func handleAPI(router *mux.Router, path string, handler http.Handler) {
+	router.Handle(apiPathPrefix+path, handler).Methods("GET")
+	router.Handle(legacyAPIPathPrefix+path, withLegacyAPI(handler)).Methods("GET")
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// schemaIncompatibilities returns the differences between the JSON values that break clients of the expected value.
+// Every field of the expected value must exist in the actual value with the same JSON type, while added fields are
+// compatible. Array elements are compared against the first element of the expected array.
+func schemaIncompatibilities(path string, expected interface{}, actual interface{}) []string {
+	switch expected := expected.(type) {
+	case map[string]interface{}:
+		actualObject, ok := actual.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %T", path, actual)}
+		}
+		keys := make([]string, 0, len(expected))
+		for key := range expected {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var incompatibilities []string
+		for _, key := range keys {
+			actualValue, ok := actualObject[key]
+			if !ok {
+				incompatibilities = append(incompatibilities, fmt.Sprintf("%s.%s: missing", path, key))
+				continue
+			}
+			incompatibilities = append(incompatibilities, schemaIncompatibilities(path+"."+key, expected[key], actualValue)...)
+		}
+		return incompatibilities
+	case []interface{}:
+		actualArray, ok := actual.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an array, got %T", path, actual)}
+		}
+		if len(expected) == 0 {
+			return nil
+		}
+		var incompatibilities []string
+		for i, actualValue := range actualArray {
+			incompatibilities = append(incompatibilities, schemaIncompatibilities(fmt.Sprintf("%s[%d]", path, i), expected[0], actualValue)...)
+		}
+		return incompatibilities
+	case nil:
+		return nil
+	default:
+		if fmt.Sprintf("%T", expected) != fmt.Sprintf("%T", actual) {
+			return []string{fmt.Sprintf("%s: expected %T, got %T", path, expected, actual)}
+		}
+		return nil
+	}
+}
+
+// assertSchemaCompatible asserts that the JSON response is compatible with the golden JSON response in testdata.
+// Golden responses pin the response schemas of the JSON APIs & must only be changed along with the API version.
+func assertSchemaCompatible(t *testing.T, golden string, body []byte) {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", golden))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected, actual interface{}
+	if err := json.Unmarshal(content, &expected); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, schemaIncompatibilities("$", expected, actual), "response is incompatible with %s", golden)
+}
+
+// newTestAPIHandler returns the application handler serving the JSON APIs from the history store
+func newTestAPIHandler(t *testing.T, configuration *config.Config, store *historyStore) http.Handler {
+	logger := zap.NewNop()
+	staticService, err := NewStaticService(configuration, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitProviderService, err := NewGitlabService(configuration, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	historyService, err := NewHistoryService(configuration, logger, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippetService, err := NewSnippetService(configuration, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &Application{
+		config:           configuration,
+		staticService:    &staticService,
+		bitbucketService: &gitProviderService,
+		giteaService:     &gitProviderService,
+		githubService:    &gitProviderService,
+		gitlabService:    &gitProviderService,
+		historyStore:     store,
+		historyService:   historyService,
+		snippetService:   snippetService,
+	}
+	return app.handler()
+}
+
+func TestSchemaIncompatibilities(t *testing.T) {
+	t.Parallel()
+
+	expected := map[string]interface{}{
+		"version": "v1",
+		"points":  []interface{}{map[string]interface{}{"date": "2020-01-02", "value": 42.0}},
+	}
+
+	testCases := []struct {
+		name     string
+		actual   string
+		expected []string
+	}{
+		{"Identical", `{"version":"v1","points":[{"date":"2020-01-02","value":42}]}`, nil},
+		{"AddedField", `{"version":"v1","points":[{"date":"2020-01-02","value":42,"delta":1}],"days":30}`, nil},
+		{"EmptyArray", `{"version":"v1","points":[]}`, nil},
+		{"RemovedField", `{"points":[]}`, []string{"$.version: missing"}},
+		{"ChangedType", `{"version":"v1","points":[{"date":"2020-01-02","value":"42"}]}`, []string{"$.points[0].value: expected float64, got string"}},
+		{"ChangedShape", `{"version":"v1","points":{}}`, []string{"$.points: expected an array, got map[string]interface {}"}},
+	}
+
+	for _, testCase := range testCases {
+		var actual interface{}
+		if err := json.Unmarshal([]byte(testCase.actual), &actual); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, testCase.expected, schemaIncompatibilities("$", expected, actual), testCase.name)
+	}
+}
+
+func TestHistoryAPI(t *testing.T) {
+	t.Parallel()
+
+	store, cleanup := newTestHistoryStore(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC))
+	defer cleanup()
+	assert.NoError(t, store.add(testHistoryTarget, 42))
+	handler := newTestAPIHandler(t, &config.Config{}, store)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/history/github/google/gopacket/stars", nil)
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "", res.Header().Get("Deprecation"))
+	assertSchemaCompatible(t, "api/v1/history.json", res.Body.Bytes())
+}
+
+func TestLegacyAPI(t *testing.T) {
+	t.Parallel()
+
+	store, cleanup := newTestHistoryStore(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC))
+	defer cleanup()
+	handler := newTestAPIHandler(t, &config.Config{}, store)
+
+	testCases := []struct {
+		path         string
+		expectedLink string
+	}{
+		{"/api/history/github/google/gopacket/stars?days=7", `</api/v1/history/github/google/gopacket/stars>; rel="successor-version"`},
+		{"/api/snippet/gitlab/gitlab-org%2Fsub/repo", `</api/v1/snippet/gitlab/gitlab-org%2Fsub/repo>; rel="successor-version"`},
+	}
+
+	for _, testCase := range testCases {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", testCase.path, nil)
+		handler.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code, testCase.path)
+		assert.Equal(t, "true", res.Header().Get("Deprecation"), testCase.path)
+		assert.Equal(t, testCase.expectedLink, res.Header().Get("Link"), testCase.path)
+	}
+}
+
+func TestAPIDeprecations(t *testing.T) {
+	t.Parallel()
+
+	store, cleanup := newTestHistoryStore(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC))
+	defer cleanup()
+	handler := newTestAPIHandler(t, &config.Config{
+		APIDeprecations: map[string]time.Time{
+			"/api/v1/history": time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC),
+			"/api/v1/snip":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}, store)
+
+	testCases := []struct {
+		path               string
+		expectedDeprecated string
+		expectedSunset     string
+	}{
+		{"/api/v1/history/github/google/gopacket/stars", "true", "Wed, 30 Jun 2021 00:00:00 GMT"},
+		{"/api/v1/snippet/github/google/gopacket", "", ""},
+	}
+
+	for _, testCase := range testCases {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", testCase.path, nil)
+		handler.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code, testCase.path)
+		assert.Equal(t, testCase.expectedDeprecated, res.Header().Get("Deprecation"), testCase.path)
+		assert.Equal(t, testCase.expectedSunset, res.Header().Get("Sunset"), testCase.path)
+	}
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// azureDevopsAPIBaseURL represents the base URL of the Azure DevOps REST API
+	azureDevopsAPIBaseURL = "https://dev.azure.com"
+	// azureDevopsAPIVersion represents the version of the Azure DevOps REST API
+	azureDevopsAPIVersion = "6.0"
+	// azureDevopsPageSize represents the number of items fetched per page when counting pull requests or commits
+	azureDevopsPageSize = 1000
+	// azureDevopsMaxPages represents the maximum number of pages fetched when counting pull requests or commits, as
+	// the Azure DevOps REST API doesn't report total counts
+	azureDevopsMaxPages = 10
+)
+
+// azureDevopsPullRequestStates maps the pull request states of the request query to the pull request statuses of the
+// Azure DevOps REST API
+var azureDevopsPullRequestStates = map[string]string{
+	"":          "all",
+	"active":    "active",
+	"completed": "completed",
+	"abandoned": "abandoned",
+}
+
+type azureDevopsService struct {
+	name        string
+	baseURL     string
+	config      *config.Config
+	logger      *zap.Logger
+	httpClient  *http.Client
+	staleValues *staleValueCache
+	results     *resultCache
+	requests    singleflight.Group
+}
+
+// azureDevopsListResponse represents a list of items, whose count is the number of items listed in the response
+type azureDevopsListResponse struct {
+	Count int `json:"count"`
+}
+
+// azureDevopsCount represents the number of pull requests, branches or commits of a repository
+type azureDevopsCount struct {
+	count int
+	// truncated is whether only the items of the first pages were counted
+	truncated bool
+}
+
+// NewAzureDevopsService returns a HTTP handler for the Azure DevOps badge service
+func NewAzureDevopsService(configuration *config.Config, logger *zap.Logger) (MetricService, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	// Azure DevOps API calls are anonymous unless a personal access token is configured, which is sent as the password
+	// of HTTP basic authentication with an empty username
+	transport := upstreamTransport(configuration)
+	if configuration.AzureDevopsToken != "" {
+		transport = &basicAuthTransport{base: transport, password: configuration.AzureDevopsToken}
+	}
+
+	results, err := newResultCache(configuration, logger, "azure")
+	if err != nil {
+		return nil, err
+	}
+	return &azureDevopsService{
+		name:        "azure",
+		baseURL:     azureDevopsAPIBaseURL,
+		config:      configuration,
+		logger:      logger,
+		httpClient:  newUpstreamClient(configuration, logger, "azure", &rateLimitTransport{base: transport, limiter: newRateLimiter("azure")}),
+		staleValues: newStaleValueCache("azure", staleValueRetention, staleValueCacheSize),
+		results:     results,
+	}, nil
+}
+
+// repositoryURL returns the URL of the Git API resource of the repository
+func (service *azureDevopsService) repositoryURL(organization string, project string, repo string, resource string) string {
+	return fmt.Sprintf("%s/%s/%s/_apis/git/repositories/%s/%s", service.baseURL, organization, project, repo, resource)
+}
+
+func (service *azureDevopsService) fetchCount(ctx context.Context, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+
+	var list azureDevopsListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return 0, err
+	}
+	return list.Count, nil
+}
+
+// getPaginatedCount returns the number of items listed by the API, counted page by page with the `top` & `skip`
+// query parameters of the API
+func (service *azureDevopsService) getPaginatedCount(ctx context.Context, url string, query url.Values,
+	top string, skip string) (azureDevopsCount, error) {
+	var count azureDevopsCount
+	query.Set(top, strconv.Itoa(azureDevopsPageSize))
+	for page := 1; ; page++ {
+		// Stop paginating as soon as the request is gone, instead of fetching the remaining pages for nothing
+		if err := ctx.Err(); err != nil {
+			return azureDevopsCount{}, err
+		}
+		query.Set(skip, strconv.Itoa(count.count))
+		pageCount, err := service.fetchCount(ctx, url+"?"+query.Encode())
+		if err != nil {
+			return azureDevopsCount{}, err
+		}
+		count.count += pageCount
+
+		if pageCount < azureDevopsPageSize {
+			return count, nil
+		}
+		if page == azureDevopsMaxPages {
+			count.truncated = true
+			return count, nil
+		}
+	}
+}
+
+// getPullRequestCount returns the number of pull requests with the status (ie. "active", "completed", "abandoned" or
+// "all")
+func (service *azureDevopsService) getPullRequestCount(ctx context.Context, organization string, project string,
+	repo string, status string) (azureDevopsCount, error) {
+	query := url.Values{"api-version": {azureDevopsAPIVersion}, "searchCriteria.status": {status}}
+	return service.getPaginatedCount(ctx, service.repositoryURL(organization, project, repo, "pullrequests"), query,
+		"$top", "$skip")
+}
+
+// getCommitCount returns the number of commits of the default branch, or of the branch if set
+func (service *azureDevopsService) getCommitCount(ctx context.Context, organization string, project string,
+	repo string, branch string) (azureDevopsCount, error) {
+	query := url.Values{"api-version": {azureDevopsAPIVersion}}
+	if branch != "" {
+		query.Set("searchCriteria.itemVersion.version", branch)
+		query.Set("searchCriteria.itemVersion.versionType", "branch")
+	}
+	return service.getPaginatedCount(ctx, service.repositoryURL(organization, project, repo, "commits"), query,
+		"searchCriteria.$top", "searchCriteria.$skip")
+}
+
+func (service *azureDevopsService) getBranchCount(ctx context.Context, organization string, project string,
+	repo string) (azureDevopsCount, error) {
+	query := url.Values{"api-version": {azureDevopsAPIVersion}, "filter": {"heads/"}}
+	count, err := service.fetchCount(ctx, service.repositoryURL(organization, project, repo, "refs")+"?"+query.Encode())
+	return azureDevopsCount{count: count}, err
+}
+
+// SupportedMetrics returns the metrics served by the service
+func (service *azureDevopsService) SupportedMetrics() []string {
+	return []string{"branches", "commits", "pull-requests"}
+}
+
+func (service *azureDevopsService) supportedQueryParams() map[string][]badgeQueryParam {
+	return map[string][]badgeQueryParam{
+		"commits":       {{"branch", "Branch of the repository, defaults to the default branch", "main"}},
+		"pull-requests": {{"state", "State of the pull requests (active, completed or abandoned), defaults to every state", "active"}},
+	}
+}
+
+func (service *azureDevopsService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *azureDevopsService) fetchBadge(r *http.Request) (cachedResult, error) {
+	routeVariables := mux.Vars(r)
+	organization := routeVariables["organization"]
+	project := routeVariables["project"]
+	repo := routeVariables["repo"]
+	method := routeVariables["method"]
+	ctx := upstreamContext(r)
+
+	var subject string
+	var fetchCount func() (azureDevopsCount, error)
+	switch method {
+	case "branches":
+		subject = "branches"
+		fetchCount = func() (azureDevopsCount, error) {
+			return service.getBranchCount(ctx, organization, project, repo)
+		}
+	case "commits":
+		subject = "commits"
+		branch := r.URL.Query().Get("branch")
+		fetchCount = func() (azureDevopsCount, error) {
+			return service.getCommitCount(ctx, organization, project, repo, branch)
+		}
+	case "pull-requests":
+		state := r.URL.Query().Get("state")
+		status, ok := azureDevopsPullRequestStates[state]
+		if !ok {
+			return cachedResult{}, badRequestBadge
+		}
+		subject = "PRs"
+		if state != "" {
+			subject = state + " PRs"
+		}
+		fetchCount = func() (azureDevopsCount, error) {
+			return service.getPullRequestCount(ctx, organization, project, repo, status)
+		}
+	default:
+		return cachedResult{}, notFoundBadge
+	}
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         fetchKey(r),
+		isFinal:     isUpstreamForbidden,
+	}
+	result, err := fetchResult(r, requestLogger(service.logger, r), fetch, func() (cachedResult, error) {
+		fetched, err, _ := service.requests.Do(fetch.key, func() (interface{}, error) {
+			return fetchCount()
+		})
+		if err != nil {
+			return cachedResult{}, err
+		}
+		count := fetched.(azureDevopsCount)
+		return cachedResult{Value: count.count, Truncated: count.truncated}, nil
+	})
+
+	// Data that is denied access to is never served, not even as stale data
+	if isUpstreamForbidden(err) {
+		return result, accessDeniedBadge
+	}
+	result.Subject = subject
+	return result, err
+}
+
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *azureDevopsService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	status := formatStatus(result.Value, r.URL.Query())
+	// Counts cut short are only lower bounds
+	if result.Truncated {
+		status += "+"
+	}
+
+	badgeParams := &badge.Params{Subject: result.Subject, Status: status}
+	if err := parseColorRangesQuery(badgeParams, result.Value, r.URL.Query()); err != nil {
+		return nil, invalidQueryParameterBadge("colorRanges")
+	}
+	return badgeParams, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestAzureDevopsService returns a router serving the Azure DevOps badge service backed by a fake Azure DevOps API
+func newTestAzureDevopsService(t *testing.T, configuration *config.Config, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewAzureDevopsService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*azureDevopsService).baseURL = fakeAPI.URL
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/azure/{method}/{organization}/{project}/{repo}`, service)
+
+	return router, fakeAPI.Close
+}
+
+// fakeAzureDevopsList responds with a list of the number of items
+func fakeAzureDevopsList(w http.ResponseWriter, count int) {
+	fmt.Fprintf(w, `{"value":[],"count":%d}`, count)
+}
+
+func TestAzureDevopsServiceWithToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		configuration *config.Config
+		expected      string
+	}{
+		{"Anonymous", &config.Config{}, ""},
+		{"PersonalAccessToken", &config.Config{AzureDevopsToken: "secret"}, "Basic " + base64.StdEncoding.EncodeToString([]byte(":secret"))},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var authorization string
+			router, cleanup := newTestAzureDevopsService(t, testCase.configuration, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/contoso/fabrikam/_apis/git/repositories/web/refs", r.URL.Path)
+				assert.Equal(t, "heads/", r.URL.Query().Get("filter"))
+				authorization = r.Header.Get("Authorization")
+				fakeAzureDevopsList(w, 12)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/azure/branches/contoso/fabrikam/web", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, createBadge(&badge.Params{Subject: "branches", Status: "12"}), res.Body.String())
+			assert.Equal(t, testCase.expected, authorization)
+		})
+	}
+}
+
+func TestAzureDevopsServiceWithPullRequests(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		state          string
+		expectedStatus string
+		expected       *badge.Params
+	}{
+		{"AllStates", "", "all", &badge.Params{Subject: "PRs", Status: "42"}},
+		{"Active", "active", "active", &badge.Params{Subject: "active PRs", Status: "42"}},
+		{"Completed", "completed", "completed", &badge.Params{Subject: "completed PRs", Status: "42"}},
+		{"Abandoned", "abandoned", "abandoned", &badge.Params{Subject: "abandoned PRs", Status: "42"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var status string
+			router, cleanup := newTestAzureDevopsService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/contoso/fabrikam/_apis/git/repositories/web/pullrequests", r.URL.Path)
+				status = r.URL.Query().Get("searchCriteria.status")
+				fakeAzureDevopsList(w, 42)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/azure/pull-requests/contoso/fabrikam/web?state="+testCase.state, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedStatus, status)
+		})
+	}
+}
+
+func TestAzureDevopsServiceWithUnsupportedState(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestAzureDevopsService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected Azure DevOps API call: %s", r.URL)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/azure/pull-requests/contoso/fabrikam/web?state=merged", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestAzureDevopsServiceWithCommits(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		url           string
+		total         int
+		expectedPages int
+		expected      *badge.Params
+	}{
+		{"SinglePage", "/azure/commits/contoso/fabrikam/web", 42, 1, &badge.Params{Subject: "commits", Status: "42"}},
+		{"MultiplePages", "/azure/commits/contoso/fabrikam/web?branch=main", 2500, 3, &badge.Params{Subject: "commits", Status: "2.50k"}},
+		{"Truncated", "/azure/commits/contoso/fabrikam/web", 20000, azureDevopsMaxPages, &badge.Params{Subject: "commits", Status: "10.0k+"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			pages := 0
+			router, cleanup := newTestAzureDevopsService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/contoso/fabrikam/_apis/git/repositories/web/commits", r.URL.Path)
+				assert.Equal(t, r.URL.Query().Get("searchCriteria.itemVersion.version") != "", r.URL.Query().Get("searchCriteria.itemVersion.versionType") == "branch")
+				pages++
+				top, _ := strconv.Atoi(r.URL.Query().Get("searchCriteria.$top"))
+				skip, _ := strconv.Atoi(r.URL.Query().Get("searchCriteria.$skip"))
+				count := testCase.total - skip
+				if count > top {
+					count = top
+				}
+				fakeAzureDevopsList(w, count)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedPages, pages)
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tohjustin/aegis/internal/version"
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// badgeWidthHeader represents the header reporting the width in pixels of the SVG badge
+	badgeWidthHeader = "X-Badge-Width"
+	// badgeHeightHeader represents the header reporting the height in pixels of the SVG badge
+	badgeHeightHeader = "X-Badge-Height"
+)
+
+const (
+	// maxIconNameLength represents the maximum number of characters of the badge icon set in the request query
+	maxIconNameLength = 64
+	// maxLinks represents the maximum number of badge links set in the request query, for the subject & the status
+	maxLinks = 2
+)
+
+// badgeQueryParam represents a badge option that can be set in the request query of every badge route
+type badgeQueryParam struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Example     string `json:"example"`
+}
+
+// badgeQueryParams represents the badge options parsed by parseBadgeQuery & parseCacheSecondsQuery
+var badgeQueryParams = []badgeQueryParam{
+	{"subject", "Text of the left-hand side of the badge", "build"},
+	{"status", "Text of the right-hand side of the badge", "passing"},
+	{"color", "Color of the right-hand side of the badge, as a HEX value or a named color", "green"},
+	{"labelColor", "Color of the left-hand side of the badge, as a HEX value or a named color", "555"},
+	{"colorRanges", "Color of the badge based on its value, as ascending `<THRESHOLD>:<COLOR>` ranges & a fallback color", "10:green,50:yellow,red"},
+	{"style", "Style of the badge (classic, flat, plastic or semaphoreci)", "flat"},
+	{"icon", "Name of the icon drawn before the subject", "brands/github"},
+	{"iconColor", "Color of the icon, as a HEX value or a named color", "fff"},
+	{"iconSize", fmt.Sprintf("Size of the icon in pixels, between %d & %d", badge.MinIconSize, badge.MaxIconSize), "14"},
+	{"logo", "Image drawn before the subject, as a base64 encoded data URI", "data:image/svg+xml;base64,PHN2Zy8+"},
+	{"logoWidth", fmt.Sprintf("Width of the logo in pixels, between 1 & %d", badge.MaxLogoWidth), "14"},
+	{"direction", "Writing direction of the subject & the status (ltr or rtl), detected from their first letter by default", "rtl"},
+	{"truncate", "Maximum number of characters of the subject & the status, truncated with an ellipsis beyond", "32"},
+	{"maxWidth", "Maximum width of the badge in pixels, the subject & the status are truncated with an ellipsis to fit, & only the leading segments that fit are kept", "200"},
+	{"link", fmt.Sprintf("Links of the subject & the status, up to %d", maxLinks), "https://github.com/tohjustin/aegis"},
+	{"cacheSeconds", "Duration in seconds that the badge is cached for, clamped to the configured range", "3600"},
+	{"format", "Format of the badge (svg, png or json), negotiated with the `Accept` header by default", "png"},
+}
+
+// badgeQueryError represents an invalid badge option set in the request query
+type badgeQueryError struct {
+	Parameter string `json:"parameter"`
+	Reason    string `json:"error"`
+}
+
+func (err *badgeQueryError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", err.Parameter, err.Reason)
+}
+
+// validateColor returns an error for color values that are neither HEX values (3 or 6 digits) nor named colors,
+// an empty color is left for the default color
+func validateColor(color string) error {
+	if color != "" && !badge.IsValidColor(color) {
+		return fmt.Errorf("invalid color: %s", color)
+	}
+
+	return nil
+}
+
+// validateBadgeQuery returns a badgeQueryError for the first badge option set in the request query that is invalid,
+// so that malformed options are rejected before rendering the badge
+func validateBadgeQuery(configuration *config.Config, query url.Values) error {
+	queryParams := &badge.Params{
+		Subject:    query.Get("subject"),
+		Status:     query.Get("status"),
+		Color:      query.Get("color"),
+		LabelColor: query.Get("labelColor"),
+		IconColor:  query.Get("iconColor"),
+		Style:      badge.Style(query.Get("style")),
+		Direction:  badge.Direction(query.Get("direction")),
+	}
+	var paramErr *badge.ParamError
+	if err := queryParams.Validate(); errors.As(err, &paramErr) {
+		return &badgeQueryError{Parameter: paramErr.Param, Reason: paramErr.Err.Error()}
+	}
+	if utf8.RuneCountInString(query.Get("icon")) > maxIconNameLength {
+		return &badgeQueryError{Parameter: "icon", Reason: fmt.Sprintf("longer than %d characters", maxIconNameLength)}
+	}
+	if logo := query.Get("logo"); logo != "" {
+		if err := validateLogo(logo, configuration.MaxLogoSize); err != nil {
+			return &badgeQueryError{Parameter: "logo", Reason: err.Error()}
+		}
+	}
+	if logoWidth := query.Get("logoWidth"); logoWidth != "" {
+		if width, err := strconv.Atoi(logoWidth); err != nil || width < 1 || width > badge.MaxLogoWidth {
+			return &badgeQueryError{Parameter: "logoWidth", Reason: fmt.Sprintf("not between 1 and %d", badge.MaxLogoWidth)}
+		}
+	}
+	if format := query.Get("format"); format != "" {
+		if _, ok := parseBadgeFormat(format); !ok {
+			return &badgeQueryError{Parameter: "format", Reason: "not svg, png or json"}
+		}
+	}
+	if len(query["link"]) > maxLinks {
+		return &badgeQueryError{Parameter: "link", Reason: fmt.Sprintf("more than %d links", maxLinks)}
+	}
+	if iconSize := query.Get("iconSize"); iconSize != "" {
+		if size, err := strconv.Atoi(iconSize); err != nil || size < badge.MinIconSize || size > badge.MaxIconSize {
+			return &badgeQueryError{Parameter: "iconSize", Reason: fmt.Sprintf("not between %d and %d", badge.MinIconSize, badge.MaxIconSize)}
+		}
+	}
+	for _, name := range []string{"truncate", "maxWidth"} {
+		if value := query.Get(name); value != "" {
+			if n, err := strconv.Atoi(value); err != nil || n < 1 {
+				return &badgeQueryError{Parameter: name, Reason: "not a positive integer"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// colorRange represents the badge color of values below the threshold
+type colorRange struct {
+	threshold int
+	color     string
+}
+
+// colorRanges represents value-based badge colors, values beyond every threshold use the fallback color
+type colorRanges struct {
+	ranges   []colorRange
+	fallback string
+}
+
+// parseColorRanges parses color ranges in the form of `<THRESHOLD>:<COLOR>,...[,<FALLBACK_COLOR>]`
+// with thresholds in ascending order (eg. `10:green,50:yellow,red`)
+func parseColorRanges(str string) (*colorRanges, error) {
+	result := &colorRanges{}
+	segments := strings.Split(str, ",")
+	for i, segment := range segments {
+		parts := strings.SplitN(segment, ":", 2)
+		if len(parts) == 1 {
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("invalid color range %q: only the last color range can omit its threshold", segment)
+			}
+			if !badge.IsValidColor(parts[0]) {
+				return nil, fmt.Errorf("invalid color range %q: invalid color", segment)
+			}
+			result.fallback = parts[0]
+			continue
+		}
+
+		threshold, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid color range %q: invalid threshold", segment)
+		}
+		if !badge.IsValidColor(parts[1]) {
+			return nil, fmt.Errorf("invalid color range %q: invalid color", segment)
+		}
+		if len(result.ranges) > 0 && threshold <= result.ranges[len(result.ranges)-1].threshold {
+			return nil, fmt.Errorf("invalid color range %q: thresholds must be in ascending order", segment)
+		}
+		result.ranges = append(result.ranges, colorRange{threshold: threshold, color: parts[1]})
+	}
+
+	return result, nil
+}
+
+// colorOf returns the color of the first range whose threshold is above the value
+func (colorRanges *colorRanges) colorOf(value int) string {
+	for _, colorRange := range colorRanges.ranges {
+		if value < colorRange.threshold {
+			return colorRange.color
+		}
+	}
+
+	return colorRanges.fallback
+}
+
+// parseColorRangesQuery sets the badge color based on the value & the `colorRanges` set in the request query,
+// any explicit `color` set in the request query still takes precedence
+func parseColorRangesQuery(params *badge.Params, value int, query url.Values) error {
+	queryColorRanges := query.Get("colorRanges")
+	if queryColorRanges == "" {
+		return nil
+	}
+
+	colorRanges, err := parseColorRanges(queryColorRanges)
+	if err != nil {
+		return err
+	}
+	if color := colorRanges.colorOf(value); color != "" && query.Get("color") == "" {
+		params.Color = color
+	}
+
+	return nil
+}
+
+// parseBadgeQuery validates & overwrites the badge parameters with any values set in the request query
+func parseBadgeQuery(configuration *config.Config, params *badge.Params, query url.Values) error {
+	if err := validateBadgeQuery(configuration, query); err != nil {
+		return err
+	}
+
+	if queryColor := query.Get("color"); queryColor != "" {
+		params.Color = queryColor
+	}
+	if queryLabelColor := query.Get("labelColor"); queryLabelColor != "" {
+		params.LabelColor = queryLabelColor
+	}
+	if queryStatus := query.Get("status"); queryStatus != "" {
+		params.Status = queryStatus
+	}
+	if querySubject := query.Get("subject"); querySubject != "" {
+		params.Subject = querySubject
+	}
+	if queryIcon := query.Get("icon"); queryIcon != "" {
+		params.Icon = queryIcon
+	}
+	if queryIconColor := query.Get("iconColor"); queryIconColor != "" {
+		params.IconColor = queryIconColor
+	}
+	if queryIconSize := query.Get("iconSize"); queryIconSize != "" {
+		params.IconSize, _ = strconv.Atoi(queryIconSize)
+	}
+	if queryLogo := query.Get("logo"); queryLogo != "" {
+		params.Logo = queryLogo
+	}
+	if queryLogoWidth := query.Get("logoWidth"); queryLogoWidth != "" {
+		params.LogoWidth, _ = strconv.Atoi(queryLogoWidth)
+	}
+	if queryLinks := query["link"]; len(queryLinks) > 0 {
+		params.Links = queryLinks
+	}
+	if queryStyle := query.Get("style"); queryStyle != "" {
+		params.Style = badge.Style(queryStyle)
+	}
+	if queryDirection := query.Get("direction"); queryDirection != "" {
+		params.Direction = badge.Direction(queryDirection)
+	}
+	if queryTruncate := query.Get("truncate"); queryTruncate != "" {
+		params.Truncate, _ = strconv.Atoi(queryTruncate)
+	}
+	if queryMaxWidth := query.Get("maxWidth"); queryMaxWidth != "" {
+		params.MaxWidth, _ = strconv.Atoi(queryMaxWidth)
+	}
+
+	return nil
+}
+
+// parseCacheSecondsQuery returns the cache duration in seconds set in the request query, clamped between the
+// configured minimum & maximum. The configured default is used if unset or invalid.
+func parseCacheSecondsQuery(configuration *config.Config, query url.Values) uint {
+	seconds, err := strconv.ParseInt(query.Get("cacheSeconds"), 10, 64)
+	switch {
+	case err != nil:
+		return configuration.CacheSeconds
+	case seconds < int64(configuration.MinCacheSeconds):
+		return configuration.MinCacheSeconds
+	case seconds > int64(configuration.MaxCacheSeconds):
+		return configuration.MaxCacheSeconds
+	default:
+		return uint(seconds)
+	}
+}
+
+// setCacheControlHeaders caches the response in both browsers & CDNs for the given duration in seconds
+func setCacheControlHeaders(w http.ResponseWriter, configuration *config.Config, seconds uint) {
+	if !configuration.ExcludeCacheControlHeaders {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, s-maxage=%d", seconds, seconds))
+	}
+}
+
+// setBadgeCacheControlHeaders caches the badge response of the format for the given duration in seconds, following
+// the cache policy of the format:
+//   - SVG badges are cached in both browsers & CDNs for the duration
+//   - PNG badges, bigger, are cached for the duration too, & as immutable when the badge parameters fully determine the
+//     badge (ie. static badges) so that browsers never revalidate them
+//   - JSON badges are revalidated by browsers on every use for fresher data, cheaply thanks to their entity tag, while
+//     CDNs cache them for the duration
+func setBadgeCacheControlHeaders(w http.ResponseWriter, configuration *config.Config, format badgeFormat, seconds uint, immutable bool) {
+	if configuration.ExcludeCacheControlHeaders {
+		return
+	}
+	switch {
+	case format == pngBadgeFormat && immutable:
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, s-maxage=%d, immutable", seconds, seconds))
+	case format == jsonBadgeFormat:
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=0, s-maxage=%d, must-revalidate", seconds))
+	default:
+		setCacheControlHeaders(w, configuration, seconds)
+	}
+}
+
+// setNoStoreCacheControlHeader prevents the response from being cached, for responses to invalid requests
+func setNoStoreCacheControlHeader(w http.ResponseWriter, configuration *config.Config) {
+	if !configuration.ExcludeCacheControlHeaders {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+}
+
+// renderBadge generates a SVG badge & its dimensions from the badge parameters, recording its render duration & span
+func renderBadge(ctx context.Context, params *badge.Params) (string, badge.Size, error) {
+	_, span := startSpan(ctx, "badge.render")
+	start := time.Now()
+	defer func() {
+		badgeRenderDuration.Observe(time.Since(start).Seconds())
+		span.End()
+	}()
+
+	return badge.CreateWithSize(params)
+}
+
+// setBadgeHeaders sets the content type, length & dimensions of the badge on the HTTP response, so that clients can
+// size badges without parsing them
+func setBadgeHeaders(w http.ResponseWriter, format badgeFormat, formatted *formattedBadge) {
+	w.Header().Set("Content-Type", format.contentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(formatted.body)))
+	if formatted.size != nil {
+		w.Header().Set(badgeWidthHeader, strconv.Itoa(formatted.size.Width))
+		w.Header().Set(badgeHeightHeader, strconv.Itoa(formatted.size.Height))
+	}
+}
+
+// badgeETag returns a strong entity tag of the badge rendered in the format from the badge parameters. It's computed
+// from the parameters rather than the rendered badge so that revalidated badges aren't rendered again, along with the
+// application build as the same parameters may be rendered differently by another release.
+func badgeETag(format badgeFormat, params *badge.Params) string {
+	return fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%#v", version.GitHash, format, *params))))
+}
+
+// etagMatches reports whether the entity tag matches the `If-None-Match` request header, using the weak comparison
+// as required for the header (https://tools.ietf.org/html/rfc7232#section-3.2)
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified sets the entity tag of the badge on the HTTP response & responds with `304 Not Modified` if the
+// request already holds the badge, returning whether it did
+func writeNotModified(w http.ResponseWriter, r *http.Request, format badgeFormat, params *badge.Params) bool {
+	etag := badgeETag(format, params)
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch == "" || !etagMatches(ifNoneMatch, etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// writeBadge renders the badge parameters in the format requested & writes the badge into the HTTP response, unless
+// the request already holds the badge
+func writeBadge(w http.ResponseWriter, r *http.Request, configuration *config.Config, query url.Values, params *badge.Params) error {
+	format, negotiated := requestBadgeFormat(r)
+	setBadgeCacheControlHeaders(w, configuration, format, parseCacheSecondsQuery(configuration, query), false)
+	return writeFormattedBadge(w, r, format, negotiated, params)
+}
+
+// writeStaticBadge renders the badge parameters in the format requested & writes the badge into the HTTP response,
+// unless the request already holds the badge, for badges fully determined by the request
+func writeStaticBadge(w http.ResponseWriter, r *http.Request, configuration *config.Config, query url.Values, params *badge.Params) error {
+	format, negotiated := requestBadgeFormat(r)
+	setBadgeCacheControlHeaders(w, configuration, format, parseCacheSecondsQuery(configuration, query), true)
+	return writeFormattedBadge(w, r, format, negotiated, params)
+}
+
+// writeStaleBadge renders the badge parameters rendered from stale data in the format requested & writes the badge
+// into the HTTP response, unless the request already holds the badge
+func writeStaleBadge(w http.ResponseWriter, r *http.Request, configuration *config.Config, params *badge.Params) error {
+	if !configuration.ExcludeCacheControlHeaders {
+		// cache response briefly so that fresh data is picked up once the upstream API recovers,
+		// while letting caches serve it during revalidation
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, s-maxage=%d, stale-while-revalidate=%d",
+			configuration.MinCacheSeconds, configuration.MinCacheSeconds, int(staleValueRetention.Seconds())))
+	}
+	w.Header().Set(staleHeader, "true")
+	format, negotiated := requestBadgeFormat(r)
+	return writeFormattedBadge(w, r, format, negotiated, params)
+}
+
+// writeFormattedBadge renders the badge parameters in the format & writes the badge into the HTTP response, unless
+// the request already holds the badge. Responses of formats negotiated with the `Accept` request header vary on it, so
+// that caches never serve a badge of another format, unlike responses of formats set in the request query.
+func writeFormattedBadge(w http.ResponseWriter, r *http.Request, format badgeFormat, negotiated bool, params *badge.Params) error {
+	if negotiated {
+		w.Header().Add("Vary", "Accept")
+	}
+	if writeNotModified(w, r, format, params) {
+		return nil
+	}
+
+	formatted, err := renderBadgeFormat(r.Context(), format, params)
+	if err != nil {
+		return err
+	}
+
+	setBadgeHeaders(w, format, formatted)
+	w.Write(formatted.body)
+	return nil
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+)
+
+func TestParseColorRanges(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected *colorRanges
+	}{
+		{"WithFallback", "10:green,50:yellow,red", &colorRanges{
+			ranges:   []colorRange{{10, "green"}, {50, "yellow"}},
+			fallback: "red",
+		}},
+		{"WithoutFallback", "10:green,50:ff0000", &colorRanges{
+			ranges: []colorRange{{10, "green"}, {50, "ff0000"}},
+		}},
+		{"OnlyFallback", "critical", &colorRanges{fallback: "critical"}},
+		{"NegativeThreshold", "-1:red,0:green", &colorRanges{
+			ranges: []colorRange{{-1, "red"}, {0, "green"}},
+		}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := parseColorRanges(testCase.input)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, result)
+		})
+	}
+}
+
+func TestParseColorRangesWithInvalidSyntax(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"Empty", ","},
+		{"MissingThreshold", ":green"},
+		{"NonIntegerThreshold", "1.5:green,red"},
+		{"MissingColor", "10:,red"},
+		{"InvalidColor", "10:notacolor,red"},
+		{"InvalidFallbackColor", "10:green,notacolor"},
+		{"FallbackNotLast", "red,10:green"},
+		{"DescendingThresholds", "50:yellow,10:green,red"},
+		{"DuplicateThresholds", "10:yellow,10:green,red"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := parseColorRanges(testCase.input)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestColorRangesColorOf(t *testing.T) {
+	t.Parallel()
+
+	colorRanges, err := parseColorRanges("10:green,50:yellow,red")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		value    int
+		expected string
+	}{
+		{0, "green"},
+		{9, "green"},
+		{10, "yellow"},
+		{49, "yellow"},
+		{50, "red"},
+		{1000, "red"},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, colorRanges.colorOf(testCase.value), testCase.value)
+	}
+
+	colorRanges, err = parseColorRanges("10:green")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", colorRanges.colorOf(10))
+}
+
+func TestParseColorRangesQuery(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"WithoutColorRanges", "", ""},
+		{"WithColorRanges", "colorRanges=10:green,50:yellow,red", "yellow"},
+		{"WithColorOverride", "colorRanges=10:green,50:yellow,red&color=blue", ""},
+		{"WithoutMatchingRange", "colorRanges=10:green", ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(testCase.query)
+			params := &badge.Params{}
+			assert.NoError(t, parseColorRangesQuery(params, 20, query))
+			assert.Equal(t, testCase.expected, params.Color)
+		})
+	}
+}
@@ -1,27 +1,65 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/tohjustin/aegis/pkg/badge"
 	"github.com/tohjustin/aegis/service/config"
 )
 
+const (
+	// bitbucketAPIBaseURL represents the base URL of the Bitbucket Cloud REST API
+	bitbucketAPIBaseURL = "https://api.bitbucket.org/2.0"
+	// bitbucketPageLength represents the number of items fetched per page when counting the items of a paginated
+	// response without its size
+	bitbucketPageLength = 100
+	// bitbucketMaxPages represents the maximum number of pages fetched when counting the items of a paginated response
+	// without its size
+	bitbucketMaxPages = 10
+)
+
+// errBitbucketPullRequestsDisabled represents a Bitbucket repository without pull requests
+var errBitbucketPullRequestsDisabled = errors.New("Bitbucket pull requests are disabled")
+
+// bitbucketPullRequestStates maps the pull request states of the request query to the states of the Bitbucket API
+var bitbucketPullRequestStates = map[string]string{
+	"open":       "OPEN",
+	"merged":     "MERGED",
+	"declined":   "DECLINED",
+	"superseded": "SUPERSEDED",
+}
+
 type bitbucketService struct {
-	name   string
-	config *config.Config
-	logger *zap.Logger
+	name        string
+	baseURL     string
+	config      *config.Config
+	logger      *zap.Logger
+	httpClient  *http.Client
+	staleValues *staleValueCache
+	results     *resultCache
+	requests    singleflight.Group
 }
 
 type bitbucketFilteredResponse struct {
 	Size int `json:"size"`
 }
 
+// bitbucketPaginatedResponse represents a page of a paginated response, whose size is optional
+type bitbucketPaginatedResponse struct {
+	Size   *int              `json:"size"`
+	Next   string            `json:"next"`
+	Values []json.RawMessage `json:"values"`
+}
+
 // NewBitbucketService returns a HTTP handler for the Bitbucket badge service
 func NewBitbucketService(configuration *config.Config,
 	logger *zap.Logger) (GitProviderService, error) {
@@ -32,30 +70,102 @@ func NewBitbucketService(configuration *config.Config,
 		return nil, fmt.Errorf("missing logger dependency")
 	}
 
+	// Bitbucket API calls are anonymous unless an app password is configured
+	transport := upstreamTransport(configuration)
+	if configuration.BitbucketUsername != "" && configuration.BitbucketAppPassword != "" {
+		transport = &basicAuthTransport{
+			base:     transport,
+			username: configuration.BitbucketUsername,
+			password: configuration.BitbucketAppPassword,
+		}
+	}
+
+	results, err := newResultCache(configuration, logger, "bitbucket")
+	if err != nil {
+		return nil, err
+	}
 	return &bitbucketService{
-		name:   "bitbucket",
-		config: configuration,
-		logger: logger,
+		name:        "bitbucket",
+		baseURL:     bitbucketAPIBaseURL,
+		config:      configuration,
+		logger:      logger,
+		httpClient:  newUpstreamClient(configuration, logger, "bitbucket", &rateLimitTransport{base: transport, limiter: newRateLimiter("bitbucket")}),
+		staleValues: newStaleValueCache("bitbucket", staleValueRetention, staleValueCacheSize),
+		results:     results,
 	}, nil
 }
 
-func (service *bitbucketService) fetch(url string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// basicAuthTransport authenticates upstream API calls with HTTP basic authentication
+type basicAuthTransport struct {
+	base     http.RoundTripper
+	username string
+	password string
+}
+
+func (transport *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(transport.username, transport.password)
+	return transport.base.RoundTrip(req)
+}
+
+func (service *bitbucketService) fetch(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := (&http.Client{}).Do(req)
+	resp, err := service.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
 
 	return resp, err
 }
 
-func (service *bitbucketService) getForkCount(owner string, repo string) (int, error) {
-	url := fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s/forks?&fields=size", owner, repo)
-	resp, err := service.fetch(url)
+// getPaginatedCount returns the number of items of the paginated response, read from its size, or counted by following
+// the `next` links of its pages when Bitbucket omits the size
+func (service *bitbucketService) getPaginatedCount(ctx context.Context, url string) (int, error) {
+	count := 0
+	for page := 1; page <= bitbucketMaxPages && url != ""; page++ {
+		resp, err := service.fetch(ctx, url)
+		if err != nil {
+			return 0, err
+		}
+
+		var response bitbucketPaginatedResponse
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+		if response.Size != nil {
+			return *response.Size, nil
+		}
+		count += len(response.Values)
+		url = response.Next
+	}
+	return count, nil
+}
+
+func (service *bitbucketService) getWatcherCount(ctx context.Context, owner string, repo string) (int, error) {
+	url := fmt.Sprintf("%s/repositories/%s/%s/watchers?pagelen=%d", service.baseURL, owner, repo, bitbucketPageLength)
+	return service.getPaginatedCount(ctx, url)
+}
+
+// getRefCount returns the number of refs of the kind (ie. "branches" or "tags")
+func (service *bitbucketService) getRefCount(ctx context.Context, owner string, repo string, kind string) (int, error) {
+	url := fmt.Sprintf("%s/repositories/%s/%s/refs/%s?pagelen=%d", service.baseURL, owner, repo, kind, bitbucketPageLength)
+	return service.getPaginatedCount(ctx, url)
+}
+
+func (service *bitbucketService) getForkCount(ctx context.Context, owner string, repo string) (int, error) {
+	url := fmt.Sprintf("%s/repositories/%s/%s/forks?&fields=size", service.baseURL, owner, repo)
+	resp, err := service.fetch(ctx, url)
 	if err != nil {
 		return 0, err
 	}
@@ -69,8 +179,8 @@ func (service *bitbucketService) getForkCount(owner string, repo string) (int, e
 	return forks.Size, nil
 }
 
-func (service *bitbucketService) getIssueCount(owner string, repo string, issueState string) (int, error) {
-	url := fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s/issues", owner, repo)
+func (service *bitbucketService) getIssueCount(ctx context.Context, owner string, repo string, issueState string) (int, error) {
+	url := fmt.Sprintf("%s/repositories/%s/%s/issues", service.baseURL, owner, repo)
 	switch issueState {
 	case "new":
 		url = fmt.Sprintf("%s?&fields=size&q=(state+=+\"%s\")", url, issueState)
@@ -89,7 +199,7 @@ func (service *bitbucketService) getIssueCount(owner string, repo string, issueS
 	case "closed":
 		url = fmt.Sprintf("%s?&fields=size&q=(state+=+\"%s\")", url, issueState)
 	}
-	resp, err := service.fetch(url)
+	resp, err := service.fetch(ctx, url)
 	if err != nil {
 		return 0, err
 	}
@@ -103,19 +213,22 @@ func (service *bitbucketService) getIssueCount(owner string, repo string, issueS
 	return issues.Size, nil
 }
 
-func (service *bitbucketService) getPullRequestCount(owner string, repo string, pullRequestState string) (int, error) {
-	url := fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s/pullrequests", owner, repo)
-	switch pullRequestState {
-	case "merged":
-		url = fmt.Sprintf("%s?&fields=size&q=(state+=+\"%s\")", url, pullRequestState)
-	case "superseded":
-		url = fmt.Sprintf("%s?&fields=size&q=(state+=+\"%s\")", url, pullRequestState)
-	case "open":
-		url = fmt.Sprintf("%s?&fields=size&q=(state+=+\"%s\")", url, pullRequestState)
-	case "declined":
-		url = fmt.Sprintf("%s?&fields=size&q=(state+=+\"%s\")", url, pullRequestState)
+// getPullRequestCount returns the number of pull requests in the state, or in any state if no state is set
+func (service *bitbucketService) getPullRequestCount(ctx context.Context, owner string, repo string, pullRequestState string) (int, error) {
+	// Only open pull requests are listed unless states are set, so every state is set to list them all
+	query := url.Values{"fields": {"size"}}
+	if state, ok := bitbucketPullRequestStates[pullRequestState]; ok {
+		query.Add("state", state)
+	} else {
+		for _, state := range []string{"OPEN", "MERGED", "DECLINED", "SUPERSEDED"} {
+			query.Add("state", state)
+		}
+	}
+	apiURL := fmt.Sprintf("%s/repositories/%s/%s/pullrequests?%s", service.baseURL, owner, repo, query.Encode())
+	resp, err := service.fetch(ctx, apiURL)
+	if statusErr, ok := err.(*upstreamStatusError); ok && statusErr.statusCode == http.StatusNotFound {
+		return 0, errBitbucketPullRequestsDisabled
 	}
-	resp, err := service.fetch(url)
 	if err != nil {
 		return 0, err
 	}
@@ -129,158 +242,143 @@ func (service *bitbucketService) getPullRequestCount(owner string, repo string,
 	return pullRequests.Size, nil
 }
 
-func (service *bitbucketService) getStarCount(owner string, repo string) (int, error) {
+func (service *bitbucketService) getStarCount(ctx context.Context, owner string, repo string) (int, error) {
 	return -2, nil
 }
 
+// SupportedMetrics returns the metrics served by the service
+func (service *bitbucketService) SupportedMetrics() []string {
+	return []string{"branches", "forks", "issues", "pull-requests", "stars", "tags", "watchers"}
+}
+
+func (service *bitbucketService) supportedQueryParams() map[string][]badgeQueryParam {
+	return map[string][]badgeQueryParam{
+		"issues":        {{"state", "State of the issues (new, open, resolved, on-hold, invalid, duplicate, wontfix or closed), defaults to every state", "open"}},
+		"pull-requests": {{"state", "State of the pull requests (open, merged, declined or superseded), defaults to every state", "open"}},
+	}
+}
+
 func (service *bitbucketService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *bitbucketService) fetchBadge(r *http.Request) (cachedResult, error) {
 	routeVariables := mux.Vars(r)
 	owner := routeVariables["owner"]
 	repo := routeVariables["repo"]
 	method := routeVariables["method"]
+	ctx := upstreamContext(r)
 
-	// Fetch data
-	var color, status, subject string
-	var value int
-	var err error
-	switch method {
-	case "forks":
-		subject = "forks"
-		value, err = service.getForkCount(owner, repo)
-	case "issues":
-		state := r.URL.Query().Get("state")
-		switch state {
-		case "":
-			subject = "issues"
-		case "new":
-			subject = "new issues"
-		case "open":
-			subject = "open issues"
-		case "resolved":
-			subject = "resolved issues"
-		case "on-hold":
-			subject = "on-hold issues"
-		case "invalid":
-			subject = "invalid issues"
-		case "duplicate":
-			subject = "duplicate issues"
-		case "wontfix":
-			subject = "wontfix issues"
-		case "closed":
-			subject = "closed issues"
-		default:
-			service.logger.Info("Unsupported state",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.String("state", state))
-			if err := badRequest(w, service.config); err != nil {
-				service.logger.Error("Failed to create error badge",
-					zap.String("url", r.URL.RequestURI()),
-					zap.String("service", service.name),
-					zap.String("method", method),
-					zap.Error(err))
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         fetchKey(r),
+		isFinal:     isUpstreamForbidden,
+	}
+	result, err := fetchResult(r, requestLogger(service.logger, r), fetch, func() (cachedResult, error) {
+		var result cachedResult
+		var err error
+		switch method {
+		case "branches", "tags":
+			result.Subject = method
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getRefCount(ctx, owner, repo, method)
+			})
+		case "forks":
+			result.Subject = "forks"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getForkCount(ctx, owner, repo)
+			})
+		case "issues":
+			state := r.URL.Query().Get("state")
+			switch state {
+			case "":
+				result.Subject = "issues"
+			case "new":
+				result.Subject = "new issues"
+			case "open":
+				result.Subject = "open issues"
+			case "resolved":
+				result.Subject = "resolved issues"
+			case "on-hold":
+				result.Subject = "on-hold issues"
+			case "invalid":
+				result.Subject = "invalid issues"
+			case "duplicate":
+				result.Subject = "duplicate issues"
+			case "wontfix":
+				result.Subject = "wontfix issues"
+			case "closed":
+				result.Subject = "closed issues"
+			default:
+				return result, badRequestBadge
 			}
-			return
-		}
-		value, err = service.getIssueCount(owner, repo, state)
-	case "pull-requests":
-		state := r.URL.Query().Get("state")
-		switch state {
-		case "":
-			subject = "PRs"
-		case "merged":
-			subject = "merged PRs"
-		case "superseded":
-			subject = "superseded PRs"
-		case "open":
-			subject = "open PRs"
-		case "declined":
-			subject = "declined PRs"
-		default:
-			service.logger.Info("Unsupported state",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.String("state", state))
-			if err := badRequest(w, service.config); err != nil {
-				service.logger.Error("Failed to create error badge",
-					zap.String("url", r.URL.RequestURI()),
-					zap.String("service", service.name),
-					zap.String("method", method),
-					zap.Error(err))
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getIssueCount(ctx, owner, repo, state)
+			})
+		case "pull-requests":
+			state := r.URL.Query().Get("state")
+			switch state {
+			case "":
+				result.Subject = "PRs"
+			case "merged":
+				result.Subject = "merged PRs"
+			case "superseded":
+				result.Subject = "superseded PRs"
+			case "open":
+				result.Subject = "open PRs"
+			case "declined":
+				result.Subject = "declined PRs"
+			default:
+				return result, badRequestBadge
 			}
-			return
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getPullRequestCount(ctx, owner, repo, state)
+			})
+		case "stars":
+			result.Subject = "stars"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getStarCount(ctx, owner, repo)
+			})
+		case "watchers":
+			result.Subject = "watchers"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getWatcherCount(ctx, owner, repo)
+			})
+		default:
+			return result, notFoundBadge
 		}
-		value, err = service.getPullRequestCount(owner, repo, state)
-	case "stars":
-		subject = "stars"
-		value, err = service.getStarCount(owner, repo)
-	default:
-		service.logger.Info("Unsupported method",
-			zap.String("url", r.URL.RequestURI()),
-			zap.String("service", service.name),
-			zap.String("method", method))
-		if err := notFound(w, service.config); err != nil {
-			service.logger.Error("Failed to create error badge",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.Error(err))
+		if err == errBitbucketPullRequestsDisabled {
+			result.Status, result.Color, err = "disabled", "lightgrey", nil
 		}
-		return
-	}
-	if err != nil {
-		service.logger.Error("Failed to fetch data",
-			zap.String("url", r.URL.RequestURI()),
-			zap.String("service", service.name),
-			zap.String("method", method),
-			zap.Error(err))
-		if err := internalServerError(w, service.config); err != nil {
-			service.logger.Error("Failed to create error badge",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.Error(err))
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		}
-		return
+		return result, err
+	})
+	// Data that is denied access to is never served, not even as stale data
+	if isUpstreamForbidden(err) {
+		return result, accessDeniedBadge
 	}
-	status = formatIntegerWithMetricPrefix(value)
+	return result, err
+}
 
-	// Overwrite any badge texts
-	if queryColor := r.URL.Query().Get("color"); queryColor != "" {
-		color = queryColor
-	}
-	if queryStatus := r.URL.Query().Get("status"); queryStatus != "" {
-		status = queryStatus
-	}
-	if querySubject := r.URL.Query().Get("subject"); querySubject != "" {
-		subject = querySubject
-	}
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *bitbucketService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	value, subject, status, color := result.Value, result.Subject, result.Status, result.Color
 
-	// Generate badge
-	generatedBadge, err := badge.Create(&badge.Params{
-		Style:   badge.Style(r.URL.Query().Get("style")),
-		Subject: subject,
-		Status:  status,
-		Color:   color,
-		Icon:    r.URL.Query().Get("icon"),
-	})
-	if err != nil {
-		service.logger.Error("Failed to create badge",
-			zap.String("url", r.URL.RequestURI()),
-			zap.String("service", service.name),
-			zap.String("method", method),
-			zap.Error(err))
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+	// Textual statuses are used as is, only numeric values are formatted & colored by value
+	isNumeric := status == ""
+	if isNumeric {
+		status = formatStatus(value, r.URL.Query())
 	}
 
-	if !service.config.ExcludeCacheControlHeaders {
-		// cache response in browser for 1 hour (3600), CDN for 1 hour (3600)
-		w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=3600")
+	badgeParams := &badge.Params{Subject: subject, Status: status, Color: color, Sparkline: sparklineFromRequest(r)}
+	if isNumeric {
+		if err := parseColorRangesQuery(badgeParams, value, r.URL.Query()); err != nil {
+			return nil, invalidQueryParameterBadge("colorRanges")
+		}
 	}
-	w.Header().Set("Content-Type", "image/svg+xml;utf-8")
-	w.Write([]byte(generatedBadge))
+	return badgeParams, nil
 }
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestBitbucketService returns a router serving the Bitbucket badge service backed by a fake Bitbucket API
+func newTestBitbucketService(t *testing.T, configuration *config.Config, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewBitbucketService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*bitbucketService).baseURL = fakeAPI.URL
+
+	router := mux.NewRouter()
+	router.Handle(`/bitbucket/{method}/{owner}/{repo}`, service).Name("bitbucket")
+
+	return router, fakeAPI.Close
+}
+
+func TestBitbucketServiceWithAppPassword(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		configuration    *config.Config
+		expectedAuth     bool
+		expectedUsername string
+		expectedPassword string
+	}{
+		{"Anonymous", &config.Config{}, false, "", ""},
+		{"AppPassword", &config.Config{BitbucketUsername: "user", BitbucketAppPassword: "secret"}, true, "user", "secret"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var auth bool
+			var username, password string
+			router, cleanup := newTestBitbucketService(t, testCase.configuration, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/repositories/atlassian/aui-react/forks", r.URL.Path)
+				username, password, auth = r.BasicAuth()
+				w.Write([]byte(`{"size":42}`))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/bitbucket/forks/atlassian/aui-react", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, createBadge(&badge.Params{Subject: "forks", Status: "42"}), res.Body.String())
+			assert.Equal(t, testCase.expectedAuth, auth)
+			assert.Equal(t, testCase.expectedUsername, username)
+			assert.Equal(t, testCase.expectedPassword, password)
+		})
+	}
+}
+
+func TestBitbucketServiceWithAccessDenied(t *testing.T) {
+	t.Parallel()
+
+	for _, statusCode := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		router, cleanup := newTestBitbucketService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(statusCode)
+		})
+
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/bitbucket/issues/atlassian/aui-react", nil)
+		router.ServeHTTP(res, req)
+		cleanup()
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "access denied"}), res.Body.String())
+	}
+}
+
+func TestBitbucketServiceWithPullRequests(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		state          string
+		expectedStates []string
+		expected       *badge.Params
+	}{
+		{"AllStates", "", []string{"OPEN", "MERGED", "DECLINED", "SUPERSEDED"}, &badge.Params{Subject: "PRs", Status: "42"}},
+		{"Open", "open", []string{"OPEN"}, &badge.Params{Subject: "open PRs", Status: "42"}},
+		{"Merged", "merged", []string{"MERGED"}, &badge.Params{Subject: "merged PRs", Status: "42"}},
+		{"Declined", "declined", []string{"DECLINED"}, &badge.Params{Subject: "declined PRs", Status: "42"}},
+		{"Superseded", "superseded", []string{"SUPERSEDED"}, &badge.Params{Subject: "superseded PRs", Status: "42"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var states []string
+			router, cleanup := newTestBitbucketService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/repositories/atlassian/aui-react/pullrequests", r.URL.Path)
+				assert.Equal(t, "size", r.URL.Query().Get("fields"))
+				states = r.URL.Query()["state"]
+				w.Write([]byte(`{"size":42}`))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/bitbucket/pull-requests/atlassian/aui-react?state="+testCase.state, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedStates, states)
+		})
+	}
+}
+
+func TestBitbucketServiceWithPullRequestsDisabled(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestBitbucketService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"type":"error","error":{"message":"Not found"}}`))
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/bitbucket/pull-requests/atlassian/aui-react?state=open", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "open PRs", Status: "disabled", Color: "lightgrey"}), res.Body.String())
+}
+
+func TestBitbucketServiceWithWatchersAndRefs(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		url           string
+		pages         []string
+		expectedPath  string
+		expectedPages int
+		expected      *badge.Params
+	}{
+		{
+			"Watchers", "/bitbucket/watchers/atlassian/aui-react",
+			[]string{`{"size":42,"pagelen":100,"values":[]}`},
+			"/repositories/atlassian/aui-react/watchers", 1,
+			&badge.Params{Subject: "watchers", Status: "42"},
+		},
+		{
+			"Branches", "/bitbucket/branches/atlassian/aui-react",
+			[]string{`{"size":1234,"pagelen":100,"values":[{"name":"master"}]}`},
+			"/repositories/atlassian/aui-react/refs/branches", 1,
+			&badge.Params{Subject: "branches", Status: "1.23k"},
+		},
+		{
+			"TagsWithoutSize", "/bitbucket/tags/atlassian/aui-react",
+			[]string{
+				`{"pagelen":2,"values":[{"name":"v1.0.0"},{"name":"v1.1.0"}],"next":"%s/repositories/atlassian/aui-react/refs/tags?page=2"}`,
+				`{"pagelen":2,"values":[{"name":"v1.2.0"},{"name":"v2.0.0"}],"next":"%s/repositories/atlassian/aui-react/refs/tags?page=3"}`,
+				`{"pagelen":2,"values":[{"name":"v2.1.0"}]}`,
+			},
+			"/repositories/atlassian/aui-react/refs/tags", 3,
+			&badge.Params{Subject: "tags", Status: "5"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var pages int
+			var baseURL string
+			router, cleanup := newTestBitbucketService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, testCase.expectedPath, r.URL.Path)
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				if page == 0 {
+					page = 1
+					assert.Equal(t, "100", r.URL.Query().Get("pagelen"))
+				}
+				pages++
+				body := testCase.pages[page-1]
+				if strings.Contains(body, "%s") {
+					body = fmt.Sprintf(body, baseURL)
+				}
+				w.Write([]byte(body))
+			})
+			defer cleanup()
+			baseURL = router.Get("bitbucket").GetHandler().(*bitbucketService).baseURL
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedPages, pages)
+		})
+	}
+}
+
+func TestBitbucketServiceWithRefsPageCap(t *testing.T) {
+	t.Parallel()
+
+	var pages int
+	var baseURL string
+	router, cleanup := newTestBitbucketService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		w.Write([]byte(fmt.Sprintf(`{"values":[{"name":"a"}],"next":"%s/repositories/atlassian/aui-react/refs/tags?page=%d"}`, baseURL, pages+1)))
+	})
+	defer cleanup()
+	baseURL = router.Get("bitbucket").GetHandler().(*bitbucketService).baseURL
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/bitbucket/tags/atlassian/aui-react", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "tags", Status: strconv.Itoa(bitbucketMaxPages)}), res.Body.String())
+	assert.Equal(t, bitbucketMaxPages, pages)
+}
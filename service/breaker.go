@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// circuitState represents the state of a circuit breaker
+type circuitState int
+
+const (
+	// circuitClosed lets every upstream API call through
+	circuitClosed circuitState = iota
+	// circuitHalfOpen lets a single upstream API call through, probing whether the upstream API has recovered
+	circuitHalfOpen
+	// circuitOpen fails every upstream API call immediately
+	circuitOpen
+)
+
+func (state circuitState) String() string {
+	switch state {
+	case circuitClosed:
+		return "closed"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// errCircuitOpen represents an upstream API call failed immediately by an open circuit breaker
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker stops calling an upstream API after consecutive failures, so that requests don't keep waiting on
+// an unavailable upstream API. The circuit opens after `threshold` consecutive failures, & lets a single probe call
+// through after `cooldown` to decide whether to close or reopen.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	provider  string
+	logger    *zap.Logger
+	threshold uint
+	cooldown  time.Duration
+	state     circuitState
+	failures  uint
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func newCircuitBreaker(provider string, logger *zap.Logger, threshold uint, cooldown time.Duration) *circuitBreaker {
+	breaker := &circuitBreaker{
+		provider:  provider,
+		logger:    logger,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     circuitClosed,
+		now:       time.Now,
+	}
+	circuitBreakerState.WithLabelValues(provider).Set(float64(circuitClosed))
+	return breaker
+}
+
+// setState transitions the circuit breaker into the state, must be called with the lock held
+func (breaker *circuitBreaker) setState(state circuitState) {
+	if breaker.state == state {
+		return
+	}
+	breaker.logger.Info("Circuit breaker state changed",
+		zap.String("provider", breaker.provider),
+		zap.String("from", breaker.state.String()),
+		zap.String("to", state.String()))
+	breaker.state = state
+	circuitBreakerState.WithLabelValues(breaker.provider).Set(float64(state))
+}
+
+// allow returns whether an upstream API call can be made
+func (breaker *circuitBreaker) allow() bool {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	switch breaker.state {
+	case circuitOpen:
+		if breaker.now().Sub(breaker.openedAt) < breaker.cooldown {
+			return false
+		}
+		breaker.setState(circuitHalfOpen)
+		breaker.probing = true
+		return true
+	case circuitHalfOpen:
+		if breaker.probing {
+			return false
+		}
+		breaker.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record records the outcome of an upstream API call allowed by the circuit breaker
+func (breaker *circuitBreaker) record(success bool) {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	breaker.probing = false
+	if success {
+		breaker.failures = 0
+		breaker.setState(circuitClosed)
+		return
+	}
+
+	breaker.failures++
+	if breaker.state == circuitHalfOpen || breaker.failures >= breaker.threshold {
+		breaker.openedAt = breaker.now()
+		breaker.setState(circuitOpen)
+	}
+}
+
+// release releases an upstream API call allowed by the circuit breaker without recording its outcome
+func (breaker *circuitBreaker) release() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	breaker.probing = false
+}
+
+// circuitBreakerTransport fails upstream API calls immediately while the circuit breaker is open, counting
+// network errors, 429 & 5xx responses as failures
+type circuitBreakerTransport struct {
+	base    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+func (transport *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !transport.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+
+	resp, err := transport.base.RoundTrip(req)
+	// calls skipped due to an exhausted rate limit say nothing about the health of the upstream API
+	if isUpstreamRateLimited(err) {
+		transport.breaker.release()
+		return resp, err
+	}
+	transport.breaker.record(err == nil &&
+		resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError)
+	return resp, err
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestCircuitBreaker returns a circuit breaker whose clock is controlled by the returned function
+func newTestCircuitBreaker(threshold uint, cooldown time.Duration) (*circuitBreaker, func(time.Duration)) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := newCircuitBreaker("test", zap.NewNop(), threshold, cooldown)
+	breaker.now = func() time.Time { return now }
+	return breaker, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("OpensAfterConsecutiveFailures", func(t *testing.T) {
+		breaker, _ := newTestCircuitBreaker(3, time.Minute)
+		for i := 0; i < 2; i++ {
+			assert.True(t, breaker.allow())
+			breaker.record(false)
+		}
+		assert.Equal(t, circuitClosed, breaker.state)
+
+		assert.True(t, breaker.allow())
+		breaker.record(false)
+		assert.Equal(t, circuitOpen, breaker.state)
+		assert.False(t, breaker.allow())
+	})
+
+	t.Run("SuccessResetsFailures", func(t *testing.T) {
+		breaker, _ := newTestCircuitBreaker(2, time.Minute)
+		breaker.allow()
+		breaker.record(false)
+		breaker.allow()
+		breaker.record(true)
+		breaker.allow()
+		breaker.record(false)
+		assert.Equal(t, circuitClosed, breaker.state)
+	})
+
+	t.Run("HalfOpenAfterCooldown", func(t *testing.T) {
+		breaker, advance := newTestCircuitBreaker(1, time.Minute)
+		breaker.allow()
+		breaker.record(false)
+
+		advance(59 * time.Second)
+		assert.False(t, breaker.allow())
+		assert.Equal(t, circuitOpen, breaker.state)
+
+		advance(time.Second)
+		assert.True(t, breaker.allow())
+		assert.Equal(t, circuitHalfOpen, breaker.state)
+		// only a single probe is let through
+		assert.False(t, breaker.allow())
+	})
+
+	t.Run("ClosesAfterSuccessfulProbe", func(t *testing.T) {
+		breaker, advance := newTestCircuitBreaker(1, time.Minute)
+		breaker.allow()
+		breaker.record(false)
+		advance(time.Minute)
+
+		assert.True(t, breaker.allow())
+		breaker.record(true)
+		assert.Equal(t, circuitClosed, breaker.state)
+		assert.True(t, breaker.allow())
+	})
+
+	t.Run("ReopensAfterFailedProbe", func(t *testing.T) {
+		breaker, advance := newTestCircuitBreaker(3, time.Minute)
+		for i := 0; i < 3; i++ {
+			breaker.allow()
+			breaker.record(false)
+		}
+		advance(time.Minute)
+
+		assert.True(t, breaker.allow())
+		breaker.record(false)
+		assert.Equal(t, circuitOpen, breaker.state)
+		assert.False(t, breaker.allow())
+
+		// the cooldown restarts from the failed probe
+		advance(59 * time.Second)
+		assert.False(t, breaker.allow())
+		advance(time.Second)
+		assert.True(t, breaker.allow())
+	})
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		statusCode int
+		failure    bool
+	}{
+		{"OK", http.StatusOK, false},
+		{"NotFound", http.StatusNotFound, false},
+		{"TooManyRequests", http.StatusTooManyRequests, true},
+		{"InternalServerError", http.StatusInternalServerError, true},
+		{"BadGateway", http.StatusBadGateway, true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(testCase.statusCode)
+			}))
+			defer fakeAPI.Close()
+
+			breaker, _ := newTestCircuitBreaker(1, time.Minute)
+			client := &http.Client{Transport: &circuitBreakerTransport{base: http.DefaultTransport, breaker: breaker}}
+			resp, err := client.Get(fakeAPI.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			assert.Equal(t, testCase.failure, breaker.state == circuitOpen)
+		})
+	}
+}
+
+func TestCircuitBreakerWithFailingUpstream(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	var failing int32
+	configuration := &config.Config{UpstreamTimeout: time.Second, CircuitBreakerThreshold: 2, CircuitBreakerCooldown: time.Hour}
+	router, cleanup := newTestRetryingGitlabService(t, configuration, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-Total", "42")
+		w.Write([]byte("[]"))
+	})
+	defer cleanup()
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	res := serve("/gitlab/issues/gitlab-org/gitaly")
+	assert.Equal(t, createBadge(&badge.Params{Subject: "issues", Status: "42"}), res.Body.String())
+
+	atomic.StoreInt32(&failing, 1)
+	for i := 0; i < 2; i++ {
+		serve("/gitlab/issues/gitlab-org/gitaly")
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// while open, the stale badge is served without calling the upstream API
+	res = serve("/gitlab/issues/gitlab-org/gitaly")
+	assert.Equal(t, "true", res.Header().Get(staleHeader))
+	assert.Equal(t, createBadge(&badge.Params{Subject: "issues", Status: "42"}), res.Body.String())
+
+	// ...or the error badge, if there's no stale value
+	res = serve("/gitlab/forks/gitlab-org/gitaly")
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "internal server error"}), res.Body.String())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// resultKeyPrefix represents the prefix of the keys of results stored in Redis, shared with other applications
+	resultKeyPrefix = "aegis:result:"
+	// redisTimeout represents the maximum duration of Redis commands, after which results are cached in memory
+	redisTimeout = 100 * time.Millisecond
+	// redisPurgeTimeout represents the maximum duration of purging results from Redis, as every result of the provider
+	// is scanned
+	redisPurgeTimeout = 5 * time.Second
+	// memoryResultCacheSize represents the maximum number of results cached in memory while Redis is unreachable
+	memoryResultCacheSize = 4096
+)
+
+// errResultNotFound represents a result that isn't stored, or expired
+var errResultNotFound = errors.New("result not found")
+
+// resultQueryParams represents the query parameters that affect the results of badges, on top of the query parameters
+// that affect the fetched data
+var resultQueryParams = []string{"display", "units"}
+
+// resultKey identifies the result of the badge requested, based on the data fetched for it & the query parameters
+// formatting the data
+func resultKey(r *http.Request) string {
+	return fetchKey(r) + resultKeySuffix(r)
+}
+
+// resultKeySuffix returns the suffix of the result key identifying the query parameters formatting the data, appended
+// to the key of the data fetched for the badge requested
+func resultKeySuffix(r *http.Request) string {
+	query := url.Values{}
+	for _, name := range resultQueryParams {
+		if value := r.URL.Query().Get(name); value != "" {
+			query.Set(name, value)
+		}
+	}
+	return "#" + query.Encode()
+}
+
+// cachedResult represents the data of a badge fetched from the upstream API, as serialized in the result cache
+type cachedResult struct {
+	Value     int    `json:"value,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Color     string `json:"color,omitempty"`
+	// Segments holds the data of each segment of multi-segment badges (eg. the open issues of each label)
+	Segments []cachedSegment `json:"segments,omitempty"`
+	// stale is whether the result is the last successfully fetched data, served while the upstream API is unavailable
+	stale bool
+	// cacheSeconds overwrites the cache duration of the badge requested, if set (eg. for data cached longer upstream)
+	cacheSeconds uint
+}
+
+// cachedSegment represents the data of a segment of a multi-segment badge, as serialized in the result cache
+type cachedSegment struct {
+	Text  string `json:"text"`
+	Value int    `json:"value"`
+	Color string `json:"color,omitempty"`
+}
+
+// resultStore stores serialized results until their TTL expires
+type resultStore interface {
+	get(ctx context.Context, key string) ([]byte, error)
+	set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// purge removes the results whose keys start with the prefix & match, returning the number of results removed
+	purge(ctx context.Context, prefix string, match func(key string) bool) (int, error)
+}
+
+// memoryResult represents a serialized result stored in memory
+type memoryResult struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// memoryResultStore stores serialized results in memory, only shared within the instance
+type memoryResultStore struct {
+	mu      sync.Mutex
+	size    int
+	results map[string]memoryResult
+	now     func() time.Time
+}
+
+func newMemoryResultStore(size int) *memoryResultStore {
+	return &memoryResultStore{
+		size:    size,
+		results: map[string]memoryResult{},
+		now:     time.Now,
+	}
+}
+
+func (store *memoryResultStore) get(ctx context.Context, key string) ([]byte, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	result, ok := store.results[key]
+	if !ok {
+		return nil, errResultNotFound
+	}
+	if store.now().After(result.expiresAt) {
+		delete(store.results, key)
+		return nil, errResultNotFound
+	}
+	return result.value, nil
+}
+
+func (store *memoryResultStore) set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// make room by evicting expired results first, then any result
+	if _, ok := store.results[key]; !ok && len(store.results) >= store.size {
+		now := store.now()
+		for storedKey, storedResult := range store.results {
+			if now.After(storedResult.expiresAt) {
+				delete(store.results, storedKey)
+			}
+		}
+		for storedKey := range store.results {
+			if len(store.results) < store.size {
+				break
+			}
+			delete(store.results, storedKey)
+		}
+	}
+	store.results[key] = memoryResult{value: value, expiresAt: store.now().Add(ttl)}
+	return nil
+}
+
+func (store *memoryResultStore) purge(ctx context.Context, prefix string, match func(key string) bool) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	purged := 0
+	for key := range store.results {
+		if strings.HasPrefix(key, prefix) && match(key) {
+			delete(store.results, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// redisResultStore stores serialized results in Redis, shared among every instance using the same Redis server
+type redisResultStore struct {
+	client *redis.Client
+}
+
+func (store *redisResultStore) get(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	value, err := store.client.Get(ctx, resultKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, errResultNotFound
+	}
+	return value, err
+}
+
+func (store *redisResultStore) set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	return store.client.Set(ctx, resultKeyPrefix+key, value, ttl).Err()
+}
+
+func (store *redisResultStore) purge(ctx context.Context, prefix string, match func(key string) bool) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisPurgeTimeout)
+	defer cancel()
+
+	// the prefix is escaped as keys may hold glob characters (eg. `[` in query parameters)
+	var keys []string
+	iter := store.client.Scan(ctx, 0, escapeRedisPattern(resultKeyPrefix+prefix)+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		if match(strings.TrimPrefix(iter.Val(), resultKeyPrefix)) {
+			keys = append(keys, iter.Val())
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	purged, err := store.client.Del(ctx, keys...).Result()
+	return int(purged), err
+}
+
+// escapeRedisPattern escapes the glob characters of the string, to match it literally in Redis patterns
+func escapeRedisPattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]^-\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// newRedisClient returns a client of the Redis server shared among instances
+func newRedisClient(configuration *config.Config) (*redis.Client, error) {
+	options, err := redis.ParseURL(configuration.RedisURL)
+	if err != nil {
+		// the error isn't wrapped as it may hold the Redis password
+		return nil, errors.New("invalid Redis URL")
+	}
+	return redis.NewClient(options), nil
+}
+
+// resultCache shares the data fetched for badges of the provider among instances, so that each instance doesn't
+// call the upstream API for the same data. Results are stored by provider & result key (ie. the method, the
+// owner, the repository & the query parameters filtering the data), & cached in memory while Redis is unreachable.
+type resultCache struct {
+	mu       sync.Mutex
+	provider string
+	logger   *zap.Logger
+	ttl      time.Duration
+	store    resultStore
+	fallback resultStore
+	degraded bool
+}
+
+// newResultCache returns the result cache of the provider, or nil if no Redis server is set as results aren't
+// shared then
+func newResultCache(configuration *config.Config, logger *zap.Logger, provider string) (*resultCache, error) {
+	if configuration.RedisURL == "" {
+		return nil, nil
+	}
+
+	client, err := newRedisClient(configuration)
+	if err != nil {
+		return nil, err
+	}
+	resultCacheDegraded.WithLabelValues(provider).Set(0)
+	return &resultCache{
+		provider: provider,
+		logger:   logger,
+		ttl:      time.Duration(configuration.RedisCacheSeconds) * time.Second,
+		store:    &redisResultStore{client: client},
+		fallback: newMemoryResultStore(memoryResultCacheSize),
+	}, nil
+}
+
+// setDegraded records whether Redis is unreachable, logging whenever it changes
+func (cache *resultCache) setDegraded(degraded bool, err error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.degraded == degraded {
+		return
+	}
+	if degraded {
+		cache.logger.Warn("Redis is unreachable, caching results in memory",
+			zap.String("provider", cache.provider),
+			zap.Error(err))
+		resultCacheDegraded.WithLabelValues(cache.provider).Set(1)
+	} else {
+		cache.logger.Info("Redis is reachable again, sharing results",
+			zap.String("provider", cache.provider))
+		resultCacheDegraded.WithLabelValues(cache.provider).Set(0)
+	}
+	cache.degraded = degraded
+}
+
+// get returns the result of the badge, if fetched within the TTL. A nil result cache never has results.
+func (cache *resultCache) get(ctx context.Context, key string) (cachedResult, bool) {
+	if cache == nil {
+		return cachedResult{}, false
+	}
+
+	span := startCacheLookupSpan(ctx, cache.provider, "result")
+	value, err := cache.store.get(ctx, cache.provider+":"+key)
+	if err != nil && err != errResultNotFound {
+		resultCacheErrorsTotal.WithLabelValues(cache.provider, "get").Inc()
+		cache.setDegraded(true, err)
+		value, err = cache.fallback.get(ctx, cache.provider+":"+key)
+	} else {
+		cache.setDegraded(false, nil)
+	}
+
+	var result cachedResult
+	if err == nil {
+		err = json.Unmarshal(value, &result)
+	}
+	if err != nil {
+		cacheLookupsTotal.WithLabelValues(cache.provider, "result", "miss").Inc()
+		endCacheLookupSpan(span, "miss")
+		return cachedResult{}, false
+	}
+
+	cacheLookupsTotal.WithLabelValues(cache.provider, "result", "hit").Inc()
+	endCacheLookupSpan(span, "hit")
+	return result, true
+}
+
+// set keeps the successfully fetched result of the badge for the TTL
+func (cache *resultCache) set(ctx context.Context, key string, result cachedResult) {
+	if cache == nil {
+		return
+	}
+
+	value, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	if err := cache.store.set(ctx, cache.provider+":"+key, value, cache.ttl); err != nil {
+		resultCacheErrorsTotal.WithLabelValues(cache.provider, "set").Inc()
+		cache.setDegraded(true, err)
+		cache.fallback.set(ctx, cache.provider+":"+key, value, cache.ttl)
+		return
+	}
+	cache.setDegraded(false, nil)
+}
+
+// purge removes the results of the badges of the repository, from Redis & from memory, returning the number of
+// results removed
+func (cache *resultCache) purge(ctx context.Context, owner string, repo string) int {
+	if cache == nil {
+		return 0
+	}
+
+	prefix := cache.provider + ":"
+	match := func(key string) bool {
+		return isRepositoryKey(strings.TrimPrefix(key, prefix), owner, repo)
+	}
+	purged, err := cache.store.purge(ctx, prefix, match)
+	if err != nil {
+		resultCacheErrorsTotal.WithLabelValues(cache.provider, "purge").Inc()
+		cache.setDegraded(true, err)
+	}
+	fallbackPurged, _ := cache.fallback.purge(ctx, prefix, match)
+	return purged + fallbackPurged
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+func newTestResultCache(t *testing.T, provider string) (*resultCache, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := newResultCache(&config.Config{RedisURL: "redis://" + server.Addr(), RedisCacheSeconds: 300}, zap.NewNop(), provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache, server
+}
+
+func TestResultCacheWithoutRedis(t *testing.T) {
+	t.Parallel()
+
+	cache, err := newResultCache(&config.Config{}, zap.NewNop(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, cache)
+
+	// results are never shared
+	cache.set(context.Background(), "stars/google/gopacket?#", cachedResult{Value: 42})
+	_, ok := cache.get(context.Background(), "stars/google/gopacket?#")
+	assert.False(t, ok)
+}
+
+func TestResultCacheWithInvalidRedisURL(t *testing.T) {
+	t.Parallel()
+
+	_, err := newResultCache(&config.Config{RedisURL: "redis://:secret@localhost:port", RedisCacheSeconds: 300}, zap.NewNop(), "mock")
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "secret")
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	t.Parallel()
+
+	cache, server := newTestResultCache(t, "mock-redis")
+	defer server.Close()
+
+	_, ok := cache.get(context.Background(), "stars/google/gopacket?#")
+	assert.False(t, ok)
+
+	cache.set(context.Background(), "stars/google/gopacket?#", cachedResult{Value: 42, Subject: "stars"})
+	result, ok := cache.get(context.Background(), "stars/google/gopacket?#")
+	assert.True(t, ok)
+	assert.Equal(t, cachedResult{Value: 42, Subject: "stars"}, result)
+
+	// results are serialized in Redis under the key of the provider, expiring with the TTL
+	assert.Equal(t, []string{"aegis:result:mock-redis:stars/google/gopacket?#"}, server.Keys())
+	assert.Equal(t, 300*time.Second, server.TTL("aegis:result:mock-redis:stars/google/gopacket?#"))
+	value, err := server.Get("aegis:result:mock-redis:stars/google/gopacket?#")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"value":42,"subject":"stars"}`, value)
+
+	server.FastForward(300 * time.Second)
+	_, ok = cache.get(context.Background(), "stars/google/gopacket?#")
+	assert.False(t, ok)
+	assert.Equal(t, float64(0), testutil.ToFloat64(resultCacheDegraded.WithLabelValues("mock-redis")))
+}
+
+func TestResultCacheWhenRedisIsUnreachable(t *testing.T) {
+	t.Parallel()
+
+	cache, server := newTestResultCache(t, "mock-unreachable")
+	defer server.Close()
+	server.Close()
+
+	// results are cached in memory instead, until Redis is reachable again
+	cache.set(context.Background(), "stars/google/gopacket?#", cachedResult{Value: 42})
+	result, ok := cache.get(context.Background(), "stars/google/gopacket?#")
+	assert.True(t, ok)
+	assert.Equal(t, cachedResult{Value: 42}, result)
+	assert.Equal(t, float64(1), testutil.ToFloat64(resultCacheDegraded.WithLabelValues("mock-unreachable")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(resultCacheErrorsTotal.WithLabelValues("mock-unreachable", "set")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(resultCacheErrorsTotal.WithLabelValues("mock-unreachable", "get")))
+
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	_, ok = cache.get(context.Background(), "stars/google/gopacket?#")
+	assert.False(t, ok)
+	assert.Equal(t, float64(0), testutil.ToFloat64(resultCacheDegraded.WithLabelValues("mock-unreachable")))
+}
+
+func TestMemoryResultStore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	store := newMemoryResultStore(2)
+	store.now = func() time.Time { return now }
+
+	assert.NoError(t, store.set(context.Background(), "a", []byte("1"), time.Minute))
+	assert.NoError(t, store.set(context.Background(), "b", []byte("2"), time.Hour))
+	value, err := store.get(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	// expired results are evicted first to make room
+	store.now = func() time.Time { return now.Add(time.Minute + time.Second) }
+	_, err = store.get(context.Background(), "a")
+	assert.Equal(t, errResultNotFound, err)
+	assert.NoError(t, store.set(context.Background(), "c", []byte("3"), time.Hour))
+	assert.Len(t, store.results, 2)
+	value, err = store.get(context.Background(), "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+}
+
+func TestResultCacheSharedAmongInstances(t *testing.T) {
+	t.Parallel()
+
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// every upstream API call reports one more issue
+	var calls int32
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", strconv.Itoa(int(atomic.AddInt32(&calls, 1))))
+		w.Write([]byte(`[{"number":1}]`))
+	}))
+	defer fakeAPI.Close()
+
+	var instances []*mux.Router
+	for i := 0; i < 2; i++ {
+		service, err := NewGiteaService(&config.Config{GiteaBaseURL: fakeAPI.URL, RedisURL: "redis://" + server.Addr(), RedisCacheSeconds: 300}, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		router := mux.NewRouter()
+		router.Handle(`/gitea/{method}/{owner}/{repo}`, service)
+		instances = append(instances, router)
+	}
+	request := func(instance *mux.Router, path string) string {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		instance.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code, path)
+		return res.Body.String()
+	}
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "open issues", Status: "1"}), request(instances[0], "/gitea/issues/forgejo/forgejo?state=open"))
+	assert.Equal(t, createBadge(&badge.Params{Subject: "open issues", Status: "1"}), request(instances[1], "/gitea/issues/forgejo/forgejo?state=open"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// results of other filters are fetched on their own
+	assert.Equal(t, createBadge(&badge.Params{Subject: "closed issues", Status: "2"}), request(instances[1], "/gitea/issues/forgejo/forgejo?state=closed"))
+	assert.Equal(t, createBadge(&badge.Params{Subject: "closed issues", Status: "2"}), request(instances[0], "/gitea/issues/forgejo/forgejo?state=closed"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.ElementsMatch(t, []string{
+		"aegis:result:gitea:issues/forgejo/forgejo?state=open#",
+		"aegis:result:gitea:issues/forgejo/forgejo?state=closed#",
+	}, server.Keys())
+
+	// expired results are fetched again
+	server.FastForward(300 * time.Second)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "open issues", Status: "3"}), request(instances[1], "/gitea/issues/forgejo/forgejo?state=open"))
+}
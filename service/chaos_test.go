@@ -0,0 +1,247 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/x509"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// chaosDeadline represents the maximum duration a request can take while the upstream API is faulty
+const chaosDeadline = time.Second
+
+// faultyReader returns the prefix, then keeps failing with the given error
+type faultyReader struct {
+	prefix io.Reader
+	err    error
+}
+
+func (reader *faultyReader) Read(p []byte) (int, error) {
+	if n, _ := reader.prefix.Read(p); n > 0 {
+		return n, nil
+	}
+	return 0, reader.err
+}
+
+// endlessReader returns its content over & over until the context is done
+type endlessReader struct {
+	ctx     context.Context
+	content []byte
+}
+
+func (reader *endlessReader) Read(p []byte) (int, error) {
+	if err := reader.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for n < len(p) {
+		n += copy(p[n:], reader.content)
+	}
+	return n, nil
+}
+
+var (
+	gzipBombOnce sync.Once
+	gzipBomb     []byte
+)
+
+// gzipBombBody returns a small gzip-compressed body that expands into a valid-looking JSON prefix
+// followed by 16MB of digits
+func gzipBombBody() io.Reader {
+	gzipBombOnce.Do(func() {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.Write([]byte(`{"size":`))
+		writer.Write(bytes.Repeat([]byte("1"), 16<<20))
+		writer.Close()
+		gzipBomb = buf.Bytes()
+	})
+
+	reader, _ := gzip.NewReader(bytes.NewReader(gzipBomb))
+	return reader
+}
+
+// faultyTransport is a HTTP transport simulating a faulty upstream API
+type faultyTransport struct {
+	fault func(req *http.Request) (*http.Response, error)
+}
+
+func (transport *faultyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return transport.fault(req)
+}
+
+func newFaultyResponse(req *http.Request, contentType string, body io.Reader) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Body:       ioutil.NopCloser(body),
+		Request:    req,
+	}
+}
+
+var chaosFaults = map[string]func(req *http.Request) (*http.Response, error){
+	"SlowDNS": func(req *http.Request) (*http.Response, error) {
+		select {
+		case <-req.Context().Done():
+			return nil, &net.DNSError{Err: "i/o timeout", Name: req.URL.Host, IsTimeout: true}
+		case <-time.After(10 * time.Second):
+			return nil, &net.DNSError{Err: "no such host", Name: req.URL.Host, IsNotFound: true}
+		}
+	},
+	"TLSError": func(req *http.Request) (*http.Response, error) {
+		return nil, x509.UnknownAuthorityError{}
+	},
+	"ConnectionResetMidBody": func(req *http.Request) (*http.Response, error) {
+		return newFaultyResponse(req, "application/json", &faultyReader{
+			prefix: strings.NewReader(`{"size": 4`),
+			err:    &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET},
+		}), nil
+	},
+	"WrongContentType": func(req *http.Request) (*http.Response, error) {
+		return newFaultyResponse(req, "text/html", strings.NewReader("<html><body>Service Unavailable</body></html>")), nil
+	},
+	"EndlessBody": func(req *http.Request) (*http.Response, error) {
+		return newFaultyResponse(req, "application/json", io.MultiReader(
+			strings.NewReader(`{"size":`),
+			&endlessReader{ctx: req.Context(), content: []byte("1111111111")},
+		)), nil
+	},
+	"MalformedChunkedEncoding": func(req *http.Request) (*http.Response, error) {
+		return newFaultyResponse(req, "application/json",
+			httputil.NewChunkedReader(strings.NewReader("4\r\n{\"si\r\nzz\r\nze\": 1}\r\n0\r\n\r\n"))), nil
+	},
+	"GzipBomb": func(req *http.Request) (*http.Response, error) {
+		return newFaultyResponse(req, "application/json", gzipBombBody()), nil
+	},
+}
+
+// chaosPaths represents every badge path fetching from an upstream API
+var chaosPaths = []string{
+	"/bitbucket/forks/atlassian/aui-react",
+	"/bitbucket/issues/atlassian/aui-react",
+	"/bitbucket/pull-requests/atlassian/aui-react",
+	"/github/forks/google/gopacket",
+	"/github/issues/google/gopacket",
+	"/github/license-check/google/gopacket?allow=MIT",
+	"/github/pull-requests/google/gopacket",
+	"/github/review-load/google/gopacket",
+	"/github/stars/google/gopacket",
+	"/gitlab/epics/gitlab-org/gitaly",
+	"/gitlab/forks/gitlab-org/gitaly",
+	"/gitlab/issue-weight/gitlab-org/gitaly",
+	"/gitlab/issues/gitlab-org/gitaly",
+	"/gitlab/merge-requests/gitlab-org/gitaly",
+	"/gitlab/stars/gitlab-org/gitaly",
+	"/gitlab/topics/gitlab-org/gitaly",
+	"/gitlab/visibility/gitlab-org/gitaly",
+}
+
+// newChaosApplication returns the application handler with every git provider service calling upstream APIs
+// through the given transport
+func newChaosApplication(t *testing.T, transport http.RoundTripper) http.Handler {
+	logger := zap.NewNop()
+	configuration := &config.Config{
+		UpstreamTimeout:   200 * time.Millisecond,
+		GithubAccessToken: "token",
+	}
+
+	mockStaticService, err := NewStaticService(configuration, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockBitbucketService, err := NewBitbucketService(configuration, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockBitbucketService.(*bitbucketService).httpClient = newUpstreamClient(configuration, logger, "bitbucket", transport)
+	mockGithubService, err := NewGithubService(configuration, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockGithubService.(*githubService).client = githubv4.NewClient(newUpstreamClient(configuration, logger, "github", transport))
+	mockGitlabService, err := NewGitlabService(configuration, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockGitlabService.(*gitlabService).httpClient = newUpstreamClient(configuration, logger, "gitlab", transport)
+
+	app := &Application{
+		config:           configuration,
+		staticService:    &mockStaticService,
+		bitbucketService: &mockBitbucketService,
+		giteaService:     &mockBitbucketService,
+		githubService:    &mockGithubService,
+		gitlabService:    &mockGitlabService,
+	}
+	return app.handler()
+}
+
+func TestHandlersWithFaultyUpstream(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	// compress the gzip bomb upfront, so that it doesn't count towards the deadline
+	gzipBombBody()
+
+	expectedBody := createBadge(&badge.Params{Subject: "aegis", Status: "internal server error"})
+	for name, fault := range chaosFaults {
+		fault := fault
+		t.Run(name, func(t *testing.T) {
+			handler := newChaosApplication(t, &faultyTransport{fault: fault})
+			for _, path := range chaosPaths {
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", path, nil)
+
+				start := time.Now()
+				handler.ServeHTTP(res, req)
+				elapsed := time.Since(start)
+
+				assert.True(t, elapsed < chaosDeadline, "%s took %s", path, elapsed)
+				assert.Equal(t, http.StatusOK, res.Code, path)
+				assert.Equal(t, "image/svg+xml;utf-8", res.Header().Get("Content-Type"), path)
+				assert.Equal(t, expectedBody, res.Body.String(), path)
+				var svg struct {
+					XMLName xml.Name `xml:"svg"`
+				}
+				assert.NoError(t, xml.Unmarshal(res.Body.Bytes(), &svg), path)
+			}
+		})
+	}
+}
+
+func TestLimitedBodyTransport(t *testing.T) {
+	t.Parallel()
+
+	transport := &limitedBodyTransport{base: &faultyTransport{fault: chaosFaults["GzipBomb"]}}
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, maxUpstreamResponseSize, len(body))
+
+	_, err = (&limitedBodyTransport{base: &faultyTransport{fault: chaosFaults["TLSError"]}}).RoundTrip(req)
+	assert.Error(t, err)
+}
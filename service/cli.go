@@ -0,0 +1,181 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/cobra"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+)
+
+// Formats of the badges written by the CLI
+const (
+	svgFormat = "svg"
+	pngFormat = "png"
+)
+
+// writeBadgeOutput renders the badge in the format into the output file, or into stdout if the output is `-`
+func writeBadgeOutput(stdout io.Writer, params *badge.Params, format string, output string) error {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case svgFormat:
+		err = badge.Render(&buf, params)
+	case pngFormat:
+		err = badge.RenderPNG(&buf, params)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if output == "-" {
+		_, err = stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(output, buf.Bytes(), 0644)
+}
+
+// runGenerate writes the badge of the parameters, without calling any upstream API
+func runGenerate(stdout io.Writer, params *badge.Params, format string, output string) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	return writeBadgeOutput(stdout, params, format, output)
+}
+
+// fetchBadgePath returns the path of the badge route of the provider, from the metric & the path segments
+// identifying the repository or the package (eg. `owner/repo`)
+func fetchBadgePath(provider string, metric string, names []string) string {
+	segments := []string{"", url.PathEscape(provider), url.PathEscape(metric)}
+	for _, name := range names {
+		segments = append(segments, url.PathEscape(name))
+	}
+	return strings.Join(segments, "/")
+}
+
+// fetchBadgeParams fetches the data of the badge of the provider from the upstream API with the metric service of the
+// provider, returning the parameters of the badge rendered from the data. The route variables of the badge are those of
+// the badge route of the application matching the path.
+func (app *Application) fetchBadgeParams(ctx context.Context, provider string, path string, query url.Values) (*badge.Params, error) {
+	fetcher, ok := app.metricServices()[provider].(badgeFetcher)
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
+	}
+	req, err := http.NewRequest("GET", path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var match mux.RouteMatch
+	if !app.router().Match(req, &match) || match.MatchErr != nil {
+		return nil, fmt.Errorf("no badge route matches %s", path)
+	}
+
+	params, result, err := fetchBadgeParams(mux.SetURLVars(req.WithContext(ctx), match.Vars), app.config, fetcher)
+	if err != nil {
+		return nil, err
+	}
+	if result.stale {
+		return nil, errors.New("upstream API is unavailable")
+	}
+	return params, nil
+}
+
+// runFetch writes the badge of the metric of the provider, fetching its data from the upstream API. The arguments are
+// the provider, the path segments identifying the repository or the package & the metric (eg. `github owner repo
+// stars`).
+func (app *Application) runFetch(ctx context.Context, stdout io.Writer, args []string, query url.Values, format string, output string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("expected a provider, a repository or package & a metric, got %d arguments", len(args))
+	}
+	params, err := app.fetchBadgeParams(ctx, args[0], fetchBadgePath(args[0], args[len(args)-1], args[1:len(args)-1]), query)
+	if err != nil {
+		return err
+	}
+	return writeBadgeOutput(stdout, params, format, output)
+}
+
+// parseQueryFlags parses the `key=value` query parameters set with flags
+func parseQueryFlags(values []string) (url.Values, error) {
+	query := url.Values{}
+	for _, value := range values {
+		i := strings.Index(value, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid query parameter %q, expected key=value", value)
+		}
+		query.Add(value[:i], value[i+1:])
+	}
+	return query, nil
+}
+
+// newGenerateCmd returns the command writing static badges
+func newGenerateCmd() *cobra.Command {
+	params := &badge.Params{}
+	var style, format, output string
+	cmd := &cobra.Command{
+		Use:  "generate",
+		Long: "Generate a static badge without running the server",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			params.Style = badge.Style(style)
+			if err := runGenerate(os.Stdout, params, format, output); err != nil {
+				log.Fatalf("Failed to generate badge: %v", err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&params.Subject, "subject", "", "Subject text (left-hand side) of the badge.")
+	cmd.Flags().StringVar(&params.Status, "status", "", "Status text (right-hand side) of the badge.")
+	cmd.Flags().StringVar(&params.Color, "color", "", "Color of the status of the badge (eg. \"green\", \"#1bacbf\").")
+	cmd.Flags().StringVar(&params.LabelColor, "label-color", "", "Color of the subject of the badge.")
+	cmd.Flags().StringVar(&params.Icon, "icon", "", "Icon of the badge (eg. \"brands/docker\"), SVG badges only.")
+	cmd.Flags().StringVar(&style, "style", "", "Style of the badge (classic, flat, plastic or semaphoreci).")
+	cmd.Flags().StringVar(&format, "format", svgFormat, "Format of the badge (svg or png).")
+	cmd.Flags().StringVarP(&output, "output", "o", "-", "File the badge is written into, \"-\" for stdout.")
+	return cmd
+}
+
+// newFetchCmd returns the command writing badges of the metrics of the providers, fetching their data from the
+// upstream APIs with the configuration of the server (eg. access tokens)
+func (app *Application) newFetchCmd() *cobra.Command {
+	var style, format, output string
+	var queryFlags []string
+	cmd := &cobra.Command{
+		Use:  "fetch <provider> <owner> <repo> <metric>",
+		Long: "Fetch the data of a badge from the upstream API & generate the badge without running the server, eg. `fetch github owner repo stars` or `fetch npm package version`",
+		Args: cobra.MinimumNArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			query, err := parseQueryFlags(queryFlags)
+			if err != nil {
+				log.Fatalf("Failed to fetch badge: %v", err)
+			}
+			if style != "" {
+				query.Set("style", style)
+			}
+
+			app.init(cmd)
+			if err := app.initServices(); err != nil {
+				log.Fatalf("Failed to initialize services: %v", err)
+			}
+			if err := app.runFetch(context.Background(), os.Stdout, args, query, format, output); err != nil {
+				log.Fatalf("Failed to fetch badge: %v", err)
+			}
+		},
+	}
+	cmd.Flags().StringArrayVar(&queryFlags, "query", nil, "Query parameter of the badge route as key=value (eg. \"state=open\"), repeatable.")
+	cmd.Flags().StringVar(&style, "style", "", "Style of the badge (classic, flat, plastic or semaphoreci).")
+	cmd.Flags().StringVar(&format, "format", svgFormat, "Format of the badge (svg or png).")
+	cmd.Flags().StringVarP(&output, "output", "o", "-", "File the badge is written into, \"-\" for stdout.")
+	return cmd
+}
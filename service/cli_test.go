@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestFetchApplication returns the application whose Gitea service calls the fake API
+func newTestFetchApplication(t *testing.T, fakeAPIHandler http.HandlerFunc) (*Application, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+	app := newTestIndexApplication(t, "")
+	giteaService, err := NewGiteaService(&config.Config{CacheSeconds: 3600, GiteaBaseURL: fakeAPI.URL}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.giteaService = &giteaService
+	return app, fakeAPI.Close
+}
+
+func TestRunGenerate(t *testing.T) {
+	t.Parallel()
+
+	params := &badge.Params{Subject: "build", Status: "passing", Color: "green", Style: badge.FlatStyle}
+	expected, err := badge.Create(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	assert.NoError(t, runGenerate(&stdout, params, "svg", "-"))
+	assert.Equal(t, expected, stdout.String())
+
+	dir, err := ioutil.TempDir("", "aegis-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "badge.png")
+	assert.NoError(t, runGenerate(&stdout, params, "png", output))
+	data, err := ioutil.ReadFile(output)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, pngSignature))
+	assert.Equal(t, len(expected), stdout.Len())
+}
+
+func TestRunGenerateInvalidParams(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		params *badge.Params
+		format string
+	}{
+		{"InvalidColor", &badge.Params{Subject: "build", Color: "nope"}, "svg"},
+		{"InvalidStyle", &badge.Params{Subject: "build", Style: "nope"}, "svg"},
+		{"UnsupportedFormat", &badge.Params{Subject: "build"}, "gif"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout bytes.Buffer
+			assert.Error(t, runGenerate(&stdout, testCase.params, testCase.format, "-"))
+			assert.Empty(t, stdout.String())
+		})
+	}
+}
+
+func TestRunFetch(t *testing.T) {
+	t.Parallel()
+
+	app, closeFakeAPI := newTestFetchApplication(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/repos/forgejo/forgejo/issues", r.URL.Path)
+		assert.Equal(t, "closed", r.URL.Query().Get("state"))
+		w.Header().Set("X-Total-Count", "1234")
+		w.Write([]byte(`[{"number":1}]`))
+	})
+	defer closeFakeAPI()
+
+	var stdout bytes.Buffer
+	query := url.Values{"state": {"closed"}, "style": {"flat"}}
+	assert.NoError(t, app.runFetch(context.Background(), &stdout, []string{"gitea", "forgejo", "forgejo", "issues"}, query, "svg", "-"))
+	expected, err := badge.Create(&badge.Params{Subject: "closed issues", Status: "1.23k", Style: badge.FlatStyle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, stdout.String())
+
+	stdout.Reset()
+	assert.NoError(t, app.runFetch(context.Background(), &stdout, []string{"gitea", "forgejo", "forgejo", "issues"}, query, "png", "-"))
+	assert.True(t, bytes.HasPrefix(stdout.Bytes(), pngSignature))
+}
+
+func TestRunFetchErrors(t *testing.T) {
+	t.Parallel()
+
+	// the upstream API fails for every repository but `forgejo/forgejo`
+	app, closeFakeAPI := newTestFetchApplication(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/repos/forgejo/forgejo" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"stars_count":42}`))
+	})
+	defer closeFakeAPI()
+
+	testCases := []struct {
+		name          string
+		args          []string
+		query         url.Values
+		expectedError string
+	}{
+		{"UpstreamError", []string{"gitea", "forgejo", "broken", "stars"}, nil, "unexpected status code: 500"},
+		{"UnsupportedMetric", []string{"gitea", "forgejo", "forgejo", "unknown"}, nil, "not found"},
+		{"UnsupportedProvider", []string{"unknown", "forgejo", "forgejo", "stars"}, nil, "unsupported provider"},
+		{"InvalidQuery", []string{"gitea", "forgejo", "forgejo", "stars"}, url.Values{"style": {"unknown"}}, "invalid style"},
+		{"MissingArguments", []string{"gitea", "stars"}, nil, "expected a provider"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		// subtests share the fake API, closed once they all ran
+		t.Run(testCase.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := app.runFetch(context.Background(), &stdout, testCase.args, testCase.query, "svg", "-")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), testCase.expectedError)
+			}
+			assert.Empty(t, stdout.String())
+		})
+	}
+}
+
+func TestParseQueryFlags(t *testing.T) {
+	t.Parallel()
+
+	query, err := parseQueryFlags([]string{"state=open", "label=bug", "label=a=b", "empty="})
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"state": {"open"}, "label": {"bug", "a=b"}, "empty": {""}}, query)
+
+	_, err = parseQueryFlags([]string{"state"})
+	assert.Error(t, err)
+	_, err = parseQueryFlags([]string{"=open"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// maxCombinedMetrics represents the maximum number of metrics of a combined badge
+	maxCombinedMetrics = 4
+	// combinedErrorStatus represents the status of the segments of metrics that failed to be fetched
+	combinedErrorStatus = "err"
+	// combinedErrorColor represents the color of the segments of metrics that failed to be fetched
+	combinedErrorColor = "lightgrey"
+)
+
+// combinedRouteVariables represents the route variables identifying the repository or the package of the badge routes
+// of the metric services, by provider
+var combinedRouteVariables = map[string][]string{
+	"azure":     {"organization", "project", "repo"},
+	"bitbucket": {"owner", "repo"},
+	"crates":    {"package"},
+	"docker":    {"owner", "repo"},
+	"gitea":     {"owner", "repo"},
+	"github":    {"owner", "repo"},
+	"gitlab":    {"owner", "repo"},
+	"npm":       {"package"},
+	"pypi":      {"package"},
+	"sourcehut": {"owner", "repo"},
+}
+
+// combinedExtraRouteVariables represents the metrics whose badge routes identify their data with an extra route
+// variable (eg. the tag of the release of the downloads), which combined badges don't set, by provider
+var combinedExtraRouteVariables = map[string]map[string]string{
+	"github": {"downloads": "tag", "milestone": "number", "workflow": "workflow"},
+}
+
+// combinedQueryParams represents the query parameters of combined badges, which aren't passed on to the badge routes
+// of their metrics along with the other query parameters
+var combinedQueryParams = []string{"metrics", "icons", "subject", "status"}
+
+type combinedMemoContextKey struct{}
+
+// combinedMemo memoizes data fetched by the metrics of a combined badge, so that metrics derived from the same upstream
+// object (eg. the stars & the forks of a GitLab project) only fetch it once per combined badge
+type combinedMemo struct {
+	mutex   sync.Mutex
+	entries map[string]*combinedMemoEntry
+}
+
+// combinedMemoEntry represents data fetched, or being fetched, for the metrics of a combined badge
+type combinedMemoEntry struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newCombinedMemo() *combinedMemo {
+	return &combinedMemo{entries: map[string]*combinedMemoEntry{}}
+}
+
+// combinedMemoFromContext returns the memo of the combined badge the request is fetching a metric of, if any
+func combinedMemoFromContext(ctx context.Context) (*combinedMemo, bool) {
+	memo, ok := ctx.Value(combinedMemoContextKey{}).(*combinedMemo)
+	return memo, ok
+}
+
+// do returns the data of the key, fetching it unless it was already fetched or is being fetched by another metric, in
+// which case the data fetched by the other metric is returned. Failed fetches aren't memoized, so that later metrics
+// fetch the data again. It also returns whether the data was memoized.
+func (memo *combinedMemo) do(key string, fetch func() (interface{}, error)) (interface{}, bool, error) {
+	memo.mutex.Lock()
+	if entry, ok := memo.entries[key]; ok {
+		memo.mutex.Unlock()
+		<-entry.done
+		return entry.value, true, entry.err
+	}
+	entry := &combinedMemoEntry{done: make(chan struct{})}
+	memo.entries[key] = entry
+	memo.mutex.Unlock()
+
+	entry.value, entry.err = fetch()
+	if entry.err != nil {
+		memo.mutex.Lock()
+		delete(memo.entries, key)
+		memo.mutex.Unlock()
+	}
+	close(entry.done)
+	return entry.value, false, entry.err
+}
+
+// combinedRoutePath returns the path template of the combined badge route of the provider (eg.
+// `/github/combined/{owner}/{repo}`)
+func combinedRoutePath(provider string, variables []string) string {
+	path := "/" + provider + "/combined"
+	for _, variable := range variables {
+		path += "/{" + variable + "}"
+	}
+	return path
+}
+
+// handleCombined registers the combined badge route of the provider on the router, which must be registered before the
+// badge routes of the metrics of the provider
+func handleCombined(router *mux.Router, configuration *config.Config, logger *zap.Logger, provider string, service MetricService) {
+	handler := newCombinedHandler(configuration, logger, provider, service)
+	router.Handle(combinedRoutePath(provider, combinedRouteVariables[provider]), withMetrics(provider, handler)).Methods("GET", "HEAD")
+}
+
+// combinedHandler serves badges combining metrics of a repository or a package, rendered as one segment per metric
+type combinedHandler struct {
+	config    *config.Config
+	logger    *zap.Logger
+	provider  string
+	variables []string
+	service   MetricService
+	fetcher   badgeFetcher
+}
+
+// newCombinedHandler returns a HTTP handler for the combined badges of the provider, fetching the data of each metric
+// from the metric service
+func newCombinedHandler(configuration *config.Config, logger *zap.Logger, provider string, service MetricService) http.Handler {
+	fetcher, _ := service.(badgeFetcher)
+	return &combinedHandler{
+		config:    configuration,
+		logger:    logger,
+		provider:  provider,
+		variables: combinedRouteVariables[provider],
+		service:   service,
+		fetcher:   fetcher,
+	}
+}
+
+// metricRequest returns the request for the badge of the metric of the repository or the package of the combined
+// badge requested, as served by the badge route of the metric
+func (handler *combinedHandler) metricRequest(ctx context.Context, r *http.Request, metric string, query url.Values) *http.Request {
+	metricURL := *r.URL
+	metricURL.RawQuery = query.Encode()
+	req := r.WithContext(ctx)
+	req.URL = &metricURL
+
+	routeVariables := mux.Vars(r)
+	metricRouteVariables := map[string]string{"method": metric}
+	for _, variable := range handler.variables {
+		metricRouteVariables[variable] = routeVariables[variable]
+	}
+	return mux.SetURLVars(req, metricRouteVariables)
+}
+
+// parseCombinedQuery returns the metrics & the icons of their segments set in the request query
+func (handler *combinedHandler) parseCombinedQuery(query url.Values) ([]string, []string, error) {
+	supported := make(map[string]bool)
+	if handler.fetcher != nil {
+		for _, metric := range handler.service.SupportedMetrics() {
+			supported[metric] = true
+		}
+	}
+
+	metrics := strings.Split(query.Get("metrics"), ",")
+	if len(metrics) > maxCombinedMetrics {
+		return nil, nil, &badgeQueryError{Parameter: "metrics", Reason: fmt.Sprintf("more than %d metrics", maxCombinedMetrics)}
+	}
+	for _, metric := range metrics {
+		if !supported[metric] {
+			return nil, nil, &badgeQueryError{Parameter: "metrics", Reason: fmt.Sprintf("unsupported metric %q", metric)}
+		}
+		if variable, ok := combinedExtraRouteVariables[handler.provider][metric]; ok {
+			return nil, nil, &badgeQueryError{Parameter: "metrics", Reason: fmt.Sprintf("metric %q requires the %s path segment", metric, variable)}
+		}
+	}
+
+	icons := make([]string, len(metrics))
+	if value := query.Get("icons"); value != "" {
+		values := strings.Split(value, ",")
+		if len(values) > len(metrics) {
+			return nil, nil, &badgeQueryError{Parameter: "icons", Reason: "more icons than metrics"}
+		}
+		for i, icon := range values {
+			if utf8.RuneCountInString(icon) > maxIconNameLength {
+				return nil, nil, &badgeQueryError{Parameter: "icons", Reason: fmt.Sprintf("longer than %d characters", maxIconNameLength)}
+			}
+			icons[i] = icon
+		}
+	}
+	return metrics, icons, nil
+}
+
+func (handler *combinedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(handler.logger, r)
+	query := r.URL.Query()
+	badgeParams := &badge.Params{}
+	metrics, icons, err := handler.parseCombinedQuery(query)
+	if err == nil {
+		err = parseBadgeQuery(handler.config, badgeParams, query)
+	}
+	if err != nil {
+		logger.Info("Invalid badge query",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", handler.provider),
+			zap.String("method", "combined"),
+			zap.Error(err))
+		if err := invalidBadgeQuery(w, handler.config, err); err != nil {
+			logger.Error("Failed to create error response",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", handler.provider),
+				zap.String("method", "combined"),
+				zap.Error(err))
+		}
+		return
+	}
+
+	// Query parameters of the metrics (eg. `state` of issues) are passed on to the badge route of each metric
+	metricQuery := url.Values{}
+	for name, values := range query {
+		metricQuery[name] = values
+	}
+	for _, name := range combinedQueryParams {
+		metricQuery.Del(name)
+	}
+
+	// Fetch the metrics concurrently, metrics failing to be fetched are rendered as `err` without failing the others.
+	// Metrics share a memo of the upstream objects they're derived from for the duration of the request.
+	ctx := context.WithValue(r.Context(), combinedMemoContextKey{}, newCombinedMemo())
+	segments := make([]badge.Segment, len(metrics))
+	staleMetrics := make([]bool, len(metrics))
+	errs := fanOutBestEffort(ctx, maxCombinedMetrics, len(metrics), func(ctx context.Context, i int) error {
+		params, result, err := fetchBadgeParams(handler.metricRequest(ctx, r, metrics[i], metricQuery), handler.config, handler.fetcher)
+		if err != nil {
+			return err
+		}
+		text := params.Status
+		if icons[i] == "" {
+			text = params.Subject + " " + params.Status
+		}
+		segments[i] = badge.Segment{Text: text, Color: params.Color, Icon: icons[i], Label: params.Subject + ": " + params.Status}
+		staleMetrics[i] = result.stale
+		return nil
+	})
+
+	failed, stale := false, false
+	for i, err := range errs {
+		stale = stale || staleMetrics[i]
+		if err == nil {
+			continue
+		}
+		logger.Info("Failed to fetch metric of combined badge",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", handler.provider),
+			zap.String("method", metrics[i]),
+			zap.Error(err))
+		text := combinedErrorStatus
+		if icons[i] == "" {
+			text = metrics[i] + " " + combinedErrorStatus
+		}
+		segments[i] = badge.Segment{Text: text, Color: combinedErrorColor, Icon: icons[i], Label: metrics[i] + ": " + combinedErrorStatus}
+		failed = true
+	}
+	badgeParams.Segments = segments
+
+	// Badges with failed or stale metrics are only cached briefly, so that the metrics are fetched again soon
+	if stale {
+		err = writeStaleBadge(w, r, handler.config, badgeParams)
+	} else {
+		if failed {
+			query.Set("cacheSeconds", strconv.FormatUint(uint64(handler.config.MinCacheSeconds), 10))
+		}
+		err = writeBadge(w, r, handler.config, query, badgeParams)
+	}
+	if err != nil {
+		logger.Error("Failed to create badge",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", handler.provider),
+			zap.String("method", "combined"),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestCombinedService returns a router serving the combined & the metric badge routes of the Gitea badge service
+// backed by a fake Gitea instance
+func newTestCombinedService(t *testing.T, configuration *config.Config, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+	configuration.GiteaBaseURL = fakeAPI.URL
+
+	service, err := NewGiteaService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	handleCombined(router, configuration, zap.NewNop(), "gitea", service)
+	router.Handle(`/gitea/{method}/{owner}/{repo}`, withSupportedMetrics(configuration, service, service))
+
+	return router, fakeAPI.Close
+}
+
+// newTestCombinedGitlabService returns a router serving the combined & the metric badge routes of the Gitlab badge
+// service backed by a fake GitLab API
+func newTestCombinedGitlabService(t *testing.T, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	configuration := &config.Config{}
+	service, err := NewGitlabService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*gitlabService).baseURL = fakeAPI.URL
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	handleCombined(router, configuration, zap.NewNop(), "gitlab", service)
+	router.Handle(`/gitlab/{method}/{owner}/{repo}`, withSupportedMetrics(configuration, service, service))
+
+	return router, fakeAPI.Close
+}
+
+// fakeGiteaAPI serves the repository of a fake Gitea instance, failing requests for its issues
+func fakeGiteaAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v1/repos/forgejo/forgejo", "/api/v1/repos/forgejo/combined":
+		w.Write([]byte(`{"full_name":"forgejo/forgejo","forks_count":567,"stars_count":1234}`))
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func TestCombinedBadge(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"TwoMetrics", "/gitea/combined/forgejo/forgejo?metrics=stars,forks", &badge.Params{Segments: []badge.Segment{
+			{Text: "stars 1.23k", Color: "#f7b137", Label: "stars: 1.23k"},
+			{Text: "forks 567", Color: "#f7b137", Label: "forks: 567"},
+		}}},
+		{"Icons", "/gitea/combined/forgejo/forgejo?metrics=stars,forks&icons=regular/star&subject=forgejo", &badge.Params{Subject: "forgejo", Segments: []badge.Segment{
+			{Text: "1.23k", Color: "#f7b137", Icon: "regular/star", Label: "stars: 1.23k"},
+			{Text: "forks 567", Color: "#f7b137", Label: "forks: 567"},
+		}}},
+		{"PartialFailure", "/gitea/combined/forgejo/forgejo?metrics=stars,issues,forks", &badge.Params{Segments: []badge.Segment{
+			{Text: "stars 1.23k", Color: "#f7b137", Label: "stars: 1.23k"},
+			{Text: "issues err", Color: "lightgrey", Label: "issues: err"},
+			{Text: "forks 567", Color: "#f7b137", Label: "forks: 567"},
+		}}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			router, cleanup := newTestCombinedService(t, &config.Config{}, fakeGiteaAPI)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestCombinedBadgeWithInvalidMetrics(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"MissingMetrics", "/gitea/combined/forgejo/forgejo", `unsupported metric`},
+		{"UnsupportedMetric", "/gitea/combined/forgejo/forgejo?metrics=stars,watchers", `unsupported metric \"watchers\"`},
+		{"TooManyMetrics", "/gitea/combined/forgejo/forgejo?metrics=stars,forks,issues,pull-requests,stars", `more than 4 metrics`},
+		{"TooManyIcons", "/gitea/combined/forgejo/forgejo?metrics=stars&icons=regular/star,regular/star", `more icons than metrics`},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			router, cleanup := newTestCombinedService(t, &config.Config{}, fakeGiteaAPI)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusBadRequest, res.Code)
+			assert.Contains(t, res.Body.String(), testCase.expected)
+		})
+	}
+}
+
+func TestCombinedBadgeWithExtraRouteVariables(t *testing.T) {
+	t.Parallel()
+
+	configuration := &config.Config{GithubAccessToken: "token"}
+	service, err := NewGithubService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	handleCombined(router, configuration, zap.NewNop(), "github", service)
+
+	// metrics whose badge routes identify their data with an extra path segment can't be combined
+	for metric, variable := range combinedExtraRouteVariables["github"] {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/github/combined/google/gopacket?metrics=stars,"+metric, nil)
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusBadRequest, res.Code, metric)
+		assert.Contains(t, res.Body.String(), `metric \"`+metric+`\" requires the `+variable+` path segment`, metric)
+	}
+}
+
+func TestCombinedBadgeWithRepositoryNamedCombined(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestCombinedService(t, &config.Config{}, fakeGiteaAPI)
+	defer cleanup()
+
+	// the metrics of a repository named `combined` are still served by the badge routes of the metrics
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitea/stars/forgejo/combined", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "stars", Status: "1.23k"}), res.Body.String())
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/gitea/combined/forgejo/combined?metrics=stars", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.True(t, strings.Contains(res.Body.String(), `aria-label="stars: 1.23k"`), res.Body.String())
+}
+
+func TestCombinedBadgeWithGitlabProjectMetrics(t *testing.T) {
+	t.Parallel()
+
+	// metrics derived from the project object share a single upstream call
+	var calls int32
+	router, cleanup := newTestCombinedGitlabService(t, fakeGitlabProjectAPI(`{"star_count":42,"forks_count":7,"topics":["go","git"]}`, &calls))
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/combined/gitlab-org/gitaly?metrics=stars,forks,topics", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Segments: []badge.Segment{
+		{Text: "stars 42", Color: "#f7b137", Label: "stars: 42"},
+		{Text: "forks 7", Color: "#f7b137", Label: "forks: 7"},
+		{Text: "topics 2", Color: "#f7b137", Label: "topics: 2"},
+	}}), res.Body.String())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
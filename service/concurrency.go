@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// upstreamSaturatedCacheSeconds represents the duration in seconds for caching the error badges of requests whose
+// upstream API calls were skipped due to too many concurrent upstream API calls, which are bound to drop shortly
+const upstreamSaturatedCacheSeconds = 5
+
+// errUpstreamSaturated represents an upstream API call skipped as too many upstream API calls of the provider kept
+// running for the upstream queue timeout
+var errUpstreamSaturated = errors.New("too many concurrent upstream API calls")
+
+// isUpstreamSaturated returns whether the error is an upstream API call skipped due to too many concurrent upstream
+// API calls
+func isUpstreamSaturated(err error) bool {
+	return errors.Is(err, errUpstreamSaturated)
+}
+
+// requestDoneContextKey represents the context key of the channel closed once the badge request is cancelled (eg. by
+// the client disconnecting)
+type requestDoneContextKey struct{}
+
+// concurrencyLimiter bounds the number of concurrent upstream API calls of the provider, so that traffic spikes don't
+// trip the abuse detection of the upstream API
+type concurrencyLimiter struct {
+	provider string
+	permits  chan struct{}
+	timeout  time.Duration
+}
+
+func newConcurrencyLimiter(provider string, size uint, timeout time.Duration) *concurrencyLimiter {
+	upstreamPermitsInUse.WithLabelValues(provider).Set(0)
+	return &concurrencyLimiter{
+		provider: provider,
+		permits:  make(chan struct{}, size),
+		timeout:  timeout,
+	}
+}
+
+// acquire takes a permit for an upstream API call, waiting for one until the queue timeout, the deadline of the
+// upstream API call or the cancellation of the badge request
+func (limiter *concurrencyLimiter) acquire(ctx context.Context) error {
+	select {
+	case limiter.permits <- struct{}{}:
+		upstreamPermitsInUse.WithLabelValues(limiter.provider).Inc()
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(limiter.timeout)
+	defer timer.Stop()
+	// upstream API calls are shared among concurrent requests, so their context outlives the badge request
+	requestDone, _ := ctx.Value(requestDoneContextKey{}).(<-chan struct{})
+	select {
+	case limiter.permits <- struct{}{}:
+		upstreamPermitsInUse.WithLabelValues(limiter.provider).Inc()
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+	case <-requestDone:
+	}
+	return errUpstreamSaturated
+}
+
+// release returns the permit of a finished upstream API call
+func (limiter *concurrencyLimiter) release() {
+	<-limiter.permits
+	upstreamPermitsInUse.WithLabelValues(limiter.provider).Dec()
+}
+
+// permitBody returns the permit of the upstream API call once its response body is closed, as the connection is in
+// use until then
+type permitBody struct {
+	io.ReadCloser
+	once    sync.Once
+	limiter *concurrencyLimiter
+}
+
+func (body *permitBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(body.limiter.release)
+	return err
+}
+
+// concurrencyLimitTransport fails upstream API calls once too many concurrent upstream API calls of the provider
+// keep running for the upstream queue timeout
+type concurrencyLimitTransport struct {
+	base    http.RoundTripper
+	limiter *concurrencyLimiter
+}
+
+func (transport *concurrencyLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := transport.limiter.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := transport.base.RoundTrip(req)
+	if err != nil {
+		transport.limiter.release()
+		return nil, err
+	}
+	resp.Body = &permitBody{ReadCloser: resp.Body, limiter: transport.limiter}
+	return resp, nil
+}
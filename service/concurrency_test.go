@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// upstreamConcurrencyLimiter returns the concurrency limiter of the upstream API calls made through the transport
+func upstreamConcurrencyLimiter(t *testing.T, transport http.RoundTripper) *concurrencyLimiter {
+	switch transport := transport.(type) {
+	case *limitedBodyTransport:
+		return upstreamConcurrencyLimiter(t, transport.base)
+	case *concurrencyLimitTransport:
+		return transport.limiter
+	}
+	t.Fatalf("no concurrency limiter found in %T", transport)
+	return nil
+}
+
+// newTestConcurrencyLimitedGitlabService returns a router serving the Gitlab badge service backed by the fake GitLab
+// API, limited to the maximum of concurrent upstream API calls, along with its concurrency limiter
+func newTestConcurrencyLimitedGitlabService(t *testing.T, fakeAPIURL string, maxConcurrentUpstream uint, queueTimeout time.Duration) (*mux.Router, *concurrencyLimiter) {
+	service, err := NewGitlabService(&config.Config{
+		CacheSeconds:          3600,
+		MinCacheSeconds:       300,
+		MaxConcurrentUpstream: maxConcurrentUpstream,
+		UpstreamQueueTimeout:  queueTimeout,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*gitlabService).baseURL = fakeAPIURL
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/gitlab/{method}/{owner}/{repo}`, service)
+	return router, upstreamConcurrencyLimiter(t, service.(*gitlabService).httpClient.Transport)
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	t.Parallel()
+
+	limiter := newConcurrencyLimiter("mock", 1, time.Hour)
+	assert.NoError(t, limiter.acquire(context.Background()))
+
+	// waiting for a permit is given up once the upstream API call times out
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, errUpstreamSaturated, limiter.acquire(ctx))
+
+	// waiting for a permit is given up once the badge request is cancelled, although its upstream API calls aren't
+	requestCtx, cancelRequest := context.WithCancel(context.Background())
+	cancelRequest()
+	req := httptest.NewRequest("GET", "/mock/stars/google/gopacket", nil).WithContext(requestCtx)
+	assert.Equal(t, errUpstreamSaturated, limiter.acquire(upstreamContext(req)))
+
+	limiter.release()
+	assert.NoError(t, limiter.acquire(upstreamContext(httptest.NewRequest("GET", "/mock/stars/google/gopacket", nil))))
+}
+
+func TestConcurrencyLimitTransport(t *testing.T) {
+	t.Parallel()
+
+	const maxConcurrentUpstream = 3
+	var inFlight, maxInFlight int32
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"star_count":42}`))
+	}))
+	defer fakeAPI.Close()
+	router, _ := newTestConcurrencyLimitedGitlabService(t, fakeAPI.URL, maxConcurrentUpstream, 10*time.Second)
+
+	// requests for different repositories don't share their upstream API calls
+	var wg sync.WaitGroup
+	codes := make([]int, 4*maxConcurrentUpstream)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitlab/stars/google/gopacket-"+strconv.Itoa(i), nil)
+			router.ServeHTTP(res, req)
+			codes[i] = res.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+	assert.Equal(t, int32(maxConcurrentUpstream), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestConcurrencyLimitTransportWhenSaturated(t *testing.T) {
+	t.Parallel()
+
+	unblock := make(chan struct{})
+	var blocked int32
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&blocked) == 1 {
+			<-unblock
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"star_count":42}`))
+	}))
+	defer fakeAPI.Close()
+	router, limiter := newTestConcurrencyLimitedGitlabService(t, fakeAPI.URL, 1, 10*time.Millisecond)
+	request := func(path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	assert.Equal(t, http.StatusOK, request("/gitlab/stars/google/gopacket").Code)
+
+	// the only permit is held by a slow upstream API call
+	atomic.StoreInt32(&blocked, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		request("/gitlab/stars/google/blocked")
+	}()
+	for len(limiter.permits) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// badges fetched before are served from stale data
+	res := request("/gitlab/stars/google/gopacket")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "true", res.Header().Get(staleHeader))
+
+	// other badges are answered with a briefly cached error badge
+	res = request("/gitlab/stars/google/other")
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "public, max-age=5, s-maxage=5", res.Header().Get("Cache-Control"))
+	assert.Equal(t, "5", res.Header().Get("Retry-After"))
+
+	close(unblock)
+	<-done
+	assert.Empty(t, limiter.permits)
+}
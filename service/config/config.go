@@ -3,58 +3,338 @@ package config
 import (
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
+	configFileCfg                 = "config"
 	portCfg                       = "port"
+	listenAddrCfg                 = "listen-addr"
+	tlsCertFileCfg                = "tls-cert-file"
+	tlsKeyFileCfg                 = "tls-key-file"
 	readTimeoutCfg                = "read-timeout"
 	writeTimeoutCfg               = "write-timeout"
+	upstreamTimeoutCfg            = "upstream-timeout"
+	upstreamRetriesCfg            = "upstream-retries"
+	upstreamRetryDelayCfg         = "upstream-retry-delay"
+	circuitBreakerThresholdCfg    = "circuit-breaker-threshold"
+	circuitBreakerCooldownCfg     = "circuit-breaker-cooldown"
+	maxConcurrentUpstreamCfg      = "max-concurrent-upstream"
+	upstreamQueueTimeoutCfg       = "upstream-queue-timeout"
 	excludeCacheControlHeadersCfg = "exclude-cache-control-headers"
+	cacheSecondsCfg               = "cache-seconds"
+	minCacheSecondsCfg            = "min-cache-seconds"
+	maxCacheSecondsCfg            = "max-cache-seconds"
+	redisURLCfg                   = "redis-url"
+	redisCacheSecondsCfg          = "redis-cache-seconds"
+	maxLogoSizeCfg                = "max-logo-size"
+	readinessCheckUpstreamsCfg    = "readiness-check-upstreams"
+	trustProxyCfg                 = "trust-proxy"
 	rootRedirectURLCfg            = "root-redirect-url"
+	externalURLCfg                = "external-url"
+	redirectsCfg                  = "redirects"
+	apiDeprecationsCfg            = "api-deprecations"
+	corsAllowedOriginsCfg         = "cors-allowed-origins"
+	disableCORSCfg                = "disable-cors"
 	githubAccessTokenCfg          = "github-access-token"
+	githubAccessTokensCfg         = "github-access-tokens"
+	githubAllowUnauthenticatedCfg = "github-allow-unauthenticated"
+	githubQuotaReserveCfg         = "github-quota-reserve"
+	gitlabAccessTokenCfg          = "gitlab-access-token"
+	bitbucketUsernameCfg          = "bitbucket-username"
+	bitbucketAppPasswordCfg       = "bitbucket-app-password"
+	giteaBaseURLCfg               = "gitea-base-url"
+	giteaAccessTokenCfg           = "gitea-access-token"
+	sourcehutAccessTokenCfg       = "sourcehut-access-token"
+	azureDevopsTokenCfg           = "azure-devops-token"
+	allowQueryTokensCfg           = "allow-query-tokens"
+	webhookSecretCfg              = "webhook-secret"
+	enableHealthBadgeCfg          = "enable-health-badge"
+	healthWeightsCfg              = "health-weights"
+	historyFileCfg                = "history-file"
+	historyIntervalCfg            = "history-interval"
+	historyRetentionCfg           = "history-retention"
+	historyTargetsCfg             = "history-targets"
+	logLevelCfg                   = "log-level"
+	logFormatCfg                  = "log-format"
+	enableDebugEndpointsCfg       = "enable-debug-endpoints"
+	debugTokenCfg                 = "debug-token"
 )
 
+// logLevels represents the supported output levels of logs
+var logLevels = []string{"DEBUG", "INFO", "WARN", "ERROR", "DPANIC", "PANIC", "FATAL"}
+
+// logFormats represents the supported output formats of logs
+var logFormats = []string{"json", "text"}
+
 var (
+	flagSet                    *flag.FlagSet
+	configFile                 *string
 	port                       *uint
+	listenAddr                 *string
+	tlsCertFile                *string
+	tlsKeyFile                 *string
 	readTimeout                *uint
 	writeTimeout               *uint
+	upstreamTimeout            *uint
+	upstreamRetries            *uint
+	upstreamRetryDelay         *uint
+	circuitBreakerThreshold    *uint
+	circuitBreakerCooldown     *uint
+	maxConcurrentUpstream      *uint
+	upstreamQueueTimeout       *uint
 	excludeCacheControlHeaders *bool
+	cacheSeconds               *uint
+	minCacheSeconds            *uint
+	maxCacheSeconds            *uint
+	redisURL                   *string
+	redisCacheSeconds          *uint
+	maxLogoSize                *uint
+	readinessCheckUpstreams    *bool
+	trustProxy                 *bool
 	rootRedirectURL            *string
+	externalURL                *string
+	redirects                  *string
+	apiDeprecations            *string
+	corsAllowedOrigins         *string
+	disableCORS                *bool
 	githubAccessToken          *string
+	githubAccessTokens         *string
+	githubAllowUnauthenticated *bool
+	githubQuotaReserve         *uint
+	gitlabAccessToken          *string
+	bitbucketUsername          *string
+	bitbucketAppPassword       *string
+	giteaBaseURL               *string
+	giteaAccessToken           *string
+	sourcehutAccessToken       *string
+	azureDevopsToken           *string
+	allowQueryTokens           *bool
+	webhookSecret              *string
+	enableHealthBadge          *bool
+	healthWeights              *string
+	historyFile                *string
+	historyInterval            *uint
+	historyRetention           *uint
+	historyTargets             *string
+	logLevel                   *string
+	logFormat                  *string
+	enableDebugEndpoints       *bool
+	debugToken                 *string
 )
 
 // Config contains all application configuration
 type Config struct {
 	Port                       uint
+	ListenAddr                 string
+	TLSCertFile                string
+	TLSKeyFile                 string
 	ReadTimeout                time.Duration
 	WriteTimeout               time.Duration
+	UpstreamTimeout            time.Duration
+	UpstreamRetries            uint
+	UpstreamRetryDelay         time.Duration
+	CircuitBreakerThreshold    uint
+	CircuitBreakerCooldown     time.Duration
+	MaxConcurrentUpstream      uint
+	UpstreamQueueTimeout       time.Duration
 	ExcludeCacheControlHeaders bool
+	CacheSeconds               uint
+	MinCacheSeconds            uint
+	MaxCacheSeconds            uint
+	RedisURL                   string
+	RedisCacheSeconds          uint
+	MaxLogoSize                uint
+	ReadinessCheckUpstreams    bool
+	TrustProxy                 bool
 	RootRedirectURL            string
+	ExternalURL                string
+	Redirects                  map[string]string
+	APIDeprecations            map[string]time.Time
+	CORSAllowedOrigins         []string
 	GithubAccessToken          string
+	GithubAccessTokens         []string
+	GithubAllowUnauthenticated bool
+	GithubQuotaReserve         uint
+	GitlabAccessToken          string
+	BitbucketUsername          string
+	BitbucketAppPassword       string
+	GiteaBaseURL               string
+	GiteaAccessToken           string
+	SourcehutAccessToken       string
+	AzureDevopsToken           string
+	AllowQueryTokens           bool
+	WebhookSecret              string
+	EnableHealthBadge          bool
+	HealthWeights              map[string]uint
+	HistoryFile                string
+	HistoryInterval            time.Duration
+	HistoryRetention           time.Duration
+	HistoryTargets             []string
+	LogLevel                   string
+	LogFormat                  string
+	EnableDebugEndpoints       bool
+	DebugToken                 string
+
+	// Options without flags, set by applications embedding the badge services: the providers whose badge services are
+	// served (every provider if empty), the base transport of upstream API calls (http.DefaultTransport if nil) & the
+	// base URLs of the GitHub & GitLab REST APIs (the public APIs if empty)
+	Providers         []string
+	UpstreamTransport http.RoundTripper
+	GithubAPIBaseURL  string
+	GitlabAPIBaseURL  string
+}
+
+// uintFromEnv returns the unsigned integer set in the environment variable, or the fallback value if unset or invalid
+func uintFromEnv(key string, fallback uint) uint {
+	value, err := strconv.ParseUint(os.Getenv(key), 10, 0)
+	if err != nil {
+		return fallback
+	}
+	return uint(value)
+}
+
+// boolFromEnv returns the boolean set in the environment variable, or the fallback value if unset or invalid
+func boolFromEnv(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// envOrDefault returns the value set in the environment variable, or the fallback value if unset
+func envOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// isPort reports whether the string is a valid TCP port number
+func isPort(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
+
+// containsFold reports whether the values contain the string, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
 }
 
 // Flags adds flags related to the application to the given flagset.
 func Flags(flags *flag.FlagSet) {
+	flagSet = flags
+	configFile = flags.String(configFileCfg, os.Getenv("CONFIG_FILE"), "Path of the YAML configuration file, whose options are overridden by command line flags & environment variables.")
+
 	// server configs
 	port = flags.Uint(portCfg, 8080, "Port exposing badge service.")
+	listenAddr = flags.String(listenAddrCfg, os.Getenv("LISTEN_ADDR"), "Address exposing badge service (eg. \"127.0.0.1\" or \"127.0.0.1:8443\"), listens on the port on every interface if unset.")
+	tlsCertFile = flags.String(tlsCertFileCfg, os.Getenv("TLS_CERT_FILE"), "Path of the PEM encoded TLS certificate (chain) to serve HTTPS & HTTP/2 with, HTTP is served if unset.")
+	tlsKeyFile = flags.String(tlsKeyFileCfg, os.Getenv("TLS_KEY_FILE"), "Path of the PEM encoded private key of the TLS certificate.")
 	readTimeout = flags.Uint(readTimeoutCfg, 2000, "Maximum duration in milliseconds for reading the entire request, including the body.")
 	writeTimeout = flags.Uint(writeTimeoutCfg, 2000, "Maximum duration in milliseconds before timing out writes of the response.")
+	upstreamTimeout = flags.Uint(upstreamTimeoutCfg, 1500, "Maximum duration in milliseconds for upstream API calls, including reading the response body.")
+	upstreamRetries = flags.Uint(upstreamRetriesCfg, uintFromEnv("UPSTREAM_RETRIES", 2), "Maximum number of retries of upstream API calls failing with network errors, 429 or 5xx responses.")
+	upstreamRetryDelay = flags.Uint(upstreamRetryDelayCfg, uintFromEnv("UPSTREAM_RETRY_DELAY", 100), "Base delay in milliseconds between retries of upstream API calls, doubled on every retry.")
+	circuitBreakerThreshold = flags.Uint(circuitBreakerThresholdCfg, uintFromEnv("CIRCUIT_BREAKER_THRESHOLD", 5), "Number of consecutive failed upstream API calls opening the circuit breaker of the provider, disabled if 0.")
+	circuitBreakerCooldown = flags.Uint(circuitBreakerCooldownCfg, uintFromEnv("CIRCUIT_BREAKER_COOLDOWN", 30), "Duration in seconds before an open circuit breaker lets an upstream API call through to probe for recovery.")
+	maxConcurrentUpstream = flags.Uint(maxConcurrentUpstreamCfg, uintFromEnv("MAX_CONCURRENT_UPSTREAM", 32), "Maximum number of concurrent upstream API calls of each provider, unlimited if 0.")
+	upstreamQueueTimeout = flags.Uint(upstreamQueueTimeoutCfg, uintFromEnv("UPSTREAM_QUEUE_TIMEOUT", 250), "Maximum duration in milliseconds for waiting on the concurrent upstream API calls of the provider to drop below the maximum, before serving stale data or a 503 error badge.")
 	excludeCacheControlHeaders = flags.Bool(excludeCacheControlHeadersCfg, false, "Flag to exclude HTTP Cache-Control headers from responses.")
+	cacheSeconds = flags.Uint(cacheSecondsCfg, uintFromEnv("CACHE_SECONDS", 3600), "Default duration in seconds for caching responses, overridable with the `cacheSeconds` query parameter.")
+	minCacheSeconds = flags.Uint(minCacheSecondsCfg, uintFromEnv("MIN_CACHE_SECONDS", 300), "Minimum duration in seconds accepted by the `cacheSeconds` query parameter.")
+	maxCacheSeconds = flags.Uint(maxCacheSecondsCfg, uintFromEnv("MAX_CACHE_SECONDS", 86400), "Maximum duration in seconds accepted by the `cacheSeconds` query parameter.")
+	redisURL = flags.String(redisURLCfg, os.Getenv("REDIS_URL"), "URL of the Redis server sharing the data fetched for badges among instances (eg. \"redis://:password@localhost:6379/0\"), unshared if unset.")
+	redisCacheSeconds = flags.Uint(redisCacheSecondsCfg, uintFromEnv("REDIS_CACHE_SECONDS", 300), "Duration in seconds for sharing the data fetched for badges in Redis.")
+	maxLogoSize = flags.Uint(maxLogoSizeCfg, uintFromEnv("MAX_LOGO_SIZE", 8192), "Maximum size in bytes of the data URI accepted by the `logo` query parameter.")
+	readinessCheckUpstreams = flags.Bool(readinessCheckUpstreamsCfg, false, "Flag to verify that upstream APIs are reachable in readiness probes.")
+	trustProxy = flags.Bool(trustProxyCfg, false, "Flag to trust the X-Forwarded-For header for client IP addresses, only set when running behind a trusted proxy.")
 	rootRedirectURL = flags.String(rootRedirectURLCfg, os.Getenv("ROOT_REDIRECT_URL"), "URL to redirect for all root path requests.")
+	externalURL = flags.String(externalURLCfg, os.Getenv("EXTERNAL_URL"), "Base URL of the badge service used in generated badge snippets, defaults to the host of the request.")
+	redirects = flags.String(redirectsCfg, os.Getenv("REDIRECTS"), "Comma-separated list of path prefixes to permanently redirect for unmatched routes, formatted as `<FROM>=<TO>` (eg. \"/badge/github=/github\").")
+	apiDeprecations = flags.String(apiDeprecationsCfg, os.Getenv("API_DEPRECATIONS"), "Comma-separated list of JSON API path prefixes to mark deprecated with Deprecation & Sunset headers, formatted as `<PATH_PREFIX>=<SUNSET_DATE>` (eg. \"/api/history=2021-06-30\").")
+	corsAllowedOrigins = flags.String(corsAllowedOriginsCfg, envOrDefault("CORS_ALLOWED_ORIGINS", "*"), "Comma-separated list of origins allowed to read responses from browsers (eg. \"https://dashboard.example.com\"), or \"*\" for any origin.")
+	disableCORS = flags.Bool(disableCORSCfg, boolFromEnv("DISABLE_CORS", false), "Flag to omit CORS headers from responses & reject CORS preflight requests.")
 
 	// service configs
 	githubAccessToken = flags.String(githubAccessTokenCfg, os.Getenv("GITHUB_ACCESS_TOKEN"), "GitHub Access Token for GitHub badge service.")
+	githubAccessTokens = flags.String(githubAccessTokensCfg, os.Getenv("GITHUB_TOKENS"), "Comma-separated list of additional GitHub Access Tokens for GitHub badge service, rotated in a round-robin fashion to spread rate limits.")
+	githubAllowUnauthenticated = flags.Bool(githubAllowUnauthenticatedCfg, false, "Flag to make unauthenticated GitHub API calls when no GitHub Access Token is set, or every GitHub Access Token is rate limited.")
+	githubQuotaReserve = flags.Uint(githubQuotaReserveCfg, uintFromEnv("GITHUB_QUOTA_RESERVE", 0), "Number of GitHub API calls of each GitHub Access Token kept in reserve by the rate limit quota shared in Redis among instances, before serving stale data. The shared quota is disabled if 0.")
+	gitlabAccessToken = flags.String(gitlabAccessTokenCfg, os.Getenv("GITLAB_TOKEN"), "GitLab Access Token for GitLab badge service, required for badges of private projects.")
+	bitbucketUsername = flags.String(bitbucketUsernameCfg, os.Getenv("BITBUCKET_USERNAME"), "Bitbucket username for Bitbucket badge service, authenticating with the Bitbucket app password.")
+	bitbucketAppPassword = flags.String(bitbucketAppPasswordCfg, os.Getenv("BITBUCKET_APP_PASSWORD"), "Bitbucket app password for Bitbucket badge service, Bitbucket API calls are anonymous if unset.")
+	giteaBaseURL = flags.String(giteaBaseURLCfg, envOrDefault("GITEA_BASE_URL", "https://codeberg.org"), "Base URL of the Gitea instance for Gitea badge service.")
+	giteaAccessToken = flags.String(giteaAccessTokenCfg, os.Getenv("GITEA_TOKEN"), "Gitea Access Token for Gitea badge service, required for badges of private repositories.")
+	sourcehutAccessToken = flags.String(sourcehutAccessTokenCfg, os.Getenv("SRHT_TOKEN"), "SourceHut personal access token for SourceHut badge service, required by the SourceHut GraphQL APIs.")
+	azureDevopsToken = flags.String(azureDevopsTokenCfg, os.Getenv("AZURE_DEVOPS_TOKEN"), "Azure DevOps personal access token for Azure DevOps badge service, required for badges of private projects.")
+	allowQueryTokens = flags.Bool(allowQueryTokensCfg, boolFromEnv("ALLOW_QUERY_TOKENS", false), "Flag to accept upstream API tokens set with the `token` query parameter, responses are never cached.")
+	webhookSecret = flags.String(webhookSecretCfg, os.Getenv("WEBHOOK_SECRET"), "Secret of the GitHub & GitLab webhooks purging the cached data of repositories (`POST /webhook/{provider}`), disabled if unset.")
+	enableHealthBadge = flags.Bool(enableHealthBadgeCfg, false, "Flag to enable the GitHub repository health badge.")
+	healthWeights = flags.String(healthWeightsCfg, envOrDefault("HEALTH_WEIGHTS", "commit=30,issues=20,license=15,ci=15,release=20"), "Comma-separated list of weights of each signal of the GitHub repository health score, formatted as `<SIGNAL>=<WEIGHT>` (signals: commit, issues, license, ci, release).")
+
+	// history configs
+	historyFile = flags.String(historyFileCfg, os.Getenv("HISTORY_FILE"), "Path of the JSONL file storing daily metric snapshots, snapshots are not recorded if empty.")
+	historyInterval = flags.Uint(historyIntervalCfg, 1440, "Duration in minutes between recording metric snapshots.")
+	historyRetention = flags.Uint(historyRetentionCfg, 365, "Number of days to retain metric snapshots for.")
+	historyTargets = flags.String(historyTargetsCfg, os.Getenv("HISTORY_TARGETS"), "Comma-separated list of metrics to record snapshots for (eg. \"github/google/gopacket/stars,gitlab/gitlab-org/gitaly/forks\").")
+
+	// log configs
+	logLevel = flags.String(logLevelCfg, envOrDefault("LOG_LEVEL", "INFO"), "Output level of logs (DEBUG, INFO, WARN, ERROR, DPANIC, PANIC, FATAL).")
+	logFormat = flags.String(logFormatCfg, envOrDefault("LOG_FORMAT", "json"), "Output format of logs (json, text).")
+
+	// debug configs
+	enableDebugEndpoints = flags.Bool(enableDebugEndpointsCfg, boolFromEnv("ENABLE_DEBUG_ENDPOINTS", false), "Flag to expose the pprof (`/debug/pprof/`) & expvar (`/debug/vars`) endpoints, never enable it on public deployments without a debug token.")
+	debugToken = flags.String(debugTokenCfg, os.Getenv("DEBUG_TOKEN"), "Bearer token required by the debug endpoints, set with the `Authorization: Bearer <TOKEN>` header.")
 }
 
-// New returns an instance of all application configuration
-func New() (*Config, error) {
-	if port == nil || readTimeout == nil || writeTimeout == nil ||
-		excludeCacheControlHeaders == nil || githubAccessToken == nil {
+// New returns an instance of all application configuration, setting flags that aren't changed on the
+// command line (as reported by `changed`) nor by environment variables from the configuration file
+func New(changed func(name string) bool) (*Config, error) {
+	if flagSet == nil || configFile == nil {
 		return nil, fmt.Errorf("configuration flags are not set")
 	}
+	if *configFile != "" {
+		if err := loadFile(*configFile, flagSet, changed); err != nil {
+			return nil, err
+		}
+	}
+
+	if port == nil || listenAddr == nil || tlsCertFile == nil || tlsKeyFile == nil || readTimeout == nil || writeTimeout == nil || upstreamTimeout == nil || upstreamRetries == nil || upstreamRetryDelay == nil ||
+		circuitBreakerThreshold == nil || circuitBreakerCooldown == nil || maxConcurrentUpstream == nil || upstreamQueueTimeout == nil ||
+		excludeCacheControlHeaders == nil || cacheSeconds == nil || minCacheSeconds == nil || maxCacheSeconds == nil || redisURL == nil || redisCacheSeconds == nil || maxLogoSize == nil ||
+		readinessCheckUpstreams == nil || trustProxy == nil || externalURL == nil || redirects == nil || apiDeprecations == nil || corsAllowedOrigins == nil || disableCORS == nil || githubAccessToken == nil || githubAccessTokens == nil || githubAllowUnauthenticated == nil || githubQuotaReserve == nil || gitlabAccessToken == nil || bitbucketUsername == nil || bitbucketAppPassword == nil || giteaBaseURL == nil || giteaAccessToken == nil || sourcehutAccessToken == nil || azureDevopsToken == nil || allowQueryTokens == nil || webhookSecret == nil || enableHealthBadge == nil || healthWeights == nil ||
+		historyFile == nil || historyInterval == nil || historyRetention == nil || historyTargets == nil ||
+		logLevel == nil || logFormat == nil || enableDebugEndpoints == nil || debugToken == nil {
+		return nil, fmt.Errorf("configuration flags are not set")
+	}
+
+	addr := net.JoinHostPort("", strconv.FormatUint(uint64(*port), 10))
+	if *listenAddr != "" {
+		addr = *listenAddr
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, strconv.FormatUint(uint64(*port), 10))
+		}
+		if _, addrPort, _ := net.SplitHostPort(addr); !isPort(addrPort) {
+			return nil, fmt.Errorf("Config.ListenAddr address is invalid: %s", *listenAddr)
+		}
+	}
+
+	if (*tlsCertFile == "") != (*tlsKeyFile == "") {
+		return nil, fmt.Errorf("Config.TLSCertFile & Config.TLSKeyFile must be set together")
+	}
 
 	if *rootRedirectURL != "" {
 		if _, err := url.ParseRequestURI(*rootRedirectURL); err != nil {
@@ -62,12 +342,189 @@ func New() (*Config, error) {
 		}
 	}
 
+	if *redisURL != "" {
+		// the URL isn't reported as it may hold the Redis password
+		if u, err := url.Parse(*redisURL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss" && u.Scheme != "unix") {
+			return nil, fmt.Errorf("Config.RedisURL URL is invalid, must be a redis://, rediss:// or unix:// URL")
+		}
+		if *redisCacheSeconds == 0 {
+			return nil, fmt.Errorf("Config.RedisCacheSeconds must be greater than 0")
+		}
+	} else if *githubQuotaReserve > 0 {
+		return nil, fmt.Errorf("Config.GithubQuotaReserve must be set along with Config.RedisURL")
+	}
+
+	if *externalURL != "" {
+		if _, err := url.ParseRequestURI(*externalURL); err != nil {
+			return nil, fmt.Errorf("Config.ExternalURL URL is invalid: %s", *externalURL)
+		}
+	}
+
+	pathRedirects := map[string]string{}
+	if *redirects != "" {
+		for _, redirect := range strings.Split(*redirects, ",") {
+			paths := strings.Split(strings.TrimSpace(redirect), "=")
+			if len(paths) != 2 || !strings.HasPrefix(paths[0], "/") || len(paths[0]) < 2 || !strings.HasPrefix(paths[1], "/") {
+				return nil, fmt.Errorf("Config.Redirects redirect is invalid: %s", redirect)
+			}
+			pathRedirects[paths[0]] = paths[1]
+		}
+	}
+
+	deprecations := map[string]time.Time{}
+	if *apiDeprecations != "" {
+		for _, deprecation := range strings.Split(*apiDeprecations, ",") {
+			parts := strings.Split(strings.TrimSpace(deprecation), "=")
+			if len(parts) != 2 || !strings.HasPrefix(parts[0], "/") || len(parts[0]) < 2 {
+				return nil, fmt.Errorf("Config.APIDeprecations deprecation is invalid: %s", deprecation)
+			}
+			sunset, err := time.Parse("2006-01-02", parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("Config.APIDeprecations sunset date is invalid: %s", parts[1])
+			}
+			deprecations[parts[0]] = sunset
+		}
+	}
+
+	var origins []string
+	if !*disableCORS {
+		for _, origin := range strings.Split(*corsAllowedOrigins, ",") {
+			if origin = strings.TrimSpace(origin); origin == "" {
+				continue
+			}
+			if origin != "*" {
+				originURL, err := url.ParseRequestURI(origin)
+				if err != nil || originURL.Host == "" || strings.TrimSuffix(originURL.Path, "/") != "" || originURL.RawQuery != "" {
+					return nil, fmt.Errorf("Config.CORSAllowedOrigins origin is invalid: %s", origin)
+				}
+				origin = originURL.Scheme + "://" + originURL.Host
+			}
+			origins = append(origins, origin)
+		}
+	}
+
+	if (*bitbucketUsername == "") != (*bitbucketAppPassword == "") {
+		return nil, fmt.Errorf("Config.BitbucketUsername & Config.BitbucketAppPassword must be set together")
+	}
+
+	if _, err := url.ParseRequestURI(*giteaBaseURL); err != nil {
+		return nil, fmt.Errorf("Config.GiteaBaseURL URL is invalid: %s", *giteaBaseURL)
+	}
+
+	if *upstreamTimeout == 0 {
+		return nil, fmt.Errorf("Config.UpstreamTimeout must be greater than 0")
+	}
+
+	if *minCacheSeconds > *maxCacheSeconds {
+		return nil, fmt.Errorf("Config.MinCacheSeconds must not be greater than Config.MaxCacheSeconds")
+	}
+	if *cacheSeconds < *minCacheSeconds || *cacheSeconds > *maxCacheSeconds {
+		return nil, fmt.Errorf("Config.CacheSeconds must be between Config.MinCacheSeconds & Config.MaxCacheSeconds: %d", *cacheSeconds)
+	}
+
+	weights := map[string]uint{}
+	totalWeight := uint(0)
+	for _, weight := range strings.Split(*healthWeights, ",") {
+		parts := strings.Split(strings.TrimSpace(weight), "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Config.HealthWeights weight is invalid: %s", weight)
+		}
+		switch parts[0] {
+		case "commit", "issues", "license", "ci", "release":
+		default:
+			return nil, fmt.Errorf("Config.HealthWeights signal is invalid: %s", parts[0])
+		}
+		value, err := strconv.ParseUint(parts[1], 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("Config.HealthWeights weight is invalid: %s", weight)
+		}
+		weights[parts[0]] = uint(value)
+		totalWeight += uint(value)
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("Config.HealthWeights must have a weight greater than 0")
+	}
+
+	var tokens []string
+	if *githubAccessTokens != "" {
+		for _, token := range strings.Split(*githubAccessTokens, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	var targets []string
+	if *historyTargets != "" {
+		for _, target := range strings.Split(*historyTargets, ",") {
+			target = strings.TrimSpace(target)
+			if len(strings.Split(target, "/")) != 4 {
+				return nil, fmt.Errorf("Config.HistoryTargets target is invalid: %s", target)
+			}
+			targets = append(targets, target)
+		}
+	}
+	if *historyInterval == 0 {
+		return nil, fmt.Errorf("Config.HistoryInterval must be greater than 0")
+	}
+
+	if !containsFold(logLevels, *logLevel) {
+		return nil, fmt.Errorf("Config.LogLevel level is invalid: %s", *logLevel)
+	}
+	if !containsFold(logFormats, *logFormat) {
+		return nil, fmt.Errorf("Config.LogFormat format is invalid: %s", *logFormat)
+	}
+
 	return &Config{
 		Port:                       *port,
+		ListenAddr:                 addr,
+		TLSCertFile:                *tlsCertFile,
+		TLSKeyFile:                 *tlsKeyFile,
 		ReadTimeout:                time.Duration(*readTimeout) * time.Millisecond,
 		WriteTimeout:               time.Duration(*writeTimeout) * time.Millisecond,
+		UpstreamTimeout:            time.Duration(*upstreamTimeout) * time.Millisecond,
+		UpstreamRetries:            *upstreamRetries,
+		UpstreamRetryDelay:         time.Duration(*upstreamRetryDelay) * time.Millisecond,
+		CircuitBreakerThreshold:    *circuitBreakerThreshold,
+		CircuitBreakerCooldown:     time.Duration(*circuitBreakerCooldown) * time.Second,
+		MaxConcurrentUpstream:      *maxConcurrentUpstream,
+		UpstreamQueueTimeout:       time.Duration(*upstreamQueueTimeout) * time.Millisecond,
 		ExcludeCacheControlHeaders: *excludeCacheControlHeaders,
+		CacheSeconds:               *cacheSeconds,
+		MinCacheSeconds:            *minCacheSeconds,
+		MaxCacheSeconds:            *maxCacheSeconds,
+		RedisURL:                   *redisURL,
+		RedisCacheSeconds:          *redisCacheSeconds,
+		MaxLogoSize:                *maxLogoSize,
+		ReadinessCheckUpstreams:    *readinessCheckUpstreams,
+		TrustProxy:                 *trustProxy,
 		RootRedirectURL:            *rootRedirectURL,
+		ExternalURL:                *externalURL,
+		Redirects:                  pathRedirects,
+		APIDeprecations:            deprecations,
+		CORSAllowedOrigins:         origins,
 		GithubAccessToken:          *githubAccessToken,
+		GithubAccessTokens:         tokens,
+		GithubAllowUnauthenticated: *githubAllowUnauthenticated,
+		GithubQuotaReserve:         *githubQuotaReserve,
+		GitlabAccessToken:          *gitlabAccessToken,
+		BitbucketUsername:          *bitbucketUsername,
+		BitbucketAppPassword:       *bitbucketAppPassword,
+		GiteaBaseURL:               strings.TrimSuffix(*giteaBaseURL, "/"),
+		GiteaAccessToken:           *giteaAccessToken,
+		SourcehutAccessToken:       *sourcehutAccessToken,
+		AzureDevopsToken:           *azureDevopsToken,
+		AllowQueryTokens:           *allowQueryTokens,
+		WebhookSecret:              *webhookSecret,
+		EnableHealthBadge:          *enableHealthBadge,
+		HealthWeights:              weights,
+		HistoryFile:                *historyFile,
+		HistoryInterval:            time.Duration(*historyInterval) * time.Minute,
+		HistoryRetention:           time.Duration(*historyRetention) * 24 * time.Hour,
+		HistoryTargets:             targets,
+		LogLevel:                   strings.ToUpper(*logLevel),
+		LogFormat:                  strings.ToLower(*logFormat),
+		EnableDebugEndpoints:       *enableDebugEndpoints,
+		DebugToken:                 *debugToken,
 	}, nil
 }
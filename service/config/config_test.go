@@ -0,0 +1,173 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestConfig registers the configuration flags on a new flagset, parses the command line arguments & returns the
+// resulting configuration. Flags are package-level state, so tests calling it can't run in parallel.
+func newTestConfig(t *testing.T, args ...string) (*Config, error) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	Flags(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return New(nil)
+}
+
+func TestNewWithDefaults(t *testing.T) {
+	configuration, err := newTestConfig(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, uint(8080), configuration.Port)
+	assert.Equal(t, ":8080", configuration.ListenAddr)
+	assert.Equal(t, 2*time.Second, configuration.ReadTimeout)
+	assert.Equal(t, 2*time.Second, configuration.WriteTimeout)
+	assert.Equal(t, 1500*time.Millisecond, configuration.UpstreamTimeout)
+	assert.Equal(t, uint(3600), configuration.CacheSeconds)
+	assert.Equal(t, uint(300), configuration.MinCacheSeconds)
+	assert.Equal(t, uint(86400), configuration.MaxCacheSeconds)
+	assert.Equal(t, uint(32), configuration.MaxConcurrentUpstream)
+	assert.Equal(t, 250*time.Millisecond, configuration.UpstreamQueueTimeout)
+	assert.Equal(t, "", configuration.RedisURL)
+	assert.Equal(t, uint(300), configuration.RedisCacheSeconds)
+	assert.Equal(t, uint(0), configuration.GithubQuotaReserve)
+	assert.Equal(t, 24*time.Hour, configuration.HistoryInterval)
+	assert.Equal(t, "https://codeberg.org", configuration.GiteaBaseURL)
+	assert.Equal(t, map[string]uint{"commit": 30, "issues": 20, "license": 15, "ci": 15, "release": 20}, configuration.HealthWeights)
+	assert.Equal(t, []string{"*"}, configuration.CORSAllowedOrigins)
+	assert.Equal(t, "INFO", configuration.LogLevel)
+	assert.Equal(t, "json", configuration.LogFormat)
+}
+
+func TestNewWithFlags(t *testing.T) {
+	configuration, err := newTestConfig(t,
+		"--port=9090",
+		"--listen-addr=127.0.0.1",
+		"--upstream-timeout=500",
+		"--circuit-breaker-cooldown=10",
+		"--history-interval=60",
+		"--history-retention=30",
+		"--github-access-tokens=a, b,,c",
+		"--redirects=/badge/github=/github",
+		"--api-deprecations=/api/history=2021-06-30",
+		"--cors-allowed-origins=https://a.example.com/,https://b.example.com:8443",
+		"--gitea-base-url=https://gitea.example.com/",
+		"--log-level=debug",
+		"--log-format=TEXT",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "127.0.0.1:9090", configuration.ListenAddr)
+	assert.Equal(t, 500*time.Millisecond, configuration.UpstreamTimeout)
+	assert.Equal(t, 10*time.Second, configuration.CircuitBreakerCooldown)
+	assert.Equal(t, time.Hour, configuration.HistoryInterval)
+	assert.Equal(t, 30*24*time.Hour, configuration.HistoryRetention)
+	assert.Equal(t, []string{"a", "b", "c"}, configuration.GithubAccessTokens)
+	assert.Equal(t, map[string]string{"/badge/github": "/github"}, configuration.Redirects)
+	assert.Equal(t, map[string]time.Time{"/api/history": time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC)}, configuration.APIDeprecations)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com:8443"}, configuration.CORSAllowedOrigins)
+	assert.Equal(t, "https://gitea.example.com", configuration.GiteaBaseURL)
+	assert.Equal(t, "DEBUG", configuration.LogLevel)
+	assert.Equal(t, "text", configuration.LogFormat)
+}
+
+func TestNewWithEnvironmentVariables(t *testing.T) {
+	for key, value := range map[string]string{"LISTEN_ADDR": "[::1]:8443", "CACHE_SECONDS": "600", "DISABLE_CORS": "true", "LOG_FORMAT": "text", "ENABLE_DEBUG_ENDPOINTS": "true", "DEBUG_TOKEN": "secret", "REDIS_URL": "redis://localhost:6379/1", "REDIS_CACHE_SECONDS": "60", "GITHUB_QUOTA_RESERVE": "100", "WEBHOOK_SECRET": "hook"} {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	configuration, err := newTestConfig(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "[::1]:8443", configuration.ListenAddr)
+	assert.Equal(t, uint(600), configuration.CacheSeconds)
+	assert.Empty(t, configuration.CORSAllowedOrigins)
+	assert.Equal(t, "text", configuration.LogFormat)
+	assert.True(t, configuration.EnableDebugEndpoints)
+	assert.Equal(t, "secret", configuration.DebugToken)
+	assert.Equal(t, "redis://localhost:6379/1", configuration.RedisURL)
+	assert.Equal(t, uint(60), configuration.RedisCacheSeconds)
+	assert.Equal(t, uint(100), configuration.GithubQuotaReserve)
+	assert.Equal(t, "hook", configuration.WebhookSecret)
+}
+
+func TestNewWithInvalidValues(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"ListenAddr", []string{"--listen-addr=127.0.0.1:http"}, "Config.ListenAddr address is invalid: 127.0.0.1:http"},
+		{"TLSCertFileOnly", []string{"--tls-cert-file=cert.pem"}, "Config.TLSCertFile & Config.TLSKeyFile must be set together"},
+		{"RootRedirectURL", []string{"--root-redirect-url=github.com"}, "Config.RootRedirectURL URL is invalid: github.com"},
+		{"Redirect", []string{"--redirects=/badge/github"}, "Config.Redirects redirect is invalid: /badge/github"},
+		{"SunsetDate", []string{"--api-deprecations=/api/history=tomorrow"}, "Config.APIDeprecations sunset date is invalid: tomorrow"},
+		{"CORSAllowedOrigin", []string{"--cors-allowed-origins=https://a.example.com/dashboard"}, "Config.CORSAllowedOrigins origin is invalid: https://a.example.com/dashboard"},
+		{"BitbucketUsernameOnly", []string{"--bitbucket-username=octocat"}, "Config.BitbucketUsername & Config.BitbucketAppPassword must be set together"},
+		{"UpstreamTimeout", []string{"--upstream-timeout=0"}, "Config.UpstreamTimeout must be greater than 0"},
+		{"CacheSecondsRange", []string{"--min-cache-seconds=600", "--max-cache-seconds=60"}, "Config.MinCacheSeconds must not be greater than Config.MaxCacheSeconds"},
+		{"CacheSeconds", []string{"--cache-seconds=60"}, "Config.CacheSeconds must be between Config.MinCacheSeconds & Config.MaxCacheSeconds: 60"},
+		{"RedisURL", []string{"--redis-url=localhost:6379"}, "Config.RedisURL URL is invalid, must be a redis://, rediss:// or unix:// URL"},
+		{"RedisCacheSeconds", []string{"--redis-url=redis://localhost:6379", "--redis-cache-seconds=0"}, "Config.RedisCacheSeconds must be greater than 0"},
+		{"GithubQuotaReserve", []string{"--github-quota-reserve=100"}, "Config.GithubQuotaReserve must be set along with Config.RedisURL"},
+		{"HealthSignal", []string{"--health-weights=stars=10"}, "Config.HealthWeights signal is invalid: stars"},
+		{"HealthWeights", []string{"--health-weights=commit=0"}, "Config.HealthWeights must have a weight greater than 0"},
+		{"HistoryTarget", []string{"--history-targets=github/google/stars"}, "Config.HistoryTargets target is invalid: github/google/stars"},
+		{"LogLevel", []string{"--log-level=verbose"}, "Config.LogLevel level is invalid: verbose"},
+		{"LogFormat", []string{"--log-format=xml"}, "Config.LogFormat format is invalid: xml"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := newTestConfig(t, testCase.args...)
+			if assert.Error(t, err) {
+				assert.Equal(t, testCase.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	if _, err := newTestConfig(t, "--github-access-token=secret", "--port=9090"); err != nil {
+		t.Fatal(err)
+	}
+
+	redacted, err := Options(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	for i, option := range redacted {
+		if i > 0 {
+			assert.True(t, redacted[i-1].Name < option.Name, "options must be sorted")
+		}
+		values[option.Name] = option.Value
+	}
+	assert.Equal(t, redactedValue, values[githubAccessTokenCfg])
+	assert.Equal(t, "", values[gitlabAccessTokenCfg], "unset secrets must not be reported as set")
+	assert.Equal(t, "9090", values[portCfg])
+	assert.NotContains(t, values, configFileCfg)
+
+	unredacted, err := Options(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, option := range unredacted {
+		if option.Name == githubAccessTokenCfg {
+			assert.Equal(t, "secret", option.Value)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue replaces the values of secrets when printing the configuration
+const redactedValue = "REDACTED"
+
+// flagEnvVars represents the environment variables of each flag, which take precedence over the configuration file
+var flagEnvVars = map[string]string{
+	listenAddrCfg:              "LISTEN_ADDR",
+	tlsCertFileCfg:             "TLS_CERT_FILE",
+	tlsKeyFileCfg:              "TLS_KEY_FILE",
+	upstreamRetriesCfg:         "UPSTREAM_RETRIES",
+	upstreamRetryDelayCfg:      "UPSTREAM_RETRY_DELAY",
+	circuitBreakerThresholdCfg: "CIRCUIT_BREAKER_THRESHOLD",
+	circuitBreakerCooldownCfg:  "CIRCUIT_BREAKER_COOLDOWN",
+	maxConcurrentUpstreamCfg:   "MAX_CONCURRENT_UPSTREAM",
+	upstreamQueueTimeoutCfg:    "UPSTREAM_QUEUE_TIMEOUT",
+	cacheSecondsCfg:            "CACHE_SECONDS",
+	minCacheSecondsCfg:         "MIN_CACHE_SECONDS",
+	maxCacheSecondsCfg:         "MAX_CACHE_SECONDS",
+	redisURLCfg:                "REDIS_URL",
+	redisCacheSecondsCfg:       "REDIS_CACHE_SECONDS",
+	maxLogoSizeCfg:             "MAX_LOGO_SIZE",
+	rootRedirectURLCfg:         "ROOT_REDIRECT_URL",
+	externalURLCfg:             "EXTERNAL_URL",
+	redirectsCfg:               "REDIRECTS",
+	apiDeprecationsCfg:         "API_DEPRECATIONS",
+	corsAllowedOriginsCfg:      "CORS_ALLOWED_ORIGINS",
+	disableCORSCfg:             "DISABLE_CORS",
+	githubAccessTokenCfg:       "GITHUB_ACCESS_TOKEN",
+	githubAccessTokensCfg:      "GITHUB_TOKENS",
+	githubQuotaReserveCfg:      "GITHUB_QUOTA_RESERVE",
+	gitlabAccessTokenCfg:       "GITLAB_TOKEN",
+	bitbucketUsernameCfg:       "BITBUCKET_USERNAME",
+	bitbucketAppPasswordCfg:    "BITBUCKET_APP_PASSWORD",
+	giteaBaseURLCfg:            "GITEA_BASE_URL",
+	giteaAccessTokenCfg:        "GITEA_TOKEN",
+	sourcehutAccessTokenCfg:    "SRHT_TOKEN",
+	azureDevopsTokenCfg:        "AZURE_DEVOPS_TOKEN",
+	allowQueryTokensCfg:        "ALLOW_QUERY_TOKENS",
+	webhookSecretCfg:           "WEBHOOK_SECRET",
+	healthWeightsCfg:           "HEALTH_WEIGHTS",
+	historyFileCfg:             "HISTORY_FILE",
+	historyTargetsCfg:          "HISTORY_TARGETS",
+	logLevelCfg:                "LOG_LEVEL",
+	logFormatCfg:               "LOG_FORMAT",
+	enableDebugEndpointsCfg:    "ENABLE_DEBUG_ENDPOINTS",
+	debugTokenCfg:              "DEBUG_TOKEN",
+}
+
+// secretFlags represents the flags holding secrets
+var secretFlags = map[string]bool{
+	githubAccessTokenCfg:    true,
+	githubAccessTokensCfg:   true,
+	gitlabAccessTokenCfg:    true,
+	bitbucketAppPasswordCfg: true,
+	giteaAccessTokenCfg:     true,
+	sourcehutAccessTokenCfg: true,
+	azureDevopsTokenCfg:     true,
+	debugTokenCfg:           true,
+	redisURLCfg:             true,
+	webhookSecretCfg:        true,
+}
+
+// fileOption represents an option set in the configuration file
+type fileOption struct {
+	name  string
+	value string
+	line  int
+}
+
+// optionValue converts the YAML node of an option into its flag value, joining lists (eg. `[a, b]` into "a,b")
+// & maps (eg. `{a: 1, b: 2}` into "a=1,b=2") with commas
+func optionValue(path string, name string, node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("%s:%d: option %q must be a list of scalar values", path, item.Line, name)
+			}
+			values = append(values, item.Value)
+		}
+		return strings.Join(values, ","), nil
+	case yaml.MappingNode:
+		values := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Kind != yaml.ScalarNode || value.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("%s:%d: option %q must be a map of scalar values", path, key.Line, name)
+			}
+			values = append(values, key.Value+"="+value.Value)
+		}
+		return strings.Join(values, ","), nil
+	default:
+		return "", fmt.Errorf("%s:%d: option %q must be a scalar value, a list or a map", path, node.Line, name)
+	}
+}
+
+// parseFile parses the options of a YAML configuration document, validating that every option is a known flag
+func parseFile(path string, content []byte, flags *flag.FlagSet) ([]fileOption, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: configuration must be a map of options", path, root.Line)
+	}
+
+	var options []fileOption
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		name := key.Value
+		if key.Kind != yaml.ScalarNode || name == configFileCfg || flags.Lookup(name) == nil {
+			return nil, fmt.Errorf("%s:%d: unknown option %q", path, key.Line, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s:%d: duplicate option %q", path, key.Line, name)
+		}
+		seen[name] = true
+
+		flagValue, err := optionValue(path, name, value)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, fileOption{name: name, value: flagValue, line: value.Line})
+	}
+
+	return options, nil
+}
+
+// loadFile sets the flags from the options of the configuration file, unless already set on the command line or
+// by an environment variable
+func loadFile(path string, flags *flag.FlagSet, changed func(name string) bool) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	options, err := parseFile(path, content, flags)
+	if err != nil {
+		return err
+	}
+
+	for _, option := range options {
+		if changed != nil && changed(option.name) {
+			continue
+		}
+		if envVar, ok := flagEnvVars[option.name]; ok && os.Getenv(envVar) != "" {
+			continue
+		}
+		if err := flags.Set(option.name, option.value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value %q for option %q: %v", path, option.line, option.value, option.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Option represents a configuration option, keyed by flag name, & its effective value
+type Option struct {
+	Name  string
+	Value string
+}
+
+// Options returns the effective configuration options in lexicographical order, replacing the values of secrets with
+// "REDACTED" if redactSecrets is set
+func Options(redactSecrets bool) ([]Option, error) {
+	if flagSet == nil {
+		return nil, fmt.Errorf("configuration flags are not set")
+	}
+
+	var options []Option
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFileCfg {
+			return
+		}
+		value := f.Value.String()
+		if redactSecrets && secretFlags[f.Name] && value != "" {
+			value = redactedValue
+		}
+		options = append(options, Option{Name: f.Name, Value: value})
+	})
+	return options, nil
+}
+
+// Print writes the effective configuration as a YAML document, which can be used as a configuration file
+func Print(w io.Writer, redactSecrets bool) error {
+	options, err := Options(redactSecrets)
+	if err != nil {
+		return err
+	}
+
+	document := &yaml.Node{Kind: yaml.MappingNode}
+	for _, option := range options {
+		value := &yaml.Node{Kind: yaml.ScalarNode, Value: option.Value}
+		if value.Value == "" {
+			value.Style = yaml.DoubleQuotedStyle
+		}
+		document.Content = append(document.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: option.Name}, value)
+	}
+
+	content, err := yaml.Marshal(document)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
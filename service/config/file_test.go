@@ -0,0 +1,119 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestFlagSet returns a flagset with a few flags of each kind
+func newTestFlagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String(configFileCfg, "", "")
+	flags.Uint(portCfg, 8080, "")
+	flags.Bool(trustProxyCfg, false, "")
+	flags.String(githubAccessTokenCfg, "", "")
+	flags.String(externalURLCfg, "", "")
+	flags.String(historyTargetsCfg, "", "")
+	flags.String(healthWeightsCfg, "", "")
+	return flags
+}
+
+func TestParseFile(t *testing.T) {
+	t.Parallel()
+
+	content := `
+port: 9090
+trust-proxy: true
+history-targets:
+  - github/google/gopacket/stars
+  - gitlab/gitlab-org/gitaly/forks
+health-weights:
+  commit: 30
+  issues: 20
+`
+	options, err := parseFile("badger.yaml", []byte(content), newTestFlagSet())
+	assert.NoError(t, err)
+	assert.Equal(t, []fileOption{
+		{name: "port", value: "9090", line: 2},
+		{name: "trust-proxy", value: "true", line: 3},
+		{name: "history-targets", value: "github/google/gopacket/stars,gitlab/gitlab-org/gitaly/forks", line: 5},
+		{name: "health-weights", value: "commit=30,issues=20", line: 8},
+	}, options)
+
+	options, err = parseFile("badger.yaml", []byte(""), newTestFlagSet())
+	assert.NoError(t, err)
+	assert.Empty(t, options)
+}
+
+func TestParseFileWithInvalidContent(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"Syntax", "port: [9090\n", "badger.yaml: yaml: line 1: did not find expected ',' or ']'"},
+		{"NotMap", "- port\n", "badger.yaml:1: configuration must be a map of options"},
+		{"UnknownOption", "port: 9090\nprot: 9090\n", `badger.yaml:2: unknown option "prot"`},
+		{"ConfigFileOption", "config: other.yaml\n", `badger.yaml:1: unknown option "config"`},
+		{"DuplicateOption", "port: 9090\n\nport: 9091\n", `badger.yaml:3: duplicate option "port"`},
+		{"NestedList", "history-targets:\n  - [a, b]\n", `badger.yaml:2: option "history-targets" must be a list of scalar values`},
+		{"NestedMap", "health-weights:\n  commit: {a: 1}\n", `badger.yaml:2: option "health-weights" must be a map of scalar values`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := parseFile("badger.yaml", []byte(testCase.content), newTestFlagSet())
+			assert.EqualError(t, err, testCase.expected)
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "badger-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	content := "port: 9090\ntrust-proxy: true\ngithub-access-token: file-token\nexternal-url: https://file.example.com\n"
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// command line flags take precedence over environment variables, which take precedence over the file
+	os.Setenv("GITHUB_ACCESS_TOKEN", "env-token")
+	defer os.Unsetenv("GITHUB_ACCESS_TOKEN")
+	flags := newTestFlagSet()
+	flags.Set(externalURLCfg, "https://flag.example.com")
+	flags.Set(githubAccessTokenCfg, "env-token")
+	changed := func(name string) bool { return name == externalURLCfg }
+
+	assert.NoError(t, loadFile(file.Name(), flags, changed))
+	assert.Equal(t, "9090", flags.Lookup(portCfg).Value.String())
+	assert.Equal(t, "true", flags.Lookup(trustProxyCfg).Value.String())
+	assert.Equal(t, "env-token", flags.Lookup(githubAccessTokenCfg).Value.String())
+	assert.Equal(t, "https://flag.example.com", flags.Lookup(externalURLCfg).Value.String())
+}
+
+func TestLoadFileWithInvalidValue(t *testing.T) {
+	t.Parallel()
+
+	file, err := ioutil.TempFile("", "badger-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString("trust-proxy: true\nport: eighty\n"); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	err = loadFile(file.Name(), newTestFlagSet(), nil)
+	assert.EqualError(t, err, file.Name()+`:2: invalid value "eighty" for option "port": parse error`)
+}
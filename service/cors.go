@@ -0,0 +1,64 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// corsAllowedMethods represents the methods allowed in CORS requests, as every route is read-only
+	corsAllowedMethods = "GET, HEAD, OPTIONS"
+	// corsMaxAge represents the duration in seconds that browsers may cache the result of CORS preflight requests
+	corsMaxAge = "86400"
+)
+
+// corsExposedHeaders represents the response headers readable from browsers besides the CORS-safelisted ones
+var corsExposedHeaders = strings.Join([]string{"ETag", badgeWidthHeader, badgeHeightHeader, staleHeader, requestIDHeader, versionHeader}, ", ")
+
+// withCORS lets browsers of the allowed origins (or any origin for "*") read every response, including badge images
+// drawn onto canvases, & answers CORS preflight requests. CORS headers are omitted if no origin is allowed.
+func withCORS(allowedOrigins []string, next http.Handler) http.Handler {
+	if len(allowedOrigins) == 0 {
+		return next
+	}
+
+	allowAnyOrigin := false
+	origins := map[string]bool{}
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAnyOrigin = true
+		}
+		origins[origin] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		allowedOrigin := ""
+		if allowAnyOrigin {
+			allowedOrigin = "*"
+		} else {
+			// responses differ between origins, even for requests without the `Origin` header
+			header.Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); origins[origin] {
+				allowedOrigin = origin
+			}
+		}
+		if allowedOrigin != "" {
+			header.Set("Access-Control-Allow-Origin", allowedOrigin)
+			header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowedOrigin != "" {
+				header.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				if requestHeaders := r.Header.Get("Access-Control-Request-Headers"); requestHeaders != "" {
+					header.Set("Access-Control-Allow-Headers", requestHeaders)
+				}
+				header.Set("Access-Control-Max-Age", corsMaxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestCORSHandler returns the application handler serving static badges, allowing CORS requests of the origins
+func newTestCORSHandler(t *testing.T, allowedOrigins []string) http.Handler {
+	configuration := &config.Config{CacheSeconds: 3600, MinCacheSeconds: 300, MaxCacheSeconds: 86400, CORSAllowedOrigins: allowedOrigins}
+	staticService, err := NewStaticService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitProviderService, err := NewGitlabService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &Application{
+		config:           configuration,
+		staticService:    &staticService,
+		bitbucketService: &gitProviderService,
+		giteaService:     &gitProviderService,
+		githubService:    &gitProviderService,
+		gitlabService:    &gitProviderService,
+	}
+	return app.handler()
+}
+
+func TestWithCORS(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                string
+		allowedOrigins      []string
+		method              string
+		path                string
+		headers             map[string]string
+		expectedStatus      int
+		expectedAllowOrigin string
+		expectedVary        bool
+	}{
+		{"AnyOrigin", []string{"*"}, "GET", "/static?subject=build&status=passing", map[string]string{"Origin": "https://a.example.com"}, http.StatusOK, "*", false},
+		{"AnyOriginWithoutOrigin", []string{"*"}, "GET", "/static?subject=build&status=passing", nil, http.StatusOK, "*", false},
+		{"AnyOriginErrorResponse", []string{"*"}, "GET", "/static?subject=build&status=passing&color=%23zzz", nil, http.StatusBadRequest, "*", false},
+		{"AllowedOrigin", []string{"https://a.example.com", "https://b.example.com"}, "GET", "/static?subject=build&status=passing", map[string]string{"Origin": "https://b.example.com"}, http.StatusOK, "https://b.example.com", true},
+		{"DisallowedOrigin", []string{"https://a.example.com", "https://b.example.com"}, "GET", "/static?subject=build&status=passing", map[string]string{"Origin": "https://c.example.com"}, http.StatusOK, "", true},
+		{"Disabled", nil, "GET", "/static?subject=build&status=passing", map[string]string{"Origin": "https://a.example.com"}, http.StatusOK, "", false},
+		{"Preflight", []string{"*"}, "OPTIONS", "/static", map[string]string{"Origin": "https://a.example.com", "Access-Control-Request-Method": "GET"}, http.StatusNoContent, "*", false},
+		{"PreflightAllowedOrigin", []string{"https://a.example.com", "https://b.example.com"}, "OPTIONS", "/static", map[string]string{"Origin": "https://a.example.com", "Access-Control-Request-Method": "GET"}, http.StatusNoContent, "https://a.example.com", true},
+		{"PreflightDisallowedOrigin", []string{"https://a.example.com"}, "OPTIONS", "/static", map[string]string{"Origin": "https://c.example.com", "Access-Control-Request-Method": "GET"}, http.StatusNoContent, "", true},
+		{"PreflightDisabled", nil, "OPTIONS", "/static", map[string]string{"Origin": "https://a.example.com", "Access-Control-Request-Method": "GET"}, http.StatusMethodNotAllowed, "", false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest(testCase.method, testCase.path, nil)
+			for name, value := range testCase.headers {
+				req.Header.Set(name, value)
+			}
+			newTestCORSHandler(t, testCase.allowedOrigins).ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatus, res.Code)
+			assert.Equal(t, testCase.expectedAllowOrigin, res.Header().Get("Access-Control-Allow-Origin"))
+			if testCase.expectedVary {
+				assert.Contains(t, res.Header()["Vary"], "Origin")
+			} else {
+				assert.NotContains(t, res.Header()["Vary"], "Origin")
+			}
+			if testCase.expectedAllowOrigin != "" {
+				assert.Contains(t, res.Header().Get("Access-Control-Expose-Headers"), "ETag")
+			}
+			if testCase.method == "OPTIONS" && testCase.expectedAllowOrigin != "" {
+				assert.Equal(t, "GET, HEAD, OPTIONS", res.Header().Get("Access-Control-Allow-Methods"))
+				assert.Equal(t, "86400", res.Header().Get("Access-Control-Max-Age"))
+				assert.Empty(t, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithCORSPreflightRequestHeaders(t *testing.T) {
+	t.Parallel()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "/static", nil)
+	req.Header.Set("Origin", "https://a.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "If-None-Match")
+	newTestCORSHandler(t, []string{"*"}).ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, "If-None-Match", res.Header().Get("Access-Control-Allow-Headers"))
+}
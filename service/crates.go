@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/internal/version"
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// cratesBaseURL represents the base URL of the crates.io API
+const cratesBaseURL = "https://crates.io/api/v1"
+
+// errCrateNotFound represents a crate that doesn't exist
+var errCrateNotFound = errors.New("crate not found")
+
+type cratesService struct {
+	name        string
+	baseURL     string
+	config      *config.Config
+	logger      *zap.Logger
+	httpClient  *http.Client
+	staleValues *staleValueCache
+	results     *resultCache
+	requests    singleflight.Group
+}
+
+type cratesCrateResponse struct {
+	Crate struct {
+		Downloads        int    `json:"downloads"`
+		MaxStableVersion string `json:"max_stable_version"`
+		MaxVersion       string `json:"max_version"`
+		RecentDownloads  int    `json:"recent_downloads"`
+	} `json:"crate"`
+	Versions []struct {
+		License string `json:"license"`
+		Num     string `json:"num"`
+		Yanked  bool   `json:"yanked"`
+	} `json:"versions"`
+}
+
+// userAgentTransport identifies upstream API calls with the `User-Agent` header, as required by the crawler policy of
+// crates.io
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (transport *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", transport.userAgent)
+	return transport.base.RoundTrip(req)
+}
+
+// NewCratesService returns a HTTP handler for the crates.io badge service
+func NewCratesService(configuration *config.Config, logger *zap.Logger) (MetricService, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	transport := &userAgentTransport{
+		base:      upstreamTransport(configuration),
+		userAgent: fmt.Sprintf("aegis/%s (https://github.com/tohjustin/aegis)", version.Version),
+	}
+	results, err := newResultCache(configuration, logger, "crates")
+	if err != nil {
+		return nil, err
+	}
+	return &cratesService{
+		name:        "crates",
+		baseURL:     cratesBaseURL,
+		config:      configuration,
+		logger:      logger,
+		httpClient:  newUpstreamClient(configuration, logger, "crates", &rateLimitTransport{base: transport, limiter: newRateLimiter("crates")}),
+		staleValues: newStaleValueCache("crates", staleValueRetention, staleValueCacheSize),
+		results:     results,
+	}, nil
+}
+
+// isYanked returns whether every published version of the crate has been yanked
+func (crate *cratesCrateResponse) isYanked() bool {
+	for _, version := range crate.Versions {
+		if !version.Yanked {
+			return false
+		}
+	}
+	return len(crate.Versions) > 0
+}
+
+// latestVersion returns the highest stable version of the crate, falling back on the highest prerelease version for
+// crates without any stable version
+func (crate *cratesCrateResponse) latestVersion() string {
+	if crate.Crate.MaxStableVersion != "" {
+		return crate.Crate.MaxStableVersion
+	}
+	return crate.Crate.MaxVersion
+}
+
+// license returns the license of the latest version of the crate, or an empty string if not specified
+func (crate *cratesCrateResponse) license() string {
+	latestVersion := crate.latestVersion()
+	for _, version := range crate.Versions {
+		if version.Num == latestVersion {
+			return version.License
+		}
+	}
+	return ""
+}
+
+// crateVersionStatus returns the badge status & color of the latest version of the crate, prereleases are colored
+// orange
+func crateVersionStatus(crate *cratesCrateResponse) (string, string) {
+	if crate.isYanked() {
+		return "yanked", "red"
+	}
+	if crate.Crate.MaxStableVersion == "" && crate.Crate.MaxVersion != "" {
+		return crate.Crate.MaxVersion, "orange"
+	}
+	return versionStatus(crate.latestVersion())
+}
+
+func (service *cratesService) getCrate(ctx context.Context, name string) (*cratesCrateResponse, error) {
+	url := fmt.Sprintf("%s/crates/%s", service.baseURL, url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errCrateNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+
+	var crate cratesCrateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&crate); err != nil {
+		return nil, err
+	}
+	return &crate, nil
+}
+
+// SupportedMetrics returns the metrics served by the service
+func (service *cratesService) SupportedMetrics() []string {
+	return []string{"downloads", "license", "version"}
+}
+
+func (service *cratesService) supportedQueryParams() map[string][]badgeQueryParam {
+	return map[string][]badgeQueryParam{
+		"downloads": {{"period", "Period of the download count (total or recent), defaults to total", "recent"}},
+	}
+}
+
+func (service *cratesService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *cratesService) fetchBadge(r *http.Request) (cachedResult, error) {
+	routeVariables := mux.Vars(r)
+	name, _ := url.PathUnescape(routeVariables["package"])
+	method := routeVariables["method"]
+	period := r.URL.Query().Get("period")
+	ctx := upstreamContext(r)
+
+	var subject string
+	switch method {
+	case "downloads":
+		subject = "downloads"
+		if period == "recent" {
+			subject = "recent downloads"
+		} else if period != "" && period != "total" {
+			return cachedResult{}, invalidQueryParameterBadge("period")
+		}
+	case "license":
+		subject = "license"
+	case "version":
+		subject = "crates.io"
+	default:
+		return cachedResult{}, notFoundBadge
+	}
+
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         fetchKey(r),
+		isFinal:     func(err error) bool { return err == errCrateNotFound },
+	}
+	result, err := fetchResult(r, requestLogger(service.logger, r), fetch, func() (cachedResult, error) {
+		var result cachedResult
+		var err error
+		var fetched interface{}
+		fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+			return service.getCrate(ctx, name)
+		})
+		if err == nil {
+			crate := fetched.(*cratesCrateResponse)
+			switch method {
+			case "downloads":
+				result.Value = crate.Crate.Downloads
+				if period == "recent" {
+					result.Value = crate.Crate.RecentDownloads
+				}
+			case "license":
+				result.Status, result.Color = licenseStatus(crate.license())
+			case "version":
+				result.Status, result.Color = crateVersionStatus(crate)
+			}
+		}
+		return result, err
+	})
+
+	if err == errCrateNotFound {
+		return result, packageNotFoundBadge
+	}
+	result.Subject = subject
+	return result, err
+}
+
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *cratesService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	value, status, color := result.Value, result.Status, result.Color
+
+	// Textual statuses are used as is, only numeric values are formatted & colored by value
+	isNumeric := status == ""
+	if isNumeric {
+		query := r.URL.Query()
+		// Download counts are humanized unless requested otherwise
+		if _, ok := query["humanize"]; !ok {
+			query.Set("humanize", "true")
+		}
+		status = formatStatus(value, query)
+	}
+
+	badgeParams := &badge.Params{Subject: result.Subject, Status: status, Color: color}
+	if isNumeric {
+		if err := parseColorRangesQuery(badgeParams, value, r.URL.Query()); err != nil {
+			return nil, invalidQueryParameterBadge("colorRanges")
+		}
+	}
+	return badgeParams, nil
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestCratesService returns a router serving the crates.io badge service backed by a fake crates.io API
+func newTestCratesService(t *testing.T, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewCratesService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*cratesService).baseURL = fakeAPI.URL + "/api/v1"
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/crates/{method}/{package}`, service)
+
+	return router, fakeAPI.Close
+}
+
+// fakeCratesAPI returns a handler responding with the canned crates of the request paths
+func fakeCratesAPI(responses map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"detail":"Not Found"}]}`))
+			return
+		}
+		w.Write([]byte(response))
+	}
+}
+
+var fakeCrates = map[string]string{
+	"/api/v1/crates/serde": `{
+		"crate": {"downloads": 123456789, "recent_downloads": 23456789, "max_version": "1.0.118", "max_stable_version": "1.0.118"},
+		"versions": [
+			{"num": "1.0.118", "license": "MIT OR Apache-2.0", "yanked": false},
+			{"num": "1.0.117", "license": "MIT OR Apache-2.0", "yanked": false}
+		]
+	}`,
+	"/api/v1/crates/tokio": `{
+		"crate": {"downloads": 4000, "recent_downloads": 1000, "max_version": "1.0.0-beta.1", "max_stable_version": "0.3.5"},
+		"versions": [
+			{"num": "1.0.0-beta.1", "license": "MIT", "yanked": false},
+			{"num": "0.3.5", "license": "MIT", "yanked": false}
+		]
+	}`,
+	"/api/v1/crates/nightly": `{
+		"crate": {"downloads": 12, "recent_downloads": 2, "max_version": "0.1.0-alpha.2", "max_stable_version": null},
+		"versions": [
+			{"num": "0.1.0-alpha.2", "license": null, "yanked": false},
+			{"num": "0.1.0-alpha.1", "license": null, "yanked": false}
+		]
+	}`,
+	"/api/v1/crates/abandoned": `{
+		"crate": {"downloads": 42, "recent_downloads": 0, "max_version": "0.0.0", "max_stable_version": null},
+		"versions": [
+			{"num": "0.2.0", "license": "MIT", "yanked": true},
+			{"num": "0.1.0", "license": "MIT", "yanked": true}
+		]
+	}`,
+}
+
+func TestCratesService(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"StableVersion", "/crates/version/serde", &badge.Params{Subject: "crates.io", Status: "1.0.118", Color: "blue"}},
+		{"StableVersionBeforePrerelease", "/crates/version/tokio", &badge.Params{Subject: "crates.io", Status: "0.3.5", Color: "blue"}},
+		{"PrereleaseVersion", "/crates/version/nightly", &badge.Params{Subject: "crates.io", Status: "0.1.0-alpha.2", Color: "orange"}},
+		{"YankedVersion", "/crates/version/abandoned", &badge.Params{Subject: "crates.io", Status: "yanked", Color: "red"}},
+		{"Downloads", "/crates/downloads/serde", &badge.Params{Subject: "downloads", Status: "123.5M"}},
+		{"TotalDownloads", "/crates/downloads/serde?period=total", &badge.Params{Subject: "downloads", Status: "123.5M"}},
+		{"RecentDownloads", "/crates/downloads/serde?period=recent", &badge.Params{Subject: "recent downloads", Status: "23.5M"}},
+		{"NotHumanizedDownloads", "/crates/downloads/tokio?humanize=false", &badge.Params{Subject: "downloads", Status: "4.00k"}},
+		{"License", "/crates/license/serde", &badge.Params{Subject: "license", Status: "MIT OR Apache-2.0", Color: "blue"}},
+		{"MissingLicense", "/crates/license/nightly", &badge.Params{Subject: "license", Status: "not specified", Color: "lightgrey"}},
+	}
+
+	router, cleanup := newTestCratesService(t, fakeCratesAPI(fakeCrates))
+	defer cleanup()
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestCratesServiceWithUserAgent(t *testing.T) {
+	t.Parallel()
+
+	var userAgent string
+	router, cleanup := newTestCratesService(t, func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		fakeCratesAPI(fakeCrates)(w, r)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/crates/version/serde", nil)
+	router.ServeHTTP(res, req)
+
+	assert.True(t, strings.HasPrefix(userAgent, "aegis/"), userAgent)
+}
+
+func TestCratesServiceWithNotFound(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestCratesService(t, fakeCratesAPI(map[string]string{}))
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/crates/version/nothing", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "package not found"}), res.Body.String())
+}
+
+func TestCratesServiceWithUnsupportedPeriod(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestCratesService(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected crates.io API call: %s", r.URL)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/crates/downloads/serde?period=weekly", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// debugPathPrefix represents the path prefix of the debug endpoints, which are never listed by the index nor the
+// OpenAPI document
+const debugPathPrefix = "/debug"
+
+// isDebugRoute reports whether the route path template is a debug endpoint
+func isDebugRoute(pathTemplate string) bool {
+	return strings.HasPrefix(pathTemplate, debugPathPrefix+"/")
+}
+
+// withDebugToken rejects requests to the debug endpoints without the debug token as the bearer token of their
+// `Authorization` header, every request is accepted if the debug token is unset
+func withDebugToken(configuration *config.Config, next http.Handler) http.Handler {
+	token := configuration.DebugToken
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setNoStoreCacheControlHeader(w, configuration)
+		if token != "" {
+			authorization := r.Header.Get("Authorization")
+			if !strings.HasPrefix(authorization, "Bearer ") ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, "Bearer ")), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="debug"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleDebug registers the pprof (`/debug/pprof/`) & expvar (`/debug/vars`) endpoints on the router. They are routed
+// like every other route, so that their requests are logged, but they never call upstream APIs & therefore never go
+// through the rate limiters of the providers.
+func handleDebug(router *mux.Router, configuration *config.Config) {
+	router.Handle(debugPathPrefix+`/vars`, withDebugToken(configuration, expvar.Handler())).Methods("GET")
+	router.Handle(debugPathPrefix+`/pprof/cmdline`, withDebugToken(configuration, http.HandlerFunc(pprof.Cmdline))).Methods("GET")
+	router.Handle(debugPathPrefix+`/pprof/profile`, withDebugToken(configuration, http.HandlerFunc(pprof.Profile))).Methods("GET")
+	router.Handle(debugPathPrefix+`/pprof/symbol`, withDebugToken(configuration, http.HandlerFunc(pprof.Symbol))).Methods("GET", "POST")
+	router.Handle(debugPathPrefix+`/pprof/trace`, withDebugToken(configuration, http.HandlerFunc(pprof.Trace))).Methods("GET")
+	// the index also serves the named profiles (eg. `/debug/pprof/heap`)
+	router.PathPrefix(debugPathPrefix + `/pprof/`).Handler(withDebugToken(configuration, http.HandlerFunc(pprof.Index))).Methods("GET")
+}
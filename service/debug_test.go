@@ -0,0 +1,79 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// debugTestPaths represents the paths of the debug endpoints served without blocking for a profiling duration
+var debugTestPaths = []string{"/debug/vars", "/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/cmdline", "/debug/pprof/symbol"}
+
+func newTestDebugHandler(t *testing.T, enabled bool, token string) http.Handler {
+	app := newTestIndexApplication(t, "")
+	app.config.EnableDebugEndpoints = enabled
+	app.config.DebugToken = token
+	return app.handler()
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		enabled        bool
+		token          string
+		authorization  string
+		expectedStatus int
+	}{
+		{"Disabled", false, "", "", http.StatusNotFound},
+		{"DisabledWithToken", false, "secret", "Bearer secret", http.StatusNotFound},
+		{"WithoutToken", true, "", "", http.StatusOK},
+		{"MissingToken", true, "secret", "", http.StatusUnauthorized},
+		{"WrongToken", true, "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"WrongScheme", true, "secret", "Basic secret", http.StatusUnauthorized},
+		{"Token", true, "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := newTestDebugHandler(t, testCase.enabled, testCase.token)
+			for _, path := range debugTestPaths {
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", path, nil)
+				if testCase.authorization != "" {
+					req.Header.Set("Authorization", testCase.authorization)
+				}
+				handler.ServeHTTP(res, req)
+
+				assert.Equal(t, testCase.expectedStatus, res.Code, path)
+				if testCase.expectedStatus == http.StatusUnauthorized {
+					assert.Equal(t, `Bearer realm="debug"`, res.Header().Get("WWW-Authenticate"), path)
+				}
+				if testCase.expectedStatus != http.StatusNotFound {
+					assert.Equal(t, "no-store", res.Header().Get("Cache-Control"), path)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugEndpointsAreNotListed(t *testing.T) {
+	t.Parallel()
+
+	app := newTestIndexApplication(t, "")
+	app.config.EnableDebugEndpoints = true
+	response, err := newIndexResponse(app.router(), app.metricServices())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range response.Routes {
+		assert.False(t, isDebugRoute(route.Path), route.Path)
+	}
+	assert.NotContains(t, newOpenAPIDocument(response).Paths, "/debug/vars")
+}
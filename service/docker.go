@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// dockerHubBaseURL represents the base URL of the Docker Hub API
+	dockerHubBaseURL = "https://hub.docker.com/v2"
+	// dockerHubPageSize represents the number of tags listed per page
+	dockerHubPageSize = 100
+	// dockerHubMaxPages represents the maximum number of pages of tags listed to find the latest version
+	dockerHubMaxPages = 10
+)
+
+var (
+	// errDockerRepositoryNotFound represents a Docker Hub repository that doesn't exist
+	errDockerRepositoryNotFound = errors.New("Docker Hub repository not found")
+	// errDockerTagNotFound represents a tag that doesn't exist in a Docker Hub repository
+	errDockerTagNotFound = errors.New("Docker Hub tag not found")
+	// errDockerImageNotFound represents an architecture without any image for a tag of a Docker Hub repository
+	errDockerImageNotFound = errors.New("Docker Hub image not found")
+)
+
+type dockerService struct {
+	name        string
+	baseURL     string
+	config      *config.Config
+	logger      *zap.Logger
+	httpClient  *http.Client
+	staleValues *staleValueCache
+	results     *resultCache
+	requests    singleflight.Group
+}
+
+type dockerRepositoryResponse struct {
+	PullCount int `json:"pull_count"`
+	StarCount int `json:"star_count"`
+}
+
+type dockerTagResponse struct {
+	Name          string    `json:"name"`
+	TagLastPushed time.Time `json:"tag_last_pushed"`
+	Images        []struct {
+		Architecture string `json:"architecture"`
+		Size         int    `json:"size"`
+	} `json:"images"`
+}
+
+type dockerTagsResponse struct {
+	Next    string              `json:"next"`
+	Results []dockerTagResponse `json:"results"`
+}
+
+// NewDockerService returns a HTTP handler for the Docker Hub badge service
+func NewDockerService(configuration *config.Config, logger *zap.Logger) (MetricService, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	results, err := newResultCache(configuration, logger, "docker")
+	if err != nil {
+		return nil, err
+	}
+	return &dockerService{
+		name:        "docker",
+		baseURL:     dockerHubBaseURL,
+		config:      configuration,
+		logger:      logger,
+		httpClient:  newUpstreamClient(configuration, logger, "docker", &rateLimitTransport{base: upstreamTransport(configuration), limiter: newRateLimiter("docker")}),
+		staleValues: newStaleValueCache("docker", staleValueRetention, staleValueCacheSize),
+		results:     results,
+	}, nil
+}
+
+// fetch decodes the response of the Docker Hub API into v, responses of missing resources are returned as notFoundErr
+func (service *dockerService) fetch(ctx context.Context, url string, notFoundErr error, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return notFoundErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (service *dockerService) getRepository(ctx context.Context, namespace string, repo string) (*dockerRepositoryResponse, error) {
+	var repository dockerRepositoryResponse
+	url := fmt.Sprintf("%s/repositories/%s/%s/", service.baseURL, url.PathEscape(namespace), url.PathEscape(repo))
+	if err := service.fetch(ctx, url, errDockerRepositoryNotFound, &repository); err != nil {
+		return nil, err
+	}
+	return &repository, nil
+}
+
+func (service *dockerService) getPullCount(ctx context.Context, namespace string, repo string) (int, error) {
+	repository, err := service.getRepository(ctx, namespace, repo)
+	if err != nil {
+		return 0, err
+	}
+	return repository.PullCount, nil
+}
+
+func (service *dockerService) getStarCount(ctx context.Context, namespace string, repo string) (int, error) {
+	repository, err := service.getRepository(ctx, namespace, repo)
+	if err != nil {
+		return 0, err
+	}
+	return repository.StarCount, nil
+}
+
+// getImageSize returns the compressed size in bytes of the image of the architecture for the tag
+func (service *dockerService) getImageSize(ctx context.Context, namespace string, repo string, tag string, arch string) (int, error) {
+	var dockerTag dockerTagResponse
+	url := fmt.Sprintf("%s/repositories/%s/%s/tags/%s", service.baseURL, url.PathEscape(namespace), url.PathEscape(repo), url.PathEscape(tag))
+	if err := service.fetch(ctx, url, errDockerTagNotFound, &dockerTag); err != nil {
+		return 0, err
+	}
+
+	for _, image := range dockerTag.Images {
+		if image.Architecture == arch {
+			return image.Size, nil
+		}
+	}
+	return 0, errDockerImageNotFound
+}
+
+// getLatestVersion returns the most recently pushed tag other than `latest`, or an empty string if the repository
+// has no such tag. Tags are listed page by page, up to `dockerHubMaxPages` pages.
+func (service *dockerService) getLatestVersion(ctx context.Context, namespace string, repo string) (string, error) {
+	var latest dockerTagResponse
+	url := fmt.Sprintf("%s/repositories/%s/%s/tags?page_size=%d", service.baseURL, url.PathEscape(namespace), url.PathEscape(repo), dockerHubPageSize)
+	for page := 0; url != "" && page < dockerHubMaxPages; page++ {
+		var tags dockerTagsResponse
+		if err := service.fetch(ctx, url, errDockerRepositoryNotFound, &tags); err != nil {
+			return "", err
+		}
+		for _, tag := range tags.Results {
+			if tag.Name != "latest" && tag.TagLastPushed.After(latest.TagLastPushed) {
+				latest = tag
+			}
+		}
+		url = tags.Next
+	}
+	return latest.Name, nil
+}
+
+// SupportedMetrics returns the metrics served by the service
+func (service *dockerService) SupportedMetrics() []string {
+	return []string{"image-size", "pulls", "stars", "version"}
+}
+
+func (service *dockerService) supportedQueryParams() map[string][]badgeQueryParam {
+	return map[string][]badgeQueryParam{
+		"image-size": {
+			{"tag", "Tag of the image, defaults to latest", "alpine"},
+			{"arch", "Architecture of the image, defaults to amd64", "arm64"},
+		},
+	}
+}
+
+func (service *dockerService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *dockerService) fetchBadge(r *http.Request) (cachedResult, error) {
+	routeVariables := mux.Vars(r)
+	namespace, _ := url.PathUnescape(routeVariables["owner"])
+	repo, _ := url.PathUnescape(routeVariables["repo"])
+	method := routeVariables["method"]
+	ctx := upstreamContext(r)
+
+	// Official images are published under the `library` namespace
+	if namespace == "_" {
+		namespace = "library"
+	}
+
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         fetchKey(r),
+		isFinal: func(err error) bool {
+			return err == errDockerRepositoryNotFound || err == errDockerTagNotFound || err == errDockerImageNotFound
+		},
+	}
+	result, err := fetchResult(r, requestLogger(service.logger, r), fetch, func() (cachedResult, error) {
+		var result cachedResult
+		var err error
+		switch method {
+		case "image-size":
+			tag := r.URL.Query().Get("tag")
+			if tag == "" {
+				tag = "latest"
+			}
+			arch := r.URL.Query().Get("arch")
+			if arch == "" {
+				arch = "amd64"
+			}
+			result.Subject = "image size"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getImageSize(ctx, namespace, repo, tag, arch)
+			})
+			if err == nil {
+				result.Status, result.Color = formatKilobytes(result.Value/1000, false), "blue"
+			}
+		case "pulls":
+			result.Subject = "docker pulls"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getPullCount(ctx, namespace, repo)
+			})
+		case "stars":
+			result.Subject = "docker stars"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getStarCount(ctx, namespace, repo)
+			})
+		case "version":
+			result.Subject = "docker"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getLatestVersion(ctx, namespace, repo)
+			})
+			if err == nil {
+				result.Status, result.Color = versionStatus(fetched.(string))
+			}
+		default:
+			return result, notFoundBadge
+		}
+		return result, err
+	})
+	switch err {
+	case errDockerRepositoryNotFound:
+		return result, repositoryNotFoundBadge
+	case errDockerTagNotFound:
+		return result, tagNotFoundBadge
+	case errDockerImageNotFound:
+		return result, imageNotFoundBadge
+	}
+	return result, err
+}
+
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *dockerService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	value, subject, status, color := result.Value, result.Subject, result.Status, result.Color
+
+	// Textual statuses are used as is, only numeric values are formatted & colored by value
+	isNumeric := status == ""
+	if isNumeric {
+		query := r.URL.Query()
+		// Pull counts are humanized unless requested otherwise
+		if _, ok := query["humanize"]; mux.Vars(r)["method"] == "pulls" && !ok {
+			query.Set("humanize", "true")
+		}
+		status = formatStatus(value, query)
+	}
+
+	badgeParams := &badge.Params{Subject: subject, Status: status, Color: color}
+	if isNumeric {
+		if err := parseColorRangesQuery(badgeParams, value, r.URL.Query()); err != nil {
+			return nil, invalidQueryParameterBadge("colorRanges")
+		}
+	}
+	return badgeParams, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestDockerService returns a router serving the Docker Hub badge service backed by a fake Docker Hub API
+func newTestDockerService(t *testing.T, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewDockerService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*dockerService).baseURL = fakeAPI.URL + "/v2"
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/docker/{method}/{owner}/{repo}`, service)
+
+	return router, fakeAPI.Close
+}
+
+// fakeDockerHubAPI returns a fake Docker Hub API of the `library/nginx` repository, whose tags are listed in 2 pages
+func fakeDockerHubAPI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/repositories/library/nginx/":
+			w.Write([]byte(`{"name":"nginx","namespace":"library","pull_count":1234567890,"star_count":15432}`))
+		case "/v2/repositories/library/nginx/tags":
+			if r.URL.Query().Get("page") == "2" {
+				w.Write([]byte(`{"next":null,"results":[
+					{"name":"1.18.0","tag_last_pushed":"2020-11-20T10:00:00.000000Z"},
+					{"name":"1.19.4","tag_last_pushed":"2020-11-26T10:00:00.000000Z"}
+				]}`))
+				return
+			}
+			w.Write([]byte(fmt.Sprintf(`{"next":"http://%s/v2/repositories/library/nginx/tags?page=2&page_size=100","results":[
+				{"name":"latest","tag_last_pushed":"2020-12-01T10:00:00.000000Z"},
+				{"name":"1.19.5","tag_last_pushed":"2020-11-25T10:00:00.000000Z"}
+			]}`, r.Host)))
+		case "/v2/repositories/library/nginx/tags/latest":
+			w.Write([]byte(`{"name":"latest","images":[
+				{"architecture":"arm64","size":51234567},
+				{"architecture":"amd64","size":53612345}
+			]}`))
+		case "/v2/repositories/library/nginx/tags/alpine":
+			w.Write([]byte(`{"name":"alpine","images":[{"architecture":"amd64","size":9512345}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"object not found"}`))
+		}
+	}
+}
+
+func TestDockerService(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"Pulls", "/docker/pulls/library/nginx", &badge.Params{Subject: "docker pulls", Status: "1.2G"}},
+		{"OfficialImagePulls", "/docker/pulls/_/nginx", &badge.Params{Subject: "docker pulls", Status: "1.2G"}},
+		{"Stars", "/docker/stars/_/nginx", &badge.Params{Subject: "docker stars", Status: "15.4k"}},
+		{"ImageSize", "/docker/image-size/_/nginx", &badge.Params{Subject: "image size", Status: "53.6 MB", Color: "blue"}},
+		{"ImageSizeOfArch", "/docker/image-size/_/nginx?arch=arm64", &badge.Params{Subject: "image size", Status: "51.2 MB", Color: "blue"}},
+		{"ImageSizeOfTag", "/docker/image-size/_/nginx?tag=alpine", &badge.Params{Subject: "image size", Status: "9.5 MB", Color: "blue"}},
+		{"Version", "/docker/version/_/nginx", &badge.Params{Subject: "docker", Status: "1.19.4", Color: "blue"}},
+	}
+
+	router, cleanup := newTestDockerService(t, fakeDockerHubAPI())
+	defer cleanup()
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestDockerServiceWithNotFound(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"Repository", "/docker/pulls/_/nothing", "repository not found"},
+		{"Tag", "/docker/image-size/_/nginx?tag=nothing", "tag not found"},
+		{"Image", "/docker/image-size/_/nginx?tag=alpine&arch=s390x", "image not found"},
+	}
+
+	router, cleanup := newTestDockerService(t, fakeDockerHubAPI())
+	defer cleanup()
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusNotFound, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: testCase.expected}), res.Body.String())
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// dynamicMaxResponseSize represents the maximum number of bytes of the JSON documents fetched by dynamic badges
+	dynamicMaxResponseSize = 1 << 20
+	// dynamicTimeout represents the maximum duration of fetching the JSON documents of dynamic badges, including
+	// redirects & reading the response body
+	dynamicTimeout = 5 * time.Second
+)
+
+var (
+	// errDynamicAddressBlocked represents a URL resolving to an address that dynamic badges must not fetch from
+	errDynamicAddressBlocked = errors.New("blocked address")
+	// errDynamicResponseTooLarge represents a response exceeding `dynamicMaxResponseSize`
+	errDynamicResponseTooLarge = errors.New("response too large")
+	// errDynamicInvalidJSON represents a response that isn't a JSON document
+	errDynamicInvalidJSON = errors.New("invalid JSON")
+	// errDynamicNoResult represents a path expression that doesn't match any value of the JSON document
+	errDynamicNoResult = errors.New("no result")
+	// errDynamicUnsupportedValue represents a path expression matching an object, which can't be rendered
+	errDynamicUnsupportedValue = errors.New("unsupported value")
+)
+
+// dynamicBlockedNetworks represents the networks of private, loopback, link-local & otherwise non-public addresses
+var dynamicBlockedNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// parseCIDRs parses the CIDR notations into networks, panicking on invalid notations
+func parseCIDRs(notations ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(notations))
+	for _, notation := range notations {
+		_, network, err := net.ParseCIDR(notation)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// isPublicIP returns whether the IP address is publicly routable
+func isPublicIP(ip net.IP) bool {
+	for _, network := range dynamicBlockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+type dynamicService struct {
+	name       string
+	config     *config.Config
+	logger     *zap.Logger
+	httpClient *http.Client
+	requests   singleflight.Group
+}
+
+// newDynamicHTTPClient returns a HTTP client fetching documents over HTTPS only, from addresses allowed by
+// isAllowedIP. Addresses are checked once resolved, right before connecting, so that DNS records (or redirects) can't
+// point the client at internal services.
+func newDynamicHTTPClient(transport *http.Transport, isAllowedIP func(net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: dynamicTimeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isAllowedIP(ip) {
+				return errDynamicAddressBlocked
+			}
+			return nil
+		},
+	}
+	// Proxies would connect to the target on behalf of the client, bypassing the check of its address
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: &instrumentedTransport{provider: "dynamic", base: transport},
+		Timeout:   dynamicTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to a non-HTTPS URL of %s", req.URL.Host)
+			}
+			if len(via) >= 5 {
+				return fmt.Errorf("too many redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// NewDynamicService returns a HTTP handler for the service rendering values extracted from JSON documents
+func NewDynamicService(configuration *config.Config, logger *zap.Logger) (http.Handler, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	return &dynamicService{
+		name:       "dynamic",
+		config:     configuration,
+		logger:     logger,
+		httpClient: newDynamicHTTPClient(http.DefaultTransport.(*http.Transport).Clone(), isPublicIP),
+	}, nil
+}
+
+// jsonPathSegment represents a step of a path expression, selecting a key of an object, an index of an array, or
+// every value of either
+type jsonPathSegment struct {
+	key      string
+	wildcard bool
+}
+
+// parseJSONPath parses a path expression in either the JSONPath dot & bracket notation (eg. `$.items[0]['name']`) or
+// the GJSON dot notation (eg. `items.0.name`), wildcards are written as `*` or `#`
+func parseJSONPath(expression string) ([]jsonPathSegment, error) {
+	path := strings.TrimPrefix(expression, "$")
+	var segments []jsonPathSegment
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			if i+1 >= len(path) || path[i+1] == '.' || path[i+1] == '[' {
+				return nil, fmt.Errorf("unexpected %q at position %d", path[i:i+1], i)
+			}
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed bracket at position %d", i)
+			}
+			selector := path[i+1 : i+end]
+			switch {
+			case selector == "*":
+				segments = append(segments, jsonPathSegment{wildcard: true})
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				segments = append(segments, jsonPathSegment{key: selector[1 : len(selector)-1]})
+			default:
+				if _, err := strconv.Atoi(selector); err != nil {
+					return nil, fmt.Errorf("invalid selector %q at position %d", selector, i)
+				}
+				segments = append(segments, jsonPathSegment{key: selector})
+			}
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end == -1 {
+				end = len(path) - i
+			}
+			key := path[i : i+end]
+			segments = append(segments, jsonPathSegment{key: key, wildcard: key == "*" || key == "#"})
+			i += end
+		}
+	}
+	return segments, nil
+}
+
+// evaluateJSONPath returns the values of the JSON document matched by the path expression
+func evaluateJSONPath(document interface{}, segments []jsonPathSegment) []interface{} {
+	values := []interface{}{document}
+	for _, segment := range segments {
+		var matches []interface{}
+		for _, value := range values {
+			switch value := value.(type) {
+			case map[string]interface{}:
+				if segment.wildcard {
+					for _, child := range value {
+						matches = append(matches, child)
+					}
+				} else if child, ok := value[segment.key]; ok {
+					matches = append(matches, child)
+				}
+			case []interface{}:
+				if segment.wildcard {
+					matches = append(matches, value...)
+				} else if index, err := strconv.Atoi(segment.key); err == nil && index >= 0 && index < len(value) {
+					matches = append(matches, value[index])
+				}
+			}
+		}
+		values = matches
+	}
+	return values
+}
+
+// formatJSONValue formats a JSON value into the badge status text, arrays are comma-joined & numbers are formatted
+// without exponent or rounding
+func formatJSONValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case string:
+		return value, nil
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return strconv.FormatInt(n, 10), nil
+		}
+		n, err := value.Float64()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			formatted, err := formatJSONValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, formatted)
+		}
+		return strings.Join(items, ", "), nil
+	default:
+		return "", errDynamicUnsupportedValue
+	}
+}
+
+// fetchDynamicDocument fetches the document of the URL provided by a badge request, with the HTTP client of
+// `newDynamicHTTPClient`
+func fetchDynamicDocument(ctx context.Context, httpClient *http.Client, documentURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", documentURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+	if resp.ContentLength > dynamicMaxResponseSize {
+		return nil, errDynamicResponseTooLarge
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, dynamicMaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > dynamicMaxResponseSize {
+		return nil, errDynamicResponseTooLarge
+	}
+	return body, nil
+}
+
+// parseDynamicURL returns the document URL set in the request query, only absolute HTTPS URLs are supported
+func parseDynamicURL(query url.Values) (*url.URL, error) {
+	documentURL, err := url.Parse(query.Get("url"))
+	if err != nil {
+		return nil, err
+	}
+	if documentURL.Host == "" || documentURL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL: %s", query.Get("url"))
+	}
+	return documentURL, nil
+}
+
+// getDocument fetches & decodes the JSON document of the URL
+func (service *dynamicService) getDocument(ctx context.Context, documentURL string) (interface{}, error) {
+	body, err := fetchDynamicDocument(ctx, service.httpClient, documentURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, errDynamicInvalidJSON
+	}
+	return document, nil
+}
+
+func (service *dynamicService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(service.logger, r)
+	query := r.URL.Query()
+
+	documentURL, err := parseDynamicURL(query)
+	if err != nil {
+		logger.Info("Invalid document URL",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.String("documentURL", query.Get("url")))
+		if err := invalidQueryParameterWithReason(w, service.config, "url", "https only"); err != nil {
+			logger.Error("Failed to create error badge",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.Error(err))
+		}
+		return
+	}
+	segments, err := parseJSONPath(query.Get("query"))
+	if err != nil || query.Get("query") == "" {
+		logger.Info("Invalid path expression",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.String("query", query.Get("query")))
+		if err := invalidQueryParameter(w, service.config, "query"); err != nil {
+			logger.Error("Failed to create error badge",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.Error(err))
+		}
+		return
+	}
+
+	// Fetch the document, sharing upstream calls among concurrent requests for the same document
+	result, err, _ := service.requests.Do(documentURL.String(), func() (interface{}, error) {
+		return service.getDocument(context.Background(), documentURL.String())
+	})
+	var status string
+	if err == nil {
+		values := evaluateJSONPath(result, segments)
+		switch {
+		case len(values) == 0:
+			err = errDynamicNoResult
+		case len(values) == 1:
+			status, err = formatJSONValue(values[0])
+		default:
+			status, err = formatJSONValue(values)
+		}
+	}
+
+	if err != nil {
+		logger.Info("Failed to extract value",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.Error(err))
+		var badgeErr error
+		switch {
+		case errors.Is(err, errDynamicAddressBlocked):
+			badgeErr = invalidQueryParameterWithReason(w, service.config, "url", "blocked address")
+		case err == errDynamicResponseTooLarge, err == errDynamicInvalidJSON:
+			badgeErr = invalidQueryParameterWithReason(w, service.config, "url", err.Error())
+		case err == errDynamicNoResult:
+			badgeErr = valueNotFound(w, service.config)
+		case err == errDynamicUnsupportedValue:
+			badgeErr = invalidQueryParameterWithReason(w, service.config, "query", "object value")
+		default:
+			badgeErr = inaccessible(w, service.config)
+		}
+		if badgeErr != nil {
+			logger.Error("Failed to create error badge",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.Error(badgeErr))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Overwrite any badge texts
+	badgeParams := &badge.Params{Subject: "custom badge", Status: status, Color: "blue"}
+	if err := parseBadgeQuery(service.config, badgeParams, query); err != nil {
+		logger.Info("Invalid badge query",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.Error(err))
+		if err := invalidBadgeQuery(w, service.config, err); err != nil {
+			logger.Error("Failed to create error response",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.Error(err))
+		}
+		return
+	}
+
+	if err := writeBadge(w, r, service.config, query, badgeParams); err != nil {
+		logger.Error("Failed to create badge",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestDynamicService returns a dynamic badge service & a fake HTTPS server of JSON documents, the service is
+// allowed to fetch from the loopback address of the fake server if allowLoopback is set
+func newTestDynamicService(t *testing.T, allowLoopback bool, fakeHandler http.HandlerFunc) (http.Handler, *httptest.Server) {
+	fakeServer := httptest.NewTLSServer(fakeHandler)
+
+	service, err := NewDynamicService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	isAllowedIP := isPublicIP
+	if allowLoopback {
+		isAllowedIP = func(ip net.IP) bool { return ip.IsLoopback() || isPublicIP(ip) }
+	}
+	transport := fakeServer.Client().Transport.(*http.Transport).Clone()
+	service.(*dynamicService).httpClient = newDynamicHTTPClient(transport, isAllowedIP)
+
+	return service, fakeServer
+}
+
+// dynamicURL returns the URL of a dynamic badge of the document URL & path expression
+func dynamicURL(documentURL string, query string) string {
+	return "/dynamic/json?" + url.Values{"url": {documentURL}, "query": {query}}.Encode()
+}
+
+func TestIsPublicIP(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		ip       string
+		expected bool
+	}{
+		{"140.82.112.3", true},
+		{"2606:4700::6810:84e5", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.20.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, isPublicIP(net.ParseIP(testCase.ip)), testCase.ip)
+	}
+}
+
+func TestDynamicService(t *testing.T) {
+	t.Parallel()
+
+	document := `{
+		"name": "aegis",
+		"version": {"major": 1, "full": "1.2.3"},
+		"downloads": 1234567,
+		"ratio": 0.75,
+		"stable": true,
+		"license": null,
+		"tags": ["go", "badges", 3],
+		"contributors": [{"login": "alice"}, {"login": "bob"}]
+	}`
+	service, fakeServer := newTestDynamicService(t, true, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(document))
+	})
+	defer fakeServer.Close()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"JSONPath", dynamicURL(fakeServer.URL, "$.version.full"), &badge.Params{Subject: "custom badge", Status: "1.2.3", Color: "blue"}},
+		{"DotNotation", dynamicURL(fakeServer.URL, "name"), &badge.Params{Subject: "custom badge", Status: "aegis", Color: "blue"}},
+		{"BracketNotation", dynamicURL(fakeServer.URL, "$['contributors'][1]['login']"), &badge.Params{Subject: "custom badge", Status: "bob", Color: "blue"}},
+		{"ArrayIndex", dynamicURL(fakeServer.URL, "tags.0"), &badge.Params{Subject: "custom badge", Status: "go", Color: "blue"}},
+		{"Array", dynamicURL(fakeServer.URL, "$.tags"), &badge.Params{Subject: "custom badge", Status: "go, badges, 3", Color: "blue"}},
+		{"Wildcard", dynamicURL(fakeServer.URL, "$.contributors[*].login"), &badge.Params{Subject: "custom badge", Status: "alice, bob", Color: "blue"}},
+		{"GJSONWildcard", dynamicURL(fakeServer.URL, "contributors.#.login"), &badge.Params{Subject: "custom badge", Status: "alice, bob", Color: "blue"}},
+		{"Integer", dynamicURL(fakeServer.URL, "$.downloads"), &badge.Params{Subject: "custom badge", Status: "1234567", Color: "blue"}},
+		{"Float", dynamicURL(fakeServer.URL, "$.ratio"), &badge.Params{Subject: "custom badge", Status: "0.75", Color: "blue"}},
+		{"Boolean", dynamicURL(fakeServer.URL, "$.stable"), &badge.Params{Subject: "custom badge", Status: "true", Color: "blue"}},
+		{"Null", dynamicURL(fakeServer.URL, "$.license"), &badge.Params{Subject: "custom badge", Status: "null", Color: "blue"}},
+		{"BadgeQuery", dynamicURL(fakeServer.URL, "$.version.full") + "&subject=release&color=green", &badge.Params{Subject: "release", Status: "1.2.3", Color: "green"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			service.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestDynamicServiceWithErrors(t *testing.T) {
+	t.Parallel()
+
+	service, fakeServer := newTestDynamicService(t, true, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Write([]byte(`{"padding":"` + strings.Repeat("x", dynamicMaxResponseSize) + `"}`))
+		case "/invalid":
+			w.Write([]byte(`<html></html>`))
+		case "/missing":
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			w.Write([]byte(`{"name":"aegis","version":{"full":"1.2.3"}}`))
+		}
+	})
+	defer fakeServer.Close()
+
+	testCases := []struct {
+		name           string
+		url            string
+		expectedCode   int
+		expectedStatus string
+	}{
+		{"MissingPath", dynamicURL(fakeServer.URL, "$.nothing.here"), http.StatusNotFound, "no result"},
+		{"OutOfRangeIndex", dynamicURL(fakeServer.URL, "$.name[3]"), http.StatusNotFound, "no result"},
+		{"ObjectValue", dynamicURL(fakeServer.URL, "$.version"), http.StatusBadRequest, "invalid query: object value"},
+		{"InvalidQuery", dynamicURL(fakeServer.URL, "$.version..full"), http.StatusBadRequest, "invalid query"},
+		{"MissingQuery", "/dynamic/json?url=" + url.QueryEscape(fakeServer.URL), http.StatusBadRequest, "invalid query"},
+		{"HTTPURL", dynamicURL(strings.Replace(fakeServer.URL, "https://", "http://", 1), "$.name"), http.StatusBadRequest, "invalid url: https only"},
+		{"MissingURL", "/dynamic/json?query=name", http.StatusBadRequest, "invalid url: https only"},
+		{"ResponseSizeCap", dynamicURL(fakeServer.URL+"/large", "$.padding"), http.StatusBadRequest, "invalid url: response too large"},
+		{"InvalidJSON", dynamicURL(fakeServer.URL+"/invalid", "$.name"), http.StatusBadRequest, "invalid url: invalid JSON"},
+		{"UpstreamError", dynamicURL(fakeServer.URL+"/missing", "$.name"), http.StatusOK, "inaccessible"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			service.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedCode, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: testCase.expectedStatus}), res.Body.String())
+		})
+	}
+}
+
+func TestDynamicServiceWithPrivateAddress(t *testing.T) {
+	t.Parallel()
+
+	service, fakeServer := newTestDynamicService(t, false, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected call to a private address: %s", r.URL)
+	})
+	defer fakeServer.Close()
+
+	// Host names are only checked once resolved, so that they can't point at private addresses either
+	localhostURL := strings.Replace(fakeServer.URL, "127.0.0.1", "localhost", 1)
+	for _, documentURL := range []string{fakeServer.URL, localhostURL} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", dynamicURL(documentURL, "$.name"), nil)
+		service.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "invalid url: blocked address"}), res.Body.String())
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// errEndpointInvalidSchema represents a document that doesn't follow the endpoint badge schema
+var errEndpointInvalidSchema = errors.New("invalid schema")
+
+// endpointDocument represents a document of the shields.io endpoint badge schema (https://shields.io/endpoint),
+// required properties are pointers to tell missing properties apart from empty ones
+type endpointDocument struct {
+	SchemaVersion *int    `json:"schemaVersion"`
+	Label         *string `json:"label"`
+	Message       *string `json:"message"`
+	Color         string  `json:"color"`
+	LabelColor    string  `json:"labelColor"`
+	IsError       bool    `json:"isError"`
+	Style         string  `json:"style"`
+	CacheSeconds  uint    `json:"cacheSeconds"`
+}
+
+// validate returns an error describing the first property of the document that doesn't follow the schema
+func (document *endpointDocument) validate() error {
+	if document.SchemaVersion == nil || *document.SchemaVersion != 1 {
+		return fmt.Errorf("%w: unsupported schemaVersion", errEndpointInvalidSchema)
+	}
+	if document.Label == nil {
+		return fmt.Errorf("%w: missing label", errEndpointInvalidSchema)
+	}
+	if document.Message == nil || *document.Message == "" {
+		return fmt.Errorf("%w: missing message", errEndpointInvalidSchema)
+	}
+	var paramErr *badge.ParamError
+	documentParams := &badge.Params{Color: document.Color, LabelColor: document.LabelColor, Style: badge.Style(document.Style)}
+	if err := documentParams.Validate(); errors.As(err, &paramErr) {
+		return fmt.Errorf("%w: invalid %s", errEndpointInvalidSchema, paramErr.Param)
+	}
+	return nil
+}
+
+type endpointService struct {
+	name       string
+	config     *config.Config
+	logger     *zap.Logger
+	httpClient *http.Client
+	requests   singleflight.Group
+}
+
+// NewEndpointService returns a HTTP handler for the service rendering badges described by shields.io endpoint badge
+// documents
+func NewEndpointService(configuration *config.Config, logger *zap.Logger) (http.Handler, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	return &endpointService{
+		name:       "endpoint",
+		config:     configuration,
+		logger:     logger,
+		httpClient: newDynamicHTTPClient(http.DefaultTransport.(*http.Transport).Clone(), isPublicIP),
+	}, nil
+}
+
+// getDocument fetches, decodes & validates the endpoint badge document of the URL
+func (service *endpointService) getDocument(ctx context.Context, documentURL string) (*endpointDocument, error) {
+	body, err := fetchDynamicDocument(ctx, service.httpClient, documentURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var document endpointDocument
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, errDynamicInvalidJSON
+	}
+	if err := document.validate(); err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+func (service *endpointService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(service.logger, r)
+	query := r.URL.Query()
+
+	documentURL, err := parseDynamicURL(query)
+	if err != nil {
+		logger.Info("Invalid document URL",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.String("documentURL", query.Get("url")))
+		if err := invalidQueryParameterWithReason(w, service.config, "url", "https only"); err != nil {
+			logger.Error("Failed to create error badge",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.Error(err))
+		}
+		return
+	}
+
+	// Fetch the document, sharing upstream calls among concurrent requests for the same document
+	result, err, _ := service.requests.Do(documentURL.String(), func() (interface{}, error) {
+		return service.getDocument(context.Background(), documentURL.String())
+	})
+	if err != nil {
+		logger.Info("Failed to fetch endpoint document",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.Error(err))
+		var badgeErr error
+		switch {
+		case errors.Is(err, errDynamicAddressBlocked):
+			badgeErr = invalidQueryParameterWithReason(w, service.config, "url", "blocked address")
+		case errors.Is(err, errEndpointInvalidSchema), err == errDynamicResponseTooLarge, err == errDynamicInvalidJSON:
+			badgeErr = invalidQueryParameterWithReason(w, service.config, "url", err.Error())
+		default:
+			badgeErr = inaccessible(w, service.config)
+		}
+		if badgeErr != nil {
+			logger.Error("Failed to create error badge",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.Error(badgeErr))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+	document := result.(*endpointDocument)
+
+	// The document provides the badge options, overridden by the options of the request query except for the color of
+	// error badges. The cache duration of the document can only be lengthened by the request query.
+	badgeParams := &badge.Params{
+		Subject:    *document.Label,
+		Status:     *document.Message,
+		Color:      document.Color,
+		LabelColor: document.LabelColor,
+		Style:      badge.Style(document.Style),
+	}
+	if badgeParams.Color == "" {
+		badgeParams.Color = "lightgrey"
+	}
+	if document.IsError {
+		if document.Color == "" {
+			badgeParams.Color = "red"
+		}
+		query.Del("color")
+	}
+	if seconds, err := strconv.ParseUint(query.Get("cacheSeconds"), 10, 64); document.CacheSeconds > 0 && (err != nil || uint(seconds) < document.CacheSeconds) {
+		query.Set("cacheSeconds", strconv.FormatUint(uint64(document.CacheSeconds), 10))
+	}
+	if err := parseBadgeQuery(service.config, badgeParams, query); err != nil {
+		logger.Info("Invalid badge query",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.Error(err))
+		if err := invalidBadgeQuery(w, service.config, err); err != nil {
+			logger.Error("Failed to create error response",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.Error(err))
+		}
+		return
+	}
+
+	if err := writeBadge(w, r, service.config, query, badgeParams); err != nil {
+		logger.Error("Failed to create badge",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestEndpointService returns an endpoint badge service & a fake HTTPS server of the endpoint badge documents of
+// the request paths, the service is allowed to fetch from the loopback address of the fake server
+func newTestEndpointService(t *testing.T, configuration *config.Config, documents map[string]string) (http.Handler, *httptest.Server) {
+	fakeServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		document, ok := documents[r.URL.Path]
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(document))
+	}))
+
+	service, err := NewEndpointService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := fakeServer.Client().Transport.(*http.Transport).Clone()
+	service.(*endpointService).httpClient = newDynamicHTTPClient(transport, func(ip net.IP) bool { return ip.IsLoopback() })
+
+	return service, fakeServer
+}
+
+// endpointURL returns the URL of an endpoint badge of the document URL, with the extra query parameters
+func endpointURL(documentURL string, extraQuery string) string {
+	return "/endpoint?url=" + url.QueryEscape(documentURL) + extraQuery
+}
+
+func TestEndpointService(t *testing.T) {
+	t.Parallel()
+
+	configuration := &config.Config{CacheSeconds: 300, MinCacheSeconds: 60, MaxCacheSeconds: 86400}
+	service, fakeServer := newTestEndpointService(t, configuration, map[string]string{
+		"/coverage": `{"schemaVersion":1,"label":"coverage","message":"92%","color":"green","labelColor":"555"}`,
+		"/plain":    `{"schemaVersion":1,"label":"build","message":"passing"}`,
+		"/error":    `{"schemaVersion":1,"label":"build","message":"failing","isError":true}`,
+		"/cached":   `{"schemaVersion":1,"label":"build","message":"passing","color":"green","cacheSeconds":3600}`,
+	})
+	defer fakeServer.Close()
+
+	testCases := []struct {
+		name                 string
+		url                  string
+		expected             *badge.Params
+		expectedCacheControl string
+	}{
+		{
+			"Document",
+			endpointURL(fakeServer.URL+"/coverage", ""),
+			&badge.Params{Subject: "coverage", Status: "92%", Color: "green", LabelColor: "555"},
+			"public, max-age=300, s-maxage=300",
+		},
+		{
+			"DefaultColor",
+			endpointURL(fakeServer.URL+"/plain", ""),
+			&badge.Params{Subject: "build", Status: "passing", Color: "lightgrey"},
+			"public, max-age=300, s-maxage=300",
+		},
+		{
+			"QueryOverrides",
+			endpointURL(fakeServer.URL+"/coverage", "&subject=tests&color=blue&labelColor=333&style=flat"),
+			&badge.Params{Subject: "tests", Status: "92%", Color: "blue", LabelColor: "333", Style: badge.Style("flat")},
+			"public, max-age=300, s-maxage=300",
+		},
+		{
+			"ErrorColor",
+			endpointURL(fakeServer.URL+"/error", ""),
+			&badge.Params{Subject: "build", Status: "failing", Color: "red"},
+			"public, max-age=300, s-maxage=300",
+		},
+		{
+			"ErrorColorNotOverridden",
+			endpointURL(fakeServer.URL+"/error", "&color=green&subject=ci"),
+			&badge.Params{Subject: "ci", Status: "failing", Color: "red"},
+			"public, max-age=300, s-maxage=300",
+		},
+		{
+			"DocumentCacheSeconds",
+			endpointURL(fakeServer.URL+"/cached", ""),
+			&badge.Params{Subject: "build", Status: "passing", Color: "green"},
+			"public, max-age=3600, s-maxage=3600",
+		},
+		{
+			"ShorterQueryCacheSeconds",
+			endpointURL(fakeServer.URL+"/cached", "&cacheSeconds=600"),
+			&badge.Params{Subject: "build", Status: "passing", Color: "green"},
+			"public, max-age=3600, s-maxage=3600",
+		},
+		{
+			"LongerQueryCacheSeconds",
+			endpointURL(fakeServer.URL+"/cached", "&cacheSeconds=7200"),
+			&badge.Params{Subject: "build", Status: "passing", Color: "green"},
+			"public, max-age=7200, s-maxage=7200",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			service.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedCacheControl, res.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestEndpointServiceWithInvalidSchema(t *testing.T) {
+	t.Parallel()
+
+	service, fakeServer := newTestEndpointService(t, &config.Config{}, map[string]string{
+		"/missing-version":     `{"label":"build","message":"passing"}`,
+		"/unsupported-version": `{"schemaVersion":2,"label":"build","message":"passing"}`,
+		"/missing-label":       `{"schemaVersion":1,"message":"passing"}`,
+		"/missing-message":     `{"schemaVersion":1,"label":"build"}`,
+		"/invalid-color":       `{"schemaVersion":1,"label":"build","message":"passing","color":"#ggg"}`,
+		"/invalid-style":       `{"schemaVersion":1,"label":"build","message":"passing","style":"3d"}`,
+		"/invalid-type":        `{"schemaVersion":"1","label":"build","message":"passing"}`,
+	})
+	defer fakeServer.Close()
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/missing-version", "invalid url: invalid schema: unsupported schemaVersion"},
+		{"/unsupported-version", "invalid url: invalid schema: unsupported schemaVersion"},
+		{"/missing-label", "invalid url: invalid schema: missing label"},
+		{"/missing-message", "invalid url: invalid schema: missing message"},
+		{"/invalid-color", "invalid url: invalid schema: invalid color"},
+		{"/invalid-style", "invalid url: invalid schema: invalid style"},
+		{"/invalid-type", "invalid url: invalid JSON"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", endpointURL(fakeServer.URL+testCase.path, ""), nil)
+			service.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusBadRequest, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: testCase.expected}), res.Body.String())
+		})
+	}
+}
+
+func TestEndpointServiceWithPrivateAddress(t *testing.T) {
+	t.Parallel()
+
+	service, fakeServer := newTestEndpointService(t, &config.Config{}, map[string]string{
+		"/plain": `{"schemaVersion":1,"label":"build","message":"passing"}`,
+	})
+	defer fakeServer.Close()
+	service.(*endpointService).httpClient = newDynamicHTTPClient(fakeServer.Client().Transport.(*http.Transport).Clone(), isPublicIP)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", endpointURL(fakeServer.URL+"/plain", ""), nil)
+	service.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "invalid url: blocked address"}), res.Body.String())
+}
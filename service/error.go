@@ -1,15 +1,73 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/tohjustin/aegis/pkg/badge"
 	"github.com/tohjustin/aegis/service/config"
 )
 
+// errorBadge represents an error of the badge requested (eg. an unsupported query parameter value, or a repository that
+// doesn't exist), returned by the fetches of the metric services so that both their HTTP handlers & the CLI report it
+type errorBadge struct {
+	// status represents the status of the error badge (eg. "repository not found")
+	status string
+	// respond responds to the request with the error badge
+	respond func(w http.ResponseWriter, configuration *config.Config) error
+}
+
+func (err *errorBadge) Error() string {
+	return err.status
+}
+
+// Error badges of the badges requested
+var (
+	accessDeniedBadge        = &errorBadge{"access denied", accessDenied}
+	accountNotFoundBadge     = &errorBadge{"account not found", accountNotFound}
+	badRequestBadge          = &errorBadge{"bad request", badRequest}
+	branchNotFoundBadge      = &errorBadge{"branch not found", branchNotFound}
+	categoryNotFoundBadge    = &errorBadge{"category not found", categoryNotFound}
+	imageNotFoundBadge       = &errorBadge{"image not found", imageNotFound}
+	mailingListNotFoundBadge = &errorBadge{"list not found", mailingListNotFound}
+	milestoneNotFoundBadge   = &errorBadge{"not found", milestoneNotFound}
+	noAccessBadge            = &errorBadge{"no access", noAccess}
+	notFoundBadge            = &errorBadge{"not found", notFound}
+	packageNotFoundBadge     = &errorBadge{"package not found", packageNotFound}
+	releaseNotFoundBadge     = &errorBadge{"release not found", releaseNotFound}
+	repositoryNotFoundBadge  = &errorBadge{"repository not found", repositoryNotFound}
+	tagNotFoundBadge         = &errorBadge{"tag not found", tagNotFound}
+	trackerNotFoundBadge     = &errorBadge{"tracker not found", trackerNotFound}
+	workflowNotFoundBadge    = &errorBadge{"workflow not found", workflowNotFound}
+)
+
+// invalidQueryParameterBadge returns the error badge of a malformed query parameter
+func invalidQueryParameterBadge(name string) *errorBadge {
+	return &errorBadge{"invalid " + name, func(w http.ResponseWriter, configuration *config.Config) error {
+		return invalidQueryParameter(w, configuration, name)
+	}}
+}
+
+// invalidQueryParameterWithReasonBadge returns the error badge of a malformed query parameter, describing why the
+// query parameter is malformed
+func invalidQueryParameterWithReasonBadge(name string, reason string) *errorBadge {
+	return &errorBadge{"invalid " + name + ": " + reason, func(w http.ResponseWriter, configuration *config.Config) error {
+		return invalidQueryParameterWithReason(w, configuration, name, reason)
+	}}
+}
+
 func generateErrorBadge(w http.ResponseWriter,
-	configuration *config.Config, status string) error {
-	generatedBadge, err := badge.Create(&badge.Params{
+	configuration *config.Config, statusCode int, status string) error {
+	return generateErrorBadgeWithCacheSeconds(w, configuration, configuration.CacheSeconds, statusCode, status)
+}
+
+// generateErrorBadgeWithCacheSeconds generates an error badge cached for the given duration in seconds, for errors
+// expected to be resolved before the configured cache duration
+func generateErrorBadgeWithCacheSeconds(w http.ResponseWriter,
+	configuration *config.Config, cacheSeconds uint, statusCode int, status string) error {
+	generatedBadge, size, err := badge.CreateWithSize(&badge.Params{
 		Subject: "aegis",
 		Status:  status,
 	})
@@ -17,35 +75,195 @@ func generateErrorBadge(w http.ResponseWriter,
 		return err
 	}
 
-	if !configuration.ExcludeCacheControlHeaders {
-		// cache response in browser for 1 hour (3600), CDN for 1 hour (3600)
-		w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=3600")
+	setCacheControlHeaders(w, configuration, cacheSeconds)
+	setErrorIDHeader(w)
+	setBadgeHeaders(w, svgBadgeFormat, &formattedBadge{body: []byte(generatedBadge), size: &size})
+	w.WriteHeader(statusCode)
+	w.Write([]byte(generatedBadge))
+	return nil
+}
+
+// generateUncachedErrorBadge generates an error badge that must not be cached, for errors of the request itself
+// rather than of the upstream APIs
+func generateUncachedErrorBadge(w http.ResponseWriter,
+	configuration *config.Config, statusCode int, status string) error {
+	generatedBadge, size, err := badge.CreateWithSize(&badge.Params{
+		Subject: "aegis",
+		Status:  status,
+	})
+	if err != nil {
+		return err
 	}
-	w.Header().Set("Content-Type", "image/svg+xml;utf-8")
+
+	setNoStoreCacheControlHeader(w, configuration)
+	setErrorIDHeader(w)
+	setBadgeHeaders(w, svgBadgeFormat, &formattedBadge{body: []byte(generatedBadge), size: &size})
+	w.WriteHeader(statusCode)
 	w.Write([]byte(generatedBadge))
 	return nil
 }
 
+// invalidBadgeQuery handles HTTP requests with invalid badge options, responding with a JSON description of the
+// invalid option that is never cached
+func invalidBadgeQuery(w http.ResponseWriter,
+	configuration *config.Config, queryErr error) error {
+	var response *badgeQueryError
+	if !errors.As(queryErr, &response) {
+		response = &badgeQueryError{Reason: queryErr.Error()}
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	setNoStoreCacheControlHeader(w, configuration)
+	setErrorIDHeader(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(body)
+	return nil
+}
+
 // badRequest handles HTTP requests that are malformed
 func badRequest(w http.ResponseWriter,
 	configuration *config.Config) error {
-	return generateErrorBadge(w, configuration, "bad request")
+	return generateErrorBadge(w, configuration, http.StatusBadRequest, "bad request")
+}
+
+// invalidQueryParameter handles HTTP requests with a malformed query parameter
+func invalidQueryParameter(w http.ResponseWriter,
+	configuration *config.Config, name string) error {
+	return generateErrorBadge(w, configuration, http.StatusBadRequest, "invalid "+name)
+}
+
+// invalidQueryParameterWithReason handles HTTP requests with a malformed query parameter, describing why
+// the query parameter is malformed
+func invalidQueryParameterWithReason(w http.ResponseWriter,
+	configuration *config.Config, name string, reason string) error {
+	return generateErrorBadge(w, configuration, http.StatusBadRequest, "invalid "+name+": "+reason)
 }
 
 // internalServerError handles HTTP requests that results in internal server error
 func internalServerError(w http.ResponseWriter,
 	configuration *config.Config) error {
-	return generateErrorBadge(w, configuration, "internal server error")
+	return generateErrorBadge(w, configuration, http.StatusOK, "internal server error")
 }
 
-// notFound handles HTTP requests for methods that don't exist
-func notFound(w http.ResponseWriter,
+// accessDenied handles HTTP requests for data that the upstream API denies access to
+func accessDenied(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusOK, "access denied")
+}
+
+// noAccess handles HTTP requests for data that the access token isn't allowed to read, which isn't cached so that the
+// badge recovers as soon as the token is granted access
+func noAccess(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateUncachedErrorBadge(w, configuration, http.StatusForbidden, "no access")
+}
+
+// inaccessible handles HTTP requests for data of a third-party URL that can't be fetched
+func inaccessible(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusOK, "inaccessible")
+}
+
+// rateLimited handles HTTP requests for data that can't be fetched until the rate limit of the upstream API resets,
+// cached for the minimum cache duration so that the badge recovers shortly after the rate limit resets
+func rateLimited(w http.ResponseWriter,
 	configuration *config.Config) error {
-	return generateErrorBadge(w, configuration, "not found")
+	return generateErrorBadgeWithCacheSeconds(w, configuration, configuration.MinCacheSeconds, http.StatusOK, "rate limited")
 }
 
-// serviceNotFound handles HTTP requests for services that don't exist
-func serviceNotFound(w http.ResponseWriter,
+// upstreamSaturated handles HTTP requests for data that can't be fetched due to too many concurrent upstream API
+// calls, cached briefly so that the badge recovers as soon as the traffic spike is over
+func upstreamSaturated(w http.ResponseWriter,
+	configuration *config.Config) error {
+	w.Header().Set("Retry-After", strconv.Itoa(upstreamSaturatedCacheSeconds))
+	return generateErrorBadgeWithCacheSeconds(w, configuration, upstreamSaturatedCacheSeconds, http.StatusServiceUnavailable, "busy")
+}
+
+// accountNotFound handles HTTP requests for a user or an organization that doesn't exist
+func accountNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "account not found")
+}
+
+// branchNotFound handles HTTP requests for a branch that doesn't exist in the repository
+func branchNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "branch not found")
+}
+
+// categoryNotFound handles HTTP requests for a discussion category that doesn't exist in the repository
+func categoryNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "category not found")
+}
+
+// milestoneNotFound handles HTTP requests for a milestone that doesn't exist in the repository
+func milestoneNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "not found")
+}
+
+// imageNotFound handles HTTP requests for an architecture without any image for a tag of a container repository
+func imageNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "image not found")
+}
+
+// mailingListNotFound handles HTTP requests for a mailing list that doesn't exist
+func mailingListNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "list not found")
+}
+
+// packageNotFound handles HTTP requests for a package that doesn't exist in the package registry
+func packageNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "package not found")
+}
+
+// releaseNotFound handles HTTP requests for a release tag that doesn't exist in the repository
+func releaseNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "release not found")
+}
+
+// repositoryNotFound handles HTTP requests for a repository that doesn't exist
+func repositoryNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "repository not found")
+}
+
+// tagNotFound handles HTTP requests for a tag that doesn't exist in the repository
+func tagNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "tag not found")
+}
+
+// trackerNotFound handles HTTP requests for a ticket tracker that doesn't exist
+func trackerNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "tracker not found")
+}
+
+// valueNotFound handles HTTP requests for a value that doesn't exist in the fetched document
+func valueNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "no result")
+}
+
+// workflowNotFound handles HTTP requests for a workflow that doesn't exist in the repository
+func workflowNotFound(w http.ResponseWriter,
+	configuration *config.Config) error {
+	return generateErrorBadge(w, configuration, http.StatusNotFound, "workflow not found")
+}
+
+// notFound handles HTTP requests for methods that don't exist
+func notFound(w http.ResponseWriter,
 	configuration *config.Config) error {
-	return generateErrorBadge(w, configuration, "service not found")
+	return generateUncachedErrorBadge(w, configuration, http.StatusNotFound, "not found")
 }
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// maxFanOutWorkers represents the maximum number of concurrent upstream API calls of a single badge request
+const maxFanOutWorkers = 8
+
+// fanOut runs the calls (indexed from 0 to n-1) on up to `workers` goroutines, returning the error of the first call
+// that failed. The first failure cancels the context of the running calls & skips the pending ones.
+func fanOut(ctx context.Context, workers int, n int, call func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	var firstErr error
+	errs := runFanOut(ctx, workers, n, func(ctx context.Context, i int) error {
+		err := call(ctx, i)
+		if err != nil {
+			once.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}
+		return err
+	})
+	if firstErr != nil {
+		return firstErr
+	}
+	// calls skipped after the cancellation of the parent context report its error
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fanOutBestEffort runs the calls (indexed from 0 to n-1) on up to `workers` goroutines, returning the error of each
+// call. Failures don't affect the other calls, only the cancellation of the context skips the pending ones, whose
+// error is the error of the context.
+func fanOutBestEffort(ctx context.Context, workers int, n int, call func(ctx context.Context, i int) error) []error {
+	return runFanOut(ctx, workers, n, call)
+}
+
+// runFanOut runs the calls on a bounded pool of goroutines, skipping the pending calls once the context is done
+func runFanOut(ctx context.Context, workers int, n int, call func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	if workers < 1 || workers > n {
+		workers = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for worker := 0; worker < workers; worker++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				errs[i] = call(ctx, i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fanOutTestLatency represents the artificial latency of the fake upstream API of the fan-out tests
+const fanOutTestLatency = 100 * time.Millisecond
+
+// newSlowUpstream returns a fake upstream API responding after the latency
+func newSlowUpstream(latency time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+// fetchSlowUpstream calls the fake upstream API
+func fetchSlowUpstream(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestFanOutRunsCallsConcurrently(t *testing.T) {
+	t.Parallel()
+
+	upstream := newSlowUpstream(fanOutTestLatency)
+	defer upstream.Close()
+
+	// N calls complete in about the latency of a single call, instead of the sum of their latencies
+	start := time.Now()
+	err := fanOut(context.Background(), maxFanOutWorkers, maxFanOutWorkers, func(ctx context.Context, i int) error {
+		return fetchSlowUpstream(ctx, upstream.URL)
+	})
+	elapsed := time.Since(start)
+
+	assert.NoError(t, err)
+	assert.True(t, elapsed >= fanOutTestLatency, elapsed)
+	assert.True(t, elapsed < 3*fanOutTestLatency, elapsed)
+}
+
+func TestFanOutBoundsWorkers(t *testing.T) {
+	t.Parallel()
+
+	var running, maxRunning int32
+	err := fanOut(context.Background(), 3, 12, func(ctx context.Context, i int) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), maxRunning)
+}
+
+func TestFanOutStopsOnFirstError(t *testing.T) {
+	t.Parallel()
+
+	upstream := newSlowUpstream(10 * fanOutTestLatency)
+	defer upstream.Close()
+
+	// the first failure cancels the running calls & skips the pending ones
+	errFailed := errors.New("failed")
+	var calls int32
+	start := time.Now()
+	err := fanOut(context.Background(), 2, 10, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i == 0 {
+			return errFailed
+		}
+		return fetchSlowUpstream(ctx, upstream.URL)
+	})
+
+	assert.Equal(t, errFailed, err)
+	assert.True(t, time.Since(start) < fanOutTestLatency, time.Since(start))
+	assert.True(t, atomic.LoadInt32(&calls) <= 3, atomic.LoadInt32(&calls))
+}
+
+func TestFanOutBestEffort(t *testing.T) {
+	t.Parallel()
+
+	// failures don't affect the other calls
+	errFailed := errors.New("failed")
+	var calls int32
+	errs := fanOutBestEffort(context.Background(), 2, 4, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i%2 == 1 {
+			return errFailed
+		}
+		return nil
+	})
+
+	assert.Equal(t, []error{nil, errFailed, nil, errFailed}, errs)
+	assert.Equal(t, int32(4), calls)
+}
+
+func TestFanOutWithCancelledContext(t *testing.T) {
+	t.Parallel()
+
+	upstream := newSlowUpstream(10 * fanOutTestLatency)
+	defer upstream.Close()
+
+	// cancelling the context stops the running calls & skips the pending ones
+	ctx, cancel := context.WithTimeout(context.Background(), fanOutTestLatency)
+	defer cancel()
+	var calls int32
+	start := time.Now()
+	errs := fanOutBestEffort(ctx, 2, 10, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&calls, 1)
+		return fetchSlowUpstream(ctx, upstream.URL)
+	})
+
+	assert.True(t, time.Since(start) < 5*fanOutTestLatency, time.Since(start))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	for _, err := range errs {
+		assert.Error(t, err)
+	}
+	assert.Equal(t, context.DeadlineExceeded, errs[len(errs)-1])
+}
+
+func TestFanOutWithoutCalls(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, fanOut(context.Background(), maxFanOutWorkers, 0, func(ctx context.Context, i int) error {
+		return errors.New("unexpected call")
+	}))
+	assert.Empty(t, fanOutBestEffort(context.Background(), maxFanOutWorkers, 0, nil))
+}
+
+func BenchmarkFanOut(b *testing.B) {
+	upstream := newSlowUpstream(10 * time.Millisecond)
+	defer upstream.Close()
+
+	for i := 0; i < b.N; i++ {
+		fanOut(context.Background(), maxFanOutWorkers, maxFanOutWorkers, func(ctx context.Context, i int) error {
+			return fetchSlowUpstream(ctx, upstream.URL)
+		})
+	}
+}
+
+func BenchmarkSequentialCalls(b *testing.B) {
+	upstream := newSlowUpstream(10 * time.Millisecond)
+	defer upstream.Close()
+
+	for i := 0; i < b.N; i++ {
+		for call := 0; call < maxFanOutWorkers; call++ {
+			fetchSlowUpstream(context.Background(), upstream.URL)
+		}
+	}
+}
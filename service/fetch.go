@@ -0,0 +1,270 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// fetchQueryParams represents the query parameters that affect the fetched data
+var fetchQueryParams = []string{"allow", "arch", "branch", "category", "event", "group", "include_prereleases", "label", "labels", "list", "period", "reviewer", "state", "tag"}
+
+// fetchKey identifies the data fetched for the badge requested, based on its route & the query parameters
+// that affect the fetched data
+func fetchKey(r *http.Request) string {
+	routeVariables := mux.Vars(r)
+	query := url.Values{}
+	for _, name := range fetchQueryParams {
+		for _, value := range r.URL.Query()[name] {
+			if value != "" {
+				query.Add(name, value)
+			}
+		}
+	}
+
+	owner := routeVariables["owner"]
+	// Routes of a package (ie. npm) identify it instead of a repository
+	if name := routeVariables["package"]; name != "" {
+		owner = name
+	}
+	// Routes of a repository of a project of an organization (ie. Azure DevOps) identify both
+	if organization := routeVariables["organization"]; organization != "" {
+		owner = organization + "/" + routeVariables["project"]
+	}
+	path := routeVariables["method"] + "/" + owner + "/" + routeVariables["repo"]
+	// Routes of a user or an organization identify the kind of account, as its data differs from the repository's
+	if account := routeVariables["account"]; account != "" {
+		path = account + "/" + path
+	}
+	// Routes of a single release, milestone or workflow identify it with an extra path variable
+	for _, name := range []string{"tag", "number", "workflow"} {
+		if value := routeVariables[name]; value != "" {
+			path += "/" + value
+		}
+	}
+	return path + "?" + query.Encode()
+}
+
+// fetchShared shares a single upstream call & its result among concurrent fetches with the same key
+func fetchShared(group *singleflight.Group, key string, fetch func() (int, error)) (int, error) {
+	result, err, _ := group.Do(key, func() (interface{}, error) {
+		return fetch()
+	})
+	value, _ := result.(int)
+	return value, err
+}
+
+// resultFetch represents the fetch of the result of the badge requested from a provider
+type resultFetch struct {
+	service     string
+	method      string
+	results     *resultCache
+	staleValues *staleValueCache
+	// key identifies the data fetched for the badge requested, as returned by `fetchKey`
+	key string
+	// uncached is whether the result is neither served from nor stored in the caches (eg. data fetched with the token
+	// of the request query)
+	uncached bool
+	// isFinal returns whether the error is answered as is by the provider, without falling back on stale data (eg.
+	// data that doesn't exist)
+	isFinal func(err error) bool
+}
+
+// fetchResult returns the result of the badge requested. Data fetched within the Redis cache duration (eg. by another
+// instance) is served without fetching it again, fetched data is cached, & the last successfully fetched data is served
+// while the upstream API is unavailable, in which case the result is stale. On errors, the result returned by `fetch`
+// is returned along with the error (eg. to render its subject).
+func fetchResult(r *http.Request, logger *zap.Logger, fetch resultFetch, fetchData func() (cachedResult, error)) (cachedResult, error) {
+	// Stale data is kept by result, as the data is formatted differently by some query parameters (eg. `display`)
+	staleKey := fetch.key + resultKeySuffix(r)
+	if !fetch.uncached {
+		if cached, ok := fetch.results.get(r.Context(), resultKey(r)); ok {
+			fetch.staleValues.set(staleKey, staleValueOf(cached))
+			return cached, nil
+		}
+	}
+
+	result, err := fetchData()
+	var errBadge *errorBadge
+	if errors.As(err, &errBadge) || (err != nil && fetch.isFinal != nil && fetch.isFinal(err)) {
+		return result, err
+	}
+	if err != nil {
+		// Fall back on the last successfully fetched data while the upstream API is unavailable
+		stale, ok := fetch.staleValues.get(r.Context(), staleKey)
+		if !ok {
+			return result, err
+		}
+		logger.Warn("Failed to fetch data, serving stale data",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", fetch.service),
+			zap.String("method", fetch.method),
+			zap.Time("fetchedAt", stale.fetchedAt),
+			zap.Error(err))
+		result.Value, result.Truncated, result.Status, result.Color = stale.value, stale.truncated, stale.status, stale.color
+		result.Segments = stale.segments
+		if stale.subject != "" {
+			result.Subject = stale.subject
+		}
+		result.stale = true
+		return result, nil
+	}
+
+	if !fetch.uncached {
+		fetch.staleValues.set(staleKey, staleValueOf(result))
+		fetch.results.set(r.Context(), resultKey(r), result)
+	}
+	return result, nil
+}
+
+// badgeFetcher represents a metric service fetching the data of its badges from an upstream API, called by both its
+// HTTP handler & the CLI
+type badgeFetcher interface {
+	// fetchBadge fetches the result of the badge of the metric requested, returning an *errorBadge for badges that
+	// can't be served (eg. an unsupported query parameter value, or a repository that doesn't exist)
+	fetchBadge(r *http.Request) (cachedResult, error)
+	// badgeParams returns the parameters of the badge of the metric requested rendered from its result, before the
+	// badge options of the request query apply
+	badgeParams(r *http.Request, result cachedResult) (*badge.Params, error)
+}
+
+// fetchBadgeParams fetches the result of the badge requested & returns the parameters of the badge rendered from it,
+// overwritten by the badge options of the request query, along with the result
+func fetchBadgeParams(r *http.Request, configuration *config.Config, fetcher badgeFetcher) (*badge.Params, cachedResult, error) {
+	result, err := fetcher.fetchBadge(r)
+	if err != nil {
+		return nil, result, err
+	}
+	params, err := fetcher.badgeParams(r, result)
+	if err != nil {
+		return nil, result, err
+	}
+	if err := parseBadgeQuery(configuration, params, r.URL.Query()); err != nil {
+		return nil, result, err
+	}
+	return params, result, nil
+}
+
+// serveBadge responds to the request with the badge of the metric requested, fetched by the metric service
+func serveBadge(w http.ResponseWriter, r *http.Request, logger *zap.Logger, configuration *config.Config, service string, fetcher badgeFetcher) {
+	logger = requestLogger(logger, r)
+	method := mux.Vars(r)["method"]
+	badgeParams, result, err := fetchBadgeParams(r, configuration, fetcher)
+	if err != nil {
+		writeBadgeError(w, r, logger, configuration, service, method, err)
+		return
+	}
+
+	// Generate badge
+	if result.stale {
+		err = writeStaleBadge(w, r, configuration, badgeParams)
+	} else {
+		query := r.URL.Query()
+		if result.cacheSeconds > 0 {
+			query.Set("cacheSeconds", strconv.FormatUint(uint64(result.cacheSeconds), 10))
+		}
+		err = writeBadge(w, r, configuration, query, badgeParams)
+	}
+	if err != nil {
+		logger.Error("Failed to create badge",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service),
+			zap.String("method", method),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// writeBadgeError responds to the request with the error badge of the badge requested, or with the JSON description
+// of its invalid badge option
+func writeBadgeError(w http.ResponseWriter, r *http.Request, logger *zap.Logger, configuration *config.Config, service string, method string, err error) {
+	var errBadge *errorBadge
+	var queryErr *badgeQueryError
+	switch {
+	case errors.As(err, &errBadge):
+		logger.Info("Failed to serve badge",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service),
+			zap.String("method", method),
+			zap.Error(err))
+		if err := errBadge.respond(w, configuration); err != nil {
+			logger.Error("Failed to create error badge",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service),
+				zap.String("method", method),
+				zap.Error(err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	case errors.As(err, &queryErr):
+		logger.Info("Invalid badge query",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service),
+			zap.String("method", method),
+			zap.Error(err))
+		if err := invalidBadgeQuery(w, configuration, err); err != nil {
+			logger.Error("Failed to create error response",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service),
+				zap.String("method", method),
+				zap.Error(err))
+		}
+	default:
+		writeFetchError(w, r, logger, configuration, service, method, err)
+	}
+}
+
+// writeFetchError responds to the request with the error badge of the failed fetch of its data
+func writeFetchError(w http.ResponseWriter, r *http.Request, logger *zap.Logger, configuration *config.Config, service string, method string, err error) {
+	var badgeErr error
+	switch {
+	case isUpstreamRateLimited(err):
+		logger.Warn("Upstream API rate limit exhausted",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service),
+			zap.String("method", method),
+			zap.Error(err))
+		badgeErr = rateLimited(w, configuration)
+	case isUpstreamSaturated(err):
+		logger.Warn("Too many concurrent upstream API calls",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service),
+			zap.String("method", method),
+			zap.Error(err))
+		badgeErr = upstreamSaturated(w, configuration)
+	default:
+		logger.Error("Failed to fetch data",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service),
+			zap.String("method", method),
+			zap.Error(err))
+		badgeErr = internalServerError(w, configuration)
+	}
+	if badgeErr != nil {
+		logger.Error("Failed to create error badge",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service),
+			zap.String("method", method),
+			zap.Error(badgeErr))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// labelsFromQuery returns the labels that issues & pull requests must all be labelled with, as set by the repeatable
+// `label` query parameter
+func labelsFromQuery(query url.Values) []string {
+	var labels []string
+	for _, label := range query["label"] {
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestFetchKey(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		url      string
+		expected string
+	}{
+		{"/github/stars/google/gopacket", "stars/google/gopacket?"},
+		{"/github/issues/google/gopacket?state=open&color=red", "issues/google/gopacket?state=open"},
+		{"/github/review-load/google/gopacket?reviewer=octocat&state=", "review-load/google/gopacket?reviewer=octocat"},
+		{"/github/license-check/google/gopacket?allow=MIT,Apache-2.0&style=flat", "license-check/google/gopacket?allow=MIT%2CApache-2.0"},
+		{"/github/issues/google/gopacket?label=bug&label=&label=ci", "issues/google/gopacket?label=bug&label=ci"},
+		{"/github/downloads/google/gopacket/v1.1.19", "downloads/google/gopacket/v1.1.19?"},
+		{"/github/milestone/google/gopacket/3?color=red", "milestone/google/gopacket/3?"},
+		{"/github/org/google/stars", "org/stars/google/?"},
+		{"/github/workflow/google/gopacket/ci.yml?branch=main&event=push", "workflow/google/gopacket/ci.yml?branch=main&event=push"},
+		{"/azure/commits/contoso/fabrikam/web?branch=main", "commits/contoso/fabrikam/web?branch=main"},
+		{"/npm/downloads/@babel%2Fcore?period=monthly", "downloads/@babel%2Fcore/?period=monthly"},
+	}
+
+	for _, testCase := range testCases {
+		var key string
+		router := mux.NewRouter()
+		router.UseEncodedPath()
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			key = fetchKey(r)
+		}
+		router.HandleFunc(`/github/{account:org}/{owner}/{method:stars}`, handler)
+		router.HandleFunc(`/github/{method}/{owner}/{repo}`, handler)
+		router.HandleFunc(`/github/{method:downloads}/{owner}/{repo}/{tag}`, handler)
+		router.HandleFunc(`/github/{method:milestone}/{owner}/{repo}/{number}`, handler)
+		router.HandleFunc(`/github/{method:workflow}/{owner}/{repo}/{workflow}`, handler)
+		router.HandleFunc(`/azure/{method}/{organization}/{project}/{repo}`, handler)
+		router.HandleFunc(`/npm/{method}/{package}`, handler)
+		req, _ := http.NewRequest("GET", testCase.url, nil)
+		router.ServeHTTP(nil, req)
+		assert.Equal(t, testCase.expected, key)
+	}
+}
+
+func TestFetchResultKeepsStaleDataByResult(t *testing.T) {
+	t.Parallel()
+
+	fetch := resultFetch{service: "github", method: "age", staleValues: newStaleValueCache("github", staleValueRetention, staleValueCacheSize)}
+	fetchURL := func(url string, fetchData func() (cachedResult, error)) (cachedResult, error) {
+		var result cachedResult
+		var err error
+		router := mux.NewRouter()
+		router.HandleFunc(`/github/{method}/{owner}/{repo}`, func(w http.ResponseWriter, r *http.Request) {
+			fetch.key = fetchKey(r)
+			result, err = fetchResult(r, zap.NewNop(), fetch, fetchData)
+		})
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(nil, req)
+		return result, err
+	}
+	upstreamErr := errors.New("upstream API is unavailable")
+
+	_, err := fetchURL("/github/age/google/gopacket?display=date", func() (cachedResult, error) {
+		return cachedResult{Subject: "created", Status: "2014-02-25"}, nil
+	})
+	assert.NoError(t, err)
+
+	// the stale data of a badge is only served to badges formatting the data the same way
+	result, err := fetchURL("/github/age/google/gopacket?display=date&style=flat", func() (cachedResult, error) {
+		return cachedResult{}, upstreamErr
+	})
+	assert.NoError(t, err)
+	assert.True(t, result.stale)
+	assert.Equal(t, "2014-02-25", result.Status)
+
+	result, err = fetchURL("/github/age/google/gopacket", func() (cachedResult, error) {
+		return cachedResult{}, upstreamErr
+	})
+	assert.Equal(t, upstreamErr, err)
+	assert.False(t, result.stale)
+}
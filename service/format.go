@@ -0,0 +1,181 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+)
+
+// badgeFormat represents a format that badges are rendered in
+type badgeFormat string
+
+const (
+	svgBadgeFormat  badgeFormat = "svg"
+	pngBadgeFormat  badgeFormat = "png"
+	jsonBadgeFormat badgeFormat = "json"
+)
+
+// badgeFormats represents the formats of badges, by order of preference between formats accepted equally by the
+// `Accept` request header
+var badgeFormats = []badgeFormat{svgBadgeFormat, pngBadgeFormat, jsonBadgeFormat}
+
+// mediaType returns the media type of badges of the format, as matched against the `Accept` request header
+func (format badgeFormat) mediaType() string {
+	switch format {
+	case pngBadgeFormat:
+		return "image/png"
+	case jsonBadgeFormat:
+		return "application/json"
+	default:
+		return "image/svg+xml"
+	}
+}
+
+// contentType returns the `Content-Type` header of badges of the format
+func (format badgeFormat) contentType() string {
+	if format == svgBadgeFormat {
+		return "image/svg+xml;utf-8"
+	}
+	return format.mediaType()
+}
+
+// parseBadgeFormat returns the badge format of the name set in the `format` query parameter, if supported
+func parseBadgeFormat(name string) (badgeFormat, bool) {
+	for _, format := range badgeFormats {
+		if string(format) == name {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// acceptQuality returns the quality value of the most specific media range of the `Accept` request header matching
+// the media type, or 0 if none matches
+func acceptQuality(accept string, mediaType string) float64 {
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		rangeType := strings.ToLower(strings.TrimSpace(params[0]))
+
+		var rangeSpecificity int
+		switch {
+		case rangeType == mediaType:
+			rangeSpecificity = 2
+		case strings.HasSuffix(rangeType, "/*") && rangeType != "*/*" && strings.HasPrefix(mediaType, strings.TrimSuffix(rangeType, "*")):
+			rangeSpecificity = 1
+		case rangeType == "*/*":
+			rangeSpecificity = 0
+		default:
+			continue
+		}
+		if rangeSpecificity <= specificity {
+			continue
+		}
+
+		rangeQuality := 1.0
+		for _, param := range params[1:] {
+			if name, value, ok := cutString(strings.TrimSpace(param), "="); ok && strings.ToLower(name) == "q" {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					rangeQuality = q
+				}
+			}
+		}
+		quality, specificity = rangeQuality, rangeSpecificity
+	}
+	return quality
+}
+
+// cutString slices the string around the first instance of the separator
+func cutString(s string, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// negotiateBadgeFormat returns the badge format preferred by the `Accept` request header, SVG unless the header
+// prefers another format (eg. `image/png`)
+func negotiateBadgeFormat(accept string) badgeFormat {
+	preferred, preferredQuality := svgBadgeFormat, 0.0
+	if accept == "" {
+		return preferred
+	}
+	for _, format := range badgeFormats {
+		if quality := acceptQuality(accept, format.mediaType()); quality > preferredQuality {
+			preferred, preferredQuality = format, quality
+		}
+	}
+	return preferred
+}
+
+// requestBadgeFormat returns the format of the badge requested, as set in the `format` query parameter or otherwise
+// negotiated with the `Accept` request header, along with whether it was negotiated
+func requestBadgeFormat(r *http.Request) (badgeFormat, bool) {
+	if format, ok := parseBadgeFormat(r.URL.Query().Get("format")); ok {
+		return format, false
+	}
+	return negotiateBadgeFormat(r.Header.Get("Accept")), true
+}
+
+// badgeJSON represents a badge rendered in the JSON format, for clients displaying the data of badges themselves
+type badgeJSON struct {
+	Subject    string             `json:"subject"`
+	Status     string             `json:"status"`
+	Color      string             `json:"color,omitempty"`
+	LabelColor string             `json:"labelColor,omitempty"`
+	Segments   []badgeSegmentJSON `json:"segments,omitempty"`
+}
+
+// badgeSegmentJSON represents a segment of a badge rendered in the JSON format
+type badgeSegmentJSON struct {
+	Text  string `json:"text"`
+	Color string `json:"color,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// formattedBadge represents a badge rendered in a format, along with its dimensions for image formats
+type formattedBadge struct {
+	body []byte
+	size *badge.Size
+}
+
+// renderBadgeFormat renders the badge parameters in the format
+func renderBadgeFormat(ctx context.Context, format badgeFormat, params *badge.Params) (*formattedBadge, error) {
+	switch format {
+	case svgBadgeFormat:
+		generatedBadge, size, err := renderBadge(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		return &formattedBadge{body: []byte(generatedBadge), size: &size}, nil
+	case pngBadgeFormat:
+		var buf bytes.Buffer
+		if err := badge.RenderPNG(&buf, params); err != nil {
+			return nil, err
+		}
+		config, err := png.DecodeConfig(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		return &formattedBadge{body: buf.Bytes(), size: &badge.Size{Width: config.Width, Height: config.Height}}, nil
+	case jsonBadgeFormat:
+		response := badgeJSON{Subject: params.Subject, Status: params.Status, Color: params.Color, LabelColor: params.LabelColor}
+		for _, segment := range params.Segments {
+			response.Segments = append(response.Segments, badgeSegmentJSON{Text: segment.Text, Color: segment.Color, Label: segment.Label})
+		}
+		body, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+		return &formattedBadge{body: body}, nil
+	default:
+		return nil, fmt.Errorf("unsupported badge format: %s", format)
+	}
+}
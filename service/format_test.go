@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+func TestNegotiateBadgeFormat(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		accept   string
+		expected badgeFormat
+	}{
+		{"", svgBadgeFormat},
+		{"*/*", svgBadgeFormat},
+		{"text/html", svgBadgeFormat},
+		{"image/png", pngBadgeFormat},
+		{"application/json", jsonBadgeFormat},
+		{"image/*", svgBadgeFormat},
+		{"image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", svgBadgeFormat},
+		{"image/webp,image/png,*/*;q=0.8", pngBadgeFormat},
+		{"image/svg+xml;q=0.5, image/png", pngBadgeFormat},
+		{"image/*;q=0.9, application/json", jsonBadgeFormat},
+		{"image/*, image/svg+xml;q=0", pngBadgeFormat},
+		{"Application/JSON; Q=0.9, */*;q=0.1", jsonBadgeFormat},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, negotiateBadgeFormat(testCase.accept), testCase.accept)
+	}
+}
+
+func TestRenderBadgeFormat(t *testing.T) {
+	t.Parallel()
+
+	params := &badge.Params{Subject: "stars", Status: "1.23k", Color: "green"}
+
+	svg, err := renderBadgeFormat(newTestRequest("/").Context(), svgBadgeFormat, params)
+	if assert.NoError(t, err) {
+		assert.Equal(t, createBadge(params), string(svg.body))
+		assert.NotNil(t, svg.size)
+	}
+
+	image, err := renderBadgeFormat(newTestRequest("/").Context(), pngBadgeFormat, params)
+	if assert.NoError(t, err) {
+		decoded, err := png.Decode(bytes.NewReader(image.body))
+		if assert.NoError(t, err) && assert.NotNil(t, image.size) {
+			assert.Equal(t, image.size.Width, decoded.Bounds().Dx())
+			assert.Equal(t, image.size.Height, decoded.Bounds().Dy())
+		}
+	}
+
+	json, err := renderBadgeFormat(newTestRequest("/").Context(), jsonBadgeFormat, &badge.Params{
+		Subject:  "repo",
+		Segments: []badge.Segment{{Text: "stars 1.23k", Color: "green", Label: "stars: 1.23k"}},
+	})
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"subject":"repo","status":"","segments":[{"text":"stars 1.23k","color":"green","label":"stars: 1.23k"}]}`, string(json.body))
+		assert.Nil(t, json.size)
+	}
+}
+
+// newTestRequest returns a GET request of the path
+func newTestRequest(path string) *http.Request {
+	req, _ := http.NewRequest("GET", path, nil)
+	return req
+}
+
+func TestWriteBadgeByFormat(t *testing.T) {
+	t.Parallel()
+
+	configuration := &config.Config{CacheSeconds: 3600, MinCacheSeconds: 300, MaxCacheSeconds: 86400}
+	params := &badge.Params{Subject: "stars", Status: "1.23k"}
+	writers := map[string]func(w http.ResponseWriter, r *http.Request) error{
+		"fetched": func(w http.ResponseWriter, r *http.Request) error {
+			return writeBadge(w, r, configuration, r.URL.Query(), params)
+		},
+		"static": func(w http.ResponseWriter, r *http.Request) error {
+			return writeStaticBadge(w, r, configuration, r.URL.Query(), params)
+		},
+		"stale": func(w http.ResponseWriter, r *http.Request) error {
+			return writeStaleBadge(w, r, configuration, params)
+		},
+	}
+	const staleCacheControl = "public, max-age=300, s-maxage=300, stale-while-revalidate=86400"
+
+	testCases := []struct {
+		name                 string
+		writer               string
+		query                string
+		accept               string
+		expectedContentType  string
+		expectedCacheControl string
+		expectedVary         []string
+		expectedSize         bool
+	}{
+		{"SVG", "fetched", "", "", "image/svg+xml;utf-8", "public, max-age=3600, s-maxage=3600", []string{"Accept"}, true},
+		{"ExplicitSVG", "fetched", "?format=svg", "image/png", "image/svg+xml;utf-8", "public, max-age=3600, s-maxage=3600", nil, true},
+		{"NegotiatedPNG", "fetched", "", "image/png", "image/png", "public, max-age=3600, s-maxage=3600", []string{"Accept"}, true},
+		{"ExplicitPNG", "fetched", "?format=png", "", "image/png", "public, max-age=3600, s-maxage=3600", nil, true},
+		{"NegotiatedJSON", "fetched", "", "application/json", "application/json", "public, max-age=0, s-maxage=3600, must-revalidate", []string{"Accept"}, false},
+		{"ExplicitJSON", "fetched", "?format=json", "", "application/json", "public, max-age=0, s-maxage=3600, must-revalidate", nil, false},
+		{"StaticSVG", "static", "", "", "image/svg+xml;utf-8", "public, max-age=3600, s-maxage=3600", []string{"Accept"}, true},
+		{"StaticExplicitSVG", "static", "?format=svg", "", "image/svg+xml;utf-8", "public, max-age=3600, s-maxage=3600", nil, true},
+		{"StaticNegotiatedPNG", "static", "", "image/png", "image/png", "public, max-age=3600, s-maxage=3600, immutable", []string{"Accept"}, true},
+		{"StaticExplicitPNG", "static", "?format=png", "", "image/png", "public, max-age=3600, s-maxage=3600, immutable", nil, true},
+		{"StaticNegotiatedJSON", "static", "", "application/json", "application/json", "public, max-age=0, s-maxage=3600, must-revalidate", []string{"Accept"}, false},
+		{"StaticExplicitJSON", "static", "?format=json", "", "application/json", "public, max-age=0, s-maxage=3600, must-revalidate", nil, false},
+		{"StaleSVG", "stale", "", "", "image/svg+xml;utf-8", staleCacheControl, []string{"Accept"}, true},
+		{"StaleExplicitSVG", "stale", "?format=svg", "", "image/svg+xml;utf-8", staleCacheControl, nil, true},
+		{"StaleNegotiatedPNG", "stale", "", "image/png", "image/png", staleCacheControl, []string{"Accept"}, true},
+		{"StaleExplicitPNG", "stale", "?format=png", "", "image/png", staleCacheControl, nil, true},
+		{"StaleNegotiatedJSON", "stale", "", "application/json", "application/json", staleCacheControl, []string{"Accept"}, false},
+		{"StaleExplicitJSON", "stale", "?format=json", "", "application/json", staleCacheControl, nil, false},
+	}
+
+	etags := map[string]string{}
+	for _, testCase := range testCases {
+		req := newTestRequest("/static" + testCase.query)
+		if testCase.accept != "" {
+			req.Header.Set("Accept", testCase.accept)
+		}
+		res := httptest.NewRecorder()
+		assert.NoError(t, writers[testCase.writer](res, req), testCase.name)
+
+		assert.Equal(t, http.StatusOK, res.Code, testCase.name)
+		assert.Equal(t, testCase.expectedContentType, res.Header().Get("Content-Type"), testCase.name)
+		assert.Equal(t, testCase.expectedCacheControl, res.Header().Get("Cache-Control"), testCase.name)
+		assert.Equal(t, testCase.expectedVary, res.Header()["Vary"], testCase.name)
+		assert.Equal(t, testCase.expectedSize, res.Header().Get(badgeWidthHeader) != "", testCase.name)
+		assert.Regexp(t, `^"[0-9a-f]{64}"$`, res.Header().Get("ETag"), testCase.name)
+
+		// badges of different formats have different entity tags, whether the format is explicit or negotiated
+		etag := res.Header().Get("ETag")
+		if previous, ok := etags[testCase.expectedContentType]; ok {
+			assert.Equal(t, previous, etag, testCase.name)
+		}
+		etags[testCase.expectedContentType] = etag
+
+		// responses to conditional requests vary on the `Accept` request header too
+		conditionalReq := newTestRequest("/static" + testCase.query)
+		conditionalReq.Header.Set("Accept", testCase.accept)
+		conditionalReq.Header.Set("If-None-Match", etag)
+		notModified := httptest.NewRecorder()
+		assert.NoError(t, writers[testCase.writer](notModified, conditionalReq), testCase.name)
+		assert.Equal(t, http.StatusNotModified, notModified.Code, testCase.name)
+		assert.Equal(t, testCase.expectedVary, notModified.Header()["Vary"], testCase.name)
+		assert.Equal(t, testCase.expectedCacheControl, notModified.Header().Get("Cache-Control"), testCase.name)
+	}
+	assert.Len(t, etags, 3)
+	assert.NotEqual(t, etags["image/png"], etags["image/svg+xml;utf-8"])
+	assert.NotEqual(t, etags["application/json"], etags["image/svg+xml;utf-8"])
+}
+
+func TestStaticBadgeServiceWithInvalidFormat(t *testing.T) {
+	t.Parallel()
+
+	runHTTPTest(t, httpTestCase{
+		requestMethod:  "GET",
+		requestPath:    "/static?subject=stars&status=1234&format=gif",
+		expectedStatus: 400,
+		expectedBody:   `{"parameter":"format","error":"not svg, png or json"}`,
+	})
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+type giteaService struct {
+	name        string
+	baseURL     string
+	config      *config.Config
+	logger      *zap.Logger
+	httpClient  *http.Client
+	staleValues *staleValueCache
+	results     *resultCache
+	requests    singleflight.Group
+}
+
+type giteaRepositoryResponse struct {
+	ForksCount int `json:"forks_count"`
+	StarsCount int `json:"stars_count"`
+}
+
+// NewGiteaService returns a HTTP handler for the Gitea badge service, backed by the Gitea instance of the configured
+// base URL (eg. Codeberg)
+func NewGiteaService(configuration *config.Config, logger *zap.Logger) (GitProviderService, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	results, err := newResultCache(configuration, logger, "gitea")
+	if err != nil {
+		return nil, err
+	}
+	return &giteaService{
+		name:    "gitea",
+		baseURL: configuration.GiteaBaseURL + "/api/v1",
+		config:  configuration,
+		logger:  logger,
+		httpClient: newUpstreamClient(configuration, logger, "gitea", &rateLimitTransport{
+			base:    &giteaTokenTransport{base: upstreamTransport(configuration), token: configuration.GiteaAccessToken},
+			limiter: newRateLimiter("gitea"),
+		}),
+		staleValues: newStaleValueCache("gitea", staleValueRetention, staleValueCacheSize),
+		results:     results,
+	}, nil
+}
+
+// giteaTokenTransport authenticates Gitea API calls with the `Authorization: token <TOKEN>` header, Gitea API calls
+// are anonymous if no token is configured
+type giteaTokenTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (transport *giteaTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport.token == "" {
+		return transport.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+transport.token)
+	return transport.base.RoundTrip(req)
+}
+
+func (service *giteaService) fetch(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+
+	return resp, err
+}
+
+// fetchTotal returns the total number of items listed by the paginated API, read from the `X-Total-Count` header of
+// the response
+func (service *giteaService) fetchTotal(ctx context.Context, url string) (int, error) {
+	resp, err := service.fetch(ctx, url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return strconv.Atoi(resp.Header.Get("X-Total-Count"))
+}
+
+func (service *giteaService) getRepository(ctx context.Context, owner string, repo string) (*giteaRepositoryResponse, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s", service.baseURL, owner, repo)
+	resp, err := service.fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var repository giteaRepositoryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&repository); err != nil {
+		return nil, err
+	}
+
+	return &repository, nil
+}
+
+func (service *giteaService) getForkCount(ctx context.Context, owner string, repo string) (int, error) {
+	repository, err := service.getRepository(ctx, owner, repo)
+	if err != nil {
+		return 0, err
+	}
+	return repository.ForksCount, nil
+}
+
+// getIssueCount returns the number of issues in the state, or in any state if no state is set
+func (service *giteaService) getIssueCount(ctx context.Context, owner string, repo string, issueState string) (int, error) {
+	// Only open issues are listed unless a state is set, & pull requests are listed as issues unless excluded
+	if issueState == "" {
+		issueState = "all"
+	}
+	query := url.Values{"state": {issueState}, "type": {"issues"}, "limit": {"1"}}
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/issues?%s", service.baseURL, owner, repo, query.Encode())
+	return service.fetchTotal(ctx, apiURL)
+}
+
+// getPullRequestCount returns the number of pull requests in the state, or in any state if no state is set
+func (service *giteaService) getPullRequestCount(ctx context.Context, owner string, repo string, pullRequestState string) (int, error) {
+	// Only open pull requests are listed unless a state is set
+	if pullRequestState == "" {
+		pullRequestState = "all"
+	}
+	query := url.Values{"state": {pullRequestState}, "limit": {"1"}}
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/pulls?%s", service.baseURL, owner, repo, query.Encode())
+	return service.fetchTotal(ctx, apiURL)
+}
+
+func (service *giteaService) getStarCount(ctx context.Context, owner string, repo string) (int, error) {
+	repository, err := service.getRepository(ctx, owner, repo)
+	if err != nil {
+		return 0, err
+	}
+	return repository.StarsCount, nil
+}
+
+// SupportedMetrics returns the metrics served by the service
+func (service *giteaService) SupportedMetrics() []string {
+	return []string{"forks", "issues", "pull-requests", "stars"}
+}
+
+func (service *giteaService) supportedQueryParams() map[string][]badgeQueryParam {
+	return map[string][]badgeQueryParam{
+		"issues":        {{"state", "State of the issues (open or closed), defaults to every state", "open"}},
+		"pull-requests": {{"state", "State of the pull requests (open or closed), defaults to every state", "open"}},
+	}
+}
+
+func (service *giteaService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *giteaService) fetchBadge(r *http.Request) (cachedResult, error) {
+	routeVariables := mux.Vars(r)
+	owner := routeVariables["owner"]
+	repo := routeVariables["repo"]
+	method := routeVariables["method"]
+	ctx := upstreamContext(r)
+
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         fetchKey(r),
+		isFinal:     isUpstreamForbidden,
+	}
+	result, err := fetchResult(r, requestLogger(service.logger, r), fetch, func() (cachedResult, error) {
+		var result cachedResult
+		var err error
+		switch method {
+		case "forks":
+			result.Subject = "forks"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getForkCount(ctx, owner, repo)
+			})
+		case "issues", "pull-requests":
+			state := r.URL.Query().Get("state")
+			noun := "issues"
+			if method == "pull-requests" {
+				noun = "PRs"
+			}
+			switch state {
+			case "":
+				result.Subject = noun
+			case "open", "closed":
+				result.Subject = state + " " + noun
+			default:
+				return result, badRequestBadge
+			}
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				if method == "pull-requests" {
+					return service.getPullRequestCount(ctx, owner, repo, state)
+				}
+				return service.getIssueCount(ctx, owner, repo, state)
+			})
+		case "stars":
+			result.Subject = "stars"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getStarCount(ctx, owner, repo)
+			})
+		default:
+			return result, notFoundBadge
+		}
+		return result, err
+	})
+
+	// Data that is denied access to is never served, not even as stale data
+	if isUpstreamForbidden(err) {
+		return result, accessDeniedBadge
+	}
+	return result, err
+}
+
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *giteaService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	badgeParams := &badge.Params{Subject: result.Subject, Status: formatStatus(result.Value, r.URL.Query()), Sparkline: sparklineFromRequest(r)}
+	if err := parseColorRangesQuery(badgeParams, result.Value, r.URL.Query()); err != nil {
+		return nil, invalidQueryParameterBadge("colorRanges")
+	}
+	return badgeParams, nil
+}
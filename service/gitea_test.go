@@ -0,0 +1,147 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestGiteaService returns a router serving the Gitea badge service backed by a fake Gitea instance
+func newTestGiteaService(t *testing.T, configuration *config.Config, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+	configuration.GiteaBaseURL = fakeAPI.URL
+
+	service, err := NewGiteaService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.Handle(`/gitea/{method}/{owner}/{repo}`, service).Name("gitea")
+
+	return router, fakeAPI.Close
+}
+
+func TestGiteaServiceWithRepository(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"Forks", "/gitea/forks/forgejo/forgejo", &badge.Params{Subject: "forks", Status: "567"}},
+		{"Stars", "/gitea/stars/forgejo/forgejo", &badge.Params{Subject: "stars", Status: "1.23k"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGiteaService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/v1/repos/forgejo/forgejo", r.URL.Path)
+				w.Write([]byte(`{"full_name":"forgejo/forgejo","forks_count":567,"stars_count":1234}`))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGiteaServiceWithIssuesAndPullRequests(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		url           string
+		expectedPath  string
+		expectedState string
+		expectedType  string
+		expected      *badge.Params
+	}{
+		{"Issues", "/gitea/issues/forgejo/forgejo", "/api/v1/repos/forgejo/forgejo/issues", "all", "issues", &badge.Params{Subject: "issues", Status: "42"}},
+		{"OpenIssues", "/gitea/issues/forgejo/forgejo?state=open", "/api/v1/repos/forgejo/forgejo/issues", "open", "issues", &badge.Params{Subject: "open issues", Status: "42"}},
+		{"ClosedIssues", "/gitea/issues/forgejo/forgejo?state=closed", "/api/v1/repos/forgejo/forgejo/issues", "closed", "issues", &badge.Params{Subject: "closed issues", Status: "42"}},
+		{"PullRequests", "/gitea/pull-requests/forgejo/forgejo", "/api/v1/repos/forgejo/forgejo/pulls", "all", "", &badge.Params{Subject: "PRs", Status: "42"}},
+		{"OpenPullRequests", "/gitea/pull-requests/forgejo/forgejo?state=open", "/api/v1/repos/forgejo/forgejo/pulls", "open", "", &badge.Params{Subject: "open PRs", Status: "42"}},
+		{"ClosedPullRequests", "/gitea/pull-requests/forgejo/forgejo?state=closed", "/api/v1/repos/forgejo/forgejo/pulls", "closed", "", &badge.Params{Subject: "closed PRs", Status: "42"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGiteaService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, testCase.expectedPath, r.URL.Path)
+				assert.Equal(t, testCase.expectedState, r.URL.Query().Get("state"))
+				assert.Equal(t, testCase.expectedType, r.URL.Query().Get("type"))
+				assert.Equal(t, "1", r.URL.Query().Get("limit"))
+				w.Header().Set("X-Total-Count", "42")
+				w.Write([]byte(`[{"number":1}]`))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGiteaServiceWithUnsupportedState(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestGiteaService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected Gitea API call: %s", r.URL)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitea/pull-requests/forgejo/forgejo?state=merged", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestGiteaServiceWithAccessToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		configuration *config.Config
+		expected      string
+	}{
+		{"Anonymous", &config.Config{}, ""},
+		{"ConfiguredToken", &config.Config{GiteaAccessToken: "secret"}, "token secret"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var authorization string
+			router, cleanup := newTestGiteaService(t, testCase.configuration, func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				w.Write([]byte(`{"forks_count":42}`))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitea/forks/forgejo/forgejo", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, createBadge(&badge.Params{Subject: "forks", Status: "42"}), res.Body.String())
+			assert.Equal(t, testCase.expected, authorization)
+		})
+	}
+}
@@ -1,24 +1,374 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/shurcooL/githubv4"
 	"go.uber.org/zap"
-	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/tohjustin/aegis/pkg/badge"
 	"github.com/tohjustin/aegis/service/config"
 )
 
+const (
+	// githubAPIBaseURL represents the base URL of the GitHub REST API, for data that the GitHub GraphQL API doesn't
+	// expose
+	githubAPIBaseURL = "https://api.github.com"
+	// githubWebBaseURL represents the base URL of the GitHub website, for data that only its HTML pages expose
+	githubWebBaseURL = "https://github.com"
+	// githubDependentsCacheSeconds represents the default cache duration in seconds of the dependents badge, as
+	// scraping the dependents page is expensive
+	githubDependentsCacheSeconds = 6 * 60 * 60
+	// githubReleasePageSize represents the number of latest releases searched for the latest release that isn't a
+	// prerelease or a draft
+	githubReleasePageSize = 20
+	// githubReleasesPerPage represents the number of releases fetched per page when summing download counts (& of
+	// assets fetched per release when summing the download counts of a release)
+	githubReleasesPerPage = 100
+	// githubMaxReleasePages represents the maximum number of pages of releases fetched when summing download counts
+	githubMaxReleasePages = 10
+	// githubOrgRepositoriesPerPage represents the number of repositories fetched per page when summing the stars of
+	// an organization
+	githubOrgRepositoriesPerPage = 100
+	// githubMaxOrgRepositoryPages represents the maximum number of pages of repositories fetched when summing the
+	// stars of an organization
+	githubMaxOrgRepositoryPages = 10
+	// maxIssueBreakdownLabels represents the maximum number of labels of the issue breakdown badge, all fetched in a
+	// single GraphQL query
+	maxIssueBreakdownLabels = 8
+	// githubIssueBreakdownMaxWidth represents the default maximum width in pixels of the issue breakdown badge, which
+	// keeps as many labels as fit
+	githubIssueBreakdownMaxWidth = 500
+)
+
+var (
+	// errGithubBranchNotFound represents a branch that doesn't exist in a GitHub repository
+	errGithubBranchNotFound = errors.New("GitHub branch not found")
+	// errGithubReleaseNotFound represents a release tag that doesn't exist in a GitHub repository
+	errGithubReleaseNotFound = errors.New("GitHub release not found")
+	// errGithubMilestoneNotFound represents a milestone that doesn't exist in a GitHub repository
+	errGithubMilestoneNotFound = errors.New("GitHub milestone not found")
+	// errGithubDiscussionsDisabled represents a GitHub repository with GitHub Discussions disabled
+	errGithubDiscussionsDisabled = errors.New("GitHub Discussions is disabled")
+	// errGithubDiscussionCategoryNotFound represents a discussion category that doesn't exist in a GitHub repository
+	errGithubDiscussionCategoryNotFound = errors.New("GitHub discussion category not found")
+	// errGithubWorkflowNotFound represents a workflow that doesn't exist in a GitHub repository
+	errGithubWorkflowNotFound = errors.New("GitHub workflow not found")
+	// errGithubAccountNotFound represents a GitHub user or organization that doesn't exist
+	errGithubAccountNotFound = errors.New("GitHub account not found")
+	// errGithubRepositoryNotFound represents a GitHub repository that doesn't exist
+	errGithubRepositoryNotFound = errors.New("GitHub repository not found")
+	// errGithubVulnerabilitiesForbidden represents the Dependabot alerts of a GitHub repository that the access token
+	// isn't allowed to read
+	errGithubVulnerabilitiesForbidden = errors.New("GitHub vulnerability alerts forbidden")
+	// errGithubDependentsNotFound represents a GitHub dependents page missing the counts of dependents
+	errGithubDependentsNotFound = errors.New("GitHub dependent counts not found")
+
+	// githubDependentsPattern matches the counts of dependent repositories & packages in the tabs of the GitHub
+	// dependents page (eg. `</svg> 1,234 Repositories </a>`), whichever tab is selected
+	githubDependentsPattern = regexp.MustCompile(`(?i)>\s*([0-9][0-9,]*)\s+(repositor(?:y|ies)|packages?)\s*<`)
+)
+
+// githubLoginPattern matches valid GitHub user logins
+var githubLoginPattern = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9]|-[a-zA-Z0-9])*$`)
+
+// buildPullRequestSearchQuery builds a GitHub search query for the pull requests of a repository,
+// narrowed down by any additional search qualifiers
+func buildPullRequestSearchQuery(owner string, repo string, qualifiers ...string) string {
+	terms := append([]string{fmt.Sprintf("repo:%s/%s", owner, repo), "is:pr"}, qualifiers...)
+	return strings.Join(terms, " ")
+}
+
+// buildLabeledSearchQuery builds a GitHub search query for the issues or pull requests (depending on the type
+// qualifier, eg. "is:issue") of a repository in the state, labelled with every label
+func buildLabeledSearchQuery(owner string, repo string, typeQualifier string, state string, labels []string) string {
+	qualifiers := []string{typeQualifier}
+	if state != "" {
+		qualifiers = append(qualifiers, "is:"+state)
+	}
+	// Closed pull requests are counted apart from merged ones, same as the `pullRequests` connection
+	if typeQualifier == "is:pr" && state == "closed" {
+		qualifiers = append(qualifiers, "is:unmerged")
+	}
+	for _, label := range labels {
+		// Labels are quoted so that labels with spaces are searched as a whole
+		qualifiers = append(qualifiers, fmt.Sprintf(`label:"%s"`, strings.Replace(label, `"`, "", -1)))
+	}
+	terms := append([]string{fmt.Sprintf("repo:%s/%s", owner, repo)}, qualifiers...)
+	return strings.Join(terms, " ")
+}
+
+// buildReviewLoadSearchQuery builds a GitHub search query for the open pull requests awaiting review,
+// scoped to the review requests of a single reviewer if provided
+func buildReviewLoadSearchQuery(owner string, repo string, reviewer string) string {
+	if reviewer != "" {
+		return buildPullRequestSearchQuery(owner, repo, "is:open", "review-requested:"+reviewer)
+	}
+	return buildPullRequestSearchQuery(owner, repo, "is:open", "review:none")
+}
+
+// versionStatus returns the badge status & color of the release or tag name, an empty name represents a repository
+// without any release or tag
+func versionStatus(name string) (string, string) {
+	if name == "" {
+		return "none", "lightgrey"
+	}
+	return name, "blue"
+}
+
+// parseLastPage returns the page number of the last page linked by the `Link` header of a paginated GitHub REST API
+// response, returns false if the header doesn't link to a last page
+func parseLastPage(link string) (int, bool) {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(part, ";")
+		target := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		isLast := false
+		for _, param := range segments[1:] {
+			if strings.TrimSpace(param) == `rel="last"` {
+				isLast = true
+			}
+		}
+		if !isLast {
+			continue
+		}
+
+		targetURL, err := url.Parse(strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">"))
+		if err != nil {
+			return 0, false
+		}
+		page, err := strconv.Atoi(targetURL.Query().Get("page"))
+		if err != nil || page < 1 {
+			return 0, false
+		}
+		return page, true
+	}
+	return 0, false
+}
+
+// getListPage fetches a page of a paginated GitHub REST API listing, returning the page along with the number of the
+// last page linked by its `Link` header (ie. its own number if the listing fits in a single page)
+func (service *githubService) getListPage(ctx context.Context, apiURL string, page int, notFoundErr error) (json.RawMessage, int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s&page=%d", apiURL, page), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, 0, notFoundErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, 0, err
+	}
+	lastPage, ok := parseLastPage(resp.Header.Get("Link"))
+	if !ok {
+		lastPage = page
+	}
+	return body, lastPage, nil
+}
+
+// getListPages fetches the pages of a paginated GitHub REST API listing, up to `maxPages` pages. The first page links
+// to the last page, so the remaining pages are fetched concurrently by page number. Returns the pages in order, &
+// whether the pages beyond `maxPages` were skipped.
+func (service *githubService) getListPages(ctx context.Context, apiURL string, maxPages int, notFoundErr error) ([]json.RawMessage, bool, error) {
+	firstPage, lastPage, err := service.getListPage(ctx, apiURL, 1, notFoundErr)
+	if err != nil {
+		return nil, false, err
+	}
+
+	pageCount := lastPage
+	if pageCount > maxPages {
+		pageCount = maxPages
+	}
+	pages := make([]json.RawMessage, pageCount)
+	pages[0] = firstPage
+	err = fanOut(ctx, maxFanOutWorkers, pageCount-1, func(ctx context.Context, i int) error {
+		page, _, err := service.getListPage(ctx, apiURL, i+2, notFoundErr)
+		pages[i+1] = page
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return pages, lastPage > maxPages, nil
+}
+
+// lastCommitStatus returns the badge status & color of the last commit date, displayed relative to now or as a
+// date, & colored by freshness. A zero date represents a repository without any commits.
+func lastCommitStatus(committedAt time.Time, display string, now time.Time) (string, string) {
+	if committedAt.IsZero() {
+		return "none", "lightgrey"
+	}
+
+	status := formatRelativeTime(committedAt, now)
+	if display == "date" {
+		status = strings.ToLower(committedAt.UTC().Format("January 2006"))
+	}
+	switch age := now.Sub(committedAt); {
+	case age < 30*24*time.Hour:
+		return status, "green"
+	case age < 365*24*time.Hour:
+		return status, "yellow"
+	default:
+		return status, "red"
+	}
+}
+
+// ageStatus returns the badge status & color of the creation date of a repository, displayed as its age or as a date
+func ageStatus(createdAt time.Time, display string, now time.Time) (string, string) {
+	if display == "date" {
+		return strings.ToLower(createdAt.UTC().Format("January 2006")), "blue"
+	}
+	return formatAge(createdAt, now), "blue"
+}
+
+// githubRepositoryState represents whether a GitHub repository is archived (read-only) or disabled (by GitHub)
+type githubRepositoryState struct {
+	IsArchived bool
+	IsDisabled bool
+}
+
+// repositoryStatus returns the badge status & color of the maintenance status of a repository
+func repositoryStatus(state githubRepositoryState) (string, string) {
+	switch {
+	case state.IsDisabled:
+		return "disabled", "red"
+	case state.IsArchived:
+		return "archived", "grey"
+	default:
+		return "active", "green"
+	}
+}
+
+// githubWorkflowRun represents a run of a GitHub Actions workflow
+type githubWorkflowRun struct {
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+}
+
+// workflowStatus returns the badge status & color of the latest run of a workflow, a nil run represents a workflow
+// that never ran
+func workflowStatus(run *githubWorkflowRun) (string, string) {
+	if run == nil {
+		return "no runs", "lightgrey"
+	}
+	// Runs are queued, in progress or waiting until completed
+	if run.Status != "completed" {
+		return "running", "yellow"
+	}
+	switch run.Conclusion {
+	case "success":
+		return "passing", "green"
+	case "failure", "timed_out", "startup_failure":
+		return "failing", "red"
+	case "cancelled", "skipped":
+		return run.Conclusion, "grey"
+	default:
+		return run.Conclusion, "lightgrey"
+	}
+}
+
+// githubLanguage represents the dominant language of a GitHub repository
+type githubLanguage struct {
+	name  string
+	color string
+	// share represents the share of the bytes of code written in the language, from 0 to 1
+	share float64
+}
+
+// languageStatus returns the badge status & color of the dominant language, colored by its GitHub color. A language
+// without name represents a repository without any detected language.
+func languageStatus(language githubLanguage, withShare bool) (string, string) {
+	if language.name == "" {
+		return "unknown", "lightgrey"
+	}
+
+	status := language.name
+	if withShare {
+		status += " " + strconv.FormatFloat(language.share*100, 'f', 1, 64) + "%"
+	}
+	color := language.color
+	if color == "" {
+		color = "blue"
+	}
+	return status, color
+}
+
+// githubMilestone represents the progress of a GitHub milestone
+type githubMilestone struct {
+	title            string
+	closed           bool
+	openIssueCount   int
+	closedIssueCount int
+}
+
+// milestoneStatus returns the badge status & color of the milestone progress, shifting to green as the milestone
+// nears completion
+func milestoneStatus(milestone githubMilestone) (string, string) {
+	if milestone.closed {
+		return "closed", "lightgrey"
+	}
+
+	total := milestone.openIssueCount + milestone.closedIssueCount
+	percentage := 0
+	if total > 0 {
+		percentage = milestone.closedIssueCount * 100 / total
+	}
+	status := fmt.Sprintf("%d/%d (%d%%)", milestone.closedIssueCount, total, percentage)
+	switch {
+	case total > 0 && milestone.openIssueCount == 0:
+		return status, "brightgreen"
+	case percentage >= 75:
+		return status, "green"
+	case percentage >= 50:
+		return status, "yellowgreen"
+	case percentage >= 25:
+		return status, "yellow"
+	default:
+		return status, "orange"
+	}
+}
+
 type githubService struct {
-	name   string
-	client *githubv4.Client
-	config *config.Config
-	logger *zap.Logger
+	name        string
+	baseURL     string
+	graphqlURL  string
+	webBaseURL  string
+	client      *githubv4.Client
+	httpClient  *http.Client
+	webClient   *http.Client
+	config      *config.Config
+	logger      *zap.Logger
+	staleValues *staleValueCache
+	results     *resultCache
+	requests    singleflight.Group
+	now         func() time.Time
 }
 
 // NewGithubService returns a HTTP handler for the Github badge service
@@ -31,109 +381,220 @@ func NewGithubService(configuration *config.Config,
 		return nil, fmt.Errorf("missing logger dependency")
 	}
 
-	accessToken := configuration.GithubAccessToken
-	if accessToken == "" {
+	var tokens []string
+	if configuration.GithubAccessToken != "" {
+		tokens = append(tokens, configuration.GithubAccessToken)
+	}
+	for _, token := range configuration.GithubAccessTokens {
+		if token != configuration.GithubAccessToken {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 && !configuration.GithubAllowUnauthenticated {
 		return nil, fmt.Errorf("missing GitHub access token")
 	}
 
 	// Create new Github GraphQL client
-	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken})
-	httpClient := oauth2.NewClient(context.Background(), tokenSource)
+	tokenPool := newGithubTokenPool(tokens, configuration.GithubAllowUnauthenticated)
+	ledger, err := newGithubQuotaLedger(configuration)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := newUpstreamClient(configuration, logger, "github", &githubTokenTransport{base: upstreamTransport(configuration), pool: tokenPool, ledger: ledger})
+
+	// GitHub Enterprise Server serves the GraphQL API next to the REST API (eg. `/api/graphql` & `/api/v3`), under
+	// the website
+	baseURL, graphqlURL, webBaseURL := githubAPIBaseURL, githubAPIBaseURL+"/graphql", githubWebBaseURL
+	client := githubv4.NewClient(httpClient)
+	if configuration.GithubAPIBaseURL != "" {
+		baseURL = strings.TrimSuffix(configuration.GithubAPIBaseURL, "/")
+		graphqlURL = strings.TrimSuffix(baseURL, "/v3") + "/graphql"
+		webBaseURL = strings.TrimSuffix(baseURL, "/api/v3")
+		client = githubv4.NewEnterpriseClient(graphqlURL, httpClient)
+	}
+	// Access tokens of the API are never sent to the website
+	webClient := newUpstreamClient(configuration, logger, "github", upstreamTransport(configuration))
 
+	results, err := newResultCache(configuration, logger, "github")
+	if err != nil {
+		return nil, err
+	}
 	return &githubService{
-		name:   "github",
-		client: githubv4.NewClient(httpClient),
-		config: configuration,
-		logger: logger,
+		name:        "github",
+		baseURL:     baseURL,
+		graphqlURL:  graphqlURL,
+		webBaseURL:  webBaseURL,
+		client:      client,
+		httpClient:  httpClient,
+		webClient:   webClient,
+		config:      configuration,
+		logger:      logger,
+		staleValues: newStaleValueCache("github", staleValueRetention, staleValueCacheSize),
+		results:     results,
+		now:         time.Now,
 	}, nil
 }
 
-func (service *githubService) getForkCount(owner string, repo string) (int, error) {
-	var query struct {
-		Repository struct {
-			Forks struct {
+// githubBranchCommit represents the head commit of a GitHub branch
+type githubBranchCommit struct {
+	Target struct {
+		Commit struct {
+			CommittedDate githubv4.DateTime
+			History       struct {
 				TotalCount int
 			}
-		} `graphql:"repository(owner: $owner, name: $repo)"`
+		} `graphql:"... on Commit"`
 	}
+}
+
+// getBranchCommit returns the head commit of the branch, or of the default branch if no branch is given. Returns nil
+// for empty repositories, which have no default branch.
+func (service *githubService) getBranchCommit(ctx context.Context, owner string, repo string, branch string) (*githubBranchCommit, error) {
 	variables := map[string]interface{}{
 		"owner": githubv4.String(owner),
 		"repo":  githubv4.String(repo),
 	}
 
-	err := service.client.Query(context.Background(), &query, variables)
-	return query.Repository.Forks.TotalCount, err
-}
+	if branch == "" {
+		var query struct {
+			Repository struct {
+				DefaultBranchRef *githubBranchCommit
+			} `graphql:"repository(owner: $owner, name: $repo)"`
+		}
+		err := service.client.Query(ctx, &query, variables)
+		return query.Repository.DefaultBranchRef, err
+	}
 
-func (service *githubService) getIssueCount(owner string, repo string, issueState string) (int, error) {
-	var issueStates []githubv4.IssueState
 	var query struct {
 		Repository struct {
-			Issues struct {
-				TotalCount int
-			} `graphql:"issues(states: $states)"`
+			Ref *githubBranchCommit `graphql:"ref(qualifiedName: $branch)"`
 		} `graphql:"repository(owner: $owner, name: $repo)"`
 	}
-	switch issueState {
-	case "open":
-		issueStates = []githubv4.IssueState{githubv4.IssueStateOpen}
-	case "closed":
-		issueStates = []githubv4.IssueState{githubv4.IssueStateClosed}
-	default:
-		issueStates = []githubv4.IssueState{
-			githubv4.IssueStateOpen,
-			githubv4.IssueStateClosed,
-		}
+	variables["branch"] = githubv4.String("refs/heads/" + branch)
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return nil, err
+	}
+	if query.Repository.Ref == nil {
+		return nil, errGithubBranchNotFound
+	}
+	return query.Repository.Ref, nil
+}
+
+func (service *githubService) getCommitCount(ctx context.Context, owner string, repo string, branch string) (int, error) {
+	commit, err := service.getBranchCommit(ctx, owner, repo, branch)
+	if err != nil || commit == nil {
+		return 0, err
+	}
+	return commit.Target.Commit.History.TotalCount, nil
+}
+
+func (service *githubService) getMilestone(ctx context.Context, owner string, repo string, number int) (githubMilestone, error) {
+	var query struct {
+		Repository struct {
+			Milestone *struct {
+				Title      string
+				State      githubv4.MilestoneState
+				OpenIssues struct {
+					TotalCount int
+				} `graphql:"openIssues: issues(states: OPEN)"`
+				ClosedIssues struct {
+					TotalCount int
+				} `graphql:"closedIssues: issues(states: CLOSED)"`
+			} `graphql:"milestone(number: $number)"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
 	}
 	variables := map[string]interface{}{
 		"owner":  githubv4.String(owner),
 		"repo":   githubv4.String(repo),
-		"states": issueStates,
+		"number": githubv4.Int(number),
 	}
 
-	err := service.client.Query(context.Background(), &query, variables)
-	return query.Repository.Issues.TotalCount, err
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return githubMilestone{}, err
+	}
+	milestone := query.Repository.Milestone
+	if milestone == nil {
+		return githubMilestone{}, errGithubMilestoneNotFound
+	}
+	return githubMilestone{
+		title:            milestone.Title,
+		closed:           milestone.State == githubv4.MilestoneStateClosed,
+		openIssueCount:   milestone.OpenIssues.TotalCount,
+		closedIssueCount: milestone.ClosedIssues.TotalCount,
+	}, nil
 }
 
-func (service *githubService) getPullRequestCount(owner string, repo string, pullRequestState string) (int, error) {
-	var pullRequestStates []githubv4.PullRequestState
+func (service *githubService) getPrimaryLanguage(ctx context.Context, owner string, repo string) (githubLanguage, error) {
 	var query struct {
 		Repository struct {
-			PullRequests struct {
-				TotalCount int
-			} `graphql:"pullRequests(states: $states)"`
+			PrimaryLanguage *struct {
+				Name  string
+				Color string
+			}
 		} `graphql:"repository(owner: $owner, name: $repo)"`
 	}
-	switch pullRequestState {
-	case "open":
-		pullRequestStates = []githubv4.PullRequestState{githubv4.PullRequestStateOpen}
-	case "closed":
-		pullRequestStates = []githubv4.PullRequestState{githubv4.PullRequestStateClosed}
-	case "merged":
-		pullRequestStates = []githubv4.PullRequestState{githubv4.PullRequestStateMerged}
-	default:
-		pullRequestStates = []githubv4.PullRequestState{
-			githubv4.PullRequestStateOpen,
-			githubv4.PullRequestStateClosed,
-			githubv4.PullRequestStateMerged,
-		}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
+
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return githubLanguage{}, err
+	}
+	language := query.Repository.PrimaryLanguage
+	if language == nil {
+		return githubLanguage{}, nil
+	}
+	return githubLanguage{name: language.Name, color: language.Color}, nil
+}
+
+func (service *githubService) getTopLanguage(ctx context.Context, owner string, repo string) (githubLanguage, error) {
+	var query struct {
+		Repository struct {
+			Languages struct {
+				TotalSize int
+				Edges     []struct {
+					Size int
+					Node struct {
+						Name  string
+						Color string
+					}
+				}
+			} `graphql:"languages(first: 10, orderBy: {field: SIZE, direction: DESC})"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
 	}
 	variables := map[string]interface{}{
-		"owner":  githubv4.String(owner),
-		"repo":   githubv4.String(repo),
-		"states": pullRequestStates,
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
 	}
 
-	err := service.client.Query(context.Background(), &query, variables)
-	return query.Repository.PullRequests.TotalCount, err
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return githubLanguage{}, err
+	}
+	languages := query.Repository.Languages
+	if languages.TotalSize == 0 || len(languages.Edges) == 0 {
+		return githubLanguage{}, nil
+	}
+	top := languages.Edges[0]
+	return githubLanguage{
+		name:  top.Node.Name,
+		color: top.Node.Color,
+		share: float64(top.Size) / float64(languages.TotalSize),
+	}, nil
+}
+
+func (service *githubService) getLastCommitDate(ctx context.Context, owner string, repo string, branch string) (time.Time, error) {
+	commit, err := service.getBranchCommit(ctx, owner, repo, branch)
+	if err != nil || commit == nil {
+		return time.Time{}, err
+	}
+	return commit.Target.Commit.CommittedDate.Time, nil
 }
 
-func (service *githubService) getStarCount(owner string, repo string) (int, error) {
+func (service *githubService) getCreatedAt(ctx context.Context, owner string, repo string) (time.Time, error) {
 	var query struct {
 		Repository struct {
-			Stargazers struct {
-				TotalCount int
-			}
+			CreatedAt githubv4.DateTime
 		} `graphql:"repository(owner: $owner, name: $repo)"`
 	}
 	variables := map[string]interface{}{
@@ -141,144 +602,1365 @@ func (service *githubService) getStarCount(owner string, repo string) (int, erro
 		"repo":  githubv4.String(repo),
 	}
 
-	err := service.client.Query(context.Background(), &query, variables)
-	return query.Repository.Stargazers.TotalCount, err
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository.CreatedAt.Time, err
 }
 
-func (service *githubService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	routeVariables := mux.Vars(r)
-	owner := routeVariables["owner"]
-	repo := routeVariables["repo"]
-	method := routeVariables["method"]
+func (service *githubService) getRepositoryState(ctx context.Context, owner string, repo string) (githubRepositoryState, error) {
+	var query struct {
+		Repository githubRepositoryState `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
 
-	// Fetch data
-	var color, status, subject string
-	var value int
-	var err error
-	switch method {
-	case "forks":
-		subject = "forks"
-		value, err = service.getForkCount(owner, repo)
-	case "issues":
-		state := r.URL.Query().Get("state")
-		switch state {
-		case "":
-			subject = "issues"
-		case "open":
-			subject = "open issues"
-		case "closed":
-			subject = "closed issues"
-		default:
-			service.logger.Info("Unsupported state",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.String("state", state))
-			if err := badRequest(w, service.config); err != nil {
-				service.logger.Error("Failed to create error badge",
-					zap.String("url", r.URL.RequestURI()),
-					zap.String("service", service.name),
-					zap.String("method", method),
-					zap.Error(err))
-			}
-			return
-		}
-		value, err = service.getIssueCount(owner, repo, state)
-	case "pull-requests":
-		state := r.URL.Query().Get("state")
-		switch state {
-		case "":
-			subject = "PRs"
-		case "open":
-			subject = "open PRs"
-		case "closed":
-			subject = "closed PRs"
-		case "merged":
-			subject = "merged PRs"
-		default:
-			service.logger.Info("Unsupported state",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.String("state", state))
-			if err := badRequest(w, service.config); err != nil {
-				service.logger.Error("Failed to create error badge",
-					zap.String("url", r.URL.RequestURI()),
-					zap.String("service", service.name),
-					zap.String("method", method),
-					zap.Error(err))
-			}
-			return
-		}
-		value, err = service.getPullRequestCount(owner, repo, state)
-	case "stars":
-		subject = "stars"
-		value, err = service.getStarCount(owner, repo)
-	default:
-		service.logger.Info("Unsupported method",
-			zap.String("url", r.URL.RequestURI()),
-			zap.String("service", service.name),
-			zap.String("method", method))
-		if err := notFound(w, service.config); err != nil {
-			service.logger.Error("Failed to create error badge",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.Error(err))
-		}
-		return
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository, err
+}
+
+func (service *githubService) getContributorCount(ctx context.Context, owner string, repo string) (int, error) {
+	// Listing a single contributor per page makes the number of the last page the number of contributors
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/contributors?per_page=1&anon=true", service.baseURL, owner, repo)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return 0, err
 	}
+
+	resp, err := service.httpClient.Do(req)
 	if err != nil {
-		service.logger.Error("Failed to fetch data",
-			zap.String("url", r.URL.RequestURI()),
-			zap.String("service", service.name),
-			zap.String("method", method),
-			zap.Error(err))
-		if err := internalServerError(w, service.config); err != nil {
-			service.logger.Error("Failed to create error badge",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.Error(err))
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		}
-		return
+		return 0, err
 	}
-	status = formatIntegerWithMetricPrefix(value)
+	defer resp.Body.Close()
 
-	// Overwrite any badge texts
-	if queryColor := r.URL.Query().Get("color"); queryColor != "" {
-		color = queryColor
+	// Empty repositories have no contributors
+	if resp.StatusCode == http.StatusNoContent {
+		return 0, nil
 	}
-	if queryStatus := r.URL.Query().Get("status"); queryStatus != "" {
-		status = queryStatus
+	if resp.StatusCode != http.StatusOK {
+		return 0, &upstreamStatusError{statusCode: resp.StatusCode}
 	}
-	if querySubject := r.URL.Query().Get("subject"); querySubject != "" {
-		subject = querySubject
+	if lastPage, ok := parseLastPage(resp.Header.Get("Link")); ok {
+		return lastPage, nil
 	}
 
-	// Generate badge
-	generatedBadge, err := badge.Create(&badge.Params{
-		Style:   badge.Style(r.URL.Query().Get("style")),
-		Subject: subject,
-		Status:  status,
-		Color:   color,
-		Icon:    r.URL.Query().Get("icon"),
-	})
+	// Responses aren't paginated when every contributor fits in a single page
+	var contributors []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&contributors); err != nil {
+		return 0, err
+	}
+	return len(contributors), nil
+}
+
+// getLatestWorkflowRun returns the latest run of the workflow (identified by its file name), optionally narrowed down to
+// runs of the branch or triggered by the event. Returns nil if no run matches.
+func (service *githubService) getLatestWorkflowRun(ctx context.Context, owner string, repo string, workflow string, branch string, event string) (*githubWorkflowRun, error) {
+	query := url.Values{"per_page": {"1"}}
+	if branch != "" {
+		query.Set("branch", branch)
+	}
+	if event != "" {
+		query.Set("event", event)
+	}
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/actions/workflows/%s/runs?%s", service.baseURL, owner, repo, url.PathEscape(workflow), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
-		service.logger.Error("Failed to create badge",
-			zap.String("url", r.URL.RequestURI()),
-			zap.String("service", service.name),
-			zap.String("method", method),
-			zap.Error(err))
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errGithubWorkflowNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+	var runs struct {
+		WorkflowRuns []githubWorkflowRun `json:"workflow_runs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&runs); err != nil {
+		return nil, err
+	}
+	if len(runs.WorkflowRuns) == 0 {
+		return nil, nil
+	}
+	return &runs.WorkflowRuns[0], nil
+}
+
+// getDiscussionCategoryID returns the ID of the discussion category, matching its name case-insensitively
+func (service *githubService) getDiscussionCategoryID(ctx context.Context, owner string, repo string, category string) (githubv4.ID, error) {
+	var query struct {
+		Repository struct {
+			HasDiscussionsEnabled bool
+			DiscussionCategories  struct {
+				Nodes []struct {
+					ID   githubv4.ID
+					Name string
+				}
+			} `graphql:"discussionCategories(first: 100)"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
 	}
 
-	if !service.config.ExcludeCacheControlHeaders {
-		// cache response in browser for 1 hour (3600), CDN for 1 hour (3600)
-		w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=3600")
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return nil, err
 	}
-	w.Header().Set("Content-Type", "image/svg+xml;utf-8")
-	w.Write([]byte(generatedBadge))
+	if !query.Repository.HasDiscussionsEnabled {
+		return nil, errGithubDiscussionsDisabled
+	}
+	for _, node := range query.Repository.DiscussionCategories.Nodes {
+		if strings.EqualFold(node.Name, category) {
+			return node.ID, nil
+		}
+	}
+	return nil, errGithubDiscussionCategoryNotFound
+}
+
+// getDiscussionCount returns the number of discussions, narrowed down to the discussion category if given
+func (service *githubService) getDiscussionCount(ctx context.Context, owner string, repo string, category string) (int, error) {
+	var query struct {
+		Repository struct {
+			HasDiscussionsEnabled bool
+			Discussions           struct {
+				TotalCount int
+			} `graphql:"discussions(categoryId: $categoryId)"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner":      githubv4.String(owner),
+		"repo":       githubv4.String(repo),
+		"categoryId": (*githubv4.ID)(nil),
+	}
+	if category != "" {
+		categoryID, err := service.getDiscussionCategoryID(ctx, owner, repo, category)
+		if err != nil {
+			return 0, err
+		}
+		variables["categoryId"] = githubv4.NewID(categoryID)
+	}
+
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return 0, err
+	}
+	if !query.Repository.HasDiscussionsEnabled {
+		return 0, errGithubDiscussionsDisabled
+	}
+	return query.Repository.Discussions.TotalCount, nil
+}
+
+// githubReleaseAssets represents the assets of a GitHub release
+type githubReleaseAssets struct {
+	ReleaseAssets struct {
+		Nodes []struct {
+			DownloadCount int
+		}
+	} `graphql:"releaseAssets(first: $first)"`
+}
+
+// downloadCount returns the sum of the download counts of the release assets
+func (release githubReleaseAssets) downloadCount() int {
+	count := 0
+	for _, asset := range release.ReleaseAssets.Nodes {
+		count += asset.DownloadCount
+	}
+	return count
+}
+
+// getDownloadCount returns the download count of the assets of every release, or of the release tag if given
+func (service *githubService) getDownloadCount(ctx context.Context, owner string, repo string, tag string) (int, error) {
+	if tag != "" {
+		var query struct {
+			Repository struct {
+				Release *githubReleaseAssets `graphql:"release(tagName: $tag)"`
+			} `graphql:"repository(owner: $owner, name: $repo)"`
+		}
+		variables := map[string]interface{}{
+			"owner": githubv4.String(owner),
+			"repo":  githubv4.String(repo),
+			"tag":   githubv4.String(tag),
+			"first": githubv4.Int(githubReleasesPerPage),
+		}
+		if err := service.client.Query(ctx, &query, variables); err != nil {
+			return 0, err
+		}
+		if query.Repository.Release == nil {
+			return 0, errGithubReleaseNotFound
+		}
+		return query.Repository.Release.downloadCount(), nil
+	}
+
+	// Releases are listed through the REST API, whose pages are numbered & thus fetched concurrently
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=%d", service.baseURL, owner, repo, githubReleasesPerPage)
+	pages, _, err := service.getListPages(ctx, apiURL, githubMaxReleasePages, errGithubRepositoryNotFound)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, page := range pages {
+		var releases []struct {
+			Assets []struct {
+				DownloadCount int `json:"download_count"`
+			} `json:"assets"`
+		}
+		if err := json.Unmarshal(page, &releases); err != nil {
+			return 0, err
+		}
+		for _, release := range releases {
+			for _, asset := range release.Assets {
+				count += asset.DownloadCount
+			}
+		}
+	}
+	return count, nil
+}
+
+func (service *githubService) getForkCount(ctx context.Context, owner string, repo string) (int, error) {
+	var query struct {
+		Repository struct {
+			Forks struct {
+				TotalCount int
+			}
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository.Forks.TotalCount, err
+}
+
+func (service *githubService) getIssueCount(ctx context.Context, owner string, repo string, issueState string) (int, error) {
+	var issueStates []githubv4.IssueState
+	var query struct {
+		Repository struct {
+			Issues struct {
+				TotalCount int
+			} `graphql:"issues(states: $states)"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	switch issueState {
+	case "open":
+		issueStates = []githubv4.IssueState{githubv4.IssueStateOpen}
+	case "closed":
+		issueStates = []githubv4.IssueState{githubv4.IssueStateClosed}
+	default:
+		issueStates = []githubv4.IssueState{
+			githubv4.IssueStateOpen,
+			githubv4.IssueStateClosed,
+		}
+	}
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(owner),
+		"repo":   githubv4.String(repo),
+		"states": issueStates,
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository.Issues.TotalCount, err
+}
+
+func (service *githubService) getHealthSignals(ctx context.Context, owner string, repo string) (repositoryHealthSignals, error) {
+	var query struct {
+		Repository struct {
+			DefaultBranchRef *struct {
+				Target struct {
+					Commit struct {
+						CommittedDate githubv4.DateTime
+						Status        *struct {
+							State githubv4.StatusState
+						}
+						CheckSuites struct {
+							TotalCount int
+						}
+					} `graphql:"... on Commit"`
+				}
+			}
+			OpenIssues struct {
+				TotalCount int
+			} `graphql:"openIssues: issues(states: OPEN)"`
+			ClosedIssues struct {
+				TotalCount int
+			} `graphql:"closedIssues: issues(states: CLOSED)"`
+			LicenseInfo *struct {
+				SpdxID string `graphql:"spdxId"`
+			}
+			Releases struct {
+				Nodes []struct {
+					PublishedAt *githubv4.DateTime
+				}
+			} `graphql:"releases(first: 1, orderBy: {field: CREATED_AT, direction: DESC})"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
+
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return repositoryHealthSignals{}, err
+	}
+	signals := repositoryHealthSignals{
+		openIssueCount:   query.Repository.OpenIssues.TotalCount,
+		closedIssueCount: query.Repository.ClosedIssues.TotalCount,
+		hasLicense:       query.Repository.LicenseInfo != nil,
+	}
+	if branch := query.Repository.DefaultBranchRef; branch != nil {
+		signals.lastCommittedAt = branch.Target.Commit.CommittedDate.Time
+		signals.hasCI = branch.Target.Commit.Status != nil || branch.Target.Commit.CheckSuites.TotalCount > 0
+	}
+	if releases := query.Repository.Releases.Nodes; len(releases) > 0 && releases[0].PublishedAt != nil {
+		signals.lastReleasedAt = releases[0].PublishedAt.Time
+	}
+	return signals, nil
+}
+
+func (service *githubService) getLicenseSPDXID(ctx context.Context, owner string, repo string) (string, error) {
+	var query struct {
+		Repository struct {
+			LicenseInfo struct {
+				SpdxID string `graphql:"spdxId"`
+			}
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository.LicenseInfo.SpdxID, err
+}
+
+func (service *githubService) getLicense(ctx context.Context, owner string, repo string) (string, error) {
+	var query struct {
+		Repository struct {
+			LicenseInfo *struct {
+				SpdxID string `graphql:"spdxId"`
+				Name   string
+			}
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
+
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return "", err
+	}
+	license := query.Repository.LicenseInfo
+	if license == nil {
+		return "", nil
+	}
+	// GitHub reports licenses without a SPDX license ID (eg. custom licenses) as "NOASSERTION"
+	if license.SpdxID == "" || license.SpdxID == "NOASSERTION" {
+		return license.Name, nil
+	}
+	return license.SpdxID, nil
+}
+
+func (service *githubService) getLatestRelease(ctx context.Context, owner string, repo string, includePrereleases bool) (string, error) {
+	var query struct {
+		Repository struct {
+			Releases struct {
+				Nodes []struct {
+					TagName      string
+					IsDraft      bool
+					IsPrerelease bool
+				}
+			} `graphql:"releases(first: $first, orderBy: {field: CREATED_AT, direction: DESC})"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+		"first": githubv4.Int(githubReleasePageSize),
+	}
+
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return "", err
+	}
+	for _, release := range query.Repository.Releases.Nodes {
+		if release.IsDraft || (release.IsPrerelease && !includePrereleases) {
+			continue
+		}
+		return release.TagName, nil
+	}
+	return "", nil
+}
+
+func (service *githubService) getLatestTag(ctx context.Context, owner string, repo string) (string, error) {
+	var query struct {
+		Repository struct {
+			Refs struct {
+				Nodes []struct {
+					Name string
+				}
+			} `graphql:"refs(refPrefix: \"refs/tags/\", first: 1, orderBy: {field: TAG_COMMIT_DATE, direction: DESC})"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
+
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return "", err
+	}
+	if tags := query.Repository.Refs.Nodes; len(tags) > 0 {
+		return tags[0].Name, nil
+	}
+	return "", nil
+}
+
+// getSearchCount returns the number of issues & pull requests matching the GitHub search query
+func (service *githubService) getSearchCount(ctx context.Context, searchQuery string) (int, error) {
+	var query struct {
+		Search struct {
+			IssueCount int
+		} `graphql:"search(query: $query, type: ISSUE)"`
+	}
+	variables := map[string]interface{}{
+		"query": githubv4.String(searchQuery),
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.Search.IssueCount, err
+}
+
+func (service *githubService) getPullRequestCount(ctx context.Context, owner string, repo string, pullRequestState string) (int, error) {
+	var pullRequestStates []githubv4.PullRequestState
+	var query struct {
+		Repository struct {
+			PullRequests struct {
+				TotalCount int
+			} `graphql:"pullRequests(states: $states)"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	switch pullRequestState {
+	case "open":
+		pullRequestStates = []githubv4.PullRequestState{githubv4.PullRequestStateOpen}
+	case "closed":
+		pullRequestStates = []githubv4.PullRequestState{githubv4.PullRequestStateClosed}
+	case "merged":
+		pullRequestStates = []githubv4.PullRequestState{githubv4.PullRequestStateMerged}
+	default:
+		pullRequestStates = []githubv4.PullRequestState{
+			githubv4.PullRequestStateOpen,
+			githubv4.PullRequestStateClosed,
+			githubv4.PullRequestStateMerged,
+		}
+	}
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(owner),
+		"repo":   githubv4.String(repo),
+		"states": pullRequestStates,
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository.PullRequests.TotalCount, err
+}
+
+func (service *githubService) getRefCount(ctx context.Context, owner string, repo string, refPrefix string) (int, error) {
+	var query struct {
+		Repository struct {
+			Refs struct {
+				TotalCount int
+			} `graphql:"refs(refPrefix: $refPrefix, first: 0)"`
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner":     githubv4.String(owner),
+		"repo":      githubv4.String(repo),
+		"refPrefix": githubv4.String(refPrefix),
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository.Refs.TotalCount, err
+}
+
+func (service *githubService) getReviewLoadCount(ctx context.Context, owner string, repo string, reviewer string) (int, error) {
+	return service.getSearchCount(ctx, buildReviewLoadSearchQuery(owner, repo, reviewer))
+}
+
+func (service *githubService) getDiskUsage(ctx context.Context, owner string, repo string) (int, error) {
+	var query struct {
+		Repository struct {
+			DiskUsage int
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository.DiskUsage, err
+}
+
+// githubOrgStars represents the stars summed across the public repositories of an organization
+type githubOrgStars struct {
+	count int
+	// truncated is whether only the repositories of the first pages were summed
+	truncated bool
+}
+
+// getOrgStarCount returns the stars summed across the public repositories of an organization, up to the first pages
+// of repositories. Repositories are listed through the REST API, whose pages are numbered & thus fetched concurrently.
+func (service *githubService) getOrgStarCount(ctx context.Context, login string) (githubOrgStars, error) {
+	// Stop as soon as the request is gone, instead of fetching the pages for nothing
+	if err := ctx.Err(); err != nil {
+		return githubOrgStars{}, err
+	}
+
+	apiURL := fmt.Sprintf("%s/orgs/%s/repos?type=public&per_page=%d", service.baseURL, login, githubOrgRepositoriesPerPage)
+	pages, truncated, err := service.getListPages(ctx, apiURL, githubMaxOrgRepositoryPages, errGithubAccountNotFound)
+	if err != nil {
+		return githubOrgStars{}, err
+	}
+
+	stars := githubOrgStars{truncated: truncated}
+	for _, page := range pages {
+		var repositories []struct {
+			StargazersCount int `json:"stargazers_count"`
+		}
+		if err := json.Unmarshal(page, &repositories); err != nil {
+			return githubOrgStars{}, err
+		}
+		for _, repository := range repositories {
+			stars.count += repository.StargazersCount
+		}
+	}
+	return stars, nil
+}
+
+func (service *githubService) getFollowerCount(ctx context.Context, login string) (int, error) {
+	var query struct {
+		User struct {
+			Followers struct {
+				TotalCount int
+			}
+		} `graphql:"user(login: $login)"`
+	}
+	variables := map[string]interface{}{
+		"login": githubv4.String(login),
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.User.Followers.TotalCount, err
+}
+
+func (service *githubService) getPublicRepoCount(ctx context.Context, login string) (int, error) {
+	var query struct {
+		User struct {
+			Repositories struct {
+				TotalCount int
+			} `graphql:"repositories(privacy: PUBLIC, ownerAffiliations: [OWNER])"`
+		} `graphql:"user(login: $login)"`
+	}
+	variables := map[string]interface{}{
+		"login": githubv4.String(login),
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.User.Repositories.TotalCount, err
+}
+
+// getSponsorCount returns the number of active sponsors of a GitHub user or organization, which is 0 for accounts
+// without GitHub Sponsors enabled
+func (service *githubService) getSponsorCount(ctx context.Context, login string) (int, error) {
+	// Users & organizations are both resolved as the owner of repositories, & both sponsorable
+	var query struct {
+		RepositoryOwner *struct {
+			Sponsorable struct {
+				SponsorshipsAsMaintainer struct {
+					TotalCount int
+				} `graphql:"sponsorshipsAsMaintainer(activeOnly: true)"`
+			} `graphql:"... on Sponsorable"`
+		} `graphql:"repositoryOwner(login: $login)"`
+	}
+	variables := map[string]interface{}{
+		"login": githubv4.String(login),
+	}
+
+	if err := service.client.Query(ctx, &query, variables); err != nil {
+		return 0, err
+	}
+	if query.RepositoryOwner == nil {
+		return 0, errGithubAccountNotFound
+	}
+	return query.RepositoryOwner.Sponsorable.SponsorshipsAsMaintainer.TotalCount, nil
+}
+
+func (service *githubService) getStarCount(ctx context.Context, owner string, repo string) (int, error) {
+	var query struct {
+		Repository struct {
+			Stargazers struct {
+				TotalCount int
+			}
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository.Stargazers.TotalCount, err
+}
+
+func (service *githubService) getWatcherCount(ctx context.Context, owner string, repo string) (int, error) {
+	var query struct {
+		Repository struct {
+			Watchers struct {
+				TotalCount int
+			}
+		} `graphql:"repository(owner: $owner, name: $repo)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"repo":  githubv4.String(repo),
+	}
+
+	err := service.client.Query(ctx, &query, variables)
+	return query.Repository.Watchers.TotalCount, err
+}
+
+// parseDependentCount returns the total number of dependent repositories & packages listed in the tabs of a GitHub
+// dependents page
+func parseDependentCount(page []byte) (int, error) {
+	matches := githubDependentsPattern.FindAllSubmatch(page, -1)
+	if len(matches) == 0 {
+		return 0, errGithubDependentsNotFound
+	}
+
+	// Each kind of dependents is counted once, even if the page lists it more than once
+	counts := map[string]int{}
+	for _, match := range matches {
+		kind := strings.ToLower(string(match[2]))
+		if strings.HasPrefix(kind, "repositor") {
+			kind = "repositories"
+		} else {
+			kind = "packages"
+		}
+		if _, ok := counts[kind]; ok {
+			continue
+		}
+		count, err := strconv.Atoi(strings.Replace(string(match[1]), ",", "", -1))
+		if err != nil {
+			return 0, err
+		}
+		counts[kind] = count
+	}
+	return counts["repositories"] + counts["packages"], nil
+}
+
+// getDependentCount returns the number of repositories & packages depending on the repository, scraped from the
+// dependents page of the GitHub website as the GitHub APIs don't expose it
+func (service *githubService) getDependentCount(ctx context.Context, owner string, repo string) (int, error) {
+	pageURL := fmt.Sprintf("%s/%s/%s/network/dependents", service.webBaseURL, owner, repo)
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := service.webClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+	page, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	return parseDependentCount(page)
+}
+
+// githubVulnerabilityAlertsQuery represents the GitHub GraphQL query of the number of open Dependabot alerts
+const githubVulnerabilityAlertsQuery = `query($owner: String!, $repo: String!) {
+  repository(owner: $owner, name: $repo) {
+    vulnerabilityAlerts(states: OPEN) {
+      totalCount
+    }
+  }
+}`
+
+// githubGraphQLError represents an error of a GitHub GraphQL API response, along with its type (eg. FORBIDDEN,
+// NOT_FOUND) that the GraphQL client doesn't expose
+type githubGraphQLError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// queryGraphQL sends the GraphQL query without the GraphQL client, decoding the data of the response into `data` &
+// returning the errors of the response along with their types, which the GraphQL client doesn't expose
+func (service *githubService) queryGraphQL(ctx context.Context, query string, variables map[string]string, data interface{}) ([]githubGraphQLError, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", service.graphqlURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+	result := struct {
+		Data   interface{}          `json:"data"`
+		Errors []githubGraphQLError `json:"errors"`
+	}{Data: data}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Errors, nil
+}
+
+// getVulnerabilityAlertCount returns the number of open Dependabot alerts. Reading the alerts requires access to the
+// security alerts of the repository, so the query is sent without the GraphQL client to tell FORBIDDEN errors apart.
+func (service *githubService) getVulnerabilityAlertCount(ctx context.Context, owner string, repo string) (int, error) {
+	var data struct {
+		Repository *struct {
+			VulnerabilityAlerts struct {
+				TotalCount int `json:"totalCount"`
+			} `json:"vulnerabilityAlerts"`
+		} `json:"repository"`
+	}
+	graphqlErrs, err := service.queryGraphQL(ctx, githubVulnerabilityAlertsQuery, map[string]string{"owner": owner, "repo": repo}, &data)
+	if err != nil {
+		return 0, err
+	}
+	for _, graphqlErr := range graphqlErrs {
+		switch graphqlErr.Type {
+		case "FORBIDDEN":
+			return 0, errGithubVulnerabilitiesForbidden
+		case "NOT_FOUND":
+			return 0, errGithubRepositoryNotFound
+		}
+	}
+	if len(graphqlErrs) > 0 {
+		return 0, errors.New(graphqlErrs[0].Message)
+	}
+	if data.Repository == nil {
+		return 0, errGithubRepositoryNotFound
+	}
+	return data.Repository.VulnerabilityAlerts.TotalCount, nil
+}
+
+// buildIssueBreakdownQuery returns the GitHub GraphQL query of the open issues & the color of each label, aliased by
+// position (eg. `label0`) as labels are passed as variables (eg. `$label0`)
+func buildIssueBreakdownQuery(labels int) string {
+	var b strings.Builder
+	b.WriteString("query($owner: String!, $repo: String!")
+	for i := 0; i < labels; i++ {
+		fmt.Fprintf(&b, ", $label%d: String!", i)
+	}
+	b.WriteString(") {\n  repository(owner: $owner, name: $repo) {\n")
+	for i := 0; i < labels; i++ {
+		fmt.Fprintf(&b, "    label%d: label(name: $label%d) {\n      color\n      issues(states: OPEN) {\n        totalCount\n      }\n    }\n", i, i)
+	}
+	b.WriteString("  }\n}")
+	return b.String()
+}
+
+// getIssueBreakdown returns the number of open issues of each label along with the color of the label, in a single
+// GraphQL query. Labels that don't exist have no open issues & no color.
+func (service *githubService) getIssueBreakdown(ctx context.Context, owner string, repo string, labels []string) ([]cachedSegment, error) {
+	variables := map[string]string{"owner": owner, "repo": repo}
+	for i, label := range labels {
+		variables[fmt.Sprintf("label%d", i)] = label
+	}
+	var data struct {
+		Repository map[string]*struct {
+			Color  string `json:"color"`
+			Issues struct {
+				TotalCount int `json:"totalCount"`
+			} `json:"issues"`
+		} `json:"repository"`
+	}
+	graphqlErrs, err := service.queryGraphQL(ctx, buildIssueBreakdownQuery(len(labels)), variables, &data)
+	if err != nil {
+		return nil, err
+	}
+	for _, graphqlErr := range graphqlErrs {
+		if graphqlErr.Type == "NOT_FOUND" {
+			return nil, errGithubRepositoryNotFound
+		}
+	}
+	if len(graphqlErrs) > 0 {
+		return nil, errors.New(graphqlErrs[0].Message)
+	}
+	if data.Repository == nil {
+		return nil, errGithubRepositoryNotFound
+	}
+
+	segments := make([]cachedSegment, 0, len(labels))
+	for i, label := range labels {
+		segment := cachedSegment{Text: label}
+		if result := data.Repository[fmt.Sprintf("label%d", i)]; result != nil {
+			segment.Value = result.Issues.TotalCount
+			segment.Color = result.Color
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// issueBreakdownLabels returns the labels of the issue breakdown badge, set as a comma-separated list by the `labels`
+// query parameter
+func issueBreakdownLabels(query url.Values) []string {
+	var labels []string
+	seen := map[string]bool{}
+	for _, label := range strings.Split(query.Get("labels"), ",") {
+		if label = strings.TrimSpace(label); label != "" && !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// issueBreakdownSegments returns one segment per label showing its open issues, colored by the color of the label.
+// Labels without open issues are hidden if requested with the `hideEmpty` query parameter.
+func issueBreakdownSegments(labels []cachedSegment, query url.Values) []badge.Segment {
+	hideEmpty := query.Get("hideEmpty") == "true"
+	segments := make([]badge.Segment, 0, len(labels))
+	for _, label := range labels {
+		if hideEmpty && label.Value == 0 {
+			continue
+		}
+		// Labels that don't exist have no color
+		color := "lightgrey"
+		if label.Color != "" {
+			color = "#" + label.Color
+		}
+		status := formatStatus(label.Value, query)
+		segments = append(segments, badge.Segment{Text: label.Text + " " + status, Color: color, Label: label.Text + ": " + status})
+	}
+	return segments
+}
+
+// SupportedMetrics returns the metrics served by the service, the health metric is only served when enabled
+func (service *githubService) SupportedMetrics() []string {
+	metrics := []string{"age", "branches", "commits", "contributors", "dependents", "discussions", "downloads",
+		"followers", "forks", "issues", "language", "languages", "last-commit", "license", "license-check", "milestone", "pull-requests",
+		"release", "repos", "review-load", "size", "sponsors", "stars", "status", "tag", "tags", "vulnerabilities", "watchers", "workflow"}
+	if service.config.EnableHealthBadge {
+		metrics = append(metrics, "health")
+	}
+	return metrics
+}
+
+func (service *githubService) supportedQueryParams() map[string][]badgeQueryParam {
+	branch := badgeQueryParam{"branch", "Branch of the repository, defaults to the default branch", "main"}
+	display := badgeQueryParam{"display", "Display of the date (relative or date), defaults to relative", "date"}
+	labels := badgeQueryParam{"label", "Label that counted items must be labelled with, repeatable", "bug"}
+	return map[string][]badgeQueryParam{
+		"":            {{"dim_archived", "Dims the badge of archived repositories (true or false)", "true"}},
+		"age":         {display},
+		"commits":     {branch},
+		"discussions": {{"category", "Category of the discussions, defaults to every category", "Q&A"}},
+		"issues":      {{"state", "State of the issues (open or closed), defaults to every state", "open"}, labels},
+		"issue-breakdown": {
+			{"labels", fmt.Sprintf("Comma-separated labels whose open issues are counted, up to %d", maxIssueBreakdownLabels), "bug,enhancement"},
+			{"hideEmpty", "Hides the labels without open issues (true or false)", "true"},
+		},
+		"last-commit":   {display, branch},
+		"license-check": {{"allow", "Comma-separated SPDX license IDs allowed", "MIT,Apache-2.0"}},
+		"pull-requests": {{"state", "State of the pull requests (open, closed or merged), defaults to every state", "open"}, labels},
+		"release":       {{"include_prereleases", "Includes prereleases (true or false)", "true"}},
+		"review-load":   {{"reviewer", "Login of the requested reviewer, defaults to every reviewer", "octocat"}},
+		"size":          {{"units", "Units of the size (si or binary), defaults to si", "binary"}},
+		"workflow":      {{"event", "Event triggering the workflow runs (push or pull_request), defaults to every event", "push"}, branch},
+	}
+}
+
+// isGithubFinalError returns whether the error is answered as is, without falling back on stale data
+func isGithubFinalError(err error) bool {
+	switch err {
+	case errGithubDiscussionCategoryNotFound, errGithubMilestoneNotFound, errGithubReleaseNotFound, errGithubWorkflowNotFound,
+		errGithubAccountNotFound, errGithubRepositoryNotFound, errGithubVulnerabilitiesForbidden, errGithubBranchNotFound:
+		return true
+	}
+	return false
+}
+
+func (service *githubService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *githubService) fetchBadge(r *http.Request) (cachedResult, error) {
+	routeVariables := mux.Vars(r)
+	owner := routeVariables["owner"]
+	repo := routeVariables["repo"]
+	method := routeVariables["method"]
+	ctx := upstreamContext(r)
+	logger := requestLogger(service.logger, r)
+
+	// Badges of archived repositories can be dimmed, on top of their usual data
+	if value := r.URL.Query().Get("dim_archived"); value != "" {
+		if _, err := strconv.ParseBool(value); err != nil {
+			return cachedResult{}, invalidQueryParameterBadge("dim_archived")
+		}
+	}
+
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         fetchKey(r),
+		isFinal:     isGithubFinalError,
+	}
+	result, err := fetchResult(r, logger, fetch, func() (cachedResult, error) {
+		var result cachedResult
+		var err error
+		switch method {
+		case "age":
+			display := r.URL.Query().Get("display")
+			if display != "" && display != "relative" && display != "date" {
+				return result, invalidQueryParameterBadge("display")
+			}
+			result.Subject = "created"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getCreatedAt(ctx, owner, repo)
+			})
+			if err == nil {
+				result.Status, result.Color = ageStatus(fetched.(time.Time), display, service.now())
+			}
+		case "branches":
+			result.Subject = "branches"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getRefCount(ctx, owner, repo, "refs/heads/")
+			})
+		case "commits":
+			result.Subject = "commits"
+			branch := r.URL.Query().Get("branch")
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getCommitCount(ctx, owner, repo, branch)
+			})
+		case "contributors":
+			result.Subject = "contributors"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getContributorCount(ctx, owner, repo)
+			})
+		case "dependents":
+			result.Subject = "used by"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getDependentCount(ctx, owner, repo)
+			})
+		case "discussions":
+			result.Subject = "discussions"
+			category := r.URL.Query().Get("category")
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getDiscussionCount(ctx, owner, repo, category)
+			})
+		case "downloads":
+			result.Subject = "downloads"
+			tag := routeVariables["tag"]
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getDownloadCount(ctx, owner, repo, tag)
+			})
+		case "followers":
+			result.Subject = "followers"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getFollowerCount(ctx, owner)
+			})
+		case "forks":
+			result.Subject = "forks"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getForkCount(ctx, owner, repo)
+			})
+		case "health":
+			if !service.config.EnableHealthBadge {
+				return result, notFoundBadge
+			}
+			result.Subject = "health"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				signals, err := service.getHealthSignals(ctx, owner, repo)
+				if err != nil {
+					return 0, err
+				}
+				return computeHealthScore(signals, service.config.HealthWeights, service.now()), nil
+			})
+			if err == nil {
+				result.Status, result.Color = healthStatus(result.Value)
+			}
+		case "issues":
+			state := r.URL.Query().Get("state")
+			switch state {
+			case "":
+				result.Subject = "issues"
+			case "open":
+				result.Subject = "open issues"
+			case "closed":
+				result.Subject = "closed issues"
+			default:
+				return result, badRequestBadge
+			}
+			labels := labelsFromQuery(r.URL.Query())
+			result.Subject = labeledSubject(result.Subject, labels)
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				if len(labels) > 0 {
+					return service.getSearchCount(ctx, buildLabeledSearchQuery(owner, repo, "is:issue", state, labels))
+				}
+				return service.getIssueCount(ctx, owner, repo, state)
+			})
+		case "language", "languages":
+			result.Subject = "language"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				if method == "languages" {
+					return service.getTopLanguage(ctx, owner, repo)
+				}
+				return service.getPrimaryLanguage(ctx, owner, repo)
+			})
+			if err == nil {
+				result.Status, result.Color = languageStatus(fetched.(githubLanguage), method == "languages")
+			}
+		case "last-commit":
+			display := r.URL.Query().Get("display")
+			if display != "" && display != "relative" && display != "date" {
+				return result, invalidQueryParameterBadge("display")
+			}
+			result.Subject = "last commit"
+			branch := r.URL.Query().Get("branch")
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getLastCommitDate(ctx, owner, repo, branch)
+			})
+			if err == nil {
+				result.Status, result.Color = lastCommitStatus(fetched.(time.Time), display, service.now())
+			}
+		case "license":
+			result.Subject = "license"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getLicense(ctx, owner, repo)
+			})
+			if err == nil {
+				result.Status, result.Color = licenseStatus(fetched.(string))
+			}
+		case "license-check":
+			allowlist, parseErr := parseLicenseAllowlist(r.URL.Query().Get("allow"))
+			if parseErr != nil {
+				return result, invalidQueryParameterWithReasonBadge("allow", parseErr.Error())
+			}
+			result.Subject = "license"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do("license/"+owner+"/"+repo, func() (interface{}, error) {
+				return service.getLicenseSPDXID(ctx, owner, repo)
+			})
+			if err == nil {
+				result.Status, result.Color = checkLicense(fetched.(string), allowlist)
+			}
+		case "milestone":
+			number, parseErr := strconv.Atoi(routeVariables["number"])
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				// Milestones are only routed with a milestone number
+				if parseErr != nil {
+					return githubMilestone{}, errGithubMilestoneNotFound
+				}
+				return service.getMilestone(ctx, owner, repo, number)
+			})
+			if err == nil {
+				milestone := fetched.(githubMilestone)
+				result.Subject = milestone.title
+				result.Status, result.Color = milestoneStatus(milestone)
+			}
+		case "pull-requests":
+			state := r.URL.Query().Get("state")
+			switch state {
+			case "":
+				result.Subject = "PRs"
+			case "open":
+				result.Subject = "open PRs"
+			case "closed":
+				result.Subject = "closed PRs"
+			case "merged":
+				result.Subject = "merged PRs"
+			default:
+				return result, badRequestBadge
+			}
+			labels := labelsFromQuery(r.URL.Query())
+			result.Subject = labeledSubject(result.Subject, labels)
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				if len(labels) > 0 {
+					return service.getSearchCount(ctx, buildLabeledSearchQuery(owner, repo, "is:pr", state, labels))
+				}
+				return service.getPullRequestCount(ctx, owner, repo, state)
+			})
+		case "release":
+			includePrereleases := false
+			if value := r.URL.Query().Get("include_prereleases"); value != "" {
+				var parseErr error
+				if includePrereleases, parseErr = strconv.ParseBool(value); parseErr != nil {
+					return result, invalidQueryParameterBadge("include_prereleases")
+				}
+			}
+			result.Subject = "release"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getLatestRelease(ctx, owner, repo, includePrereleases)
+			})
+			if err == nil {
+				result.Status, result.Color = versionStatus(fetched.(string))
+			}
+		case "review-load":
+			reviewer := r.URL.Query().Get("reviewer")
+			if reviewer != "" && !githubLoginPattern.MatchString(reviewer) {
+				return result, badRequestBadge
+			}
+			result.Subject = "awaiting review"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getReviewLoadCount(ctx, owner, repo, reviewer)
+			})
+		case "issue-breakdown":
+			labels := issueBreakdownLabels(r.URL.Query())
+			if len(labels) == 0 || len(labels) > maxIssueBreakdownLabels {
+				return result, invalidQueryParameterBadge("labels")
+			}
+			result.Subject = "issues"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getIssueBreakdown(ctx, owner, repo, labels)
+			})
+			if err == nil {
+				result.Segments = fetched.([]cachedSegment)
+			}
+		case "status":
+			result.Subject = "status"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getRepositoryState(ctx, owner, repo)
+			})
+			if err == nil {
+				result.Status, result.Color = repositoryStatus(fetched.(githubRepositoryState))
+			}
+		case "workflow":
+			event := r.URL.Query().Get("event")
+			if event != "" && event != "push" && event != "pull_request" {
+				return result, invalidQueryParameterBadge("event")
+			}
+			result.Subject = "build"
+			branch := r.URL.Query().Get("branch")
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getLatestWorkflowRun(ctx, owner, repo, routeVariables["workflow"], branch, event)
+			})
+			if err == nil {
+				result.Status, result.Color = workflowStatus(fetched.(*githubWorkflowRun))
+			}
+		case "size":
+			units := r.URL.Query().Get("units")
+			if units != "" && units != "si" && units != "binary" {
+				return result, invalidQueryParameterBadge("units")
+			}
+			result.Subject = "repo size"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getDiskUsage(ctx, owner, repo)
+			})
+			if err == nil {
+				result.Status, result.Color = formatKilobytes(result.Value, units == "binary"), "blue"
+			}
+		case "repos":
+			result.Subject = "repos"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getPublicRepoCount(ctx, owner)
+			})
+		case "sponsors":
+			result.Subject = "sponsors"
+			result.Color = "pink"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getSponsorCount(ctx, owner)
+			})
+		case "stars":
+			result.Subject = "stars"
+			if routeVariables["account"] == "org" {
+				var fetched interface{}
+				fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+					return service.getOrgStarCount(ctx, owner)
+				})
+				if err == nil {
+					stars := fetched.(githubOrgStars)
+					result.Value, result.Truncated = stars.count, stars.truncated
+				}
+				break
+			}
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getStarCount(ctx, owner, repo)
+			})
+		case "tag":
+			result.Subject = "tag"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getLatestTag(ctx, owner, repo)
+			})
+			if err == nil {
+				result.Status, result.Color = versionStatus(fetched.(string))
+			}
+		case "tags":
+			result.Subject = "tags"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getRefCount(ctx, owner, repo, "refs/tags/")
+			})
+		case "vulnerabilities":
+			result.Subject = "vulnerabilities"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getVulnerabilityAlertCount(ctx, owner, repo)
+			})
+			if err == nil {
+				result.Color = "red"
+				if result.Value == 0 {
+					result.Color = "green"
+				}
+			}
+		case "watchers":
+			result.Subject = "watchers"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getWatcherCount(ctx, owner, repo)
+			})
+		default:
+			return result, notFoundBadge
+		}
+		if err == errGithubDiscussionsDisabled {
+			result.Status, result.Color, err = "disabled", "lightgrey", nil
+		}
+		return result, err
+	})
+	switch err {
+	case errGithubDiscussionCategoryNotFound:
+		return result, categoryNotFoundBadge
+	case errGithubMilestoneNotFound:
+		return result, milestoneNotFoundBadge
+	case errGithubReleaseNotFound:
+		return result, releaseNotFoundBadge
+	case errGithubWorkflowNotFound:
+		return result, workflowNotFoundBadge
+	case errGithubAccountNotFound:
+		return result, accountNotFoundBadge
+	case errGithubRepositoryNotFound:
+		return result, repositoryNotFoundBadge
+	case errGithubVulnerabilitiesForbidden:
+		return result, noAccessBadge
+	case errGithubBranchNotFound:
+		return result, branchNotFoundBadge
+	}
+
+	// Scraped data degrades to an unknown status rather than an error badge, as scraping breaks with the website
+	if err != nil && method == "dependents" {
+		logger.Warn("Failed to scrape data, serving unknown status",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.String("method", method),
+			zap.Error(err))
+		result.Status, result.Color = "unknown", "lightgrey"
+		// Unknown statuses are retried shortly
+		result.cacheSeconds = service.config.MinCacheSeconds
+		return result, nil
+	}
+	// Scraped data is cached longer unless requested otherwise
+	if _, ok := r.URL.Query()["cacheSeconds"]; err == nil && method == "dependents" && !ok {
+		result.cacheSeconds = githubDependentsCacheSeconds
+	}
+	return result, err
+}
+
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *githubService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	routeVariables := mux.Vars(r)
+	owner := routeVariables["owner"]
+	repo := routeVariables["repo"]
+	method := routeVariables["method"]
+	value, truncated, subject, status, color := result.Value, result.Truncated, result.Subject, result.Status, result.Color
+
+	// Textual statuses are used as is, only numeric values are formatted & colored by value
+	isNumeric := status == ""
+	if isNumeric {
+		query := r.URL.Query()
+		// Download counts are humanized unless requested otherwise
+		if _, ok := query["humanize"]; method == "downloads" && !ok {
+			query.Set("humanize", "true")
+		}
+		status = formatStatus(value, query)
+		// Counts cut short are only lower bounds
+		if truncated {
+			status += "+"
+		}
+	}
+
+	// Overwrite any badge texts
+	badgeParams := &badge.Params{Subject: subject, Status: status, Color: color, Sparkline: sparklineFromRequest(r)}
+	if method == "health" {
+		badgeParams.Title = fmt.Sprintf("health score: %d/100", value)
+	}
+	if method == "issue-breakdown" {
+		badgeParams.Segments = issueBreakdownSegments(result.Segments, r.URL.Query())
+		// Badges whose labels are all hidden read as such
+		if len(badgeParams.Segments) == 0 {
+			badgeParams.Status, badgeParams.Color = "none", "lightgrey"
+		}
+	}
+	if isNumeric {
+		if err := parseColorRangesQuery(badgeParams, value, r.URL.Query()); err != nil {
+			return nil, invalidQueryParameterBadge("colorRanges")
+		}
+	}
+	// Badges of archived repositories can be dimmed, on top of their usual data
+	if dimArchived, _ := strconv.ParseBool(r.URL.Query().Get("dim_archived")); dimArchived && repo != "" {
+		// Shares the upstream call with the status badge of the repository
+		result, err, _ := service.requests.Do("status/"+owner+"/"+repo+"?", func() (interface{}, error) {
+			return service.getRepositoryState(upstreamContext(r), owner, repo)
+		})
+		if err != nil {
+			requestLogger(service.logger, r).Warn("Failed to fetch repository status, leaving the badge undimmed",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.String("method", method),
+				zap.Error(err))
+		} else if result.(githubRepositoryState).IsArchived {
+			badgeParams.Color = "grey"
+		}
+	}
+	// Issue breakdown badges keep as many labels as fit within the default maximum width unless requested otherwise
+	if method == "issue-breakdown" {
+		badgeParams.MaxWidth = githubIssueBreakdownMaxWidth
+	}
+	return badgeParams, nil
+}
+
+// purgeRepository removes the data cached for the badges of the repository, returning the number of entries removed
+func (service *githubService) purgeRepository(ctx context.Context, owner string, repo string) int {
+	purged := service.staleValues.purge(func(key string) bool {
+		return isRepositoryKey(key, owner, repo)
+	})
+	return purged + service.results.purge(ctx, owner, repo)
 }
@@ -0,0 +1,1792 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shurcooL/githubv4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// fakeGithubGraphQLAPI returns a fake GitHub GraphQL API responding with the given data to every query
+func fakeGithubGraphQLAPI(data string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":` + data + `}`))
+	}
+}
+
+// newTestGithubService returns a router serving the GitHub badge service backed by the fake API handler
+func newTestGithubService(t *testing.T, configuration *config.Config, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	configuration.GithubAccessToken = "token"
+	service, err := NewGithubService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*githubService).baseURL = fakeAPI.URL
+	service.(*githubService).graphqlURL = fakeAPI.URL
+	service.(*githubService).webBaseURL = fakeAPI.URL
+	service.(*githubService).client = githubv4.NewEnterpriseClient(fakeAPI.URL, fakeAPI.Client())
+	service.(*githubService).httpClient = fakeAPI.Client()
+	service.(*githubService).webClient = fakeAPI.Client()
+
+	router := mux.NewRouter()
+	router.Handle(`/github/{method:issue-breakdown}/{owner}/{repo}`, service)
+	router.Handle(`/github/{method}/{owner}/{repo}`, service).Name("github")
+
+	return router, fakeAPI.Close
+}
+
+func TestBuildPullRequestSearchQuery(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "repo:google/gopacket is:pr", buildPullRequestSearchQuery("google", "gopacket"))
+	assert.Equal(t, "repo:google/gopacket is:pr is:open author:octocat",
+		buildPullRequestSearchQuery("google", "gopacket", "is:open", "author:octocat"))
+}
+
+func TestBuildReviewLoadSearchQuery(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		reviewer string
+		expected string
+	}{
+		{"AllReviewers", "", "repo:google/gopacket is:pr is:open review:none"},
+		{"SingleReviewer", "octocat", "repo:google/gopacket is:pr is:open review-requested:octocat"},
+		{"HyphenatedReviewer", "octo-cat", "repo:google/gopacket is:pr is:open review-requested:octo-cat"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, buildReviewLoadSearchQuery("google", "gopacket", testCase.reviewer))
+		})
+	}
+}
+
+func TestGithubServiceWithLabels(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                string
+		url                 string
+		expectedSearchQuery string
+		expected            *badge.Params
+	}{
+		{
+			"IssuesWithLabel", "/github/issues/google/gopacket?label=bug",
+			`repo:google/gopacket is:issue label:"bug"`,
+			&badge.Params{Subject: "bug issues", Status: "42"},
+		},
+		{
+			"IssuesWithLabels", "/github/issues/google/gopacket?label=bug&label=good%20first%20issue",
+			`repo:google/gopacket is:issue label:"bug" label:"good first issue"`,
+			&badge.Params{Subject: "bug good first issue issues", Status: "42"},
+		},
+		{
+			"OpenIssuesWithLabel", "/github/issues/google/gopacket?state=open&label=bug",
+			`repo:google/gopacket is:issue is:open label:"bug"`,
+			&badge.Params{Subject: "open bug issues", Status: "42"},
+		},
+		{
+			"ClosedPullRequestsWithLabel", "/github/pull-requests/google/gopacket?state=closed&label=dependencies",
+			`repo:google/gopacket is:pr is:closed is:unmerged label:"dependencies"`,
+			&badge.Params{Subject: "closed dependencies PRs", Status: "42"},
+		},
+		{
+			"MergedPullRequestsWithLabels", "/github/pull-requests/google/gopacket?state=merged&label=bug&label=ci",
+			`repo:google/gopacket is:pr is:merged label:"bug" label:"ci"`,
+			&badge.Params{Subject: "merged bug ci PRs", Status: "42"},
+		},
+		{
+			"SubjectOverride", "/github/issues/google/gopacket?state=open&label=bug&subject=bugs",
+			`repo:google/gopacket is:issue is:open label:"bug"`,
+			&badge.Params{Subject: "bugs", Status: "42"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var searchQuery string
+			router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Variables struct {
+						Query string `json:"query"`
+					} `json:"variables"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				searchQuery = body.Variables.Query
+				fakeGithubGraphQLAPI(`{"search":{"issueCount":42}}`)(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedSearchQuery, searchQuery)
+		})
+	}
+}
+
+func TestParseLastPage(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		link         string
+		expectedPage int
+		expectedOK   bool
+	}{
+		{
+			"NextAndLast",
+			`<https://api.github.com/repositories/1/contributors?per_page=1&anon=true&page=2>; rel="next", ` +
+				`<https://api.github.com/repositories/1/contributors?per_page=1&anon=true&page=42>; rel="last"`,
+			42, true,
+		},
+		{
+			"LastBeforeNext",
+			`<https://api.github.com/repositories/1/contributors?page=1337&per_page=1>; rel="last",` +
+				`<https://api.github.com/repositories/1/contributors?page=2&per_page=1>; rel="next"`,
+			1337, true,
+		},
+		{
+			"FirstAndPrev",
+			`<https://api.github.com/repositories/1/contributors?page=1>; rel="first", ` +
+				`<https://api.github.com/repositories/1/contributors?page=41>; rel="prev"`,
+			0, false,
+		},
+		{"Empty", "", 0, false},
+		{"MalformedTarget", `https://api.github.com/repositories/1/contributors?page=42; rel="last"`, 0, false},
+		{"MalformedPage", `<https://api.github.com/repositories/1/contributors?page=last>; rel="last"`, 0, false},
+	}
+
+	for _, testCase := range testCases {
+		page, ok := parseLastPage(testCase.link)
+		assert.Equal(t, testCase.expectedPage, page, testCase.name)
+		assert.Equal(t, testCase.expectedOK, ok, testCase.name)
+	}
+}
+
+func TestGithubServiceWithContributors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		statusCode     int
+		link           string
+		body           string
+		expectedStatus string
+	}{
+		{"Paginated", http.StatusOK, `<https://api.github.com/repositories/1/contributors?per_page=1&anon=true&page=2>; rel="next", <https://api.github.com/repositories/1/contributors?per_page=1&anon=true&page=128>; rel="last"`, `[{"login":"octocat"}]`, "128"},
+		{"SingleContributor", http.StatusOK, "", `[{"login":"octocat"}]`, "1"},
+		{"EmptyRepository", http.StatusNoContent, "", "", "0"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var path, query string
+			router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				path, query = r.URL.Path, r.URL.RawQuery
+				if testCase.link != "" {
+					w.Header().Set("Link", testCase.link)
+				}
+				w.WriteHeader(testCase.statusCode)
+				w.Write([]byte(testCase.body))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/contributors/google/gopacket", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, "/repos/google/gopacket/contributors", path)
+			assert.Equal(t, "per_page=1&anon=true", query)
+			assert.Equal(t, createBadge(&badge.Params{Subject: "contributors", Status: testCase.expectedStatus}), res.Body.String())
+		})
+	}
+}
+
+func TestWorkflowStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		run            *githubWorkflowRun
+		expectedStatus string
+		expectedColor  string
+	}{
+		{"NoRuns", nil, "no runs", "lightgrey"},
+		{"Success", &githubWorkflowRun{Status: "completed", Conclusion: "success"}, "passing", "green"},
+		{"Failure", &githubWorkflowRun{Status: "completed", Conclusion: "failure"}, "failing", "red"},
+		{"TimedOut", &githubWorkflowRun{Status: "completed", Conclusion: "timed_out"}, "failing", "red"},
+		{"StartupFailure", &githubWorkflowRun{Status: "completed", Conclusion: "startup_failure"}, "failing", "red"},
+		{"Cancelled", &githubWorkflowRun{Status: "completed", Conclusion: "cancelled"}, "cancelled", "grey"},
+		{"Skipped", &githubWorkflowRun{Status: "completed", Conclusion: "skipped"}, "skipped", "grey"},
+		{"Neutral", &githubWorkflowRun{Status: "completed", Conclusion: "neutral"}, "neutral", "lightgrey"},
+		{"Queued", &githubWorkflowRun{Status: "queued"}, "running", "yellow"},
+		{"InProgress", &githubWorkflowRun{Status: "in_progress"}, "running", "yellow"},
+	}
+
+	for _, testCase := range testCases {
+		status, color := workflowStatus(testCase.run)
+		assert.Equal(t, testCase.expectedStatus, status, testCase.name)
+		assert.Equal(t, testCase.expectedColor, color, testCase.name)
+	}
+}
+
+func TestGithubServiceWithWorkflow(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name               string
+		query              string
+		statusCode         int
+		body               string
+		expectedQuery      string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{
+			"Passing", "", http.StatusOK, `{"total_count":3,"workflow_runs":[{"status":"completed","conclusion":"success"}]}`,
+			"per_page=1", http.StatusOK, &badge.Params{Subject: "build", Status: "passing", Color: "green"},
+		},
+		{
+			"Failing", "branch=main", http.StatusOK, `{"total_count":3,"workflow_runs":[{"status":"completed","conclusion":"failure"}]}`,
+			"branch=main&per_page=1", http.StatusOK, &badge.Params{Subject: "build", Status: "failing", Color: "red"},
+		},
+		{
+			"Cancelled", "event=push", http.StatusOK, `{"total_count":3,"workflow_runs":[{"status":"completed","conclusion":"cancelled"}]}`,
+			"event=push&per_page=1", http.StatusOK, &badge.Params{Subject: "build", Status: "cancelled", Color: "grey"},
+		},
+		{
+			"Skipped", "branch=main&event=pull_request", http.StatusOK, `{"total_count":3,"workflow_runs":[{"status":"completed","conclusion":"skipped"}]}`,
+			"branch=main&event=pull_request&per_page=1", http.StatusOK, &badge.Params{Subject: "build", Status: "skipped", Color: "grey"},
+		},
+		{
+			"Running", "", http.StatusOK, `{"total_count":3,"workflow_runs":[{"status":"in_progress","conclusion":null}]}`,
+			"per_page=1", http.StatusOK, &badge.Params{Subject: "build", Status: "running", Color: "yellow"},
+		},
+		{
+			"NoRuns", "branch=gh-pages", http.StatusOK, `{"total_count":0,"workflow_runs":[]}`,
+			"branch=gh-pages&per_page=1", http.StatusOK, &badge.Params{Subject: "build", Status: "no runs", Color: "lightgrey"},
+		},
+		{
+			"WorkflowNotFound", "", http.StatusNotFound, `{"message":"Not Found"}`,
+			"per_page=1", http.StatusNotFound, &badge.Params{Subject: "aegis", Status: "workflow not found"},
+		},
+		{
+			"InvalidEvent", "event=schedule", http.StatusOK, "",
+			"", http.StatusBadRequest, &badge.Params{Subject: "aegis", Status: "invalid event"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var path, query string
+			router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				path, query = r.URL.Path, r.URL.RawQuery
+				w.WriteHeader(testCase.statusCode)
+				w.Write([]byte(testCase.body))
+			})
+			defer cleanup()
+			router.Handle(`/github/{method:workflow}/{owner}/{repo}/{workflow}`, router.Get("github").GetHandler())
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/workflow/google/gopacket/ci.yml?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			if testCase.expectedQuery != "" {
+				assert.Equal(t, "/repos/google/gopacket/actions/workflows/ci.yml/runs", path)
+			}
+			assert.Equal(t, testCase.expectedQuery, query)
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubLoginPattern(t *testing.T) {
+	t.Parallel()
+
+	for _, login := range []string{"octocat", "octo-cat", "a", "User123"} {
+		assert.True(t, githubLoginPattern.MatchString(login), login)
+	}
+	for _, login := range []string{"", "-octocat", "octocat-", "octo--cat", "octo cat", "octocat repo:other/repo"} {
+		assert.False(t, githubLoginPattern.MatchString(login), login)
+	}
+}
+
+func TestGithubServiceWithLicense(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		data           string
+		query          string
+		expectedStatus string
+		expectedColor  string
+	}{
+		{"Licensed", `{"repository":{"licenseInfo":{"spdxId":"Apache-2.0","name":"Apache License 2.0"}}}`, "", "Apache-2.0", "blue"},
+		{"Unlicensed", `{"repository":{"licenseInfo":null}}`, "", "not specified", "lightgrey"},
+		{"CustomLicense", `{"repository":{"licenseInfo":{"spdxId":"NOASSERTION","name":"Other"}}}`, "", "Other", "blue"},
+		{"ColorOverride", `{"repository":{"licenseInfo":{"spdxId":"MIT","name":"MIT License"}}}`, "color=green", "MIT", "green"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(testCase.data))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/license/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{
+				Subject: "license",
+				Status:  testCase.expectedStatus,
+				Color:   testCase.expectedColor,
+			}), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithRelease(t *testing.T) {
+	t.Parallel()
+
+	const prereleasesOnly = `{"repository":{"releases":{"nodes":[` +
+		`{"tagName":"v2.0.0-rc.1","isDraft":false,"isPrerelease":true},` +
+		`{"tagName":"v2.0.0-beta.1","isDraft":false,"isPrerelease":true}]}}}`
+	const releases = `{"repository":{"releases":{"nodes":[` +
+		`{"tagName":"v1.5.0","isDraft":true,"isPrerelease":false},` +
+		`{"tagName":"v1.5.0-rc.1","isDraft":false,"isPrerelease":true},` +
+		`{"tagName":"v1.4.2","isDraft":false,"isPrerelease":false}]}}}`
+
+	testCases := []struct {
+		name           string
+		data           string
+		query          string
+		expectedStatus string
+		expectedColor  string
+	}{
+		{"Release", releases, "", "v1.4.2", "blue"},
+		{"ReleaseWithPrereleases", releases, "include_prereleases=true", "v1.5.0-rc.1", "blue"},
+		{"PrereleasesOnly", prereleasesOnly, "", "none", "lightgrey"},
+		{"PrereleasesOnlyWithPrereleases", prereleasesOnly, "include_prereleases=true", "v2.0.0-rc.1", "blue"},
+		{"NoReleases", `{"repository":{"releases":{"nodes":[]}}}`, "", "none", "lightgrey"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(testCase.data))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/release/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{
+				Subject: "release",
+				Status:  testCase.expectedStatus,
+				Color:   testCase.expectedColor,
+			}), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithInvalidIncludePrereleases(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(`{"repository":{"releases":{"nodes":[]}}}`))
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/release/google/gopacket?include_prereleases=maybe", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "invalid include_prereleases"}), res.Body.String())
+}
+
+func TestGithubServiceWithTag(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		data           string
+		expectedStatus string
+		expectedColor  string
+	}{
+		{"Tag", `{"repository":{"refs":{"nodes":[{"name":"v0.3.1"}]}}}`, "v0.3.1", "blue"},
+		{"NoTags", `{"repository":{"refs":{"nodes":[]}}}`, "none", "lightgrey"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(testCase.data))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/tag/google/gopacket", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{
+				Subject: "tag",
+				Status:  testCase.expectedStatus,
+				Color:   testCase.expectedColor,
+			}), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithRefCounts(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name              string
+		path              string
+		expectedRefPrefix string
+		expected          *badge.Params
+	}{
+		{"Branches", "/github/branches/google/gopacket", "refs/heads/", &badge.Params{Subject: "branches", Status: "42"}},
+		{"Tags", "/github/tags/google/gopacket", "refs/tags/", &badge.Params{Subject: "tags", Status: "42"}},
+		{"Overrides", "/github/branches/google/gopacket?subject=stale&color=red", "refs/heads/", &badge.Params{Subject: "stale", Status: "42", Color: "red"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var body struct {
+				Query     string                 `json:"query"`
+				Variables map[string]interface{} `json:"variables"`
+			}
+			router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&body)
+				fakeGithubGraphQLAPI(`{"repository":{"refs":{"totalCount":42}}}`)(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.path, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Contains(t, body.Query, "refs(refPrefix: $refPrefix, first: 0){totalCount}")
+			assert.Equal(t, testCase.expectedRefPrefix, body.Variables["refPrefix"])
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+// fakeGithubReleasesAPI returns a fake GitHub GraphQL API paginating releases with the given asset download counts,
+// a page per slice of releases, recording the cursor of every API call
+// fakeGithubListAPI returns a fake paginated GitHub REST API listing, serving the JSON pages by page number along
+// with a `Link` header to the last page, & the page numbers requested so far
+func fakeGithubListAPI(path string, pages []string, latency time.Duration) (http.HandlerFunc, func() []int) {
+	var mutex sync.Mutex
+	var requested []int
+	return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != path {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			mutex.Lock()
+			requested = append(requested, page)
+			mutex.Unlock()
+			time.Sleep(latency)
+
+			if len(pages) > 1 {
+				w.Header().Set("Link", fmt.Sprintf(`<https://api.github.com%s?page=%d>; rel="last"`, path, len(pages)))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(pages[page-1]))
+		}, func() []int {
+			mutex.Lock()
+			defer mutex.Unlock()
+			sorted := append([]int(nil), requested...)
+			sort.Ints(sorted)
+			return sorted
+		}
+}
+
+// fakeGithubReleasesAPI returns a fake GitHub REST API listing releases, each page listing the download counts of the
+// assets of each release
+func fakeGithubReleasesAPI(pages [][][]int, latency time.Duration) (http.HandlerFunc, func() []int) {
+	var jsonPages []string
+	for _, page := range pages {
+		var releases []string
+		for _, assets := range page {
+			var nodes []string
+			for _, downloadCount := range assets {
+				nodes = append(nodes, fmt.Sprintf(`{"download_count":%d}`, downloadCount))
+			}
+			releases = append(releases, `{"assets":[`+strings.Join(nodes, ",")+`]}`)
+		}
+		jsonPages = append(jsonPages, "["+strings.Join(releases, ",")+"]")
+	}
+	return fakeGithubListAPI("/repos/google/gopacket/releases", jsonPages, latency)
+}
+
+func TestGithubServiceWithDownloads(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		pages          [][][]int
+		query          string
+		expectedStatus string
+		expectedPages  []int
+	}{
+		{"NoReleases", [][][]int{{}}, "", "0", []int{1}},
+		{"SinglePage", [][][]int{{{1200, 34}, {}, {5}}}, "", "1.2k", []int{1}},
+		{"MultiplePages", [][][]int{{{1000}, {200}}, {{30000}}, {{4, 5}}}, "", "31.2k", []int{1, 2, 3}},
+		{"NotHumanized", [][][]int{{{1234}}}, "humanize=false", "1.23k", []int{1}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler, requested := fakeGithubReleasesAPI(testCase.pages, 0)
+			router, cleanup := newTestGithubService(t, &config.Config{}, handler)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/downloads/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{Subject: "downloads", Status: testCase.expectedStatus}), res.Body.String())
+			assert.Equal(t, testCase.expectedPages, requested())
+		})
+	}
+}
+
+func TestGithubServiceWithDownloadsPageCap(t *testing.T) {
+	t.Parallel()
+
+	pages := make([][][]int, githubMaxReleasePages+5)
+	for i := range pages {
+		pages[i] = [][]int{{1}}
+	}
+	handler, requested := fakeGithubReleasesAPI(pages, 0)
+	router, cleanup := newTestGithubService(t, &config.Config{}, handler)
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/downloads/google/gopacket", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "downloads", Status: strconv.Itoa(githubMaxReleasePages)}), res.Body.String())
+	assert.Len(t, requested(), githubMaxReleasePages)
+}
+
+func TestGithubServiceWithDownloadsFetchesPagesConcurrently(t *testing.T) {
+	t.Parallel()
+
+	pages := make([][][]int, githubMaxReleasePages)
+	for i := range pages {
+		pages[i] = [][]int{{1}}
+	}
+	handler, _ := fakeGithubReleasesAPI(pages, fanOutTestLatency)
+	router, cleanup := newTestGithubService(t, &config.Config{}, handler)
+	defer cleanup()
+
+	// the pages after the first page are fetched in about the latency of a single page
+	start := time.Now()
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/downloads/google/gopacket", nil)
+	router.ServeHTTP(res, req)
+	elapsed := time.Since(start)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "downloads", Status: strconv.Itoa(githubMaxReleasePages)}), res.Body.String())
+	assert.True(t, elapsed < 5*fanOutTestLatency, elapsed)
+}
+
+// newTestGithubAccountRouter returns a router serving the badges of GitHub users & organizations with the handler
+// of the router returned by `newTestGithubService`
+func newTestGithubAccountRouter(router *mux.Router) *mux.Router {
+	accountRouter := mux.NewRouter()
+	accountRouter.Handle(`/github/{account:user}/{owner}/{method:followers|repos|sponsors}`, router.Get("github").GetHandler())
+	accountRouter.Handle(`/github/{account:org}/{owner}/{method:stars}`, router.Get("github").GetHandler())
+	return accountRouter
+}
+
+func TestGithubServiceWithSponsors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name               string
+		login              string
+		data               string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{
+			"User", "octocat", `{"repositoryOwner":{"sponsorshipsAsMaintainer":{"totalCount":42}}}`,
+			http.StatusOK, &badge.Params{Subject: "sponsors", Status: "42", Color: "pink"},
+		},
+		{
+			"Organization", "github", `{"repositoryOwner":{"sponsorshipsAsMaintainer":{"totalCount":1234}}}`,
+			http.StatusOK, &badge.Params{Subject: "sponsors", Status: "1.23k", Color: "pink"},
+		},
+		{
+			"NotSponsorable", "octo-org", `{"repositoryOwner":{"sponsorshipsAsMaintainer":{"totalCount":0}}}`,
+			http.StatusOK, &badge.Params{Subject: "sponsors", Status: "0", Color: "pink"},
+		},
+		{
+			"NotFound", "ghost-org", `{"repositoryOwner":null}`,
+			http.StatusNotFound, &badge.Params{Subject: "aegis", Status: "account not found"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var query, login string
+			router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Query     string            `json:"query"`
+					Variables map[string]string `json:"variables"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				query, login = body.Query, body.Variables["login"]
+				fakeGithubGraphQLAPI(testCase.data)(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/user/"+testCase.login+"/sponsors", nil)
+			newTestGithubAccountRouter(router).ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.login, login)
+			assert.Contains(t, query, "repositoryOwner(login: $login){... on Sponsorable{sponsorshipsAsMaintainer(activeOnly: true){totalCount}}}")
+		})
+	}
+}
+
+func TestGithubServiceWithUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		url           string
+		data          string
+		expectedQuery string
+		expected      *badge.Params
+	}{
+		{
+			"Followers", "/github/user/octocat/followers", `{"user":{"followers":{"totalCount":12345}}}`,
+			"followers{totalCount}", &badge.Params{Subject: "followers", Status: "12.3k"},
+		},
+		{
+			"Repos", "/github/user/octocat/repos", `{"user":{"repositories":{"totalCount":8}}}`,
+			"repositories(privacy: PUBLIC, ownerAffiliations: [OWNER]){totalCount}", &badge.Params{Subject: "repos", Status: "8"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var query, login string
+			router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Query     string            `json:"query"`
+					Variables map[string]string `json:"variables"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				query, login = body.Query, body.Variables["login"]
+				fakeGithubGraphQLAPI(testCase.data)(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			newTestGithubAccountRouter(router).ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Contains(t, query, testCase.expectedQuery)
+			assert.Equal(t, "octocat", login)
+		})
+	}
+}
+
+// fakeGithubOrgRepositoriesAPI returns a fake GitHub GraphQL API paginating the repositories of an organization with
+// the given star counts, a page per slice of repositories, recording the cursor of every API call
+// fakeGithubOrgRepositoriesAPI returns a fake GitHub REST API listing the repositories of an organization, each page
+// listing the stargazer counts of the repositories
+func fakeGithubOrgRepositoriesAPI(pages [][]int, latency time.Duration) (http.HandlerFunc, func() []int) {
+	var jsonPages []string
+	for _, page := range pages {
+		var repositories []string
+		for _, stargazersCount := range page {
+			repositories = append(repositories, fmt.Sprintf(`{"stargazers_count":%d}`, stargazersCount))
+		}
+		jsonPages = append(jsonPages, "["+strings.Join(repositories, ",")+"]")
+	}
+	return fakeGithubListAPI("/orgs/google/repos", jsonPages, latency)
+}
+
+func TestGithubServiceWithOrgStars(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		pages          [][]int
+		expectedStatus string
+		expectedPages  []int
+	}{
+		{"NoRepositories", [][]int{{}}, "0", []int{1}},
+		{"SinglePage", [][]int{{12, 30, 0}}, "42", []int{1}},
+		{"MultiplePages", [][]int{{1000, 200}, {30}, {4, 5}}, "1.24k", []int{1, 2, 3}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler, requested := fakeGithubOrgRepositoriesAPI(testCase.pages, 0)
+			router, cleanup := newTestGithubService(t, &config.Config{}, handler)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/org/google/stars", nil)
+			newTestGithubAccountRouter(router).ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{Subject: "stars", Status: testCase.expectedStatus}), res.Body.String())
+			assert.Equal(t, testCase.expectedPages, requested())
+		})
+	}
+}
+
+func TestGithubServiceWithOrgStarsPageCap(t *testing.T) {
+	t.Parallel()
+
+	pages := make([][]int, githubMaxOrgRepositoryPages+5)
+	for i := range pages {
+		pages[i] = []int{1}
+	}
+	handler, requested := fakeGithubOrgRepositoriesAPI(pages, 0)
+	router, cleanup := newTestGithubService(t, &config.Config{}, handler)
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/org/google/stars", nil)
+	newTestGithubAccountRouter(router).ServeHTTP(res, req)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "stars", Status: strconv.Itoa(githubMaxOrgRepositoryPages) + "+"}), res.Body.String())
+	assert.Len(t, requested(), githubMaxOrgRepositoryPages)
+}
+
+func TestGithubServiceWithOrgStarsFetchesPagesConcurrently(t *testing.T) {
+	t.Parallel()
+
+	pages := make([][]int, githubMaxOrgRepositoryPages)
+	for i := range pages {
+		pages[i] = []int{1}
+	}
+	handler, _ := fakeGithubOrgRepositoriesAPI(pages, fanOutTestLatency)
+	router, cleanup := newTestGithubService(t, &config.Config{}, handler)
+	defer cleanup()
+
+	// the pages after the first page are fetched in about the latency of a single page
+	start := time.Now()
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/org/google/stars", nil)
+	newTestGithubAccountRouter(router).ServeHTTP(res, req)
+	elapsed := time.Since(start)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "stars", Status: strconv.Itoa(githubMaxOrgRepositoryPages)}), res.Body.String())
+	assert.True(t, elapsed < 5*fanOutTestLatency, elapsed)
+}
+
+func TestGithubServiceWithMissingOrg(t *testing.T) {
+	t.Parallel()
+
+	handler, _ := fakeGithubOrgRepositoriesAPI([][]int{{1}}, 0)
+	router, cleanup := newTestGithubService(t, &config.Config{}, handler)
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/org/missing/stars", nil)
+	newTestGithubAccountRouter(router).ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "account not found"}), res.Body.String())
+}
+
+func TestGithubServiceGetOrgStarCountWithCanceledContext(t *testing.T) {
+	t.Parallel()
+
+	handler, requested := fakeGithubOrgRepositoriesAPI([][]int{{1}, {2}}, 0)
+	fakeAPI := httptest.NewServer(handler)
+	defer fakeAPI.Close()
+	service := &githubService{baseURL: fakeAPI.URL, httpClient: fakeAPI.Client()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := service.getOrgStarCount(ctx, "google")
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, requested())
+}
+
+func TestGithubServiceWithReleaseDownloads(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name               string
+		data               string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{
+			"Release",
+			`{"repository":{"release":{"releaseAssets":{"nodes":[{"downloadCount":40},{"downloadCount":2}]}}}}`,
+			http.StatusOK,
+			&badge.Params{Subject: "downloads", Status: "42"},
+		},
+		{
+			"MissingRelease",
+			`{"repository":{"release":null}}`,
+			http.StatusNotFound,
+			&badge.Params{Subject: "aegis", Status: "release not found"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var tag interface{}
+			router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Variables map[string]interface{} `json:"variables"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				tag = body.Variables["tag"]
+				fakeGithubGraphQLAPI(testCase.data)(w, r)
+			})
+			defer cleanup()
+			router.Handle(`/github/{method:downloads}/{owner}/{repo}/{tag}`, router.Get("github").GetHandler())
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/downloads/google/gopacket/v1.1.19", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, "v1.1.19", tag)
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithDiscussions(t *testing.T) {
+	t.Parallel()
+
+	// the fake API knows the "Q&A" & "Ideas" discussion categories
+	fakeAPI := func(enabled bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Query     string                 `json:"query"`
+				Variables map[string]interface{} `json:"variables"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			switch {
+			case strings.Contains(body.Query, "discussionCategories"):
+				fakeGithubGraphQLAPI(fmt.Sprintf(`{"repository":{"hasDiscussionsEnabled":%t,"discussionCategories":{"nodes":[`+
+					`{"id":"DIC_qa","name":"Q&A"},{"id":"DIC_ideas","name":"Ideas"}]}}}`, enabled))(w, r)
+			case body.Variables["categoryId"] == "DIC_qa":
+				fakeGithubGraphQLAPI(`{"repository":{"hasDiscussionsEnabled":true,"discussions":{"totalCount":12}}}`)(w, r)
+			default:
+				fakeGithubGraphQLAPI(fmt.Sprintf(`{"repository":{"hasDiscussionsEnabled":%t,"discussions":{"totalCount":42}}}`, enabled))(w, r)
+			}
+		}
+	}
+
+	testCases := []struct {
+		name               string
+		enabled            bool
+		query              string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{"Enabled", true, "", http.StatusOK, &badge.Params{Subject: "discussions", Status: "42"}},
+		{"Disabled", false, "", http.StatusOK, &badge.Params{Subject: "discussions", Status: "disabled", Color: "lightgrey"}},
+		{"Category", true, "category=Q%26A", http.StatusOK, &badge.Params{Subject: "discussions", Status: "12"}},
+		{"CategoryWithDifferentCase", true, "category=q%26a", http.StatusOK, &badge.Params{Subject: "discussions", Status: "12"}},
+		{"CategoryWhileDisabled", false, "category=Q%26A", http.StatusOK, &badge.Params{Subject: "discussions", Status: "disabled", Color: "lightgrey"}},
+		{"MissingCategory", true, "category=Polls", http.StatusNotFound, &badge.Params{Subject: "aegis", Status: "category not found"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeAPI(testCase.enabled))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/discussions/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithVulnerabilities(t *testing.T) {
+	t.Parallel()
+
+	forbidden := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"repository":{"vulnerabilityAlerts":null}},"errors":[{"type":"FORBIDDEN",` +
+			`"path":["repository","vulnerabilityAlerts"],"message":"Resource not accessible by integration"}]}`))
+	}
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"repository":null},"errors":[{"type":"NOT_FOUND","path":["repository"],` +
+			`"message":"Could not resolve to a Repository with the name 'google/gopacket'."}]}`))
+	}
+
+	testCases := []struct {
+		name                 string
+		fakeAPI              http.HandlerFunc
+		expectedStatusCode   int
+		expectedCacheControl string
+		expected             *badge.Params
+	}{
+		{"Accessible", fakeGithubGraphQLAPI(`{"repository":{"vulnerabilityAlerts":{"totalCount":3}}}`),
+			http.StatusOK, "public, max-age=0, s-maxage=0",
+			&badge.Params{Subject: "vulnerabilities", Status: "3", Color: "red"}},
+		{"NoAlerts", fakeGithubGraphQLAPI(`{"repository":{"vulnerabilityAlerts":{"totalCount":0}}}`),
+			http.StatusOK, "public, max-age=0, s-maxage=0",
+			&badge.Params{Subject: "vulnerabilities", Status: "0", Color: "green"}},
+		{"Forbidden", forbidden, http.StatusForbidden, "no-store", &badge.Params{Subject: "aegis", Status: "no access"}},
+		{"RepositoryNotFound", notFound, http.StatusNotFound, "public, max-age=0, s-maxage=0",
+			&badge.Params{Subject: "aegis", Status: "repository not found"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, testCase.fakeAPI)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/vulnerabilities/google/gopacket", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, testCase.expectedCacheControl, res.Header().Get("Cache-Control"))
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestBuildIssueBreakdownQuery(t *testing.T) {
+	t.Parallel()
+
+	query := buildIssueBreakdownQuery(2)
+	assert.True(t, strings.HasPrefix(query, "query($owner: String!, $repo: String!, $label0: String!, $label1: String!) {"), query)
+	assert.Contains(t, query, "label0: label(name: $label0) {")
+	assert.Contains(t, query, "label1: label(name: $label1) {")
+	assert.NotContains(t, query, "label2")
+}
+
+func TestGithubServiceWithIssueBreakdown(t *testing.T) {
+	t.Parallel()
+
+	// every label is fetched by a single aliased GraphQL query
+	var requests []map[string]interface{}
+	var mu sync.Mutex
+	fakeAPI := func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		requests = append(requests, body)
+		mu.Unlock()
+		fakeGithubGraphQLAPI(`{"repository":{`+
+			`"label0":{"color":"d73a4a","issues":{"totalCount":12}},`+
+			`"label1":{"color":"a2eeef","issues":{"totalCount":0}},`+
+			`"label2":null}}`)(w, r)
+	}
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"Labels", "/github/issue-breakdown/google/gopacket?labels=bug,%20enhancement,wontfix,bug", &badge.Params{Subject: "issues", MaxWidth: githubIssueBreakdownMaxWidth, Segments: []badge.Segment{
+			{Text: "bug 12", Color: "#d73a4a", Label: "bug: 12"},
+			{Text: "enhancement 0", Color: "#a2eeef", Label: "enhancement: 0"},
+			{Text: "wontfix 0", Color: "lightgrey", Label: "wontfix: 0"},
+		}}},
+		{"HideEmpty", "/github/issue-breakdown/google/gopacket?labels=bug,enhancement,wontfix&hideEmpty=true", &badge.Params{Subject: "issues", MaxWidth: githubIssueBreakdownMaxWidth, Segments: []badge.Segment{
+			{Text: "bug 12", Color: "#d73a4a", Label: "bug: 12"},
+		}}},
+		{"MaxWidth", "/github/issue-breakdown/google/gopacket?labels=bug,enhancement,wontfix&maxWidth=150", &badge.Params{Subject: "issues", MaxWidth: 150, Segments: []badge.Segment{
+			{Text: "bug 12", Color: "#d73a4a", Label: "bug: 12"},
+			{Text: "enhancement 0", Color: "#a2eeef", Label: "enhancement: 0"},
+			{Text: "wontfix 0", Color: "lightgrey", Label: "wontfix: 0"},
+		}}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			mu.Lock()
+			requests = nil
+			mu.Unlock()
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeAPI)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			mu.Lock()
+			defer mu.Unlock()
+			if assert.Len(t, requests, 1) {
+				assert.Equal(t, buildIssueBreakdownQuery(3), requests[0]["query"])
+				assert.Equal(t, map[string]interface{}{"owner": "google", "repo": "gopacket", "label0": "bug",
+					"label1": "enhancement", "label2": "wontfix"}, requests[0]["variables"])
+			}
+		})
+	}
+}
+
+func TestGithubServiceWithIssueBreakdownWidthCap(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(`{"repository":{`+
+		`"label0":{"color":"d73a4a","issues":{"totalCount":12}},`+
+		`"label1":{"color":"a2eeef","issues":{"totalCount":3}},`+
+		`"label2":{"color":"cfd3d7","issues":{"totalCount":1}}}}`))
+	defer cleanup()
+
+	// only the leading labels that fit within the maximum width are kept
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/issue-breakdown/google/gopacket?labels=bug,enhancement,duplicate&maxWidth=150", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), "<title>issues: bug: 12</title>")
+	assert.NotContains(t, res.Body.String(), "duplicate")
+	width, err := strconv.Atoi(regexp.MustCompile(`<svg[^>]* width="(\d+)"`).FindStringSubmatch(res.Body.String())[1])
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, width, 150)
+}
+
+func TestGithubServiceWithInvalidIssueBreakdown(t *testing.T) {
+	t.Parallel()
+
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"repository":null},"errors":[{"type":"NOT_FOUND","path":["repository"],` +
+			`"message":"Could not resolve to a Repository with the name 'google/gopacket'."}]}`))
+	}
+
+	testCases := []struct {
+		name               string
+		url                string
+		expectedStatusCode int
+		expected           string
+	}{
+		{"MissingLabels", "/github/issue-breakdown/google/gopacket", http.StatusBadRequest, "labels"},
+		{"EmptyLabels", "/github/issue-breakdown/google/gopacket?labels=,%20", http.StatusBadRequest, "labels"},
+		{"TooManyLabels", "/github/issue-breakdown/google/gopacket?labels=a,b,c,d,e,f,g,h,i", http.StatusBadRequest, "labels"},
+		{"RepositoryNotFound", "/github/issue-breakdown/google/gopacket?labels=bug", http.StatusNotFound, "repository not found"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, notFound)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Contains(t, res.Body.String(), testCase.expected)
+		})
+	}
+}
+
+// readDependentsFixture returns the HTML of a tab of the GitHub dependents page saved in testdata
+func readDependentsFixture(t *testing.T, tab string) []byte {
+	page, err := ioutil.ReadFile(filepath.Join("testdata", "github", "dependents", tab+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestParseDependentCount(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		page     string
+		expected int
+	}{
+		{"RepositoriesTab", string(readDependentsFixture(t, "repositories")), 4829 + 312},
+		{"PackagesTab", string(readDependentsFixture(t, "packages")), 4829 + 312},
+		{"Singular", `<a>1 Repository</a><a>1 Package</a>`, 2},
+		{"WithoutPackages", "<a href=\"?dependent_type=REPOSITORY\">\n  <svg></svg>\n  1,234,567\n  Repositories\n</a>", 1234567},
+		{"ListedTwice", `<a>12 Repositories</a><a>3 Packages</a><a>12 Repositories</a>`, 15},
+	}
+
+	for _, testCase := range testCases {
+		count, err := parseDependentCount([]byte(testCase.page))
+		assert.NoError(t, err, testCase.name)
+		assert.Equal(t, testCase.expected, count, testCase.name)
+	}
+
+	_, err := parseDependentCount([]byte(`<html><body>Page not found</body></html>`))
+	assert.Equal(t, errGithubDependentsNotFound, err)
+}
+
+func TestGithubServiceWithDependents(t *testing.T) {
+	t.Parallel()
+
+	fakeAPI := func(statusCode int, page []byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// access tokens of the API are never sent to the website
+			if r.URL.Path != "/google/gopacket/network/dependents" || r.Header.Get("Authorization") != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(statusCode)
+			w.Write(page)
+		}
+	}
+
+	testCases := []struct {
+		name                 string
+		fakeAPI              http.HandlerFunc
+		query                string
+		expectedCacheControl string
+		expected             *badge.Params
+	}{
+		{"RepositoriesTab", fakeAPI(http.StatusOK, readDependentsFixture(t, "repositories")), "",
+			"public, max-age=21600, s-maxage=21600", &badge.Params{Subject: "used by", Status: "5.14k"}},
+		{"PackagesTab", fakeAPI(http.StatusOK, readDependentsFixture(t, "packages")), "",
+			"public, max-age=21600, s-maxage=21600", &badge.Params{Subject: "used by", Status: "5.14k"}},
+		{"CacheSeconds", fakeAPI(http.StatusOK, readDependentsFixture(t, "repositories")), "cacheSeconds=3600",
+			"public, max-age=3600, s-maxage=3600", &badge.Params{Subject: "used by", Status: "5.14k"}},
+		{"UnparsablePage", fakeAPI(http.StatusOK, []byte(`<html><body>Redesigned</body></html>`)), "",
+			"public, max-age=300, s-maxage=300", &badge.Params{Subject: "used by", Status: "unknown", Color: "lightgrey"}},
+		{"UpstreamError", fakeAPI(http.StatusInternalServerError, nil), "cacheSeconds=3600",
+			"public, max-age=300, s-maxage=300", &badge.Params{Subject: "used by", Status: "unknown", Color: "lightgrey"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			configuration := &config.Config{CacheSeconds: 3600, MinCacheSeconds: 300, MaxCacheSeconds: 86400}
+			router, cleanup := newTestGithubService(t, configuration, testCase.fakeAPI)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/dependents/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, testCase.expectedCacheControl, res.Header().Get("Cache-Control"))
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestMilestoneStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		milestone      githubMilestone
+		expectedStatus string
+		expectedColor  string
+	}{
+		{githubMilestone{openIssueCount: 0, closedIssueCount: 0}, "0/0 (0%)", "orange"},
+		{githubMilestone{openIssueCount: 9, closedIssueCount: 1}, "1/10 (10%)", "orange"},
+		{githubMilestone{openIssueCount: 3, closedIssueCount: 1}, "1/4 (25%)", "yellow"},
+		{githubMilestone{openIssueCount: 3, closedIssueCount: 7}, "7/10 (70%)", "yellowgreen"},
+		{githubMilestone{openIssueCount: 1, closedIssueCount: 199}, "199/200 (99%)", "green"},
+		{githubMilestone{openIssueCount: 0, closedIssueCount: 10}, "10/10 (100%)", "brightgreen"},
+		{githubMilestone{closed: true, openIssueCount: 3, closedIssueCount: 7}, "closed", "lightgrey"},
+	}
+
+	for _, testCase := range testCases {
+		status, color := milestoneStatus(testCase.milestone)
+		assert.Equal(t, testCase.expectedStatus, status)
+		assert.Equal(t, testCase.expectedColor, color, testCase.expectedStatus)
+	}
+}
+
+func TestGithubServiceWithMilestone(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name               string
+		data               string
+		query              string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{
+			"Open",
+			`{"repository":{"milestone":{"title":"v2.0","state":"OPEN","openIssues":{"totalCount":3},"closedIssues":{"totalCount":7}}}}`,
+			"",
+			http.StatusOK,
+			&badge.Params{Subject: "v2.0", Status: "7/10 (70%)", Color: "yellowgreen"},
+		},
+		{
+			"Overrides",
+			`{"repository":{"milestone":{"title":"v2.0","state":"OPEN","openIssues":{"totalCount":3},"closedIssues":{"totalCount":7}}}}`,
+			"subject=next&color=blue",
+			http.StatusOK,
+			&badge.Params{Subject: "next", Status: "7/10 (70%)", Color: "blue"},
+		},
+		{
+			"Closed",
+			`{"repository":{"milestone":{"title":"v1.0","state":"CLOSED","openIssues":{"totalCount":0},"closedIssues":{"totalCount":12}}}}`,
+			"",
+			http.StatusOK,
+			&badge.Params{Subject: "v1.0", Status: "closed", Color: "lightgrey"},
+		},
+		{
+			"Missing",
+			`{"repository":{"milestone":null}}`,
+			"",
+			http.StatusNotFound,
+			&badge.Params{Subject: "aegis", Status: "not found"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var number interface{}
+			router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Variables map[string]interface{} `json:"variables"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				number = body.Variables["number"]
+				fakeGithubGraphQLAPI(testCase.data)(w, r)
+			})
+			defer cleanup()
+			router.Handle(`/github/{method:milestone}/{owner}/{repo}/{number:[0-9]+}`, router.Get("github").GetHandler())
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/milestone/google/gopacket/3?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, 3.0, number)
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithCommits(t *testing.T) {
+	t.Parallel()
+
+	// the fake API only knows the default branch & the "release-1.0" branch
+	fakeAPI := func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case strings.Contains(body.Query, "defaultBranchRef"):
+			fakeGithubGraphQLAPI(`{"repository":{"defaultBranchRef":{"target":{"history":{"totalCount":123456}}}}}`)(w, r)
+		case body.Variables["branch"] == "refs/heads/release-1.0":
+			fakeGithubGraphQLAPI(`{"repository":{"ref":{"target":{"history":{"totalCount":42}}}}}`)(w, r)
+		default:
+			fakeGithubGraphQLAPI(`{"repository":{"ref":null}}`)(w, r)
+		}
+	}
+
+	testCases := []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{"DefaultBranch", "", http.StatusOK, &badge.Params{Subject: "commits", Status: "123k"}},
+		{"DefaultBranchHumanized", "humanize", http.StatusOK, &badge.Params{Subject: "commits", Status: "123.5k"}},
+		{"ExplicitBranch", "branch=release-1.0", http.StatusOK, &badge.Params{Subject: "commits", Status: "42"}},
+		{"MissingBranch", "branch=release-2.0", http.StatusNotFound, &badge.Params{Subject: "aegis", Status: "branch not found"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeAPI)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/commits/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithLanguage(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		method   string
+		data     string
+		query    string
+		expected *badge.Params
+	}{
+		{
+			"MonoLanguage", "language",
+			`{"repository":{"primaryLanguage":{"name":"Go","color":"#00ADD8"}}}`, "",
+			&badge.Params{Subject: "language", Status: "Go", Color: "#00ADD8"},
+		},
+		{
+			"LanguageWithoutColor", "language",
+			`{"repository":{"primaryLanguage":{"name":"Nix","color":null}}}`, "",
+			&badge.Params{Subject: "language", Status: "Nix", Color: "blue"},
+		},
+		{
+			"ColorOverride", "language",
+			`{"repository":{"primaryLanguage":{"name":"Go","color":"#00ADD8"}}}`, "color=green",
+			&badge.Params{Subject: "language", Status: "Go", Color: "green"},
+		},
+		{
+			"EmptyRepository", "language",
+			`{"repository":{"primaryLanguage":null}}`, "",
+			&badge.Params{Subject: "language", Status: "unknown", Color: "lightgrey"},
+		},
+		{
+			"MonoLanguageShare", "languages",
+			`{"repository":{"languages":{"totalSize":4096,"edges":[{"size":4096,"node":{"name":"Go","color":"#00ADD8"}}]}}}`, "",
+			&badge.Params{Subject: "language", Status: "Go 100.0%", Color: "#00ADD8"},
+		},
+		{
+			"MultiLanguageShare", "languages",
+			`{"repository":{"languages":{"totalSize":10000,"edges":[` +
+				`{"size":8734,"node":{"name":"Go","color":"#00ADD8"}},` +
+				`{"size":1266,"node":{"name":"Shell","color":"#89e051"}}]}}}`, "",
+			&badge.Params{Subject: "language", Status: "Go 87.3%", Color: "#00ADD8"},
+		},
+		{
+			"EmptyRepositoryShare", "languages",
+			`{"repository":{"languages":{"totalSize":0,"edges":[]}}}`, "",
+			&badge.Params{Subject: "language", Status: "unknown", Color: "lightgrey"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(testCase.data))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/"+testCase.method+"/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithAge(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name               string
+		createdAt          string
+		query              string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{"Years", "2018-01-20T09:30:00Z", "", http.StatusOK, &badge.Params{Subject: "created", Status: "6 years", Color: "blue"}},
+		{"Months", "2023-11-02T00:00:00Z", "display=relative", http.StatusOK, &badge.Params{Subject: "created", Status: "4 months", Color: "blue"}},
+		{"Days", "2024-03-01T00:00:00Z", "", http.StatusOK, &badge.Params{Subject: "created", Status: "14 days", Color: "blue"}},
+		{"Date", "2018-01-20T09:30:00Z", "display=date", http.StatusOK, &badge.Params{Subject: "created", Status: "january 2018", Color: "blue"}},
+		{"Overrides", "2018-01-20T09:30:00Z", "subject=age&color=green", http.StatusOK, &badge.Params{Subject: "age", Status: "6 years", Color: "green"}},
+		{"InvalidDisplay", "2018-01-20T09:30:00Z", "display=absolute", http.StatusBadRequest, &badge.Params{Subject: "aegis", Status: "invalid display"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(`{"repository":{"createdAt":"`+testCase.createdAt+`"}}`))
+			defer cleanup()
+			router.Get("github").GetHandler().(*githubService).now = func() time.Time { return now }
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/age/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		data     string
+		expected *badge.Params
+	}{
+		{"Active", `{"repository":{"isArchived":false,"isDisabled":false}}`, &badge.Params{Subject: "status", Status: "active", Color: "green"}},
+		{"Archived", `{"repository":{"isArchived":true,"isDisabled":false}}`, &badge.Params{Subject: "status", Status: "archived", Color: "grey"}},
+		{"Disabled", `{"repository":{"isArchived":true,"isDisabled":true}}`, &badge.Params{Subject: "status", Status: "disabled", Color: "red"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(testCase.data))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/status/google/gopacket", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithDimArchived(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name               string
+		isArchived         bool
+		query              string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{"Archived", true, "dim_archived=true", http.StatusOK, &badge.Params{Subject: "issues", Status: "12", Color: "grey"}},
+		{"Active", false, "dim_archived=true", http.StatusOK, &badge.Params{Subject: "issues", Status: "12"}},
+		{"NotDimmed", true, "dim_archived=false", http.StatusOK, &badge.Params{Subject: "issues", Status: "12"}},
+		{"ColorOverride", true, "dim_archived=true&color=blue", http.StatusOK, &badge.Params{Subject: "issues", Status: "12", Color: "blue"}},
+		{"InvalidDimArchived", true, "dim_archived=maybe", http.StatusBadRequest, &badge.Params{Subject: "aegis", Status: "invalid dim_archived"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Query string `json:"query"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				if strings.Contains(body.Query, "isArchived") {
+					fakeGithubGraphQLAPI(fmt.Sprintf(`{"repository":{"isArchived":%t,"isDisabled":false}}`, testCase.isArchived))(w, r)
+					return
+				}
+				fakeGithubGraphQLAPI(`{"repository":{"issues":{"totalCount":12}}}`)(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/issues/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithLastCommit(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	fakeAPI := func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch body.Variables["branch"] {
+		case nil:
+			fakeGithubGraphQLAPI(`{"repository":{"defaultBranchRef":{"target":{"committedDate":"2024-03-12T09:30:00Z"}}}}`)(w, r)
+		case "refs/heads/legacy":
+			fakeGithubGraphQLAPI(`{"repository":{"ref":{"target":{"committedDate":"2022-01-20T00:00:00Z"}}}}`)(w, r)
+		case "refs/heads/release-1.0":
+			fakeGithubGraphQLAPI(`{"repository":{"ref":{"target":{"committedDate":"2023-11-02T00:00:00Z"}}}}`)(w, r)
+		default:
+			fakeGithubGraphQLAPI(`{"repository":{"ref":null}}`)(w, r)
+		}
+	}
+
+	testCases := []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{"Relative", "", http.StatusOK, &badge.Params{Subject: "last commit", Status: "3 days ago", Color: "green"}},
+		{"Date", "display=date", http.StatusOK, &badge.Params{Subject: "last commit", Status: "march 2024", Color: "green"}},
+		{"StaleBranch", "branch=release-1.0", http.StatusOK, &badge.Params{Subject: "last commit", Status: "4 months ago", Color: "yellow"}},
+		{"AbandonedBranch", "branch=legacy&display=relative", http.StatusOK, &badge.Params{Subject: "last commit", Status: "2 years ago", Color: "red"}},
+		{"ColorOverride", "branch=legacy&color=blue", http.StatusOK, &badge.Params{Subject: "last commit", Status: "2 years ago", Color: "blue"}},
+		{"MissingBranch", "branch=main", http.StatusNotFound, &badge.Params{Subject: "aegis", Status: "branch not found"}},
+		{"InvalidDisplay", "display=absolute", http.StatusBadRequest, &badge.Params{Subject: "aegis", Status: "invalid display"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeAPI)
+			defer cleanup()
+			router.Get("github").GetHandler().(*githubService).now = func() time.Time { return now }
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/last-commit/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithSize(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expected           *badge.Params
+	}{
+		{"SI", "", http.StatusOK, &badge.Params{Subject: "repo size", Status: "4.2 MB", Color: "blue"}},
+		{"ExplicitSI", "units=si", http.StatusOK, &badge.Params{Subject: "repo size", Status: "4.2 MB", Color: "blue"}},
+		{"Binary", "units=binary", http.StatusOK, &badge.Params{Subject: "repo size", Status: "4.1 MiB", Color: "blue"}},
+		{"InvalidUnits", "units=metric", http.StatusBadRequest, &badge.Params{Subject: "aegis", Status: "invalid units"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(`{"repository":{"diskUsage":4200}}`))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/size/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceGetWatcherCount(t *testing.T) {
+	t.Parallel()
+
+	var query string
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query string `json:"query"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		query = body.Query
+		fakeGithubGraphQLAPI(`{"repository":{"watchers":{"totalCount":42}}}`)(w, r)
+	}))
+	defer fakeAPI.Close()
+	service := &githubService{client: githubv4.NewEnterpriseClient(fakeAPI.URL, fakeAPI.Client())}
+
+	watcherCount, err := service.getWatcherCount(context.Background(), "google", "gopacket")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, watcherCount)
+	assert.Contains(t, query, "watchers{totalCount}")
+}
+
+func TestGithubServiceWithWatchers(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected *badge.Params
+	}{
+		{"Default", "", &badge.Params{Subject: "watchers", Status: "42"}},
+		{"Overrides", "subject=watching&status=many&color=green", &badge.Params{Subject: "watching", Status: "many", Color: "green"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(`{"repository":{"watchers":{"totalCount":42}}}`))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/watchers/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithLicenseCheck(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		data           string
+		query          string
+		expectedStatus string
+		expectedColor  string
+	}{
+		{"Compliant", `{"repository":{"licenseInfo":{"spdxId":"BSD-3-Clause"}}}`, "allow=MIT,Apache-2.0,BSD-3-Clause", "compliant", "green"},
+		{"CompliantWithDifferentCase", `{"repository":{"licenseInfo":{"spdxId":"MIT"}}}`, "allow=mit", "compliant", "green"},
+		{"Review", `{"repository":{"licenseInfo":{"spdxId":"GPL-3.0"}}}`, "allow=MIT,Apache-2.0", "review", "red"},
+		{"Unrecognized", `{"repository":{"licenseInfo":{"spdxId":"NOASSERTION"}}}`, "allow=MIT", "unknown", "lightgrey"},
+		{"Undetected", `{"repository":{"licenseInfo":null}}`, "allow=MIT", "unknown", "lightgrey"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(testCase.data))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/license-check/google/gopacket?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{
+				Subject: "license",
+				Status:  testCase.expectedStatus,
+				Color:   testCase.expectedColor,
+			}), res.Body.String())
+		})
+	}
+}
+
+func TestGithubServiceWithInvalidLicenseAllowlist(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	router, cleanup := newTestGithubService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fakeGithubGraphQLAPI(`{"repository":{"licenseInfo":{"spdxId":"MIT"}}}`)(w, r)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/license-check/google/gopacket?allow=MIT,apache2", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{
+		Subject: "aegis",
+		Status:  `invalid allow: license "apache2" is not a SPDX license ID, valid forms: Apache-2.0`,
+	}), res.Body.String())
+	assert.Equal(t, 0, calls)
+}
+
+func TestGithubServiceWithHealth(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	testCases := []struct {
+		name           string
+		data           string
+		expectedStatus string
+		expectedColor  string
+		expectedTitle  string
+	}{
+		{
+			"Healthy",
+			`{"repository":{
+				"defaultBranchRef":{"target":{"committedDate":"` + now.Format(time.RFC3339) + `","status":{"state":"SUCCESS"},"checkSuites":{"totalCount":0}}},
+				"openIssues":{"totalCount":10},"closedIssues":{"totalCount":90},
+				"licenseInfo":{"spdxId":"MIT"},
+				"releases":{"nodes":[{"publishedAt":"` + now.AddDate(0, 0, -7).Format(time.RFC3339) + `"}]}}}`,
+			"healthy", "green", "health score: 98/100",
+		},
+		{
+			"AtRisk",
+			`{"repository":{
+				"defaultBranchRef":{"target":{"committedDate":"` + now.AddDate(-2, 0, 0).Format(time.RFC3339) + `","status":null,"checkSuites":{"totalCount":0}}},
+				"openIssues":{"totalCount":30},"closedIssues":{"totalCount":10},
+				"licenseInfo":{"spdxId":"MIT"},
+				"releases":{"nodes":[]}}}`,
+			"at risk", "red", "health score: 20/100",
+		},
+		{
+			"EmptyRepository",
+			`{"repository":{"defaultBranchRef":null,"openIssues":{"totalCount":0},"closedIssues":{"totalCount":0},"licenseInfo":null,"releases":{"nodes":[]}}}`,
+			"at risk", "red", "health score: 20/100",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			calls := 0
+			configuration := &config.Config{
+				EnableHealthBadge: true,
+				HealthWeights:     map[string]uint{"commit": 30, "issues": 20, "license": 15, "ci": 15, "release": 20},
+			}
+			router, cleanup := newTestGithubService(t, configuration, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				fakeGithubGraphQLAPI(testCase.data)(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/health/google/gopacket", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{
+				Subject: "health",
+				Status:  testCase.expectedStatus,
+				Color:   testCase.expectedColor,
+				Title:   testCase.expectedTitle,
+			}), res.Body.String())
+			assert.Equal(t, 1, calls)
+		})
+	}
+}
+
+func TestGithubServiceWithHealthDisabled(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestGithubService(t, &config.Config{}, fakeGithubGraphQLAPI(`{}`))
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/health/google/gopacket", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "not found"}), res.Body.String())
+}
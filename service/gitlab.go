@@ -1,23 +1,50 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/tohjustin/aegis/pkg/badge"
 	"github.com/tohjustin/aegis/service/config"
 )
 
+const (
+	// gitlabAPIBaseURL represents the base URL of the GitLab REST API
+	gitlabAPIBaseURL = "https://gitlab.com/api/v4"
+	// gitlabIssuesPerPage represents the number of issues fetched per page when summing issue weights
+	gitlabIssuesPerPage = 100
+	// gitlabMaxIssuePages represents the maximum number of pages of issues fetched when summing issue weights
+	gitlabMaxIssuePages = 10
+)
+
+// errGitlabPremiumUnavailable represents a GitLab Premium feature that isn't available for a project or group
+var errGitlabPremiumUnavailable = errors.New("GitLab Premium feature is unavailable")
+
 type gitlabService struct {
-	name   string
-	config *config.Config
-	logger *zap.Logger
+	name        string
+	baseURL     string
+	config      *config.Config
+	logger      *zap.Logger
+	httpClient  *http.Client
+	staleValues *staleValueCache
+	results     *resultCache
+	requests    singleflight.Group
+}
+
+type gitlabIssue struct {
+	Weight *int `json:"weight"`
 }
 
 type gitlabFilteredResponse struct {
@@ -34,6 +61,8 @@ type gitlabProjectsResponse struct {
 	CreatedAt         time.Time     `json:"created_at"`
 	DefaultBranch     string        `json:"default_branch"`
 	TagList           []interface{} `json:"tag_list"`
+	Topics            []string      `json:"topics"`
+	Visibility        string        `json:"visibility"`
 	SSHURLToRepo      string        `json:"ssh_url_to_repo"`
 	HTTPURLToRepo     string        `json:"http_url_to_repo"`
 	WebURL            string        `json:"web_url"`
@@ -52,6 +81,100 @@ type gitlabProjectsResponse struct {
 	} `json:"namespace"`
 }
 
+// gitlabVisibilityColors represents the badge colors of each project visibility level
+var gitlabVisibilityColors = map[string]string{
+	"public":   "green",
+	"internal": "yellow",
+	"private":  "lightgrey",
+}
+
+// gitlabPipelineResponse represents a CI/CD pipeline of a GitLab project
+type gitlabPipelineResponse struct {
+	ID     int    `json:"id"`
+	Ref    string `json:"ref"`
+	Status string `json:"status"`
+}
+
+// pipelineStatus returns the badge status & color of the latest pipeline, a nil pipeline represents a ref without any
+// pipelines
+func pipelineStatus(pipeline *gitlabPipelineResponse) (string, string) {
+	if pipeline == nil {
+		return "none", "lightgrey"
+	}
+	switch pipeline.Status {
+	case "success":
+		return "passed", "green"
+	case "failed":
+		return "failed", "red"
+	case "created", "waiting_for_resource", "preparing", "pending", "running", "scheduled":
+		return "running", "yellow"
+	case "canceled", "skipped":
+		return pipeline.Status, "grey"
+	default:
+		return pipeline.Status, "lightgrey"
+	}
+}
+
+// coverageStatus returns the badge status & color of the test coverage percentage, a nil coverage represents a test
+// coverage that isn't known
+func coverageStatus(coverage *float64) (string, string) {
+	if coverage == nil {
+		return "unknown", "grey"
+	}
+	status := strconv.FormatFloat(*coverage, 'f', 1, 64) + "%"
+	switch {
+	case *coverage < 50:
+		return status, "red"
+	case *coverage < 80:
+		return status, "yellow"
+	default:
+		return status, "green"
+	}
+}
+
+// gitlabProjectFetcher memoizes project objects fetched within a single request, so that metrics
+// derived from the same project object only issue one upstream call. Metrics of a combined badge share the memo of
+// the combined badge.
+type gitlabProjectFetcher struct {
+	service   *gitlabService
+	keyPrefix string
+	memo      *combinedMemo
+}
+
+func newGitlabProjectFetcher(ctx context.Context, service *gitlabService, keyPrefix string) *gitlabProjectFetcher {
+	memo, ok := combinedMemoFromContext(ctx)
+	if !ok {
+		memo = newCombinedMemo()
+	}
+	return &gitlabProjectFetcher{
+		service:   service,
+		keyPrefix: keyPrefix,
+		memo:      memo,
+	}
+}
+
+func (fetcher *gitlabProjectFetcher) getProject(ctx context.Context, owner string, repo string) (*gitlabProjectsResponse, error) {
+	key := fetcher.keyPrefix + "projects/" + owner + "/" + repo
+	span := startCacheLookupSpan(ctx, fetcher.service.name, "project")
+	result, memoized, err := fetcher.memo.do(key, func() (interface{}, error) {
+		result, err, _ := fetcher.service.requests.Do(key, func() (interface{}, error) {
+			return fetcher.service.getProject(ctx, owner, repo)
+		})
+		return result, err
+	})
+	if memoized {
+		cacheLookupsTotal.WithLabelValues(fetcher.service.name, "project", "hit").Inc()
+		endCacheLookupSpan(span, "hit")
+	} else {
+		cacheLookupsTotal.WithLabelValues(fetcher.service.name, "project", "miss").Inc()
+		endCacheLookupSpan(span, "miss")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.(*gitlabProjectsResponse), nil
+}
+
 // NewGitlabService returns a HTTP handler for the Gitlab badge service
 func NewGitlabService(configuration *config.Config, logger *zap.Logger) (GitProviderService, error) {
 	if configuration == nil {
@@ -61,244 +184,589 @@ func NewGitlabService(configuration *config.Config, logger *zap.Logger) (GitProv
 		return nil, fmt.Errorf("missing logger dependency")
 	}
 
+	baseURL := gitlabAPIBaseURL
+	if configuration.GitlabAPIBaseURL != "" {
+		baseURL = strings.TrimSuffix(configuration.GitlabAPIBaseURL, "/")
+	}
+
+	results, err := newResultCache(configuration, logger, "gitlab")
+	if err != nil {
+		return nil, err
+	}
 	return &gitlabService{
-		name:   "gitlab",
-		config: configuration,
-		logger: logger,
+		name:    "gitlab",
+		baseURL: baseURL,
+		config:  configuration,
+		logger:  logger,
+		httpClient: newUpstreamClient(configuration, logger, "gitlab", &rateLimitTransport{
+			base:    &gitlabTokenTransport{base: upstreamTransport(configuration), token: configuration.GitlabAccessToken},
+			limiter: newRateLimiter("gitlab"),
+		}),
+		staleValues: newStaleValueCache("gitlab", staleValueRetention, staleValueCacheSize),
+		results:     results,
 	}, nil
 }
 
-func (service *gitlabService) fetch(url string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// gitlabTokenTransport authenticates GitLab API calls with the `PRIVATE-TOKEN` header, using the token of the request
+// query stored in the context if any, or the configured token otherwise
+type gitlabTokenTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (transport *gitlabTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := queryTokenFromContext(req.Context())
+	if token == "" {
+		token = transport.token
+	}
+	if token == "" {
+		return transport.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	req.Header.Set("PRIVATE-TOKEN", token)
+	return transport.base.RoundTrip(req)
+}
+
+func (service *gitlabService) fetch(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := (&http.Client{}).Do(req)
+	resp, err := service.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
 
 	return resp, err
 }
 
-func (service *gitlabService) getForkCount(owner string, repo string) (int, error) {
-	url := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s%%2F%s", owner, repo)
-	resp, err := service.fetch(url)
+// fetchTotal returns the total number of items listed by the paginated API, read from the `X-Total` header of the
+// response
+func (service *gitlabService) fetchTotal(ctx context.Context, url string) (int, error) {
+	resp, err := service.fetch(ctx, url)
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
 
+	return strconv.Atoi(resp.Header.Get("X-Total"))
+}
+
+func (service *gitlabService) getProject(ctx context.Context, owner string, repo string) (*gitlabProjectsResponse, error) {
+	url := fmt.Sprintf("%s/projects/%s%%2F%s", service.baseURL, owner, repo)
+	resp, err := service.fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
 	var project gitlabProjectsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&project); err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return project.ForksCount, nil
+	return &project, nil
 }
 
-func (service *gitlabService) getIssueCount(owner string, repo string, issueState string) (int, error) {
-	url := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s%%2F%s/issues", owner, repo)
-	switch issueState {
-	case "opened":
-		url = fmt.Sprintf("%s?state=opened", url)
-	case "closed":
-		url = fmt.Sprintf("%s?state=closed", url)
+func (service *gitlabService) getEpicCount(ctx context.Context, group string) (int, error) {
+	url := fmt.Sprintf("%s/groups/%s/epics?state=opened&per_page=1", service.baseURL, group)
+	epicCount, err := service.fetchTotal(ctx, url)
+	if isUpstreamForbidden(err) {
+		return 0, errGitlabPremiumUnavailable
 	}
-	resp, err := service.fetch(url)
 	if err != nil {
 		return 0, err
 	}
+	return epicCount, nil
+}
+
+// getIssuePage returns a page of the open issues of the project, along with the headers of the response
+func (service *gitlabService) getIssuePage(ctx context.Context, owner string, repo string, page int) ([]gitlabIssue, http.Header, error) {
+	url := fmt.Sprintf("%s/projects/%s%%2F%s/issues?state=opened&per_page=%d&page=%d",
+		service.baseURL, owner, repo, gitlabIssuesPerPage, page)
+	resp, err := service.fetch(ctx, url)
+	if isUpstreamForbidden(err) {
+		return nil, nil, errGitlabPremiumUnavailable
+	}
+	if err != nil {
+		return nil, nil, err
+	}
 	defer resp.Body.Close()
 
-	xTotal := resp.Header.Get("X-Total")
-	issueCount, err := strconv.Atoi(xTotal)
+	var issues []gitlabIssue
+	if err := json.NewDecoder(resp.Body).Decode(&issues); err != nil {
+		return nil, nil, err
+	}
+	return issues, resp.Header, nil
+}
+
+func (service *gitlabService) getIssueWeight(ctx context.Context, owner string, repo string) (int, error) {
+	issues, header, err := service.getIssuePage(ctx, owner, repo, 1)
 	if err != nil {
 		return 0, err
 	}
+	pages := [][]gitlabIssue{issues}
+
+	// The remaining pages are fetched concurrently when GitLab reports the number of pages, which it omits for large
+	// collections, in which case the pages are followed one by one
+	if totalPages, err := strconv.Atoi(header.Get("X-Total-Pages")); err == nil {
+		if totalPages > gitlabMaxIssuePages {
+			totalPages = gitlabMaxIssuePages
+		}
+		if totalPages > 1 {
+			remaining := make([][]gitlabIssue, totalPages-1)
+			err := fanOut(ctx, maxFanOutWorkers, len(remaining), func(ctx context.Context, i int) error {
+				issues, _, err := service.getIssuePage(ctx, owner, repo, i+2)
+				remaining[i] = issues
+				return err
+			})
+			if err != nil {
+				return 0, err
+			}
+			pages = append(pages, remaining...)
+		}
+	} else {
+		for page := 2; page <= gitlabMaxIssuePages && header.Get("X-Next-Page") != ""; page++ {
+			issues, header, err = service.getIssuePage(ctx, owner, repo, page)
+			if err != nil {
+				return 0, err
+			}
+			pages = append(pages, issues)
+		}
+	}
 
-	return issueCount, nil
+	weight := 0
+	hasWeights := false
+	hasIssues := false
+	for _, issues := range pages {
+		for _, issue := range issues {
+			hasIssues = true
+			if issue.Weight != nil {
+				hasWeights = true
+				weight += *issue.Weight
+			}
+		}
+	}
+
+	// Issue weights are omitted for projects without GitLab Premium, which would otherwise look like legitimate zeros
+	if hasIssues && !hasWeights {
+		return 0, errGitlabPremiumUnavailable
+	}
+	return weight, nil
 }
 
-func (service *gitlabService) getPullRequestCount(owner string, repo string, pullRequestState string) (int, error) {
-	url := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s%%2F%s/merge_requests", owner, repo)
-	switch pullRequestState {
-	case "opened":
-		url = fmt.Sprintf("%s?state=opened", url)
-	case "closed":
-		url = fmt.Sprintf("%s?state=closed", url)
-	case "locked":
-		url = fmt.Sprintf("%s?state=locked", url)
-	case "merged":
-		url = fmt.Sprintf("%s?state=merged", url)
-	}
-	resp, err := service.fetch(url)
+func (service *gitlabService) getForkCount(ctx context.Context, owner string, repo string) (int, error) {
+	project, err := service.getProject(ctx, owner, repo)
 	if err != nil {
 		return 0, err
 	}
+
+	return project.ForksCount, nil
+}
+
+func (service *gitlabService) getIssueCount(ctx context.Context, owner string, repo string, issueState string) (int, error) {
+	return service.getLabeledIssueCount(ctx, owner, repo, issueState, nil)
+}
+
+// getLabeledIssueCount returns the number of issues in the state labelled with every label
+func (service *gitlabService) getLabeledIssueCount(ctx context.Context, owner string, repo string, issueState string, labels []string) (int, error) {
+	query := url.Values{}
+	switch issueState {
+	case "opened", "closed":
+		query.Set("state", issueState)
+	}
+	return service.getFilteredCount(ctx, owner, repo, "issues", query, labels)
+}
+
+func (service *gitlabService) getPullRequestCount(ctx context.Context, owner string, repo string, pullRequestState string) (int, error) {
+	return service.getLabeledPullRequestCount(ctx, owner, repo, pullRequestState, nil)
+}
+
+// getLabeledPullRequestCount returns the number of merge requests in the state labelled with every label
+func (service *gitlabService) getLabeledPullRequestCount(ctx context.Context, owner string, repo string, pullRequestState string, labels []string) (int, error) {
+	query := url.Values{}
+	switch pullRequestState {
+	case "opened", "closed", "locked", "merged":
+		query.Set("state", pullRequestState)
+	}
+	return service.getFilteredCount(ctx, owner, repo, "merge_requests", query, labels)
+}
+
+// getFilteredCount returns the number of issues or merge requests (depending on the resource) matching the query.
+// GitLab only lists the issues or merge requests labelled with every
+// label set in the comma-separated `labels` parameter.
+func (service *gitlabService) getFilteredCount(ctx context.Context, owner string, repo string, resource string, query url.Values, labels []string) (int, error) {
+	if len(labels) > 0 {
+		query.Set("labels", strings.Join(labels, ","))
+	}
+	apiURL := fmt.Sprintf("%s/projects/%s%%2F%s/%s", service.baseURL, owner, repo, resource)
+	if encoded := query.Encode(); encoded != "" {
+		apiURL = apiURL + "?" + encoded
+	}
+	return service.fetchTotal(ctx, apiURL)
+}
+
+func (service *gitlabService) getContributorCount(ctx context.Context, owner string, repo string) (int, error) {
+	apiURL := fmt.Sprintf("%s/projects/%s%%2F%s/repository/contributors?per_page=1", service.baseURL, owner, repo)
+	return service.fetchTotal(ctx, apiURL)
+}
+
+// getCommitCount returns the number of commits of the branch, or of the default branch if no branch is set
+func (service *gitlabService) getCommitCount(ctx context.Context, owner string, repo string, branch string) (int, error) {
+	query := url.Values{"per_page": {"1"}}
+	if branch != "" {
+		query.Set("ref_name", branch)
+	}
+	apiURL := fmt.Sprintf("%s/projects/%s%%2F%s/repository/commits?%s", service.baseURL, owner, repo, query.Encode())
+	return service.fetchTotal(ctx, apiURL)
+}
+
+func (service *gitlabService) getTagCount(ctx context.Context, owner string, repo string) (int, error) {
+	apiURL := fmt.Sprintf("%s/projects/%s%%2F%s/repository/tags?per_page=1", service.baseURL, owner, repo)
+	return service.fetchTotal(ctx, apiURL)
+}
+
+// getLatestRelease returns the tag name of the most recent release, or an empty name if the project has no releases
+func (service *gitlabService) getLatestRelease(ctx context.Context, owner string, repo string) (string, error) {
+	apiURL := fmt.Sprintf("%s/projects/%s%%2F%s/releases?per_page=1", service.baseURL, owner, repo)
+	resp, err := service.fetch(ctx, apiURL)
+	if err != nil {
+		return "", err
+	}
 	defer resp.Body.Close()
 
-	xTotal := resp.Header.Get("X-Total")
-	issueCount, err := strconv.Atoi(xTotal)
+	var releases []struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return "", err
+	}
+	if len(releases) == 0 {
+		return "", nil
+	}
+	return releases[0].TagName, nil
+}
+
+// getLatestPipeline returns the latest pipeline of the ref, optionally narrowed down to pipelines with the status, or
+// nil if the ref has no such pipelines
+func (service *gitlabService) getLatestPipeline(ctx context.Context, owner string, repo string, ref string, status string) (*gitlabPipelineResponse, error) {
+	query := url.Values{"per_page": {"1"}, "ref": {ref}}
+	if status != "" {
+		query.Set("status", status)
+	}
+	apiURL := fmt.Sprintf("%s/projects/%s%%2F%s/pipelines?%s", service.baseURL, owner, repo, query.Encode())
+	resp, err := service.fetch(ctx, apiURL)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	return issueCount, nil
+	var pipelines []gitlabPipelineResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pipelines); err != nil {
+		return nil, err
+	}
+	if len(pipelines) == 0 {
+		return nil, nil
+	}
+	return &pipelines[0], nil
 }
 
-func (service *gitlabService) getStarCount(owner string, repo string) (int, error) {
-	url := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s%%2F%s", owner, repo)
-	resp, err := service.fetch(url)
+// getCoverage returns the test coverage percentage of the latest successful pipeline of the ref, or nil if the ref has
+// no successful pipelines or if test coverage isn't configured
+func (service *gitlabService) getCoverage(ctx context.Context, owner string, repo string, ref string) (*float64, error) {
+	pipeline, err := service.getLatestPipeline(ctx, owner, repo, ref, "success")
+	if err != nil || pipeline == nil {
+		return nil, err
+	}
+
+	// Pipelines are only listed without their test coverage
+	apiURL := fmt.Sprintf("%s/projects/%s%%2F%s/pipelines/%d", service.baseURL, owner, repo, pipeline.ID)
+	resp, err := service.fetch(ctx, apiURL)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var project gitlabProjectsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&project); err != nil {
+	var details struct {
+		Coverage *string `json:"coverage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		return nil, err
+	}
+	if details.Coverage == nil || *details.Coverage == "" {
+		return nil, nil
+	}
+	coverage, err := strconv.ParseFloat(*details.Coverage, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &coverage, nil
+}
+
+func (service *gitlabService) getStarCount(ctx context.Context, owner string, repo string) (int, error) {
+	project, err := service.getProject(ctx, owner, repo)
+	if err != nil {
 		return 0, err
 	}
 
 	return project.StarCount, nil
 }
 
+// SupportedMetrics returns the metrics served by the service
+func (service *gitlabService) SupportedMetrics() []string {
+	return []string{"commits", "contributors", "coverage", "epics", "forks", "issue-weight", "issues", "merge-requests", "pipeline",
+		"releases", "stars", "tags", "topics", "visibility"}
+}
+
+func (service *gitlabService) supportedQueryParams() map[string][]badgeQueryParam {
+	branch := badgeQueryParam{"branch", "Branch of the project, defaults to the default branch", "main"}
+	labels := badgeQueryParam{"label", "Label that counted items must be labelled with, repeatable", "bug"}
+	return map[string][]badgeQueryParam{
+		"commits":        {branch},
+		"coverage":       {branch},
+		"epics":          {{"group", "Group of the epics, defaults to the owner of the project", "gitlab-org/frontend"}},
+		"issues":         {{"state", "State of the issues (opened or closed), defaults to every state", "opened"}, labels},
+		"merge-requests": {{"state", "State of the merge requests (opened, closed, locked or merged), defaults to every state", "opened"}, labels},
+		"pipeline":       {branch},
+		"topics":         {{"list", "Lists the topics instead of counting them (true)", "true"}},
+	}
+}
+
+// queryToken returns the token set in the request query, if allowed
+func (service *gitlabService) queryToken(r *http.Request) string {
+	if !service.config.AllowQueryTokens {
+		return ""
+	}
+	return queryTokenFromContext(r.Context())
+}
+
 func (service *gitlabService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Responses fetched with tokens set in the request query are never cached
+	if service.queryToken(r) != "" {
+		w = &privateResponseWriter{ResponseWriter: w}
+	}
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *gitlabService) fetchBadge(r *http.Request) (cachedResult, error) {
 	routeVariables := mux.Vars(r)
 	owner := routeVariables["owner"]
 	repo := routeVariables["repo"]
 	method := routeVariables["method"]
+	ctx := upstreamContext(r)
 
-	// Fetch data
-	var color, status, subject string
-	var value int
-	var err error
-	switch method {
-	case "forks":
-		subject = "forks"
-		value, err = service.getForkCount(owner, repo)
-	case "issues":
-		state := r.URL.Query().Get("state")
-		switch state {
-		case "":
-			subject = "issues"
-		case "opened":
-			subject = "opened issues"
-		case "closed":
-			subject = "closed issues"
-		default:
-			service.logger.Info("Unsupported state",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.String("state", state))
-			if err := badRequest(w, service.config); err != nil {
-				service.logger.Error("Failed to create error badge",
-					zap.String("url", r.URL.RequestURI()),
-					zap.String("service", service.name),
-					zap.String("method", method),
-					zap.Error(err))
+	queryToken := service.queryToken(r)
+	if queryToken != "" {
+		ctx = context.WithValue(ctx, queryTokenContextKey{}, queryToken)
+	}
+
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         queryTokenKeyPrefix(queryToken) + fetchKey(r),
+		uncached:    queryToken != "",
+	}
+	var project *gitlabProjectsResponse
+	projectFetcher := newGitlabProjectFetcher(r.Context(), service, queryTokenKeyPrefix(queryToken))
+	result, err := fetchResult(r, requestLogger(service.logger, r), fetch, func() (cachedResult, error) {
+		var result cachedResult
+		var err error
+		switch method {
+		case "forks":
+			result.Subject = "forks"
+			if project, err = projectFetcher.getProject(ctx, owner, repo); err == nil {
+				result.Value = project.ForksCount
 			}
-			return
-		}
-		value, err = service.getIssueCount(owner, repo, state)
-	case "merge-requests":
-		state := r.URL.Query().Get("state")
-		switch state {
-		case "":
-			subject = "MRs"
-		case "opened":
-			subject = "opened MRs"
-		case "closed":
-			subject = "closed MRs"
-		case "locked":
-			subject = "locked MRs"
-		case "merged":
-			subject = "merged MRs"
-		default:
-			service.logger.Info("Unsupported state",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.String("state", state))
-			if err := badRequest(w, service.config); err != nil {
-				service.logger.Error("Failed to create error badge",
-					zap.String("url", r.URL.RequestURI()),
-					zap.String("service", service.name),
-					zap.String("method", method),
-					zap.Error(err))
+		case "commits":
+			result.Subject = "commits"
+			branch := r.URL.Query().Get("branch")
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getCommitCount(ctx, owner, repo, branch)
+			})
+		case "contributors":
+			result.Subject = "contributors"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getContributorCount(ctx, owner, repo)
+			})
+		case "coverage":
+			result.Subject = "coverage"
+			branch := r.URL.Query().Get("branch")
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				// Test coverage of the default branch is shown unless a branch is requested
+				ref := branch
+				if ref == "" {
+					project, err := projectFetcher.getProject(ctx, owner, repo)
+					if err != nil {
+						return nil, err
+					}
+					ref = project.DefaultBranch
+				}
+				return service.getCoverage(ctx, owner, repo, ref)
+			})
+			if err == nil {
+				coverage := fetched.(*float64)
+				result.Status, result.Color = coverageStatus(coverage)
+				if coverage != nil {
+					// Whole percentages keep the coverage below thresholds of result.Color ranges it doesn't reach
+					result.Value = int(math.Floor(*coverage))
+				}
 			}
-			return
-		}
-		value, err = service.getPullRequestCount(owner, repo, state)
-	case "stars":
-		subject = "stars"
-		value, err = service.getStarCount(owner, repo)
-	default:
-		service.logger.Info("Unsupported method",
-			zap.String("url", r.URL.RequestURI()),
-			zap.String("service", service.name),
-			zap.String("method", method))
-		if err := notFound(w, service.config); err != nil {
-			service.logger.Error("Failed to create error badge",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.Error(err))
+		case "epics":
+			// Route variables are already encoded, unlike query parameters (eg. nested groups like "gitlab-org/frontend")
+			group := owner
+			if r.URL.Query().Get("group") != "" {
+				group = url.PathEscape(r.URL.Query().Get("group"))
+			}
+			result.Subject = "epics"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getEpicCount(ctx, group)
+			})
+		case "issue-weight":
+			result.Subject = "issue weight"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getIssueWeight(ctx, owner, repo)
+			})
+		case "issues":
+			state := r.URL.Query().Get("state")
+			switch state {
+			case "":
+				result.Subject = "issues"
+			case "opened":
+				result.Subject = "opened issues"
+			case "closed":
+				result.Subject = "closed issues"
+			default:
+				return result, badRequestBadge
+			}
+			labels := labelsFromQuery(r.URL.Query())
+			result.Subject = labeledSubject(result.Subject, labels)
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getLabeledIssueCount(ctx, owner, repo, state, labels)
+			})
+		case "merge-requests":
+			state := r.URL.Query().Get("state")
+			switch state {
+			case "":
+				result.Subject = "MRs"
+			case "opened":
+				result.Subject = "opened MRs"
+			case "closed":
+				result.Subject = "closed MRs"
+			case "locked":
+				result.Subject = "locked MRs"
+			case "merged":
+				result.Subject = "merged MRs"
+			default:
+				return result, badRequestBadge
+			}
+			labels := labelsFromQuery(r.URL.Query())
+			result.Subject = labeledSubject(result.Subject, labels)
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getLabeledPullRequestCount(ctx, owner, repo, state, labels)
+			})
+		case "pipeline":
+			result.Subject = "pipeline"
+			branch := r.URL.Query().Get("branch")
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				// Pipelines of the default branch are shown unless a branch is requested
+				ref := branch
+				if ref == "" {
+					project, err := projectFetcher.getProject(ctx, owner, repo)
+					if err != nil {
+						return nil, err
+					}
+					ref = project.DefaultBranch
+				}
+				return service.getLatestPipeline(ctx, owner, repo, ref, "")
+			})
+			if err == nil {
+				result.Status, result.Color = pipelineStatus(fetched.(*gitlabPipelineResponse))
+			}
+		case "releases":
+			result.Subject = "release"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getLatestRelease(ctx, owner, repo)
+			})
+			if err == nil {
+				result.Status, result.Color = versionStatus(fetched.(string))
+			}
+		case "stars":
+			result.Subject = "stars"
+			if project, err = projectFetcher.getProject(ctx, owner, repo); err == nil {
+				result.Value = project.StarCount
+			}
+		case "tags":
+			result.Subject = "tags"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getTagCount(ctx, owner, repo)
+			})
+		case "topics":
+			result.Subject = "topics"
+			if project, err = projectFetcher.getProject(ctx, owner, repo); err == nil {
+				result.Value = len(project.Topics)
+				if r.URL.Query().Get("list") == "true" {
+					result.Status = "none"
+					if len(project.Topics) > 0 {
+						result.Status = strings.Join(project.Topics, ", ")
+					}
+				}
+			}
+		case "visibility":
+			result.Subject = "visibility"
+			if project, err = projectFetcher.getProject(ctx, owner, repo); err == nil {
+				result.Status = project.Visibility
+				result.Color = gitlabVisibilityColors[project.Visibility]
+			}
+		default:
+			return result, notFoundBadge
 		}
-		return
-	}
-	if err != nil {
-		service.logger.Error("Failed to fetch data",
-			zap.String("url", r.URL.RequestURI()),
-			zap.String("service", service.name),
-			zap.String("method", method),
-			zap.Error(err))
-		if err := internalServerError(w, service.config); err != nil {
-			service.logger.Error("Failed to create error badge",
-				zap.String("url", r.URL.RequestURI()),
-				zap.String("service", service.name),
-				zap.String("method", method),
-				zap.Error(err))
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if err == errGitlabPremiumUnavailable {
+			result.Status, result.Color, err = "unavailable", "lightgrey", nil
 		}
-		return
-	}
-	status = formatIntegerWithMetricPrefix(value)
+		return result, err
+	})
+	return result, err
+}
 
-	// Overwrite any badge texts
-	if queryColor := r.URL.Query().Get("color"); queryColor != "" {
-		color = queryColor
-	}
-	if queryStatus := r.URL.Query().Get("status"); queryStatus != "" {
-		status = queryStatus
-	}
-	if querySubject := r.URL.Query().Get("subject"); querySubject != "" {
-		subject = querySubject
-	}
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *gitlabService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	value, subject, status, color := result.Value, result.Subject, result.Status, result.Color
 
-	// Generate badge
-	generatedBadge, err := badge.Create(&badge.Params{
-		Style:   badge.Style(r.URL.Query().Get("style")),
-		Subject: subject,
-		Status:  status,
-		Color:   color,
-		Icon:    r.URL.Query().Get("icon"),
-	})
-	if err != nil {
-		service.logger.Error("Failed to create badge",
-			zap.String("url", r.URL.RequestURI()),
-			zap.String("service", service.name),
-			zap.Error(err))
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+	// Textual statuses are used as is, only numeric values are formatted & colored by value
+	isNumeric := status == ""
+	if isNumeric {
+		status = formatStatus(value, r.URL.Query())
 	}
+	// Known test coverages are formatted as percentages, yet colored by value like numeric values
+	isColoredByValue := isNumeric || (mux.Vars(r)["method"] == "coverage" && status != "unknown")
 
-	if !service.config.ExcludeCacheControlHeaders {
-		// cache response in browser for 1 hour (3600), CDN for 1 hour (3600)
-		w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=3600")
+	badgeParams := &badge.Params{Subject: subject, Status: status, Color: color, Sparkline: sparklineFromRequest(r)}
+	if isColoredByValue {
+		if err := parseColorRangesQuery(badgeParams, value, r.URL.Query()); err != nil {
+			return nil, invalidQueryParameterBadge("colorRanges")
+		}
 	}
-	w.Header().Set("Content-Type", "image/svg+xml;utf-8")
-	w.Write([]byte(generatedBadge))
+	return badgeParams, nil
+}
+
+// purgeRepository removes the data cached for the badges of the repository, returning the number of entries removed
+func (service *gitlabService) purgeRepository(ctx context.Context, owner string, repo string) int {
+	purged := service.staleValues.purge(func(key string) bool {
+		return isRepositoryKey(key, owner, repo)
+	})
+	return purged + service.results.purge(ctx, owner, repo)
 }
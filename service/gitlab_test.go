@@ -0,0 +1,789 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// fakeGitlabIssuesAPI returns a fake GitLab API reporting the given number of issues
+func fakeGitlabIssuesAPI(issueCount string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total", issueCount)
+		w.Write([]byte("[]"))
+	}
+}
+
+// fakeGitlabProjectAPI returns a fake GitLab API serving the given project object & counting its calls
+func fakeGitlabProjectAPI(project string, calls *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(project))
+	}
+}
+
+// newTestGitlabService returns a router serving the Gitlab badge service backed by a fake GitLab API
+func newTestGitlabService(t *testing.T, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewGitlabService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*gitlabService).baseURL = fakeAPI.URL
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/gitlab/{method}/{owner}/{repo}`, service)
+
+	return router, fakeAPI.Close
+}
+
+func TestGitlabServiceWithColorRanges(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		issueCount    string
+		query         string
+		expectedColor string
+	}{
+		{"BelowFirstThreshold", "5", "colorRanges=10:green,50:yellow,red", "green"},
+		{"BelowSecondThreshold", "20", "colorRanges=10:green,50:yellow,red", "yellow"},
+		{"Fallback", "75", "colorRanges=10:green,50:yellow,red", "red"},
+		{"WithColorOverride", "5", "colorRanges=10:green,50:yellow,red&color=blue", "blue"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGitlabService(t, fakeGitlabIssuesAPI(testCase.issueCount))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{
+				Subject: "issues",
+				Status:  testCase.issueCount,
+				Color:   testCase.expectedColor,
+			}), res.Body.String())
+		})
+	}
+}
+
+func TestGitlabServiceWithInvalidColorRanges(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestGitlabService(t, fakeGitlabIssuesAPI("5"))
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly?colorRanges=50:yellow,10:green", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{
+		Subject: "aegis",
+		Status:  "invalid colorRanges",
+	}), res.Body.String())
+}
+
+func TestGitlabServiceWithProjectMetrics(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		project  string
+		path     string
+		expected *badge.Params
+	}{
+		{"TopicCount", `{"topics":["go","badges"]}`, "/gitlab/topics/gitlab-org/gitaly",
+			&badge.Params{Subject: "topics", Status: "2"}},
+		{"TopicList", `{"topics":["go","badges"]}`, "/gitlab/topics/gitlab-org/gitaly?list=true",
+			&badge.Params{Subject: "topics", Status: "go, badges"}},
+		{"EmptyTopicList", `{"topics":[]}`, "/gitlab/topics/gitlab-org/gitaly?list=true",
+			&badge.Params{Subject: "topics", Status: "none"}},
+		{"PublicVisibility", `{"visibility":"public"}`, "/gitlab/visibility/gitlab-org/gitaly",
+			&badge.Params{Subject: "visibility", Status: "public", Color: "green"}},
+		{"InternalVisibility", `{"visibility":"internal"}`, "/gitlab/visibility/gitlab-org/gitaly",
+			&badge.Params{Subject: "visibility", Status: "internal", Color: "yellow"}},
+		{"PrivateVisibility", `{"visibility":"private"}`, "/gitlab/visibility/gitlab-org/gitaly",
+			&badge.Params{Subject: "visibility", Status: "private", Color: "lightgrey"}},
+		{"VisibilityWithColorOverride", `{"visibility":"private"}`, "/gitlab/visibility/gitlab-org/gitaly?color=blue",
+			&badge.Params{Subject: "visibility", Status: "private", Color: "blue"}},
+		{"Stars", `{"star_count":42}`, "/gitlab/stars/gitlab-org/gitaly",
+			&badge.Params{Subject: "stars", Status: "42"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls int32
+			router, cleanup := newTestGitlabService(t, fakeGitlabProjectAPI(testCase.project, &calls))
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.path, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, int32(1), calls)
+		})
+	}
+}
+
+func TestGitlabProjectFetcher(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	fakeAPI := httptest.NewServer(fakeGitlabProjectAPI(`{"star_count":42,"forks_count":7,"topics":["go"]}`, &calls))
+	defer fakeAPI.Close()
+
+	service, err := NewGitlabService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*gitlabService).baseURL = fakeAPI.URL
+
+	fetcher := newGitlabProjectFetcher(context.Background(), service.(*gitlabService), "")
+	for i := 0; i < 3; i++ {
+		project, err := fetcher.getProject(context.Background(), "gitlab-org", "gitaly")
+		assert.NoError(t, err)
+		assert.Equal(t, 42, project.StarCount)
+		assert.Equal(t, 7, project.ForksCount)
+		assert.Equal(t, []string{"go"}, project.Topics)
+	}
+	assert.Equal(t, int32(1), calls)
+
+	_, err = fetcher.getProject(context.Background(), "gitlab-org", "gitlab")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestGitlabProjectFetcherWithCombinedMemo(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	fakeAPI := httptest.NewServer(fakeGitlabProjectAPI(`{"star_count":42,"forks_count":7,"topics":["go"]}`, &calls))
+	defer fakeAPI.Close()
+
+	service, err := NewGitlabService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*gitlabService).baseURL = fakeAPI.URL
+
+	// fetchers of the metrics of a combined badge share the project objects fetched by one another
+	ctx := context.WithValue(context.Background(), combinedMemoContextKey{}, newCombinedMemo())
+	for i := 0; i < 3; i++ {
+		project, err := newGitlabProjectFetcher(ctx, service.(*gitlabService), "").getProject(ctx, "gitlab-org", "gitaly")
+		assert.NoError(t, err)
+		assert.Equal(t, 42, project.StarCount)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// fetchers of other requests don't
+	_, err = newGitlabProjectFetcher(context.Background(), service.(*gitlabService), "").getProject(context.Background(), "gitlab-org", "gitaly")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestGitlabServiceServesStaleDataWhenUpstreamFails(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fakeGitlabIssuesAPI("42")(w, r)
+	})
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly", nil)
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, createBadge(&badge.Params{Subject: "issues", Status: "42"}), res.Body.String())
+		if i == 0 {
+			assert.Equal(t, "", res.Header().Get(staleHeader))
+			assert.Equal(t, "public, max-age=0, s-maxage=0", res.Header().Get("Cache-Control"))
+		} else {
+			assert.Equal(t, "true", res.Header().Get(staleHeader))
+			assert.Equal(t, "public, max-age=0, s-maxage=0, stale-while-revalidate=86400", res.Header().Get("Cache-Control"))
+		}
+	}
+	assert.Equal(t, int32(3), calls)
+
+	// badges without any previously fetched data still fail
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly?state=opened", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "internal server error"}), res.Body.String())
+	assert.Equal(t, "", res.Header().Get(staleHeader))
+}
+
+func TestGitlabServiceSharesConcurrentUpstreamCalls(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		// keep the upstream call in flight until every request has been made
+		time.Sleep(200 * time.Millisecond)
+		fakeGitlabIssuesAPI("42")(w, r)
+	})
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly", nil)
+			router.ServeHTTP(res, req)
+			assert.Equal(t, createBadge(&badge.Params{Subject: "issues", Status: "42"}), res.Body.String())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestGitlabServiceWithLabels(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		url            string
+		expectedPath   string
+		expectedState  string
+		expectedLabels string
+		expected       *badge.Params
+	}{
+		{
+			"IssuesWithLabel", "/gitlab/issues/gitlab-org/gitaly?label=bug",
+			"/projects/gitlab-org%2Fgitaly/issues", "", "bug",
+			&badge.Params{Subject: "bug issues", Status: "42"},
+		},
+		{
+			"IssuesWithLabels", "/gitlab/issues/gitlab-org/gitaly?label=bug&label=security",
+			"/projects/gitlab-org%2Fgitaly/issues", "", "bug,security",
+			&badge.Params{Subject: "bug security issues", Status: "42"},
+		},
+		{
+			"OpenedIssuesWithLabel", "/gitlab/issues/gitlab-org/gitaly?state=opened&label=bug",
+			"/projects/gitlab-org%2Fgitaly/issues", "opened", "bug",
+			&badge.Params{Subject: "opened bug issues", Status: "42"},
+		},
+		{
+			"MergedMergeRequestsWithLabels", "/gitlab/merge-requests/gitlab-org/gitaly?state=merged&label=bug&label=backend",
+			"/projects/gitlab-org%2Fgitaly/merge_requests", "merged", "bug,backend",
+			&badge.Params{Subject: "merged bug backend MRs", Status: "42"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, testCase.expectedPath, r.URL.EscapedPath())
+				assert.Equal(t, testCase.expectedState, r.URL.Query().Get("state"))
+				assert.Equal(t, testCase.expectedLabels, r.URL.Query().Get("labels"))
+				fakeGitlabIssuesAPI("42")(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGitlabServiceWithPipeline(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		query       string
+		pipelines   string
+		expectedRef string
+		expected    *badge.Params
+	}{
+		{"Passed", "", `[{"id":1,"ref":"master","status":"success"}]`, "master", &badge.Params{Subject: "pipeline", Status: "passed", Color: "green"}},
+		{"Failed", "", `[{"id":1,"ref":"master","status":"failed"}]`, "master", &badge.Params{Subject: "pipeline", Status: "failed", Color: "red"}},
+		{"Running", "", `[{"id":1,"ref":"master","status":"running"}]`, "master", &badge.Params{Subject: "pipeline", Status: "running", Color: "yellow"}},
+		{"Pending", "", `[{"id":1,"ref":"master","status":"pending"}]`, "master", &badge.Params{Subject: "pipeline", Status: "running", Color: "yellow"}},
+		{"Canceled", "", `[{"id":1,"ref":"master","status":"canceled"}]`, "master", &badge.Params{Subject: "pipeline", Status: "canceled", Color: "grey"}},
+		{"Skipped", "", `[{"id":1,"ref":"master","status":"skipped"}]`, "master", &badge.Params{Subject: "pipeline", Status: "skipped", Color: "grey"}},
+		{"Manual", "", `[{"id":1,"ref":"master","status":"manual"}]`, "master", &badge.Params{Subject: "pipeline", Status: "manual", Color: "lightgrey"}},
+		{"NoPipelines", "", `[]`, "master", &badge.Params{Subject: "pipeline", Status: "none", Color: "lightgrey"}},
+		{"Branch", "branch=feature/ci", `[{"id":1,"ref":"feature/ci","status":"failed"}]`, "feature/ci", &badge.Params{Subject: "pipeline", Status: "failed", Color: "red"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var ref string
+			router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.EscapedPath() {
+				case "/projects/gitlab-org%2Fgitaly":
+					w.Write([]byte(`{"id":2009901,"default_branch":"master"}`))
+				case "/projects/gitlab-org%2Fgitaly/pipelines":
+					assert.Equal(t, "1", r.URL.Query().Get("per_page"))
+					ref = r.URL.Query().Get("ref")
+					w.Write([]byte(testCase.pipelines))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitlab/pipeline/gitlab-org/gitaly?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedRef, ref)
+		})
+	}
+}
+
+func TestCoverageStatus(t *testing.T) {
+	t.Parallel()
+
+	coverage := func(coverage float64) *float64 { return &coverage }
+	testCases := []struct {
+		name           string
+		coverage       *float64
+		expectedStatus string
+		expectedColor  string
+	}{
+		{"Unknown", nil, "unknown", "grey"},
+		{"Zero", coverage(0), "0.0%", "red"},
+		{"BelowHalf", coverage(49.95), "50.0%", "red"},
+		{"Half", coverage(50), "50.0%", "yellow"},
+		{"BelowGood", coverage(79.99), "80.0%", "yellow"},
+		{"Good", coverage(80), "80.0%", "green"},
+		{"Rounded", coverage(87.54), "87.5%", "green"},
+		{"Full", coverage(100), "100.0%", "green"},
+	}
+
+	for _, testCase := range testCases {
+		status, color := coverageStatus(testCase.coverage)
+		assert.Equal(t, testCase.expectedStatus, status, testCase.name)
+		assert.Equal(t, testCase.expectedColor, color, testCase.name)
+	}
+}
+
+func TestGitlabServiceWithCoverage(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		query       string
+		pipelines   string
+		coverage    string
+		expectedRef string
+		expected    *badge.Params
+	}{
+		{"Coverage", "", `[{"id":42,"ref":"master","status":"success"}]`, `"87.50"`, "master", &badge.Params{Subject: "coverage", Status: "87.5%", Color: "green"}},
+		{"LowCoverage", "", `[{"id":42,"ref":"master","status":"success"}]`, `"42.26"`, "master", &badge.Params{Subject: "coverage", Status: "42.3%", Color: "red"}},
+		{"Branch", "branch=develop", `[{"id":42,"ref":"develop","status":"success"}]`, `"65"`, "develop", &badge.Params{Subject: "coverage", Status: "65.0%", Color: "yellow"}},
+		{"NotConfigured", "", `[{"id":42,"ref":"master","status":"success"}]`, `null`, "master", &badge.Params{Subject: "coverage", Status: "unknown", Color: "grey"}},
+		{"NoSuccessfulPipelines", "", `[]`, `"87.50"`, "master", &badge.Params{Subject: "coverage", Status: "unknown", Color: "grey"}},
+		{"ColorRanges", "colorRanges=90:red,green", `[{"id":42,"ref":"master","status":"success"}]`, `"89.99"`, "master", &badge.Params{Subject: "coverage", Status: "90.0%", Color: "red"}},
+		{"ColorOverride", "color=blue", `[{"id":42,"ref":"master","status":"success"}]`, `"87.50"`, "master", &badge.Params{Subject: "coverage", Status: "87.5%", Color: "blue"}},
+		{"UnknownColorRanges", "colorRanges=90:red,green", `[]`, ``, "master", &badge.Params{Subject: "coverage", Status: "unknown", Color: "grey"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var ref string
+			router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.EscapedPath() {
+				case "/projects/gitlab-org%2Fgitaly":
+					w.Write([]byte(`{"id":2009901,"default_branch":"master"}`))
+				case "/projects/gitlab-org%2Fgitaly/pipelines":
+					assert.Equal(t, "success", r.URL.Query().Get("status"))
+					ref = r.URL.Query().Get("ref")
+					w.Write([]byte(testCase.pipelines))
+				case "/projects/gitlab-org%2Fgitaly/pipelines/42":
+					w.Write([]byte(`{"id":42,"status":"success","coverage":` + testCase.coverage + `}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitlab/coverage/gitlab-org/gitaly?"+testCase.query, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedRef, ref)
+		})
+	}
+}
+
+func TestGitlabServiceWithCommitsAndContributors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		url           string
+		total         string
+		expectedPath  string
+		expectedQuery string
+		expected      *badge.Params
+	}{
+		{
+			"Commits", "/gitlab/commits/gitlab-org/gitaly", "12345",
+			"/projects/gitlab-org%2Fgitaly/repository/commits", "per_page=1",
+			&badge.Params{Subject: "commits", Status: "12.3k"},
+		},
+		{
+			"BranchCommits", "/gitlab/commits/gitlab-org/gitaly?branch=15-11-stable&humanize", "12345",
+			"/projects/gitlab-org%2Fgitaly/repository/commits", "per_page=1&ref_name=15-11-stable",
+			&badge.Params{Subject: "commits", Status: "12.3k"},
+		},
+		{
+			"Contributors", "/gitlab/contributors/gitlab-org/gitaly", "318",
+			"/projects/gitlab-org%2Fgitaly/repository/contributors", "per_page=1",
+			&badge.Params{Subject: "contributors", Status: "318"},
+		},
+		{
+			"HumanizedContributors", "/gitlab/contributors/gitlab-org/gitaly?humanize", "1250",
+			"/projects/gitlab-org%2Fgitaly/repository/contributors", "per_page=1",
+			&badge.Params{Subject: "contributors", Status: "1.3k"},
+		},
+		{
+			"Overrides", "/gitlab/contributors/gitlab-org/gitaly?subject=authors&color=green", "318",
+			"/projects/gitlab-org%2Fgitaly/repository/contributors", "per_page=1",
+			&badge.Params{Subject: "authors", Status: "318", Color: "green"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var path, query string
+			router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+				path, query = r.URL.EscapedPath(), r.URL.RawQuery
+				fakeGitlabIssuesAPI(testCase.total)(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedPath, path)
+			assert.Equal(t, testCase.expectedQuery, query)
+		})
+	}
+}
+
+func TestGitlabServiceWithTags(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/projects/gitlab-org%2Fgitaly/repository/tags", r.URL.EscapedPath())
+		assert.Equal(t, "1", r.URL.Query().Get("per_page"))
+		fakeGitlabIssuesAPI("1234")(w, r)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/tags/gitlab-org/gitaly", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "tags", Status: "1.23k"}), res.Body.String())
+}
+
+func TestGitlabServiceWithReleases(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		releases string
+		expected *badge.Params
+	}{
+		{"LatestRelease", `[{"tag_name":"v16.2.0","name":"v16.2.0"}]`, &badge.Params{Subject: "release", Status: "v16.2.0", Color: "blue"}},
+		{"NoReleases", `[]`, &badge.Params{Subject: "release", Status: "none", Color: "lightgrey"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/projects/gitlab-org%2Fgitaly/releases", r.URL.EscapedPath())
+				assert.Equal(t, "1", r.URL.Query().Get("per_page"))
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(testCase.releases))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitlab/releases/gitlab-org/gitaly", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestGitlabServiceWithIssueWeight(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		pages         []string
+		statusCode    int
+		expectedCalls int32
+		expected      *badge.Params
+	}{
+		{"SinglePage", []string{`[{"weight":3},{"weight":null},{"weight":5}]`}, http.StatusOK, 1,
+			&badge.Params{Subject: "issue weight", Status: "8"}},
+		{"MultiplePages", []string{`[{"weight":3},{"weight":4}]`, `[{"weight":5}]`}, http.StatusOK, 2,
+			&badge.Params{Subject: "issue weight", Status: "12"}},
+		{"NoIssues", []string{`[]`}, http.StatusOK, 1,
+			&badge.Params{Subject: "issue weight", Status: "0"}},
+		{"FreeTier", []string{`[{"title":"a"},{"title":"b"}]`}, http.StatusOK, 1,
+			&badge.Params{Subject: "issue weight", Status: "unavailable", Color: "lightgrey"}},
+		{"Forbidden", []string{`{"message":"403 Forbidden"}`}, http.StatusForbidden, 1,
+			&badge.Params{Subject: "issue weight", Status: "unavailable", Color: "lightgrey"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls int32
+			router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				assert.Equal(t, "/projects/gitlab-org%2Fgitaly/issues", r.URL.EscapedPath())
+				assert.Equal(t, "opened", r.URL.Query().Get("state"))
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				if page < len(testCase.pages) {
+					w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+				}
+				w.WriteHeader(testCase.statusCode)
+				w.Write([]byte(testCase.pages[page-1]))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitlab/issue-weight/gitlab-org/gitaly", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+			assert.Equal(t, testCase.expectedCalls, calls)
+		})
+	}
+}
+
+func TestGitlabServiceWithIssueWeightPageCap(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("X-Next-Page", "next")
+		w.Write([]byte(`[{"weight":1}]`))
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/issue-weight/gitlab-org/gitaly", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "issue weight", Status: "10"}), res.Body.String())
+	assert.Equal(t, int32(gitlabMaxIssuePages), calls)
+}
+
+func TestGitlabServiceWithIssueWeightTotalPages(t *testing.T) {
+	t.Parallel()
+
+	// pages are fetched concurrently when GitLab reports the number of pages, up to the page cap
+	var calls int32
+	router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("X-Total-Pages", "12")
+		w.Header().Set("X-Next-Page", "next")
+		w.Write([]byte(`[{"weight":2}]`))
+	})
+	defer cleanup()
+
+	start := time.Now()
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/issue-weight/gitlab-org/gitaly", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "issue weight", Status: "20"}), res.Body.String())
+	assert.Equal(t, int32(gitlabMaxIssuePages), calls)
+	assert.True(t, time.Since(start) < 5*50*time.Millisecond, time.Since(start))
+}
+
+func TestGitlabServiceWithEpics(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		path         string
+		statusCode   int
+		expectedPath string
+		expected     *badge.Params
+	}{
+		{"OwnerGroup", "/gitlab/epics/gitlab-org/gitaly", http.StatusOK, "/groups/gitlab-org/epics",
+			&badge.Params{Subject: "epics", Status: "42"}},
+		{"QueryGroup", "/gitlab/epics/gitlab-org/gitaly?group=gitlab-com", http.StatusOK, "/groups/gitlab-com/epics",
+			&badge.Params{Subject: "epics", Status: "42"}},
+		{"NestedQueryGroup", "/gitlab/epics/gitlab-org/gitaly?group=gitlab-org/frontend", http.StatusOK, "/groups/gitlab-org%2Ffrontend/epics",
+			&badge.Params{Subject: "epics", Status: "42"}},
+		{"NestedOwnerGroup", "/gitlab/epics/gitlab-org%2Ffrontend/gitaly", http.StatusOK, "/groups/gitlab-org%2Ffrontend/epics",
+			&badge.Params{Subject: "epics", Status: "42"}},
+		{"FreeTier", "/gitlab/epics/gitlab-org/gitaly", http.StatusForbidden, "/groups/gitlab-org/epics",
+			&badge.Params{Subject: "epics", Status: "unavailable", Color: "lightgrey"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestGitlabService(t, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, testCase.expectedPath, r.URL.EscapedPath())
+				assert.Equal(t, "opened", r.URL.Query().Get("state"))
+				w.Header().Set("X-Total", "42")
+				w.WriteHeader(testCase.statusCode)
+				w.Write([]byte("[]"))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.path, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+// newTestGitlabServiceWithLogger returns a handler serving the Gitlab badge service with the given configuration,
+// moving query tokens into the request context like the application handler
+func newTestGitlabServiceWithLogger(t *testing.T, configuration *config.Config, logger *zap.Logger, fakeAPIHandler http.HandlerFunc) (http.Handler, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewGitlabService(configuration, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*gitlabService).baseURL = fakeAPI.URL
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/gitlab/{method}/{owner}/{repo}`, service)
+
+	return withQueryToken(router), fakeAPI.Close
+}
+
+func TestGitlabServiceWithTokens(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                 string
+		configuration        *config.Config
+		path                 string
+		expectedToken        string
+		expectedCacheControl string
+	}{
+		{"NoToken", &config.Config{CacheSeconds: 3600},
+			"/gitlab/issues/gitlab-org/gitaly", "", "public, max-age=3600, s-maxage=3600"},
+		{"ConfiguredToken", &config.Config{CacheSeconds: 3600, GitlabAccessToken: "secret"},
+			"/gitlab/issues/gitlab-org/gitaly", "secret", "public, max-age=3600, s-maxage=3600"},
+		{"QueryToken", &config.Config{CacheSeconds: 3600, GitlabAccessToken: "secret", AllowQueryTokens: true},
+			"/gitlab/issues/gitlab-org/gitaly?token=query-secret", "query-secret", "private, no-store"},
+		{"DisallowedQueryToken", &config.Config{CacheSeconds: 3600, GitlabAccessToken: "secret"},
+			"/gitlab/issues/gitlab-org/gitaly?token=query-secret", "secret", "public, max-age=3600, s-maxage=3600"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var token string
+			handler, cleanup := newTestGitlabServiceWithLogger(t, testCase.configuration, zap.NewNop(), func(w http.ResponseWriter, r *http.Request) {
+				token = r.Header.Get("PRIVATE-TOKEN")
+				fakeGitlabIssuesAPI("42")(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.path, nil)
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(t, createBadge(&badge.Params{Subject: "issues", Status: "42"}), res.Body.String())
+			assert.Equal(t, testCase.expectedToken, token)
+			assert.Equal(t, testCase.expectedCacheControl, res.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestGitlabServiceWithQueryTokenFailure(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+	configuration := &config.Config{CacheSeconds: 3600, AllowQueryTokens: true}
+	var failing int32
+	handler, cleanup := newTestGitlabServiceWithLogger(t, configuration, logger, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fakeGitlabIssuesAPI("42")(w, r)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly?token=query-secret", nil)
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "issues", Status: "42"}), res.Body.String())
+
+	// data fetched with query tokens is never served as stale data
+	atomic.StoreInt32(&failing, 1)
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly?token=query-secret", nil)
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "internal server error"}), res.Body.String())
+	assert.Equal(t, "private, no-store", res.Header().Get("Cache-Control"))
+	assert.Contains(t, buf.String(), "Failed to fetch data")
+	assert.NotContains(t, buf.String(), "query-secret")
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipMinSize represents the minimum size in bytes of the responses worth compressing, smaller responses barely
+// shrink (if at all) once the gzip header & footer are added
+const gzipMinSize = 256
+
+// gzipContentTypes represents the media types of the responses compressed with gzip, other responses are either
+// already compressed (eg. PNG images) or not worth compressing
+var gzipContentTypes = []string{"image/svg+xml", "application/json"}
+
+// gzipWriters reuses the gzip writers between responses, as every writer allocates sizable compression tables
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// acceptsGzip reports whether the `Accept-Encoding` request header accepts gzip encoded responses
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(coding, ";")
+		if name := strings.ToLower(strings.TrimSpace(params[0])); name != "gzip" && name != "x-gzip" {
+			continue
+		}
+		for _, param := range params[1:] {
+			if param = strings.TrimSpace(param); !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isGzipContentType reports whether responses of the `Content-Type` header are compressed with gzip
+func isGzipContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, gzipContentType := range gzipContentTypes {
+		if mediaType == gzipContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the responses to be compressed, so that they can be sent with the length of the
+// compressed body, other responses are written through as is
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	acceptsGzip bool
+	statusCode  int
+	wroteHeader bool
+	buffering   bool
+	body        bytes.Buffer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(statusCode int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+	gw.statusCode = statusCode
+
+	header := gw.Header()
+	if isGzipContentType(header.Get("Content-Type")) {
+		header.Add("Vary", "Accept-Encoding")
+		hasBody := statusCode >= http.StatusOK && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified
+		gw.buffering = gw.acceptsGzip && hasBody && header.Get("Content-Encoding") == ""
+	}
+	if !gw.buffering {
+		gw.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.buffering {
+		return gw.body.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+// flush writes the buffered response, compressed if it's large enough
+func (gw *gzipResponseWriter) flush() error {
+	if !gw.buffering {
+		return nil
+	}
+
+	body := gw.body.Bytes()
+	header := gw.Header()
+	if len(body) >= gzipMinSize {
+		var compressed bytes.Buffer
+		zw := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(zw)
+		zw.Reset(&compressed)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		body = compressed.Bytes()
+		header.Set("Content-Encoding", "gzip")
+		// the compressed body is only semantically equivalent to the uncompressed one
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	gw.ResponseWriter.WriteHeader(gw.statusCode)
+	_, err := gw.ResponseWriter.Write(body)
+	return err
+}
+
+// withGzip compresses the SVG & JSON responses with gzip for clients accepting gzip encoded responses
+func withGzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gw := &gzipResponseWriter{
+			ResponseWriter: w,
+			// responses to HEAD requests must have the headers of the responses to GET requests, without the body
+			acceptsGzip: r.Method != http.MethodHead && acceptsGzip(r.Header.Get("Accept-Encoding")),
+			statusCode:  http.StatusOK,
+		}
+		next.ServeHTTP(gw, r)
+		gw.flush()
+	})
+}
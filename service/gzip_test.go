@@ -0,0 +1,159 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// gunzip returns the decompressed body of a gzip encoded response
+func gunzip(t *testing.T, body []byte) string {
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(decompressed)
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		acceptEncoding string
+		expected       bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"x-gzip", true},
+		{"deflate, gzip;q=1.0, *;q=0.5", true},
+		{"br;q=1.0, gzip; q=0.8", true},
+		{"gzip;q=0", false},
+		{"gzip;q=0.000", false},
+		{"deflate, br", false},
+		{"identity", false},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, acceptsGzip(testCase.acceptEncoding), testCase.acceptEncoding)
+	}
+}
+
+func TestWithGzipStaticBadge(t *testing.T) {
+	t.Parallel()
+
+	staticService, err := NewStaticService(&config.Config{CacheSeconds: 3600, MinCacheSeconds: 300, MaxCacheSeconds: 86400}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := withGzip(staticService)
+	request := func(path string, acceptEncoding string, ifNoneMatch string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	plain := request("/static?subject=stars&status=1234&icon=brands/github", "", "")
+	assert.Equal(t, http.StatusOK, plain.Code)
+	assert.Empty(t, plain.Header().Get("Content-Encoding"))
+	assert.Equal(t, []string{"Accept", "Accept-Encoding"}, plain.Header()["Vary"])
+	assert.Equal(t, strconv.Itoa(plain.Body.Len()), plain.Header().Get("Content-Length"))
+
+	compressed := request("/static?subject=stars&status=1234&icon=brands/github", "gzip", "")
+	assert.Equal(t, http.StatusOK, compressed.Code)
+	assert.Equal(t, "gzip", compressed.Header().Get("Content-Encoding"))
+	assert.Equal(t, []string{"Accept", "Accept-Encoding"}, compressed.Header()["Vary"])
+	assert.Equal(t, "image/svg+xml;utf-8", compressed.Header().Get("Content-Type"))
+	assert.Equal(t, strconv.Itoa(compressed.Body.Len()), compressed.Header().Get("Content-Length"))
+	assert.Equal(t, plain.Header().Get("Cache-Control"), compressed.Header().Get("Cache-Control"))
+	assert.Equal(t, "W/"+plain.Header().Get("ETag"), compressed.Header().Get("ETag"))
+	assert.Less(t, compressed.Body.Len(), plain.Body.Len())
+	assert.Equal(t, plain.Body.String(), gunzip(t, compressed.Body.Bytes()))
+
+	// revalidating the compressed badge with its weak entity tag
+	notModified := request("/static?subject=stars&status=1234&icon=brands/github", "gzip", compressed.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Header().Get("Content-Encoding"))
+	assert.Empty(t, notModified.Body.String())
+
+	// error responses are compressed with their status code
+	invalid := request("/static?subject=stars&status="+strings.Repeat("a", 300), "gzip", "")
+	assert.Equal(t, http.StatusBadRequest, invalid.Code)
+	assert.Equal(t, "application/json", invalid.Header().Get("Content-Type"))
+	assert.Empty(t, invalid.Header().Get("Content-Encoding"), "responses below the size threshold aren't compressed")
+	assert.JSONEq(t, `{"parameter":"status","error":"longer than 200 characters"}`, invalid.Body.String())
+}
+
+func TestWithGzip(t *testing.T) {
+	t.Parallel()
+
+	largeSVG := `<svg xmlns="http://www.w3.org/2000/svg">` + strings.Repeat(`<rect width="1" height="1"/>`, 20) + `</svg>`
+	testCases := []struct {
+		name                    string
+		method                  string
+		contentType             string
+		contentEncoding         string
+		statusCode              int
+		body                    string
+		expectedContentEncoding string
+		expectedVary            string
+	}{
+		{"SVG", "GET", "image/svg+xml;utf-8", "", http.StatusOK, largeSVG, "gzip", "Accept-Encoding"},
+		{"JSON", "GET", "application/json", "", http.StatusOK, `{"values":[` + strings.Repeat(`1,`, 200) + `1]}`, "gzip", "Accept-Encoding"},
+		{"ErrorBadge", "GET", "image/svg+xml;utf-8", "", http.StatusNotFound, largeSVG, "gzip", "Accept-Encoding"},
+		{"SmallSVG", "GET", "image/svg+xml;utf-8", "", http.StatusOK, `<svg xmlns="http://www.w3.org/2000/svg"/>`, "", "Accept-Encoding"},
+		{"PNG", "GET", "image/png", "", http.StatusOK, "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 512), "", ""},
+		{"Text", "GET", "text/plain; charset=utf-8", "", http.StatusOK, strings.Repeat("a", 512), "", ""},
+		{"AlreadyEncoded", "GET", "application/json", "br", http.StatusOK, strings.Repeat("a", 512), "br", "Accept-Encoding"},
+		{"HEAD", "HEAD", "image/svg+xml;utf-8", "", http.StatusOK, "", "", "Accept-Encoding"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", testCase.contentType)
+				if testCase.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", testCase.contentEncoding)
+				}
+				w.WriteHeader(testCase.statusCode)
+				w.Write([]byte(testCase.body))
+			}))
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest(testCase.method, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.statusCode, res.Code)
+			assert.Equal(t, testCase.expectedContentEncoding, res.Header().Get("Content-Encoding"))
+			assert.Equal(t, testCase.expectedVary, res.Header().Get("Vary"))
+			if testCase.expectedContentEncoding == "gzip" {
+				assert.Equal(t, strconv.Itoa(res.Body.Len()), res.Header().Get("Content-Length"))
+				assert.Equal(t, testCase.body, gunzip(t, res.Body.Bytes()))
+			} else {
+				assert.Equal(t, testCase.body, res.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headCacheSize represents the maximum number of badge responses whose headers are kept to answer HEAD requests
+const headCacheSize = 4096
+
+// headCachedHeaders represents the headers of badge responses replayed on HEAD requests, other headers (eg. request
+// IDs) are set for every request
+var headCachedHeaders = []string{"Cache-Control", "Content-Length", "Content-Type", "ETag", badgeWidthHeader, badgeHeightHeader, staleHeader}
+
+// headResponse represents the headers of a badge response, kept until the response expires from caches
+type headResponse struct {
+	header    http.Header
+	expiresAt time.Time
+}
+
+// headResponseCache keeps the headers of recent badge responses, so that HEAD requests (eg. from link checkers) for
+// the same badges are answered without fetching their data from the upstream APIs again
+type headResponseCache struct {
+	mu        sync.Mutex
+	size      int
+	responses map[string]headResponse
+	now       func() time.Time
+}
+
+func newHeadResponseCache(size int) *headResponseCache {
+	return &headResponseCache{
+		size:      size,
+		responses: map[string]headResponse{},
+		now:       time.Now,
+	}
+}
+
+// maxAge returns the duration that the response can be cached for, based on the `max-age` directive of its
+// `Cache-Control` header
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive == "no-store" || directive == "no-cache" || directive == "private" {
+			return 0
+		}
+		if strings.HasPrefix(directive, "max-age=") {
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return 0
+}
+
+// set keeps the headers of the badge response for as long as it can be cached
+func (cache *headResponseCache) set(key string, header http.Header) {
+	ttl := maxAge(header.Get("Cache-Control"))
+	if ttl == 0 {
+		return
+	}
+
+	response := headResponse{header: http.Header{}, expiresAt: cache.now().Add(ttl)}
+	for _, name := range headCachedHeaders {
+		if values := header[http.CanonicalHeaderKey(name)]; len(values) > 0 {
+			response.header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// make room by evicting expired responses first, then any response
+	if _, ok := cache.responses[key]; !ok && len(cache.responses) >= cache.size {
+		now := cache.now()
+		for cachedKey, cachedResponse := range cache.responses {
+			if now.After(cachedResponse.expiresAt) {
+				delete(cache.responses, cachedKey)
+			}
+		}
+		for cachedKey := range cache.responses {
+			if len(cache.responses) < cache.size {
+				break
+			}
+			delete(cache.responses, cachedKey)
+		}
+	}
+	cache.responses[key] = response
+}
+
+// get returns the headers of the badge response of the provider, if it hasn't expired yet
+func (cache *headResponseCache) get(ctx context.Context, provider string, key string) (http.Header, bool) {
+	span := startCacheLookupSpan(ctx, provider, "head")
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	response, ok := cache.responses[key]
+	if ok && cache.now().After(response.expiresAt) {
+		delete(cache.responses, key)
+		ok = false
+	}
+	if !ok {
+		cacheLookupsTotal.WithLabelValues(provider, "head", "miss").Inc()
+		endCacheLookupSpan(span, "miss")
+		return nil, false
+	}
+
+	cacheLookupsTotal.WithLabelValues(provider, "head", "hit").Inc()
+	endCacheLookupSpan(span, "hit")
+	return response.header, true
+}
+
+// purge removes the headers of the badge responses whose keys match, returning the number of responses removed
+func (cache *headResponseCache) purge(match func(key string) bool) int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	purged := 0
+	for key := range cache.responses {
+		if match(key) {
+			delete(cache.responses, key)
+			purged++
+		}
+	}
+	return purged
+}
+
+// headResponseWriter discards the body of responses to HEAD requests, keeping the headers set by the handler
+// (including the `Content-Length` of the body that a GET request would get)
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// headKey identifies the badge requested in the format requested, never sharing responses of requests made with an
+// upstream API token
+func headKey(r *http.Request) string {
+	format, _ := requestBadgeFormat(r)
+	return queryTokenKeyPrefix(queryTokenFromContext(r.Context())) + r.URL.RequestURI() + "#" + string(format)
+}
+
+// withHeadRequests answers HEAD requests with the headers of the badge response that a GET request would get, without
+// the body. Headers of recent badge responses are replayed, so that their data isn't fetched again.
+func withHeadRequests(cache *headResponseCache, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := headKey(r)
+		if r.Method == http.MethodHead {
+			if header, ok := cache.get(r.Context(), routeName(r.URL.Path), key); ok {
+				if _, negotiated := requestBadgeFormat(r); negotiated {
+					w.Header().Add("Vary", "Accept")
+				}
+				// responses to conditional requests only carry the headers set by writeNotModified
+				if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, header.Get("ETag")) {
+					for _, name := range []string{"Cache-Control", "ETag"} {
+						if value := header.Get(name); value != "" {
+							w.Header().Set(name, value)
+						}
+					}
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				for name, values := range header {
+					w.Header()[name] = append([]string(nil), values...)
+				}
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(&headResponseWriter{recorder}, r)
+		} else {
+			next.ServeHTTP(recorder, r)
+		}
+		if recorder.statusCode == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "image/svg+xml") {
+			cache.set(key, w.Header())
+		}
+	})
+}
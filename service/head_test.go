@@ -0,0 +1,157 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxAge(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		cacheControl string
+		expected     time.Duration
+	}{
+		{"", 0},
+		{"public, max-age=3600, s-maxage=3600", time.Hour},
+		{"max-age=0", 0},
+		{"max-age=abc", 0},
+		{"no-store", 0},
+		{"private, no-store", 0},
+		{"private, max-age=60", 0},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, maxAge(testCase.cacheControl), testCase.cacheControl)
+	}
+}
+
+func TestHeadRequests(t *testing.T) {
+	t.Parallel()
+
+	handler := newTestCORSHandler(t, nil)
+	request := func(method string, path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{"Badge", "/static?subject=build&status=passing", http.StatusOK},
+		{"PathBadge", "/static/build/passing/green", http.StatusOK},
+		{"InvalidQuery", "/static?subject=build&status=passing&color=%23zzz", http.StatusBadRequest},
+		{"UnsupportedMetric", "/gitlab/bananas/google/gopacket", http.StatusNotFound},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// uncached HEAD request, then GET & cached HEAD requests
+			uncached := request("HEAD", testCase.path)
+			get := request("GET", testCase.path)
+			head := request("HEAD", testCase.path)
+
+			assert.Equal(t, testCase.expectedStatus, get.Code)
+			assert.NotEmpty(t, get.Body.String())
+			for _, res := range []*httptest.ResponseRecorder{uncached, head} {
+				assert.Equal(t, get.Code, res.Code)
+				assert.Empty(t, res.Body.String())
+				for _, name := range []string{"Content-Type", "Content-Length", "Cache-Control", "ETag", badgeWidthHeader, badgeHeightHeader} {
+					assert.Equal(t, get.Header().Get(name), res.Header().Get(name), name)
+				}
+			}
+			assert.Equal(t, strconv.Itoa(get.Body.Len()), head.Header().Get("Content-Length"))
+		})
+	}
+}
+
+func TestHeadRequestsByFormat(t *testing.T) {
+	t.Parallel()
+
+	handler := newTestCORSHandler(t, nil)
+	request := func(method string, accept string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/static?subject=build&status=passing", nil)
+		req.Header.Set("Accept", accept)
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	// the headers of the SVG badge are never replayed for HEAD requests negotiating another format
+	svg := request("GET", "image/svg+xml")
+	svgHead := request("HEAD", "image/svg+xml")
+	pngHead := request("HEAD", "image/png")
+	assert.Equal(t, svg.Header().Get("ETag"), svgHead.Header().Get("ETag"))
+	assert.Contains(t, svgHead.Header()["Vary"], "Accept")
+	assert.Equal(t, "image/png", pngHead.Header().Get("Content-Type"))
+	assert.NotEqual(t, svg.Header().Get("ETag"), pngHead.Header().Get("ETag"))
+}
+
+func TestWithHeadRequests(t *testing.T) {
+	t.Parallel()
+
+	fetches := 0
+	cache := newHeadResponseCache(2)
+	now := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	handler := withHeadRequests(cache, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Cache-Control", "public, max-age=60, s-maxage=60")
+		w.Header().Set("Content-Type", "image/svg+xml;utf-8")
+		w.Header().Set("Content-Length", "5")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set(requestIDHeader, strconv.Itoa(fetches))
+		w.Write([]byte("badge"))
+	}))
+	request := func(method string, path string, ifNoneMatch string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	// HEAD requests of recently requested badges are answered without fetching their data again
+	assert.Equal(t, "badge", request("GET", "/mock/stars/google/gopacket", "").Body.String())
+	head := request("HEAD", "/mock/stars/google/gopacket", "")
+	assert.Equal(t, 1, fetches)
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Empty(t, head.Body.String())
+	assert.Equal(t, "5", head.Header().Get("Content-Length"))
+	assert.Equal(t, `"abc"`, head.Header().Get("ETag"))
+	assert.Empty(t, head.Header().Get(requestIDHeader), "only badge headers are replayed")
+
+	notModified := request("HEAD", "/mock/stars/google/gopacket", `"abc"`)
+	assert.Equal(t, 1, fetches)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Equal(t, `"abc"`, notModified.Header().Get("ETag"))
+	assert.Empty(t, notModified.Header().Get("Content-Length"))
+
+	// other badges are fetched, with their body discarded
+	head = request("HEAD", "/mock/forks/google/gopacket", "")
+	assert.Equal(t, 2, fetches)
+	assert.Empty(t, head.Body.String())
+	assert.Equal(t, "5", head.Header().Get("Content-Length"))
+	request("HEAD", "/mock/forks/google/gopacket", "")
+	assert.Equal(t, 2, fetches)
+
+	// badges are fetched again once their response expires from caches
+	now = now.Add(61 * time.Second)
+	request("HEAD", "/mock/stars/google/gopacket", "")
+	assert.Equal(t, 3, fetches)
+
+	// expired responses are evicted first to make room for new ones
+	request("HEAD", "/mock/issues/google/gopacket", "")
+	assert.Len(t, cache.responses, 2)
+}
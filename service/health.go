@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// readinessCheckTTL represents how long the result of a readiness check is reused for
+	readinessCheckTTL = 30 * time.Second
+	// readinessCheckTimeout represents the maximum duration of a readiness check of an upstream API
+	readinessCheckTimeout = 2 * time.Second
+)
+
+// readinessCheckTargets represents the API root of each upstream API verified by readiness checks
+var readinessCheckTargets = map[string]string{
+	"bitbucket": "https://api.bitbucket.org/2.0/",
+	"github":    "https://api.github.com/",
+	"gitlab":    gitlabAPIBaseURL + "/version",
+}
+
+// readinessChecker verifies that the upstream APIs are reachable, reusing its result for a short while so that
+// frequent probes don't hammer the upstream APIs
+type readinessChecker struct {
+	mu        sync.Mutex
+	client    *http.Client
+	targets   map[string]string
+	ttl       time.Duration
+	checkedAt time.Time
+	err       error
+	now       func() time.Time
+}
+
+func newReadinessChecker(targets map[string]string) *readinessChecker {
+	return &readinessChecker{
+		client:  &http.Client{Timeout: readinessCheckTimeout},
+		targets: targets,
+		ttl:     readinessCheckTTL,
+		now:     time.Now,
+	}
+}
+
+// checkTarget verifies that the upstream API responds, any response other than a server error is considered reachable
+func (checker *readinessChecker) checkTarget(url string) error {
+	resp, err := checker.client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// check returns an error if any of the upstream APIs is unreachable
+func (checker *readinessChecker) check() error {
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+
+	if !checker.checkedAt.IsZero() && checker.now().Sub(checker.checkedAt) < checker.ttl {
+		return checker.err
+	}
+
+	providers := make([]string, 0, len(checker.targets))
+	for provider := range checker.targets {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	targetErrs := fanOutBestEffort(context.Background(), len(providers), len(providers), func(_ context.Context, i int) error {
+		return checker.checkTarget(checker.targets[providers[i]])
+	})
+	var errors []string
+	for i, err := range targetErrs {
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", providers[i], err))
+		}
+	}
+
+	checker.err = nil
+	if len(errors) > 0 {
+		checker.err = fmt.Errorf("unreachable upstream APIs: %s", strings.Join(errors, ", "))
+	}
+	checker.checkedAt = checker.now()
+	return checker.err
+}
+
+// writeProbeResponse writes a plain-text response that is never cached
+func writeProbeResponse(w http.ResponseWriter, statusCode int, body string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(body + "\n"))
+}
+
+// healthz handles liveness probes
+func healthz(w http.ResponseWriter, r *http.Request) {
+	writeProbeResponse(w, http.StatusOK, "ok")
+}
+
+// newReadyzHandler returns a HTTP handler for readiness probes, verifying the upstream APIs if a readiness checker
+// is provided
+func newReadyzHandler(checker *readinessChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checker != nil {
+			if err := checker.check(); err != nil {
+				writeProbeResponse(w, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+		}
+		writeProbeResponse(w, http.StatusOK, "ok")
+	})
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthz(t *testing.T) {
+	t.Parallel()
+
+	runHTTPTest(t, httpTestCase{
+		requestMethod: "GET",
+		requestPath:   "/healthz",
+		expectedHeaders: map[string]string{
+			"Cache-Control": "no-store",
+			"Content-Type":  "text/plain; charset=utf-8",
+		},
+		expectedStatus: 200,
+		expectedBody:   "ok\n",
+	})
+}
+
+func TestReadyzWithoutUpstreamChecks(t *testing.T) {
+	t.Parallel()
+
+	runHTTPTest(t, httpTestCase{
+		requestMethod: "GET",
+		requestPath:   "/readyz",
+		expectedHeaders: map[string]string{
+			"Cache-Control": "no-store",
+		},
+		expectedStatus: 200,
+		expectedBody:   "ok\n",
+	})
+}
+
+func TestReadyzWithUpstreamChecks(t *testing.T) {
+	t.Parallel()
+
+	var failing int32
+	var calls int32
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		// client errors still mean the upstream API is reachable
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer fakeAPI.Close()
+
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	checker := newReadinessChecker(map[string]string{"gitlab": fakeAPI.URL})
+	checker.now = func() time.Time { return now }
+	handler := newReadyzHandler(checker)
+	probe := func() *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	// ready
+	assert.Equal(t, http.StatusOK, probe().Code)
+	assert.Equal(t, int32(1), calls)
+
+	// results are reused within the TTL, even after the upstream API fails
+	atomic.StoreInt32(&failing, 1)
+	now = now.Add(readinessCheckTTL - time.Second)
+	assert.Equal(t, http.StatusOK, probe().Code)
+	assert.Equal(t, int32(1), calls)
+
+	// not ready
+	now = now.Add(time.Second)
+	res := probe()
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+	assert.Equal(t, "unreachable upstream APIs: gitlab: unexpected status code: 502\n", res.Body.String())
+	assert.Equal(t, int32(2), calls)
+
+	// ready again once the upstream API recovers
+	atomic.StoreInt32(&failing, 0)
+	now = now.Add(readinessCheckTTL)
+	assert.Equal(t, http.StatusOK, probe().Code)
+	assert.Equal(t, int32(3), calls)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// healthyScore represents the minimum health score of a "healthy" repository
+	healthyScore = 70
+	// fairScore represents the minimum health score of a "fair" repository
+	fairScore = 40
+)
+
+// repositoryHealthSignals represents the signals of a repository that its health score is computed from
+type repositoryHealthSignals struct {
+	lastCommittedAt  time.Time
+	openIssueCount   int
+	closedIssueCount int
+	hasLicense       bool
+	hasCI            bool
+	lastReleasedAt   time.Time
+}
+
+// recencyScore returns 1 for times within the fresh duration, decaying linearly to 0 for times older than
+// the stale duration, & 0 for zero times
+func recencyScore(t time.Time, now time.Time, fresh time.Duration, stale time.Duration) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	age := now.Sub(t)
+	if age <= fresh {
+		return 1
+	}
+	if age >= stale {
+		return 0
+	}
+	return float64(stale-age) / float64(stale-fresh)
+}
+
+// boolScore returns 1 for true & 0 for false
+func boolScore(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// computeHealthScore returns the health score of a repository from 0 to 100, as the weighted average of the
+// score of each signal (from 0 to 1):
+//   - commit: 1 if last committed within 30 days, decaying linearly to 0 at 365 days
+//   - issues: ratio of closed issues to all issues, 1 if there are no issues
+//   - license: 1 if a license is detected
+//   - ci: 1 if the latest commit has any status checks or check suites
+//   - release: 1 if last released within 90 days, decaying linearly to 0 at 365 days, 0 if never released
+func computeHealthScore(signals repositoryHealthSignals, weights map[string]uint, now time.Time) int {
+	day := 24 * time.Hour
+	issueScore := 1.0
+	if total := signals.openIssueCount + signals.closedIssueCount; total > 0 {
+		issueScore = float64(signals.closedIssueCount) / float64(total)
+	}
+	scores := map[string]float64{
+		"commit":  recencyScore(signals.lastCommittedAt, now, 30*day, 365*day),
+		"issues":  issueScore,
+		"license": boolScore(signals.hasLicense),
+		"ci":      boolScore(signals.hasCI),
+		"release": recencyScore(signals.lastReleasedAt, now, 90*day, 365*day),
+	}
+
+	var weightedScore, totalWeight float64
+	for signal, score := range scores {
+		weightedScore += float64(weights[signal]) * score
+		totalWeight += float64(weights[signal])
+	}
+	if totalWeight == 0 {
+		return 0
+	}
+	return int(math.Round(100 * weightedScore / totalWeight))
+}
+
+// healthStatus returns the badge status & color of the health score
+func healthStatus(score int) (string, string) {
+	switch {
+	case score >= healthyScore:
+		return "healthy", "green"
+	case score >= fairScore:
+		return "fair", "yellow"
+	default:
+		return "at risk", "red"
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecencyScore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	testCases := []struct {
+		name     string
+		input    time.Time
+		expected float64
+	}{
+		{"Zero", time.Time{}, 0},
+		{"Fresh", now.Add(-10 * day), 1},
+		{"FreshBoundary", now.Add(-30 * day), 1},
+		{"Halfway", now.Add(-75 * day), 0.5},
+		{"StaleBoundary", now.Add(-120 * day), 0},
+		{"Stale", now.Add(-400 * day), 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.InDelta(t, testCase.expected, recencyScore(testCase.input, now, 30*day, 120*day), 1e-9)
+		})
+	}
+}
+
+func TestComputeHealthScore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	weights := map[string]uint{"commit": 30, "issues": 20, "license": 15, "ci": 15, "release": 20}
+	testCases := []struct {
+		name     string
+		signals  repositoryHealthSignals
+		weights  map[string]uint
+		expected int
+	}{
+		{"AllSignals", repositoryHealthSignals{
+			lastCommittedAt:  now.AddDate(0, 0, -1),
+			openIssueCount:   0,
+			closedIssueCount: 10,
+			hasLicense:       true,
+			hasCI:            true,
+			lastReleasedAt:   now.AddDate(0, -1, 0),
+		}, weights, 100},
+		{"NoSignals", repositoryHealthSignals{openIssueCount: 10}, weights, 0},
+		{"NoIssues", repositoryHealthSignals{}, weights, 20},
+		{"HalfClosedIssues", repositoryHealthSignals{openIssueCount: 5, closedIssueCount: 5, hasLicense: true}, weights, 25},
+		{"CustomWeights", repositoryHealthSignals{hasLicense: true, openIssueCount: 1}, map[string]uint{"license": 1, "ci": 1}, 50},
+		{"ZeroWeights", repositoryHealthSignals{hasLicense: true}, map[string]uint{}, 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, computeHealthScore(testCase.signals, testCase.weights, now))
+		})
+	}
+}
+
+func TestHealthStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		score          int
+		expectedStatus string
+		expectedColor  string
+	}{
+		{100, "healthy", "green"},
+		{70, "healthy", "green"},
+		{69, "fair", "yellow"},
+		{40, "fair", "yellow"},
+		{39, "at risk", "red"},
+		{0, "at risk", "red"},
+	}
+
+	for _, testCase := range testCases {
+		status, color := healthStatus(testCase.score)
+		assert.Equal(t, testCase.expectedStatus, status, testCase.score)
+		assert.Equal(t, testCase.expectedColor, color, testCase.score)
+	}
+}
@@ -0,0 +1,479 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// historyDateLayout represents the date format used for metric snapshots
+	historyDateLayout = "2006-01-02"
+	// defaultHistoryDays represents the number of days returned when no `days` query is provided
+	defaultHistoryDays = 90
+	// sparklineDays represents the number of days drawn in sparklines
+	sparklineDays = 30
+)
+
+// sparklineContextKey is the request context key of the sparkline values
+type sparklineContextKey struct{}
+
+// historyTarget identifies a metric of a repository
+type historyTarget struct {
+	Provider string `json:"provider"`
+	Owner    string `json:"owner"`
+	Repo     string `json:"repo"`
+	Metric   string `json:"metric"`
+}
+
+// historyRecord represents a daily metric snapshot, stored as a single line in the history file
+type historyRecord struct {
+	historyTarget
+	Date  string `json:"date"`
+	Value int    `json:"value"`
+}
+
+// historyPoint represents a single data point of a metric series
+type historyPoint struct {
+	Date  string `json:"date"`
+	Value int    `json:"value"`
+}
+
+// historyResponse represents the JSON response of the history service
+type historyResponse struct {
+	Version string `json:"version"`
+	historyTarget
+	Points []historyPoint `json:"points"`
+}
+
+// parseHistoryTarget parses a target in the form of `<PROVIDER>/<OWNER>/<REPO>/<METRIC>`
+func parseHistoryTarget(str string) (historyTarget, error) {
+	segments := strings.Split(str, "/")
+	if len(segments) != 4 {
+		return historyTarget{}, fmt.Errorf("invalid history target: %s", str)
+	}
+	for _, segment := range segments {
+		if segment == "" {
+			return historyTarget{}, fmt.Errorf("invalid history target: %s", str)
+		}
+	}
+
+	return historyTarget{
+		Provider: segments[0],
+		Owner:    segments[1],
+		Repo:     segments[2],
+		Metric:   segments[3],
+	}, nil
+}
+
+// fetchMetric fetches the value of a metric from a git provider service
+func fetchMetric(ctx context.Context, service GitProviderService, owner string, repo string, metric string) (int, error) {
+	switch metric {
+	case "forks":
+		return service.getForkCount(ctx, owner, repo)
+	case "issues":
+		return service.getIssueCount(ctx, owner, repo, "")
+	case "merge-requests", "pull-requests":
+		return service.getPullRequestCount(ctx, owner, repo, "")
+	case "stars":
+		return service.getStarCount(ctx, owner, repo)
+	default:
+		return 0, fmt.Errorf("unsupported metric: %s", metric)
+	}
+}
+
+// historyStore stores daily metric snapshots in a JSONL file
+type historyStore struct {
+	mu        sync.RWMutex
+	path      string
+	retention time.Duration
+	records   []historyRecord
+	now       func() time.Time
+}
+
+// newHistoryStore returns a history store backed by the given file, loading any existing snapshots
+func newHistoryStore(path string, retention time.Duration) (*historyStore, error) {
+	store := &historyStore{
+		path:      path,
+		retention: retention,
+		now:       time.Now,
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var record historyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse history file: %v", err)
+		}
+		store.records = append(store.records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// today returns the current date in the snapshot date format
+func (store *historyStore) today() string {
+	return store.now().UTC().Format(historyDateLayout)
+}
+
+// has reports whether a snapshot of the target has been recorded on the given date
+func (store *historyStore) has(target historyTarget, date string) bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, record := range store.records {
+		if record.historyTarget == target && record.Date == date {
+			return true
+		}
+	}
+	return false
+}
+
+// add records today's snapshot of the target, subsequent snapshots on the same day are ignored
+func (store *historyStore) add(target historyTarget, value int) error {
+	date := store.today()
+	if store.has(target, date) {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	record := historyRecord{historyTarget: target, Date: date, Value: value}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(store.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	store.records = append(store.records, record)
+	return nil
+}
+
+// prune removes snapshots older than the retention period & rewrites the history file
+func (store *historyStore) prune() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	cutoff := store.now().UTC().Add(-store.retention).Format(historyDateLayout)
+	records := make([]historyRecord, 0, len(store.records))
+	for _, record := range store.records {
+		if record.Date >= cutoff {
+			records = append(records, record)
+		}
+	}
+	if len(records) == len(store.records) {
+		return nil
+	}
+
+	// Write into a temporary file first so that the history file is never left half-written
+	tmpFile, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), store.path); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	store.records = records
+	return nil
+}
+
+// series returns the snapshots of the target recorded within the last given number of days, oldest first
+func (store *historyStore) series(target historyTarget, days int) []historyPoint {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	cutoff := store.now().UTC().AddDate(0, 0, -days).Format(historyDateLayout)
+	points := []historyPoint{}
+	for _, record := range store.records {
+		if record.historyTarget == target && record.Date > cutoff {
+			points = append(points, historyPoint{Date: record.Date, Value: record.Value})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Date < points[j].Date })
+
+	return points
+}
+
+// sparkline returns the target's daily snapshots between its first & last snapshot of the last 30 days,
+// days without snapshots are represented by NaN
+func (store *historyStore) sparkline(target historyTarget) []float64 {
+	points := store.series(target, sparklineDays)
+	if len(points) == 0 {
+		return nil
+	}
+
+	firstDate, _ := time.Parse(historyDateLayout, points[0].Date)
+	lastDate, _ := time.Parse(historyDateLayout, points[len(points)-1].Date)
+	values := make([]float64, int(lastDate.Sub(firstDate).Hours()/24)+1)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	for _, point := range points {
+		date, _ := time.Parse(historyDateLayout, point.Date)
+		values[int(date.Sub(firstDate).Hours()/24)] = float64(point.Value)
+	}
+
+	return values
+}
+
+// withSparkline adds the recorded snapshots of the requested metric into the request context
+// when the sparkline is requested with `sparkline=true`
+func withSparkline(store *historyStore, provider string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("sparkline") == "true" && query.Get("state") == "" {
+			routeVariables := mux.Vars(r)
+			values := store.sparkline(historyTarget{
+				Provider: provider,
+				Owner:    routeVariables["owner"],
+				Repo:     routeVariables["repo"],
+				Metric:   routeVariables["method"],
+			})
+			r = r.WithContext(context.WithValue(r.Context(), sparklineContextKey{}, values))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sparklineFromRequest returns the sparkline values added by `withSparkline`
+func sparklineFromRequest(r *http.Request) []float64 {
+	values, _ := r.Context().Value(sparklineContextKey{}).([]float64)
+	return values
+}
+
+// historyRecorder periodically records snapshots of the configured metrics
+type historyRecorder struct {
+	store    *historyStore
+	targets  []historyTarget
+	services map[string]GitProviderService
+	interval time.Duration
+	logger   *zap.Logger
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// newHistoryRecorder returns a recorder for the configured history targets
+func newHistoryRecorder(configuration *config.Config, logger *zap.Logger,
+	store *historyStore, services map[string]GitProviderService) (*historyRecorder, error) {
+	targets := make([]historyTarget, 0, len(configuration.HistoryTargets))
+	for _, str := range configuration.HistoryTargets {
+		target, err := parseHistoryTarget(str)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := services[target.Provider]; !ok {
+			return nil, fmt.Errorf("unsupported history target provider: %s", target.Provider)
+		}
+		targets = append(targets, target)
+	}
+
+	return &historyRecorder{
+		store:    store,
+		targets:  targets,
+		services: services,
+		interval: configuration.HistoryInterval,
+		logger:   logger,
+		stopCh:   make(chan struct{}),
+	}, nil
+}
+
+// record fetches & stores a snapshot of every target that hasn't been recorded today
+func (recorder *historyRecorder) record() {
+	date := recorder.store.today()
+	for _, target := range recorder.targets {
+		select {
+		case <-recorder.stopCh:
+			return
+		default:
+		}
+
+		if recorder.store.has(target, date) {
+			continue
+		}
+		value, err := fetchMetric(context.Background(), recorder.services[target.Provider], target.Owner, target.Repo, target.Metric)
+		if err != nil {
+			recorder.logger.Error("Failed to fetch metric snapshot",
+				zap.String("provider", target.Provider),
+				zap.String("owner", target.Owner),
+				zap.String("repo", target.Repo),
+				zap.String("metric", target.Metric),
+				zap.Error(err))
+			continue
+		}
+		if err := recorder.store.add(target, value); err != nil {
+			recorder.logger.Error("Failed to store metric snapshot",
+				zap.String("provider", target.Provider),
+				zap.String("owner", target.Owner),
+				zap.String("repo", target.Repo),
+				zap.String("metric", target.Metric),
+				zap.Error(err))
+		}
+	}
+
+	if err := recorder.store.prune(); err != nil {
+		recorder.logger.Error("Failed to prune metric snapshots", zap.Error(err))
+	}
+}
+
+// start records snapshots immediately & then once every interval until stopped
+func (recorder *historyRecorder) start() {
+	recorder.wg.Add(1)
+	go func() {
+		defer recorder.wg.Done()
+
+		ticker := time.NewTicker(recorder.interval)
+		defer ticker.Stop()
+		for {
+			recorder.record()
+			select {
+			case <-ticker.C:
+			case <-recorder.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops recording snapshots & waits for any in-progress recording to finish
+func (recorder *historyRecorder) stop() {
+	close(recorder.stopCh)
+	recorder.wg.Wait()
+}
+
+type historyService struct {
+	name   string
+	store  *historyStore
+	config *config.Config
+	logger *zap.Logger
+}
+
+// NewHistoryService returns a HTTP handler serving recorded metric snapshots
+func NewHistoryService(configuration *config.Config, logger *zap.Logger,
+	store *historyStore) (http.Handler, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("missing history store dependency")
+	}
+
+	return &historyService{
+		name:   "history",
+		store:  store,
+		config: configuration,
+		logger: logger,
+	}, nil
+}
+
+func (service *historyService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(service.logger, r)
+	routeVariables := mux.Vars(r)
+	target := historyTarget{
+		Provider: routeVariables["provider"],
+		Owner:    routeVariables["owner"],
+		Repo:     routeVariables["repo"],
+		Metric:   routeVariables["metric"],
+	}
+
+	days := defaultHistoryDays
+	if queryDays := r.URL.Query().Get("days"); queryDays != "" {
+		var err error
+		days, err = strconv.Atoi(queryDays)
+		if err != nil || days <= 0 {
+			logger.Info("Unsupported days",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.String("days", queryDays))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	body, err := json.Marshal(historyResponse{
+		Version:       apiVersion,
+		historyTarget: target,
+		Points:        service.store.series(target, days),
+	})
+	if err != nil {
+		logger.Error("Failed to encode history",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !service.config.ExcludeCacheControlHeaders {
+		// cache response in browser for 1 hour (3600), CDN for 1 hour (3600)
+		w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=3600")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+var testHistoryTarget = historyTarget{Provider: "github", Owner: "google", Repo: "gopacket", Metric: "stars"}
+
+func newTestHistoryStore(t *testing.T, now time.Time) (*historyStore, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := newHistoryStore(filepath.Join(dir, "history.jsonl"), 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.now = func() time.Time { return now }
+
+	return store, func() { os.RemoveAll(dir) }
+}
+
+func readHistoryLines(t *testing.T, path string) []string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestParseHistoryTarget(t *testing.T) {
+	t.Parallel()
+
+	target, err := parseHistoryTarget("github/google/gopacket/stars")
+	assert.NoError(t, err)
+	assert.Equal(t, testHistoryTarget, target)
+
+	for _, input := range []string{"", "github/google/gopacket", "github//gopacket/stars", "a/b/c/d/e"} {
+		_, err := parseHistoryTarget(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestHistoryStoreSameDayWritesAreIdempotent(t *testing.T) {
+	t.Parallel()
+
+	store, cleanup := newTestHistoryStore(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC))
+	defer cleanup()
+
+	assert.NoError(t, store.add(testHistoryTarget, 10))
+	assert.NoError(t, store.add(testHistoryTarget, 11))
+	assert.Len(t, readHistoryLines(t, store.path), 1)
+
+	reloadedStore, err := newHistoryStore(store.path, store.retention)
+	assert.NoError(t, err)
+	reloadedStore.now = store.now
+	assert.NoError(t, reloadedStore.add(testHistoryTarget, 12))
+	assert.Equal(t, []historyPoint{{Date: "2020-01-02", Value: 10}}, reloadedStore.series(testHistoryTarget, 1))
+	assert.Len(t, readHistoryLines(t, store.path), 1)
+}
+
+func TestHistoryStorePrune(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	store, cleanup := newTestHistoryStore(t, now)
+	defer cleanup()
+
+	for _, daysAgo := range []int{45, 31, 30, 1, 0} {
+		store.now = func() time.Time { return now.AddDate(0, 0, -daysAgo) }
+		assert.NoError(t, store.add(testHistoryTarget, daysAgo))
+	}
+	store.now = func() time.Time { return now }
+	assert.NoError(t, store.prune())
+
+	expected := []historyPoint{
+		{Date: "2020-01-31", Value: 30},
+		{Date: "2020-02-29", Value: 1},
+		{Date: "2020-03-01", Value: 0},
+	}
+	assert.Equal(t, expected, store.series(testHistoryTarget, 90))
+	assert.Len(t, readHistoryLines(t, store.path), 3)
+}
+
+func TestHistoryStoreSeries(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	store, cleanup := newTestHistoryStore(t, now)
+	defer cleanup()
+
+	otherTarget := historyTarget{Provider: "github", Owner: "google", Repo: "gopacket", Metric: "forks"}
+	for _, daysAgo := range []int{0, 2, 1, 5} {
+		store.now = func() time.Time { return now.AddDate(0, 0, -daysAgo) }
+		assert.NoError(t, store.add(testHistoryTarget, daysAgo))
+		assert.NoError(t, store.add(otherTarget, -daysAgo))
+	}
+	store.now = func() time.Time { return now }
+
+	expected := []historyPoint{
+		{Date: "2020-02-28", Value: 2},
+		{Date: "2020-02-29", Value: 1},
+		{Date: "2020-03-01", Value: 0},
+	}
+	assert.Equal(t, expected, store.series(testHistoryTarget, 3))
+	assert.Equal(t, []historyPoint{}, store.series(historyTarget{Provider: "gitlab"}, 3))
+}
+
+func TestHistoryStoreSparkline(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	store, cleanup := newTestHistoryStore(t, now)
+	defer cleanup()
+
+	for _, daysAgo := range []int{40, 4, 3, 1} {
+		store.now = func() time.Time { return now.AddDate(0, 0, -daysAgo) }
+		assert.NoError(t, store.add(testHistoryTarget, 10-daysAgo))
+	}
+	store.now = func() time.Time { return now }
+
+	values := store.sparkline(testHistoryTarget)
+	assert.Len(t, values, 4)
+	assert.Equal(t, []float64{6, 7}, values[:2])
+	assert.True(t, math.IsNaN(values[2]))
+	assert.Equal(t, float64(9), values[3])
+	assert.Nil(t, store.sparkline(historyTarget{Provider: "gitlab"}))
+}
+
+func TestWithSparkline(t *testing.T) {
+	t.Parallel()
+
+	store, cleanup := newTestHistoryStore(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC))
+	defer cleanup()
+	assert.NoError(t, store.add(testHistoryTarget, 42))
+
+	var values []float64
+	router := mux.NewRouter()
+	router.Handle(`/github/{method}/{owner}/{repo}`, withSparkline(store, "github", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values = sparklineFromRequest(r)
+	})))
+
+	tests := []struct {
+		url      string
+		expected []float64
+	}{
+		{"/github/stars/google/gopacket?sparkline=true", []float64{42}},
+		{"/github/stars/google/gopacket", nil},
+		{"/github/stars/google/gopacket?sparkline=true&state=open", nil},
+		{"/github/forks/google/gopacket?sparkline=true", nil},
+	}
+	for _, test := range tests {
+		values = nil
+		req, _ := http.NewRequest("GET", test.url, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, test.expected, values, test.url)
+	}
+}
+
+func TestHistoryRecorder(t *testing.T) {
+	t.Parallel()
+
+	store, cleanup := newTestHistoryStore(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC))
+	defer cleanup()
+
+	mockService := &mockGitProviderService{value: 42}
+	recorder, err := newHistoryRecorder(&config.Config{
+		HistoryInterval: time.Hour,
+		HistoryTargets:  []string{"github/google/gopacket/stars", "github/google/gopacket/forks"},
+	}, zap.NewNop(), store, map[string]GitProviderService{"github": mockService})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// targets already recorded today are not fetched again
+	recorder.record()
+	recorder.record()
+	assert.Equal(t, int32(2), mockService.calls)
+	assert.Equal(t, []historyPoint{{Date: "2020-01-02", Value: 42}}, store.series(testHistoryTarget, 1))
+
+	recorder.start()
+	recorder.stop()
+	assert.Equal(t, int32(2), mockService.calls)
+
+	_, err = newHistoryRecorder(&config.Config{
+		HistoryTargets: []string{"sourceforge/google/gopacket/stars"},
+	}, zap.NewNop(), store, map[string]GitProviderService{"github": mockService})
+	assert.Error(t, err)
+}
+
+func TestHistoryService(t *testing.T) {
+	t.Parallel()
+
+	store, cleanup := newTestHistoryStore(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC))
+	defer cleanup()
+	assert.NoError(t, store.add(testHistoryTarget, 42))
+
+	historyService, err := NewHistoryService(&config.Config{}, zap.NewNop(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.Handle(`/api/v1/history/{provider}/{owner}/{repo}/{metric}`, historyService)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/history/github/google/gopacket/stars?days=30", nil)
+	router.ServeHTTP(res, req)
+
+	var body historyResponse
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+	assert.Equal(t, historyResponse{
+		Version:       apiVersion,
+		historyTarget: testHistoryTarget,
+		Points:        []historyPoint{{Date: "2020-01-02", Value: 42}},
+	}, body)
+
+	for _, days := range []string{"-1", "0", "abc"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/history/github/google/gopacket/stars?days="+days, nil)
+		router.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// indexRouteVariablePattern matches the variables of route path templates, eg. `{owner}` or `{number:[0-9]+}`
+var indexRouteVariablePattern = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+// indexRouteVariableAlternativesPattern matches route variable patterns made of literal alternatives, eg. `user|org`
+var indexRouteVariableAlternativesPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+(\|[A-Za-z0-9_.-]+)*$`)
+
+// indexExampleRouteVariables represents the values of route variables used in example URLs
+var indexExampleRouteVariables = map[string]string{
+	"color":        "green",
+	"metric":       "stars",
+	"number":       "1",
+	"organization": "tohjustin",
+	"owner":        "tohjustin",
+	"package":      "aegis",
+	"project":      "aegis",
+	"provider":     "github",
+	"repo":         "aegis",
+	"status":       "passing",
+	"subject":      "build",
+	"tag":          "latest",
+	"workflow":     "ci",
+}
+
+// indexRoute represents a route registered on the application router
+type indexRoute struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"`
+	Example string   `json:"example"`
+}
+
+// indexProvider represents a badge provider, with the metrics selected by the `method` route variable & the query
+// parameters specific to some of its metrics
+type indexProvider struct {
+	Name            string                       `json:"name"`
+	Metrics         []string                     `json:"metrics"`
+	QueryParameters map[string][]badgeQueryParam `json:"queryParameters,omitempty"`
+	Routes          []indexRoute                 `json:"routes"`
+}
+
+// indexResponse represents the description of the application routes returned by the index route
+type indexResponse struct {
+	Providers       []indexProvider   `json:"providers"`
+	Routes          []indexRoute      `json:"routes"`
+	QueryParameters []badgeQueryParam `json:"queryParameters"`
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>aegis</title></head>
+<body>
+<h1>aegis</h1>
+<h2>Providers</h2>
+{{range .Providers}}<h3>{{.Name}}</h3>
+<p>Metrics: {{range $i, $metric := .Metrics}}{{if $i}}, {{end}}<code>{{$metric}}</code>{{end}}</p>
+{{if .QueryParameters}}<p>Query parameters:</p>
+<ul>{{range $metric, $params := .QueryParameters}}{{range $params}}<li><code>{{.Name}}</code>{{if $metric}} (<code>{{$metric}}</code> only){{end}}: {{.Description}}</li>{{end}}{{end}}</ul>
+{{end}}<ul>{{range .Routes}}<li><code>{{.Path}}</code> (eg. <a href="{{.Example}}">{{.Example}}</a>)</li>{{end}}</ul>
+{{end}}<h2>Routes</h2>
+<ul>{{range .Routes}}<li><code>{{.Path}}</code> (eg. <a href="{{.Example}}">{{.Example}}</a>)</li>{{end}}</ul>
+<h2>Query Parameters</h2>
+<ul>{{range .QueryParameters}}<li><code>{{.Name}}</code>: {{.Description}} (eg. <code>{{.Name}}={{.Example}}</code>)</li>{{end}}</ul>
+</body>
+</html>
+`))
+
+// exampleRoutePath returns an example path of the route path template, replacing route variables with example values
+// & the `method` route variable with a metric supported by the provider
+func exampleRoutePath(pathTemplate string, metrics []string) string {
+	return indexRouteVariablePattern.ReplaceAllStringFunc(pathTemplate, func(variable string) string {
+		submatches := indexRouteVariablePattern.FindStringSubmatch(variable)
+		name, pattern := submatches[1], submatches[2]
+		switch {
+		case indexRouteVariableAlternativesPattern.MatchString(pattern):
+			return strings.Split(pattern, "|")[0]
+		case name == "method" && len(metrics) > 0:
+			return metrics[0]
+		case indexExampleRouteVariables[name] != "":
+			return indexExampleRouteVariables[name]
+		default:
+			return name
+		}
+	})
+}
+
+// newIndexResponse describes the routes registered on the router, grouping the routes of the metric services by
+// provider (ie. the first path segment) in the order they were registered
+func newIndexResponse(router *mux.Router, metricServices map[string]MetricService) (*indexResponse, error) {
+	response := &indexResponse{
+		Providers:       []indexProvider{},
+		Routes:          []indexRoute{},
+		QueryParameters: badgeQueryParams,
+	}
+	providerIndexes := map[string]int{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		pathTemplate, err := route.GetPathTemplate()
+		if err != nil || isDebugRoute(pathTemplate) {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+
+		name := strings.SplitN(strings.TrimPrefix(pathTemplate, "/"), "/", 2)[0]
+		service, ok := metricServices[name]
+		if !ok {
+			response.Routes = append(response.Routes, indexRoute{Path: pathTemplate, Methods: methods, Example: exampleRoutePath(pathTemplate, nil)})
+			return nil
+		}
+
+		i, ok := providerIndexes[name]
+		if !ok {
+			i = len(response.Providers)
+			providerIndexes[name] = i
+			provider := indexProvider{Name: name, Metrics: service.SupportedMetrics()}
+			if service, ok := service.(queryParamsService); ok {
+				provider.QueryParameters = service.supportedQueryParams()
+			}
+			response.Providers = append(response.Providers, provider)
+		}
+		provider := &response.Providers[i]
+		provider.Routes = append(provider.Routes, indexRoute{Path: pathTemplate, Methods: methods, Example: exampleRoutePath(pathTemplate, provider.Metrics)})
+		return nil
+	})
+	return response, err
+}
+
+// newIndexHandler returns a HTTP handler describing the routes registered on the router, as HTML for clients
+// accepting `text/html` (eg. browsers) & as JSON otherwise
+func newIndexHandler(configuration *config.Config, router *mux.Router, metricServices map[string]MetricService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, err := newIndexResponse(router, metricServices)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		var body bytes.Buffer
+		contentType := "application/json"
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			contentType = "text/html; charset=utf-8"
+			err = indexTemplate.Execute(&body, response)
+		} else {
+			err = json.NewEncoder(&body).Encode(response)
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		setCacheControlHeaders(w, configuration, configuration.MinCacheSeconds)
+		w.Header().Add("Vary", "Accept")
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body.Bytes())
+	})
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestIndexApplication returns an application with the git provider services & the npm service
+func newTestIndexApplication(t *testing.T, rootRedirectURL string) *Application {
+	configuration := &config.Config{
+		CacheSeconds:      3600,
+		MinCacheSeconds:   300,
+		MaxCacheSeconds:   86400,
+		GithubAccessToken: "token",
+		RootRedirectURL:   rootRedirectURL,
+	}
+	staticService, err := NewStaticService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitbucketService, err := NewBitbucketService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	giteaService, err := NewGiteaService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	githubService, err := NewGithubService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitlabService, err := NewGitlabService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	npmService, err := NewNpmService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Application{
+		config:           configuration,
+		staticService:    &staticService,
+		bitbucketService: &bitbucketService,
+		giteaService:     &giteaService,
+		githubService:    &githubService,
+		gitlabService:    &gitlabService,
+		npmService:       npmService,
+	}
+}
+
+func TestExampleRoutePath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		pathTemplate string
+		metrics      []string
+		expected     string
+	}{
+		{"/healthz", nil, "/healthz"},
+		{"/static/{subject}/{status}/{color}", nil, "/static/build/passing/green"},
+		{"/github/{method}/{owner}/{repo}", []string{"stars", "forks"}, "/github/stars/tohjustin/aegis"},
+		{"/github/{account:user}/{owner}/{method:followers|repos|sponsors}", []string{"stars"}, "/github/user/tohjustin/followers"},
+		{"/github/{method:milestone}/{owner}/{repo}/{number:[0-9]+}", nil, "/github/milestone/tohjustin/aegis/1"},
+		{"/bananas/{unknown}", nil, "/bananas/unknown"},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, exampleRoutePath(testCase.pathTemplate, testCase.metrics), testCase.pathTemplate)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	t.Parallel()
+
+	app := newTestIndexApplication(t, "")
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "*/*")
+	app.handler().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=300, s-maxage=300", res.Header().Get("Cache-Control"))
+	assert.Contains(t, res.Header()["Vary"], "Accept")
+
+	var response indexResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	// every provider is listed with all the metrics it supports
+	providers := map[string]indexProvider{}
+	for _, provider := range response.Providers {
+		providers[provider.Name] = provider
+	}
+	metricServices := app.metricServices()
+	assert.Len(t, providers, len(metricServices))
+	for name, service := range metricServices {
+		if assert.Contains(t, providers, name) {
+			assert.ElementsMatch(t, service.SupportedMetrics(), providers[name].Metrics, name)
+			assert.NotEmpty(t, providers[name].Routes, name)
+		}
+	}
+	assert.Contains(t, providers["github"].Routes, indexRoute{
+		Path:    "/github/{method}/{owner}/{repo}",
+		Methods: []string{"GET", "HEAD"},
+		Example: "/github/" + providers["github"].Metrics[0] + "/tohjustin/aegis",
+	})
+
+	// every example URL matches the path template of its route
+	for _, provider := range response.Providers {
+		for _, route := range provider.Routes {
+			router := mux.NewRouter()
+			router.Path(route.Path)
+			assert.True(t, router.Match(httptest.NewRequest("GET", route.Example, nil), &mux.RouteMatch{}), route.Example)
+		}
+	}
+
+	assert.Contains(t, response.Routes, indexRoute{Path: "/healthz", Methods: []string{"GET", "HEAD"}, Example: "/healthz"})
+	assert.Contains(t, response.Routes, indexRoute{Path: "/static/{subject}/{status}", Methods: []string{"GET", "HEAD"}, Example: "/static/build/passing"})
+	assert.Equal(t, badgeQueryParams, response.QueryParameters)
+}
+
+func TestIndexHTML(t *testing.T) {
+	t.Parallel()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	newTestIndexApplication(t, "").handler().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/html; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Contains(t, res.Body.String(), "<h3>npm</h3>")
+	assert.Contains(t, res.Body.String(), `<a href="/static/build/passing">/static/build/passing</a>`)
+	assert.Contains(t, res.Body.String(), "<code>colorRanges</code>")
+}
+
+func TestIndexWithRootRedirectURL(t *testing.T) {
+	t.Parallel()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	newTestIndexApplication(t, "https://github.com/tohjustin/aegis").handler().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusFound, res.Code)
+	assert.Equal(t, "https://github.com/tohjustin/aegis", res.Header().Get("Location"))
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// spdxLicenseIDs represents the SPDX license IDs detected by GitHub that are accepted in license allowlists
+var spdxLicenseIDs = []string{
+	"0BSD",
+	"AFL-3.0",
+	"AGPL-3.0",
+	"Apache-2.0",
+	"Artistic-2.0",
+	"BSD-2-Clause",
+	"BSD-3-Clause",
+	"BSD-3-Clause-Clear",
+	"BSL-1.0",
+	"CC-BY-4.0",
+	"CC-BY-SA-4.0",
+	"CC0-1.0",
+	"ECL-2.0",
+	"EPL-1.0",
+	"EPL-2.0",
+	"EUPL-1.1",
+	"EUPL-1.2",
+	"GPL-2.0",
+	"GPL-3.0",
+	"ISC",
+	"LGPL-2.1",
+	"LGPL-3.0",
+	"LPPL-1.3c",
+	"MIT",
+	"MPL-2.0",
+	"MS-PL",
+	"MS-RL",
+	"NCSA",
+	"OFL-1.1",
+	"OSL-3.0",
+	"PostgreSQL",
+	"Unlicense",
+	"UPL-1.0",
+	"WTFPL",
+	"Zlib",
+}
+
+// normalizeLicenseID strips the license ID down to its lowercased letters & digits,
+// so that similar forms of the same license ID can be matched (eg. "apache2" & "Apache-2.0")
+func normalizeLicenseID(id string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(id) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// suggestLicenseIDs returns the SPDX license IDs similar to the given license ID, or all supported
+// SPDX license IDs if none are similar
+func suggestLicenseIDs(id string) []string {
+	normalizedID := normalizeLicenseID(id)
+	var suggestions []string
+	if normalizedID != "" {
+		for _, spdxID := range spdxLicenseIDs {
+			normalizedSPDXID := normalizeLicenseID(spdxID)
+			if strings.HasPrefix(normalizedSPDXID, normalizedID) || strings.HasPrefix(normalizedID, normalizedSPDXID) {
+				suggestions = append(suggestions, spdxID)
+			}
+		}
+	}
+	if len(suggestions) == 0 {
+		return spdxLicenseIDs
+	}
+	return suggestions
+}
+
+// invalidLicenseIDError represents a license ID that is not a supported SPDX license ID
+type invalidLicenseIDError struct {
+	id          string
+	suggestions []string
+}
+
+func (err *invalidLicenseIDError) Error() string {
+	return fmt.Sprintf("license %q is not a SPDX license ID, valid forms: %s", err.id, strings.Join(err.suggestions, ", "))
+}
+
+// parseLicenseAllowlist parses a comma-separated list of SPDX license IDs (eg. "MIT,Apache-2.0"),
+// matching each license ID case-insensitively & returning them in their canonical SPDX form
+func parseLicenseAllowlist(str string) ([]string, error) {
+	var allowlist []string
+	for _, id := range strings.Split(str, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		canonicalID := ""
+		for _, spdxID := range spdxLicenseIDs {
+			if strings.EqualFold(id, spdxID) {
+				canonicalID = spdxID
+				break
+			}
+		}
+		if canonicalID == "" {
+			return nil, &invalidLicenseIDError{id: id, suggestions: suggestLicenseIDs(id)}
+		}
+		allowlist = append(allowlist, canonicalID)
+	}
+	if len(allowlist) == 0 {
+		return nil, fmt.Errorf("license allowlist is empty")
+	}
+
+	return allowlist, nil
+}
+
+// licenseStatus returns the badge status & color of the detected license, an empty license represents a license
+// that GitHub failed to detect
+func licenseStatus(license string) (string, string) {
+	if license == "" {
+		return "not specified", "lightgrey"
+	}
+	return license, "blue"
+}
+
+// checkLicense returns the badge status & color of the detected SPDX license ID against the allowlist,
+// an empty or "NOASSERTION" license ID represents a license that GitHub failed to detect
+func checkLicense(spdxID string, allowlist []string) (string, string) {
+	if spdxID == "" || spdxID == "NOASSERTION" {
+		return "unknown", "lightgrey"
+	}
+	for _, allowedID := range allowlist {
+		if strings.EqualFold(spdxID, allowedID) {
+			return "compliant", "green"
+		}
+	}
+	return "review", "red"
+}
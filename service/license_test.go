@@ -0,0 +1,88 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLicenseAllowlist(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"Single", "MIT", []string{"MIT"}},
+		{"Multiple", "MIT,Apache-2.0,BSD-3-Clause", []string{"MIT", "Apache-2.0", "BSD-3-Clause"}},
+		{"CaseInsensitive", "mit,apache-2.0,unlicense", []string{"MIT", "Apache-2.0", "Unlicense"}},
+		{"WithWhitespace", " MIT , Apache-2.0 ,", []string{"MIT", "Apache-2.0"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			allowlist, err := parseLicenseAllowlist(testCase.input)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, allowlist)
+		})
+	}
+}
+
+func TestParseLicenseAllowlistWithInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Empty", "", "license allowlist is empty"},
+		{"OnlySeparators", ",,", "license allowlist is empty"},
+		{"SimilarForm", "MIT,apache2", `license "apache2" is not a SPDX license ID, valid forms: Apache-2.0`},
+		{"AmbiguousForm", "gpl", `license "gpl" is not a SPDX license ID, valid forms: GPL-2.0, GPL-3.0`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			allowlist, err := parseLicenseAllowlist(testCase.input)
+			assert.Nil(t, allowlist)
+			assert.EqualError(t, err, testCase.expected)
+		})
+	}
+}
+
+func TestSuggestLicenseIDs(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"BSD-3-Clause", "BSD-3-Clause-Clear"}, suggestLicenseIDs("bsd3"))
+	assert.Equal(t, []string{"LGPL-2.1"}, suggestLicenseIDs("LGPL 2.1"))
+	assert.Equal(t, spdxLicenseIDs, suggestLicenseIDs("proprietary"))
+	assert.Equal(t, spdxLicenseIDs, suggestLicenseIDs("--"))
+}
+
+func TestCheckLicense(t *testing.T) {
+	t.Parallel()
+
+	allowlist := []string{"MIT", "Apache-2.0"}
+	testCases := []struct {
+		name           string
+		spdxID         string
+		expectedStatus string
+		expectedColor  string
+	}{
+		{"Allowed", "Apache-2.0", "compliant", "green"},
+		{"AllowedWithDifferentCase", "mit", "compliant", "green"},
+		{"NotAllowed", "GPL-3.0", "review", "red"},
+		{"Undetected", "", "unknown", "lightgrey"},
+		{"Unrecognized", "NOASSERTION", "unknown", "lightgrey"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			status, color := checkLicense(testCase.spdxID, allowlist)
+			assert.Equal(t, testCase.expectedStatus, status)
+			assert.Equal(t, testCase.expectedColor, color)
+		})
+	}
+}
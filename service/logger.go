@@ -1,33 +1,30 @@
 package service
 
 import (
-	"flag"
+	"fmt"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-)
-
-const (
-	logLevelCfg = "log-level"
-)
 
-var (
-	// Command line pointer to logger level flag configuration.
-	loggerLevelPtr *string
+	"github.com/tohjustin/aegis/service/config"
 )
 
-func loggerFlags(flags *flag.FlagSet) {
-	loggerLevelPtr = flags.String(logLevelCfg, "INFO",
-		"Output level of logs (DEBUG, INFO, WARN, ERROR, DPANIC, PANIC, FATAL)")
-}
-
-func newLogger() (*zap.Logger, error) {
+// newLogger returns a logger of the configured output level & format
+func newLogger(configuration *config.Config) (*zap.Logger, error) {
 	var level zapcore.Level
-	err := (&level).UnmarshalText([]byte(*loggerLevelPtr))
+	err := (&level).UnmarshalText([]byte(configuration.LogLevel))
 	if err != nil {
 		return nil, err
 	}
 	conf := zap.NewProductionConfig()
 	conf.Level.SetLevel(level)
+	switch configuration.LogFormat {
+	case "json":
+		conf.Encoding = "json"
+	case "text":
+		conf.Encoding = "console"
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", configuration.LogFormat)
+	}
 	return conf.Build()
 }
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pngSignature represents the first bytes of every PNG image
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// unsafeSVGElements represents the SVG elements able to run scripts or embed arbitrary markup
+var unsafeSVGElements = map[string]bool{
+	"foreignobject": true,
+	"script":        true,
+}
+
+// validateLogo returns an error describing why the logo set in the request query can't be embedded into badges, logos
+// must be base64-encoded SVG or PNG data URIs of at most maxSize bytes, whose SVG images can't run scripts
+func validateLogo(logo string, maxSize uint) error {
+	if uint(len(logo)) > maxSize {
+		return fmt.Errorf("larger than %d bytes", maxSize)
+	}
+	if !strings.HasPrefix(logo, "data:") {
+		return errors.New("not a data URI")
+	}
+	parts := strings.SplitN(strings.TrimPrefix(logo, "data:"), ",", 2)
+	if len(parts) != 2 || !strings.HasSuffix(parts[0], ";base64") {
+		return errors.New("not a base64 data URI")
+	}
+	data, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return errors.New("not a base64 data URI")
+	}
+
+	switch mediaType := strings.TrimSuffix(parts[0], ";base64"); mediaType {
+	case "image/png":
+		if !bytes.HasPrefix(data, pngSignature) {
+			return errors.New("invalid PNG image")
+		}
+	case "image/svg+xml":
+		if err := validateSVGLogo(data); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported media type %q", mediaType)
+	}
+
+	return nil
+}
+
+// validateSVGLogo returns an error for SVG images that aren't well-formed or that contain script-bearing content, ie.
+// script & foreignObject elements or event handler attributes
+func validateSVGLogo(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	hasRoot := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.New("invalid SVG image")
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !hasRoot && element.Name.Local != "svg" {
+			return errors.New("invalid SVG image")
+		}
+		hasRoot = true
+		if unsafeSVGElements[strings.ToLower(element.Name.Local)] {
+			return errors.New("unsafe SVG image")
+		}
+		for _, attr := range element.Attr {
+			if strings.HasPrefix(strings.ToLower(attr.Name.Local), "on") {
+				return errors.New("unsafe SVG image")
+			}
+		}
+	}
+	if !hasRoot {
+		return errors.New("invalid SVG image")
+	}
+
+	return nil
+}
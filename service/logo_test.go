@@ -0,0 +1,55 @@
+package service
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// svgDataURI returns the base64-encoded data URI of the SVG image
+func svgDataURI(svg string) string {
+	return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))
+}
+
+func TestValidateLogo(t *testing.T) {
+	t.Parallel()
+
+	pngLogo := "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+	svgLogo := svgDataURI(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1 1"><rect width="1" height="1"/></svg>`)
+
+	testCases := []struct {
+		name     string
+		logo     string
+		expected string
+	}{
+		{"PNG", pngLogo, ""},
+		{"SVG", svgLogo, ""},
+		{"SVGWithDeclaration", svgDataURI(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><path d="M0 0h1v1H0z"/></svg>`), ""},
+		{"Oversized", "data:image/png;base64," + strings.Repeat("A", 8192), "larger than 8192 bytes"},
+		{"URL", "https://example.com/logo.svg", "not a data URI"},
+		{"NotBase64", "data:image/svg+xml," + `<svg xmlns="http://www.w3.org/2000/svg"/>`, "not a base64 data URI"},
+		{"InvalidBase64", "data:image/png;base64,!!!", "not a base64 data URI"},
+		{"UnsupportedMediaType", "data:text/html;base64,PGgxPmhpPC9oMT4=", `unsupported media type "text/html"`},
+		{"InvalidPNG", "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("GIF89a")), "invalid PNG image"},
+		{"MalformedSVG", svgDataURI(`<svg xmlns="http://www.w3.org/2000/svg"><rect>`), "invalid SVG image"},
+		{"NotSVG", svgDataURI(`<html><body/></html>`), "invalid SVG image"},
+		{"EmptySVG", svgDataURI(``), "invalid SVG image"},
+		{"Script", svgDataURI(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), "unsafe SVG image"},
+		{"NestedScript", svgDataURI(`<svg xmlns="http://www.w3.org/2000/svg"><g><SCRIPT href="https://example.com/x.js"/></g></svg>`), "unsafe SVG image"},
+		{"ForeignObject", svgDataURI(`<svg xmlns="http://www.w3.org/2000/svg"><foreignObject><iframe/></foreignObject></svg>`), "unsafe SVG image"},
+		{"EventHandler", svgDataURI(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`), "unsafe SVG image"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := validateLogo(testCase.logo, 8192)
+			if testCase.expected == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Equal(t, testCase.expected, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsNamespace represents the namespace of every exposed metric
+const metricsNamespace = "aegis"
+
+var (
+	// metricsRegistry holds every exposed metric, separate from the global registry of the Prometheus client
+	metricsRegistry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests handled, by provider, request type & status code.",
+	}, []string{"provider", "request_type", "code"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of handling HTTP requests, by provider & request type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "request_type"})
+	requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of HTTP requests currently being handled.",
+	})
+	badgeRenderDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "badge_render_duration_seconds",
+		Help:      "Duration of rendering badges.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05},
+	})
+	upstreamRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Duration of upstream API calls, by provider.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+	upstreamErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_errors_total",
+		Help:      "Number of failed upstream API calls, by provider.",
+	}, []string{"provider"})
+	cacheLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_lookups_total",
+		Help:      "Number of cache lookups, by provider, cache & result (hit or miss).",
+	}, []string{"provider", "cache", "result"})
+	circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "circuit_breaker_state",
+		Help:      "State of the circuit breaker of upstream API calls, by provider (0: closed, 1: half-open, 2: open).",
+	}, []string{"provider"})
+	githubTokenRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_token_rate_limit_remaining",
+		Help:      "Remaining rate limit quota of each GitHub access token, by token position & rate limit resource.",
+	}, []string{"token", "resource"})
+	githubQuotaReservedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_quota_reserved_total",
+		Help:      "Number of GitHub API calls skipped as the rate limit quota shared among instances is down to its reserve, by token position.",
+	}, []string{"token"})
+	githubQuotaLedgerErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_quota_ledger_errors_total",
+		Help:      "Number of failed Redis commands of the shared GitHub rate limit quota, by operation (reserve or record).",
+	}, []string{"operation"})
+	upstreamPermitsInUse = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_permits_in_use",
+		Help:      "Number of concurrent upstream API calls in progress, out of the maximum of each provider, by provider.",
+	}, []string{"provider"})
+	upstreamRateLimitReset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_rate_limit_reset_timestamp_seconds",
+		Help:      "Unix time at which the last exhausted rate limit of upstream API calls resets, by provider & token position.",
+	}, []string{"provider", "token"})
+	resultCacheErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "result_cache_errors_total",
+		Help:      "Number of failed Redis commands of the result cache, by provider & operation (get, set or purge).",
+	}, []string{"provider", "operation"})
+	resultCacheDegraded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "result_cache_degraded",
+		Help:      "Whether results are cached in memory as Redis is unreachable, by provider (0: Redis, 1: in-memory).",
+	}, []string{"provider"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		requestsTotal,
+		requestDuration,
+		requestsInFlight,
+		badgeRenderDuration,
+		upstreamRequestDuration,
+		upstreamErrorsTotal,
+		cacheLookupsTotal,
+		circuitBreakerState,
+		githubTokenRemaining,
+		githubQuotaReservedTotal,
+		githubQuotaLedgerErrorsTotal,
+		upstreamPermitsInUse,
+		upstreamRateLimitReset,
+		resultCacheErrorsTotal,
+		resultCacheDegraded,
+	)
+}
+
+// newMetricsHandler returns a HTTP handler exposing every metric in the Prometheus text format
+func newMetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// requestTypeLabel returns the request type label of the requested provider method, unknown methods share a
+// single label to keep the number of label values bounded
+func requestTypeLabel(provider string, method string) string {
+	if method == "" {
+		return ""
+	}
+	for _, badge := range snippetProviders[provider].badges {
+		if method == badge {
+			return method
+		}
+	}
+	return "other"
+}
+
+// statusRecorder records the status code & the number of bytes written into the HTTP response
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	size       int
+}
+
+func (recorder *statusRecorder) WriteHeader(statusCode int) {
+	recorder.statusCode = statusCode
+	recorder.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (recorder *statusRecorder) Write(b []byte) (int, error) {
+	n, err := recorder.ResponseWriter.Write(b)
+	recorder.size += n
+	return n, err
+}
+
+// withMetrics records the number, duration & status codes of the HTTP requests handled by the provider
+func withMetrics(provider string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		requestType := requestTypeLabel(provider, mux.Vars(r)["method"])
+		requestDuration.WithLabelValues(provider, requestType).Observe(time.Since(start).Seconds())
+		requestsTotal.WithLabelValues(provider, requestType, strconv.Itoa(recorder.statusCode)).Inc()
+	})
+}
+
+// instrumentedTransport records the duration & errors of upstream API calls
+type instrumentedTransport struct {
+	provider string
+	base     http.RoundTripper
+}
+
+func (transport *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := transport.base.RoundTrip(req)
+	// calls skipped due to an exhausted rate limit never reached the upstream API
+	if isUpstreamRateLimited(err) {
+		return resp, err
+	}
+	upstreamRequestDuration.WithLabelValues(transport.provider).Observe(time.Since(start).Seconds())
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		upstreamErrorsTotal.WithLabelValues(transport.provider).Inc()
+	}
+
+	return resp, err
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	t.Parallel()
+
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/issues") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"star_count":42}`))
+	}))
+	defer fakeAPI.Close()
+
+	mockConfig := &config.Config{}
+	mockStaticService, err := NewStaticService(mockConfig, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockGitlabService, err := NewGitlabService(mockConfig, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockGitlabService.(*gitlabService).baseURL = fakeAPI.URL
+	app := &Application{
+		config:           mockConfig,
+		staticService:    &mockStaticService,
+		bitbucketService: &mockGitlabService,
+		giteaService:     &mockGitlabService,
+		githubService:    &mockGitlabService,
+		gitlabService:    &mockGitlabService,
+	}
+	handler := app.handler()
+
+	for _, path := range []string{
+		"/static?subject=testSubject&status=testStatus",
+		"/static?color=%23zzz",
+		"/gitlab/stars/gitlab-org/gitaly",
+		"/gitlab/issues/gitlab-org/gitaly",
+		"/gitlab/unknown-method/gitlab-org/gitaly",
+	} {
+		req, _ := http.NewRequest("GET", path, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	body := res.Body.String()
+	for _, expected := range []string{
+		`aegis_http_requests_total{code="200",provider="static",request_type=""}`,
+		`aegis_http_requests_total{code="400",provider="static",request_type=""}`,
+		`aegis_http_requests_total{code="200",provider="gitlab",request_type="stars"}`,
+		`aegis_http_requests_total{code="200",provider="gitlab",request_type="issues"}`,
+		`aegis_http_requests_total{code="200",provider="gitlab",request_type="other"}`,
+		`aegis_http_request_duration_seconds_count{provider="gitlab",request_type="stars"}`,
+		`aegis_http_requests_in_flight`,
+		`aegis_badge_render_duration_seconds_count`,
+		`aegis_upstream_request_duration_seconds_count{provider="gitlab"}`,
+		`aegis_upstream_errors_total{provider="gitlab"}`,
+		`aegis_cache_lookups_total{cache="project",provider="gitlab",result="miss"}`,
+		`aegis_cache_lookups_total{cache="stale",provider="gitlab",result="miss"}`,
+	} {
+		assert.Contains(t, body, expected)
+	}
+}
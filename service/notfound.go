@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// unknownBadgeStatus represents the status of the badge returned for unmatched routes
+const unknownBadgeStatus = "unknown badge"
+
+type notFoundResponse struct {
+	Error string `json:"error"`
+	Path  string `json:"path"`
+}
+
+// pathRedirect represents a path prefix redirected to another path prefix
+type pathRedirect struct {
+	from string
+	to   string
+}
+
+// newPathRedirects returns the path redirects of the configured redirect map, ordered by the longest path prefix
+// first so that more specific redirects take precedence
+func newPathRedirects(redirects map[string]string) []pathRedirect {
+	pathRedirects := make([]pathRedirect, 0, len(redirects))
+	for from, to := range redirects {
+		pathRedirects = append(pathRedirects, pathRedirect{from: strings.TrimSuffix(from, "/"), to: strings.TrimSuffix(to, "/")})
+	}
+	sort.Slice(pathRedirects, func(i, j int) bool {
+		if len(pathRedirects[i].from) != len(pathRedirects[j].from) {
+			return len(pathRedirects[i].from) > len(pathRedirects[j].from)
+		}
+		return pathRedirects[i].from < pathRedirects[j].from
+	})
+	return pathRedirects
+}
+
+// redirectPath returns the path with its prefix replaced by the first matching redirect, matching whole path
+// segments only
+func redirectPath(pathRedirects []pathRedirect, path string) (string, bool) {
+	for _, redirect := range pathRedirects {
+		if path == redirect.from || strings.HasPrefix(path, redirect.from+"/") {
+			if redirectedPath := redirect.to + strings.TrimPrefix(path, redirect.from); redirectedPath != "" {
+				return redirectedPath, true
+			}
+			return "/", true
+		}
+	}
+	return "", false
+}
+
+// newNotFoundHandler returns a HTTP handler for all unmatched routes, forwarding paths of the configured redirect map
+// with a 301 & returning an "unknown badge" badge (or JSON with `format=json`) otherwise
+func newNotFoundHandler(configuration *config.Config) http.Handler {
+	pathRedirects := newPathRedirects(configuration.Redirects)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path, ok := redirectPath(pathRedirects, r.URL.EscapedPath()); ok {
+			if r.URL.RawQuery != "" {
+				path += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, path, http.StatusMovedPermanently)
+			return
+		}
+
+		// Unmatched routes are likely to be fixed soon (eg. a typo or a route change), so only cache them briefly
+		if r.URL.Query().Get("format") == "json" {
+			body, err := json.Marshal(notFoundResponse{Error: unknownBadgeStatus, Path: r.URL.Path})
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			setCacheControlHeaders(w, configuration, configuration.MinCacheSeconds)
+			setErrorIDHeader(w)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(body)
+			return
+		}
+
+		generatedBadge, size, err := badge.CreateWithSize(&badge.Params{
+			Subject: "aegis",
+			Status:  unknownBadgeStatus,
+			Color:   "lightgrey",
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		setCacheControlHeaders(w, configuration, configuration.MinCacheSeconds)
+		setErrorIDHeader(w)
+		setBadgeHeaders(w, svgBadgeFormat, &formattedBadge{body: []byte(generatedBadge), size: &size})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(generatedBadge))
+	})
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestNotFoundApplication returns the application handler with the given redirect map
+func newTestNotFoundApplication(t *testing.T, redirects map[string]string) http.Handler {
+	mockConfig := &config.Config{CacheSeconds: 3600, MinCacheSeconds: 300, MaxCacheSeconds: 86400, Redirects: redirects}
+	mockStaticService, err := NewStaticService(mockConfig, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockGitProviderService, err := NewGitlabService(mockConfig, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &Application{
+		config:           mockConfig,
+		staticService:    &mockStaticService,
+		bitbucketService: &mockGitProviderService,
+		giteaService:     &mockGitProviderService,
+		githubService:    &mockGitProviderService,
+		gitlabService:    &mockGitProviderService,
+	}
+	return app.handler()
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	t.Parallel()
+
+	handler := newTestNotFoundApplication(t, nil)
+	for _, path := range []string{"/badge/github/stars/google/gopacket", "/github/stars/google", "/unknown"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		handler.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusNotFound, res.Code, path)
+		assert.Equal(t, "image/svg+xml;utf-8", res.Header().Get("Content-Type"), path)
+		assert.Equal(t, "public, max-age=300, s-maxage=300", res.Header().Get("Cache-Control"), path)
+		assert.Equal(t, createBadge(&badge.Params{
+			Subject: "aegis",
+			Status:  "unknown badge",
+			Color:   "lightgrey",
+		}), res.Body.String(), path)
+	}
+}
+
+func TestNotFoundHandlerWithJSONFormat(t *testing.T) {
+	t.Parallel()
+
+	handler := newTestNotFoundApplication(t, nil)
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/badge/github/stars/google/gopacket?format=json", nil)
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=300, s-maxage=300", res.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"error":"unknown badge","path":"/badge/github/stars/google/gopacket"}`, res.Body.String())
+}
+
+func TestNotFoundHandlerWithRedirects(t *testing.T) {
+	t.Parallel()
+
+	handler := newTestNotFoundApplication(t, map[string]string{
+		"/badge":          "/",
+		"/badge/gh":       "/github",
+		"/legacy/static/": "/static",
+	})
+	testCases := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"PathPrefix", "/badge/gitlab/stars/gitlab-org/gitaly", "/gitlab/stars/gitlab-org/gitaly"},
+		{"LongestPathPrefix", "/badge/gh/stars/google/gopacket", "/github/stars/google/gopacket"},
+		{"WithQuery", "/badge/gh/issues/google/gopacket?state=open&color=red", "/github/issues/google/gopacket?state=open&color=red"},
+		{"WithTrailingSlash", "/legacy/static?subject=foo&status=bar", "/static?subject=foo&status=bar"},
+		{"ExactPath", "/badge", "/"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.path, nil)
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusMovedPermanently, res.Code)
+			assert.Equal(t, testCase.expected, res.Header().Get("Location"))
+		})
+	}
+
+	// Paths only sharing a partial path segment with a redirect are not redirected
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/badges/gitlab/stars/gitlab-org/gitaly", nil)
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// npmRegistryBaseURL represents the base URL of the npm registry
+	npmRegistryBaseURL = "https://registry.npmjs.org"
+	// npmDownloadsAPIBaseURL represents the base URL of the npm download counts API
+	npmDownloadsAPIBaseURL = "https://api.npmjs.org/downloads"
+	// npmMaxDownloadsRangeDays represents the maximum number of days of a download count range, as the npm download
+	// counts API rejects ranges longer than 18 months
+	npmMaxDownloadsRangeDays = 540
+)
+
+var (
+	// errNpmPackageNotFound represents an npm package that doesn't exist
+	errNpmPackageNotFound = errors.New("npm package not found")
+	// npmDownloadsEpoch represents the first day of the download counts of the npm download counts API
+	npmDownloadsEpoch = time.Date(2015, time.January, 10, 0, 0, 0, 0, time.UTC)
+)
+
+// npmDownloadPeriods maps the periods of the request query to the periods of the npm download counts API & the
+// suffix of the badge status, the total download count spans every period since the epoch
+var npmDownloadPeriods = map[string]struct {
+	period string
+	suffix string
+}{
+	"weekly":  {"last-week", "/week"},
+	"monthly": {"last-month", "/month"},
+	"total":   {"", ""},
+}
+
+type npmService struct {
+	name             string
+	registryBaseURL  string
+	downloadsBaseURL string
+	config           *config.Config
+	logger           *zap.Logger
+	httpClient       *http.Client
+	staleValues      *staleValueCache
+	results          *resultCache
+	requests         singleflight.Group
+	now              func() time.Time
+}
+
+type npmDownloadsResponse struct {
+	Downloads int `json:"downloads"`
+}
+
+type npmManifestResponse struct {
+	// License is either an SPDX license expression, or an object of the legacy `license` format
+	License json.RawMessage `json:"license"`
+}
+
+// NewNpmService returns a HTTP handler for the npm badge service
+func NewNpmService(configuration *config.Config, logger *zap.Logger) (MetricService, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	results, err := newResultCache(configuration, logger, "npm")
+	if err != nil {
+		return nil, err
+	}
+	return &npmService{
+		name:             "npm",
+		registryBaseURL:  npmRegistryBaseURL,
+		downloadsBaseURL: npmDownloadsAPIBaseURL,
+		config:           configuration,
+		logger:           logger,
+		httpClient:       newUpstreamClient(configuration, logger, "npm", &rateLimitTransport{base: upstreamTransport(configuration), limiter: newRateLimiter("npm")}),
+		staleValues:      newStaleValueCache("npm", staleValueRetention, staleValueCacheSize),
+		results:          results,
+		now:              time.Now,
+	}, nil
+}
+
+func (service *npmService) fetch(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errNpmPackageNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getLatestVersion returns the version of the `latest` dist-tag of the package, or an empty string if the package has
+// no such dist-tag. Only the dist-tags are fetched, as the documents of packages with many versions exceed the size
+// limit of upstream responses.
+func (service *npmService) getLatestVersion(ctx context.Context, name string) (string, error) {
+	var distTags map[string]string
+	url := fmt.Sprintf("%s/-/package/%s/dist-tags", service.registryBaseURL, url.PathEscape(name))
+	if err := service.fetch(ctx, url, &distTags); err != nil {
+		return "", err
+	}
+	return distTags["latest"], nil
+}
+
+// getLicense returns the license of the latest version of the package, or an empty string if not specified
+func (service *npmService) getLicense(ctx context.Context, name string) (string, error) {
+	version, err := service.getLatestVersion(ctx, name)
+	if err != nil || version == "" {
+		return "", err
+	}
+
+	var manifest npmManifestResponse
+	url := fmt.Sprintf("%s/%s/%s", service.registryBaseURL, url.PathEscape(name), url.PathEscape(version))
+	if err := service.fetch(ctx, url, &manifest); err != nil {
+		return "", err
+	}
+
+	var license string
+	if err := json.Unmarshal(manifest.License, &license); err == nil {
+		return license, nil
+	}
+	var legacyLicense struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(manifest.License, &legacyLicense)
+	return legacyLicense.Type, nil
+}
+
+// getDownloadCount returns the download count of the package over the period of the npm download counts API (eg.
+// "last-week"), or since the epoch if no period is set
+func (service *npmService) getDownloadCount(ctx context.Context, name string, period string) (int, error) {
+	if period != "" {
+		return service.getRangeDownloadCount(ctx, name, period)
+	}
+
+	// Ranges are limited in length, so the total download count is summed across consecutive ranges
+	total := 0
+	today := service.now().UTC()
+	for start := npmDownloadsEpoch; !start.After(today); start = start.AddDate(0, 0, npmMaxDownloadsRangeDays) {
+		end := start.AddDate(0, 0, npmMaxDownloadsRangeDays-1)
+		if end.After(today) {
+			end = today
+		}
+		count, err := service.getRangeDownloadCount(ctx, name, start.Format("2006-01-02")+":"+end.Format("2006-01-02"))
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// getRangeDownloadCount returns the download count of the package over the period or date range
+func (service *npmService) getRangeDownloadCount(ctx context.Context, name string, period string) (int, error) {
+	// Scoped package names keep their slash (eg. "@babel/core"), as the npm download counts API doesn't decode it
+	var downloads npmDownloadsResponse
+	url := fmt.Sprintf("%s/point/%s/%s", service.downloadsBaseURL, period, strings.Replace(url.PathEscape(name), "%2F", "/", 1))
+	if err := service.fetch(ctx, url, &downloads); err != nil {
+		return 0, err
+	}
+	return downloads.Downloads, nil
+}
+
+// SupportedMetrics returns the metrics served by the service
+func (service *npmService) SupportedMetrics() []string {
+	return []string{"downloads", "license", "version"}
+}
+
+func (service *npmService) supportedQueryParams() map[string][]badgeQueryParam {
+	return map[string][]badgeQueryParam{
+		"downloads": {{"period", "Period of the download count (weekly, monthly or total), defaults to weekly", "monthly"}},
+	}
+}
+
+func (service *npmService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *npmService) fetchBadge(r *http.Request) (cachedResult, error) {
+	routeVariables := mux.Vars(r)
+	// Scoped package names are routed with an encoded slash (eg. "@babel%2Fcore")
+	name, _ := url.PathUnescape(routeVariables["package"])
+	method := routeVariables["method"]
+	ctx := upstreamContext(r)
+
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         fetchKey(r),
+		isFinal:     func(err error) bool { return err == errNpmPackageNotFound },
+	}
+	result, err := fetchResult(r, requestLogger(service.logger, r), fetch, func() (cachedResult, error) {
+		var result cachedResult
+		var err error
+		switch method {
+		case "downloads":
+			period := r.URL.Query().Get("period")
+			if period == "" {
+				period = "weekly"
+			}
+			downloadPeriod, ok := npmDownloadPeriods[period]
+			if !ok {
+				return result, invalidQueryParameterBadge("period")
+			}
+			result.Subject = "downloads"
+			result.Value, err = fetchShared(&service.requests, fetch.key, func() (int, error) {
+				return service.getDownloadCount(ctx, name, downloadPeriod.period)
+			})
+		case "license":
+			result.Subject = "license"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getLicense(ctx, name)
+			})
+			if err == nil {
+				result.Status, result.Color = licenseStatus(fetched.(string))
+			}
+		case "version":
+			result.Subject = "npm"
+			var fetched interface{}
+			fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+				return service.getLatestVersion(ctx, name)
+			})
+			if err == nil {
+				result.Status, result.Color = versionStatus(fetched.(string))
+			}
+		default:
+			return result, notFoundBadge
+		}
+		return result, err
+	})
+	if err == errNpmPackageNotFound {
+		return result, packageNotFoundBadge
+	}
+	return result, err
+}
+
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *npmService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	value, subject, status, color := result.Value, result.Subject, result.Status, result.Color
+
+	// Textual statuses are used as is, only numeric values are formatted & colored by value
+	isNumeric := status == ""
+	if isNumeric {
+		query := r.URL.Query()
+		// Download counts are humanized unless requested otherwise
+		if _, ok := query["humanize"]; !ok {
+			query.Set("humanize", "true")
+		}
+		period := query.Get("period")
+		if period == "" {
+			period = "weekly"
+		}
+		status = formatStatus(value, query) + npmDownloadPeriods[period].suffix
+	}
+
+	badgeParams := &badge.Params{Subject: subject, Status: status, Color: color}
+	if isNumeric {
+		if err := parseColorRangesQuery(badgeParams, value, r.URL.Query()); err != nil {
+			return nil, invalidQueryParameterBadge("colorRanges")
+		}
+	}
+	return badgeParams, nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestNpmService returns a router serving the npm badge service backed by a fake npm registry & download counts API
+func newTestNpmService(t *testing.T, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewNpmService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*npmService).registryBaseURL = fakeAPI.URL + "/registry"
+	service.(*npmService).downloadsBaseURL = fakeAPI.URL + "/downloads"
+	service.(*npmService).now = func() time.Time { return time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC) }
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/npm/{method}/{package}`, service)
+
+	return router, fakeAPI.Close
+}
+
+// fakeNpmAPI returns a handler responding with the canned responses of the escaped request paths
+func fakeNpmAPI(t *testing.T, responses map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			http.Error(w, `{"error":"Not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(response))
+	}
+}
+
+func TestNpmServiceWithVersion(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"Package", "/npm/version/express", &badge.Params{Subject: "npm", Status: "4.17.1", Color: "blue"}},
+		{"ScopedPackage", "/npm/version/@babel%2Fcore", &badge.Params{Subject: "npm", Status: "7.12.3", Color: "blue"}},
+		{"NoDistTags", "/npm/version/unpublished", &badge.Params{Subject: "npm", Status: "none", Color: "lightgrey"}},
+	}
+
+	router, cleanup := newTestNpmService(t, fakeNpmAPI(t, map[string]string{
+		"/registry/-/package/express/dist-tags":       `{"latest":"4.17.1","next":"5.0.0-alpha.8"}`,
+		"/registry/-/package/@babel%2Fcore/dist-tags": `{"latest":"7.12.3"}`,
+		"/registry/-/package/unpublished/dist-tags":   `{}`,
+	}))
+	defer cleanup()
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestNpmServiceWithLicense(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"Package", "/npm/license/express", &badge.Params{Subject: "license", Status: "MIT", Color: "blue"}},
+		{"ScopedPackage", "/npm/license/@babel%2Fcore", &badge.Params{Subject: "license", Status: "MIT", Color: "blue"}},
+		{"LegacyLicense", "/npm/license/legacy", &badge.Params{Subject: "license", Status: "BSD", Color: "blue"}},
+		{"NoDistTags", "/npm/license/unpublished", &badge.Params{Subject: "license", Status: "not specified", Color: "lightgrey"}},
+	}
+
+	router, cleanup := newTestNpmService(t, fakeNpmAPI(t, map[string]string{
+		"/registry/-/package/express/dist-tags":       `{"latest":"4.17.1"}`,
+		"/registry/express/4.17.1":                    `{"name":"express","version":"4.17.1","license":"MIT"}`,
+		"/registry/-/package/@babel%2Fcore/dist-tags": `{"latest":"7.12.3"}`,
+		"/registry/@babel%2Fcore/7.12.3":              `{"name":"@babel/core","version":"7.12.3","license":"MIT"}`,
+		"/registry/-/package/legacy/dist-tags":        `{"latest":"1.0.0"}`,
+		"/registry/legacy/1.0.0":                      `{"name":"legacy","version":"1.0.0","license":{"type":"BSD","url":"https://opensource.org/licenses/BSD"}}`,
+		"/registry/-/package/unpublished/dist-tags":   `{}`,
+	}))
+	defer cleanup()
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestNpmServiceWithDownloads(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"Weekly", "/npm/downloads/express", &badge.Params{Subject: "downloads", Status: "12.3M/week"}},
+		{"Monthly", "/npm/downloads/express?period=monthly", &badge.Params{Subject: "downloads", Status: "51.2M/month"}},
+		{"Total", "/npm/downloads/express?period=total", &badge.Params{Subject: "downloads", Status: "1.5k"}},
+		{"NotHumanized", "/npm/downloads/express?period=total&humanize=false", &badge.Params{Subject: "downloads", Status: "1.50k"}},
+		{"ScopedPackage", "/npm/downloads/@babel%2Fcore", &badge.Params{Subject: "downloads", Status: "9.9M/week"}},
+	}
+
+	router, cleanup := newTestNpmService(t, fakeNpmAPI(t, map[string]string{
+		"/downloads/point/last-week/express":             `{"downloads":12345678,"package":"express"}`,
+		"/downloads/point/last-month/express":            `{"downloads":51234567,"package":"express"}`,
+		"/downloads/point/2015-01-10:2016-07-02/express": `{"downloads":1000,"package":"express"}`,
+		"/downloads/point/2016-07-03:2017-01-01/express": `{"downloads":500,"package":"express"}`,
+		"/downloads/point/last-week/@babel/core":         `{"downloads":9876543,"package":"@babel/core"}`,
+	}))
+	defer cleanup()
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestNpmServiceWithTotalDownloadsRanges(t *testing.T) {
+	t.Parallel()
+
+	var paths []string
+	router, cleanup := newTestNpmService(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"downloads":1000}`))
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/npm/downloads/express?period=total&humanize=false", nil)
+	router.ServeHTTP(res, req)
+
+	// The total download count spans a range of the maximum length & a range ending on the current day
+	assert.Equal(t, createBadge(&badge.Params{Subject: "downloads", Status: "2.00k"}), res.Body.String())
+	assert.Equal(t, []string{
+		"/downloads/point/2015-01-10:2016-07-02/express",
+		"/downloads/point/2016-07-03:2017-01-01/express",
+	}, paths)
+}
+
+func TestNpmServiceWithNotFound(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestNpmService(t, fakeNpmAPI(t, map[string]string{}))
+	defer cleanup()
+
+	for _, url := range []string{"/npm/version/nothing", "/npm/license/nothing", "/npm/downloads/nothing"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusNotFound, res.Code)
+		assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "package not found"}), res.Body.String())
+	}
+}
+
+func TestNpmServiceWithUnsupportedPeriod(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestNpmService(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected npm API call: %s", r.URL)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/npm/downloads/express?period=daily", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
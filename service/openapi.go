@@ -0,0 +1,290 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/tohjustin/aegis/internal/version"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// openAPIVersion represents the version of the OpenAPI specification that the generated document conforms to
+const openAPIVersion = "3.0.3"
+
+// openAPIContentTypes represents the content types of the responses of the routes other than badge routes, by route
+// name (ie. the first path segment after any JSON API path prefix). Every other route responds with badges.
+var openAPIContentTypes = map[string][]string{
+	"":             {"application/json", "text/html"},
+	"healthz":      {"text/plain"},
+	"history":      {"application/json"},
+	"metrics":      {"text/plain"},
+	"openapi.json": {"application/json"},
+	"readyz":       {"text/plain"},
+	"snippet":      {"text/plain"},
+	"version":      {"application/json"},
+}
+
+// openAPIOperationIDPattern matches the words of the paths making up operation IDs
+var openAPIOperationIDPattern = regexp.MustCompile(`[A-Za-z0-9]+`)
+
+type openAPIDocument struct {
+	OpenAPI string                     `json:"openapi"`
+	Info    openAPIInfo                `json:"info"`
+	Paths   map[string]openAPIPathItem `json:"paths"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// openAPIPathItem represents the operations of a path, by lowercase HTTP method
+type openAPIPathItem map[string]*openAPIOperation
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string        `json:"name"`
+	In          string        `json:"in"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Schema      openAPISchema `json:"schema"`
+	Example     string        `json:"example,omitempty"`
+}
+
+type openAPISchema struct {
+	Type    string   `json:"type"`
+	Enum    []string `json:"enum,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct{}
+
+// routeName returns the name of the route, ie. the first path segment after any JSON API path prefix
+func routeName(pathTemplate string) string {
+	for _, prefix := range []string{apiPathPrefix, legacyAPIPathPrefix} {
+		if strings.HasPrefix(pathTemplate, prefix+"/") {
+			pathTemplate = strings.TrimPrefix(pathTemplate, prefix)
+			break
+		}
+	}
+	return strings.SplitN(strings.TrimPrefix(pathTemplate, "/"), "/", 2)[0]
+}
+
+// openAPIPath returns the OpenAPI path of the route path template, replacing route variables of a single literal
+// (eg. `{method:stars}`) with the literal & dropping the patterns of other route variables
+func openAPIPath(pathTemplate string) string {
+	return indexRouteVariablePattern.ReplaceAllStringFunc(pathTemplate, func(variable string) string {
+		submatches := indexRouteVariablePattern.FindStringSubmatch(variable)
+		name, pattern := submatches[1], submatches[2]
+		if indexRouteVariableAlternativesPattern.MatchString(pattern) && !strings.Contains(pattern, "|") {
+			return pattern
+		}
+		return "{" + name + "}"
+	})
+}
+
+// openAPIOperationID returns the ID of the operation of the HTTP method on the OpenAPI path, eg. `getGithubMethodOwnerRepo`
+func openAPIOperationID(method string, path string) string {
+	operationID := strings.ToLower(method)
+	words := openAPIOperationIDPattern.FindAllString(path, -1)
+	if len(words) == 0 {
+		words = []string{"index"}
+	}
+	for _, word := range words {
+		operationID += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return operationID
+}
+
+// routeMetrics returns the metrics served by the route path template, either fixed by the pattern of the `method`
+// route variable or any metric of the provider
+func routeMetrics(pathTemplate string, metrics []string) []string {
+	for _, submatches := range indexRouteVariablePattern.FindAllStringSubmatch(pathTemplate, -1) {
+		if submatches[1] == "method" && indexRouteVariableAlternativesPattern.MatchString(submatches[2]) {
+			return strings.Split(submatches[2], "|")
+		}
+	}
+	return metrics
+}
+
+// openAPIPathParameters returns the path parameters of the route path template, restricting the `method` route
+// variable to the metrics of the provider
+func openAPIPathParameters(pathTemplate string, metrics []string) []openAPIParameter {
+	var parameters []openAPIParameter
+	for _, submatches := range indexRouteVariablePattern.FindAllStringSubmatch(pathTemplate, -1) {
+		name, pattern := submatches[1], submatches[2]
+		schema := openAPISchema{Type: "string"}
+		switch {
+		case indexRouteVariableAlternativesPattern.MatchString(pattern):
+			if !strings.Contains(pattern, "|") {
+				continue
+			}
+			schema.Enum = strings.Split(pattern, "|")
+		case pattern != "":
+			schema.Pattern = "^(?:" + pattern + ")$"
+		case name == "method" && len(metrics) > 0:
+			schema.Enum = metrics
+		}
+		parameters = append(parameters, openAPIParameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+			Example:  exampleRoutePath(submatches[0], metrics),
+		})
+	}
+	return parameters
+}
+
+// openAPIQueryParameters returns the query parameters of a badge route serving the metrics, with the query parameters
+// specific to some metrics merged by name
+func openAPIQueryParameters(metrics []string, metricQueryParams map[string][]badgeQueryParam) []openAPIParameter {
+	parameters := make([]openAPIParameter, 0, len(badgeQueryParams))
+	for _, param := range badgeQueryParams {
+		parameters = append(parameters, openAPIParameter{Name: param.Name, In: "query", Description: param.Description, Schema: openAPISchema{Type: "string"}, Example: param.Example})
+	}
+
+	served := map[string]bool{"": true}
+	for _, metric := range metrics {
+		served[metric] = true
+	}
+	paramMetrics := make([]string, 0, len(metricQueryParams))
+	for metric := range metricQueryParams {
+		if served[metric] {
+			paramMetrics = append(paramMetrics, metric)
+		}
+	}
+	sort.Strings(paramMetrics)
+
+	// metrics sharing the same query parameter are listed together, as long as its description is the same
+	indexes := map[string]int{}
+	var names []string
+	descriptions := map[string][]string{}
+	descriptionMetrics := map[string]map[string][]string{}
+	for _, metric := range paramMetrics {
+		for _, param := range metricQueryParams[metric] {
+			if _, ok := indexes[param.Name]; !ok {
+				indexes[param.Name] = len(parameters)
+				names = append(names, param.Name)
+				descriptionMetrics[param.Name] = map[string][]string{}
+				parameters = append(parameters, openAPIParameter{Name: param.Name, In: "query", Schema: openAPISchema{Type: "string"}, Example: param.Example})
+			}
+			if _, ok := descriptionMetrics[param.Name][param.Description]; !ok {
+				descriptions[param.Name] = append(descriptions[param.Name], param.Description)
+			}
+			if metric != "" {
+				descriptionMetrics[param.Name][param.Description] = append(descriptionMetrics[param.Name][param.Description], "`"+metric+"`")
+			} else {
+				descriptionMetrics[param.Name][param.Description] = nil
+			}
+		}
+	}
+	for _, name := range names {
+		var parts []string
+		for _, description := range descriptions[name] {
+			if metricsOfDescription := descriptionMetrics[name][description]; len(metricsOfDescription) > 0 && len(metrics) > 1 {
+				description = strings.Join(metricsOfDescription, ", ") + " only: " + description
+			}
+			parts = append(parts, description)
+		}
+		parameters[indexes[name]].Description = strings.Join(parts, "; ")
+	}
+	return parameters
+}
+
+// newOpenAPIDocument returns the OpenAPI document of the routes described by the index, so that routes & metrics
+// of new providers are documented as soon as they are registered
+func newOpenAPIDocument(response *indexResponse) *openAPIDocument {
+	document := &openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: openAPIInfo{
+			Title:       "Aegis",
+			Description: "SVG badge generation service",
+			Version:     version.Get().Version,
+		},
+		Paths: map[string]openAPIPathItem{},
+	}
+	addRoute := func(route indexRoute, operation openAPIOperation) {
+		path := openAPIPath(route.Path)
+		if document.Paths[path] == nil {
+			document.Paths[path] = openAPIPathItem{}
+		}
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			methodOperation := operation
+			methodOperation.OperationID = openAPIOperationID(method, path)
+			document.Paths[path][strings.ToLower(method)] = &methodOperation
+		}
+	}
+	badgeResponses := map[string]openAPIResponse{
+		"200":     {Description: "Badge", Content: map[string]openAPIMediaType{"image/svg+xml": {}}},
+		"default": {Description: "Error badge, or error details for invalid query parameters", Content: map[string]openAPIMediaType{"image/svg+xml": {}, "application/json": {}}},
+	}
+
+	for _, provider := range response.Providers {
+		for _, route := range provider.Routes {
+			parameters := openAPIPathParameters(route.Path, provider.Metrics)
+			metrics := routeMetrics(route.Path, provider.Metrics)
+			parameters = append(parameters, openAPIQueryParameters(metrics, provider.QueryParameters)...)
+			addRoute(route, openAPIOperation{Tags: []string{provider.Name}, Parameters: parameters, Responses: badgeResponses})
+		}
+	}
+	for _, route := range response.Routes {
+		parameters := openAPIPathParameters(route.Path, nil)
+		contentTypes, ok := openAPIContentTypes[routeName(route.Path)]
+		if !ok {
+			parameters = append(parameters, openAPIQueryParameters(nil, nil)...)
+			addRoute(route, openAPIOperation{Parameters: parameters, Responses: badgeResponses})
+			continue
+		}
+
+		content := map[string]openAPIMediaType{}
+		for _, contentType := range contentTypes {
+			content[contentType] = openAPIMediaType{}
+		}
+		addRoute(route, openAPIOperation{Parameters: parameters, Responses: map[string]openAPIResponse{
+			"200": {Description: "Successful response", Content: content},
+		}})
+	}
+	return document
+}
+
+// newOpenAPIHandler returns a HTTP handler serving the OpenAPI document of the routes registered on the router
+func newOpenAPIHandler(configuration *config.Config, router *mux.Router, metricServices map[string]MetricService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, err := newIndexResponse(router, metricServices)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		body, err := json.Marshal(newOpenAPIDocument(response))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		setCacheControlHeaders(w, configuration, configuration.MinCacheSeconds)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
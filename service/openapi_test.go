@@ -0,0 +1,248 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	openAPIVersionPattern      = regexp.MustCompile(`^3\.0\.\d+$`)
+	openAPIResponseCodePattern = regexp.MustCompile(`^(default|[1-5](\d\d|XX))$`)
+	openAPIPathVariablePattern = regexp.MustCompile(`\{([^}]+)\}`)
+)
+
+// openAPIObjectFields represents the fields allowed in the objects of OpenAPI 3.0 documents (ignoring `x-` extensions)
+var openAPIObjectFields = map[string][]string{
+	"document":  {"openapi", "info", "servers", "paths", "components", "security", "tags", "externalDocs"},
+	"info":      {"title", "description", "termsOfService", "contact", "license", "version"},
+	"pathItem":  {"$ref", "summary", "description", "get", "put", "post", "delete", "options", "head", "patch", "trace", "servers", "parameters"},
+	"operation": {"tags", "summary", "description", "externalDocs", "operationId", "parameters", "requestBody", "responses", "callbacks", "deprecated", "security", "servers"},
+	"parameter": {"name", "in", "description", "required", "deprecated", "allowEmptyValue", "style", "explode", "allowReserved", "schema", "example", "examples", "content"},
+	"schema":    {"type", "enum", "pattern", "format", "minLength", "maxLength", "minimum", "maximum", "default", "description", "items"},
+	"response":  {"description", "headers", "content", "links"},
+	"mediaType": {"schema", "example", "examples", "encoding"},
+}
+
+// openAPIHTTPMethods represents the fields of path item objects describing operations
+var openAPIHTTPMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// validateOpenAPIObjectFields asserts that the object only has fields allowed in the kind of OpenAPI objects & has
+// all the required fields
+func validateOpenAPIObjectFields(t *testing.T, kind string, location string, object map[string]interface{}, required ...string) {
+	for field := range object {
+		if !strings.HasPrefix(field, "x-") {
+			assert.Contains(t, openAPIObjectFields[kind], field, "%s: unknown %s field", location, kind)
+		}
+	}
+	for _, field := range required {
+		assert.Contains(t, object, field, "%s: missing %s field", location, kind)
+	}
+}
+
+// validateOpenAPIDocument asserts that the decoded JSON document is valid against the OpenAPI 3.0 schema, covering
+// the objects generated by newOpenAPIDocument
+func validateOpenAPIDocument(t *testing.T, document map[string]interface{}) {
+	validateOpenAPIObjectFields(t, "document", "#", document, "openapi", "info", "paths")
+	assert.Regexp(t, openAPIVersionPattern, document["openapi"])
+
+	info, _ := document["info"].(map[string]interface{})
+	validateOpenAPIObjectFields(t, "info", "#/info", info, "title", "version")
+	assert.IsType(t, "", info["title"])
+	assert.IsType(t, "", info["version"])
+
+	paths, _ := document["paths"].(map[string]interface{})
+	operationIDs := map[string]bool{}
+	for path, value := range paths {
+		assert.True(t, strings.HasPrefix(path, "/"), "%s: paths must start with a slash", path)
+		pathItem, _ := value.(map[string]interface{})
+		validateOpenAPIObjectFields(t, "pathItem", path, pathItem)
+
+		var pathVariables []string
+		for _, submatches := range openAPIPathVariablePattern.FindAllStringSubmatch(path, -1) {
+			pathVariables = append(pathVariables, submatches[1])
+		}
+		for _, method := range openAPIHTTPMethods {
+			operation, ok := pathItem[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			location := path + " " + method
+			validateOpenAPIObjectFields(t, "operation", location, operation, "responses")
+
+			operationID, _ := operation["operationId"].(string)
+			assert.NotEmpty(t, operationID, "%s: missing operation ID", location)
+			assert.False(t, operationIDs[operationID], "%s: duplicate operation ID %s", location, operationID)
+			operationIDs[operationID] = true
+
+			parameters, _ := operation["parameters"].([]interface{})
+			declared := map[string]bool{}
+			var pathParameters []string
+			for _, value := range parameters {
+				parameter, _ := value.(map[string]interface{})
+				validateOpenAPIObjectFields(t, "parameter", location, parameter, "name", "in")
+				name, _ := parameter["name"].(string)
+				in, _ := parameter["in"].(string)
+				assert.Contains(t, []string{"query", "header", "path", "cookie"}, in, "%s: invalid parameter location", location)
+				assert.False(t, declared[in+" "+name], "%s: duplicate %s parameter %s", location, in, name)
+				declared[in+" "+name] = true
+				if in == "path" {
+					assert.Equal(t, true, parameter["required"], "%s: path parameter %s must be required", location, name)
+					pathParameters = append(pathParameters, name)
+				}
+
+				// parameters must have either a schema or a content
+				schema, ok := parameter["schema"].(map[string]interface{})
+				if assert.True(t, ok, "%s: missing schema of parameter %s", location, name) {
+					validateOpenAPIObjectFields(t, "schema", location, schema)
+					assert.Contains(t, []string{"string", "integer", "number", "boolean", "array", "object"}, schema["type"])
+					if pattern, ok := schema["pattern"].(string); ok {
+						_, err := regexp.Compile(pattern)
+						assert.NoError(t, err, "%s: invalid pattern of parameter %s", location, name)
+					}
+				}
+			}
+			assert.ElementsMatch(t, pathVariables, pathParameters, "%s: path parameters must match the path template", location)
+
+			responses, _ := operation["responses"].(map[string]interface{})
+			assert.NotEmpty(t, responses, "%s: missing responses", location)
+			for code, value := range responses {
+				assert.Regexp(t, openAPIResponseCodePattern, code, "%s: invalid response code", location)
+				response, _ := value.(map[string]interface{})
+				validateOpenAPIObjectFields(t, "response", location+" "+code, response, "description")
+				content, _ := response["content"].(map[string]interface{})
+				for mediaType, value := range content {
+					assert.NotContains(t, mediaType, ";", "%s: media types must not have parameters", location)
+					mediaTypeObject, _ := value.(map[string]interface{})
+					validateOpenAPIObjectFields(t, "mediaType", location+" "+code+" "+mediaType, mediaTypeObject)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		pathTemplate string
+		expected     string
+	}{
+		{"/healthz", "/healthz"},
+		{"/github/{method}/{owner}/{repo}", "/github/{method}/{owner}/{repo}"},
+		{"/github/{account:user}/{owner}/{method:followers|repos|sponsors}", "/github/user/{owner}/{method}"},
+		{"/github/{account:org}/{owner}/{method:stars}", "/github/org/{owner}/stars"},
+		{"/github/{method:milestone}/{owner}/{repo}/{number:[0-9]+}", "/github/milestone/{owner}/{repo}/{number}"},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, openAPIPath(testCase.pathTemplate), testCase.pathTemplate)
+	}
+}
+
+func TestOpenAPIQueryParameters(t *testing.T) {
+	t.Parallel()
+
+	metricQueryParams := map[string][]badgeQueryParam{
+		"":              {{"dim", "Dims the badge", "true"}},
+		"issues":        {{"state", "State of the issues", "open"}, {"label", "Label of the items", "bug"}},
+		"pull-requests": {{"state", "State of the pull requests", "open"}, {"label", "Label of the items", "bug"}},
+		"workflow":      {{"event", "Event of the workflow runs", "push"}},
+	}
+	parameters := map[string]openAPIParameter{}
+	for _, parameter := range openAPIQueryParameters([]string{"issues", "pull-requests", "stars"}, metricQueryParams) {
+		parameters[parameter.Name] = parameter
+	}
+
+	assert.Len(t, parameters, len(badgeQueryParams)+3)
+	assert.Equal(t, "Dims the badge", parameters["dim"].Description)
+	assert.Equal(t, "`issues` only: State of the issues; `pull-requests` only: State of the pull requests", parameters["state"].Description)
+	assert.Equal(t, "`issues`, `pull-requests` only: Label of the items", parameters["label"].Description)
+	assert.NotContains(t, parameters, "event")
+
+	single := openAPIQueryParameters([]string{"workflow"}, metricQueryParams)
+	assert.Equal(t, openAPIParameter{Name: "event", In: "query", Description: "Event of the workflow runs", Schema: openAPISchema{Type: "string"}, Example: "push"}, single[len(single)-1])
+}
+
+func TestOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	app := newTestIndexApplication(t, "")
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	app.handler().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(res.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	validateOpenAPIDocument(t, document)
+
+	// every route is documented, with every method it accepts
+	var spec openAPIDocument
+	if err := json.Unmarshal(res.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	routes := 0
+	err := app.router().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		pathTemplate, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		routes++
+		methods, _ := route.GetMethods()
+		path := openAPIPath(pathTemplate)
+		if assert.Contains(t, spec.Paths, path) {
+			for _, method := range methods {
+				assert.Contains(t, spec.Paths[path], strings.ToLower(method), path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, spec.Paths, routes)
+	assert.Contains(t, spec.Paths, "/openapi.json")
+	assert.Contains(t, spec.Paths, "/")
+
+	// every metric of the providers is documented
+	for name, service := range app.metricServices() {
+		path := "/" + name + "/{method}"
+		for specPath, pathItem := range spec.Paths {
+			if !strings.HasPrefix(specPath, path) {
+				continue
+			}
+			for _, parameter := range pathItem["get"].Parameters {
+				if parameter.Name == "method" {
+					assert.ElementsMatch(t, service.SupportedMetrics(), parameter.Schema.Enum, specPath)
+				}
+			}
+			assert.Equal(t, []string{name}, pathItem["get"].Tags, specPath)
+		}
+	}
+
+	github := spec.Paths["/github/{method}/{owner}/{repo}"]["get"]
+	if assert.NotNil(t, github) {
+		parameters := map[string]openAPIParameter{}
+		for _, parameter := range github.Parameters {
+			parameters[parameter.In+" "+parameter.Name] = parameter
+		}
+		for _, name := range []string{"style", "color", "subject", "status", "icon", "state", "branch", "dim_archived"} {
+			assert.Contains(t, parameters, "query "+name)
+		}
+		assert.Equal(t, openAPIParameter{Name: "owner", In: "path", Required: true, Schema: openAPISchema{Type: "string"}, Example: "tohjustin"}, parameters["path owner"])
+		assert.Contains(t, github.Responses["200"].Content, "image/svg+xml")
+	}
+	assert.Contains(t, spec.Paths["/version"]["get"].Responses["200"].Content, "application/json")
+	assert.Equal(t, "^(?:[0-9]+)$", spec.Paths["/github/milestone/{owner}/{repo}/{number}"]["get"].Parameters[2].Schema.Pattern)
+}
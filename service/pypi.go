@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// pypiBaseURL represents the base URL of the PyPI JSON API
+const pypiBaseURL = "https://pypi.org/pypi"
+
+var (
+	// errPypiPackageNotFound represents a PyPI package that doesn't exist
+	errPypiPackageNotFound = errors.New("pypi package not found")
+	// pypiNameSeparators represents the runs of characters normalized into a single hyphen by PEP 503
+	pypiNameSeparators = regexp.MustCompile(`[-_.]+`)
+)
+
+type pypiService struct {
+	name        string
+	baseURL     string
+	config      *config.Config
+	logger      *zap.Logger
+	httpClient  *http.Client
+	staleValues *staleValueCache
+	results     *resultCache
+	requests    singleflight.Group
+}
+
+type pypiPackageResponse struct {
+	Info struct {
+		Classifiers       []string `json:"classifiers"`
+		License           string   `json:"license"`
+		LicenseExpression string   `json:"license_expression"`
+		RequiresPython    string   `json:"requires_python"`
+		Version           string   `json:"version"`
+	} `json:"info"`
+}
+
+// NewPypiService returns a HTTP handler for the PyPI badge service
+func NewPypiService(configuration *config.Config, logger *zap.Logger) (MetricService, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	results, err := newResultCache(configuration, logger, "pypi")
+	if err != nil {
+		return nil, err
+	}
+	return &pypiService{
+		name:        "pypi",
+		baseURL:     pypiBaseURL,
+		config:      configuration,
+		logger:      logger,
+		httpClient:  newUpstreamClient(configuration, logger, "pypi", &rateLimitTransport{base: upstreamTransport(configuration), limiter: newRateLimiter("pypi")}),
+		staleValues: newStaleValueCache("pypi", staleValueRetention, staleValueCacheSize),
+		results:     results,
+	}, nil
+}
+
+// normalizePypiName returns the normalized name of a package as defined by PEP 503 (eg. "Flask_SQLAlchemy" =>
+// "flask-sqlalchemy")
+func normalizePypiName(name string) string {
+	return pypiNameSeparators.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// pypiLicense returns the license of the package metadata, falling back on its license classifiers when the license
+// field is missing or holds the full license text
+func pypiLicense(pkg *pypiPackageResponse) string {
+	if pkg.Info.LicenseExpression != "" {
+		return pkg.Info.LicenseExpression
+	}
+	if license := strings.TrimSpace(pkg.Info.License); license != "" && !strings.Contains(license, "\n") {
+		return license
+	}
+	for _, classifier := range pkg.Info.Classifiers {
+		if strings.HasPrefix(classifier, "License :: ") {
+			segments := strings.Split(classifier, " :: ")
+			return segments[len(segments)-1]
+		}
+	}
+	return ""
+}
+
+// pythonStatus returns the badge status & color of the supported Python versions of a package (eg. ">= 3.9, <4" =>
+// ">=3.9,<4")
+func pythonStatus(requiresPython string) (string, string) {
+	if requiresPython == "" {
+		return "not specified", "lightgrey"
+	}
+	return strings.Join(strings.Fields(requiresPython), ""), "blue"
+}
+
+func (service *pypiService) getPackage(ctx context.Context, name string) (*pypiPackageResponse, error) {
+	url := fmt.Sprintf("%s/%s/json", service.baseURL, url.PathEscape(normalizePypiName(name)))
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errPypiPackageNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+
+	var pkg pypiPackageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pkg); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+// SupportedMetrics returns the metrics served by the service
+func (service *pypiService) SupportedMetrics() []string {
+	return []string{"license", "python", "version"}
+}
+
+func (service *pypiService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *pypiService) fetchBadge(r *http.Request) (cachedResult, error) {
+	routeVariables := mux.Vars(r)
+	name, _ := url.PathUnescape(routeVariables["package"])
+	method := routeVariables["method"]
+	ctx := upstreamContext(r)
+
+	var subject string
+	switch method {
+	case "license":
+		subject = "license"
+	case "python":
+		subject = "python"
+	case "version":
+		subject = "pypi"
+	default:
+		return cachedResult{}, notFoundBadge
+	}
+
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         fetchKey(r),
+		isFinal:     func(err error) bool { return err == errPypiPackageNotFound },
+	}
+	result, err := fetchResult(r, requestLogger(service.logger, r), fetch, func() (cachedResult, error) {
+		var result cachedResult
+		var err error
+		var fetched interface{}
+		fetched, err, _ = service.requests.Do(fetch.key, func() (interface{}, error) {
+			return service.getPackage(ctx, name)
+		})
+		if err == nil {
+			pkg := fetched.(*pypiPackageResponse)
+			switch method {
+			case "license":
+				result.Status, result.Color = licenseStatus(pypiLicense(pkg))
+			case "python":
+				result.Status, result.Color = pythonStatus(pkg.Info.RequiresPython)
+			case "version":
+				result.Status, result.Color = versionStatus(pkg.Info.Version)
+			}
+		}
+		return result, err
+	})
+
+	if err == errPypiPackageNotFound {
+		return result, packageNotFoundBadge
+	}
+	result.Subject = subject
+	return result, err
+}
+
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *pypiService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	return &badge.Params{Subject: result.Subject, Status: result.Status, Color: result.Color}, nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestPypiService returns a router serving the PyPI badge service backed by a fake PyPI JSON API
+func newTestPypiService(t *testing.T, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewPypiService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*pypiService).baseURL = fakeAPI.URL + "/pypi"
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/pypi/{method}/{package}`, service)
+
+	return router, fakeAPI.Close
+}
+
+// fakePypiAPI returns a handler responding with the canned package metadata of the request paths
+func fakePypiAPI(responses map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(response))
+	}
+}
+
+func TestNormalizePypiName(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"requests", "requests"},
+		{"Django", "django"},
+		{"Flask_SQLAlchemy", "flask-sqlalchemy"},
+		{"zope.interface", "zope-interface"},
+		{"Foo.-_Bar", "foo-bar"},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, normalizePypiName(testCase.name), testCase.name)
+	}
+}
+
+func TestPypiService(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *badge.Params
+	}{
+		{"Version", "/pypi/version/requests", &badge.Params{Subject: "pypi", Status: "2.25.0", Color: "blue"}},
+		{"Python", "/pypi/python/requests", &badge.Params{Subject: "python", Status: ">=2.7,!=3.0.*", Color: "blue"}},
+		{"License", "/pypi/license/requests", &badge.Params{Subject: "license", Status: "Apache 2.0", Color: "blue"}},
+		{"NormalizedName", "/pypi/version/Flask_SQLAlchemy", &badge.Params{Subject: "pypi", Status: "2.4.4", Color: "blue"}},
+		{"LicenseExpression", "/pypi/license/Flask_SQLAlchemy", &badge.Params{Subject: "license", Status: "BSD-3-Clause", Color: "blue"}},
+		{"LicenseClassifier", "/pypi/license/classified", &badge.Params{Subject: "license", Status: "MIT License", Color: "blue"}},
+		{"MissingVersion", "/pypi/version/bare", &badge.Params{Subject: "pypi", Status: "none", Color: "lightgrey"}},
+		{"MissingPython", "/pypi/python/bare", &badge.Params{Subject: "python", Status: "not specified", Color: "lightgrey"}},
+		{"MissingLicense", "/pypi/license/bare", &badge.Params{Subject: "license", Status: "not specified", Color: "lightgrey"}},
+	}
+
+	router, cleanup := newTestPypiService(t, fakePypiAPI(map[string]string{
+		"/pypi/requests/json":         `{"info":{"version":"2.25.0","requires_python":">=2.7, !=3.0.*","license":"Apache 2.0"}}`,
+		"/pypi/flask-sqlalchemy/json": `{"info":{"version":"2.4.4","license_expression":"BSD-3-Clause","license":"BSD"}}`,
+		"/pypi/classified/json":       `{"info":{"version":"1.0.0","license":"Permission is hereby granted...\n...","classifiers":["Development Status :: 5 - Production/Stable","License :: OSI Approved :: MIT License"]}}`,
+		"/pypi/bare/json":             `{"info":{"version":"","requires_python":null,"license":null}}`,
+	}))
+	defer cleanup()
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestPypiServiceWithNotFound(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestPypiService(t, fakePypiAPI(map[string]string{}))
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/pypi/version/nothing", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "package not found"}), res.Body.String())
+}
+
+func TestPypiServiceWithUnsupportedMethod(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestPypiService(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected PyPI API call: %s", r.URL)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/pypi/downloads/requests", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "not found"}), res.Body.String())
+}
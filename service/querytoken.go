@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+)
+
+// queryTokenParam represents the query parameter of the upstream API token of a single request
+const queryTokenParam = "token"
+
+type queryTokenContextKey struct{}
+
+// withQueryToken moves the upstream API token set in the request query into the request context, so that it never
+// gets into logs, cache keys or redirects
+func withQueryToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		token := query.Get(queryTokenParam)
+		if _, ok := query[queryTokenParam]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		query.Del(queryTokenParam)
+		r = r.WithContext(context.WithValue(r.Context(), queryTokenContextKey{}, token))
+		r.URL.RawQuery = query.Encode()
+		r.RequestURI = r.URL.RequestURI()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// queryTokenFromContext returns the upstream API token stored in the context, or an empty string if none
+func queryTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(queryTokenContextKey{}).(string)
+	return token
+}
+
+// queryTokenKeyPrefix returns the prefix of the keys of upstream API calls made with the token, so that they are
+// never shared with requests made without the same token
+func queryTokenKeyPrefix(token string) string {
+	if token == "" {
+		return ""
+	}
+	return fmt.Sprintf("token:%x/", sha256.Sum256([]byte(token)))
+}
+
+// privateResponseWriter prevents the response from being cached by browsers & CDNs, overriding any Cache-Control
+// header set by the handler
+type privateResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *privateResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *privateResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// quotaKeyPrefix represents the prefix of the keys of the rate limit quotas of GitHub access tokens stored in Redis
+	quotaKeyPrefix = "aegis:quota:github:"
+	// githubQuotaAllowance represents the number of calls allowed per allowance window for a rate limit quota that
+	// isn't known, ie. not recorded yet or reset since (shared among instances), or while Redis is unreachable (by
+	// instance)
+	githubQuotaAllowance = 10
+	// githubQuotaAllowanceWindow represents the window of the calls allowed for rate limit quotas that aren't known
+	githubQuotaAllowanceWindow = time.Minute
+)
+
+// errGithubQuotaReserved represents an upstream API call skipped while the rate limit quota of every GitHub access
+// token shared among instances is down to its reserve
+var errGithubQuotaReserved = fmt.Errorf("shared rate limit quota of every GitHub access token is down to its reserve: %w", errUpstreamRateLimited)
+
+// reserveQuotaScript takes one call off the remaining quota of the token, unless the remaining quota is down to the
+// reserve (`ARGV[1]`). Quotas that are unknown (ie. not recorded yet, or reset since) only allow a few calls
+// (`ARGV[2]`) per window in seconds (`ARGV[3]`), until the quota reported by one of them is recorded.
+var reserveQuotaScript = redis.NewScript(`
+local remaining = tonumber(redis.call("HGET", KEYS[1], "remaining"))
+if remaining == nil then
+	local allowed = redis.call("HINCRBY", KEYS[1], "allowed", 1)
+	if allowed == 1 then
+		redis.call("EXPIRE", KEYS[1], ARGV[3])
+	end
+	if allowed > tonumber(ARGV[2]) then
+		return 0
+	end
+	return 1
+end
+if remaining <= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("HINCRBY", KEYS[1], "remaining", -1)
+return 1
+`)
+
+// recordQuotaScript records the remaining quota (`ARGV[1]`) of the token until its reset time (`ARGV[2]`), as
+// reported by an upstream API call. Within the same rate limit window, the lowest remaining quota is kept, as the
+// reported quota doesn't account for the calls reserved by other instances meanwhile, & quotas reported for a past
+// rate limit window are ignored.
+var recordQuotaScript = redis.NewScript(`
+local remaining = tonumber(ARGV[1])
+local reset = tonumber(ARGV[2])
+local recordedReset = tonumber(redis.call("HGET", KEYS[1], "reset"))
+if recordedReset ~= nil and recordedReset > reset then
+	return 0
+end
+if recordedReset == reset then
+	local recorded = tonumber(redis.call("HGET", KEYS[1], "remaining"))
+	if recorded ~= nil and recorded < remaining then
+		remaining = recorded
+	end
+end
+redis.call("HSET", KEYS[1], "remaining", remaining, "reset", reset)
+redis.call("EXPIREAT", KEYS[1], reset)
+return 1
+`)
+
+// githubQuotaLedger shares the rate limit quotas of GitHub access tokens among instances using the same Redis server,
+// so that instances sharing tokens collectively keep within their rate limits. Instances take a call off the shared
+// remaining quota of a token for the rate limit resource called before each call & record the quota reported by the
+// GitHub API after it, leaving the token alone once its shared remaining quota is down to the reserve. The shared
+// quota is approximate but never higher than the last quota reported by the GitHub API, minus the calls made since.
+type githubQuotaLedger struct {
+	client  *redis.Client
+	reserve uint
+
+	mu sync.Mutex
+	// fallbackCalls counts the calls allowed by the instance while Redis is unreachable, by quota key, until the
+	// fallback window resets
+	fallbackCalls   map[string]int
+	fallbackResetAt time.Time
+	now             func() time.Time
+}
+
+// newGithubQuotaLedger returns the quota ledger of GitHub access tokens, or nil if no reserve is set as quotas aren't
+// shared then
+func newGithubQuotaLedger(configuration *config.Config) (*githubQuotaLedger, error) {
+	if configuration.GithubQuotaReserve == 0 || configuration.RedisURL == "" {
+		return nil, nil
+	}
+
+	client, err := newRedisClient(configuration)
+	if err != nil {
+		return nil, err
+	}
+	return &githubQuotaLedger{
+		client:        client,
+		reserve:       configuration.GithubQuotaReserve,
+		fallbackCalls: map[string]int{},
+		now:           time.Now,
+	}, nil
+}
+
+// quotaKey returns the key of the quota of the rate limit resource of the GitHub access token, shared by instances
+// regardless of the order of their tokens without the token ever being stored
+func quotaKey(token *githubToken, resource string) string {
+	sum := sha256.Sum256([]byte(token.value))
+	return quotaKeyPrefix + hex.EncodeToString(sum[:8]) + ":" + resource
+}
+
+// take takes one call off the shared remaining quota of the rate limit resource of the GitHub access token, returning
+// false if the quota is down to the reserve. While Redis is unreachable, the instance only allows a few calls per
+// window, as the calls of other instances are unknown. A nil quota ledger allows every call.
+func (ledger *githubQuotaLedger) take(ctx context.Context, token *githubToken, resource string) bool {
+	if ledger == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	key := quotaKey(token, resource)
+	allowed, err := reserveQuotaScript.Run(ctx, ledger.client, []string{key}, ledger.reserve, githubQuotaAllowance,
+		int(githubQuotaAllowanceWindow.Seconds())).Int()
+	if err != nil {
+		githubQuotaLedgerErrorsTotal.WithLabelValues("reserve").Inc()
+		allowed = ledger.takeFallback(key)
+	}
+	if allowed == 0 {
+		githubQuotaReservedTotal.WithLabelValues(token.label).Inc()
+		return false
+	}
+	return true
+}
+
+// takeFallback takes one call off the calls allowed by the instance within the fallback window, returning 0 once
+// they're all taken
+func (ledger *githubQuotaLedger) takeFallback(key string) int {
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+
+	if now := ledger.now(); !now.Before(ledger.fallbackResetAt) {
+		ledger.fallbackCalls = map[string]int{}
+		ledger.fallbackResetAt = now.Add(githubQuotaAllowanceWindow)
+	}
+	if ledger.fallbackCalls[key] >= githubQuotaAllowance {
+		return 0
+	}
+	ledger.fallbackCalls[key]++
+	return 1
+}
+
+// record keeps the rate limit quota of the resource of the GitHub access token reported by the
+// `X-RateLimit-Remaining` & `X-RateLimit-Reset` headers of the response
+func (ledger *githubQuotaLedger) record(ctx context.Context, token *githubToken, resource string, resp *http.Response) {
+	if ledger == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	if err := recordQuotaScript.Run(ctx, ledger.client, []string{quotaKey(token, resource)}, remaining, reset).Err(); err != nil {
+		githubQuotaLedgerErrorsTotal.WithLabelValues("record").Inc()
+	}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/shurcooL/githubv4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestGithubQuotaLedger returns a quota ledger of its own Redis client, as used by a separate instance
+func newTestGithubQuotaLedger(t *testing.T, server *miniredis.Miniredis, reserve uint) *githubQuotaLedger {
+	ledger, err := newGithubQuotaLedger(&config.Config{RedisURL: "redis://" + server.Addr(), GithubQuotaReserve: reserve})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ledger
+}
+
+// quotaResponse returns a response reporting the remaining rate limit quota until the reset time
+func quotaResponse(remaining int, resetAt time.Time) *http.Response {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+	return resp
+}
+
+func TestNewGithubQuotaLedgerWithoutReserve(t *testing.T) {
+	t.Parallel()
+
+	ledger, err := newGithubQuotaLedger(&config.Config{RedisURL: "redis://localhost:6379"})
+	assert.NoError(t, err)
+	assert.Nil(t, ledger)
+
+	// a nil quota ledger allows every call
+	token := &githubToken{label: "0", value: "token"}
+	assert.True(t, ledger.take(context.Background(), token, githubCoreResource))
+	ledger.record(context.Background(), token, githubCoreResource, quotaResponse(0, time.Now().Add(time.Hour)))
+}
+
+func TestGithubQuotaLedger(t *testing.T) {
+	t.Parallel()
+
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	ctx := context.Background()
+	token := &githubToken{label: "0", value: "token"}
+	resetAt := time.Now().Add(time.Hour)
+	first, second := newTestGithubQuotaLedger(t, server, 10), newTestGithubQuotaLedger(t, server, 10)
+
+	// calls are limited to the allowance, shared by the instances, until a quota is recorded
+	for i := 0; i < githubQuotaAllowance; i++ {
+		assert.True(t, first.take(ctx, token, githubCoreResource))
+	}
+	assert.False(t, second.take(ctx, token, githubCoreResource))
+
+	// quotas recorded by an instance are taken off by the others, down to the reserve
+	first.record(ctx, token, githubCoreResource, quotaResponse(12, resetAt))
+	assert.True(t, second.take(ctx, token, githubCoreResource))
+	assert.True(t, second.take(ctx, token, githubCoreResource))
+	assert.False(t, second.take(ctx, token, githubCoreResource))
+	assert.False(t, first.take(ctx, token, githubCoreResource))
+
+	// quotas reported before calls taken off by other instances never raise the shared quota
+	first.record(ctx, token, githubCoreResource, quotaResponse(50, resetAt))
+	assert.False(t, second.take(ctx, token, githubCoreResource))
+
+	// quotas of past rate limit windows are ignored, unlike quotas of the next rate limit window
+	first.record(ctx, token, githubCoreResource, quotaResponse(5000, resetAt.Add(-time.Hour)))
+	assert.False(t, second.take(ctx, token, githubCoreResource))
+	first.record(ctx, token, githubCoreResource, quotaResponse(5000, resetAt.Add(time.Hour)))
+	assert.True(t, second.take(ctx, token, githubCoreResource))
+
+	// quotas are shared by token & by rate limit resource, never stored as is
+	first.record(ctx, token, githubGraphQLResource, quotaResponse(10, resetAt))
+	assert.False(t, second.take(ctx, token, githubGraphQLResource))
+	assert.True(t, second.take(ctx, token, githubCoreResource))
+	assert.True(t, second.take(ctx, &githubToken{label: "0", value: "other"}, githubCoreResource))
+	for _, key := range server.Keys() {
+		assert.NotContains(t, key, "token")
+	}
+}
+
+func TestGithubQuotaLedgerWithUnreachableRedis(t *testing.T) {
+	t.Parallel()
+
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := newTestGithubQuotaLedger(t, server, 10)
+	server.Close()
+
+	now := time.Now()
+	ledger.now = func() time.Time { return now }
+	ctx := context.Background()
+	token := &githubToken{label: "0", value: "token"}
+
+	// instances only allow a few calls per window while Redis is unreachable
+	for i := 0; i < githubQuotaAllowance; i++ {
+		assert.True(t, ledger.take(ctx, token, githubCoreResource))
+	}
+	assert.False(t, ledger.take(ctx, token, githubCoreResource))
+	assert.True(t, ledger.take(ctx, token, githubGraphQLResource))
+
+	now = now.Add(githubQuotaAllowanceWindow)
+	assert.True(t, ledger.take(ctx, token, githubCoreResource))
+}
+
+func TestGithubQuotaLedgerWithConcurrentInstances(t *testing.T) {
+	t.Parallel()
+
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// the fake GitHub API counts down the rate limit quota of the token shared by the instances
+	const quota, reserve, instances, workers = 100, 20, 2, 4
+	var mu sync.Mutex
+	remaining, calls, exhausted := quota, 0, 0
+	resetAt := time.Now().Add(time.Hour)
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		calls++
+		if remaining == 0 {
+			exhausted++
+		} else {
+			remaining--
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	}))
+	defer fakeAPI.Close()
+
+	// every instance calls the API until the shared quota is down to the reserve
+	var wg sync.WaitGroup
+	errs := make(chan error, instances*workers)
+	for i := 0; i < instances; i++ {
+		client := &http.Client{Transport: &githubTokenTransport{
+			base:   http.DefaultTransport,
+			pool:   newGithubTokenPool([]string{"token"}, false),
+			ledger: newTestGithubQuotaLedger(t, server, reserve),
+		}}
+		for j := 0; j < workers; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					resp, err := client.Get(fakeAPI.URL)
+					if err != nil {
+						errs <- err
+						return
+					}
+					resp.Body.Close()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.True(t, errors.Is(err, errGithubQuotaReserved), err)
+	}
+	// calls made before the first quota is recorded are the only ones that may dig into the reserve
+	assert.Equal(t, 0, exhausted)
+	assert.GreaterOrEqual(t, calls, quota-reserve)
+	assert.LessOrEqual(t, calls, quota-reserve+instances*workers)
+}
+
+func TestGithubServiceWithSharedQuota(t *testing.T) {
+	t.Parallel()
+
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// the only API call brings the shared quota down to the reserve
+	var mu sync.Mutex
+	calls := 0
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.Header().Set("X-RateLimit-Remaining", "10")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		fakeGithubGraphQLAPI(`{"repository":{"stargazers":{"totalCount":1234}}}`)(w, r)
+	}))
+	defer fakeAPI.Close()
+
+	newInstance := func() *mux.Router {
+		configuration := &config.Config{RedisURL: "redis://" + server.Addr(), RedisCacheSeconds: 1, GithubAccessToken: "token", GithubQuotaReserve: 10}
+		service, err := NewGithubService(configuration, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger, err := newGithubQuotaLedger(configuration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpClient := &http.Client{Transport: &githubTokenTransport{base: http.DefaultTransport, pool: newGithubTokenPool([]string{"token"}, false), ledger: ledger}}
+		service.(*githubService).client = githubv4.NewEnterpriseClient(fakeAPI.URL, httpClient)
+
+		router := mux.NewRouter()
+		router.Handle(`/github/{method}/{owner}/{repo}`, service)
+		return router
+	}
+	first, second := newInstance(), newInstance()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/stars/google/gopacket", nil)
+	first.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "", res.Header().Get(staleHeader))
+	assert.Equal(t, createBadge(&badge.Params{Subject: "stars", Status: "1.23k"}), res.Body.String())
+
+	// once the shared results expire, instances serve stale data rather than digging into the reserve
+	server.FastForward(2 * time.Second)
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/github/stars/google/gopacket", nil)
+	first.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "true", res.Header().Get(staleHeader))
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/github/stars/google/gopacket", nil)
+	second.ServeHTTP(res, req)
+	assert.Contains(t, res.Body.String(), "rate limited")
+	assert.Equal(t, 1, calls)
+}
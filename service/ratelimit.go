@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errUpstreamRateLimited represents an upstream API call skipped until the rate limit of the upstream API resets
+var errUpstreamRateLimited = errors.New("upstream API rate limit is exhausted")
+
+// isUpstreamRateLimited returns whether the error is an upstream API call skipped due to an exhausted rate limit
+func isUpstreamRateLimited(err error) bool {
+	return errors.Is(err, errUpstreamRateLimited)
+}
+
+// rateLimitHeader returns the value of the first header set on the response among the header names
+func rateLimitHeader(resp *http.Response, names ...string) string {
+	for _, name := range names {
+		if value := resp.Header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// rateLimitReset returns the time at which the exhausted rate limit of the upstream API resets, as reported by
+// either the `X-RateLimit-*` headers (eg. GitHub) or the `RateLimit-*` headers (eg. GitLab) of the response. Returns
+// false if the rate limit isn't exhausted, or its reset time is unknown.
+func rateLimitReset(resp *http.Response, now time.Time) (time.Time, bool) {
+	remaining := rateLimitHeader(resp, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	if remaining != "0" && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+
+	reset, err := strconv.ParseInt(rateLimitHeader(resp, "X-RateLimit-Reset", "RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	resetAt := time.Unix(reset, 0)
+	if !resetAt.After(now) {
+		return time.Time{}, false
+	}
+	return resetAt, true
+}
+
+// rateLimiter skips upstream API calls of the provider while its rate limit is exhausted, instead of making calls
+// that are bound to fail until the rate limit resets
+type rateLimiter struct {
+	mu       sync.Mutex
+	provider string
+	resetAt  time.Time
+	now      func() time.Time
+}
+
+func newRateLimiter(provider string) *rateLimiter {
+	return &rateLimiter{provider: provider, now: time.Now}
+}
+
+// allow returns whether an upstream API call can be made
+func (limiter *rateLimiter) allow() bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	return !limiter.now().Before(limiter.resetAt)
+}
+
+// update records the exhausted rate limit reported by the response, returning whether the rate limit is exhausted
+func (limiter *rateLimiter) update(resp *http.Response) bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	resetAt, ok := rateLimitReset(resp, limiter.now())
+	if !ok {
+		return false
+	}
+	limiter.resetAt = resetAt
+	upstreamRateLimitReset.WithLabelValues(limiter.provider, "").Set(float64(resetAt.Unix()))
+	return true
+}
+
+// rateLimitTransport fails upstream API calls immediately while the rate limit of the upstream API is exhausted.
+// Calls made with the upstream API token of a request are left alone, as they are rate limited separately.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (transport *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if queryTokenFromContext(req.Context()) != "" {
+		return transport.base.RoundTrip(req)
+	}
+	if !transport.limiter.allow() {
+		return nil, errUpstreamRateLimited
+	}
+
+	resp, err := transport.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// calls rejected for an exhausted rate limit are reported the same way as the calls skipped after them
+	if transport.limiter.update(resp) && resp.StatusCode >= http.StatusBadRequest {
+		resp.Body.Close()
+		return nil, errUpstreamRateLimited
+	}
+	return resp, nil
+}
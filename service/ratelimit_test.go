@@ -0,0 +1,160 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// upstreamRateLimiter returns the rate limiter of the upstream API calls made through the transport
+func upstreamRateLimiter(t *testing.T, transport http.RoundTripper) *rateLimiter {
+	switch transport := transport.(type) {
+	case *limitedBodyTransport:
+		return upstreamRateLimiter(t, transport.base)
+	case *circuitBreakerTransport:
+		return upstreamRateLimiter(t, transport.base)
+	case *concurrencyLimitTransport:
+		return upstreamRateLimiter(t, transport.base)
+	case *retryTransport:
+		return upstreamRateLimiter(t, transport.base)
+	case *instrumentedTransport:
+		return upstreamRateLimiter(t, transport.base)
+	case *tracingTransport:
+		return upstreamRateLimiter(t, transport.base)
+	case *requestIDTransport:
+		return upstreamRateLimiter(t, transport.base)
+	case *rateLimitTransport:
+		return transport.limiter
+	}
+	t.Fatalf("no rate limiter found in %T", transport)
+	return nil
+}
+
+func TestRateLimitReset(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	reset := strconv.FormatInt(now.Add(time.Minute).Unix(), 10)
+	past := strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)
+
+	testCases := []struct {
+		name          string
+		statusCode    int
+		header        map[string]string
+		expectedReset bool
+	}{
+		{"GithubExhausted", http.StatusOK, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset}, true},
+		{"GithubRemaining", http.StatusOK, map[string]string{"X-RateLimit-Remaining": "42", "X-RateLimit-Reset": reset}, false},
+		{"GitlabTooManyRequests", http.StatusTooManyRequests, map[string]string{"RateLimit-Reset": reset}, true},
+		{"GitlabExhausted", http.StatusOK, map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": reset}, true},
+		{"TooManyRequestsWithoutReset", http.StatusTooManyRequests, map[string]string{"Retry-After": "60"}, false},
+		{"PastReset", http.StatusTooManyRequests, map[string]string{"RateLimit-Reset": past}, false},
+		{"NoHeaders", http.StatusOK, map[string]string{}, false},
+	}
+
+	for _, testCase := range testCases {
+		resp := &http.Response{StatusCode: testCase.statusCode, Header: http.Header{}}
+		for name, value := range testCase.header {
+			resp.Header.Set(name, value)
+		}
+
+		resetAt, ok := rateLimitReset(resp, now)
+		assert.Equal(t, testCase.expectedReset, ok, testCase.name)
+		if testCase.expectedReset {
+			assert.Equal(t, now.Add(time.Minute), resetAt.UTC(), testCase.name)
+		}
+	}
+}
+
+func TestGitlabServiceWithRateLimit(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+	var calls, rateLimited int32
+	atomic.StoreInt32(&rateLimited, 1)
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&rateLimited) == 1 {
+			w.Header().Set("RateLimit-Remaining", "0")
+			w.Header().Set("RateLimit-Reset", strconv.FormatInt(now.Add(time.Minute).Unix(), 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fakeGitlabIssuesAPI("42")(w, r)
+	}))
+	defer fakeAPI.Close()
+
+	service, err := NewGitlabService(&config.Config{UpstreamRetries: 2}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*gitlabService).baseURL = fakeAPI.URL
+	limiter := upstreamRateLimiter(t, service.(*gitlabService).httpClient.Transport)
+	var clock int64
+	limiter.now = func() time.Time { return now.Add(time.Duration(atomic.LoadInt64(&clock))) }
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/gitlab/{method}/{owner}/{repo}`, service)
+
+	serve := func() *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitlab-ce", nil)
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	// the rate limited call isn't retried, & no upstream API calls are made until the rate limit resets
+	for i := 0; i < 3; i++ {
+		res := serve()
+		assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "rate limited"}), res.Body.String())
+		assert.Equal(t, "public, max-age=0, s-maxage=0", res.Header().Get("Cache-Control"))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&rateLimited, 0)
+	atomic.StoreInt64(&clock, int64(time.Minute))
+	res := serve()
+	assert.Equal(t, createBadge(&badge.Params{Subject: "issues", Status: "42"}), res.Body.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestGithubServiceWithUnauthenticatedRateLimit(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var calls int32
+	pool := newGithubTokenPool(nil, true)
+	pool.now = func() time.Time { return now }
+	router, cleanup := newTestGithubServiceWithTokens(t, pool, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Minute).Unix(), 10))
+		fakeGithubGraphQLAPI(`{"repository":{"forks":{"totalCount":42}}}`)(w, r)
+	})
+	defer cleanup()
+
+	// the call exhausting the rate limit succeeds, later calls are skipped until the rate limit resets
+	expectedBodies := map[string]string{
+		"gopacket":  createBadge(&badge.Params{Subject: "forks", Status: "42"}),
+		"go-github": createBadge(&badge.Params{Subject: "aegis", Status: "rate limited"}),
+	}
+	for _, repo := range []string{"gopacket", "go-github"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/github/forks/google/"+repo, nil)
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, expectedBodies[repo], res.Body.String())
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// requestIDHeader represents the header identifying a request, both in responses & upstream API calls
+	requestIDHeader = "X-Request-ID"
+	// errorIDHeader represents the header referencing the request ID of a response with an error badge
+	errorIDHeader = "X-Badger-Error-ID"
+)
+
+// requestIDPattern matches request IDs accepted from clients, so that arbitrary texts never get into logs or headers
+var requestIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,128}$`)
+
+type requestIDContextKey struct{}
+
+// newRequestID returns a random (version 4) UUID
+func newRequestID() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return ""
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// withRequestID identifies every HTTP request with the request ID set by the client, or a generated one,
+// & sets it on the response
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, requestID)))
+	})
+}
+
+// setErrorIDHeader references the request ID set on the response in the error ID header, so that users can
+// reference error badges in reports
+func setErrorIDHeader(w http.ResponseWriter) {
+	if requestID := w.Header().Get(requestIDHeader); requestID != "" {
+		w.Header().Set(errorIDHeader, requestID)
+	}
+}
+
+// requestIDFromContext returns the request ID stored in the context, or an empty string if none
+func requestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// requestLogger returns the logger annotated with the ID of the request
+func requestLogger(logger *zap.Logger, r *http.Request) *zap.Logger {
+	if requestID := requestIDFromContext(r.Context()); requestID != "" {
+		return logger.With(zap.String("requestID", requestID))
+	}
+	return logger
+}
+
+// upstreamContext returns the context of the upstream API calls made for the request, carrying its request ID, its
+// trace context & its cancellation. Upstream API calls are shared among concurrent requests, so they are bounded by
+// the upstream timeout rather than cancelled along with the request, only waiting for too many concurrent upstream
+// API calls to drop is given up once the request is cancelled.
+func upstreamContext(r *http.Request) context.Context {
+	ctx := context.WithValue(context.Background(), requestIDContextKey{}, requestIDFromContext(r.Context()))
+	ctx = context.WithValue(ctx, requestDoneContextKey{}, r.Context().Done())
+	return contextWithTrace(ctx, r)
+}
+
+// requestIDTransport sets the request ID of the context on upstream API calls
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (transport *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestID := requestIDFromContext(req.Context())
+	if requestID == "" {
+		return transport.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	req.Header.Set(requestIDHeader, requestID)
+	return transport.base.RoundTrip(req)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewRequestID(t *testing.T) {
+	t.Parallel()
+
+	requestID := newRequestID()
+	assert.Regexp(t, uuidPattern, requestID)
+	assert.NotEqual(t, requestID, newRequestID())
+}
+
+func TestWithRequestID(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		requestID string
+		expected  string
+	}{
+		{"Generated", "", ""},
+		{"Passthrough", "abc-123.def:456_789", "abc-123.def:456_789"},
+		{"InvalidCharacters", "abc\n{\"level\":\"error\"}", ""},
+		{"TooLong", strings.Repeat("a", 129), ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var contextRequestID string
+			handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextRequestID = requestIDFromContext(r.Context())
+			}))
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			if testCase.requestID != "" {
+				req.Header.Set(requestIDHeader, testCase.requestID)
+			}
+			handler.ServeHTTP(res, req)
+
+			if testCase.expected == "" {
+				assert.Regexp(t, uuidPattern, contextRequestID)
+			} else {
+				assert.Equal(t, testCase.expected, contextRequestID)
+			}
+			assert.Equal(t, contextRequestID, res.Header().Get(requestIDHeader))
+		})
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+	var upstreamRequestID string
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRequestID = r.Header.Get(requestIDHeader)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fakeAPI.Close()
+
+	service, err := NewGitlabService(&config.Config{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*gitlabService).baseURL = fakeAPI.URL
+	router := mux.NewRouter()
+	router.Handle(`/gitlab/{method}/{owner}/{repo}`, service)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly", nil)
+	req.Header.Set(requestIDHeader, "report-1234")
+	withRequestID(router).ServeHTTP(res, req)
+
+	// upstream API call
+	assert.Equal(t, "report-1234", upstreamRequestID)
+
+	// error badge
+	assert.Equal(t, "report-1234", res.Header().Get(requestIDHeader))
+	assert.Equal(t, "report-1234", res.Header().Get(errorIDHeader))
+
+	// log lines
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.NotEmpty(t, lines)
+	for _, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "report-1234", entry["requestID"], line)
+	}
+}
+
+func TestRequestIDWithoutError(t *testing.T) {
+	t.Parallel()
+
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("badge"))
+	}))
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(res, req)
+
+	assert.NotEmpty(t, res.Header().Get(requestIDHeader))
+	assert.Empty(t, res.Header().Get(errorIDHeader))
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// clientIP returns the IP address of the client, taken from the `X-Forwarded-For` header only if the
+// application is behind a trusted proxy since the header can be set to anything by clients
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+			return strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withRequestLogging logs every HTTP request handled by the router as a structured log entry. Only the path of the
+// request is logged (not its query or headers besides the user agent), so that tokens never appear in logs.
+func withRequestLogging(logger *zap.Logger, trustProxy bool, router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		router.ServeHTTP(recorder, r)
+
+		fields := []zap.Field{
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+		}
+		var match mux.RouteMatch
+		if router.Match(r, &match) {
+			if provider, ok := match.Vars["provider"]; ok {
+				fields = append(fields, zap.String("provider", provider))
+			}
+			if owner, ok := match.Vars["owner"]; ok {
+				fields = append(fields, zap.String("owner", owner))
+			}
+			if repo, ok := match.Vars["repo"]; ok {
+				fields = append(fields, zap.String("repo", repo))
+			}
+			if method, ok := match.Vars["method"]; ok {
+				fields = append(fields, zap.String("requestType", method))
+			}
+		}
+		fields = append(fields,
+			zap.Int("status", recorder.statusCode),
+			zap.Duration("duration", time.Since(start)),
+			zap.Int("size", recorder.size),
+			zap.String("clientIP", clientIP(r, trustProxy)),
+			zap.String("userAgent", r.UserAgent()),
+			zap.String("requestID", requestIDFromContext(r.Context())))
+		logger.Info("Handled request", fields...)
+	})
+}
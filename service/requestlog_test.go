@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestLoggingApplication returns the application handler, logging JSON into the buffer
+func newTestLoggingApplication(t *testing.T, trustProxy bool, buf *bytes.Buffer) http.Handler {
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zap.InfoLevel))
+	mockConfig := &config.Config{CacheSeconds: 3600, MinCacheSeconds: 300, MaxCacheSeconds: 86400, TrustProxy: trustProxy}
+	mockStaticService, err := NewStaticService(mockConfig, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockGitProviderService := GitProviderService(&mockGitProviderService{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("badge"))
+		}),
+	})
+
+	app := &Application{
+		config:           mockConfig,
+		logger:           logger,
+		staticService:    &mockStaticService,
+		bitbucketService: &mockGitProviderService,
+		giteaService:     &mockGitProviderService,
+		githubService:    &mockGitProviderService,
+		gitlabService:    &mockGitProviderService,
+	}
+	return app.handler()
+}
+
+func TestRequestLogging(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	handler := newTestLoggingApplication(t, false, &buf)
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/github/stars/google/gopacket?access_token=secret-token", nil)
+	req.RemoteAddr = "192.0.2.1:54321"
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("User-Agent", "github-camo")
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	handler.ServeHTTP(res, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Handled request", entry["msg"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/github/stars/google/gopacket", entry["path"])
+	assert.Equal(t, "google", entry["owner"])
+	assert.Equal(t, "gopacket", entry["repo"])
+	assert.Equal(t, "stars", entry["requestType"])
+	assert.Equal(t, float64(http.StatusOK), entry["status"])
+	assert.Equal(t, float64(len("badge")), entry["size"])
+	assert.Contains(t, entry, "duration")
+	assert.Equal(t, "192.0.2.1", entry["clientIP"])
+	assert.Equal(t, "github-camo", entry["userAgent"])
+	assert.NotContains(t, buf.String(), "secret-token")
+}
+
+func TestRequestLoggingWithUnmatchedRoute(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	handler := newTestLoggingApplication(t, false, &buf)
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unknown", nil)
+	handler.ServeHTTP(res, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "/unknown", entry["path"])
+	assert.Equal(t, float64(http.StatusNotFound), entry["status"])
+	assert.Equal(t, float64(res.Body.Len()), entry["size"])
+	assert.NotContains(t, entry, "requestType")
+}
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  string
+		trustProxy    bool
+		expectedValue string
+	}{
+		{"RemoteAddr", "192.0.2.1:54321", "", false, "192.0.2.1"},
+		{"UntrustedProxy", "192.0.2.1:54321", "198.51.100.7", false, "192.0.2.1"},
+		{"TrustedProxy", "192.0.2.1:54321", "198.51.100.7, 203.0.113.9", true, "198.51.100.7"},
+		{"TrustedProxyWithoutHeader", "192.0.2.1:54321", "", true, "192.0.2.1"},
+		{"RemoteAddrWithoutPort", "192.0.2.1", "", false, "192.0.2.1"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.RemoteAddr = testCase.remoteAddr
+			if testCase.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", testCase.forwardedFor)
+			}
+			assert.Equal(t, testCase.expectedValue, clientIP(req, testCase.trustProxy))
+		})
+	}
+}
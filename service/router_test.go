@@ -0,0 +1,68 @@
+package service_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+func TestNewRouter(t *testing.T) {
+	t.Parallel()
+
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"stars_count":42}`))
+	}))
+	defer fakeAPI.Close()
+
+	router, err := service.NewRouter(&config.Config{
+		UpstreamTimeout: time.Second,
+		CacheSeconds:    3600,
+		MaxCacheSeconds: 86400,
+		GiteaBaseURL:    fakeAPI.URL,
+		Providers:       []string{"gitea"},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.StripPrefix("/badges", router))
+	defer server.Close()
+
+	testCases := []struct {
+		path               string
+		expectedStatusCode int
+	}{
+		{"/badges/gitea/stars/forgejo/forgejo", http.StatusOK},
+		{"/badges/static/build/passing", http.StatusOK},
+		{"/badges/healthz", http.StatusOK},
+		// badge services of the providers that aren't set aren't served
+		{"/badges/github/stars/google/gopacket", http.StatusNotFound},
+	}
+
+	for _, testCase := range testCases {
+		resp, err := http.Get(server.URL + testCase.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, testCase.expectedStatusCode, resp.StatusCode, testCase.path)
+	}
+}
+
+func TestNewRouterMissingDependencies(t *testing.T) {
+	t.Parallel()
+
+	_, err := service.NewRouter(nil, zap.NewNop())
+	assert.Error(t, err)
+	_, err = service.NewRouter(&config.Config{}, nil)
+	assert.Error(t, err)
+	// the GitHub badge service requires an access token, unless unauthenticated GitHub API calls are allowed
+	_, err = service.NewRouter(&config.Config{Providers: []string{"github"}}, zap.NewNop())
+	assert.Error(t, err)
+}
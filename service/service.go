@@ -1,9 +1,12 @@
 package service
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,6 +14,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 
 	"github.com/tohjustin/aegis/service/config"
@@ -21,13 +25,25 @@ type BadgeService interface {
 	http.Handler
 }
 
+// MetricService represents a badge service serving a fixed set of metrics, selected by the `method` route variable
+type MetricService interface {
+	BadgeService
+	SupportedMetrics() []string
+}
+
+// queryParamsService represents a metric service accepting query parameters specific to some of its metrics, by
+// metric. Query parameters of the empty metric are accepted by every metric.
+type queryParamsService interface {
+	supportedQueryParams() map[string][]badgeQueryParam
+}
+
 // GitProviderService represents a badge service for git providers
 type GitProviderService interface {
-	BadgeService
-	getForkCount(owner string, repo string) (int, error)
-	getIssueCount(owner string, repo string, issueState string) (int, error)
-	getPullRequestCount(owner string, repo string, pullRequestState string) (int, error)
-	getStarCount(owner string, repo string) (int, error)
+	MetricService
+	getForkCount(ctx context.Context, owner string, repo string) (int, error)
+	getIssueCount(ctx context.Context, owner string, repo string, issueState string) (int, error)
+	getPullRequestCount(ctx context.Context, owner string, repo string, pullRequestState string) (int, error)
+	getStarCount(ctx context.Context, owner string, repo string) (int, error)
 }
 
 // Info contains build information about the application
@@ -47,23 +63,143 @@ type Application struct {
 	rootCmd *cobra.Command
 
 	staticService    *BadgeService
+	azureService     MetricService
 	bitbucketService *GitProviderService
+	giteaService     *GitProviderService
 	githubService    *GitProviderService
 	gitlabService    *GitProviderService
+	historyStore     *historyStore
+	historyService   http.Handler
+	historyRecorder  *historyRecorder
+	cratesService    MetricService
+	dockerService    MetricService
+	dynamicService   http.Handler
+	endpointService  http.Handler
+	npmService       MetricService
+	pypiService      MetricService
+	snippetService   http.Handler
+	sourcehutService MetricService
+	readinessChecker *readinessChecker
 }
 
-func (app *Application) init() {
-	logger, err := newLogger()
+func (app *Application) init(cmd *cobra.Command) {
+	// load config first, since the configuration file may set logger flags
+	config, err := config.New(cmd.Flags().Changed)
+	if err != nil {
+		log.Fatalf("Failed to get config: %v", err)
+	}
+	app.config = config
+
+	logger, err := newLogger(config)
 	if err != nil {
 		log.Fatalf("Failed to get logger: %v", err)
 	}
 	app.logger = logger
+}
+
+// initServices initializes the badge services of the application, only initializing the badge services of the
+// providers set by the configuration if any
+func (app *Application) initServices() error {
+	app.logger.Info("Initializing services...")
+	providers := map[string]bool{}
+	for _, provider := range app.config.Providers {
+		providers[provider] = true
+	}
+	enabled := func(provider string) bool {
+		return len(providers) == 0 || providers[provider]
+	}
 
-	config, err := config.New()
+	staticService, err := NewStaticService(app.config, app.logger)
 	if err != nil {
-		log.Fatalf("Failed to get config: %v", err)
+		return fmt.Errorf("failed to get static service: %w", err)
 	}
-	app.config = config
+	app.staticService = &staticService
+	if enabled("azure") {
+		azureService, err := NewAzureDevopsService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get Azure DevOps service: %w", err)
+		}
+		app.azureService = azureService
+	}
+	if enabled("bitbucket") {
+		bitbucketService, err := NewBitbucketService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get Bitbucket service: %w", err)
+		}
+		app.bitbucketService = &bitbucketService
+	}
+	if enabled("gitea") {
+		giteaService, err := NewGiteaService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get Gitea service: %w", err)
+		}
+		app.giteaService = &giteaService
+	}
+	if enabled("github") {
+		githubService, err := NewGithubService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get GitHub service: %w", err)
+		}
+		app.githubService = &githubService
+	}
+	if enabled("gitlab") {
+		gitlabService, err := NewGitlabService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get GitLab service: %w", err)
+		}
+		app.gitlabService = &gitlabService
+	}
+	if enabled("crates") {
+		cratesService, err := NewCratesService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get crates.io service: %w", err)
+		}
+		app.cratesService = cratesService
+	}
+	if enabled("docker") {
+		dockerService, err := NewDockerService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get Docker Hub service: %w", err)
+		}
+		app.dockerService = dockerService
+	}
+	if enabled("npm") {
+		npmService, err := NewNpmService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get npm service: %w", err)
+		}
+		app.npmService = npmService
+	}
+	if enabled("pypi") {
+		pypiService, err := NewPypiService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get PyPI service: %w", err)
+		}
+		app.pypiService = pypiService
+	}
+	if enabled("sourcehut") {
+		sourcehutService, err := NewSourcehutService(app.config, app.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get SourceHut service: %w", err)
+		}
+		app.sourcehutService = sourcehutService
+	}
+	dynamicService, err := NewDynamicService(app.config, app.logger)
+	if err != nil {
+		return fmt.Errorf("failed to get dynamic service: %w", err)
+	}
+	app.dynamicService = dynamicService
+	endpointService, err := NewEndpointService(app.config, app.logger)
+	if err != nil {
+		return fmt.Errorf("failed to get endpoint service: %w", err)
+	}
+	app.endpointService = endpointService
+	snippetService, err := NewSnippetService(app.config, app.logger)
+	if err != nil {
+		return fmt.Errorf("failed to get snippet service: %w", err)
+	}
+	app.snippetService = snippetService
+	return nil
 }
 
 func (app *Application) execute() {
@@ -72,34 +208,57 @@ func (app *Application) execute() {
 		zap.String("GitHash", app.info.GitHash),
 		zap.Int("NumCPU", runtime.NumCPU()))
 
-	// Setup dependencies
-	app.logger.Info("Initializing services...")
-	staticService, err := NewStaticService(app.config, app.logger)
-	if err != nil {
-		log.Fatalf("Failed to get static service: %v", err)
+	// Log the effective configuration, without secrets
+	if options, err := config.Options(true); err == nil {
+		fields := make([]zap.Field, 0, len(options))
+		for _, option := range options {
+			fields = append(fields, zap.String(option.Name, option.Value))
+		}
+		app.logger.Info("Loaded configuration", fields...)
 	}
-	bitbucketService, err := NewBitbucketService(app.config, app.logger)
+
+	// Export traces if an OTLP endpoint is set
+	tracerProvider, err := newTracerProvider(context.Background(), app.info.ExecutableName)
 	if err != nil {
-		log.Fatalf("Failed to get Bitbucket service: %v", err)
+		log.Fatalf("Failed to get tracer provider: %v", err)
 	}
-	githubService, err := NewGithubService(app.config, app.logger)
-	if err != nil {
-		log.Fatalf("Failed to get GitHub service: %v", err)
+	if tracerProvider != nil {
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			app.logger.Warn("Failed to export traces", zap.Error(err))
+		}))
+		otel.SetTracerProvider(tracerProvider)
+		app.logger.Info("Exporting traces to the OTLP endpoint...")
 	}
-	gitlabService, err := NewGitlabService(app.config, app.logger)
-	if err != nil {
-		log.Fatalf("Failed to get GitLab service: %v", err)
+
+	// Setup dependencies
+	if err := app.initServices(); err != nil {
+		log.Fatalf("Failed to initialize services: %v", err)
+	}
+	if app.config.ReadinessCheckUpstreams {
+		app.readinessChecker = newReadinessChecker(readinessCheckTargets)
+	}
+	if app.config.HistoryFile != "" {
+		historyStore, err := newHistoryStore(app.config.HistoryFile, app.config.HistoryRetention)
+		if err != nil {
+			log.Fatalf("Failed to get history store: %v", err)
+		}
+		historyRecorder, err := newHistoryRecorder(app.config, app.logger, historyStore, app.gitProviderServices())
+		if err != nil {
+			log.Fatalf("Failed to get history recorder: %v", err)
+		}
+		historyService, err := NewHistoryService(app.config, app.logger, historyStore)
+		if err != nil {
+			log.Fatalf("Failed to get history service: %v", err)
+		}
+		app.historyStore = historyStore
+		app.historyRecorder = historyRecorder
+		app.historyService = historyService
 	}
-	app.staticService = &staticService
-	app.bitbucketService = &bitbucketService
-	app.githubService = &githubService
-	app.gitlabService = &gitlabService
 
-	httpServer := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.config.Port),
-		ReadTimeout:  app.config.ReadTimeout,
-		WriteTimeout: app.config.WriteTimeout,
-		Handler:      app.handler(),
+	httpServer := newHTTPServer(app.config, app.handler())
+	listener, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", httpServer.Addr, err)
 	}
 
 	// gracefully shutdowns server
@@ -111,46 +270,275 @@ func (app *Application) execute() {
 		app.logger.Info("Received signal from OS", zap.String("signal", s.String()))
 
 		app.logger.Info("Starting shutdown...")
-		if err := httpServer.Shutdown(nil); err != nil {
+		if err := httpServer.Shutdown(context.Background()); err != nil {
 			app.logger.Error("Encountered error during shutdown", zap.Error(err))
 		}
+		if app.historyRecorder != nil {
+			app.historyRecorder.stop()
+		}
+		if tracerProvider != nil {
+			if err := tracerProvider.Shutdown(context.Background()); err != nil {
+				app.logger.Error("Failed to flush traces", zap.Error(err))
+			}
+		}
 
 		app.logger.Info("Shutdown complete.")
 		close(idleConnsClosed)
 	}()
 
+	// Start recording metric snapshots
+	if app.historyRecorder != nil {
+		app.logger.Info("Recording metric snapshots...",
+			zap.String("HistoryFile", app.config.HistoryFile),
+			zap.Duration("HistoryInterval", app.config.HistoryInterval))
+		app.historyRecorder.start()
+	}
+
 	// Start HTTP server
-	app.logger.Info("HTTP server listening...", zap.Uint("Port", app.config.Port))
-	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+	app.logger.Info("HTTP server listening...",
+		zap.String("Addr", listener.Addr().String()),
+		zap.Bool("TLS", httpServer.TLSConfig != nil))
+	if err := serve(app.config, httpServer, listener); err != http.ErrServerClosed {
 		app.logger.Error("HTTP server encountered an error", zap.Error(err))
 	}
 
 	<-idleConnsClosed
 }
 
-// handler setup routes & returns a HTTP handler for the application server
-func (app *Application) handler() http.Handler {
+// newHTTPServer returns the HTTP server of the application. With a TLS certificate, the server only accepts TLS 1.2+
+// with forward secret AEAD cipher suites, which also satisfies the requirements of HTTP/2.
+func newHTTPServer(configuration *config.Config, handler http.Handler) *http.Server {
+	httpServer := &http.Server{
+		Addr:         configuration.ListenAddr,
+		ReadTimeout:  configuration.ReadTimeout,
+		WriteTimeout: configuration.WriteTimeout,
+		Handler:      handler,
+	}
+	if configuration.TLSCertFile != "" {
+		httpServer.TLSConfig = &tls.Config{
+			MinVersion:               tls.VersionTLS12,
+			PreferServerCipherSuites: true,
+			CurvePreferences:         []tls.CurveID{tls.X25519, tls.CurveP256},
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			},
+		}
+	}
+	return httpServer
+}
+
+// serve accepts connections on the listener until the HTTP server is shut down, over TLS (negotiating HTTP/2) if a
+// TLS certificate is configured
+func serve(configuration *config.Config, httpServer *http.Server, listener net.Listener) error {
+	if httpServer.TLSConfig != nil {
+		return httpServer.ServeTLS(listener, configuration.TLSCertFile, configuration.TLSKeyFile)
+	}
+	return httpServer.Serve(listener)
+}
+
+// withSupportedMetrics responds with a not found badge to requests for metrics that the service doesn't support,
+// before they reach the next handler. Metrics are case-sensitive.
+func withSupportedMetrics(configuration *config.Config, service MetricService, next http.Handler) http.Handler {
+	supported := make(map[string]bool)
+	for _, metric := range service.SupportedMetrics() {
+		supported[metric] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !supported[mux.Vars(r)["method"]] {
+			if err := notFound(w, configuration); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gitProviderServices returns the initialized badge services of the git providers of the application by provider
+func (app *Application) gitProviderServices() map[string]GitProviderService {
+	gitProviderServices := map[string]GitProviderService{}
+	for provider, service := range map[string]*GitProviderService{
+		"bitbucket": app.bitbucketService,
+		"gitea":     app.giteaService,
+		"github":    app.githubService,
+		"gitlab":    app.gitlabService,
+	} {
+		if service != nil {
+			gitProviderServices[provider] = *service
+		}
+	}
+	return gitProviderServices
+}
+
+// metricServices returns the metric services of the application by provider
+func (app *Application) metricServices() map[string]MetricService {
+	metricServices := map[string]MetricService{}
+	for provider, service := range app.gitProviderServices() {
+		metricServices[provider] = service
+	}
+	for provider, service := range map[string]MetricService{
+		"azure":     app.azureService,
+		"crates":    app.cratesService,
+		"docker":    app.dockerService,
+		"npm":       app.npmService,
+		"pypi":      app.pypiService,
+		"sourcehut": app.sourcehutService,
+	} {
+		if service != nil {
+			metricServices[provider] = service
+		}
+	}
+	return metricServices
+}
+
+// withHistory adds sparklines of the recorded metric snapshots to the badges of the git provider, if metric snapshots
+// are recorded
+func (app *Application) withHistory(provider string, service GitProviderService) http.Handler {
+	if app.historyStore == nil {
+		return service
+	}
+	return withSparkline(app.historyStore, provider, service)
+}
+
+// router setup routes & returns the router of the application server
+func (app *Application) router() *mux.Router {
 	mux := mux.NewRouter()
+	metricServices := app.metricServices()
+	headCache := newHeadResponseCache(headCacheSize)
 
 	mux.UseEncodedPath()
-	mux.Handle(`/static`, *app.staticService).Methods("GET")
-	mux.Handle(`/bitbucket/{method}/{owner}/{repo}`, *app.bitbucketService).Methods("GET")
-	mux.Handle(`/github/{method}/{owner}/{repo}`, *app.githubService).Methods("GET")
-	mux.Handle(`/gitlab/{method}/{owner}/{repo}`, *app.gitlabService).Methods("GET")
+	mux.HandleFunc(`/healthz`, healthz).Methods("GET", "HEAD")
+	mux.HandleFunc(`/version`, versionHandler).Methods("GET")
+	mux.Handle(`/readyz`, newReadyzHandler(app.readinessChecker)).Methods("GET", "HEAD")
+	mux.Handle(`/metrics`, newMetricsHandler()).Methods("GET")
+	mux.Handle(`/openapi.json`, newOpenAPIHandler(app.config, mux, metricServices)).Methods("GET")
+	mux.Handle(`/static`, withMetrics("static", *app.staticService)).Methods("GET", "HEAD")
+	mux.Handle(`/static/{subject}/{status}`, withMetrics("static", *app.staticService)).Methods("GET", "HEAD")
+	mux.Handle(`/static/{subject}/{status}/{color}`, withMetrics("static", *app.staticService)).Methods("GET", "HEAD")
+	if app.bitbucketService != nil {
+		handleCombined(mux, app.config, app.logger, "bitbucket", *app.bitbucketService)
+		mux.Handle(`/bitbucket/{method}/{owner}/{repo}`, withMetrics("bitbucket", withSupportedMetrics(app.config, *app.bitbucketService, app.withHistory("bitbucket", *app.bitbucketService)))).Methods("GET", "HEAD")
+	}
+	if app.giteaService != nil {
+		handleCombined(mux, app.config, app.logger, "gitea", *app.giteaService)
+		mux.Handle(`/gitea/{method}/{owner}/{repo}`, withMetrics("gitea", withSupportedMetrics(app.config, *app.giteaService, app.withHistory("gitea", *app.giteaService)))).Methods("GET", "HEAD")
+	}
+	if app.githubService != nil {
+		handleCombined(mux, app.config, app.logger, "github", *app.githubService)
+		mux.Handle(`/github/{method:issue-breakdown}/{owner}/{repo}`, withMetrics("github", *app.githubService)).Methods("GET", "HEAD")
+		mux.Handle(`/github/{account:user}/{owner}/{method:followers|repos|sponsors}`, withMetrics("github", *app.githubService)).Methods("GET", "HEAD")
+		mux.Handle(`/github/{account:org}/{owner}/{method:stars}`, withMetrics("github", *app.githubService)).Methods("GET", "HEAD")
+		mux.Handle(`/github/{method}/{owner}/{repo}`, withMetrics("github", withSupportedMetrics(app.config, *app.githubService, app.withHistory("github", *app.githubService)))).Methods("GET", "HEAD")
+		mux.Handle(`/github/{method:downloads}/{owner}/{repo}/{tag}`, withMetrics("github", *app.githubService)).Methods("GET", "HEAD")
+		mux.Handle(`/github/{method:milestone}/{owner}/{repo}/{number:[0-9]+}`, withMetrics("github", *app.githubService)).Methods("GET", "HEAD")
+		mux.Handle(`/github/{method:workflow}/{owner}/{repo}/{workflow}`, withMetrics("github", *app.githubService)).Methods("GET", "HEAD")
+	}
+	if app.gitlabService != nil {
+		handleCombined(mux, app.config, app.logger, "gitlab", *app.gitlabService)
+		mux.Handle(`/gitlab/{method}/{owner}/{repo}`, withMetrics("gitlab", withSupportedMetrics(app.config, *app.gitlabService, app.withHistory("gitlab", *app.gitlabService)))).Methods("GET", "HEAD")
+	}
+	if app.historyStore != nil {
+		handleAPI(mux, `/history/{provider}/{owner}/{repo}/{metric}`, withMetrics("history", app.historyService))
+	}
+	if app.azureService != nil {
+		handleCombined(mux, app.config, app.logger, "azure", app.azureService)
+		mux.Handle(`/azure/{method}/{organization}/{project}/{repo}`, withMetrics("azure", withSupportedMetrics(app.config, app.azureService, app.azureService))).Methods("GET", "HEAD")
+	}
+	if app.cratesService != nil {
+		handleCombined(mux, app.config, app.logger, "crates", app.cratesService)
+		mux.Handle(`/crates/{method}/{package}`, withMetrics("crates", withSupportedMetrics(app.config, app.cratesService, app.cratesService))).Methods("GET", "HEAD")
+	}
+	if app.dockerService != nil {
+		handleCombined(mux, app.config, app.logger, "docker", app.dockerService)
+		mux.Handle(`/docker/{method}/{owner}/{repo}`, withMetrics("docker", withSupportedMetrics(app.config, app.dockerService, app.dockerService))).Methods("GET", "HEAD")
+	}
+	if app.dynamicService != nil {
+		mux.Handle(`/dynamic/json`, withMetrics("dynamic", app.dynamicService)).Methods("GET", "HEAD")
+	}
+	if app.endpointService != nil {
+		mux.Handle(`/endpoint`, withMetrics("endpoint", app.endpointService)).Methods("GET", "HEAD")
+	}
+	if app.npmService != nil {
+		handleCombined(mux, app.config, app.logger, "npm", app.npmService)
+		mux.Handle(`/npm/{method}/{package}`, withMetrics("npm", withSupportedMetrics(app.config, app.npmService, app.npmService))).Methods("GET", "HEAD")
+	}
+	if app.pypiService != nil {
+		handleCombined(mux, app.config, app.logger, "pypi", app.pypiService)
+		mux.Handle(`/pypi/{method}/{package}`, withMetrics("pypi", withSupportedMetrics(app.config, app.pypiService, app.pypiService))).Methods("GET", "HEAD")
+	}
+	if app.sourcehutService != nil {
+		handleCombined(mux, app.config, app.logger, "sourcehut", app.sourcehutService)
+		mux.Handle(`/sourcehut/{method}/{owner}/{repo}`, withMetrics("sourcehut", withSupportedMetrics(app.config, app.sourcehutService, app.sourcehutService))).Methods("GET", "HEAD")
+	}
+	if app.snippetService != nil {
+		handleAPI(mux, `/snippet/{provider}/{owner}/{repo}`, withMetrics("snippet", app.snippetService))
+	}
+	if app.config.WebhookSecret != "" {
+		purgers := map[string]repositoryCachePurger{}
+		for provider, service := range app.gitProviderServices() {
+			if purger, ok := service.(repositoryCachePurger); ok {
+				purgers[provider] = purger
+			}
+		}
+		mux.Handle(`/webhook/{provider}`, newWebhookHandler(app.config, app.logger, headCache, purgers)).Methods("POST")
+	}
+	if app.config.EnableDebugEndpoints {
+		handleDebug(mux, app.config)
+	}
 
 	if url := app.config.RootRedirectURL; url != "" {
 		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 			http.Redirect(w, r, url, http.StatusFound)
 		}).Methods("GET")
+	} else {
+		mux.Handle("/", newIndexHandler(app.config, mux, metricServices)).Methods("GET")
 	}
-	// return service-not-found badge for all unmatched routes
-	mux.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		serviceNotFound(w, app.config)
-	}).Methods("GET")
+	mux.Use(func(next http.Handler) http.Handler {
+		return withAPIDeprecations(app.config.APIDeprecations, next)
+	})
+	mux.Use(func(next http.Handler) http.Handler {
+		return withHeadRequests(headCache, next)
+	})
+	// return unknown-badge badge (or redirect legacy paths) for all unmatched routes
+	mux.NotFoundHandler = newNotFoundHandler(app.config)
 
 	return mux
 }
 
+// handler returns a HTTP handler for the application server, wrapping the router with the middlewares
+func (app *Application) handler() http.Handler {
+	router := app.router()
+	if app.logger == nil {
+		return withRequestID(withTracing(router, withVersionHeader(withCORS(app.config.CORSAllowedOrigins, withQueryToken(withGzip(router))))))
+	}
+	return withRequestID(withTracing(router, withVersionHeader(withCORS(app.config.CORSAllowedOrigins, withQueryToken(withGzip(withRequestLogging(app.logger, app.config.TrustProxy, router)))))))
+}
+
+// NewRouter returns the HTTP handler of the badge routes (wrapped with the middlewares of the server) for applications
+// embedding the badge services, which can mount it under a path prefix with http.StripPrefix. Unlike the server, the
+// configuration isn't validated nor defaulted, metric snapshots aren't recorded & readiness probes don't check upstream
+// APIs.
+func NewRouter(configuration *config.Config, logger *zap.Logger) (http.Handler, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	app := &Application{config: configuration, logger: logger}
+	if err := app.initServices(); err != nil {
+		return nil, err
+	}
+	return app.handler(), nil
+}
+
 // Start starts the application
 func (app *Application) Start() error {
 	return app.rootCmd.Execute()
@@ -167,7 +555,7 @@ func New(appInfo Info) (*Application, error) {
 		Use:  appInfo.ExecutableName,
 		Long: appInfo.LongName,
 		Run: func(cmd *cobra.Command, args []string) {
-			app.init()
+			app.init(cmd)
 			app.execute()
 		},
 	}
@@ -178,18 +566,42 @@ func New(appInfo Info) (*Application, error) {
 			fmt.Printf("%s v%s (%s)\n", appInfo.ShortName, appInfo.Version, appInfo.GitHash)
 		},
 	}
-	rootCmd.AddCommand(versionCmd)
+	configCmd := &cobra.Command{
+		Use:  "config",
+		Long: "Manage the configuration",
+	}
+	configValidateCmd := &cobra.Command{
+		Use:  "validate",
+		Long: "Validate the configuration without starting the server",
+		Run: func(cmd *cobra.Command, args []string) {
+			app.init(cmd)
+			fmt.Println("Configuration is valid")
+		},
+	}
+	var redactSecrets bool
+	configPrintCmd := &cobra.Command{
+		Use:  "print",
+		Long: "Print the effective configuration, merged from the configuration file, environment variables & flags",
+		Run: func(cmd *cobra.Command, args []string) {
+			app.init(cmd)
+			if err := config.Print(os.Stdout, redactSecrets); err != nil {
+				log.Fatalf("Failed to print config: %v", err)
+			}
+		},
+	}
+	configPrintCmd.Flags().BoolVar(&redactSecrets, "redact-secrets", false, "Replace secrets (eg. access tokens) with \"REDACTED\".")
+	configCmd.AddCommand(configValidateCmd, configPrintCmd)
+	rootCmd.AddCommand(versionCmd, configCmd, newGenerateCmd(), app.newFetchCmd())
 
 	// Setup Flags
 	flagSet := new(flag.FlagSet)
 	addFlagsFns := []func(*flag.FlagSet){
 		config.Flags,
-		loggerFlags,
 	}
 	for _, addFlags := range addFlagsFns {
 		addFlags(flagSet)
 	}
-	rootCmd.Flags().AddGoFlagSet(flagSet)
+	rootCmd.PersistentFlags().AddGoFlagSet(flagSet)
 
 	app.rootCmd = rootCmd
 
@@ -1,14 +1,65 @@
 package service
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/tohjustin/aegis/pkg/badge"
 	"github.com/tohjustin/aegis/service/config"
 	"go.uber.org/zap"
 )
 
+// mockGitProviderService is a git provider service returning fixed values & counting its upstream calls
+type mockGitProviderService struct {
+	http.Handler
+	value int
+	err   error
+	calls int32
+}
+
+func (service *mockGitProviderService) fetch() (int, error) {
+	atomic.AddInt32(&service.calls, 1)
+	return service.value, service.err
+}
+
+func (service *mockGitProviderService) SupportedMetrics() []string {
+	return []string{"forks", "issues", "pull-requests", "stars"}
+}
+
+func (service *mockGitProviderService) getForkCount(ctx context.Context, owner string, repo string) (int, error) {
+	return service.fetch()
+}
+
+func (service *mockGitProviderService) getIssueCount(ctx context.Context, owner string, repo string, issueState string) (int, error) {
+	return service.fetch()
+}
+
+func (service *mockGitProviderService) getPullRequestCount(ctx context.Context, owner string, repo string, pullRequestState string) (int, error) {
+	return service.fetch()
+}
+
+func (service *mockGitProviderService) getStarCount(ctx context.Context, owner string, repo string) (int, error) {
+	return service.fetch()
+}
+
 type httpTestCase struct {
 	requestMethod   string
 	requestPath     string
@@ -24,8 +75,8 @@ func runHTTPTest(t *testing.T, testCase httpTestCase) {
 	}
 
 	// TODO: Create proper mock dependencies & service generators
-	mockLogger := &zap.Logger{}
-	mockConfig := &config.Config{}
+	mockLogger := zap.NewNop()
+	mockConfig := &config.Config{CacheSeconds: 3600, MinCacheSeconds: 300, MaxCacheSeconds: 86400, MaxLogoSize: 8192}
 	mockStaticService, err := NewStaticService(mockConfig, mockLogger)
 	if err != nil {
 		t.Fatalf(err.Error())
@@ -37,8 +88,10 @@ func runHTTPTest(t *testing.T, testCase httpTestCase) {
 
 	testServer := &Application{
 		info:             Info{},
+		config:           mockConfig,
 		staticService:    &mockStaticService,
 		bitbucketService: &mockGitProviderService,
+		giteaService:     &mockGitProviderService,
 		githubService:    &mockGitProviderService,
 		gitlabService:    &mockGitProviderService,
 	}
@@ -65,3 +118,180 @@ func runHTTPTest(t *testing.T, testCase httpTestCase) {
 			body, testCase.expectedBody)
 	}
 }
+
+func TestUnsupportedMetric(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		requestPath string
+	}{
+		{"Unknown", "/gitlab/bananas/google/gopacket"},
+		{"CaseMismatch", "/gitlab/Stars/google/gopacket"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			runHTTPTest(t, httpTestCase{
+				requestMethod: "GET",
+				requestPath:   testCase.requestPath,
+				expectedHeaders: map[string]string{
+					"Cache-Control": "no-store",
+					"Content-Type":  "image/svg+xml;utf-8",
+				},
+				expectedStatus: http.StatusNotFound,
+				expectedBody:   createBadge(&badge.Params{Subject: "aegis", Status: "not found"}),
+			})
+		})
+	}
+}
+
+func TestWithSupportedMetrics(t *testing.T) {
+	t.Parallel()
+
+	service := &mockGitProviderService{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("badge"))
+		}),
+	}
+	router := mux.NewRouter()
+	router.Handle(`/mock/{method}/{owner}/{repo}`, withSupportedMetrics(&config.Config{}, service, service))
+
+	testCases := []struct {
+		name           string
+		requestPath    string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Supported", "/mock/stars/google/gopacket", http.StatusOK, "badge"},
+		{"Unsupported", "/mock/bananas/google/gopacket", http.StatusNotFound, createBadge(&badge.Params{Subject: "aegis", Status: "not found"})},
+		{"CaseMismatch", "/mock/STARS/google/gopacket", http.StatusNotFound, createBadge(&badge.Params{Subject: "aegis", Status: "not found"})},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.requestPath, nil)
+			router.ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", res.Code, testCase.expectedStatus)
+			}
+			if body := res.Body.String(); body != testCase.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v", body, testCase.expectedBody)
+			}
+		})
+	}
+}
+
+// writeSelfSignedCertificate writes a PEM encoded self-signed certificate of 127.0.0.1 & its private key into the
+// directory, returning the certificate & the paths of the files
+func writeSelfSignedCertificate(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certificate, certFile, keyFile
+}
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "aegis-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certificate, certFile, keyFile := writeSelfSignedCertificate(t, dir)
+	certPool := x509.NewCertPool()
+	certPool.AddCert(certificate)
+
+	testCases := []struct {
+		name          string
+		certFile      string
+		keyFile       string
+		scheme        string
+		expectedProto string
+	}{
+		{"HTTP", "", "", "http", "HTTP/1.1"},
+		{"HTTPS", certFile, keyFile, "https", "HTTP/2.0"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			configuration := &config.Config{
+				ListenAddr:      "127.0.0.1:0",
+				TLSCertFile:     testCase.certFile,
+				TLSKeyFile:      testCase.keyFile,
+				CacheSeconds:    3600,
+				MinCacheSeconds: 300,
+				MaxCacheSeconds: 86400,
+			}
+			staticService, err := NewStaticService(configuration, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			httpServer := newHTTPServer(configuration, staticService)
+			listener, err := net.Listen("tcp", httpServer.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			served := make(chan error, 1)
+			go func() {
+				served <- serve(configuration, httpServer, listener)
+			}()
+
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: certPool},
+				ForceAttemptHTTP2: true,
+			}}
+			res, err := client.Get(testCase.scheme + "://" + listener.Addr().String() + "/static?subject=build&status=passing")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, testCase.expectedProto, res.Proto)
+			assert.Equal(t, createBadge(&badge.Params{Subject: "build", Status: "passing"}), string(body))
+
+			// Shutting down gracefully stops serving in both modes
+			assert.NoError(t, httpServer.Shutdown(context.Background()))
+			assert.Equal(t, http.ErrServerClosed, <-served)
+		})
+	}
+}
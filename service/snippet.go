@@ -0,0 +1,210 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// snippetProvider represents the badges available for a git provider
+type snippetProvider struct {
+	// repoURLFormat is the format of the repository URL linked by the badges
+	repoURLFormat string
+	badges        []string
+}
+
+// snippetProviders represents the git providers supported by the snippet service
+var snippetProviders = map[string]snippetProvider{
+	"bitbucket": {
+		repoURLFormat: "https://bitbucket.org/%s/%s",
+		badges:        []string{"forks", "branches", "issues", "pull-requests", "tags", "watchers"},
+	},
+	"gitea": {
+		repoURLFormat: "https://codeberg.org/%s/%s",
+		badges:        []string{"stars", "forks", "issues", "pull-requests"},
+	},
+	"github": {
+		repoURLFormat: "https://github.com/%s/%s",
+		badges:        []string{"stars", "forks", "age", "branches", "commits", "contributors", "discussions", "issues", "language", "languages", "last-commit", "license", "pull-requests", "release", "review-load", "size", "status", "tag", "tags", "watchers"},
+	},
+	"gitlab": {
+		repoURLFormat: "https://gitlab.com/%s/%s",
+		badges:        []string{"stars", "forks", "commits", "contributors", "coverage", "issues", "merge-requests", "pipeline", "releases", "tags", "topics", "visibility"},
+	},
+	"sourcehut": {
+		repoURLFormat: "https://sr.ht/%s/%s",
+		badges:        []string{"tickets", "patches"},
+	},
+}
+
+// snippetBadge represents a badge of the snippet
+type snippetBadge struct {
+	name     string
+	imageURL string
+	linkURL  string
+}
+
+type snippetService struct {
+	name   string
+	config *config.Config
+	logger *zap.Logger
+}
+
+// NewSnippetService returns a HTTP handler for the service generating Markdown & HTML snippets of badges
+func NewSnippetService(configuration *config.Config, logger *zap.Logger) (http.Handler, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	return &snippetService{
+		name:   "snippet",
+		config: configuration,
+		logger: logger,
+	}, nil
+}
+
+// escapeMarkdownURL escapes the characters of a URL that end a Markdown link destination
+func escapeMarkdownURL(str string) string {
+	return strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(str)
+}
+
+// baseURL returns the external base URL of the instance, falling back on the host of the request if not configured
+func (service *snippetService) baseURL(r *http.Request) string {
+	if service.config.ExternalURL != "" {
+		return strings.TrimSuffix(service.config.ExternalURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// parseSnippetBadges returns the badges requested, or every badge available for the provider if none is requested
+func parseSnippetBadges(provider snippetProvider, queryBadges string) ([]string, error) {
+	if queryBadges == "" {
+		return provider.badges, nil
+	}
+
+	var badges []string
+	for _, name := range strings.Split(queryBadges, ",") {
+		supported := false
+		for _, providerBadge := range provider.badges {
+			if name == providerBadge {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("unsupported badge: %s", name)
+		}
+		badges = append(badges, name)
+	}
+
+	return badges, nil
+}
+
+// formatSnippet formats the badges into a Markdown or HTML snippet
+func formatSnippet(badges []snippetBadge, format string) string {
+	lines := make([]string, 0, len(badges))
+	for _, entry := range badges {
+		if format == "html" {
+			lines = append(lines, fmt.Sprintf(`<a href="%s"><img src="%s" alt="%s"></a>`,
+				html.EscapeString(entry.linkURL), html.EscapeString(entry.imageURL), html.EscapeString(entry.name)))
+		} else {
+			lines = append(lines, fmt.Sprintf("[![%s](%s)](%s)",
+				entry.name, escapeMarkdownURL(entry.imageURL), escapeMarkdownURL(entry.linkURL)))
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (service *snippetService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(service.logger, r)
+	routeVariables := mux.Vars(r)
+	providerName := routeVariables["provider"]
+	owner, _ := url.PathUnescape(routeVariables["owner"])
+	repo, _ := url.PathUnescape(routeVariables["repo"])
+	query := r.URL.Query()
+
+	provider, ok := snippetProviders[providerName]
+	if !ok {
+		logger.Info("Unsupported provider",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.String("provider", providerName))
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	badges, err := parseSnippetBadges(provider, query.Get("badges"))
+	if err != nil {
+		logger.Info("Unsupported badges",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.Error(err))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "markdown" && format != "html" {
+		logger.Info("Unsupported format",
+			zap.String("url", r.URL.RequestURI()),
+			zap.String("service", service.name),
+			zap.String("format", format))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Only pass on supported styles, the badge query is validated again by the badge services
+	badgeQuery := url.Values{}
+	if style := query.Get("style"); style != "" {
+		supported := false
+		for _, supportedStyle := range badge.SupportedStyles {
+			if badge.Style(style) == supportedStyle {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			logger.Info("Unsupported style",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.String("style", style))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		badgeQuery.Set("style", style)
+	}
+
+	baseURL := service.baseURL(r)
+	linkURL := fmt.Sprintf(provider.repoURLFormat, url.PathEscape(owner), url.PathEscape(repo))
+	// Gitea repositories are linked on the configured Gitea instance, which defaults to Codeberg
+	if providerName == "gitea" && service.config.GiteaBaseURL != "" {
+		linkURL = fmt.Sprintf("%s/%s/%s", service.config.GiteaBaseURL, url.PathEscape(owner), url.PathEscape(repo))
+	}
+	snippetBadges := make([]snippetBadge, 0, len(badges))
+	for _, name := range badges {
+		imageURL := fmt.Sprintf("%s/%s/%s/%s/%s", baseURL, providerName, name, url.PathEscape(owner), url.PathEscape(repo))
+		if len(badgeQuery) > 0 {
+			imageURL += "?" + badgeQuery.Encode()
+		}
+		snippetBadges = append(snippetBadges, snippetBadge{name: name, imageURL: imageURL, linkURL: linkURL})
+	}
+
+	setCacheControlHeaders(w, service.config, service.config.CacheSeconds)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(formatSnippet(snippetBadges, format)))
+}
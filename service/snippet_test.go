@@ -0,0 +1,109 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+func runSnippetTest(t *testing.T, configuration *config.Config, path string) *httptest.ResponseRecorder {
+	snippetService, err := NewSnippetService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/api/snippet/{provider}/{owner}/{repo}`, snippetService)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Host = "badges.example.com"
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestSnippetService(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		config   *config.Config
+		path     string
+		expected string
+	}{
+		{
+			"Markdown",
+			&config.Config{ExternalURL: "https://aegis.example.com/"},
+			"/api/snippet/github/google/gopacket?badges=stars,forks&style=flat",
+			"[![stars](https://aegis.example.com/github/stars/google/gopacket?style=flat)](https://github.com/google/gopacket)\n" +
+				"[![forks](https://aegis.example.com/github/forks/google/gopacket?style=flat)](https://github.com/google/gopacket)\n",
+		},
+		{
+			"HTML",
+			&config.Config{ExternalURL: "https://aegis.example.com"},
+			"/api/snippet/gitlab/gitlab-org/gitaly?badges=stars,visibility&style=plastic&format=html",
+			`<a href="https://gitlab.com/gitlab-org/gitaly"><img src="https://aegis.example.com/gitlab/stars/gitlab-org/gitaly?style=plastic" alt="stars"></a>` + "\n" +
+				`<a href="https://gitlab.com/gitlab-org/gitaly"><img src="https://aegis.example.com/gitlab/visibility/gitlab-org/gitaly?style=plastic" alt="visibility"></a>` + "\n",
+		},
+		{
+			"DefaultBadgesWithRequestHost",
+			&config.Config{},
+			"/api/snippet/bitbucket/atlassian/aui-react",
+			"[![forks](http://badges.example.com/bitbucket/forks/atlassian/aui-react)](https://bitbucket.org/atlassian/aui-react)\n" +
+				"[![branches](http://badges.example.com/bitbucket/branches/atlassian/aui-react)](https://bitbucket.org/atlassian/aui-react)\n" +
+				"[![issues](http://badges.example.com/bitbucket/issues/atlassian/aui-react)](https://bitbucket.org/atlassian/aui-react)\n" +
+				"[![pull-requests](http://badges.example.com/bitbucket/pull-requests/atlassian/aui-react)](https://bitbucket.org/atlassian/aui-react)\n" +
+				"[![tags](http://badges.example.com/bitbucket/tags/atlassian/aui-react)](https://bitbucket.org/atlassian/aui-react)\n" +
+				"[![watchers](http://badges.example.com/bitbucket/watchers/atlassian/aui-react)](https://bitbucket.org/atlassian/aui-react)\n",
+		},
+		{
+			"EscapedRepoNames",
+			&config.Config{ExternalURL: "https://aegis.example.com"},
+			"/api/snippet/gitlab/gitlab-org%2Fsub%20group/repo(1)?badges=stars",
+			"[![stars](https://aegis.example.com/gitlab/stars/gitlab-org%2Fsub%20group/repo%281%29)](https://gitlab.com/gitlab-org%2Fsub%20group/repo%281%29)\n",
+		},
+		{
+			"EscapedRepoNamesInHTML",
+			&config.Config{ExternalURL: "https://aegis.example.com"},
+			"/api/snippet/github/a&b/%22repo%22?badges=stars&format=html",
+			`<a href="https://github.com/a&amp;b/%22repo%22"><img src="https://aegis.example.com/github/stars/a&amp;b/%22repo%22" alt="stars"></a>` + "\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := runSnippetTest(t, testCase.config, testCase.path)
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, "text/plain; charset=utf-8", res.Header().Get("Content-Type"))
+			assert.Equal(t, testCase.expected, res.Body.String())
+		})
+	}
+}
+
+func TestSnippetServiceWithInvalidQuery(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{"UnsupportedProvider", "/api/snippet/sourceforge/google/gopacket", http.StatusNotFound},
+		{"UnsupportedBadge", "/api/snippet/bitbucket/atlassian/aui-react?badges=stars", http.StatusBadRequest},
+		{"UnsupportedFormat", "/api/snippet/github/google/gopacket?format=rst", http.StatusBadRequest},
+		{"UnsupportedStyle", "/api/snippet/github/google/gopacket?style=flat-square", http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := runSnippetTest(t, &config.Config{}, testCase.path)
+			assert.Equal(t, testCase.expectedStatus, res.Code)
+		})
+	}
+}
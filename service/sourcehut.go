@@ -0,0 +1,383 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const (
+	// sourcehutTodoAPIURL represents the URL of the todo.sr.ht GraphQL API
+	sourcehutTodoAPIURL = "https://todo.sr.ht/query"
+	// sourcehutListsAPIURL represents the URL of the lists.sr.ht GraphQL API
+	sourcehutListsAPIURL = "https://lists.sr.ht/query"
+	// sourcehutMaxPages represents the maximum number of pages fetched when counting tickets or patchsets, as the
+	// SourceHut GraphQL APIs don't report total counts
+	sourcehutMaxPages = 20
+
+	sourcehutTicketsQuery = `query tickets($username: String!, $tracker: String!, $cursor: Cursor) {
+	user(username: $username) {
+		tracker(name: $tracker) {
+			tickets(cursor: $cursor) { results { status } cursor }
+		}
+	}
+}`
+	sourcehutPatchesQuery = `query patches($username: String!, $list: String!, $cursor: Cursor) {
+	user(username: $username) {
+		list(name: $list) {
+			patches(cursor: $cursor) { results { status } cursor }
+		}
+	}
+}`
+)
+
+var (
+	// errSourcehutAccountNotFound represents a SourceHut user that doesn't exist
+	errSourcehutAccountNotFound = errors.New("SourceHut account not found")
+	// errSourcehutTrackerNotFound represents a todo.sr.ht tracker that doesn't exist
+	errSourcehutTrackerNotFound = errors.New("SourceHut tracker not found")
+	// errSourcehutListNotFound represents a lists.sr.ht mailing list that doesn't exist
+	errSourcehutListNotFound = errors.New("SourceHut mailing list not found")
+)
+
+// sourcehutTicketStates maps the ticket states of the request query to the ticket statuses of todo.sr.ht
+var sourcehutTicketStates = map[string][]string{
+	"open":        {"REPORTED", "CONFIRMED", "IN_PROGRESS", "PENDING"},
+	"reported":    {"REPORTED"},
+	"confirmed":   {"CONFIRMED"},
+	"in-progress": {"IN_PROGRESS"},
+	"pending":     {"PENDING"},
+	"resolved":    {"RESOLVED"},
+}
+
+// sourcehutPatchStates maps the patch states of the request query to the patchset statuses of lists.sr.ht
+var sourcehutPatchStates = map[string][]string{
+	"proposed":       {"PROPOSED"},
+	"needs-revision": {"NEEDS_REVISION"},
+	"superseded":     {"SUPERSEDED"},
+	"approved":       {"APPROVED"},
+	"rejected":       {"REJECTED"},
+	"applied":        {"APPLIED"},
+}
+
+type sourcehutService struct {
+	name        string
+	todoURL     string
+	listsURL    string
+	config      *config.Config
+	logger      *zap.Logger
+	httpClient  *http.Client
+	staleValues *staleValueCache
+	results     *resultCache
+	requests    singleflight.Group
+}
+
+// sourcehutStatusPage represents a page of tickets or patchsets, whose cursor is null on the last page
+type sourcehutStatusPage struct {
+	Results []struct {
+		Status string `json:"status"`
+	} `json:"results"`
+	Cursor *string `json:"cursor"`
+}
+
+type sourcehutQueryResponse struct {
+	Data struct {
+		User *struct {
+			Tracker *struct {
+				Tickets sourcehutStatusPage `json:"tickets"`
+			} `json:"tracker"`
+			List *struct {
+				Patches sourcehutStatusPage `json:"patches"`
+			} `json:"list"`
+		} `json:"user"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// sourcehutCount represents the number of tickets or patchsets in any of the statuses
+type sourcehutCount struct {
+	count int
+	// truncated is whether only the tickets or patchsets of the first pages were counted
+	truncated bool
+}
+
+// NewSourcehutService returns a HTTP handler for the SourceHut badge service
+func NewSourcehutService(configuration *config.Config, logger *zap.Logger) (MetricService, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("missing config dependency")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("missing logger dependency")
+	}
+
+	results, err := newResultCache(configuration, logger, "sourcehut")
+	if err != nil {
+		return nil, err
+	}
+	return &sourcehutService{
+		name:     "sourcehut",
+		todoURL:  sourcehutTodoAPIURL,
+		listsURL: sourcehutListsAPIURL,
+		config:   configuration,
+		logger:   logger,
+		httpClient: newUpstreamClient(configuration, logger, "sourcehut", &rateLimitTransport{
+			base:    &sourcehutTokenTransport{base: upstreamTransport(configuration), token: configuration.SourcehutAccessToken},
+			limiter: newRateLimiter("sourcehut"),
+		}),
+		staleValues: newStaleValueCache("sourcehut", staleValueRetention, staleValueCacheSize),
+		results:     results,
+	}, nil
+}
+
+// sourcehutTokenTransport authenticates SourceHut API calls with the personal access token as a bearer token
+type sourcehutTokenTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (transport *sourcehutTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport.token == "" {
+		return transport.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+transport.token)
+	return transport.base.RoundTrip(req)
+}
+
+// query runs the GraphQL query against the GraphQL API of the URL
+func (service *sourcehutService) query(ctx context.Context, url string, query string,
+	variables map[string]interface{}) (*sourcehutQueryResponse, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &upstreamStatusError{statusCode: resp.StatusCode}
+	}
+
+	var response sourcehutQueryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("SourceHut GraphQL API error: %s", response.Errors[0].Message)
+	}
+	return &response, nil
+}
+
+// countStatuses counts the tickets or patchsets of the pages fetched by `fetchPage` in any of the statuses, or in
+// any status if no statuses are set
+func countStatuses(ctx context.Context, statuses []string,
+	fetchPage func(cursor *string) (*sourcehutStatusPage, error)) (sourcehutCount, error) {
+	var count sourcehutCount
+	var cursor *string
+	for page := 1; ; page++ {
+		// Stop paginating as soon as the request is gone, instead of fetching the remaining pages for nothing
+		if err := ctx.Err(); err != nil {
+			return sourcehutCount{}, err
+		}
+		results, err := fetchPage(cursor)
+		if err != nil {
+			return sourcehutCount{}, err
+		}
+		for _, result := range results.Results {
+			matches := len(statuses) == 0
+			for _, status := range statuses {
+				if result.Status == status {
+					matches = true
+					break
+				}
+			}
+			if matches {
+				count.count++
+			}
+		}
+
+		if results.Cursor == nil {
+			return count, nil
+		}
+		if page == sourcehutMaxPages {
+			count.truncated = true
+			return count, nil
+		}
+		cursor = results.Cursor
+	}
+}
+
+// getTicketCount returns the number of tickets of the todo.sr.ht tracker in any of the statuses
+func (service *sourcehutService) getTicketCount(ctx context.Context, username string, tracker string,
+	statuses []string) (sourcehutCount, error) {
+	return countStatuses(ctx, statuses, func(cursor *string) (*sourcehutStatusPage, error) {
+		response, err := service.query(ctx, service.todoURL, sourcehutTicketsQuery, map[string]interface{}{
+			"username": username,
+			"tracker":  tracker,
+			"cursor":   cursor,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if response.Data.User == nil {
+			return nil, errSourcehutAccountNotFound
+		}
+		if response.Data.User.Tracker == nil {
+			return nil, errSourcehutTrackerNotFound
+		}
+		return &response.Data.User.Tracker.Tickets, nil
+	})
+}
+
+// getPatchCount returns the number of patchsets of the lists.sr.ht mailing list in any of the statuses
+func (service *sourcehutService) getPatchCount(ctx context.Context, username string, list string,
+	statuses []string) (sourcehutCount, error) {
+	return countStatuses(ctx, statuses, func(cursor *string) (*sourcehutStatusPage, error) {
+		response, err := service.query(ctx, service.listsURL, sourcehutPatchesQuery, map[string]interface{}{
+			"username": username,
+			"list":     list,
+			"cursor":   cursor,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if response.Data.User == nil {
+			return nil, errSourcehutAccountNotFound
+		}
+		if response.Data.User.List == nil {
+			return nil, errSourcehutListNotFound
+		}
+		return &response.Data.User.List.Patches, nil
+	})
+}
+
+// SupportedMetrics returns the metrics served by the service
+func (service *sourcehutService) SupportedMetrics() []string {
+	return []string{"patches", "tickets"}
+}
+
+func (service *sourcehutService) supportedQueryParams() map[string][]badgeQueryParam {
+	return map[string][]badgeQueryParam{
+		"patches": {{"state", "State of the patches (proposed, needs-revision, superseded, approved, rejected or applied), defaults to every state", "proposed"}},
+		"tickets": {{"state", "State of the tickets (open, reported, confirmed, in-progress, pending or resolved), defaults to every state", "open"}},
+	}
+}
+
+// isSourcehutFinalError returns whether the error is answered as is, without falling back on stale data
+func isSourcehutFinalError(err error) bool {
+	switch err {
+	case errSourcehutAccountNotFound, errSourcehutTrackerNotFound, errSourcehutListNotFound:
+		return true
+	}
+	return isUpstreamForbidden(err)
+}
+
+func (service *sourcehutService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBadge(w, r, service.logger, service.config, service.name, service)
+}
+
+// fetchBadge fetches the result of the badge of the metric requested, sharing upstream calls among concurrent requests
+// for the same data
+func (service *sourcehutService) fetchBadge(r *http.Request) (cachedResult, error) {
+	routeVariables := mux.Vars(r)
+	// Owners are written with a leading tilde (eg. "~sircmpwn"), which SourceHut usernames go without
+	owner, _ := url.PathUnescape(routeVariables["owner"])
+	username := strings.TrimPrefix(owner, "~")
+	repo, _ := url.PathUnescape(routeVariables["repo"])
+	method := routeVariables["method"]
+	ctx := upstreamContext(r)
+
+	var subject string
+	var fetchCount func() (interface{}, error)
+	switch method {
+	case "patches", "tickets":
+		states := sourcehutTicketStates
+		if method == "patches" {
+			states = sourcehutPatchStates
+		}
+		state := r.URL.Query().Get("state")
+		statuses, ok := states[state]
+		if state != "" && !ok {
+			return cachedResult{}, badRequestBadge
+		}
+		subject = strings.TrimSpace(strings.Replace(state, "-", " ", -1) + " " + method)
+		fetchCount = func() (interface{}, error) {
+			if method == "patches" {
+				return service.getPatchCount(ctx, username, repo, statuses)
+			}
+			return service.getTicketCount(ctx, username, repo, statuses)
+		}
+	default:
+		return cachedResult{}, notFoundBadge
+	}
+
+	fetch := resultFetch{
+		service:     service.name,
+		method:      method,
+		results:     service.results,
+		staleValues: service.staleValues,
+		key:         fetchKey(r),
+		isFinal:     isSourcehutFinalError,
+	}
+	result, err := fetchResult(r, requestLogger(service.logger, r), fetch, func() (cachedResult, error) {
+		fetched, err, _ := service.requests.Do(fetch.key, fetchCount)
+		if err != nil {
+			return cachedResult{}, err
+		}
+		count := fetched.(sourcehutCount)
+		return cachedResult{Value: count.count, Truncated: count.truncated}, nil
+	})
+
+	switch {
+	case err == errSourcehutAccountNotFound:
+		return result, accountNotFoundBadge
+	case err == errSourcehutTrackerNotFound:
+		return result, trackerNotFoundBadge
+	case err == errSourcehutListNotFound:
+		return result, mailingListNotFoundBadge
+	case isUpstreamForbidden(err):
+		// Data that is denied access to is never served, not even as stale data
+		return result, accessDeniedBadge
+	}
+	result.Subject = subject
+	return result, err
+}
+
+// badgeParams returns the parameters of the badge of the metric requested rendered from its result
+func (service *sourcehutService) badgeParams(r *http.Request, result cachedResult) (*badge.Params, error) {
+	status := formatStatus(result.Value, r.URL.Query())
+	// Counts cut short are only lower bounds
+	if result.Truncated {
+		status += "+"
+	}
+
+	badgeParams := &badge.Params{Subject: result.Subject, Status: status}
+	if err := parseColorRangesQuery(badgeParams, result.Value, r.URL.Query()); err != nil {
+		return nil, invalidQueryParameterBadge("colorRanges")
+	}
+	return badgeParams, nil
+}
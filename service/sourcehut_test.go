@@ -0,0 +1,221 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestSourcehutService returns a router serving the SourceHut badge service backed by fake SourceHut GraphQL APIs
+func newTestSourcehutService(t *testing.T, configuration *config.Config, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewSourcehutService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*sourcehutService).todoURL = fakeAPI.URL + "/todo/query"
+	service.(*sourcehutService).listsURL = fakeAPI.URL + "/lists/query"
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/sourcehut/{method}/{owner}/{repo}`, service)
+
+	return router, fakeAPI.Close
+}
+
+// sourcehutRequest represents a GraphQL query sent to a fake SourceHut GraphQL API
+type sourcehutRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// fakeSourcehutStatusPages returns a handler responding with pages of tickets (or patchsets) of the statuses, whose
+// cursors are the number of the next page
+func fakeSourcehutStatusPages(t *testing.T, field string, pages ...[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request sourcehutRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+			return
+		}
+		page := 0
+		if cursor, ok := request.Variables["cursor"].(string); ok {
+			page, _ = strconv.Atoi(cursor)
+		}
+
+		results := []map[string]string{}
+		for _, status := range pages[page] {
+			results = append(results, map[string]string{"status": status})
+		}
+		var cursor interface{}
+		if page+1 < len(pages) {
+			cursor = strconv.Itoa(page + 1)
+		}
+		container := map[string]string{"tickets": "tracker", "patches": "list"}[field]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"user": map[string]interface{}{
+					container: map[string]interface{}{
+						field: map[string]interface{}{"results": results, "cursor": cursor},
+					},
+				},
+			},
+		})
+	}
+}
+
+func TestSourcehutServiceWithTickets(t *testing.T) {
+	t.Parallel()
+
+	pages := [][]string{
+		{"REPORTED", "CONFIRMED", "RESOLVED"},
+		{"IN_PROGRESS", "PENDING", "RESOLVED", "RESOLVED"},
+	}
+	testCases := []struct {
+		name     string
+		state    string
+		expected *badge.Params
+	}{
+		{"AllStates", "", &badge.Params{Subject: "tickets", Status: "7"}},
+		{"Open", "open", &badge.Params{Subject: "open tickets", Status: "4"}},
+		{"Resolved", "resolved", &badge.Params{Subject: "resolved tickets", Status: "3"}},
+		{"InProgress", "in-progress", &badge.Params{Subject: "in progress tickets", Status: "1"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestSourcehutService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/todo/query", r.URL.Path)
+				assert.Equal(t, "POST", r.Method)
+				fakeSourcehutStatusPages(t, "tickets", pages...)(w, r)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/sourcehut/tickets/~sircmpwn/sr.ht?state="+testCase.state, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, createBadge(testCase.expected), res.Body.String())
+		})
+	}
+}
+
+func TestSourcehutServiceWithPatches(t *testing.T) {
+	t.Parallel()
+
+	var variables map[string]interface{}
+	router, cleanup := newTestSourcehutService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/lists/query", r.URL.Path)
+		body, _ := ioutil.ReadAll(r.Body)
+		var request sourcehutRequest
+		json.Unmarshal(body, &request)
+		variables = request.Variables
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		fakeSourcehutStatusPages(t, "patches", []string{"PROPOSED", "APPLIED", "APPLIED"})(w, r)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/sourcehut/patches/%7Esircmpwn/sr.ht-dev?state=applied", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, createBadge(&badge.Params{Subject: "applied patches", Status: "2"}), res.Body.String())
+	assert.Equal(t, "sircmpwn", variables["username"])
+	assert.Equal(t, "sr.ht-dev", variables["list"])
+}
+
+func TestSourcehutServiceWithTruncatedCount(t *testing.T) {
+	t.Parallel()
+
+	pages := make([][]string, sourcehutMaxPages+1)
+	for i := range pages {
+		pages[i] = []string{"REPORTED"}
+	}
+	router, cleanup := newTestSourcehutService(t, &config.Config{}, fakeSourcehutStatusPages(t, "tickets", pages...))
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/sourcehut/tickets/~sircmpwn/sr.ht", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "tickets", Status: fmt.Sprintf("%d+", sourcehutMaxPages)}), res.Body.String())
+}
+
+func TestSourcehutServiceWithNotFound(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		response string
+		expected string
+	}{
+		{"Account", "/sourcehut/tickets/~nobody/sr.ht", `{"data":{"user":null}}`, "account not found"},
+		{"Tracker", "/sourcehut/tickets/~sircmpwn/nothing", `{"data":{"user":{"tracker":null}}}`, "tracker not found"},
+		{"List", "/sourcehut/patches/~sircmpwn/nothing", `{"data":{"user":{"list":null}}}`, "list not found"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router, cleanup := newTestSourcehutService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(testCase.response))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", testCase.url, nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusNotFound, res.Code)
+			assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: testCase.expected}), res.Body.String())
+		})
+	}
+}
+
+func TestSourcehutServiceWithAccessToken(t *testing.T) {
+	t.Parallel()
+
+	var authorization string
+	router, cleanup := newTestSourcehutService(t, &config.Config{SourcehutAccessToken: "secret"}, func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		fakeSourcehutStatusPages(t, "tickets", []string{"REPORTED"})(w, r)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/sourcehut/tickets/~sircmpwn/sr.ht", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "tickets", Status: "1"}), res.Body.String())
+	assert.Equal(t, "Bearer secret", authorization)
+}
+
+func TestSourcehutServiceWithUnsupportedState(t *testing.T) {
+	t.Parallel()
+
+	router, cleanup := newTestSourcehutService(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected SourceHut API call: %s", r.URL)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/sourcehut/patches/~sircmpwn/sr.ht-dev?state=open", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// staleHeader represents the response header marking badges rendered from stale data
+	staleHeader = "X-Aegis-Stale"
+	// staleValueRetention represents how long the last successfully fetched data is kept for
+	staleValueRetention = 24 * time.Hour
+	// staleValueCacheSize represents the maximum number of badges whose last successfully fetched data is kept, the
+	// least recently used badges are evicted beyond
+	staleValueCacheSize = 16384
+	// staleValueSweepInterval represents how often the data kept beyond the retention period is removed, as the data
+	// of badges that are no longer requested is otherwise never read again
+	staleValueSweepInterval = time.Hour
+)
+
+// staleValue represents the last successfully fetched data of a badge
+type staleValue struct {
+	value     int
+	truncated bool
+	subject   string
+	status    string
+	color     string
+	segments  []cachedSegment
+	fetchedAt time.Time
+}
+
+// staleValueOf returns the stale data of the result of a badge
+func staleValueOf(result cachedResult) staleValue {
+	return staleValue{value: result.Value, truncated: result.Truncated, subject: result.Subject, status: result.Status, color: result.Color,
+		segments: result.Segments}
+}
+
+// staleEntry represents the last successfully fetched data of a badge, in the order of use of the cache
+type staleEntry struct {
+	key   string
+	value staleValue
+}
+
+// staleValueCache keeps the last successfully fetched data of each badge, so that badges can still be
+// rendered while the upstream API is unavailable
+type staleValueCache struct {
+	mu        sync.Mutex
+	provider  string
+	retention time.Duration
+	size      int
+	values    map[string]*list.Element
+	// order holds the entries of the cache from the most to the least recently used
+	order   *list.List
+	sweptAt time.Time
+	now     func() time.Time
+}
+
+func newStaleValueCache(provider string, retention time.Duration, size int) *staleValueCache {
+	return &staleValueCache{
+		provider:  provider,
+		retention: retention,
+		size:      size,
+		values:    map[string]*list.Element{},
+		order:     list.New(),
+		now:       time.Now,
+	}
+}
+
+// set keeps the successfully fetched data of the badge, evicting the least recently used badges beyond the size of
+// the cache
+func (cache *staleValueCache) set(key string, value staleValue) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := cache.now()
+	if now.Sub(cache.sweptAt) >= staleValueSweepInterval {
+		cache.sweep(now)
+	}
+
+	value.fetchedAt = now
+	if element, ok := cache.values[key]; ok {
+		element.Value.(*staleEntry).value = value
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.values[key] = cache.order.PushFront(&staleEntry{key: key, value: value})
+	for len(cache.values) > cache.size {
+		cache.remove(cache.order.Back())
+	}
+}
+
+// get returns the last successfully fetched data of the badge, if fetched within the retention period
+func (cache *staleValueCache) get(ctx context.Context, key string) (staleValue, bool) {
+	span := startCacheLookupSpan(ctx, cache.provider, "stale")
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, ok := cache.values[key]
+	if ok && cache.now().Sub(element.Value.(*staleEntry).value.fetchedAt) > cache.retention {
+		cache.remove(element)
+		ok = false
+	}
+	if !ok {
+		cacheLookupsTotal.WithLabelValues(cache.provider, "stale", "miss").Inc()
+		endCacheLookupSpan(span, "miss")
+		return staleValue{}, false
+	}
+
+	cache.order.MoveToFront(element)
+	cacheLookupsTotal.WithLabelValues(cache.provider, "stale", "hit").Inc()
+	endCacheLookupSpan(span, "hit")
+	return element.Value.(*staleEntry).value, true
+}
+
+// purge removes the data of the badges whose keys match, returning the number of badges removed
+func (cache *staleValueCache) purge(match func(key string) bool) int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	purged := 0
+	for key, element := range cache.values {
+		if match(key) {
+			cache.remove(element)
+			purged++
+		}
+	}
+	return purged
+}
+
+// sweep removes the data of the badges fetched beyond the retention period, from the least recently used badges
+func (cache *staleValueCache) sweep(now time.Time) {
+	for element := cache.order.Back(); element != nil; {
+		previous := element.Prev()
+		if now.Sub(element.Value.(*staleEntry).value.fetchedAt) > cache.retention {
+			cache.remove(element)
+		}
+		element = previous
+	}
+	cache.sweptAt = now
+}
+
+// remove removes the entry of the cache
+func (cache *staleValueCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.values, element.Value.(*staleEntry).key)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleValueCache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	cache := newStaleValueCache("github", time.Hour, staleValueCacheSize)
+	cache.now = func() time.Time { return now }
+
+	_, ok := cache.get(context.Background(), "stars/google/gopacket?")
+	assert.False(t, ok)
+
+	cache.set("stars/google/gopacket?", staleValue{value: 42})
+	cache.now = func() time.Time { return now.Add(time.Hour) }
+	value, ok := cache.get(context.Background(), "stars/google/gopacket?")
+	assert.True(t, ok)
+	assert.Equal(t, staleValue{value: 42, fetchedAt: now}, value)
+
+	cache.now = func() time.Time { return now.Add(time.Hour + time.Second) }
+	_, ok = cache.get(context.Background(), "stars/google/gopacket?")
+	assert.False(t, ok)
+	assert.Empty(t, cache.values)
+}
+
+func TestStaleValueCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	cache := newStaleValueCache("github", time.Hour, 2)
+	cache.set("stars/google/gopacket?", staleValue{value: 1})
+	cache.set("stars/golang/go?", staleValue{value: 2})
+
+	// reading a badge keeps it over badges read less recently
+	_, ok := cache.get(context.Background(), "stars/google/gopacket?")
+	assert.True(t, ok)
+	cache.set("stars/kubernetes/kubernetes?", staleValue{value: 3})
+
+	assert.ElementsMatch(t, []string{"stars/google/gopacket?", "stars/kubernetes/kubernetes?"}, staleKeys(cache))
+	_, ok = cache.get(context.Background(), "stars/golang/go?")
+	assert.False(t, ok)
+
+	// updating a badge doesn't evict any other badge
+	cache.set("stars/google/gopacket?", staleValue{value: 4})
+	assert.Len(t, cache.values, 2)
+	assert.Equal(t, 2, cache.order.Len())
+}
+
+func TestStaleValueCacheSweepsExpiredValues(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	cache := newStaleValueCache("github", 30*time.Minute, staleValueCacheSize)
+	cache.now = func() time.Time { return now }
+	cache.set("stars/google/gopacket?", staleValue{value: 1})
+	cache.set("stars/golang/go?", staleValue{value: 2})
+
+	// expired badges are kept until the next sweep, even if they're never read again
+	cache.now = func() time.Time { return now.Add(staleValueSweepInterval - time.Second) }
+	cache.set("stars/kubernetes/kubernetes?", staleValue{value: 3})
+	assert.Len(t, cache.values, 3)
+
+	cache.now = func() time.Time { return now.Add(staleValueSweepInterval + time.Second) }
+	cache.set("forks/kubernetes/kubernetes?", staleValue{value: 4})
+	assert.ElementsMatch(t, []string{"stars/kubernetes/kubernetes?", "forks/kubernetes/kubernetes?"}, staleKeys(cache))
+	assert.Equal(t, 2, cache.order.Len())
+}
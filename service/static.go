@@ -3,7 +3,10 @@ package service
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 
 	"github.com/tohjustin/aegis/pkg/badge"
@@ -33,32 +36,66 @@ func NewStaticService(configuration *config.Config,
 	}, nil
 }
 
-func (service *staticService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	generatedBadge, err := badge.Create(&badge.Params{
-		Style:   badge.Style(r.URL.Query().Get("style")),
-		Subject: r.URL.Query().Get("subject"),
-		Status:  r.URL.Query().Get("status"),
-		Color:   r.URL.Query().Get("color"),
-		Icon:    r.URL.Query().Get("icon"),
-	})
+// unescapeStaticPathSegment returns the text of a path segment of a static badge, dashes are escaped as `--` for
+// compatibility with shields.io badge URLs
+func unescapeStaticPathSegment(segment string) string {
+	text, err := url.PathUnescape(segment)
 	if err != nil {
-		service.logger.Error("Failed to create badge",
+		text = segment
+	}
+	return strings.Replace(text, "--", "-", -1)
+}
+
+func (service *staticService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(service.logger, r)
+	badgeParams := &badge.Params{}
+	// Badge texts set in the path (ie. `/static/{subject}/{status}/{color}`) are overridden by the request query
+	routeVariables := mux.Vars(r)
+	if status, ok := routeVariables["status"]; ok {
+		badgeParams.Subject = unescapeStaticPathSegment(routeVariables["subject"])
+		badgeParams.Status = unescapeStaticPathSegment(status)
+		badgeParams.Color = "blue"
+		if color := routeVariables["color"]; color != "" {
+			badgeParams.Color = unescapeStaticPathSegment(color)
+			if err := validateColor(badgeParams.Color); err != nil {
+				logger.Info("Invalid badge color",
+					zap.String("url", r.URL.RequestURI()),
+					zap.String("service", service.name),
+					zap.Error(err))
+				if err := badRequest(w, service.config); err != nil {
+					logger.Error("Failed to create error badge",
+						zap.String("url", r.URL.RequestURI()),
+						zap.String("service", service.name),
+						zap.Error(err))
+				}
+				return
+			}
+		}
+	}
+	if err := parseBadgeQuery(service.config, badgeParams, r.URL.Query()); err != nil {
+		logger.Info("Invalid badge query",
+			zap.String("url", r.URL.RequestURI()),
 			zap.String("service", service.name),
 			zap.Error(err))
-		if err := internalServerError(w, service.config); err != nil {
-			service.logger.Error("Failed to create error badge",
+		if err := invalidBadgeQuery(w, service.config, err); err != nil {
+			logger.Error("Failed to create error response",
 				zap.String("url", r.URL.RequestURI()),
 				zap.String("service", service.name),
 				zap.Error(err))
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	if !service.config.ExcludeCacheControlHeaders {
-		// cache response in browser for 1 hour (3600), CDN for 1 hour (3600)
-		w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=3600")
+	if err := writeStaticBadge(w, r, service.config, r.URL.Query(), badgeParams); err != nil {
+		logger.Error("Failed to create badge",
+			zap.String("service", service.name),
+			zap.Error(err))
+		if err := internalServerError(w, service.config); err != nil {
+			logger.Error("Failed to create error badge",
+				zap.String("url", r.URL.RequestURI()),
+				zap.String("service", service.name),
+				zap.Error(err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
 	}
-	w.Header().Set("Content-Type", "image/svg+xml;utf-8")
-	w.Write([]byte(generatedBadge))
 }
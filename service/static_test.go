@@ -1,10 +1,19 @@
 package service
 
 import (
+	"encoding/xml"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
 	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
 )
 
 func createBadge(params *badge.Params) string {
@@ -54,31 +63,59 @@ func TestStaticBadgeServiceWithCSSColorName(t *testing.T) {
 	})
 }
 
-func TestStaticBadgeServiceWithNoColor(t *testing.T) {
+func TestStaticBadgeServiceWithColorAlias(t *testing.T) {
+	t.Parallel()
+
+	for _, colorAlias := range []string{"brightgreen", "success", "critical", "informational"} {
+		runHTTPTest(t, httpTestCase{
+			requestMethod: "GET",
+			requestPath:   "/static?subject=testSubject&status=testStatus&color=" + colorAlias,
+			expectedHeaders: map[string]string{
+				"Cache-Control": "public, max-age=3600, s-maxage=3600",
+				"Content-Type":  "image/svg+xml;utf-8",
+			},
+			expectedStatus: 200,
+			expectedBody: createBadge(&badge.Params{
+				Subject: "testSubject",
+				Status:  "testStatus",
+				Color:   colorAlias,
+			}),
+		})
+	}
+}
+
+func TestStaticBadgeServiceWithLabelColor(t *testing.T) {
 	t.Parallel()
 
 	runHTTPTest(t, httpTestCase{
 		requestMethod: "GET",
-		requestPath:   "/static?subject=testSubject&status=testStatus",
+		requestPath:   "/static?subject=testSubject&status=testStatus&labelColor=ffff00",
 		expectedHeaders: map[string]string{
 			"Cache-Control": "public, max-age=3600, s-maxage=3600",
 			"Content-Type":  "image/svg+xml;utf-8",
 		},
 		expectedStatus: 200,
 		expectedBody: createBadge(&badge.Params{
-			Subject: "testSubject",
-			Status:  "testStatus",
-			Color:   badge.DefaultColor,
+			Subject:    "testSubject",
+			Status:     "testStatus",
+			LabelColor: "ffff00",
 		}),
 	})
+	runHTTPTest(t, httpTestCase{
+		requestMethod:   "GET",
+		requestPath:     "/static?subject=testSubject&status=testStatus&labelColor=ff00",
+		expectedHeaders: map[string]string{"Cache-Control": "no-store", "Content-Type": "application/json"},
+		expectedStatus:  400,
+		expectedBody:    `{"parameter":"labelColor","error":"invalid color"}`,
+	})
 }
 
-func TestStaticBadgeServiceWithBadColor(t *testing.T) {
+func TestStaticBadgeServiceWithNoColor(t *testing.T) {
 	t.Parallel()
 
 	runHTTPTest(t, httpTestCase{
 		requestMethod: "GET",
-		requestPath:   "/static?subject=testSubject&status=testStatus&color=badColor",
+		requestPath:   "/static?subject=testSubject&status=testStatus",
 		expectedHeaders: map[string]string{
 			"Cache-Control": "public, max-age=3600, s-maxage=3600",
 			"Content-Type":  "image/svg+xml;utf-8",
@@ -92,6 +129,23 @@ func TestStaticBadgeServiceWithBadColor(t *testing.T) {
 	})
 }
 
+func TestStaticBadgeServiceWithBadColor(t *testing.T) {
+	t.Parallel()
+
+	for _, badColor := range []string{"badColor", "%23zzz", "%23f7b137aa", "ff00"} {
+		runHTTPTest(t, httpTestCase{
+			requestMethod: "GET",
+			requestPath:   "/static?subject=testSubject&status=testStatus&color=" + badColor,
+			expectedHeaders: map[string]string{
+				"Cache-Control": "no-store",
+				"Content-Type":  "application/json",
+			},
+			expectedStatus: 400,
+			expectedBody:   `{"parameter":"color","error":"invalid color"}`,
+		})
+	}
+}
+
 func TestStaticBadgeServiceWithIconQuery(t *testing.T) {
 	t.Parallel()
 
@@ -111,6 +165,82 @@ func TestStaticBadgeServiceWithIconQuery(t *testing.T) {
 	})
 }
 
+func TestStaticBadgeServiceWithIconOptionsQuery(t *testing.T) {
+	t.Parallel()
+
+	runHTTPTest(t, httpTestCase{
+		requestMethod: "GET",
+		requestPath:   "/static?subject=testSubject&status=testStatus&icon=brands/docker&iconColor=2496ed&iconSize=16",
+		expectedHeaders: map[string]string{
+			"Cache-Control": "public, max-age=3600, s-maxage=3600",
+			"Content-Type":  "image/svg+xml;utf-8",
+		},
+		expectedStatus: 200,
+		expectedBody: createBadge(&badge.Params{
+			Subject:   "testSubject",
+			Status:    "testStatus",
+			Icon:      "brands/docker",
+			IconColor: "2496ed",
+			IconSize:  16,
+		}),
+	})
+}
+
+func TestStaticBadgeServiceWithLogoQuery(t *testing.T) {
+	t.Parallel()
+
+	logo := "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+	runHTTPTest(t, httpTestCase{
+		requestMethod: "GET",
+		requestPath:   "/static?" + url.Values{"subject": {"testSubject"}, "status": {"testStatus"}, "logo": {logo}, "logoWidth": {"20"}}.Encode(),
+		expectedHeaders: map[string]string{
+			"Cache-Control": "public, max-age=3600, s-maxage=3600",
+			"Content-Type":  "image/svg+xml;utf-8",
+		},
+		expectedStatus: 200,
+		expectedBody: createBadge(&badge.Params{
+			Subject:   "testSubject",
+			Status:    "testStatus",
+			Logo:      logo,
+			LogoWidth: 20,
+		}),
+	})
+}
+
+func TestStaticBadgeServiceWithLinkQuery(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		links []string
+	}{
+		{"NoLink", nil},
+		{"Link", []string{"https://github.com/tohjustin/aegis"}},
+		{"Links", []string{"https://github.com/tohjustin/aegis", "https://github.com/tohjustin/aegis/releases"}},
+		{"UnsafeLink", []string{"javascript:alert(1)", "https://github.com/tohjustin/aegis/releases"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			query := url.Values{"subject": {"testSubject"}, "status": {"testStatus"}, "link": testCase.links}
+			runHTTPTest(t, httpTestCase{
+				requestMethod: "GET",
+				requestPath:   "/static?" + query.Encode(),
+				expectedHeaders: map[string]string{
+					"Cache-Control": "public, max-age=3600, s-maxage=3600",
+					"Content-Type":  "image/svg+xml;utf-8",
+				},
+				expectedStatus: 200,
+				expectedBody: createBadge(&badge.Params{
+					Subject: "testSubject",
+					Status:  "testStatus",
+					Links:   testCase.links,
+				}),
+			})
+		})
+	}
+}
+
 func TestStaticBadgeServiceWithBadIconQuery(t *testing.T) {
 	t.Parallel()
 
@@ -148,25 +278,107 @@ func TestStaticBadgeServiceWithStyleQuery(t *testing.T) {
 	})
 }
 
-func TestStaticBadgeServiceWithBadStyleQuery(t *testing.T) {
+func TestStaticBadgeServiceWithTruncationQuery(t *testing.T) {
 	t.Parallel()
 
 	runHTTPTest(t, httpTestCase{
 		requestMethod: "GET",
-		requestPath:   "/static?subject=testSubject&status=testStatus&style=badStyle",
+		requestPath:   "/static?subject=description&status=Packet%20decoding%20for%20the%20Go%20language&truncate=16&maxWidth=150",
 		expectedHeaders: map[string]string{
-			"Cache-Control": "public, max-age=3600, s-maxage=3600",
-			"Content-Type":  "image/svg+xml;utf-8",
+			"Content-Type": "image/svg+xml;utf-8",
 		},
 		expectedStatus: 200,
 		expectedBody: createBadge(&badge.Params{
-			Style:   badge.DefaultStyle,
-			Subject: "testSubject",
-			Status:  "testStatus",
+			Subject:  "description",
+			Status:   "Packet decoding…",
+			Truncate: 16,
+			MaxWidth: 150,
+		}),
+	})
+}
+
+func TestStaticBadgeServiceWithDirectionQuery(t *testing.T) {
+	t.Parallel()
+
+	runHTTPTest(t, httpTestCase{
+		requestMethod: "GET",
+		requestPath:   "/static?subject=%D7%92%D7%A8%D7%A1%D7%94&status=1.2.0&direction=rtl",
+		expectedHeaders: map[string]string{
+			"Content-Type": "image/svg+xml;utf-8",
+		},
+		expectedStatus: 200,
+		expectedBody: createBadge(&badge.Params{
+			Subject:   "גרסה",
+			Status:    "1.2.0",
+			Direction: badge.RightToLeft,
 		}),
 	})
 }
 
+func TestStaticBadgeServiceWithBadQuery(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		query        url.Values
+		expectedBody string
+	}{
+		{"Color", url.Values{"color": {"#zzz"}}, `{"parameter":"color","error":"invalid color"}`},
+		{"FourDigitHexColor", url.Values{"color": {"#f7b1"}}, `{"parameter":"color","error":"invalid color"}`},
+		{"UnknownColorName", url.Values{"color": {"notacolor"}}, `{"parameter":"color","error":"invalid color"}`},
+		{"LabelColor", url.Values{"labelColor": {"12345"}}, `{"parameter":"labelColor","error":"invalid color"}`},
+		{"Style", url.Values{"style": {"badStyle"}}, `{"parameter":"style","error":"unsupported style"}`},
+		{"StyleCase", url.Values{"style": {"Flat"}}, `{"parameter":"style","error":"unsupported style"}`},
+		{"LongSubject", url.Values{"subject": {strings.Repeat("a", badge.MaxTextLength+1)}}, `{"parameter":"subject","error":"longer than 200 characters"}`},
+		{"LongStatus", url.Values{"status": {strings.Repeat("状", badge.MaxTextLength+1)}}, `{"parameter":"status","error":"longer than 200 characters"}`},
+		{"IconColor", url.Values{"iconColor": {"#12"}}, `{"parameter":"iconColor","error":"invalid color"}`},
+		{"IconSizeNotInteger", url.Values{"iconSize": {"big"}}, `{"parameter":"iconSize","error":"not between 8 and 18"}`},
+		{"IconSizeTooSmall", url.Values{"iconSize": {"7"}}, `{"parameter":"iconSize","error":"not between 8 and 18"}`},
+		{"IconSizeTooLarge", url.Values{"iconSize": {"19"}}, `{"parameter":"iconSize","error":"not between 8 and 18"}`},
+		{"Logo", url.Values{"logo": {svgDataURI(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)}}, `{"parameter":"logo","error":"unsafe SVG image"}`},
+		{"OversizedLogo", url.Values{"logo": {"data:image/png;base64," + strings.Repeat("A", 8192)}}, `{"parameter":"logo","error":"larger than 8192 bytes"}`},
+		{"LogoWidth", url.Values{"logoWidth": {"0"}}, `{"parameter":"logoWidth","error":"not between 1 and 100"}`},
+		{"Direction", url.Values{"direction": {"ttb"}}, `{"parameter":"direction","error":"unsupported direction"}`},
+		{"TruncateNotInteger", url.Values{"truncate": {"short"}}, `{"parameter":"truncate","error":"not a positive integer"}`},
+		{"TruncateZero", url.Values{"truncate": {"0"}}, `{"parameter":"truncate","error":"not a positive integer"}`},
+		{"MaxWidthNegative", url.Values{"maxWidth": {"-100"}}, `{"parameter":"maxWidth","error":"not a positive integer"}`},
+		{"TooManyLinks", url.Values{"link": {"https://a.example", "https://b.example", "https://c.example"}}, `{"parameter":"link","error":"more than 2 links"}`},
+		{"LongIcon", url.Values{"icon": {strings.Repeat("a", maxIconNameLength+1)}}, `{"parameter":"icon","error":"longer than 64 characters"}`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			runHTTPTest(t, httpTestCase{
+				requestMethod: "GET",
+				requestPath:   "/static?" + testCase.query.Encode(),
+				expectedHeaders: map[string]string{
+					"Cache-Control": "no-store",
+					"Content-Type":  "application/json",
+				},
+				expectedStatus: 400,
+				expectedBody:   testCase.expectedBody,
+			})
+		})
+	}
+}
+
+func TestStaticBadgeServiceWithLongestQuery(t *testing.T) {
+	t.Parallel()
+
+	text := strings.Repeat("a", badge.MaxTextLength)
+	icon := strings.Repeat("a", maxIconNameLength)
+	runHTTPTest(t, httpTestCase{
+		requestMethod: "GET",
+		requestPath:   "/static?" + url.Values{"subject": {text}, "status": {text}, "icon": {icon}}.Encode(),
+		expectedHeaders: map[string]string{
+			"Cache-Control": "public, max-age=3600, s-maxage=3600",
+			"Content-Type":  "image/svg+xml;utf-8",
+		},
+		expectedStatus: 200,
+		expectedBody:   createBadge(&badge.Params{Subject: text, Status: text, Icon: icon}),
+	})
+}
+
 func TestStaticBadgeServiceWithBadHTTPMethods(t *testing.T) {
 	t.Parallel()
 
@@ -191,3 +403,202 @@ func TestStaticBadgeServiceWithBadHTTPMethods(t *testing.T) {
 		})
 	}
 }
+
+func TestStaticBadgeServiceWithUnsafeText(t *testing.T) {
+	t.Parallel()
+
+	staticService, err := NewStaticService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsafeTexts := []string{
+		`"><script>alert(1)</script>`,
+		`</text><foreignObject><iframe src="javascript:alert(1)"/></foreignObject>`,
+		"a & b < c",
+		`'single' "double"`,
+		"🚀 ビルド",
+		strings.Repeat("<", badge.MaxTextLength),
+	}
+	for _, unsafeText := range unsafeTexts {
+		res := httptest.NewRecorder()
+		query := url.Values{"subject": {unsafeText}, "status": {unsafeText}}
+		req, _ := http.NewRequest("GET", "/static?"+query.Encode(), nil)
+		staticService.ServeHTTP(res, req)
+
+		body := res.Body.String()
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.NoError(t, xml.Unmarshal([]byte(body), new(struct{})))
+		assert.NotContains(t, body, "<script")
+		assert.NotContains(t, body, "<foreignObject")
+		assert.NotContains(t, body, "<iframe")
+		params, err := badge.ExtractParams(body)
+		if assert.NoError(t, err) && len([]rune(unsafeText)) <= badge.MaxTextLength {
+			assert.Equal(t, unsafeText, params.Subject)
+			assert.Equal(t, unsafeText, params.Status)
+		}
+	}
+}
+
+func TestStaticBadgeServiceWithCacheSeconds(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                 string
+		query                string
+		expectedCacheControl string
+	}{
+		{"Default", "", "public, max-age=3600, s-maxage=3600"},
+		{"Custom", "&cacheSeconds=600", "public, max-age=600, s-maxage=600"},
+		{"BelowMinimum", "&cacheSeconds=60", "public, max-age=300, s-maxage=300"},
+		{"AboveMaximum", "&cacheSeconds=604800", "public, max-age=86400, s-maxage=86400"},
+		{"Negative", "&cacheSeconds=-1", "public, max-age=300, s-maxage=300"},
+		{"NonNumeric", "&cacheSeconds=abc", "public, max-age=3600, s-maxage=3600"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			runHTTPTest(t, httpTestCase{
+				requestMethod: "GET",
+				requestPath:   "/static?subject=testSubject&status=testStatus" + testCase.query,
+				expectedHeaders: map[string]string{
+					"Cache-Control": testCase.expectedCacheControl,
+					"Content-Type":  "image/svg+xml;utf-8",
+				},
+				expectedStatus: 200,
+				expectedBody: createBadge(&badge.Params{
+					Subject: "testSubject",
+					Status:  "testStatus",
+				}),
+			})
+		})
+	}
+}
+
+func TestStaticBadgeServiceWithConditionalRequest(t *testing.T) {
+	t.Parallel()
+
+	staticService, err := NewStaticService(&config.Config{CacheSeconds: 3600, MinCacheSeconds: 300, MaxCacheSeconds: 86400}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(path string, ifNoneMatch string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		staticService.ServeHTTP(res, req)
+		return res
+	}
+
+	res := request("/static?subject=stars&status=1234", "")
+	etag := res.Header().Get("ETag")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Regexp(t, `^"[0-9a-f]{64}"$`, etag)
+
+	testCases := []struct {
+		name           string
+		path           string
+		ifNoneMatch    string
+		expectedStatus int
+		expectedETag   bool
+	}{
+		{"Match", "/static?subject=stars&status=1234", etag, http.StatusNotModified, true},
+		{"WeakMatch", "/static?subject=stars&status=1234", "W/" + etag, http.StatusNotModified, true},
+		{"ListMatch", "/static?subject=stars&status=1234", `"0", ` + etag, http.StatusNotModified, true},
+		{"Wildcard", "/static?subject=stars&status=1234", "*", http.StatusNotModified, true},
+		{"NoMatch", "/static?subject=stars&status=1234", `"0"`, http.StatusOK, true},
+		{"ChangedStatus", "/static?subject=stars&status=1235", etag, http.StatusOK, false},
+		{"ChangedStyle", "/static?subject=stars&status=1234&style=flat", etag, http.StatusOK, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			res := request(testCase.path+"&cacheSeconds=600", testCase.ifNoneMatch)
+
+			assert.Equal(t, testCase.expectedStatus, res.Code)
+			assert.Equal(t, "public, max-age=600, s-maxage=600", res.Header().Get("Cache-Control"))
+			assert.Equal(t, testCase.expectedETag, etag == res.Header().Get("ETag"))
+			if testCase.expectedStatus == http.StatusNotModified {
+				assert.Empty(t, res.Body.String())
+				assert.Empty(t, res.Header().Get("Content-Length"))
+			} else {
+				assert.NotEmpty(t, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestStaticBadgeServiceWithSizeHeaders(t *testing.T) {
+	t.Parallel()
+
+	staticService, err := NewStaticService(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, style := range badge.SupportedStyles {
+		for _, icon := range []string{"", "brands/docker"} {
+			res := httptest.NewRecorder()
+			query := url.Values{"subject": {"testSubject"}, "status": {"testStatus"}, "style": {string(style)}, "icon": {icon}}
+			req, _ := http.NewRequest("GET", "/static?"+query.Encode(), nil)
+			staticService.ServeHTTP(res, req)
+
+			var root struct {
+				Width  string `xml:"width,attr"`
+				Height string `xml:"height,attr"`
+			}
+			if err := xml.Unmarshal(res.Body.Bytes(), &root); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, root.Width, res.Header().Get(badgeWidthHeader), "style %q, icon %q", style, icon)
+			assert.Equal(t, root.Height, res.Header().Get(badgeHeightHeader), "style %q, icon %q", style, icon)
+			assert.Equal(t, strconv.Itoa(res.Body.Len()), res.Header().Get("Content-Length"), "style %q, icon %q", style, icon)
+		}
+	}
+}
+
+func TestStaticBadgeServiceWithPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		path     string
+		expected *badge.Params
+	}{
+		{"DefaultColor", "/static/release/v2.0.0", &badge.Params{Subject: "release", Status: "v2.0.0", Color: "blue"}},
+		{"Color", "/static/build/passing/brightgreen", &badge.Params{Subject: "build", Status: "passing", Color: "brightgreen"}},
+		{"HexColor", "/static/build/passing/ff0000", &badge.Params{Subject: "build", Status: "passing", Color: "ff0000"}},
+		{"EncodedSpaces", "/static/code%20style/black", &badge.Params{Subject: "code style", Status: "black", Color: "blue"}},
+		{"EscapedDashes", "/static/pre--commit/enabled", &badge.Params{Subject: "pre-commit", Status: "enabled", Color: "blue"}},
+		{"EncodedSlashes", "/static/ci%2Fcd/main%2Fstable", &badge.Params{Subject: "ci/cd", Status: "main/stable", Color: "blue"}},
+		{"QueryOverrides", "/static/build/passing/green?subject=ci&color=red", &badge.Params{Subject: "ci", Status: "passing", Color: "red"}},
+		{"QueryStyle", "/static/build/passing?style=flat", &badge.Params{Subject: "build", Status: "passing", Color: "blue", Style: badge.Style("flat")}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			runHTTPTest(t, httpTestCase{
+				requestMethod:  "GET",
+				requestPath:    testCase.path,
+				expectedStatus: 200,
+				expectedBody:   createBadge(testCase.expected),
+			})
+		})
+	}
+}
+
+func TestStaticBadgeServiceWithBadPathColor(t *testing.T) {
+	t.Parallel()
+
+	runHTTPTest(t, httpTestCase{
+		requestMethod:  "GET",
+		requestPath:    "/static/build/passing/%23ggg",
+		expectedStatus: 400,
+		expectedBody: createBadge(&badge.Params{
+			Subject: "aegis",
+			Status:  "bad request",
+		}),
+	})
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit resources of the GitHub API, each with a rate limit quota of its own
+const (
+	githubCoreResource    = "core"
+	githubGraphQLResource = "graphql"
+	githubSearchResource  = "search"
+)
+
+// errGithubTokensExhausted represents an upstream API call made while every GitHub access token is rate limited
+var errGithubTokensExhausted = fmt.Errorf("every GitHub access token is rate limited: %w", errUpstreamRateLimited)
+
+// githubQuota represents a rate limit quota of a GitHub access token as last reported by the GitHub API
+type githubQuota struct {
+	remaining int
+	resetAt   time.Time
+}
+
+// githubToken represents a GitHub access token & its rate limit quotas, by rate limit resource (eg. `core` for the
+// REST API or `graphql` for the GraphQL API)
+type githubToken struct {
+	label  string
+	value  string
+	quotas map[string]githubQuota
+}
+
+// isExhausted returns whether the token exhausted the rate limit quota of the resource, until its rate limit resets
+func (token *githubToken) isExhausted(resource string, now time.Time) bool {
+	quota, ok := token.quotas[resource]
+	return ok && quota.remaining == 0 && now.Before(quota.resetAt)
+}
+
+// githubRateLimitResource returns the rate limit resource of the GitHub API call, as reported by the
+// `X-RateLimit-Resource` header of its response if any, or as inferred from the API endpoint called otherwise
+func githubRateLimitResource(req *http.Request, resp *http.Response) string {
+	if resp != nil {
+		if resource := resp.Header.Get("X-RateLimit-Resource"); resource != "" {
+			return resource
+		}
+	}
+	switch path := req.URL.Path; {
+	case strings.HasSuffix(path, "/graphql"):
+		return githubGraphQLResource
+	case strings.Contains(path, "/search/"):
+		return githubSearchResource
+	default:
+		return githubCoreResource
+	}
+}
+
+// githubTokenPool rotates upstream API calls across GitHub access tokens in a round-robin fashion, skipping tokens
+// that exhausted the rate limit of the resource called until their rate limit resets
+type githubTokenPool struct {
+	mu                   sync.Mutex
+	tokens               []*githubToken
+	next                 int
+	allowUnauthenticated bool
+	unauthenticated      *githubToken
+	now                  func() time.Time
+}
+
+func newGithubTokenPool(tokens []string, allowUnauthenticated bool) *githubTokenPool {
+	pool := &githubTokenPool{
+		allowUnauthenticated: allowUnauthenticated,
+		unauthenticated:      &githubToken{label: "unauthenticated", quotas: map[string]githubQuota{}},
+		now:                  time.Now,
+	}
+	for i, token := range tokens {
+		// tokens are labelled by their position, so that they never leak into metrics
+		pool.tokens = append(pool.tokens, &githubToken{label: strconv.Itoa(i), value: token, quotas: map[string]githubQuota{}})
+	}
+	return pool
+}
+
+// acquire returns the next GitHub access token that isn't rate limited for the resource, or nil if every token is
+// rate limited
+func (pool *githubTokenPool) acquire(resource string) *githubToken {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	now := pool.now()
+	for i := 0; i < len(pool.tokens); i++ {
+		token := pool.tokens[(pool.next+i)%len(pool.tokens)]
+		if token.isExhausted(resource, now) {
+			continue
+		}
+		pool.next = (pool.next + i + 1) % len(pool.tokens)
+		return token
+	}
+	return nil
+}
+
+// acquireUnauthenticated returns the pseudo token of unauthenticated calls, or nil if unauthenticated calls aren't
+// allowed or are rate limited for the resource
+func (pool *githubTokenPool) acquireUnauthenticated(resource string) *githubToken {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if !pool.allowUnauthenticated || pool.unauthenticated.isExhausted(resource, pool.now()) {
+		return nil
+	}
+	return pool.unauthenticated
+}
+
+// update records the rate limit quota of the resource of the GitHub access token reported by the
+// `X-RateLimit-Remaining` & `X-RateLimit-Reset` headers of the response
+func (pool *githubTokenPool) update(token *githubToken, resource string, resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	token.quotas[resource] = githubQuota{remaining: remaining, resetAt: time.Unix(reset, 0)}
+	githubTokenRemaining.WithLabelValues(token.label, resource).Set(float64(remaining))
+	if remaining == 0 {
+		upstreamRateLimitReset.WithLabelValues("github", token.label).Set(float64(reset))
+	}
+}
+
+// isRateLimited returns whether the response is a GitHub API call rejected for exceeding the rate limit
+func isRateLimited(resp *http.Response) bool {
+	return (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) &&
+		resp.Header.Get("X-RateLimit-Remaining") == "0"
+}
+
+// githubTokenTransport authenticates upstream API calls with the GitHub access tokens of the pool, retrying calls
+// rejected for exceeding the rate limit with the next token. Tokens whose rate limit quota shared among instances is
+// down to its reserve are skipped, if a quota ledger is set.
+type githubTokenTransport struct {
+	base   http.RoundTripper
+	pool   *githubTokenPool
+	ledger *githubQuotaLedger
+}
+
+// acquire returns the next GitHub access token that is neither rate limited nor down to the reserve of its shared
+// quota for the resource, or nil if there is none. It also returns whether tokens were skipped for the reserve of
+// their shared quota.
+func (transport *githubTokenTransport) acquire(ctx context.Context, resource string) (*githubToken, bool) {
+	reserved := false
+	for i := 0; i < len(transport.pool.tokens); i++ {
+		token := transport.pool.acquire(resource)
+		if token == nil {
+			break
+		}
+		if transport.ledger.take(ctx, token, resource) {
+			return token, reserved
+		}
+		reserved = true
+	}
+	return nil, reserved
+}
+
+func (transport *githubTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Tokens are only skipped for the rate limit of the resource called, as each resource has a quota of its own
+	resource := githubRateLimitResource(req, nil)
+	for attempt := 0; ; attempt++ {
+		// RoundTrippers must not modify the original request
+		attemptReq := req.Clone(req.Context())
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+
+		var token *githubToken
+		reserved := false
+		if attempt < len(transport.pool.tokens) {
+			token, reserved = transport.acquire(req.Context(), resource)
+		}
+		if token == nil {
+			token = transport.pool.acquireUnauthenticated(resource)
+			if token == nil && reserved {
+				return nil, errGithubQuotaReserved
+			}
+			if token == nil {
+				return nil, errGithubTokensExhausted
+			}
+		}
+		if token != transport.pool.unauthenticated {
+			attemptReq.Header.Set("Authorization", "Bearer "+token.value)
+		}
+
+		resp, err := transport.base.RoundTrip(attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		transport.pool.update(token, githubRateLimitResource(req, resp), resp)
+		if token != transport.pool.unauthenticated {
+			transport.ledger.record(req.Context(), token, githubRateLimitResource(req, resp), resp)
+		}
+		// requests whose body can't be replayed are never retried
+		if token == transport.pool.unauthenticated || !isRateLimited(resp) || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shurcooL/githubv4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// fakeRateLimitedGithubAPI returns a fake GitHub GraphQL API rejecting API calls authenticated with the rate limited
+// tokens, recording the token of every API call
+func fakeRateLimitedGithubAPI(data string, rateLimitedTokens map[string]bool) (http.HandlerFunc, func() []string) {
+	var mu sync.Mutex
+	var tokens []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		mu.Lock()
+		tokens = append(tokens, token)
+		mu.Unlock()
+
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		if rateLimitedTokens[token] {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		fakeGithubGraphQLAPI(data)(w, r)
+	}
+	return handler, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), tokens...)
+	}
+}
+
+// newTestGithubServiceWithTokens returns a router serving the GitHub badge service backed by the fake API handler,
+// authenticating API calls with the token pool
+func newTestGithubServiceWithTokens(t *testing.T, pool *githubTokenPool, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewGithubService(&config.Config{GithubAccessToken: "token"}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpClient := &http.Client{Transport: &githubTokenTransport{base: http.DefaultTransport, pool: pool}}
+	service.(*githubService).client = githubv4.NewEnterpriseClient(fakeAPI.URL, httpClient)
+
+	router := mux.NewRouter()
+	router.Handle(`/github/{method}/{owner}/{repo}`, service)
+
+	return router, fakeAPI.Close
+}
+
+func TestGithubTokenPoolAcquire(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	pool := newGithubTokenPool([]string{"a", "b", "c"}, false)
+	pool.now = func() time.Time { return now }
+
+	var values []string
+	for i := 0; i < 4; i++ {
+		values = append(values, pool.acquire(githubGraphQLResource).value)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a"}, values)
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("X-RateLimit-Remaining", "0")
+	resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Minute).Unix(), 10))
+	pool.update(pool.tokens[1], githubGraphQLResource, resp)
+	values = nil
+	for i := 0; i < 3; i++ {
+		values = append(values, pool.acquire(githubGraphQLResource).value)
+	}
+	assert.Equal(t, []string{"c", "a", "c"}, values)
+
+	// exhausted tokens are used again once their rate limit resets
+	now = now.Add(time.Minute)
+	assert.Equal(t, "a", pool.acquire(githubGraphQLResource).value)
+	assert.Equal(t, "b", pool.acquire(githubGraphQLResource).value)
+
+	for _, token := range pool.tokens {
+		pool.update(token, githubGraphQLResource, resp)
+	}
+	now = now.Add(-time.Minute)
+	assert.Nil(t, pool.acquire(githubGraphQLResource))
+
+	// tokens are only exhausted for the rate limit resource that reported it
+	assert.Equal(t, "c", pool.acquire(githubCoreResource).value)
+}
+
+func TestGithubRateLimitResource(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		url      string
+		resource string
+		expected string
+	}{
+		{"GraphQL", "https://api.github.com/graphql", "", githubGraphQLResource},
+		{"Search", "https://api.github.com/search/issues?q=repo:google/gopacket", "", githubSearchResource},
+		{"Core", "https://api.github.com/repos/google/gopacket/contributors", "", githubCoreResource},
+		{"EnterpriseGraphQL", "https://github.example.com/api/graphql", "", githubGraphQLResource},
+		{"ReportedResource", "https://api.github.com/repos/google/gopacket/dependency-graph/sbom", "dependency_snapshots", "dependency_snapshots"},
+	}
+
+	for _, testCase := range testCases {
+		req, _ := http.NewRequest("GET", testCase.url, nil)
+		resp := &http.Response{Header: http.Header{}}
+		if testCase.resource != "" {
+			resp.Header.Set("X-RateLimit-Resource", testCase.resource)
+		}
+		assert.Equal(t, testCase.expected, githubRateLimitResource(req, resp), testCase.name)
+	}
+}
+
+func TestGithubTokenTransportTracksRateLimitByResource(t *testing.T) {
+	t.Parallel()
+
+	// the token exhausted the rate limit of the REST API, but not of the GraphQL API
+	var mu sync.Mutex
+	var calls []string
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		if r.URL.Path == "/graphql" {
+			w.Header().Set("X-RateLimit-Resource", githubGraphQLResource)
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Header().Set("X-RateLimit-Resource", githubCoreResource)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer fakeAPI.Close()
+
+	client := &http.Client{Transport: &githubTokenTransport{base: http.DefaultTransport, pool: newGithubTokenPool([]string{"a"}, false)}}
+	for _, path := range []string{"/repos/google/gopacket/contributors", "/graphql", "/repos/google/gopacket/contributors", "/graphql"} {
+		resp, err := client.Get(fakeAPI.URL + path)
+		if path == "/graphql" {
+			if assert.NoError(t, err) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				resp.Body.Close()
+			}
+			continue
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	// REST API calls are skipped until the rate limit resets, while GraphQL API calls keep using the token
+	assert.Equal(t, []string{"/repos/google/gopacket/contributors", "/graphql", "/graphql"}, calls)
+}
+
+func TestGithubServiceWithRateLimitedToken(t *testing.T) {
+	t.Parallel()
+
+	handler, calls := fakeRateLimitedGithubAPI(`{"repository":{"forks":{"totalCount":42}}}`, map[string]bool{"Bearer a": true})
+	router, cleanup := newTestGithubServiceWithTokens(t, newGithubTokenPool([]string{"a", "b"}, false), handler)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/github/forks/google/gopacket", nil)
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, createBadge(&badge.Params{Subject: "forks", Status: "42"}), res.Body.String())
+	}
+
+	// the rate limited token is retried with the next token & skipped until its rate limit resets
+	assert.Equal(t, []string{"Bearer a", "Bearer b", "Bearer b"}, calls())
+}
+
+func TestGithubServiceWithRateLimitedTokens(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                 string
+		allowUnauthenticated bool
+		expectedBody         string
+		expectedCalls        []string
+	}{
+		{
+			"Unauthenticated",
+			true,
+			createBadge(&badge.Params{Subject: "forks", Status: "42"}),
+			[]string{"Bearer a", "Bearer b", ""},
+		},
+		{
+			"Authenticated",
+			false,
+			createBadge(&badge.Params{Subject: "aegis", Status: "rate limited"}),
+			[]string{"Bearer a", "Bearer b"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			rateLimitedTokens := map[string]bool{"Bearer a": true, "Bearer b": true}
+			handler, calls := fakeRateLimitedGithubAPI(`{"repository":{"forks":{"totalCount":42}}}`, rateLimitedTokens)
+			pool := newGithubTokenPool([]string{"a", "b"}, testCase.allowUnauthenticated)
+			router, cleanup := newTestGithubServiceWithTokens(t, pool, handler)
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/github/forks/google/gopacket", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedBody, res.Body.String())
+			assert.Equal(t, testCase.expectedCalls, calls())
+		})
+	}
+}
+
+func TestNewGithubServiceWithoutTokens(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewGithubService(&config.Config{}, zap.NewNop())
+	assert.EqualError(t, err, "missing GitHub access token")
+
+	_, err = NewGithubService(&config.Config{GithubAllowUnauthenticated: true}, zap.NewNop())
+	assert.NoError(t, err)
+}
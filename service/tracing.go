@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tohjustin/aegis/internal/version"
+)
+
+// tracerName identifies the spans of the application among the spans of its dependencies
+const tracerName = "github.com/tohjustin/aegis/service"
+
+// Attributes of the spans specific to the application, alongside the semantic conventions of HTTP spans
+const (
+	providerAttribute    = attribute.Key("aegis.provider")
+	methodAttribute      = attribute.Key("aegis.method")
+	ownerAttribute       = attribute.Key("aegis.owner")
+	repoAttribute        = attribute.Key("aegis.repo")
+	requestIDAttribute   = attribute.Key("aegis.request_id")
+	cacheAttribute       = attribute.Key("aegis.cache")
+	cacheResultAttribute = attribute.Key("aegis.cache.result")
+)
+
+// routeVariablesContextKey represents the context key of the route variables of the badge request
+type routeVariablesContextKey struct{}
+
+// tracePropagator reads the trace context of incoming requests & sets it on upstream API calls, with the W3C Trace
+// Context & Baggage headers
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// isTracingEnabled reports whether an OTLP endpoint is set with the standard environment variables
+func isTracingEnabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// newTracerProvider returns a tracer provider exporting spans to the OTLP endpoint (over HTTP) configured with the
+// standard `OTEL_EXPORTER_OTLP_*` environment variables, or nil if no OTLP endpoint is set as spans are dropped then
+func newTracerProvider(ctx context.Context, serviceName string) (*sdktrace.TracerProvider, error) {
+	if !isTracingEnabled() {
+		return nil, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// `OTEL_SERVICE_NAME` & `OTEL_RESOURCE_ATTRIBUTES` take precedence over the default attributes
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceNameKey.String(serviceName), semconv.ServiceVersionKey.String(version.Get().Version)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+}
+
+// startSpan starts a span of the global tracer provider, a child of the span of the context if any. Spans are
+// dropped unless a tracer provider is set.
+func startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// routeAttributes returns the attributes of the badge requested, based on its route variables
+func routeAttributes(routeVariables map[string]string) []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+	if method, ok := routeVariables["method"]; ok {
+		attributes = append(attributes, methodAttribute.String(method))
+	}
+	if owner, ok := routeVariables["owner"]; ok {
+		attributes = append(attributes, ownerAttribute.String(owner))
+	}
+	if repo, ok := routeVariables["repo"]; ok {
+		attributes = append(attributes, repoAttribute.String(repo))
+	}
+	return attributes
+}
+
+// contextWithTrace returns the context carrying the span & the route variables of the request, so that spans started
+// from the context (eg. of upstream API calls shared among concurrent requests) are children of the span of the
+// request, even when the context isn't derived from the request context
+func contextWithTrace(ctx context.Context, r *http.Request) context.Context {
+	ctx = context.WithValue(ctx, routeVariablesContextKey{}, mux.Vars(r))
+	return trace.ContextWithSpan(ctx, trace.SpanFromContext(r.Context()))
+}
+
+// withTracing traces every request with a server span, continuing the trace context of the request if any. Spans
+// are named after the route matched by the router (eg. `GET /github/{method}/{owner}/{repo}`).
+func withTracing(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := startSpan(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPMethodKey.String(r.Method),
+			// the query string is left out, as it may hold an upstream API token
+			semconv.HTTPTargetKey.String(r.URL.Path),
+			semconv.HTTPUserAgentKey.String(r.UserAgent()),
+			requestIDAttribute.String(requestIDFromContext(r.Context())),
+		))
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(recorder, r)
+
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if pathTemplate, err := match.Route.GetPathTemplate(); err == nil {
+				span.SetName(r.Method + " " + pathTemplate)
+				span.SetAttributes(semconv.HTTPRouteKey.String(pathTemplate), providerAttribute.String(routeName(pathTemplate)))
+			}
+			span.SetAttributes(routeAttributes(match.Vars)...)
+		}
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(recorder.statusCode))
+		if recorder.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.statusCode))
+		}
+	})
+}
+
+// startCacheLookupSpan starts the span of a lookup of a cache of the provider, whose result is set by
+// endCacheLookupSpan
+func startCacheLookupSpan(ctx context.Context, provider string, cache string) trace.Span {
+	_, span := startSpan(ctx, "cache.lookup", trace.WithAttributes(providerAttribute.String(provider), cacheAttribute.String(cache)))
+	return span
+}
+
+// endCacheLookupSpan ends the span of a cache lookup with its result (hit or miss)
+func endCacheLookupSpan(span trace.Span, result string) {
+	span.SetAttributes(cacheResultAttribute.String(result))
+	span.End()
+}
+
+// tracingTransport traces upstream API calls with client spans, children of the span of the badge request, & sets
+// their trace context on the upstream API calls
+type tracingTransport struct {
+	provider string
+	base     http.RoundTripper
+}
+
+func (transport *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the credentials & query string are left out, as the query string may hold an upstream API token
+	url := *req.URL
+	url.User = nil
+	url.RawQuery = ""
+	attributes := []attribute.KeyValue{
+		providerAttribute.String(transport.provider),
+		semconv.HTTPMethodKey.String(req.Method),
+		semconv.HTTPURLKey.String(url.String()),
+	}
+	routeVariables, _ := req.Context().Value(routeVariablesContextKey{}).(map[string]string)
+	attributes = append(attributes, routeAttributes(routeVariables)...)
+	ctx, span := startSpan(req.Context(), "upstream.request", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	defer span.End()
+
+	// RoundTrippers must not modify the original request
+	req = req.Clone(ctx)
+	tracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := transport.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
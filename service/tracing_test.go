@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// spanAttributes returns the attributes of the span by key
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, attribute := range span.Attributes {
+		attributes[attribute.Key] = attribute.Value
+	}
+	return attributes
+}
+
+// TestTracing sets the global tracer provider, so it can't run in parallel
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tracerProvider)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	defer tracerProvider.Shutdown(context.Background())
+
+	var traceparent string
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"star_count":42}`))
+	}))
+	defer fakeAPI.Close()
+
+	configuration := &config.Config{CacheSeconds: 3600, MinCacheSeconds: 300, MaxCacheSeconds: 86400}
+	staticService, err := NewStaticService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitProviderService, err := NewGitlabService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitProviderService.(*gitlabService).baseURL = fakeAPI.URL
+	app := &Application{
+		config:           configuration,
+		staticService:    &staticService,
+		bitbucketService: &gitProviderService,
+		giteaService:     &gitProviderService,
+		githubService:    &gitProviderService,
+		gitlabService:    &gitProviderService,
+	}
+
+	// the trace of the request is continued
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/stars/google/gopacket?token=secret", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	app.handler().ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	assert.Len(t, spans, 4)
+
+	server := spans["GET /gitlab/{method}/{owner}/{repo}"]
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.True(t, server.Parent.IsRemote())
+	attributes := spanAttributes(server)
+	assert.Equal(t, "/gitlab/{method}/{owner}/{repo}", attributes["http.route"].AsString())
+	assert.Equal(t, "/gitlab/stars/google/gopacket", attributes["http.target"].AsString())
+	assert.Equal(t, int64(http.StatusOK), attributes["http.status_code"].AsInt64())
+	assert.Equal(t, "gitlab", attributes[providerAttribute].AsString())
+	assert.Equal(t, "stars", attributes[methodAttribute].AsString())
+
+	// every other span is a child of the server span
+	for _, name := range []string{"cache.lookup", "upstream.request", "badge.render"} {
+		if assert.Contains(t, spans, name) {
+			assert.Equal(t, server.SpanContext.TraceID(), spans[name].SpanContext.TraceID(), name)
+			assert.Equal(t, server.SpanContext.SpanID(), spans[name].Parent.SpanID(), name)
+		}
+	}
+
+	attributes = spanAttributes(spans["cache.lookup"])
+	assert.Equal(t, "gitlab", attributes[providerAttribute].AsString())
+	assert.Equal(t, "project", attributes[cacheAttribute].AsString())
+	assert.Equal(t, "miss", attributes[cacheResultAttribute].AsString())
+
+	upstream := spans["upstream.request"]
+	assert.Equal(t, trace.SpanKindClient, upstream.SpanKind)
+	attributes = spanAttributes(upstream)
+	assert.Equal(t, "gitlab", attributes[providerAttribute].AsString())
+	assert.Equal(t, "google", attributes[ownerAttribute].AsString())
+	assert.Equal(t, "gopacket", attributes[repoAttribute].AsString())
+	assert.Equal(t, int64(http.StatusOK), attributes["http.status_code"].AsInt64())
+	assert.NotContains(t, attributes["http.url"].AsString(), "?")
+
+	// the trace context is propagated onto the upstream API call, as a child of the upstream span
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+upstream.SpanContext.SpanID().String()+"-01", traceparent)
+}
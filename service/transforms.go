@@ -2,9 +2,16 @@ package service
 
 import (
 	"fmt"
+	"math"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// humanizedPrefixes represents the metric prefixes used by `humanizeInteger`, in ascending order
+var humanizedPrefixes = []string{"k", "M", "G"}
+
 // formatIntegerWithMetricPrefix formats an integer into a string with metric prefix
 func formatIntegerWithMetricPrefix(n int) string {
 	var metricPrefix string
@@ -32,3 +39,132 @@ func formatIntegerWithMetricPrefix(n int) string {
 	formatSpecifier := fmt.Sprintf("%%.%df%s", precision, metricPrefix)
 	return fmt.Sprintf(formatSpecifier, result)
 }
+
+// humanizeInteger formats an integer into a string with metric prefix & at most one decimal place
+func humanizeInteger(n int) string {
+	if n < 1000 {
+		return strconv.Itoa(n)
+	}
+
+	// Move on to the next prefix whenever rounding would reach 1000 (eg. 999999 => "1M" instead of "1000k")
+	var metricPrefix string
+	result := float64(n)
+	for _, prefix := range humanizedPrefixes {
+		metricPrefix = prefix
+		result /= 1000
+		if math.Round(result*10)/10 < 1000 {
+			break
+		}
+	}
+
+	return strconv.FormatFloat(math.Round(result*10)/10, 'f', -1, 64) + metricPrefix
+}
+
+// formatStatus formats a fetched value into the badge status text, values are humanized when the request
+// query contains `humanize` or `format=metric`
+func formatStatus(value int, query url.Values) string {
+	humanize := query.Get("format") == "metric"
+	if values, ok := query["humanize"]; ok {
+		enabled, err := strconv.ParseBool(values[0])
+		humanize = humanize || values[0] == "" || (err == nil && enabled)
+	}
+
+	if humanize {
+		return humanizeInteger(value)
+	}
+	return formatIntegerWithMetricPrefix(value)
+}
+
+// labeledSubject returns the subject of a count of issues or pull requests narrowed down by the labels, naming the
+// labels right before the counted noun (eg. "open issues" => "open bug issues")
+func labeledSubject(subject string, labels []string) string {
+	if len(labels) == 0 {
+		return subject
+	}
+	words := strings.Fields(subject)
+	noun := words[len(words)-1]
+	words = append(words[:len(words)-1], labels...)
+	return strings.Join(append(words, noun), " ")
+}
+
+// byteSizeUnits represents the units used by `formatKilobytes` beyond kilobytes, in ascending order
+var byteSizeUnits = map[bool][]string{
+	false: {"KB", "MB", "GB", "TB"},
+	true:  {"KiB", "MiB", "GiB", "TiB"},
+}
+
+// formatKilobytes formats a size in kilobytes into a string with the largest unit keeping the size below 1000, scaled
+// by 1024 for binary units or by 1000 otherwise. Sizes beyond kilobytes are formatted with one decimal place.
+func formatKilobytes(kilobytes int, binary bool) string {
+	scale := 1000.0
+	if binary {
+		scale = 1024
+	}
+	units := byteSizeUnits[binary]
+
+	size := float64(kilobytes)
+	unit := 0
+	// Move on to the next unit whenever rounding would reach 1000 (eg. 999999 KB => "1.0 GB" instead of "1000.0 MB")
+	for unit < len(units)-1 && math.Round(size*10)/10 >= 1000 {
+		size /= scale
+		unit++
+	}
+	if unit == 0 {
+		return strconv.Itoa(kilobytes) + " " + units[0]
+	}
+	return strconv.FormatFloat(size, 'f', 1, 64) + " " + units[unit]
+}
+
+// relativeTimeUnits represents the units used by `formatRelativeTime`, in descending order
+var relativeTimeUnits = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"week", 7 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+}
+
+// formatRelativeTime formats the time relative to now in its largest whole unit (eg. "3 days ago")
+func formatRelativeTime(t time.Time, now time.Time) string {
+	elapsed := now.Sub(t)
+	for _, unit := range relativeTimeUnits {
+		count := int(elapsed / unit.duration)
+		if count == 1 {
+			return "1 " + unit.name + " ago"
+		}
+		if count > 1 {
+			return strconv.Itoa(count) + " " + unit.name + "s ago"
+		}
+	}
+	return "just now"
+}
+
+// ageUnits represents the units used by `formatAge`, in descending order
+var ageUnits = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+}
+
+// formatAge formats the time elapsed from the time until now in its largest whole unit among years, months & days
+// (eg. "6 years")
+func formatAge(t time.Time, now time.Time) string {
+	elapsed := now.Sub(t)
+	for _, unit := range ageUnits {
+		count := int(elapsed / unit.duration)
+		if count == 1 {
+			return "1 " + unit.name
+		}
+		if count > 1 {
+			return strconv.Itoa(count) + " " + unit.name + "s"
+		}
+	}
+	return "0 days"
+}
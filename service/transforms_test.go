@@ -1,7 +1,10 @@
 package service
 
 import (
+	"net/url"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,8 +32,135 @@ func TestFormatIntegerWithMetricPrefix(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		t.Run(string(testCase.input), func(t *testing.T) {
+		t.Run(strconv.Itoa(testCase.input), func(t *testing.T) {
 			assert.Equal(t, testCase.expected, formatIntegerWithMetricPrefix(testCase.input))
 		})
 	}
 }
+
+func TestHumanizeInteger(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		input    int
+		expected string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{999, "999"},
+		{1000, "1k"},
+		{1049, "1k"},
+		{1234, "1.2k"},
+		{123456, "123.5k"},
+		{999949, "999.9k"},
+		{999999, "1M"},
+		{1000000, "1M"},
+		{3456789, "3.5M"},
+		{999999999, "1G"},
+		{1100000000, "1.1G"},
+		{112233445566, "112.2G"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(strconv.Itoa(testCase.input), func(t *testing.T) {
+			assert.Equal(t, testCase.expected, humanizeInteger(testCase.input))
+		})
+	}
+}
+
+func TestFormatStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		query    string
+		expected string
+	}{
+		{"", "123k"},
+		{"humanize", "123.5k"},
+		{"humanize=true", "123.5k"},
+		{"humanize=false", "123k"},
+		{"format=metric", "123.5k"},
+		{"format=other", "123k"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.query, func(t *testing.T) {
+			query, _ := url.ParseQuery(testCase.query)
+			assert.Equal(t, testCase.expected, formatStatus(123456, query))
+		})
+	}
+}
+
+func TestFormatKilobytes(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		kilobytes int
+		binary    bool
+		expected  string
+	}{
+		{0, false, "0 KB"},
+		{999, false, "999 KB"},
+		{1000, false, "1.0 MB"},
+		{4200, false, "4.2 MB"},
+		{999949, false, "999.9 MB"},
+		{999950, false, "1.0 GB"},
+		{1300000, false, "1.3 GB"},
+		{999, true, "999 KiB"},
+		{1024, true, "1.0 MiB"},
+		{4300, true, "4.2 MiB"},
+		{1363149, true, "1.3 GiB"},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, formatKilobytes(testCase.kilobytes, testCase.binary), strconv.Itoa(testCase.kilobytes))
+	}
+}
+
+func TestFormatRelativeTime(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		elapsed  time.Duration
+		expected string
+	}{
+		{0, "just now"},
+		{59 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{45 * time.Minute, "45 minutes ago"},
+		{3 * time.Hour, "3 hours ago"},
+		{24 * time.Hour, "1 day ago"},
+		{3 * 24 * time.Hour, "3 days ago"},
+		{15 * 24 * time.Hour, "2 weeks ago"},
+		{90 * 24 * time.Hour, "3 months ago"},
+		{800 * 24 * time.Hour, "2 years ago"},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, formatRelativeTime(now.Add(-testCase.elapsed), now), testCase.elapsed.String())
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		elapsed  time.Duration
+		expected string
+	}{
+		{0, "0 days"},
+		{3 * time.Hour, "0 days"},
+		{24 * time.Hour, "1 day"},
+		{15 * 24 * time.Hour, "15 days"},
+		{30 * 24 * time.Hour, "1 month"},
+		{200 * 24 * time.Hour, "6 months"},
+		{365 * 24 * time.Hour, "1 year"},
+		{2200 * 24 * time.Hour, "6 years"},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, formatAge(now.Add(-testCase.elapsed), now), testCase.elapsed.String())
+	}
+}
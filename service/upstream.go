@@ -0,0 +1,174 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tohjustin/aegis/service/config"
+	"go.uber.org/zap"
+)
+
+// maxUpstreamResponseSize represents the maximum number of bytes read from upstream API responses
+const maxUpstreamResponseSize = 1 << 20
+
+// upstreamStatusError represents an upstream API response with an unexpected status code
+type upstreamStatusError struct {
+	statusCode int
+}
+
+func (err *upstreamStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", err.statusCode)
+}
+
+// isUpstreamForbidden returns whether the error is an upstream API response denying access to a resource
+func isUpstreamForbidden(err error) bool {
+	statusErr, ok := err.(*upstreamStatusError)
+	return ok && (statusErr.statusCode == http.StatusUnauthorized || statusErr.statusCode == http.StatusForbidden)
+}
+
+// upstreamTransport returns the base transport of upstream API calls
+func upstreamTransport(configuration *config.Config) http.RoundTripper {
+	if configuration.UpstreamTransport != nil {
+		return configuration.UpstreamTransport
+	}
+	return http.DefaultTransport
+}
+
+// limitedBody limits the number of bytes read from a response body
+type limitedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// limitedBodyTransport limits the number of bytes read from response bodies, so that oversized or endless
+// upstream responses can't exhaust memory
+type limitedBodyTransport struct {
+	base http.RoundTripper
+}
+
+func (transport *limitedBodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := transport.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = limitedBody{Reader: io.LimitReader(resp.Body, maxUpstreamResponseSize), Closer: resp.Body}
+	return resp, nil
+}
+
+// retryTransport retries idempotent upstream API calls failing with network errors, 429 or 5xx responses, with
+// exponential backoff plus jitter. Retries are given up once their delay (or the `Retry-After` header of the
+// response) would exceed the deadline of the request.
+type retryTransport struct {
+	base      http.RoundTripper
+	retries   uint
+	baseDelay time.Duration
+}
+
+// isRetryable returns whether the upstream API call should be retried
+func isRetryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil || isUpstreamRateLimited(err) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	// calls rejected for an exhausted rate limit are bound to fail until the rate limit resets
+	if _, ok := rateLimitReset(resp, time.Now()); ok {
+		return false
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retryAfter returns the delay requested by the `Retry-After` header of the response, or 0 if none
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// backoffDelay returns the delay before the given retry (starting from 0), doubling the base delay on every retry &
+// adding up to 50% of random jitter
+func backoffDelay(baseDelay time.Duration, retry uint) time.Duration {
+	delay := baseDelay << retry
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+func (transport *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return transport.base.RoundTrip(req)
+	}
+
+	for retry := uint(0); ; retry++ {
+		resp, err := transport.base.RoundTrip(req)
+		if retry >= transport.retries || !isRetryable(req, resp, err) {
+			return resp, err
+		}
+
+		now := time.Now()
+		delay := backoffDelay(transport.baseDelay, retry)
+		if after := retryAfter(resp, now); after > delay {
+			delay = after
+		}
+		if deadline, ok := req.Context().Deadline(); ok && now.Add(delay).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxUpstreamResponseSize))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// newUpstreamClient returns a HTTP client for upstream API calls of the provider, bounded by the configured
+// upstream timeout & maximum of concurrent upstream API calls, retried on transient failures, guarded by a circuit
+// breaker, traced & identified by the request ID of their context
+func newUpstreamClient(configuration *config.Config, logger *zap.Logger, provider string, transport http.RoundTripper) *http.Client {
+	var upstreamTransport http.RoundTripper = &retryTransport{
+		base:      &instrumentedTransport{provider: provider, base: &tracingTransport{provider: provider, base: &requestIDTransport{base: transport}}},
+		retries:   configuration.UpstreamRetries,
+		baseDelay: configuration.UpstreamRetryDelay,
+	}
+	if configuration.CircuitBreakerThreshold > 0 {
+		upstreamTransport = &circuitBreakerTransport{
+			base: upstreamTransport,
+			breaker: newCircuitBreaker(provider, logger,
+				configuration.CircuitBreakerThreshold, configuration.CircuitBreakerCooldown),
+		}
+	}
+	if configuration.MaxConcurrentUpstream > 0 {
+		upstreamTransport = &concurrencyLimitTransport{
+			base:    upstreamTransport,
+			limiter: newConcurrencyLimiter(provider, configuration.MaxConcurrentUpstream, configuration.UpstreamQueueTimeout),
+		}
+	}
+
+	return &http.Client{
+		Transport: &limitedBodyTransport{base: upstreamTransport},
+		Timeout:   configuration.UpstreamTimeout,
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/pkg/badge"
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// newTestRetryingGitlabService returns a router serving the GitLab badge service backed by the fake API handler,
+// retrying upstream API calls with the given configuration
+func newTestRetryingGitlabService(t *testing.T, configuration *config.Config, fakeAPIHandler http.HandlerFunc) (*mux.Router, func()) {
+	fakeAPI := httptest.NewServer(fakeAPIHandler)
+
+	service, err := NewGitlabService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.(*gitlabService).baseURL = fakeAPI.URL
+
+	router := mux.NewRouter()
+	router.Handle(`/gitlab/{method}/{owner}/{repo}`, service)
+
+	return router, fakeAPI.Close
+}
+
+func TestUpstreamRetries(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		statusCode int
+	}{
+		{"BadGateway", http.StatusBadGateway},
+		{"ServiceUnavailable", http.StatusServiceUnavailable},
+		{"TooManyRequests", http.StatusTooManyRequests},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls int32
+			configuration := &config.Config{UpstreamTimeout: time.Second, UpstreamRetries: 2, UpstreamRetryDelay: time.Millisecond}
+			router, cleanup := newTestRetryingGitlabService(t, configuration, func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) <= 2 {
+					w.WriteHeader(testCase.statusCode)
+					return
+				}
+				w.Header().Set("X-Total", "42")
+				w.Write([]byte("[]"))
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly", nil)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, createBadge(&badge.Params{Subject: "issues", Status: "42"}), res.Body.String())
+			assert.Equal(t, int32(3), calls)
+		})
+	}
+}
+
+func TestUpstreamRetriesExhausted(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	configuration := &config.Config{UpstreamTimeout: time.Second, UpstreamRetries: 2, UpstreamRetryDelay: time.Millisecond}
+	router, cleanup := newTestRetryingGitlabService(t, configuration, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "internal server error"}), res.Body.String())
+	assert.Equal(t, int32(3), calls)
+}
+
+func TestUpstreamRetriesWithinDeadline(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		retryAfter string
+	}{
+		{"Backoff", ""},
+		{"RetryAfter", "1"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			timeout := 200 * time.Millisecond
+			configuration := &config.Config{UpstreamTimeout: timeout, UpstreamRetries: 10, UpstreamRetryDelay: 20 * time.Millisecond}
+			router, cleanup := newTestRetryingGitlabService(t, configuration, func(w http.ResponseWriter, r *http.Request) {
+				if testCase.retryAfter != "" {
+					w.Header().Set("Retry-After", testCase.retryAfter)
+				}
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+			defer cleanup()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/gitlab/issues/gitlab-org/gitaly", nil)
+			start := time.Now()
+			router.ServeHTTP(res, req)
+
+			assert.True(t, time.Since(start) < timeout, "took %s", time.Since(start))
+			assert.Equal(t, createBadge(&badge.Params{Subject: "aegis", Status: "internal server error"}), res.Body.String())
+		})
+	}
+}
+
+func TestRetryTransportSkipsNonIdempotentRequests(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	fakeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer fakeAPI.Close()
+
+	client := &http.Client{Transport: &retryTransport{base: http.DefaultTransport, retries: 2, baseDelay: time.Millisecond}}
+	resp, err := client.Post(fakeAPI.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		header   string
+		expected time.Duration
+	}{
+		{"None", "", 0},
+		{"Seconds", "3", 3 * time.Second},
+		{"Date", now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second},
+		{"PastDate", now.Add(-5 * time.Second).Format(http.TimeFormat), 0},
+		{"Invalid", "soon", 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			resp.Header.Set("Retry-After", testCase.header)
+			assert.Equal(t, testCase.expected, retryAfter(resp, now))
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	t.Parallel()
+
+	for retry := uint(0); retry < 4; retry++ {
+		delay := backoffDelay(100*time.Millisecond, retry)
+		minDelay := (100 * time.Millisecond) << retry
+		assert.True(t, delay >= minDelay && delay <= minDelay*3/2, "retry %d: %s", retry, delay)
+	}
+	assert.Equal(t, time.Duration(0), backoffDelay(0, 3))
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tohjustin/aegis/internal/version"
+)
+
+// versionHeader represents the header reporting the version of the application serving the response
+const versionHeader = "X-Badger-Version"
+
+// versionHandler handles requests for the build information of the application, which is never cached so that
+// deployments are reflected immediately
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(version.Get())
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// withVersionHeader sets the version of the application on every response, to tell apart the builds served by
+// multiple instances
+func withVersionHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(versionHeader, version.Get().Version)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/tohjustin/aegis/internal/version"
+	"github.com/tohjustin/aegis/pkg/badge"
+)
+
+// setTestVersion sets the build information of the application, returning a function restoring it. Tests calling it
+// can't run in parallel.
+func setTestVersion(versionNumber string, gitHash string, buildDate string) func() {
+	previousVersion, previousGitHash, previousBuildDate := version.Version, version.GitHash, version.BuildDate
+	version.Version, version.GitHash, version.BuildDate = versionNumber, gitHash, buildDate
+	return func() {
+		version.Version, version.GitHash, version.BuildDate = previousVersion, previousGitHash, previousBuildDate
+	}
+}
+
+func TestVersion(t *testing.T) {
+	defer setTestVersion("1.2.3", "7591664", "2020-12-01T10:00:00Z")()
+
+	body, err := json.Marshal(version.BuildInfo{
+		Version:   "1.2.3",
+		GitCommit: "7591664",
+		BuildDate: "2020-12-01T10:00:00Z",
+		GoVersion: runtime.Version(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runHTTPTest(t, httpTestCase{
+		requestMethod: "GET",
+		requestPath:   "/version",
+		expectedHeaders: map[string]string{
+			"Cache-Control": "no-store",
+			"Content-Type":  "application/json",
+			versionHeader:   "1.2.3",
+		},
+		expectedStatus: 200,
+		expectedBody:   string(body),
+	})
+}
+
+func TestVersionHeader(t *testing.T) {
+	defer setTestVersion("1.2.3", "7591664", "2020-12-01T10:00:00Z")()
+
+	runHTTPTest(t, httpTestCase{
+		requestMethod: "GET",
+		requestPath:   "/static?subject=build&status=passing",
+		expectedHeaders: map[string]string{
+			versionHeader: "1.2.3",
+		},
+		expectedStatus: 200,
+		expectedBody:   createBadge(&badge.Params{Subject: "build", Status: "passing"}),
+	})
+	runHTTPTest(t, httpTestCase{
+		requestMethod: "GET",
+		requestPath:   "/github/bananas/google/gopacket",
+		expectedHeaders: map[string]string{
+			versionHeader: "1.2.3",
+		},
+		expectedStatus: 404,
+		expectedBody:   createBadge(&badge.Params{Subject: "aegis", Status: "not found"}),
+	})
+}
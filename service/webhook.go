@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+// webhookMaxPayloadSize represents the maximum size of webhook payloads, same as the maximum size of GitHub's
+const webhookMaxPayloadSize = 25 << 20
+
+// githubWebhookEvents represents the GitHub webhook events changing the data of badges
+var githubWebhookEvents = map[string]bool{
+	"create":       true,
+	"delete":       true,
+	"fork":         true,
+	"issues":       true,
+	"milestone":    true,
+	"pull_request": true,
+	"push":         true,
+	"release":      true,
+	"repository":   true,
+	"star":         true,
+	"watch":        true,
+	"workflow_run": true,
+}
+
+// gitlabWebhookEvents represents the GitLab webhook events changing the data of badges
+var gitlabWebhookEvents = map[string]bool{
+	"Issue Hook":         true,
+	"Merge Request Hook": true,
+	"Pipeline Hook":      true,
+	"Push Hook":          true,
+	"Release Hook":       true,
+	"Tag Push Hook":      true,
+}
+
+// repositoryCachePurger represents a badge service purging the data cached for the badges of a repository
+type repositoryCachePurger interface {
+	purgeRepository(ctx context.Context, owner string, repo string) int
+}
+
+// webhookResponse represents the response of a webhook purging the cached data of a repository
+type webhookResponse struct {
+	Repository string `json:"repository"`
+	Purged     int    `json:"purged"`
+}
+
+// webhookProvider verifies & parses the webhook payloads of a provider
+type webhookProvider struct {
+	// verify reports whether the request was signed with the webhook secret
+	verify func(r *http.Request, body []byte, secret string) bool
+	// event returns the event of the request, & whether it changes the data of badges
+	event func(r *http.Request) (string, bool)
+	// repository returns the full name (ie. `owner/repo`) of the repository of the payload
+	repository func(body []byte) (string, error)
+}
+
+var webhookProviders = map[string]webhookProvider{
+	"github": {
+		verify: func(r *http.Request, body []byte, secret string) bool {
+			signature := r.Header.Get("X-Hub-Signature-256")
+			if !strings.HasPrefix(signature, "sha256=") {
+				return false
+			}
+			expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+			if err != nil {
+				return false
+			}
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(body)
+			return hmac.Equal(mac.Sum(nil), expected)
+		},
+		event: func(r *http.Request) (string, bool) {
+			event := r.Header.Get("X-GitHub-Event")
+			return event, githubWebhookEvents[event]
+		},
+		repository: func(body []byte) (string, error) {
+			var payload struct {
+				Repository struct {
+					FullName string `json:"full_name"`
+				} `json:"repository"`
+			}
+			err := json.Unmarshal(body, &payload)
+			return payload.Repository.FullName, err
+		},
+	},
+	"gitlab": {
+		verify: func(r *http.Request, body []byte, secret string) bool {
+			return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(secret)) == 1
+		},
+		event: func(r *http.Request) (string, bool) {
+			event := r.Header.Get("X-Gitlab-Event")
+			return event, gitlabWebhookEvents[event]
+		},
+		repository: func(body []byte) (string, error) {
+			var payload struct {
+				Project struct {
+					PathWithNamespace string `json:"path_with_namespace"`
+				} `json:"project"`
+			}
+			err := json.Unmarshal(body, &payload)
+			return payload.Project.PathWithNamespace, err
+		},
+	},
+}
+
+// splitRepositoryName splits the full name of a repository into its owner & name. The owner of GitLab projects may
+// be nested groups (eg. `group/subgroup`).
+func splitRepositoryName(fullName string) (string, string, bool) {
+	i := strings.LastIndex(fullName, "/")
+	if i <= 0 || i == len(fullName)-1 {
+		return "", "", false
+	}
+	return fullName[:i], fullName[i+1:], true
+}
+
+// isRepositoryKey reports whether the fetch key (or result key) identifies data of the repository, regardless of the
+// upstream API token, the metric & the query parameters
+func isRepositoryKey(key string, owner string, repo string) bool {
+	if strings.HasPrefix(key, "token:") {
+		key = key[strings.Index(key, "/")+1:]
+	}
+	if i := strings.IndexAny(key, "?#"); i >= 0 {
+		key = key[:i]
+	}
+	i := strings.Index(key, "/")
+	if i < 0 {
+		return false
+	}
+	// route variables are escaped, & repositories are case-insensitive
+	path := strings.ToLower(key[i+1:])
+	repository := strings.ToLower(url.PathEscape(owner) + "/" + url.PathEscape(repo))
+	return path == repository || strings.HasPrefix(path, repository+"/")
+}
+
+// isRepositoryHeadKey reports whether the key of a badge response identifies a badge of the repository of the
+// provider
+func isRepositoryHeadKey(key string, provider string, owner string, repo string) bool {
+	if strings.HasPrefix(key, "token:") {
+		key = key[strings.Index(key, "/")+1:]
+	}
+	if !strings.HasPrefix(key, "/"+provider+"/") {
+		return false
+	}
+	return isRepositoryKey(strings.TrimPrefix(key, "/"+provider+"/"), owner, repo)
+}
+
+// newWebhookHandler returns the handler of `POST /webhook/{provider}`, purging the data cached for the badges of the
+// repository of the payload, so that badges reflect changes (eg. a new release) without waiting for caches to expire.
+// Payloads are only accepted when signed with the webhook secret.
+func newWebhookHandler(configuration *config.Config, logger *zap.Logger, headCache *headResponseCache, purgers map[string]repositoryCachePurger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setNoStoreCacheControlHeader(w, configuration)
+		name := mux.Vars(r)["provider"]
+		provider, ok := webhookProviders[name]
+		purger := purgers[name]
+		if !ok || purger == nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxPayloadSize))
+		if err != nil {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !provider.verify(r, body, configuration.WebhookSecret) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		event, ok := provider.event(r)
+		if !ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		fullName, err := provider.repository(body)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		owner, repo, ok := splitRepositoryName(fullName)
+		if !ok {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		purged := purger.purgeRepository(r.Context(), owner, repo)
+		if headCache != nil {
+			purged += headCache.purge(func(key string) bool {
+				return isRepositoryHeadKey(key, name, owner, repo)
+			})
+		}
+		if logger != nil {
+			logger.Info("Purged cached data of repository",
+				zap.String("provider", name),
+				zap.String("event", event),
+				zap.String("repository", fullName),
+				zap.Int("purged", purged))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(webhookResponse{Repository: fullName, Purged: purged})
+	})
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/tohjustin/aegis/service/config"
+)
+
+const testWebhookSecret = "It's a Secret to Everybody"
+
+func githubWebhookSignature(body string) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newTestWebhookHandler returns the webhook router, with the data of the badges of `google/gopacket` &
+// `gitlab-org/gitlab-runner` cached, along with the data of other repositories
+func newTestWebhookHandler(t *testing.T) (*mux.Router, *githubService, *gitlabService, *headResponseCache, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration := &config.Config{
+		CacheSeconds:      3600,
+		GithubAccessToken: "token",
+		RedisURL:          "redis://" + server.Addr(),
+		RedisCacheSeconds: 300,
+		WebhookSecret:     testWebhookSecret,
+	}
+	github, err := NewGithubService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitlab, err := NewGitlabService(configuration, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	githubService := github.(*githubService)
+	gitlabService := gitlab.(*gitlabService)
+
+	ctx := context.Background()
+	for _, key := range []string{"stars/google/gopacket?", "downloads/google/gopacket/v1.1.19?", "stars/google/gopacket-extra?", "stars/golang/go?"} {
+		githubService.staleValues.set(key, staleValue{value: 1})
+		githubService.results.set(ctx, key+"#", cachedResult{Value: 1})
+	}
+	for _, key := range []string{"issues/gitlab-org%2Fgitlab-runner/gitlab-runner?state=opened", "token:abc/stars/gitlab-org/gitlab-runner?", "stars/gitlab-org/gitlab?"} {
+		gitlabService.staleValues.set(key, staleValue{value: 1})
+	}
+	headCache := newHeadResponseCache(headCacheSize)
+	for _, key := range []string{"/github/stars/google/gopacket?style=flat", "/github/stars/golang/go", "/gitlab/stars/google/gopacket"} {
+		headCache.set(key, http.Header{"Cache-Control": {"max-age=3600"}})
+	}
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Handle(`/webhook/{provider}`, newWebhookHandler(configuration, zap.NewNop(), headCache, map[string]repositoryCachePurger{
+		"github": githubService,
+		"gitlab": gitlabService,
+	})).Methods("POST")
+	return router, githubService, gitlabService, headCache, server
+}
+
+func staleKeys(cache *staleValueCache) []string {
+	keys := []string{}
+	for key := range cache.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func headKeys(cache *headResponseCache) []string {
+	keys := []string{}
+	for key := range cache.responses {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestWebhookSignatureVerification(t *testing.T) {
+	t.Parallel()
+
+	body := `{"repository":{"full_name":"google/gopacket"},"project":{"path_with_namespace":"google/gopacket"}}`
+	testCases := []struct {
+		name    string
+		path    string
+		headers map[string]string
+	}{
+		{"GitHubMissingSignature", "/webhook/github", map[string]string{"X-GitHub-Event": "push"}},
+		{"GitHubWrongSignature", "/webhook/github", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + hex.EncodeToString([]byte("wrong"))}},
+		{"GitHubMalformedSignature", "/webhook/github", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=wrong"}},
+		{"GitHubSHA1Signature", "/webhook/github", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha1=" + githubWebhookSignature(body)[len("sha256="):]}},
+		{"GitHubSignatureOfOtherPayload", "/webhook/github", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": githubWebhookSignature(body + " ")}},
+		{"GitLabMissingToken", "/webhook/gitlab", map[string]string{"X-Gitlab-Event": "Push Hook"}},
+		{"GitLabWrongToken", "/webhook/gitlab", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "wrong"}},
+		{"GitLabSignature", "/webhook/gitlab", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Hub-Signature-256": githubWebhookSignature(body)}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			router, githubService, gitlabService, headCache, server := newTestWebhookHandler(t)
+			defer server.Close()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", testCase.path, bytes.NewBufferString(body))
+			for name, value := range testCase.headers {
+				req.Header.Set(name, value)
+			}
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusUnauthorized, res.Code)
+			assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+			assert.Len(t, githubService.staleValues.values, 4)
+			assert.Len(t, gitlabService.staleValues.values, 3)
+			assert.Len(t, headCache.responses, 3)
+			assert.Len(t, server.Keys(), 4)
+		})
+	}
+}
+
+func TestWebhookPurge(t *testing.T) {
+	t.Parallel()
+
+	t.Run("GitHub", func(t *testing.T) {
+		t.Parallel()
+
+		router, githubService, gitlabService, headCache, server := newTestWebhookHandler(t)
+		defer server.Close()
+
+		body := `{"ref":"refs/heads/master","repository":{"full_name":"Google/GoPacket"}}`
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/webhook/github", bytes.NewBufferString(body))
+		req.Header.Set("X-GitHub-Event", "release")
+		req.Header.Set("X-Hub-Signature-256", githubWebhookSignature(body))
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"repository":"Google/GoPacket","purged":5}`, res.Body.String())
+		assert.ElementsMatch(t, []string{"stars/google/gopacket-extra?", "stars/golang/go?"}, staleKeys(githubService.staleValues))
+		assert.ElementsMatch(t, []string{"aegis:result:github:stars/google/gopacket-extra?#", "aegis:result:github:stars/golang/go?#"}, server.Keys())
+		assert.ElementsMatch(t, []string{"/github/stars/golang/go", "/gitlab/stars/google/gopacket"}, headKeys(headCache))
+		assert.Len(t, gitlabService.staleValues.values, 3)
+	})
+
+	t.Run("GitLab", func(t *testing.T) {
+		t.Parallel()
+
+		router, githubService, gitlabService, headCache, server := newTestWebhookHandler(t)
+		defer server.Close()
+
+		body := `{"object_kind":"push","project":{"path_with_namespace":"gitlab-org/gitlab-runner"}}`
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/webhook/gitlab", bytes.NewBufferString(body))
+		req.Header.Set("X-Gitlab-Event", "Push Hook")
+		req.Header.Set("X-Gitlab-Token", testWebhookSecret)
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.JSONEq(t, `{"repository":"gitlab-org/gitlab-runner","purged":1}`, res.Body.String())
+		// data fetched with an upstream API token is purged too
+		assert.ElementsMatch(t, []string{"issues/gitlab-org%2Fgitlab-runner/gitlab-runner?state=opened", "stars/gitlab-org/gitlab?"}, staleKeys(gitlabService.staleValues))
+		assert.Len(t, githubService.staleValues.values, 4)
+		assert.Len(t, headCache.responses, 3)
+	})
+
+	t.Run("GitLabSubgroup", func(t *testing.T) {
+		t.Parallel()
+
+		router, _, gitlabService, _, server := newTestWebhookHandler(t)
+		defer server.Close()
+
+		body := `{"object_kind":"pipeline","project":{"path_with_namespace":"gitlab-org/gitlab-runner/gitlab-runner"}}`
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/webhook/gitlab", bytes.NewBufferString(body))
+		req.Header.Set("X-Gitlab-Event", "Pipeline Hook")
+		req.Header.Set("X-Gitlab-Token", testWebhookSecret)
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.JSONEq(t, `{"repository":"gitlab-org/gitlab-runner/gitlab-runner","purged":1}`, res.Body.String())
+		assert.ElementsMatch(t, []string{"token:abc/stars/gitlab-org/gitlab-runner?", "stars/gitlab-org/gitlab?"}, staleKeys(gitlabService.staleValues))
+	})
+}
+
+func TestWebhookUnsupportedEvent(t *testing.T) {
+	t.Parallel()
+
+	router, githubService, _, _, server := newTestWebhookHandler(t)
+	defer server.Close()
+
+	body := `{"zen":"Keep it logically awesome.","repository":{"full_name":"google/gopacket"}}`
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhook/github", bytes.NewBufferString(body))
+	req.Header.Set("X-GitHub-Event", "ping")
+	req.Header.Set("X-Hub-Signature-256", githubWebhookSignature(body))
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusAccepted, res.Code)
+	assert.Len(t, githubService.staleValues.values, 4)
+}
+
+func TestWebhookMalformedPayload(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{"InvalidJSON", `{"repository":`},
+		{"MissingRepository", `{"ref":"refs/heads/master"}`},
+		{"InvalidFullName", `{"repository":{"full_name":"gopacket"}}`},
+		{"EmptyRepositoryName", `{"repository":{"full_name":"google/"}}`},
+		{"WrongType", `{"repository":{"full_name":42}}`},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			router, githubService, _, _, server := newTestWebhookHandler(t)
+			defer server.Close()
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/webhook/github", bytes.NewBufferString(testCase.body))
+			req.Header.Set("X-GitHub-Event", "push")
+			req.Header.Set("X-Hub-Signature-256", githubWebhookSignature(testCase.body))
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusBadRequest, res.Code)
+			assert.Len(t, githubService.staleValues.values, 4)
+		})
+	}
+}
+
+func TestWebhookRoute(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		secret         string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"Disabled", "", "POST", "/webhook/github", http.StatusNotFound},
+		{"Enabled", testWebhookSecret, "POST", "/webhook/github", http.StatusUnauthorized},
+		{"UnsupportedProvider", testWebhookSecret, "POST", "/webhook/bitbucket", http.StatusNotFound},
+		{"UnsupportedMethod", testWebhookSecret, "GET", "/webhook/github", http.StatusMethodNotAllowed},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			app := newTestIndexApplication(t, "")
+			app.config.WebhookSecret = testCase.secret
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest(testCase.method, testCase.path, bytes.NewBufferString(`{}`))
+			req.Header.Set("X-GitHub-Event", "push")
+			app.handler().ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatus, res.Code)
+		})
+	}
+}